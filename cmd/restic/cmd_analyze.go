@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+)
+
+var cmdAnalyze = &cobra.Command{
+	Use:   "analyze [flags] file [file...]",
+	Short: "Estimate how much new data a backup of files would add",
+	Long: `
+The "analyze" command splits local files into chunks the same way "backup"
+does and looks up the chunks in the index of the repository. For each file, the
+number of chunks which are already stored in the repository and the number of
+new chunks is printed, together with the amount of new data a backup of the
+file would add and the share of the file which is deduplicated.
+
+Nothing is written to the repository. The estimate is based on the uncompressed
+size of the chunks, so with compression less data may be added.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAnalyze(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdAnalyze)
+}
+
+// analyzeResult describes how a file would be deduplicated against the
+// repository.
+type analyzeResult struct {
+	Path           string  `json:"path"`
+	Size           uint64  `json:"size"`
+	Chunks         int     `json:"chunks"`
+	UniqueChunks   int     `json:"unique_chunks"`
+	ExistingChunks int     `json:"existing_chunks"`
+	ExistingBytes  uint64  `json:"existing_bytes"`
+	NewChunks      int     `json:"new_chunks"`
+	NewBytes       uint64  `json:"new_bytes"`
+	DedupRatio     float64 `json:"dedup_ratio"`
+}
+
+// analyzeFile chunks the file and looks up the chunks in the index. Chunks
+// contained several times in the file are only counted once as new.
+func analyzeFile(repo restic.Repository, filename string) (analyzeResult, error) {
+	pat, err := newContentPattern(repo.Config(), filename)
+	if err != nil {
+		return analyzeResult{}, err
+	}
+
+	res := analyzeResult{
+		Path:         filename,
+		Size:         pat.size,
+		Chunks:       pat.count,
+		UniqueChunks: len(pat.chunks),
+	}
+	for id, c := range pat.chunks {
+		if repo.Index().Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
+			res.ExistingChunks++
+			res.ExistingBytes += uint64(c.size)
+		} else {
+			res.NewChunks++
+			res.NewBytes += uint64(c.size)
+		}
+	}
+
+	if res.Size > 0 {
+		res.DedupRatio = float64(res.Size-res.NewBytes) / float64(res.Size)
+	}
+	return res, nil
+}
+
+func runAnalyze(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) == 0 {
+		return errors.Fatal("no file specified")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	var results []analyzeResult
+	for _, filename := range args {
+		res, err := analyzeFile(repo, filename)
+		if err != nil {
+			return err
+		}
+
+		if gopts.JSON {
+			results = append(results, res)
+			continue
+		}
+
+		Printf("%v: %v in %d chunks (%d unique)\n", res.Path, ui.FormatBytes(res.Size), res.Chunks, res.UniqueChunks)
+		Printf("  existing chunks: %6d  %v\n", res.ExistingChunks, ui.FormatBytes(res.ExistingBytes))
+		Printf("  new chunks:      %6d  %v\n", res.NewChunks, ui.FormatBytes(res.NewBytes))
+		if res.Size > 0 {
+			Printf("  deduplicated:    %v of the file is already stored\n", ui.FormatPercent(res.Size-res.NewBytes, res.Size))
+		}
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(results)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/table"
+	"github.com/spf13/cobra"
+)
+
+var cmdAudit = &cobra.Command{
+	Use:   "audit [flags]",
+	Short: "List the entries of the audit log",
+	Long: `
+The "audit" command lists the entries of the audit log of the repository. With
+the global option --audit-log, the commands "backup", "forget", "prune" and
+"key" record who changed the repository and when in the audit log. Each entry
+contains the time, the hostname and the user, the version of restic and the
+snapshots which have been created or removed.
+
+The entries are stored in the repository, encrypted and authenticated with the
+master key. New entries are only ever added, so writing the audit log also
+works for append-only repositories.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAudit(cmd.Context(), auditOptions, globalOptions, args)
+	},
+}
+
+// AuditOptions bundles all options for the 'audit' command.
+type AuditOptions struct {
+	Actions []string
+}
+
+var auditOptions AuditOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdAudit)
+
+	f := cmdAudit.Flags()
+	f.StringArrayVar(&auditOptions.Actions, "action", nil, "only show entries for `action`, e.g. backup or forget (can be specified multiple times)")
+}
+
+// writeAuditEntry records action in the audit log of the repository if
+// --audit-log is set. Errors are only reported as a warning, the operation
+// itself has succeeded already.
+func writeAuditEntry(ctx context.Context, gopts GlobalOptions, repo restic.SaverUnpacked, action string, snapshots restic.IDs, details string) {
+	if !gopts.AuditLog {
+		return
+	}
+
+	e := restic.NewAuditEntry(action, version, time.Now())
+	e.Snapshots = snapshots
+	e.Details = details
+	_, err := restic.SaveAuditEntry(ctx, repo, e)
+	if err != nil {
+		Warnf("unable to write audit log entry: %v\n", err)
+	}
+}
+
+// auditEntryJSON is the JSON representation of an audit log entry.
+type auditEntryJSON struct {
+	*restic.AuditEntry
+	ID restic.ID `json:"id"`
+}
+
+func runAudit(ctx context.Context, opts AuditOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.Fatal("the audit command expects no arguments, only options - please see `restic help audit` for usage and flags")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	actions := make(map[string]struct{}, len(opts.Actions))
+	for _, action := range opts.Actions {
+		actions[action] = struct{}{}
+	}
+
+	var entries []*restic.AuditEntry
+	err = restic.ForAllAuditEntries(ctx, repo.Backend(), repo, func(id restic.ID, e *restic.AuditEntry, err error) error {
+		if err != nil {
+			Warnf("unable to load audit log entry %v: %v\n", id.Str(), err)
+			return nil
+		}
+		if _, ok := actions[e.Action]; len(actions) > 0 && !ok {
+			return nil
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	if gopts.JSON {
+		out := make([]auditEntryJSON, 0, len(entries))
+		for _, e := range entries {
+			out = append(out, auditEntryJSON{AuditEntry: e, ID: *e.ID()})
+		}
+		return json.NewEncoder(gopts.stdout).Encode(out)
+	}
+
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ID }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Host", "{{ .Host }}")
+	tab.AddColumn("User", "{{ .User }}")
+	tab.AddColumn("Action", "{{ .Action }}")
+	tab.AddColumn("Snapshots", "{{ .Snapshots }}")
+	tab.AddColumn("Details", "{{ .Details }}")
+
+	type data struct {
+		ID        string
+		Time      string
+		Host      string
+		User      string
+		Action    string
+		Snapshots string
+		Details   string
+	}
+
+	for _, e := range entries {
+		snapshots := make([]string, 0, len(e.Snapshots))
+		for _, id := range e.Snapshots {
+			snapshots = append(snapshots, id.Str())
+		}
+		tab.AddRow(data{
+			ID:        e.ID().Str(),
+			Time:      e.Time.Local().Format(TimeFormat),
+			Host:      e.Hostname,
+			User:      e.Username,
+			Action:    e.Action,
+			Snapshots: strings.Join(snapshots, " "),
+			Details:   e.Details,
+		})
+	}
+
+	return tab.Write(gopts.stdout)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
@@ -22,6 +23,7 @@ import (
 	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -65,7 +67,13 @@ Exit status is 3 if some source data could not be read (incomplete snapshot crea
 			wg.Wait()
 		}()
 
-		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		if backupOptions.QuietUntilError {
+			// messages are only printed as context for errors by the
+			// progress printer
+			globalOptions.verbosity = 0
+		}
+
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet || backupOptions.QuietUntilError)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -80,30 +88,62 @@ Exit status is 3 if some source data could not be read (incomplete snapshot crea
 type BackupOptions struct {
 	excludePatternOptions
 
-	Parent            string
-	Force             bool
-	ExcludeOtherFS    bool
-	ExcludeIfPresent  []string
-	ExcludeCaches     bool
-	ExcludeLargerThan string
-	Stdin             bool
-	StdinFilename     string
-	Tags              restic.TagLists
-	Host              string
-	FilesFrom         []string
-	FilesFromVerbatim []string
-	FilesFromRaw      []string
-	TimeStamp         string
-	WithAtime         bool
-	IgnoreInode       bool
-	IgnoreCtime       bool
-	UseFsSnapshot     bool
-	DryRun            bool
-	ReadConcurrency   uint
+	Parent             string
+	Force              bool
+	ExcludeOtherFS     bool
+	WarnOtherFS        bool
+	ExcludeIfPresent   []string
+	ExcludeCaches      bool
+	ExcludeLargerThan  string
+	ExcludeSmallerThan string
+	ExcludeOlderThan   string
+	ExcludeNewerThan   string
+	ExcludeIfXattr     []string
+	Dereference        []string
+	Stdin              bool
+	StdinFilename      string
+	Tags               restic.TagLists
+	Meta               []string
+	Host               string
+	FilesFrom          []string
+	FilesFromVerbatim  []string
+	FilesFromRaw       []string
+	TimeStamp          string
+	WithAtime          bool
+	WithBtime          bool
+	IgnoreInode        bool
+	IgnoreCtime        bool
+	UseFsSnapshot      bool
+	DryRun             bool
+	JSONLog            string
+	QuietUntilError    bool
+	QuietSummary       bool
+	Resume             bool
+	ReadConcurrency    uint
+	ReadTimeout        time.Duration
+	ParallelReadSize   string
+	ParallelReaders    uint
+	Delay              time.Duration
+	Nice               int
+	IONice             string
+	MaxLoad            float64
+	AlsoRepo           []string
+	AlsoPasswordFile   []string
+	ExportManifest     string
+	MinFreeSpace       string
+	SignCommand        string
 }
 
 var backupOptions BackupOptions
 
+// quietContextLines is the number of messages printed before an error with
+// --quiet-until-error.
+const quietContextLines = 20
+
+// checkpointInterval is the interval in which the checkpoint is written with
+// --resume.
+const checkpointInterval = 5 * time.Minute
+
 // ErrInvalidSourceData is used to report an incomplete backup
 var ErrInvalidSourceData = errors.New("at least one source file could not be read")
 
@@ -117,13 +157,32 @@ func init() {
 	initExcludePatternOptions(f, &backupOptions.excludePatternOptions)
 
 	f.BoolVarP(&backupOptions.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems, don't cross filesystem boundaries and subvolumes")
+	f.BoolVar(&backupOptions.WarnOtherFS, "warn-other-fs", false, "print a warning for each directory which is on a different file system than its parent directory, for example mount points")
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes `filename[:header]`, exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file. See https://bford.info/cachedir/ for the Cache Directory Tagging Standard`)
+	f.StringArrayVar(&backupOptions.ExcludeIfXattr, "exclude-if-xattr", nil, "takes `name[=value]`, exclude files and directories with this extended attribute, optionally only if it has the given value (can be specified multiple times)")
 	f.StringVar(&backupOptions.ExcludeLargerThan, "exclude-larger-than", "", "max `size` of the files to be backed up (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.StringVar(&backupOptions.ExcludeSmallerThan, "exclude-smaller-than", "", "min `size` of the files to be backed up (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.StringVar(&backupOptions.ExcludeOlderThan, "exclude-older-than", "", "exclude files last modified before `time`, given as a duration before now like 90d or a date like 2006-01-02")
+	f.StringVar(&backupOptions.ExcludeNewerThan, "exclude-newer-than", "", "exclude files last modified after `time`, given as a duration before now like 1h or a date like 2006-01-02")
+	f.StringArrayVar(&backupOptions.Dereference, "dereference", nil, "follow symlinks matching `pattern` and back up their targets instead of the symlinks (can be specified multiple times)")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin")
-	f.Var(&backupOptions.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]` (can be specified multiple times)")
+	f.Var(&backupOptions.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]`, placeholders like {host} or {date:2006-01-02} are expanded (can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.Meta, "meta", nil, "add the metadata `key=value` to the new snapshot (can be specified multiple times)")
 	f.UintVar(&backupOptions.ReadConcurrency, "read-concurrency", 0, "read `n` files concurrently. (default: $RESTIC_READ_CONCURRENCY or 2)")
+	f.DurationVar(&backupOptions.ReadTimeout, "read-timeout", 0, "skip files for which a single read takes longer than `duration` (default: no timeout)")
+	f.StringVar(&backupOptions.ParallelReadSize, "parallel-read-size", "", "read files of at least `size` with several concurrent readers (allowed suffixes: k/K, m/M, g/G, t/T) (default: disabled)")
+	f.UintVar(&backupOptions.ParallelReaders, "parallel-readers", 0, "use `n` concurrent readers for files selected by --parallel-read-size (default: 4)")
+	f.DurationVar(&backupOptions.Delay, "delay", 0, "wait for a random time of at most `duration` before starting the backup, to spread the backups of many hosts over time (default: no delay)")
+	f.IntVar(&backupOptions.Nice, "nice", 0, "run the backup with the CPU scheduling priority `niceness`, from -20 (highest) to 19 (lowest) (default: unchanged)")
+	f.StringVar(&backupOptions.IONice, "ionice", "", "run the backup with the I/O scheduling `class` idle, best-effort or best-effort:level with a level from 0 to 7 (default: unchanged, Linux only)")
+	f.Float64Var(&backupOptions.MaxLoad, "max-load", 0, "read only one file at a time while the system load average exceeds `load` (default: no limit, Linux only)")
+	f.StringArrayVar(&backupOptions.AlsoRepo, "also-repo", nil, "also save the snapshot to the `repository`, the files are only read once (can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.AlsoPasswordFile, "also-password-file", nil, "read the password of the corresponding --also-repo repository from `file` (can be specified multiple times, default: the password of the repository)")
+	f.StringVar(&backupOptions.ExportManifest, "export-manifest", "", "write the size and content hash of each file in the new snapshot to `file`")
+	f.StringVar(&backupOptions.MinFreeSpace, "min-free-space", "", "abort the backup when less than `size` (e.g. 10G) or a percentage (e.g. 5%) of the repository disk is free (default: no limit, local and sftp only)")
+	f.StringVar(&backupOptions.SignCommand, "sign-command", "", "sign the new snapshot with the detached signature printed by `command`, which reads the snapshot from stdin (default: $RESTIC_SIGN_COMMAND)")
 	f.StringVarP(&backupOptions.Host, "host", "H", "", "set the `hostname` for the snapshot manually. To prevent an expensive rescan use the \"parent\" flag")
 	f.StringVar(&backupOptions.Host, "hostname", "", "set the `hostname` for the snapshot manually")
 	err := f.MarkDeprecated("hostname", "use --host")
@@ -133,12 +192,17 @@ func init() {
 	}
 	f.StringArrayVar(&backupOptions.FilesFrom, "files-from", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringArrayVar(&backupOptions.FilesFromVerbatim, "files-from-verbatim", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
-	f.StringArrayVar(&backupOptions.FilesFromRaw, "files-from-raw", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.FilesFromRaw, "files-from-raw", nil, "read the zero byte or newline separated files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "`time` of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
+	f.BoolVar(&backupOptions.WithBtime, "with-btime", false, "store the birth time for all files and directories if the file system records it")
 	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore inode number changes when checking for modified files")
 	f.BoolVar(&backupOptions.IgnoreCtime, "ignore-ctime", false, "ignore ctime changes when checking for modified files")
 	f.BoolVarP(&backupOptions.DryRun, "dry-run", "n", false, "do not upload or write any data, just show what would be done")
+	f.StringVar(&backupOptions.JSONLog, "json-log", "", "additionally write progress messages in JSON format to `file`")
+	f.BoolVar(&backupOptions.QuietUntilError, "quiet-until-error", false, "do not print anything unless an error occurs, then also print the preceding messages")
+	f.BoolVar(&backupOptions.QuietSummary, "quiet-summary", false, "with --quiet-until-error, print a single summary line after a successful backup")
+	f.BoolVar(&backupOptions.Resume, "resume", false, "record saved files in a checkpoint and skip the files saved by a previous, interrupted backup of the same targets")
 	if runtime.GOOS == "windows" {
 		f.BoolVar(&backupOptions.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshot where possible (currently only Windows VSS)")
 	}
@@ -146,6 +210,37 @@ func init() {
 	// parse read concurrency from env, on error the default value will be used
 	readConcurrency, _ := strconv.ParseUint(os.Getenv("RESTIC_READ_CONCURRENCY"), 10, 32)
 	backupOptions.ReadConcurrency = uint(readConcurrency)
+	backupOptions.SignCommand = os.Getenv("RESTIC_SIGN_COMMAND")
+}
+
+// delayStart waits for a random time of at most max, such that backups which
+// are scheduled at the same time on many hosts do not all access the
+// repository at once. The wait ends early when ctx is cancelled.
+func delayStart(ctx context.Context, max time.Duration, report bool) error {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	delay := time.Duration(r.Int63n(int64(max) + 1)).Round(time.Second)
+	if delay > max {
+		delay = max
+	}
+
+	debug.Log("delaying the start of the backup by %v", delay)
+	if report {
+		Verbosef("waiting %v before starting the backup\n", delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	if report {
+		Verbosef("starting the backup at %v\n", time.Now().Format(TimeFormat))
+	}
+	return nil
 }
 
 // filterExisting returns a slice of all existing items, or an error if no
@@ -208,8 +303,8 @@ func readLines(filename string) ([]string, error) {
 }
 
 // readFilenamesFromFileRaw reads a list of filenames from the given file,
-// or stdin if filename is "-". Each filename is terminated by a zero byte,
-// which is stripped off.
+// or stdin if filename is "-". The filenames are separated as described for
+// readFilenamesRaw.
 func readFilenamesFromFileRaw(filename string) (names []string, err error) {
 	f := os.Stdin
 	if filename != "-" {
@@ -233,30 +328,43 @@ func readFilenamesFromFileRaw(filename string) (names []string, err error) {
 	return names, nil
 }
 
+// readFilenamesRaw reads a list of filenames from r. If the data contains a
+// zero byte, each filename must be terminated by a zero byte, so that the
+// filenames may contain newlines. Otherwise, the filenames are separated by
+// newlines. The filenames are returned exactly as they are, without removing
+// whitespace or decoding them.
 func readFilenamesRaw(r io.Reader) (names []string, err error) {
-	br := bufio.NewReader(r)
-	for {
-		name, err := br.ReadString(0)
-		switch err {
-		case nil:
-		case io.EOF:
-			if name == "" {
-				return names, nil
-			}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	sep := byte('\n')
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = 0
+		if data[len(data)-1] != 0 {
 			return nil, errors.Fatal("--files-from-raw: trailing zero byte missing")
-		default:
-			return nil, err
 		}
+	}
 
-		name = name[:len(name)-1]
-		if name == "" {
+	// the last filename does not need to be terminated by a newline
+	if data[len(data)-1] == sep {
+		data = data[:len(data)-1]
+	}
+
+	for _, name := range bytes.Split(data, []byte{sep}) {
+		if len(name) == 0 {
 			// The empty filename is never valid. Handle this now to
 			// prevent downstream code from erroneously backing up
 			// filepath.Clean("") == ".".
 			return nil, errors.Fatal("--files-from-raw: empty filename in listing")
 		}
-		names = append(names, name)
+		names = append(names, string(name))
 	}
+	return names, nil
 }
 
 // Check returns an error when an invalid combination of options was set.
@@ -284,6 +392,68 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 		if len(args) > 0 {
 			return errors.Fatal("--stdin was specified and files/dirs were listed as arguments")
 		}
+		if len(opts.Dereference) > 0 {
+			return errors.Fatal("--stdin and --dereference cannot be used together")
+		}
+	}
+
+	if err := filter.ValidatePatterns(opts.Dereference); err != nil {
+		return errors.Fatalf("--dereference: %s", err)
+	}
+
+	if len(opts.ExcludeIfXattr) > 0 && !restic.XattrSupported {
+		return errors.Fatalf("--exclude-if-xattr is not supported on %v", runtime.GOOS)
+	}
+
+	if opts.Delay < 0 {
+		return errors.Fatal("--delay must not be negative")
+	}
+
+	if opts.Nice < -20 || opts.Nice > 19 {
+		return errors.Fatal("--nice must be between -20 and 19")
+	}
+	if opts.IONice != "" {
+		if _, err := parseIOPriority(opts.IONice); err != nil {
+			return err
+		}
+	}
+	if opts.MaxLoad < 0 {
+		return errors.Fatal("--max-load must not be negative")
+	}
+	if opts.ParallelReadSize != "" {
+		if size, err := parseSizeStr(opts.ParallelReadSize); err != nil || size <= 0 {
+			return errors.Fatalf("invalid argument for --parallel-read-size: %q", opts.ParallelReadSize)
+		}
+	}
+	if opts.ParallelReaders != 0 && opts.ParallelReadSize == "" {
+		return errors.Fatal("--parallel-readers requires --parallel-read-size")
+	}
+	if opts.MinFreeSpace != "" {
+		if _, err := parseMinFreeSpace(opts.MinFreeSpace); err != nil {
+			return errors.Fatalf("invalid argument for --min-free-space: %v", err)
+		}
+	}
+
+	if len(opts.AlsoPasswordFile) > len(opts.AlsoRepo) {
+		return errors.Fatal("--also-password-file was given more often than --also-repo")
+	}
+	if len(opts.AlsoRepo) > 0 && opts.Resume {
+		return errors.Fatal("--also-repo and --resume cannot be used together")
+	}
+
+	if opts.Resume && opts.Stdin {
+		return errors.Fatal("--resume and --stdin cannot be used together")
+	}
+
+	if opts.ExportManifest != "" && opts.DryRun {
+		return errors.Fatal("--export-manifest and --dry-run cannot be used together")
+	}
+
+	if opts.QuietUntilError && gopts.JSON {
+		return errors.Fatal("--quiet-until-error and --json cannot be used together")
+	}
+	if opts.QuietSummary && !opts.QuietUntilError {
+		return errors.Fatal("--quiet-summary requires --quiet-until-error")
 	}
 
 	return nil
@@ -336,8 +506,24 @@ func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets
 		fs = append(fs, f)
 	}
 
-	if len(opts.ExcludeLargerThan) != 0 && !opts.Stdin {
-		f, err := rejectBySize(opts.ExcludeLargerThan)
+	if (len(opts.ExcludeLargerThan) != 0 || len(opts.ExcludeSmallerThan) != 0) && !opts.Stdin {
+		f, err := rejectBySize(opts.ExcludeSmallerThan, opts.ExcludeLargerThan)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+
+	if (len(opts.ExcludeOlderThan) != 0 || len(opts.ExcludeNewerThan) != 0) && !opts.Stdin {
+		f, err := rejectByAge(opts.ExcludeOlderThan, opts.ExcludeNewerThan, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+
+	if len(opts.ExcludeIfXattr) > 0 && !opts.Stdin {
+		f, err := rejectByXattr(opts.ExcludeIfXattr)
 		if err != nil {
 			return nil, err
 		}
@@ -444,6 +630,31 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
+	metadata, err := restic.ParseMetadata(opts.Meta)
+	if err != nil {
+		return errors.Fatalf("invalid argument for --meta: %v", err)
+	}
+
+	if opts.Delay > 0 {
+		// report the delay unless the output must not contain anything but
+		// JSON or the backup is supposed to be quiet
+		report := !gopts.JSON && !opts.QuietUntilError
+		err = delayStart(ctx, opts.Delay, report)
+		if err != nil {
+			return err
+		}
+	}
+
+	setBackupPriority(opts)
+
+	limitByLoad := opts.MaxLoad > 0
+	if limitByLoad {
+		if _, err := loadAverage(); err != nil {
+			Warnf("ignoring --max-load, the load average is not available: %v\n", err)
+			limitByLoad = false
+		}
+	}
+
 	timeStamp := time.Now()
 	if opts.TimeStamp != "" {
 		timeStamp, err = time.ParseInLocation(TimeFormat, opts.TimeStamp, time.Local)
@@ -461,17 +672,87 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
+	alsoRepos, err := openAlsoRepositories(ctx, opts, gopts, repo)
+	if err != nil {
+		return err
+	}
+
+	// nothing is written to the repository for a dry run
+	var minFree minFreeSpace
+	freeSpaceBackend := backendFreeSpace
+	checkSpace := opts.MinFreeSpace != "" && !opts.DryRun
+	if checkSpace {
+		minFree, _ = parseMinFreeSpace(opts.MinFreeSpace)
+		if freeSpaceBackend == nil {
+			return errors.Fatal("--min-free-space is only supported for local and sftp repositories")
+		}
+		if err := checkFreeSpace(ctx, freeSpaceBackend, minFree); err != nil {
+			return errors.Fatalf("unable to start backup: %v", err)
+		}
+	}
+
 	var progressPrinter backup.ProgressPrinter
 	if gopts.JSON {
 		progressPrinter = backup.NewJSONProgress(term, gopts.verbosity)
 	} else {
-		progressPrinter = backup.NewTextProgress(term, gopts.verbosity)
+		verbosity := gopts.verbosity
+		if opts.QuietUntilError {
+			// print all messages when they are shown as context for an error
+			verbosity = 3
+		}
+
+		textPrinter := backup.NewTextProgress(term, verbosity)
+		textPrinter.DryRun = opts.DryRun
+		progressPrinter = textPrinter
+
+		if opts.QuietUntilError {
+			quiet := backup.NewQuietProgress(textPrinter, quietContextLines)
+			quiet.SummaryLine = opts.QuietSummary
+			progressPrinter = quiet
+		}
+	}
+
+	if opts.JSONLog != "" {
+		f, err := os.Create(opts.JSONLog)
+		if err != nil {
+			return errors.Fatalf("unable to create JSON log: %v", err)
+		}
+
+		// the log has its own terminal, which is stopped once the backup
+		// has finished so that all messages are written to the file
+		logCtx, logCancel := context.WithCancel(context.Background())
+		logTerm := termstatus.New(f, f, true)
+		logDone := make(chan struct{})
+		go func() {
+			logTerm.Run(logCtx)
+			close(logDone)
+		}()
+		defer func() {
+			logCancel()
+			<-logDone
+			_ = f.Close()
+		}()
+
+		progressPrinter = backup.NewMultiPrinter(progressPrinter, backup.NewJSONProgress(logTerm, gopts.verbosity))
 	}
 	progressReporter := backup.NewProgress(progressPrinter,
-		calculateProgressInterval(!gopts.Quiet, gopts.JSON))
+		calculateProgressInterval(!gopts.Quiet, gopts.JSON), uint64(gopts.Limits.UploadKb)*1024)
+	if !gopts.JSON && !term.CanUpdateStatus() {
+		// only print a new status line for each percent of progress to avoid
+		// flooding logs, json output is consumed by tools so it is not limited
+		progressReporter.SetMinPercentDelta(1)
+	}
+	if repo.Config().Version >= 2 {
+		progressReporter.SetCompression(gopts.Compression.String())
+	}
+	pauseGate := archiver.NewPauseGate()
+	progressReporter.PauseGate = pauseGate
 
 	if opts.DryRun {
 		repo.SetDryRun()
+		for _, r := range alsoRepos {
+			r.SetDryRun()
+		}
 	}
 
 	// use the terminal for stdout/stderr
@@ -489,11 +770,20 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	if !gopts.JSON {
 		progressPrinter.V("lock repository")
 	}
-	lock, ctx, err := lockRepo(ctx, repo)
+	// backups of different hosts do not conflict
+	lock, ctx, err := lockRepoScoped(ctx, repo, restic.HostLockScope(opts.Host))
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
+	for _, r := range alsoRepos {
+		var alsoLock *restic.Lock
+		alsoLock, ctx, err = lockRepoScoped(ctx, r, restic.HostLockScope(opts.Host))
+		defer unlockRepo(alsoLock)
+		if err != nil {
+			return err
+		}
+	}
 
 	// rejectByNameFuncs collect functions that can reject items from the backup based on path only
 	rejectByNameFuncs, err := collectRejectByNameFuncs(opts, repo, targets)
@@ -507,19 +797,25 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
-	var parentSnapshot *restic.Snapshot
-	if !opts.Stdin {
-		parentSnapshot, err = findParentSnapshot(ctx, repo, opts, targets, timeStamp)
-		if err != nil {
-			return err
-		}
+	// data read from stdin is saved as a single file, the previous snapshot
+	// of a file with the same name is used as the parent
+	stdinFilename := path.Join("/", opts.StdinFilename)
+	parentTargets := targets
+	if opts.Stdin {
+		parentTargets = []string{stdinFilename}
+	}
 
-		if !gopts.JSON {
-			if parentSnapshot != nil {
-				progressPrinter.P("using parent snapshot %v\n", parentSnapshot.ID().Str())
-			} else {
-				progressPrinter.P("no parent snapshot found, will read all files\n")
-			}
+	parentSnapshot, err := findParentSnapshot(ctx, repo, opts, parentTargets, timeStamp)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.JSON {
+		switch {
+		case parentSnapshot != nil:
+			progressPrinter.P("using parent snapshot %v\n", parentSnapshot.ID().Str())
+		case !opts.Stdin:
+			progressPrinter.P("no parent snapshot found, will read all files\n")
 		}
 	}
 
@@ -531,6 +827,38 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
+	// the backup is saved to all repositories through a fanout, the parent
+	// snapshot and the unchanged files are taken from the first one
+	repos := append([]*repository.Repository{repo}, alsoRepos...)
+	var archRepo restic.Repository = repo
+	var fanout *repository.Fanout
+	if len(alsoRepos) > 0 {
+		fanout, err = repository.NewFanout(repos...)
+		if err != nil {
+			return err
+		}
+		for _, r := range alsoRepos {
+			err = r.LoadIndex(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		archRepo = fanout
+	}
+
+	var checkpoint *archiver.Checkpoint
+	var checkpointFile string
+	if opts.Resume {
+		checkpoint, checkpointFile, err = loadCheckpoint(repo, opts.Host, targets)
+		if err != nil {
+			return err
+		}
+
+		if checkpoint.Len() > 0 && !gopts.JSON {
+			progressPrinter.P("resuming backup, %d files have been saved before\n", checkpoint.Len())
+		}
+	}
+
 	selectByNameFilter := func(item string) bool {
 		for _, reject := range rejectByNameFuncs {
 			if reject(item) {
@@ -573,14 +901,13 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		if !gopts.JSON {
 			progressPrinter.V("read data from stdin")
 		}
-		filename := path.Join("/", opts.StdinFilename)
 		targetFS = &fs.Reader{
 			ModTime:    timeStamp,
-			Name:       filename,
+			Name:       stdinFilename,
 			Mode:       0644,
 			ReadCloser: os.Stdin,
 		}
-		targets = []string{filename}
+		targets = []string{stdinFilename}
 	}
 
 	sc := archiver.NewScanner(targetFS)
@@ -588,16 +915,58 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	sc.Select = selectFilter
 	sc.Error = progressPrinter.ScannerError
 	sc.Result = progressReporter.ReportTotal
+	sc.TopLevel = progressReporter.ReportTopLevel
+	if len(opts.Dereference) > 0 {
+		sc.Dereference = dereferenceByPattern(opts.Dereference)
+	}
 
 	if !gopts.JSON {
 		progressPrinter.V("start scan on %v", targets)
 	}
 	wg.Go(func() error { return sc.Scan(cancelCtx, targets) })
 
-	arch := archiver.New(repo, targetFS, archiver.Options{ReadConcurrency: backupOptions.ReadConcurrency})
+	archOpts := archiver.Options{
+		ReadConcurrency: backupOptions.ReadConcurrency,
+		ReadTimeout:     opts.ReadTimeout,
+		ParallelReaders: opts.ParallelReaders,
+	}
+	if opts.ParallelReadSize != "" {
+		size, _ := parseSizeStr(opts.ParallelReadSize)
+		archOpts.ParallelReadSize = uint64(size)
+	}
+	arch := archiver.New(archRepo, targetFS, archOpts)
 	arch.SelectByName = selectByNameFilter
 	arch.Select = selectFilter
 	arch.WithAtime = opts.WithAtime
+	arch.WithBtime = opts.WithBtime
+	arch.PauseGate = pauseGate
+	if limitByLoad {
+		readers := arch.Options.ReadConcurrency
+		arch.ReadLimiter = archiver.NewReadLimiter(readers)
+		wg.Go(func() error {
+			limitReadersByLoad(cancelCtx, arch.ReadLimiter, loadAverage, opts.MaxLoad, readers, loadCheckInterval, func(limit uint, load float64) {
+				if !gopts.JSON {
+					progressPrinter.V("load average is %.2f, limiting the number of files read concurrently to %d", load, limit)
+				}
+			})
+			return nil
+		})
+	}
+	// the backup is aborted once the free space in the repository drops
+	// below --min-free-space
+	snapshotCtx, cancelSnapshot := context.WithCancel(ctx)
+	defer cancelSnapshot()
+	var freeSpaceErr error
+	if checkSpace {
+		wg.Go(func() error {
+			watchFreeSpace(cancelCtx, freeSpaceBackend, minFree, freeSpaceCheckInterval, func(err error) {
+				freeSpaceErr = err
+				_ = progressPrinter.Error("", errors.Errorf("%v, aborting backup", err))
+				cancelSnapshot()
+			})
+			return nil
+		})
+	}
 	success := true
 	arch.Error = func(item string, err error) error {
 		success = false
@@ -605,7 +974,33 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	}
 	arch.CompleteItem = progressReporter.CompleteItem
 	arch.StartFile = progressReporter.StartFile
+	arch.StartTarget = progressReporter.StartTarget
 	arch.CompleteBlob = progressReporter.CompleteBlob
+	arch.BlobSaved = progressReporter.BlobSaved
+	if !opts.Stdin {
+		// the size of data read from stdin is not known in advance
+		arch.ChangedDuringRead = progressReporter.ChangedDuringRead
+	}
+	arch.SkipItem = progressReporter.SkipFile
+	arch.ParallelRead = progressReporter.ParallelRead
+	if opts.WarnOtherFS {
+		arch.FilesystemBoundary = progressReporter.FilesystemBoundary
+	}
+	if len(opts.Dereference) > 0 {
+		arch.Dereference = dereferenceByPattern(opts.Dereference)
+		arch.Dereferenced = progressReporter.Dereferenced
+		arch.SymlinkLoop = progressReporter.SymlinkLoop
+	}
+	if checkpoint != nil {
+		arch.Checkpoint = checkpoint
+		arch.ResumeFile = progressReporter.ResumeFile
+		if !opts.DryRun {
+			wg.Go(func() error {
+				writeCheckpoints(cancelCtx, repo, checkpoint, checkpointFile)
+				return nil
+			})
+		}
+	}
 
 	if opts.IgnoreInode {
 		// --ignore-inode implies --ignore-ctime: on FUSE, the ctime is not
@@ -619,6 +1014,7 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	snapshotOpts := archiver.SnapshotOptions{
 		Excludes:       opts.Excludes,
 		Tags:           opts.Tags.Flatten(),
+		Metadata:       metadata,
 		Time:           timeStamp,
 		Hostname:       opts.Host,
 		ParentSnapshot: parentSnapshot,
@@ -627,24 +1023,86 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	if !gopts.JSON {
 		progressPrinter.V("start backup on %v", targets)
 	}
-	_, id, err := arch.Snapshot(ctx, targets, snapshotOpts)
+	sn, id, err := arch.Snapshot(snapshotCtx, targets, snapshotOpts)
 
 	// cleanly shutdown all running goroutines
 	cancel()
 
 	// let's see if one returned an error
 	werr := wg.Wait()
+	if freeSpaceErr != nil && err != nil {
+		err = freeSpaceErr
+	}
+
+	var fanoutResults []repository.FanoutResult
+	if fanout != nil {
+		fanoutResults = fanout.Results()
+	}
+
+	if checkpoint != nil && !opts.DryRun {
+		if err != nil {
+			// keep the files saved so far for the next attempt
+			if cerr := writeCheckpoint(context.Background(), repo, checkpoint, checkpointFile); cerr != nil {
+				Warnf("unable to write checkpoint: %v\n", cerr)
+			}
+		} else if rerr := os.Remove(checkpointFile); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			Warnf("unable to remove checkpoint: %v\n", rerr)
+		}
+	}
 
 	// return original error
 	if err != nil {
+		if fanout != nil {
+			printFanoutResults(progressPrinter, gopts, opts, fanoutResults)
+		}
 		return errors.Fatalf("unable to save snapshot: %v", err)
 	}
 
 	// Report finished execution
+	progressReporter.SetBackendStats(backendAccounting.Stats())
 	progressReporter.Finish(id, opts.DryRun)
 	if !gopts.JSON && !opts.DryRun {
 		progressPrinter.P("snapshot %s saved\n", id.Str())
 	}
+	if !opts.DryRun {
+		if fanout == nil {
+			writeAuditEntry(ctx, gopts, repo, "backup", restic.IDs{id}, "")
+		}
+		for i, res := range fanoutResults {
+			if snID, ok := fanoutSnapshotID(res); ok {
+				writeAuditEntry(ctx, gopts, repos[i], "backup", restic.IDs{snID}, "")
+			}
+		}
+	}
+	if opts.SignCommand != "" && !opts.DryRun {
+		snapshots := []signedSnapshot{{repo: repo, id: id}}
+		if fanout != nil {
+			snapshots = snapshots[:0]
+			for i, res := range fanoutResults {
+				if snID, ok := fanoutSnapshotID(res); ok {
+					snapshots = append(snapshots, signedSnapshot{repo: repos[i], id: snID})
+				}
+			}
+		}
+		err = signSnapshot(ctx, opts.SignCommand, snapshots)
+		if err != nil {
+			return errors.Fatalf("unable to sign snapshot %s: %v", id.Str(), err)
+		}
+		Verbosef("snapshot %s signed\n", id.Str())
+	}
+	if opts.ExportManifest != "" {
+		err = writeBackupManifest(ctx, repo, sn, opts.ExportManifest)
+		if err != nil {
+			return err
+		}
+		Verbosef("manifest of snapshot %s written to %v\n", id.Str(), opts.ExportManifest)
+	}
+	if fanout != nil {
+		failed := printFanoutResults(progressPrinter, gopts, opts, fanoutResults)
+		if failed > 0 {
+			return errors.Fatalf("unable to save the snapshot to %d of %d repositories", failed, len(fanoutResults))
+		}
+	}
 	if !success {
 		return ErrInvalidSourceData
 	}
@@ -652,3 +1110,61 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	// Return error if any
 	return werr
 }
+
+// loadCheckpoint loads the checkpoint for a backup of targets on host from
+// the cache directory and returns it along with its filename. If the targets
+// differ from those of the checkpoint, an empty checkpoint is returned.
+func loadCheckpoint(repo *repository.Repository, host string, targets []string) (*archiver.Checkpoint, string, error) {
+	if repo.Cache == nil {
+		return nil, "", errors.Fatal("--resume requires the local cache")
+	}
+
+	absTargets := make([]string, 0, len(targets))
+	for _, target := range targets {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return nil, "", err
+		}
+		absTargets = append(absTargets, abs)
+	}
+
+	hostID := restic.Hash([]byte(host))
+	name := "backup-checkpoint-" + hostID.Str() + ".json"
+	filename := filepath.Join(repo.Cache.BaseDir(), repo.Config().ID, name)
+
+	checkpoint, err := archiver.LoadCheckpoint(filename, absTargets)
+	if err != nil {
+		Warnf("unable to load checkpoint, starting from scratch: %v\n", err)
+		checkpoint = archiver.NewCheckpoint(absTargets)
+	}
+	return checkpoint, filename, nil
+}
+
+// writeCheckpoint saves the index for all uploaded data and then the
+// checkpoint. Files in the checkpoint are only skipped if their data is
+// contained in the index, so the order matters.
+func writeCheckpoint(ctx context.Context, repo *repository.Repository, checkpoint *archiver.Checkpoint, filename string) error {
+	err := repo.SaveIndex(ctx)
+	if err != nil {
+		return err
+	}
+	return checkpoint.Save(filename)
+}
+
+// writeCheckpoints periodically writes the checkpoint until ctx is cancelled.
+func writeCheckpoints(ctx context.Context, repo *repository.Repository, checkpoint *archiver.Checkpoint, filename string) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			debug.Log("writing checkpoint with %d files", checkpoint.Len())
+			if err := writeCheckpoint(ctx, repo, checkpoint, filename); err != nil {
+				Warnf("unable to write checkpoint: %v\n", err)
+			}
+		}
+	}
+}
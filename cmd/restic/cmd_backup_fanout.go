@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/backup"
+)
+
+// openAlsoRepositories opens the repositories passed to --also-repo. Unless a
+// password file is given for a repository, the password of the main
+// repository is used. All repositories must use the same chunker parameters
+// as the main repository repo.
+func openAlsoRepositories(ctx context.Context, opts BackupOptions, gopts GlobalOptions, repo *repository.Repository) ([]*repository.Repository, error) {
+	if len(opts.AlsoRepo) == 0 {
+		return nil, nil
+	}
+
+	// the statistics shown at the end of the backup and the free space
+	// checked for --min-free-space are those of the main repository
+	accounting, freeSpace := backendAccounting, backendFreeSpace
+	defer func() {
+		backendAccounting, backendFreeSpace = accounting, freeSpace
+	}()
+
+	var repos []*repository.Repository
+	for i, loc := range opts.AlsoRepo {
+		alsoGopts := gopts
+		alsoGopts.Repo = loc
+		alsoGopts.RepositoryFile = ""
+		if i < len(opts.AlsoPasswordFile) {
+			alsoGopts.PasswordFile = opts.AlsoPasswordFile[i]
+			alsoGopts.PasswordCommand = ""
+			alsoGopts.KeyProvider = ""
+
+			var err error
+			alsoGopts.password, err = resolvePassword(alsoGopts, "")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		r, err := OpenRepository(ctx, alsoGopts)
+		if err != nil {
+			return nil, errors.Fatalf("unable to open repository %v: %v", location.StripPassword(loc), err)
+		}
+		if !repository.SameChunker(r.Config(), repo.Config()) {
+			return nil, errors.Fatalf("repository %v uses different chunker parameters than the main repository, "+
+				"create it with `restic init --copy-chunker-params` to back up to both at once", location.StripPassword(loc))
+		}
+		repos = append(repos, r)
+	}
+	return repos, nil
+}
+
+// fanoutSnapshotID returns the ID of the snapshot saved to a repository of a
+// backup with --also-repo. The snapshot is encrypted for each repository, so
+// the IDs differ.
+func fanoutSnapshotID(res repository.FanoutResult) (restic.ID, bool) {
+	if res.Err != nil || len(res.Unpacked) == 0 {
+		return restic.ID{}, false
+	}
+	return res.Unpacked[len(res.Unpacked)-1], true
+}
+
+// printFanoutResults prints what was saved to each of the repositories of a
+// backup with --also-repo, and returns the number of repositories for which
+// saving the snapshot failed.
+func printFanoutResults(printer backup.ProgressPrinter, gopts GlobalOptions, opts BackupOptions, results []repository.FanoutResult) int {
+	main, _ := ReadRepo(gopts)
+	names := append([]string{main}, opts.AlsoRepo...)
+
+	failed := 0
+	for i, res := range results {
+		name := location.StripPassword(names[i])
+		if res.Err != nil {
+			failed++
+			Warnf("unable to save the snapshot to repository %v: %v\n", name, res.Err)
+			continue
+		}
+		if gopts.JSON {
+			continue
+		}
+
+		verb := "added"
+		if opts.DryRun {
+			verb = "would add"
+		}
+		id, ok := fanoutSnapshotID(res)
+		if opts.DryRun || !ok {
+			printer.P("repository %v: %s %s (%s stored)\n", name, verb,
+				ui.FormatBytes(res.DataAdded), ui.FormatBytes(res.DataAddedPacked))
+		} else {
+			printer.P("repository %v: snapshot %s saved, %s %s (%s stored)\n", name, id.Str(), verb,
+				ui.FormatBytes(res.DataAdded), ui.FormatBytes(res.DataAddedPacked))
+		}
+	}
+	return failed
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+)
+
+// manifestEntry is a line of the manifest written with --export-manifest.
+type manifestEntry struct {
+	Path string    `json:"path"`
+	Size uint64    `json:"size"`
+	Hash restic.ID `json:"hash"`
+}
+
+// newManifestEntry returns the manifest entry for the file node at path. Like
+// for `stats --mode files-by-contents`, the hash is computed from the IDs of
+// the file's blobs, files with the same content have the same hash as long as
+// the repositories use the same chunker parameters.
+func newManifestEntry(path string, node *restic.Node) manifestEntry {
+	return manifestEntry{
+		Path: path,
+		Size: node.Size,
+		Hash: restic.ID(makeFileIDByContents(node)),
+	}
+}
+
+// writeBackupManifest walks the tree of the snapshot sn and writes a line in
+// JSON format for each file it contains to filename.
+func writeBackupManifest(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, filename string) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Fatalf("unable to create the manifest: %v", err)
+	}
+
+	wr := bufio.NewWriter(f)
+	enc := json.NewEncoder(wr)
+	err = walker.Walk(ctx, repo, *sn.Tree, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		if node == nil || node.Type != "file" {
+			return false, nil
+		}
+		return false, enc.Encode(newManifestEntry(nodepath, node))
+	})
+	if err == nil {
+		err = wr.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Fatalf("unable to write the manifest: %v", err)
+	}
+	return nil
+}
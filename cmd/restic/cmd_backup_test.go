@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,7 +10,9 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/errors"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -104,10 +107,47 @@ func TestReadFilenamesRaw(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), "empty filename"),
 		"wrong error message: %v", err.Error())
 
-	// No trailing NUL byte is an error, because it likely means we're
-	// reading a line-oriented text file (someone forgot -print0).
-	_, err = readFilenamesRaw(strings.NewReader("simple.txt"))
+	// No trailing NUL byte is an error when the filenames are NUL-terminated.
+	_, err = readFilenamesRaw(strings.NewReader("foo\x00simple.txt"))
 	rtest.Assert(t, err != nil, "no error for zero byte")
 	rtest.Assert(t, strings.Contains(err.Error(), "zero byte"),
 		"wrong error message: %v", err.Error())
 }
+
+func TestReadFilenamesRawNewline(t *testing.T) {
+	// These should all be returned exactly as-is.
+	expected := []string{
+		"\xef\xbb\xbf/utf-8-bom",
+		"/absolute",
+		"\t\t leading and trailing space   \t\t",
+		"not UTF-8: \x80\xff/simple",
+		"# not a comment",
+	}
+
+	for _, input := range []string{
+		strings.Join(expected, "\n"),
+		strings.Join(expected, "\n") + "\n",
+	} {
+		got, err := readFilenamesRaw(strings.NewReader(input))
+		rtest.OK(t, err)
+		rtest.Equals(t, expected, got)
+	}
+
+	_, err := readFilenamesRaw(strings.NewReader("foo\n\nbar\n"))
+	rtest.Assert(t, err != nil, "no error for empty line")
+	rtest.Assert(t, strings.Contains(err.Error(), "empty filename"),
+		"wrong error message: %v", err.Error())
+}
+
+func TestDelayStart(t *testing.T) {
+	start := time.Now()
+	rtest.OK(t, delayStart(context.TODO(), 1500*time.Millisecond, false))
+	rtest.Assert(t, time.Since(start) < 3*time.Second, "delay of %v is longer than the maximum", time.Since(start))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	start = time.Now()
+	err := delayStart(ctx, time.Hour, false)
+	rtest.Assert(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+	rtest.Assert(t, time.Since(start) < time.Second, "cancelled delay took %v", time.Since(start))
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+var cmdCacheWarm = &cobra.Command{
+	Use:   "warm [flags] snapshotID",
+	Short: "Download the trees of a snapshot into the local cache",
+	Long: `
+The "warm" command walks the tree of a snapshot and downloads all packs
+containing its directories into the local cache, so that later operations on
+the snapshot, for example "ls", "find" or "mount", don't have to load them from
+the repository. With --data, the packs containing the file contents are
+downloaded as well. Packs which are cached already are skipped.
+
+With --max-size, no further packs are downloaded once the cache for the
+repository would grow beyond the given size.
+
+The special snapshot "latest" can be used to use the latest snapshot in the
+repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCacheWarm(cmd.Context(), cacheWarmOptions, globalOptions, args)
+	},
+}
+
+// CacheWarmOptions bundles all options for the 'cache warm' command.
+type CacheWarmOptions struct {
+	snapshotFilterOptions
+	Data    bool
+	MaxSize string
+}
+
+var cacheWarmOptions CacheWarmOptions
+
+func init() {
+	cmdCache.AddCommand(cmdCacheWarm)
+
+	f := cmdCacheWarm.Flags()
+	initSingleSnapshotFilterOptions(f, &cacheWarmOptions.snapshotFilterOptions)
+	f.BoolVar(&cacheWarmOptions.Data, "data", false, "also download the packs containing the file contents")
+	f.StringVar(&cacheWarmOptions.MaxSize, "max-size", "", "stop when the cache for the repository would exceed `size` (allowed suffixes: k/K, m/M, g/G, t/T)")
+}
+
+// errCacheFull is returned by cacheWarmer when the maximum size is reached.
+var errCacheFull = errors.New("maximum cache size reached")
+
+// cacheWarmer downloads packs into the cache and keeps track of the cache size.
+type cacheWarmer struct {
+	repo    restic.Repository
+	be      *cache.Backend
+	sizes   map[restic.ID]int64
+	maxSize int64
+	bar     *progress.Counter
+
+	mu     sync.Mutex
+	seen   restic.IDSet
+	size   int64
+	full   bool
+	warmed struct {
+		packs int
+		bytes int64
+	}
+	cached int
+}
+
+// warmPack downloads the pack id into the cache unless it has been warmed before.
+func (w *cacheWarmer) warmPack(ctx context.Context, id restic.ID, tpe restic.BlobType) error {
+	w.mu.Lock()
+	if w.seen.Has(id) {
+		w.mu.Unlock()
+		return nil
+	}
+
+	h := restic.Handle{Type: restic.PackFile, Name: id.String(), ContainedBlobType: tpe}
+	if w.be.Has(h) {
+		w.seen.Insert(id)
+		w.cached++
+		w.mu.Unlock()
+		return nil
+	}
+
+	size := w.sizes[id]
+	if w.maxSize > 0 && w.size+size > w.maxSize {
+		w.full = true
+		w.mu.Unlock()
+		return errCacheFull
+	}
+	w.seen.Insert(id)
+	// reserve the space so that concurrent downloads respect the maximum size
+	w.size += size
+	w.mu.Unlock()
+
+	err := w.be.Warm(ctx, h)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		w.size -= size
+		return err
+	}
+	w.warmed.packs++
+	w.warmed.bytes += size
+	w.bar.Add(1)
+	return nil
+}
+
+// warmBlob downloads the pack containing the blob into the cache.
+func (w *cacheWarmer) warmBlob(ctx context.Context, bh restic.BlobHandle) error {
+	packs := w.repo.Index().Lookup(bh)
+	if len(packs) == 0 {
+		// let the caller report the missing blob
+		return nil
+	}
+	return w.warmPack(ctx, packs[0].PackID, bh.Type)
+}
+
+// cacheWarmLoader warms the pack of each tree before it is loaded.
+type cacheWarmLoader struct {
+	restic.Repository
+	w *cacheWarmer
+}
+
+func (l cacheWarmLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	err := l.w.warmBlob(ctx, restic.BlobHandle{ID: id, Type: t})
+	if err != nil {
+		return nil, err
+	}
+	return l.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+func runCacheWarm(ctx context.Context, opts CacheWarmOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("no snapshot ID specified")
+	}
+
+	if gopts.NoCache {
+		return errors.Fatal("Refusing to do anything, the cache is disabled")
+	}
+
+	var maxSize int64
+	if opts.MaxSize != "" {
+		var err error
+		maxSize, err = parseSizeStr(opts.MaxSize)
+		if err != nil {
+			return errors.Fatalf("invalid argument for --max-size: %v", err)
+		}
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	be, ok := repo.Backend().(*cache.Backend)
+	if repo.Cache == nil || !ok {
+		return errors.Fatal("the cache could not be opened")
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	sn, err := findSingleSnapshot(ctx, repo.Backend(), repo, opts.snapshotFilterOptions, args[0])
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+
+	Verbosef("load index files\n")
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	sizes := make(map[restic.ID]int64)
+	err = repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		sizes[id] = size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cacheDir := filepath.Join(repo.Cache.BaseDir(), repo.Config().ID)
+	size, err := dirSize(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	w := &cacheWarmer{
+		repo:    repo,
+		be:      be,
+		sizes:   sizes,
+		maxSize: maxSize,
+		seen:    restic.NewIDSet(),
+		size:    size,
+	}
+
+	Verbosef("warm tree packs of snapshot %v\n", sn.ID().Str())
+	w.bar = newProgressMax(!gopts.Quiet, 0, "tree packs warmed")
+	blobs := restic.NewBlobSet()
+	err = restic.FindUsedBlobs(ctx, cacheWarmLoader{repo, w}, restic.IDs{*sn.Tree}, blobs, nil)
+	w.bar.Done()
+	if err != nil && !errors.Is(err, errCacheFull) {
+		return err
+	}
+
+	if opts.Data && !w.full {
+		dataPacks := restic.NewIDSet()
+		for bh := range blobs {
+			if bh.Type != restic.DataBlob {
+				continue
+			}
+			if packs := repo.Index().Lookup(bh); len(packs) > 0 {
+				dataPacks.Insert(packs[0].PackID)
+			}
+		}
+
+		Verbosef("warm data packs of snapshot %v\n", sn.ID().Str())
+		w.bar = newProgressMax(!gopts.Quiet, uint64(len(dataPacks)), "data packs warmed")
+		err = warmDataPacks(ctx, w, dataPacks, int(repo.Connections()))
+		w.bar.Done()
+		if err != nil && !errors.Is(err, errCacheFull) {
+			return err
+		}
+	}
+
+	if w.full {
+		Warnf("stopped warming the cache, it would exceed the maximum size of %s\n", ui.FormatBytes(uint64(maxSize)))
+	}
+
+	Printf("warmed %d packs (%s), %d packs were cached already\n",
+		w.warmed.packs, ui.FormatBytes(uint64(w.warmed.bytes)), w.cached)
+
+	size, err = dirSize(cacheDir)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 {
+		Printf("cache size: %s of %s (%s)\n", ui.FormatBytes(uint64(size)),
+			ui.FormatBytes(uint64(maxSize)), ui.FormatPercent(uint64(size), uint64(maxSize)))
+	} else {
+		Printf("cache size: %s\n", ui.FormatBytes(uint64(size)))
+	}
+
+	return nil
+}
+
+// warmDataPacks downloads the packs into the cache using the given number of
+// workers.
+func warmDataPacks(ctx context.Context, w *cacheWarmer, packs restic.IDSet, workers int) error {
+	wg, ctx := errgroup.WithContext(ctx)
+	ch := make(chan restic.ID)
+
+	wg.Go(func() error {
+		defer close(ch)
+		for id := range packs {
+			select {
+			case ch <- id:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < workers; i++ {
+		wg.Go(func() error {
+			for id := range ch {
+				err := w.warmPack(ctx, id, restic.DataBlob)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return wg.Wait()
+}
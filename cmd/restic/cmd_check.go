@@ -4,6 +4,7 @@ import (
 	"context"
 	"io/ioutil"
 	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +17,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 )
 
 var cmdCheck = &cobra.Command{
@@ -28,6 +30,19 @@ finds. It can also be used to read all data and therefore simulate a restore.
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
 
+With --read-data --incremental, the packs verified by the check are recorded in
+the local cache. The next incremental check only reads the packs added since
+then, plus a random sample of the previously verified packs which is set with
+--incremental-sample. The record is discarded when packs were removed from the
+repository, e.g. by prune, and all packs are read again.
+
+With --orphaned, only the pack files which are not referenced by any index are
+listed with their sizes, the rest of the repository is not checked. Such packs
+are left behind by interrupted backups or prune runs, or their index files were
+lost. Pass --remove together with --confirm to delete them; if index files may
+have been lost, run "restic rebuild-index" first, since the packs would still
+contain data referenced by snapshots.
+
 EXIT STATUS
 ===========
 
@@ -48,6 +63,15 @@ type CheckOptions struct {
 	ReadDataSubset string
 	CheckUnused    bool
 	WithCache      bool
+
+	ReadConcurrency uint
+
+	Incremental       bool
+	IncrementalSample float64
+
+	Orphaned bool
+	Remove   bool
+	Confirm  bool
 }
 
 var checkOptions CheckOptions
@@ -66,12 +90,33 @@ func init() {
 		panic(err)
 	}
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use the cache")
+	f.UintVar(&checkOptions.ReadConcurrency, "read-concurrency", 0, "download `n` packs concurrently with --read-data and --read-data-subset (default: number of backend connections)")
+	f.BoolVar(&checkOptions.Incremental, "incremental", false, "with --read-data, only read the packs added since the last incremental check")
+	f.Float64Var(&checkOptions.IncrementalSample, "incremental-sample", 5, "with --incremental, also read a random sample of `percent` of the previously verified packs")
+	f.BoolVar(&checkOptions.Orphaned, "orphaned", false, "only list the pack files which are not referenced by any index")
+	f.BoolVar(&checkOptions.Remove, "remove", false, "with --orphaned, remove the orphaned pack files (requires --confirm)")
+	f.BoolVar(&checkOptions.Confirm, "confirm", false, "confirm removing the orphaned pack files (with --remove)")
 }
 
 func checkFlags(opts CheckOptions) error {
 	if opts.ReadData && opts.ReadDataSubset != "" {
 		return errors.Fatal("check flags --read-data and --read-data-subset cannot be used together")
 	}
+	if opts.Incremental && !opts.ReadData {
+		return errors.Fatal("check flag --incremental requires --read-data")
+	}
+	if opts.IncrementalSample < 0 || opts.IncrementalSample > 100 {
+		return errors.Fatal("check flag --incremental-sample must be at least 0 and at most 100")
+	}
+	if opts.Orphaned && (opts.ReadData || opts.ReadDataSubset != "") {
+		return errors.Fatal("check flag --orphaned cannot be used together with --read-data or --read-data-subset")
+	}
+	if opts.Remove && !opts.Orphaned {
+		return errors.Fatal("check flag --remove requires --orphaned")
+	}
+	if opts.Confirm && !opts.Remove {
+		return errors.Fatal("check flag --confirm requires --remove")
+	}
 	if opts.ReadDataSubset != "" {
 		dataSubset, err := stringToIntSlice(opts.ReadDataSubset)
 		argumentError := errors.Fatal("check flag --read-data-subset has invalid value, please see documentation")
@@ -196,6 +241,21 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	if len(args) != 0 {
 		return errors.Fatal("the check command expects no arguments, only options - please see `restic help check` for usage and flags")
 	}
+	if opts.Remove && gopts.NoLock {
+		// a concurrent backup may have uploaded packs which are not indexed yet
+		return errors.Fatal("--remove cannot be used with --no-lock")
+	}
+
+	// the state of incremental checks is kept in the default cache, check
+	// itself uses a temporary cache unless --with-cache is given
+	var stateDir string
+	if opts.Incremental {
+		var err error
+		stateDir, err = checkStateDir(gopts, "--incremental")
+		if err != nil {
+			return err
+		}
+	}
 
 	cleanup := prepareCheckCache(opts, &gopts)
 	AddCleanupHandler(func(code int) (int, error) {
@@ -258,6 +318,10 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		return errors.Fatal("LoadIndex returned errors")
 	}
 
+	if opts.Orphaned {
+		return checkOrphanedPacks(ctx, opts, gopts, repo, chkr)
+	}
+
 	orphanedPacks := 0
 	errChan := make(chan error)
 
@@ -316,10 +380,14 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		}
 	}
 
+	chkr.ReadConcurrency = opts.ReadConcurrency
 	doReadData := func(packs map[restic.ID]int64) {
-		packCount := uint64(len(packs))
+		var size uint64
+		for _, packSize := range packs {
+			size += uint64(packSize)
+		}
 
-		p := newProgressMax(!gopts.Quiet, packCount, "packs")
+		p := newProgressBytes(!gopts.Quiet, size, "read")
 		errChan := make(chan error)
 
 		go chkr.ReadPacks(ctx, packs, p, errChan)
@@ -332,6 +400,24 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	}
 
 	switch {
+	case opts.ReadData && opts.Incremental:
+		stateFile := checker.CheckStateFile(stateDir, repo.Config().ID, checker.CheckScope)
+		start := time.Now()
+		allPacks := chkr.GetPacks()
+		packs := selectIncrementalPacks(stateFile, allPacks, opts.IncrementalSample)
+		doReadData(packs)
+
+		if !errorsFound {
+			// the packs which were not read have been verified before
+			state := checker.NewCheckState(start, allPacks)
+			for id := range allPacks {
+				state.Checked(id, nil)
+			}
+			err = state.Save(stateFile)
+			if err != nil {
+				Warnf("unable to write check state: %v\n", err)
+			}
+		}
 	case opts.ReadData:
 		Verbosef("read all data\n")
 		doReadData(selectPacksByBucket(chkr.GetPacks(), 1, 1))
@@ -381,6 +467,115 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	return nil
 }
 
+// checkOrphanedPacks lists the packs which are not referenced by any index and
+// removes them with --remove --confirm.
+func checkOrphanedPacks(ctx context.Context, opts CheckOptions, gopts GlobalOptions, repo restic.Repository, chkr *checker.Checker) error {
+	Verbosef("list orphaned packs\n")
+	orphaned, err := chkr.OrphanedPacks(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(orphaned) == 0 {
+		Printf("no orphaned packs found\n")
+		return nil
+	}
+
+	ids := make(restic.IDs, 0, len(orphaned))
+	var size uint64
+	for id, packSize := range orphaned {
+		ids = append(ids, id)
+		size += uint64(packSize)
+	}
+	sort.Sort(ids)
+
+	for _, id := range ids {
+		Printf("%v %10s\n", id, ui.FormatBytes(uint64(orphaned[id])))
+	}
+	Printf("%d orphaned packs, %s in total\n", len(ids), ui.FormatBytes(size))
+
+	if !opts.Remove {
+		return nil
+	}
+	if !opts.Confirm {
+		return errors.Fatalf("removing the orphaned packs cannot be undone, pass --confirm to remove %d packs", len(ids))
+	}
+
+	err = DeleteFilesChecked(ctx, gopts, repo, restic.NewIDSet(ids...), restic.PackFile)
+	if err != nil {
+		return err
+	}
+	DeletePackManifests(ctx, gopts, repo, restic.NewIDSet(ids...))
+	Printf("removed %d orphaned packs, %s were freed\n", len(ids), ui.FormatBytes(size))
+	return nil
+}
+
+// checkStateDir returns the directory which holds the check state, this is the
+// default cache directory unless --cache-dir is given. flag is the option which
+// needs the state, it is used in the error message if the cache is disabled.
+func checkStateDir(gopts GlobalOptions, flag string) (string, error) {
+	if gopts.NoCache {
+		return "", errors.Fatalf("%s requires the local cache", flag)
+	}
+	if gopts.CacheDir != "" {
+		return gopts.CacheDir, nil
+	}
+	return cache.DefaultDir()
+}
+
+// selectIncrementalPacks returns the packs which have not been verified by the
+// previous incremental check recorded in stateFile, along with a random sample
+// of percentage of the packs which have been verified. All packs are returned if
+// there is no usable state.
+func selectIncrementalPacks(stateFile string, allPacks map[restic.ID]int64, percentage float64) map[restic.ID]int64 {
+	state, err := checker.LoadCheckState(stateFile)
+	if err != nil {
+		Warnf("unable to load check state, reading all data: %v\n", err)
+		state = nil
+	}
+	if state != nil && !state.Valid(allPacks) {
+		Printf("packs were removed since the last incremental check, probably by prune, reading all data\n")
+		state = nil
+	}
+	if state == nil {
+		Verbosef("read all data\n")
+		return allPacks
+	}
+
+	previous := state.Verified()
+	packs := make(map[restic.ID]int64)
+	verified := make(map[restic.ID]int64)
+	for id, size := range allPacks {
+		if previous.Has(id) {
+			verified[id] = size
+		} else {
+			packs[id] = size
+		}
+	}
+	newPacks := len(packs)
+
+	if percentage > 0 {
+		for id, size := range selectRandomPacksByPercentage(verified, percentage) {
+			packs[id] = size
+			delete(verified, id)
+		}
+	}
+
+	var readSize, skippedSize uint64
+	for _, size := range packs {
+		readSize += uint64(size)
+	}
+	for _, size := range verified {
+		skippedSize += uint64(size)
+	}
+
+	Printf("last incremental check at %v\n", state.Time.Format(TimeFormat))
+	Printf("read %d new packs and %d of %d previously verified packs (%s), skipped %d packs (%s)\n",
+		newPacks, len(packs)-newPacks, len(previous), ui.FormatBytes(readSize),
+		len(verified), ui.FormatBytes(skippedSize))
+	return packs
+}
+
 // selectPacksByBucket selects subsets of packs by ranges of buckets.
 func selectPacksByBucket(allPacks map[restic.ID]int64, bucket, totalBuckets uint) map[restic.ID]int64 {
 	packs := make(map[restic.ID]int64)
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/table"
+	"github.com/spf13/cobra"
+)
+
+var cmdCheckBackend = &cobra.Command{
+	Use:   "check-backend",
+	Short: "Test that the repository backend is reachable and writable",
+	Long: `
+The "check-backend" command performs a small round trip against the backend of
+the repository: it lists the lock files, uploads a temporary lock file, reads
+it back and removes it again. The duration of each operation is reported. This
+allows detecting wrong credentials or network problems before starting a long
+running operation.
+
+The temporary lock file is not exclusive, it only blocks commands which
+require an exclusive lock for the duration of the check.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCheckBackend(cmd.Context(), globalOptions, args)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdCheckBackend)
+}
+
+// checkBackendOperation is the result of a single backend operation.
+type checkBackendOperation struct {
+	Operation string  `json:"operation"`
+	Duration  float64 `json:"duration"`
+	Error     string  `json:"error,omitempty"`
+	Skipped   bool    `json:"skipped,omitempty"`
+}
+
+// checkBackendResult is the result of the 'check-backend' command.
+type checkBackendResult struct {
+	Operations []checkBackendOperation `json:"operations"`
+	Success    bool                    `json:"success"`
+}
+
+// run measures the duration of fn and records it as the operation name. If skip
+// is set, fn is not called and the operation is recorded as skipped.
+func (r *checkBackendResult) run(name string, skip bool, fn func() error) bool {
+	if skip {
+		r.Operations = append(r.Operations, checkBackendOperation{Operation: name, Skipped: true})
+		return false
+	}
+
+	start := time.Now()
+	err := fn()
+	op := checkBackendOperation{
+		Operation: name,
+		Duration:  time.Since(start).Seconds(),
+	}
+	if err != nil {
+		op.Error = err.Error()
+		r.Success = false
+	}
+	r.Operations = append(r.Operations, op)
+	return err == nil
+}
+
+func runCheckBackend(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.Fatal("the check-backend command expects no arguments, only options - please see `restic help check-backend` for usage and flags")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	// the temporary file is a valid lock so that other processes can load it
+	hostname, _ := os.Hostname()
+	lock := restic.Lock{
+		Time:     time.Now(),
+		Hostname: hostname,
+		PID:      os.Getpid(),
+	}
+	buf, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+
+	result := checkBackendResult{Success: true}
+	be := repo.Backend()
+
+	result.run("list", false, func() error {
+		return be.List(ctx, restic.LockFile, func(restic.FileInfo) error {
+			return nil
+		})
+	})
+
+	var id restic.ID
+	saved := result.run("save", false, func() error {
+		var err error
+		id, err = repo.SaveUnpacked(ctx, restic.LockFile, buf)
+		return err
+	})
+
+	result.run("load", !saved, func() error {
+		data, err := repo.LoadUnpacked(ctx, restic.LockFile, id, nil)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, buf) {
+			return errors.New("loaded data differs from saved data")
+		}
+		return nil
+	})
+
+	result.run("remove", !saved, func() error {
+		return be.Remove(ctx, restic.Handle{Type: restic.LockFile, Name: id.String()})
+	})
+
+	if gopts.JSON {
+		err = json.NewEncoder(gopts.stdout).Encode(result)
+		if err != nil {
+			return err
+		}
+	} else {
+		printCheckBackendResult(gopts, result)
+	}
+
+	if !result.Success {
+		return errors.Fatal("backend check failed")
+	}
+	return nil
+}
+
+func printCheckBackendResult(gopts GlobalOptions, result checkBackendResult) {
+	tab := table.New()
+	tab.AddColumn("Operation", "{{ .Operation }}")
+	tab.AddColumn("Duration", "{{ .Duration }}")
+	tab.AddColumn("Result", "{{ .Result }}")
+
+	type data struct {
+		Operation string
+		Duration  string
+		Result    string
+	}
+
+	for _, op := range result.Operations {
+		row := data{Operation: op.Operation, Result: "ok"}
+		switch {
+		case op.Skipped:
+			row.Result = "skipped"
+		case op.Error != "":
+			row.Result = op.Error
+		}
+		if !op.Skipped {
+			row.Duration = fmt.Sprintf("%8.3fs", op.Duration)
+		}
+		tab.AddRow(row)
+	}
+
+	_ = tab.Write(gopts.stdout)
+}
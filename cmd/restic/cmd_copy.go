@@ -3,11 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	copyui "github.com/restic/restic/internal/ui/copy"
+	"github.com/restic/restic/internal/ui/termstatus"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/spf13/cobra"
@@ -30,9 +33,31 @@ This means that copied files, which existed in both the source and destination
 repository, /may occupy up to twice their space/ in the destination repository.
 This can be mitigated by the "--copy-chunker-params" option when initializing a
 new destination repository using the "init" command.
+
+The progress shows the number of blobs and bytes copied, blobs which are
+already present in the destination repository are not copied again. An
+interrupted copy can therefore be resumed by running the command again. The
+blobs are transferred in parallel using up to the number of backend
+connections of the source repository.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runCopy(cmd.Context(), copyOptions, globalOptions, args)
+		ctx := cmd.Context()
+		var wg sync.WaitGroup
+		cancelCtx, cancel := context.WithCancel(ctx)
+		defer func() {
+			// shutdown termstatus
+			cancel()
+			wg.Wait()
+		}()
+
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			term.Run(cancelCtx)
+		}()
+
+		return runCopy(ctx, copyOptions, globalOptions, term, args)
 	},
 }
 
@@ -52,7 +77,7 @@ func init() {
 	initMultiSnapshotFilterOptions(f, &copyOptions.snapshotFilterOptions, true)
 }
 
-func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []string) error {
+func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
 	secondaryGopts, isFromRepo, err := fillSecondaryGlobalOpts(opts.secondaryRepoOptions, gopts, "destination")
 	if err != nil {
 		return err
@@ -116,11 +141,30 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		dstSnapshotByOriginal[*sn.ID()] = append(dstSnapshotByOriginal[*sn.ID()], sn)
 	}
 
+	var progressPrinter copyui.ProgressPrinter
+	if gopts.JSON {
+		progressPrinter = copyui.NewJSONProgress(term, gopts.verbosity)
+	} else {
+		progressPrinter = copyui.NewTextProgress(term, gopts.verbosity)
+	}
+	progress := copyui.NewProgress(progressPrinter, calculateProgressInterval(!gopts.Quiet, gopts.JSON))
+
+	progressCtx, cancelProgress := context.WithCancel(ctx)
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		progress.Run(progressCtx)
+	}()
+	defer func() {
+		cancelProgress()
+		<-progressDone
+	}()
+
 	// remember already processed trees across all snapshots
 	visitedTrees := restic.NewIDSet()
 
 	for sn := range FindFilteredSnapshots(ctx, srcSnapshotLister, srcRepo, opts.Hosts, opts.Tags, opts.Paths, args) {
-		Verbosef("\nsnapshot %s of %v at %s)\n", sn.ID().Str(), sn.Paths, sn.Time)
+		progressPrinter.V("\nsnapshot %s of %v at %s)\n", sn.ID().Str(), sn.Paths, sn.Time)
 
 		// check whether the destination has a snapshot with the same persistent ID which has similar snapshot fields
 		srcOriginal := *sn.ID()
@@ -131,7 +175,7 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 			isCopy := false
 			for _, originalSn := range originalSns {
 				if similarSnapshots(originalSn, sn) {
-					Verbosef("skipping source snapshot %s, was already copied to snapshot %s\n", sn.ID().Str(), originalSn.ID().Str())
+					progressPrinter.V("skipping source snapshot %s, was already copied to snapshot %s\n", sn.ID().Str(), originalSn.ID().Str())
 					isCopy = true
 					break
 				}
@@ -140,8 +184,8 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 				continue
 			}
 		}
-		Verbosef("  copy started, this may take a while...\n")
-		if err := copyTree(ctx, srcRepo, dstRepo, visitedTrees, *sn.Tree, gopts.Quiet); err != nil {
+		progressPrinter.V("  copy started, this may take a while...\n")
+		if err := copyTree(ctx, srcRepo, dstRepo, visitedTrees, *sn.Tree, progress); err != nil {
 			return err
 		}
 		debug.Log("tree copied")
@@ -156,8 +200,13 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		if err != nil {
 			return err
 		}
-		Verbosef("snapshot %s saved\n", newID.Str())
+		progressPrinter.V("snapshot %s saved\n", newID.Str())
+		progress.CompleteSnapshot()
 	}
+
+	cancelProgress()
+	<-progressDone
+	progress.Finish()
 	return nil
 }
 
@@ -181,7 +230,7 @@ func similarSnapshots(sna *restic.Snapshot, snb *restic.Snapshot) bool {
 }
 
 func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Repository,
-	visitedTrees restic.IDSet, rootTreeID restic.ID, quiet bool) error {
+	visitedTrees restic.IDSet, rootTreeID restic.ID, progress *copyui.Progress) error {
 
 	wg, wgCtx := errgroup.WithContext(ctx)
 
@@ -192,14 +241,30 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 	}, nil)
 
 	copyBlobs := restic.NewBlobSet()
+	existingBlobs := restic.NewBlobSet()
 	packList := restic.NewIDSet()
 
 	enqueue := func(h restic.BlobHandle) {
+		if dstRepo.Index().Has(h) {
+			if !existingBlobs.Has(h) {
+				existingBlobs.Insert(h)
+				size, _ := srcRepo.LookupBlobSize(h.ID, h.Type)
+				progress.ExistingBlob(uint64(size))
+			}
+			return
+		}
+		if copyBlobs.Has(h) {
+			return
+		}
+
 		pb := srcRepo.Index().Lookup(h)
 		copyBlobs.Insert(h)
 		for _, p := range pb {
 			packList.Insert(p.PackID)
 		}
+		if len(pb) > 0 {
+			progress.AddBlob(uint64(pb[0].DataLength()))
+		}
 	}
 
 	wg.Go(func() error {
@@ -208,21 +273,14 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 				return fmt.Errorf("LoadTree(%v) returned error %v", tree.ID.Str(), tree.Error)
 			}
 
-			// Do we already have this tree blob?
-			treeHandle := restic.BlobHandle{ID: tree.ID, Type: restic.TreeBlob}
-			if !dstRepo.Index().Has(treeHandle) {
-				// copy raw tree bytes to avoid problems if the serialization changes
-				enqueue(treeHandle)
-			}
+			// copy raw tree bytes to avoid problems if the serialization changes
+			enqueue(restic.BlobHandle{ID: tree.ID, Type: restic.TreeBlob})
 
 			for _, entry := range tree.Nodes {
 				// Recursion into directories is handled by StreamTrees
 				// Copy the blobs for this file.
 				for _, blobID := range entry.Content {
-					h := restic.BlobHandle{Type: restic.DataBlob, ID: blobID}
-					if !dstRepo.Index().Has(h) {
-						enqueue(h)
-					}
+					enqueue(restic.BlobHandle{Type: restic.DataBlob, ID: blobID})
 				}
 			}
 		}
@@ -233,8 +291,9 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 		return err
 	}
 
-	bar := newProgressMax(!quiet, uint64(len(packList)), "packs copied")
-	_, err = repository.Repack(ctx, srcRepo, dstRepo, packList, copyBlobs, bar)
-	bar.Done()
-	return err
+	debug.Log("copying %d blobs, %d blobs are already present", len(copyBlobs), len(existingBlobs))
+	return repository.CopyBlobs(ctx, srcRepo, dstRepo, packList, copyBlobs, int(srcRepo.Connections()),
+		func(blob restic.BlobHandle, size uint, known bool) {
+			progress.CompleteBlob(uint64(size), known)
+		})
 }
@@ -28,6 +28,18 @@ directory:
 * U  The metadata (access mode, timestamps, ...) for the item was updated
 * M  The file's content was modified
 * T  The type was changed, e.g. a file was made a symlink
+* B  The birth time of the item changed, i.e. it was recreated (only for
+     snapshots created with "backup --with-btime")
+
+With --only, only the given categories of changes are shown: "added",
+"removed", "modified-content", "modified-metadata" (includes changes of the
+birth time), "modified" (both kinds of modifications) and "type-changed". The
+statistics then only count the shown changes, unless --all-stats is given.
+
+With --content, the contents of the given file in both snapshots are compared
+instead and the changed lines are shown as a unified diff. The path is the path
+of the file in the snapshots, e.g. "/home/user/notes.txt". Binary files are only
+reported as differing.
 
 EXIT STATUS
 ===========
@@ -43,6 +55,9 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 // DiffOptions collects all options for the diff command.
 type DiffOptions struct {
 	ShowMetadata bool
+	Only         []string
+	AllStats     bool
+	Content      []string
 }
 
 var diffOptions DiffOptions
@@ -52,6 +67,9 @@ func init() {
 
 	f := cmdDiff.Flags()
 	f.BoolVar(&diffOptions.ShowMetadata, "metadata", false, "print changes in metadata")
+	f.StringSliceVar(&diffOptions.Only, "only", nil, "only show changes of the given `categories` (added, removed, modified, modified-content, modified-metadata, type-changed)")
+	f.BoolVar(&diffOptions.AllStats, "all-stats", false, "count all changes in the statistics, regardless of --only")
+	f.StringArrayVar(&diffOptions.Content, "content", nil, "show the changed lines of the file at `path` in the snapshots (can be specified multiple times)")
 }
 
 func loadSnapshot(ctx context.Context, be restic.Lister, repo restic.Repository, desc string) (*restic.Snapshot, error) {
@@ -62,13 +80,92 @@ func loadSnapshot(ctx context.Context, be restic.Lister, repo restic.Repository,
 	return sn, err
 }
 
+// changeFilter selects the categories of changes which are shown.
+type changeFilter struct {
+	added, removed, content, metadata, typeChanged bool
+}
+
+// newChangeFilter returns a filter for the categories given with --only. All
+// changes are shown if no category is given.
+func newChangeFilter(only []string) (changeFilter, error) {
+	if len(only) == 0 {
+		return changeFilter{added: true, removed: true, content: true, metadata: true, typeChanged: true}, nil
+	}
+
+	var f changeFilter
+	for _, category := range only {
+		switch category {
+		case "added":
+			f.added = true
+		case "removed":
+			f.removed = true
+		case "modified":
+			f.content = true
+			f.metadata = true
+		case "modified-content":
+			f.content = true
+		case "modified-metadata":
+			f.metadata = true
+		case "type-changed":
+			f.typeChanged = true
+		default:
+			return changeFilter{}, errors.Fatalf("invalid category %q for --only", category)
+		}
+	}
+	return f, nil
+}
+
+// matches returns true if the change described by modifier belongs to one of
+// the selected categories.
+func (f changeFilter) matches(modifier string) bool {
+	for _, m := range modifier {
+		switch m {
+		case '+':
+			if f.added {
+				return true
+			}
+		case '-':
+			if f.removed {
+				return true
+			}
+		case 'M':
+			if f.content {
+				return true
+			}
+		case 'U', 'B':
+			if f.metadata {
+				return true
+			}
+		case 'T':
+			if f.typeChanged {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Comparer collects all things needed to compare two snapshots.
 type Comparer struct {
 	repo        restic.Repository
 	opts        DiffOptions
+	filter      changeFilter
 	printChange func(change *Change)
 }
 
+// report prints the change unless it is excluded by the filter.
+func (c *Comparer) report(path, modifier string) {
+	if c.filter.matches(modifier) {
+		c.printChange(NewChange(path, modifier))
+	}
+}
+
+// counts returns true if a change described by modifier is included in the
+// statistics.
+func (c *Comparer) counts(modifier string) bool {
+	return c.opts.AllStats || c.filter.matches(modifier)
+}
+
 type Change struct {
 	MessageType string `json:"message_type"` // "change"
 	Path        string `json:"path"`
@@ -134,6 +231,7 @@ type DiffStatsContainer struct {
 	SourceSnapshot                       string         `json:"source_snapshot"`
 	TargetSnapshot                       string         `json:"target_snapshot"`
 	ChangedFiles                         int            `json:"changed_files"`
+	ChangedMetadata                      int            `json:"changed_metadata,omitempty"`
 	Added                                DiffStat       `json:"added"`
 	Removed                              DiffStat       `json:"removed"`
 	BlobsBefore, BlobsAfter, BlobsCommon restic.BlobSet `json:"-"`
@@ -171,8 +269,10 @@ func (c *Comparer) printDir(ctx context.Context, mode string, stats *DiffStat, b
 		if node.Type == "dir" {
 			name += "/"
 		}
-		c.printChange(NewChange(name, mode))
-		stats.Add(node)
+		c.report(name, mode)
+		if c.counts(mode) {
+			stats.Add(node)
+		}
 		addBlobs(blobs, node)
 
 		if node.Type == "dir" {
@@ -268,13 +368,24 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, pref
 				node2.Type == "file" &&
 				!reflect.DeepEqual(node1.Content, node2.Content) {
 				mod += "M"
-				stats.ChangedFiles++
+				if c.counts("M") {
+					stats.ChangedFiles++
+				}
 			} else if c.opts.ShowMetadata && !node1.Equals(*node2) {
 				mod += "U"
+				if c.counts("U") {
+					stats.ChangedMetadata++
+				}
+			}
+
+			// the birth time is only compared if both snapshots recorded it
+			if !node1.BirthTime.IsZero() && !node2.BirthTime.IsZero() &&
+				!node1.BirthTime.Equal(node2.BirthTime) {
+				mod += "B"
 			}
 
 			if mod != "" {
-				c.printChange(NewChange(name, mod))
+				c.report(name, mod)
 			}
 
 			if node1.Type == "dir" && node2.Type == "dir" {
@@ -293,8 +404,10 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, pref
 			if node1.Type == "dir" {
 				prefix += "/"
 			}
-			c.printChange(NewChange(prefix, "-"))
-			stats.Removed.Add(node1)
+			c.report(prefix, "-")
+			if c.counts("-") {
+				stats.Removed.Add(node1)
+			}
 
 			if node1.Type == "dir" {
 				err := c.printDir(ctx, "-", &stats.Removed, stats.BlobsBefore, prefix, *node1.Subtree)
@@ -307,8 +420,10 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, pref
 			if node2.Type == "dir" {
 				prefix += "/"
 			}
-			c.printChange(NewChange(prefix, "+"))
-			stats.Added.Add(node2)
+			c.report(prefix, "+")
+			if c.counts("+") {
+				stats.Added.Add(node2)
+			}
 
 			if node2.Type == "dir" {
 				err := c.printDir(ctx, "+", &stats.Added, stats.BlobsAfter, prefix, *node2.Subtree)
@@ -327,6 +442,15 @@ func runDiff(ctx context.Context, opts DiffOptions, gopts GlobalOptions, args []
 		return errors.Fatalf("specify two snapshot IDs")
 	}
 
+	filter, err := newChangeFilter(opts.Only)
+	if err != nil {
+		return err
+	}
+	if len(opts.Only) > 0 && filter.metadata {
+		// metadata changes must be detected to show them
+		opts.ShowMetadata = true
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -372,9 +496,30 @@ func runDiff(ctx context.Context, opts DiffOptions, gopts GlobalOptions, args []
 		return errors.Errorf("snapshot %v has nil tree", sn2.ID().Str())
 	}
 
+	if len(opts.Content) > 0 {
+		enc := json.NewEncoder(gopts.stdout)
+		for _, p := range opts.Content {
+			d, err := diffContent(ctx, repo, sn1, sn2, p)
+			if err != nil {
+				return err
+			}
+
+			if gopts.JSON {
+				err = enc.Encode(d)
+				if err != nil {
+					Warnf("JSON encode failed: %v\n", err)
+				}
+			} else {
+				printContentDiff(d)
+			}
+		}
+		return nil
+	}
+
 	c := &Comparer{
-		repo: repo,
-		opts: diffOptions,
+		repo:   repo,
+		opts:   opts,
+		filter: filter,
 		printChange: func(change *Change) {
 			Printf("%-5s%v\n", change.Modifier, change.Path)
 		},
@@ -422,6 +567,9 @@ func runDiff(ctx context.Context, opts DiffOptions, gopts GlobalOptions, args []
 	} else {
 		Printf("\n")
 		Printf("Files:       %5d new, %5d removed, %5d changed\n", stats.Added.Files, stats.Removed.Files, stats.ChangedFiles)
+		if opts.ShowMetadata {
+			Printf("Metadata:    %5d changed\n", stats.ChangedMetadata)
+		}
 		Printf("Dirs:        %5d new, %5d removed\n", stats.Added.Dirs, stats.Removed.Dirs)
 		Printf("Others:      %5d new, %5d removed\n", stats.Added.Others, stats.Removed.Others)
 		Printf("Data Blobs:  %5d new, %5d removed\n", stats.Added.DataBlobs, stats.Removed.DataBlobs)
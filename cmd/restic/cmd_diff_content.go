@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// maxContentDiffSize is the size up to which the contents of files are
+// compared with diff --content, both versions are held in memory.
+const maxContentDiffSize = 16 * 1024 * 1024
+
+// contentDiffContext is the number of unchanged lines shown around each change.
+const contentDiffContext = 3
+
+// binaryCheckSize is the number of bytes at the start of a file which are
+// checked for null bytes to detect binary files, like git and diff do.
+const binaryCheckSize = 8000
+
+// ContentDiff is the result of comparing the contents of a file in two
+// snapshots, it is printed for diff --content --json.
+type ContentDiff struct {
+	MessageType string `json:"message_type"` // "content_diff"
+	Path        string `json:"path"`
+	Binary      bool   `json:"binary"`
+	Modified    bool   `json:"modified"`
+	Diff        string `json:"diff,omitempty"`
+}
+
+// loadFileContent returns the content of the file at p in the tree with the
+// given ID, or nil if the file does not exist in the tree.
+func loadFileContent(ctx context.Context, repo restic.Repository, tree restic.ID, p string) ([]byte, *restic.Node, error) {
+	root, err := restic.LoadTree(ctx, repo, tree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	node, err := findNode(ctx, repo, root, splitPath(path.Clean(p)))
+	if err != nil || node == nil {
+		return nil, nil, err
+	}
+	if node.Type != "file" {
+		return nil, nil, errors.Fatalf("%v is not a file", p)
+	}
+	if node.Size > maxContentDiffSize {
+		return nil, nil, errors.Fatalf("%v is too large to compare, the maximum size is %d MiB", p, maxContentDiffSize/1024/1024)
+	}
+
+	buf := make([]byte, 0, node.Size)
+	for _, id := range node.Content {
+		blob, err := repo.LoadBlob(ctx, restic.DataBlob, id, nil)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot load the content of %v", p)
+		}
+		buf = append(buf, blob...)
+	}
+	return buf, node, nil
+}
+
+// isBinary returns true if data looks like the content of a binary file.
+func isBinary(data []byte) bool {
+	if len(data) > binaryCheckSize {
+		data = data[:binaryCheckSize]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// diffContent compares the file at p in the trees of sn1 and sn2. A file which
+// does not exist in one of the snapshots is treated like an empty file.
+func diffContent(ctx context.Context, repo restic.Repository, sn1, sn2 *restic.Snapshot, p string) (ContentDiff, error) {
+	result := ContentDiff{MessageType: "content_diff", Path: p}
+
+	data1, node1, err := loadFileContent(ctx, repo, *sn1.Tree, p)
+	if err != nil {
+		return result, err
+	}
+	data2, node2, err := loadFileContent(ctx, repo, *sn2.Tree, p)
+	if err != nil {
+		return result, err
+	}
+	if node1 == nil && node2 == nil {
+		return result, errors.Fatalf("%v is not contained in either snapshot", p)
+	}
+
+	result.Modified = node1 == nil || node2 == nil || !bytes.Equal(data1, data2)
+	result.Binary = isBinary(data1) || isBinary(data2)
+	if !result.Modified || result.Binary {
+		return result, nil
+	}
+
+	name1, name2 := "/dev/null", "/dev/null"
+	if node1 != nil {
+		name1 = sn1.ID().Str() + ":" + p
+	}
+	if node2 != nil {
+		name2 = sn2.ID().Str() + ":" + p
+	}
+
+	var buf bytes.Buffer
+	writeUnifiedDiff(&buf, name1, name2, splitLines(data1), splitLines(data2), contentDiffContext)
+	result.Diff = buf.String()
+	return result, nil
+}
+
+func printContentDiff(d ContentDiff) {
+	switch {
+	case !d.Modified:
+		Verbosef("%v is identical\n", d.Path)
+	case d.Binary:
+		Printf("binary file %v differs\n", d.Path)
+	default:
+		Print(d.Diff)
+	}
+}
+
+// splitLines splits data into lines, which retain their line endings.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			i = len(data) - 1
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// diffOp is a single step of an edit script, op is ' ', '-' or '+'. For lines
+// which are unchanged or removed, a is the index of the line in the old
+// version, for lines which are unchanged or added b is the index in the new
+// version.
+type diffOp struct {
+	op   byte
+	a, b int
+}
+
+// diffLines computes the shortest edit script which transforms a into b using
+// the algorithm by Eugene W. Myers, "An O(ND) Difference Algorithm and Its
+// Variations". Common prefixes and suffixes are handled separately, the
+// remaining part needs O((N+M)D) time and O(D²) memory.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{' ', prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	a1, b1 := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	for _, op := range myers(a1, b1) {
+		ops = append(ops, diffOp{op.op, op.a + prefix, op.b + prefix})
+	}
+
+	for i := suffix; i > 0; i-- {
+		ops = append(ops, diffOp{' ', len(a) - i, len(b) - i})
+	}
+	return ops
+}
+
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// v[k+offset] is the furthest x reached on diagonal k, trace[d] holds
+	// the values for the diagonals -d-1..d+1 before step d
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	var d int
+search:
+	for d = 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk back through the trace to collect the edit script in reverse
+	var ops []diffOp
+	x, y := n, m
+	for ; d >= 0; d-- {
+		tv := trace[d]
+		get := func(k int) int { return tv[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = get(prevK)
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', x, y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', x, y})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', x, y})
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunkRange formats the range of lines of a hunk like diff -u, start is the
+// number of lines before the hunk.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// writeUnifiedDiff writes the differences between the lines a and b in the
+// unified format to w, with context unchanged lines around each change.
+func writeUnifiedDiff(w io.Writer, name1, name2 string, a, b []string, context int) {
+	ops := diffLines(a, b)
+
+	var changes []int
+	for i, op := range ops {
+		if op.op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", name1, name2)
+
+	for len(changes) > 0 {
+		// extend the hunk while the next change is close enough that the
+		// context lines would overlap
+		last := 0
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*context {
+			last++
+		}
+
+		start := changes[0] - context
+		if start < 0 {
+			start = 0
+		}
+		end := changes[last] + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		hunk := ops[start:end]
+		changes = changes[last+1:]
+
+		// the number of lines of both versions before the hunk
+		aStart, bStart := hunk[0].a, hunk[0].b
+		var aLen, bLen int
+		for _, op := range hunk {
+			if op.op != '+' {
+				aLen++
+			}
+			if op.op != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+
+		for _, op := range hunk {
+			line := ""
+			switch op.op {
+			case '-':
+				line = a[op.a]
+			default:
+				line = b[op.b]
+			}
+			fmt.Fprintf(w, "%c%s", op.op, line)
+			if !strings.HasSuffix(line, "\n") {
+				fmt.Fprintf(w, "\n\\ No newline at end of file\n")
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		diff string
+	}{
+		{
+			a:    "a\nb\nc\n",
+			b:    "a\nb\nc\n",
+			diff: "",
+		},
+		{
+			a:    "",
+			b:    "a\nb\n",
+			diff: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			b:    "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			diff: "--- old\n+++ new\n@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n@@ -9,4 +9,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+		{
+			// the context of nearby changes is merged into a single hunk
+			a:    "1\n2\n3\n4\n5\n6\n7\n",
+			b:    "1\nzwei\n3\n4\n5\n6\nsieben\n",
+			diff: "--- old\n+++ new\n@@ -1,7 +1,7 @@\n 1\n-2\n+zwei\n 3\n 4\n 5\n 6\n-7\n+sieben\n",
+		},
+		{
+			a:    "a\nb",
+			b:    "a\nb\n",
+			diff: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		writeUnifiedDiff(&buf, "old", "new", splitLines([]byte(test.a)), splitLines([]byte(test.b)), 3)
+		rtest.Equals(t, test.diff, buf.String())
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	rtest.Assert(t, !isBinary([]byte("text\nwith umlauts: äöü\n")), "text detected as binary")
+	rtest.Assert(t, isBinary([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")), "binary data detected as text")
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var cmdDryrun = &cobra.Command{
+	Use:   "dryrun",
+	Short: "Preview the effect of operations without modifying the repository",
+	Long: `
+The "dryrun" command groups subcommands which show what an operation would do,
+without modifying the repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+}
+
+var cmdDryrunDiff = &cobra.Command{
+	Use:   "diff [flags] snapshotID path [path...]",
+	Short: "Show which files changed compared to a snapshot",
+	Long: `
+The "dryrun diff" command compares the files and directories below the given
+paths with their state in a snapshot, without creating a new snapshot. The
+paths are mapped to the snapshot in the same way "backup" does, so pass the
+same paths which were used to create the snapshot.
+
+Each added, removed and changed item is listed with a prefix:
+
+  +  the item was added
+  -  the item was removed
+  M  the contents of the file were modified
+  U  only the metadata of the file changed (with --read-content)
+  T  the type of the item changed
+
+Whether a file changed is decided with the same rules "backup" uses to skip
+reading unchanged files, so by default only the metadata of files is compared.
+With --read-content, the files considered changed are read and split into
+chunks, files with the same contents as in the snapshot are then reported with
+"U".
+
+The special snapshot "latest" can be used to use the latest snapshot in the
+repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDryrunDiff(cmd.Context(), dryrunDiffOptions, globalOptions, args)
+	},
+}
+
+// DryrunDiffOptions bundles all options for the 'dryrun diff' command.
+type DryrunDiffOptions struct {
+	snapshotFilterOptions
+	IgnoreInode bool
+	IgnoreCtime bool
+	ReadContent bool
+}
+
+var dryrunDiffOptions DryrunDiffOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdDryrun)
+	cmdDryrun.AddCommand(cmdDryrunDiff)
+
+	f := cmdDryrunDiff.Flags()
+	initSingleSnapshotFilterOptions(f, &dryrunDiffOptions.snapshotFilterOptions)
+	f.BoolVar(&dryrunDiffOptions.IgnoreInode, "ignore-inode", false, "ignore inode number changes when checking for modified files")
+	f.BoolVar(&dryrunDiffOptions.IgnoreCtime, "ignore-ctime", false, "ignore ctime changes when checking for modified files")
+	f.BoolVar(&dryrunDiffOptions.ReadContent, "read-content", false, "read changed files to check whether their contents differ")
+}
+
+// LiveDiffStats collects the statistics of the 'dryrun diff' command.
+type LiveDiffStats struct {
+	MessageType   string `json:"message_type"` // "statistics"
+	Snapshot      string `json:"snapshot"`
+	Added         int    `json:"added"`
+	Removed       int    `json:"removed"`
+	Changed       int    `json:"changed"`
+	MetadataOnly  int    `json:"metadata_only,omitempty"`
+	ChangedBytes  uint64 `json:"changed_bytes"`
+	ErrorsReading int    `json:"errors_reading,omitempty"`
+}
+
+// liveComparer compares the local file system with the trees of a snapshot.
+type liveComparer struct {
+	repo        restic.Repository
+	ignoreFlags uint
+	readContent bool
+	printChange func(change *Change)
+	stats       *LiveDiffStats
+
+	// verify is set by the verify command, the metadata and the contents of
+	// all items are then compared instead of using the change detection of
+	// backup, see verifyItem
+	verify       bool
+	metadataOnly bool
+	buf          []byte
+}
+
+// liveType returns the node type of the item described by fi.
+func liveType(fi os.FileInfo) string {
+	switch fi.Mode() & (os.ModeType | os.ModeCharDevice) {
+	case 0:
+		return "file"
+	case os.ModeDir:
+		return "dir"
+	case os.ModeSymlink:
+		return "symlink"
+	case os.ModeDevice | os.ModeCharDevice:
+		return "chardev"
+	case os.ModeDevice:
+		return "dev"
+	case os.ModeNamedPipe:
+		return "fifo"
+	case os.ModeSocket:
+		return "socket"
+	}
+	return ""
+}
+
+func (c *liveComparer) warn(target string, err error) {
+	Warnf("%v: %v\n", target, err)
+	c.stats.ErrorsReading++
+}
+
+// loadSubtree loads the subtree of node, it returns nil if node is not a
+// directory.
+func (c *liveComparer) loadSubtree(ctx context.Context, node *restic.Node) (*restic.Tree, error) {
+	if node == nil || node.Type != "dir" || node.Subtree == nil {
+		return nil, nil
+	}
+	return restic.LoadTree(ctx, c.repo, *node.Subtree)
+}
+
+// compareDir compares the entries of the local directory dir with tree, which
+// may be nil if the directory is not contained in the snapshot.
+func (c *liveComparer) compareDir(ctx context.Context, snPath, dir string, tree *restic.Tree) error {
+	entries := make(map[string]os.FileInfo)
+	if dir != "" {
+		list, err := ioutil.ReadDir(dir)
+		if err != nil {
+			c.warn(dir, err)
+			// don't report the contents of an unreadable directory as removed
+			return nil
+		}
+		for _, fi := range list {
+			entries[fi.Name()] = fi
+		}
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	if tree != nil {
+		for _, node := range tree.Nodes {
+			if _, ok := entries[node.Name]; !ok {
+				names = append(names, node.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var node *restic.Node
+		if tree != nil {
+			node = tree.Find(name)
+		}
+		// fi is nil if the item does not exist locally
+		fi := entries[name]
+		err := c.compare(ctx, path.Join(snPath, name), filepath.Join(dir, name), fi, node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compare compares the local item target with node. fi is nil if the item
+// does not exist locally, node is nil if it is not contained in the snapshot.
+func (c *liveComparer) compare(ctx context.Context, snPath, target string, fi os.FileInfo, node *restic.Node) error {
+	switch {
+	case fi == nil && node == nil:
+		return nil
+
+	case fi == nil:
+		return c.removed(ctx, snPath, node)
+
+	case node == nil:
+		return c.added(ctx, snPath, target, fi)
+
+	case liveType(fi) != node.Type:
+		c.printChange(NewChange(c.formatPath(snPath, liveType(fi)), "T"))
+		c.stats.Changed++
+		if fi.Mode().IsRegular() {
+			c.stats.ChangedBytes += uint64(fi.Size())
+		}
+		// the contents of a directory which replaced a file or vice versa
+		// are reported as added or removed
+		if node.Type == "dir" {
+			subtree, err := c.loadSubtree(ctx, node)
+			if err != nil {
+				return err
+			}
+			err = c.compareDir(ctx, snPath, "", subtree)
+			if err != nil {
+				return err
+			}
+		}
+		if fi.IsDir() {
+			return c.compareDir(ctx, snPath, target, nil)
+		}
+		return nil
+
+	case c.verify:
+		return c.verifyItem(ctx, snPath, target, fi, node)
+
+	case fi.IsDir():
+		subtree, err := c.loadSubtree(ctx, node)
+		if err != nil {
+			return err
+		}
+		return c.compareDir(ctx, snPath, target, subtree)
+
+	case fi.Mode().IsRegular():
+		if !archiver.FileChanged(fi, node, c.ignoreFlags) {
+			return nil
+		}
+		if c.readContent {
+			same, err := c.sameContent(target, node)
+			if err != nil {
+				c.warn(target, err)
+				return nil
+			}
+			if same {
+				c.printChange(NewChange(snPath, "U"))
+				c.stats.MetadataOnly++
+				return nil
+			}
+		}
+		c.printChange(NewChange(snPath, "M"))
+		c.stats.Changed++
+		c.stats.ChangedBytes += uint64(fi.Size())
+		return nil
+
+	case fi.Mode()&os.ModeSymlink != 0:
+		linkTarget, err := fs.Readlink(target)
+		if err != nil {
+			c.warn(target, err)
+			return nil
+		}
+		if linkTarget != node.LinkTarget {
+			c.printChange(NewChange(snPath, "M"))
+			c.stats.Changed++
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// added reports target and, for directories, all items below it as added.
+func (c *liveComparer) added(ctx context.Context, snPath, target string, fi os.FileInfo) error {
+	c.printChange(NewChange(c.formatPath(snPath, liveType(fi)), "+"))
+	c.stats.Added++
+	if fi.Mode().IsRegular() {
+		c.stats.ChangedBytes += uint64(fi.Size())
+	}
+	if fi.IsDir() {
+		return c.compareDir(ctx, snPath, target, nil)
+	}
+	return nil
+}
+
+// removed reports node and, for directories, all items below it as removed.
+func (c *liveComparer) removed(ctx context.Context, snPath string, node *restic.Node) error {
+	c.printChange(NewChange(c.formatPath(snPath, node.Type), "-"))
+	c.stats.Removed++
+	subtree, err := c.loadSubtree(ctx, node)
+	if err != nil {
+		return err
+	}
+	if subtree != nil {
+		return c.compareDir(ctx, snPath, "", subtree)
+	}
+	return nil
+}
+
+func (c *liveComparer) formatPath(snPath, tpe string) string {
+	if tpe == "dir" {
+		return snPath + "/"
+	}
+	return snPath
+}
+
+// sameContent reads the file target and checks whether it is split into the
+// same chunks in the same order as the contents of node.
+func (c *liveComparer) sameContent(target string, node *restic.Node) (bool, error) {
+	pat, err := newContentPattern(c.repo.Config(), target)
+	if err != nil {
+		return false, err
+	}
+	if pat.size != node.Size || len(pat.content) != len(node.Content) {
+		return false, nil
+	}
+	for i, id := range node.Content {
+		if pat.content[i] != id {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// findNode returns the node at the path pc below tree, or nil if the path is
+// not contained in the snapshot.
+func findNode(ctx context.Context, repo restic.Repository, tree *restic.Tree, pc []string) (*restic.Node, error) {
+	for i, name := range pc {
+		node := tree.Find(name)
+		if node == nil || i == len(pc)-1 {
+			return node, nil
+		}
+		if node.Type != "dir" || node.Subtree == nil {
+			return nil, nil
+		}
+		var err error
+		tree, err = restic.LoadTree(ctx, repo, *node.Subtree)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func runDryrunDiff(ctx context.Context, opts DryrunDiffOptions, gopts GlobalOptions, args []string) error {
+	if len(args) < 2 {
+		return errors.Fatal("specify a snapshot ID and at least one path")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	sn, err := findSingleSnapshot(ctx, repo.Backend(), repo, opts.snapshotFilterOptions, args[0])
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+	if sn.Tree == nil {
+		return errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+
+	if !gopts.JSON {
+		Verbosef("comparing snapshot %v to the local files:\n\n", sn.ID().Str())
+	}
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	root, err := restic.LoadTree(ctx, repo, *sn.Tree)
+	if err != nil {
+		return err
+	}
+
+	c := &liveComparer{
+		repo:        repo,
+		readContent: opts.ReadContent,
+		stats: &LiveDiffStats{
+			MessageType: "statistics",
+			Snapshot:    sn.ID().Str(),
+		},
+		printChange: func(change *Change) {
+			Printf("%-5s%v\n", change.Modifier, change.Path)
+		},
+	}
+	if opts.IgnoreInode {
+		c.ignoreFlags |= archiver.ChangeIgnoreCtime | archiver.ChangeIgnoreInode
+	}
+	if opts.IgnoreCtime {
+		c.ignoreFlags |= archiver.ChangeIgnoreCtime
+	}
+
+	if gopts.JSON {
+		enc := json.NewEncoder(gopts.stdout)
+		c.printChange = func(change *Change) {
+			err := enc.Encode(change)
+			if err != nil {
+				Warnf("JSON encode failed: %v\n", err)
+			}
+		}
+	}
+
+	if gopts.Quiet {
+		c.printChange = func(change *Change) {}
+	}
+
+	for _, target := range args[1:] {
+		pc := archiver.SnapshotPath(fs.Local{}, target)
+		if len(pc) == 0 {
+			// "." or "../", backup saves the contents of the directory
+			err = c.compareDir(ctx, "/", target, root)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		node, err := findNode(ctx, repo, root, pc)
+		if err != nil {
+			return err
+		}
+
+		snPath := "/" + path.Join(pc...)
+		fi, err := fs.Lstat(target)
+		if err != nil && !os.IsNotExist(err) {
+			c.warn(target, err)
+			continue
+		}
+		err = c.compare(ctx, snPath, target, fi, node)
+		if err != nil {
+			return err
+		}
+	}
+
+	stats := c.stats
+	if gopts.JSON {
+		err := json.NewEncoder(gopts.stdout).Encode(stats)
+		if err != nil {
+			Warnf("JSON encode failed: %v\n", err)
+		}
+	} else {
+		Printf("\n")
+		Printf("Items:       %5d new, %5d removed, %5d changed\n", stats.Added, stats.Removed, stats.Changed)
+		if opts.ReadContent {
+			Printf("Metadata:    %5d changed\n", stats.MetadataOnly)
+		}
+		Printf("Changed data: %s\n", ui.FormatBytes(stats.ChangedBytes))
+	}
+
+	if stats.ErrorsReading > 0 {
+		return errors.Fatalf("%d items could not be read", stats.ErrorsReading)
+	}
+	return nil
+}
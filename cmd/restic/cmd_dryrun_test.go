@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestLiveComparerSameContent(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, rtest.Random(23, 8*1024*1024), 0600))
+
+	pat, err := newContentPattern(repo.Config(), filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(pat.content) > 1, "file was not split into several chunks")
+
+	c := &liveComparer{repo: repo}
+	node := &restic.Node{Size: pat.size, Content: pat.content}
+	same, err := c.sameContent(filename, node)
+	rtest.OK(t, err)
+	rtest.Assert(t, same, "file with the same chunks reported as changed")
+
+	// the same chunks in a different order are a different file
+	var reversed restic.IDs
+	for i := len(pat.content) - 1; i >= 0; i-- {
+		reversed = append(reversed, pat.content[i])
+	}
+	node = &restic.Node{Size: pat.size, Content: reversed}
+	same, err = c.sameContent(filename, node)
+	rtest.OK(t, err)
+	rtest.Assert(t, !same, "file with reordered chunks reported as unchanged")
+}
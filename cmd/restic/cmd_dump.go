@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
 	"path"
 	"path/filepath"
 
@@ -24,6 +23,10 @@ single file is selected, it prints its contents to stdout. Folders are output
 as a tar (default) or zip file containing the contents of the specified folder.
 Pass "/" as file name to dump the whole snapshot as an archive file.
 
+With --offset and --length, only a part of a single file is printed. Only the
+parts of the file's contents which contain the range are loaded from the
+repository, so this is useful to look into large files.
+
 The special snapshot "latest" can be used to use the latest snapshot in the
 repository.
 
@@ -42,6 +45,13 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 type DumpOptions struct {
 	snapshotFilterOptions
 	Archive string
+	Offset  string
+	Length  string
+}
+
+// fileRange selects the part of the contents of a file which is dumped.
+type fileRange struct {
+	offset, length uint64
 }
 
 var dumpOptions DumpOptions
@@ -52,6 +62,8 @@ func init() {
 	flags := cmdDump.Flags()
 	initSingleSnapshotFilterOptions(flags, &dumpOptions.snapshotFilterOptions)
 	flags.StringVarP(&dumpOptions.Archive, "archive", "a", "tar", "set archive `format` as \"tar\" or \"zip\"")
+	flags.StringVar(&dumpOptions.Offset, "offset", "", "only print the contents of the file starting at `offset` (allowed suffixes: k/K, m/M, g/G, t/T)")
+	flags.StringVar(&dumpOptions.Length, "length", "", "only print `size` bytes of the contents of the file (allowed suffixes: k/K, m/M, g/G, t/T)")
 }
 
 func splitPath(p string) []string {
@@ -63,10 +75,13 @@ func splitPath(p string) []string {
 	return append(s, f)
 }
 
-func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string, d *dump.Dumper) error {
+func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string, d *dump.Dumper, rng *fileRange) error {
 	// If we print / we need to assume that there are multiple nodes at that
 	// level in the tree.
 	if pathComponents[0] == "" {
+		if rng != nil {
+			return fmt.Errorf("--offset and --length can only be used for files")
+		}
 		if err := checkStdoutArchive(); err != nil {
 			return err
 		}
@@ -81,14 +96,20 @@ func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repositor
 		if node.Name == pathComponents[0] {
 			switch {
 			case l == 1 && dump.IsFile(node):
+				if rng != nil {
+					return d.WriteNodeRange(ctx, node, rng.offset, rng.length)
+				}
 				return d.WriteNode(ctx, node)
 			case l > 1 && dump.IsDir(node):
 				subtree, err := restic.LoadTree(ctx, repo, *node.Subtree)
 				if err != nil {
 					return errors.Wrapf(err, "cannot load subtree for %q", item)
 				}
-				return printFromTree(ctx, subtree, repo, item, pathComponents[1:], d)
+				return printFromTree(ctx, subtree, repo, item, pathComponents[1:], d, rng)
 			case dump.IsDir(node):
+				if rng != nil {
+					return fmt.Errorf("%q is a directory, --offset and --length can only be used for files", item)
+				}
 				if err := checkStdoutArchive(); err != nil {
 					return err
 				}
@@ -118,6 +139,25 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		return fmt.Errorf("unknown archive format %q", opts.Archive)
 	}
 
+	var rng *fileRange
+	if opts.Offset != "" || opts.Length != "" {
+		rng = &fileRange{}
+		if opts.Offset != "" {
+			offset, err := parseSizeStr(opts.Offset)
+			if err != nil || offset < 0 {
+				return errors.Fatalf("invalid offset %q", opts.Offset)
+			}
+			rng.offset = uint64(offset)
+		}
+		if opts.Length != "" {
+			length, err := parseSizeStr(opts.Length)
+			if err != nil || length <= 0 {
+				return errors.Fatalf("invalid length %q", opts.Length)
+			}
+			rng.length = uint64(length)
+		}
+	}
+
 	snapshotIDString := args[0]
 	pathToPrint := args[1]
 
@@ -139,7 +179,7 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		}
 	}
 
-	sn, err := restic.FindFilteredSnapshot(ctx, repo.Backend(), repo, opts.Paths, opts.Tags, opts.Hosts, nil, snapshotIDString)
+	sn, err := findSingleSnapshot(ctx, repo.Backend(), repo, opts.snapshotFilterOptions, snapshotIDString)
 	if err != nil {
 		Exitf(1, "failed to find snapshot: %v", err)
 	}
@@ -154,8 +194,8 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		Exitf(2, "loading tree for snapshot %q failed: %v", snapshotIDString, err)
 	}
 
-	d := dump.New(opts.Archive, repo, os.Stdout)
-	err = printFromTree(ctx, tree, repo, "/", splittedPath, d)
+	d := dump.New(opts.Archive, repo, gopts.stdout)
+	err = printFromTree(ctx, tree, repo, "/", splittedPath, d, rng)
 	if err != nil {
 		Exitf(2, "cannot dump file: %v", err)
 	}
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"os"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/restic/chunker"
 	"github.com/spf13/cobra"
 
 	"github.com/restic/restic/internal/backend"
@@ -14,6 +17,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/walker"
 )
 
@@ -23,13 +27,18 @@ var cmdFind = &cobra.Command{
 	Long: `
 The "find" command searches for files or directories in snapshots stored in the
 repo.
-It can also be used to search for restic blobs or trees for troubleshooting.`,
+It can also be used to search for restic blobs or trees for troubleshooting.
+
+With --content, the patterns are local files. They are split into chunks the
+same way "backup" does and all files in the snapshots containing these chunks
+are listed, together with the percentage of the local file they contain.`,
 	Example: `restic find config.json
 restic find --json "*.yml" "*.json"
 restic find --json --blob 420f620f b46ebe8a ddd38656
 restic find --show-pack-id --blob 420f620f
 restic find --tree 577c2bc9 f81f2e22 a62827a9
 restic find --pack 025c1d06
+restic find --content /home/user/work/report.pdf
 
 EXIT STATUS
 ===========
@@ -49,6 +58,7 @@ type FindOptions struct {
 	Snapshots          []string
 	BlobID, TreeID     bool
 	PackID, ShowPackID bool
+	Content            bool
 	CaseInsensitive    bool
 	ListLong           bool
 	snapshotFilterOptions
@@ -66,6 +76,7 @@ func init() {
 	f.BoolVar(&findOptions.BlobID, "blob", false, "pattern is a blob-ID")
 	f.BoolVar(&findOptions.TreeID, "tree", false, "pattern is a tree-ID")
 	f.BoolVar(&findOptions.PackID, "pack", false, "pattern is a pack-ID")
+	f.BoolVar(&findOptions.Content, "content", false, "pattern is a local file to search by content")
 	f.BoolVar(&findOptions.ShowPackID, "show-pack-id", false, "display the pack-ID the blobs belong to (with --blob or --tree)")
 	f.BoolVarP(&findOptions.CaseInsensitive, "ignore-case", "i", false, "ignore case for pattern")
 	f.BoolVarP(&findOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
@@ -226,6 +237,61 @@ func (s *statefulOutput) PrintObject(kind, id, nodepath, treeID string, sn *rest
 	}
 }
 
+func (s *statefulOutput) PrintContentJSON(file, nodepath string, matched, size uint64, sn *restic.Snapshot) {
+	b, err := json.Marshal(struct {
+		ObjectType   string    `json:"object_type"`
+		File         string    `json:"file"`
+		Path         string    `json:"path"`
+		SnapshotID   string    `json:"snapshot"`
+		Time         time.Time `json:"time,omitempty"`
+		MatchedBytes uint64    `json:"matched_bytes"`
+		Percentage   float64   `json:"percentage"`
+	}{
+		ObjectType:   "content",
+		File:         file,
+		Path:         nodepath,
+		SnapshotID:   sn.ID().String(),
+		Time:         sn.Time,
+		MatchedBytes: matched,
+		Percentage:   contentPercentage(matched, size),
+	})
+	if err != nil {
+		Warnf("Marshall failed: %v\n", err)
+		return
+	}
+	if !s.inuse {
+		Printf("[")
+		s.inuse = true
+	}
+	if s.hits > 0 {
+		Printf(",")
+	}
+	Print(string(b))
+	s.hits++
+}
+
+func (s *statefulOutput) PrintContentNormal(file, nodepath string, matched, size uint64, sn *restic.Snapshot) {
+	Printf("Found content of %s\n", file)
+	Printf(" ... in file %s (%s, %s)\n", nodepath, ui.FormatBytes(matched), ui.FormatPercent(matched, size))
+	Printf(" ... in snapshot %s (%s)\n", sn.ID().Str(), sn.Time.Local().Format(TimeFormat))
+}
+
+func (s *statefulOutput) PrintContent(file, nodepath string, matched, size uint64, sn *restic.Snapshot) {
+	if s.JSON {
+		s.PrintContentJSON(file, nodepath, matched, size, sn)
+	} else {
+		s.PrintContentNormal(file, nodepath, matched, size, sn)
+	}
+}
+
+// contentPercentage returns the share of matched in size in percent.
+func contentPercentage(matched, size uint64) float64 {
+	if size == 0 {
+		return 100
+	}
+	return 100 * float64(matched) / float64(size)
+}
+
 func (s *statefulOutput) Finish() {
 	if s.JSON {
 		// do some finishing up
@@ -249,9 +315,89 @@ type Finder struct {
 	ignoreTrees restic.IDSet
 	blobIDs     map[string]struct{}
 	treeIDs     map[string]struct{}
+	contents    []contentPattern
 	itemsFound  int
 }
 
+// contentPattern is a local file which is searched for by its chunks.
+type contentPattern struct {
+	filename string
+	size     uint64
+	// count is the number of chunks of the file, including duplicates
+	count int
+	// content lists the IDs of the chunks in the order of the file
+	content restic.IDs
+	// chunks maps the IDs of the chunks of the file to their size and how
+	// often they occur in the file
+	chunks map[restic.ID]contentChunk
+}
+
+type contentChunk struct {
+	size  uint
+	count uint
+}
+
+// newContentPattern splits the local file into chunks using the chunker
+// parameters of the repository.
+func newContentPattern(cfg restic.Config, filename string) (contentPattern, error) {
+	pat := contentPattern{
+		filename: filename,
+		chunks:   make(map[restic.ID]contentChunk),
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return pat, errors.Fatalf("unable to open %v: %v", filename, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	minSize, maxSize, averageBits := cfg.ChunkerSizes()
+	chnker := chunker.NewWithBoundaries(file, cfg.ChunkerPolynomial, minSize, maxSize)
+	chnker.SetAverageBits(averageBits)
+
+	buf := make([]byte, maxSize)
+	for {
+		chunk, err := chnker.Next(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return pat, errors.Fatalf("unable to read %v: %v", filename, err)
+		}
+
+		pat.size += uint64(chunk.Length)
+		pat.count++
+		id := restic.Hash(chunk.Data)
+		pat.content = append(pat.content, id)
+		c := pat.chunks[id]
+		c.size = chunk.Length
+		c.count++
+		pat.chunks[id] = c
+		buf = chunk.Data
+	}
+
+	return pat, nil
+}
+
+// matchedBytes returns the number of bytes of the local file which are
+// contained in content. A chunk is counted at most as often as it occurs in
+// the local file, so the result never exceeds the size of the file.
+func (pat contentPattern) matchedBytes(content restic.IDs) uint64 {
+	var matched uint64
+	used := make(map[restic.ID]uint)
+	for _, id := range content {
+		c, ok := pat.chunks[id]
+		if !ok || used[id] >= c.count {
+			continue
+		}
+		used[id]++
+		matched += uint64(c.size)
+	}
+	return matched
+}
+
 func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error {
 	debug.Log("searching in snapshot %s\n  for entries within [%s %s]", sn.ID(), f.pat.oldest, f.pat.newest)
 
@@ -397,6 +543,43 @@ func (f *Finder) findIDs(ctx context.Context, sn *restic.Snapshot) error {
 	})
 }
 
+func (f *Finder) findContent(ctx context.Context, sn *restic.Snapshot) error {
+	debug.Log("searching content in snapshot %s", sn.ID())
+
+	if sn.Tree == nil {
+		return errors.Errorf("snapshot %v has no tree", sn.ID().Str())
+	}
+
+	f.out.newsn = sn
+	return walker.Walk(ctx, f.repo, *sn.Tree, f.ignoreTrees, func(parentTreeID restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			debug.Log("Error loading tree %v: %v", parentTreeID, err)
+
+			Printf("Unable to load tree %s\n ... which belongs to snapshot %s\n", parentTreeID, sn.ID())
+
+			return false, walker.ErrSkipNode
+		}
+
+		if node == nil || node.Type != "file" {
+			return false, nil
+		}
+
+		for _, pat := range f.contents {
+			matched := pat.matchedBytes(node.Content)
+			if matched == 0 && pat.size > 0 {
+				continue
+			}
+			if pat.size == 0 && node.Size != 0 {
+				// an empty file only matches other empty files
+				continue
+			}
+			f.out.PrintContent(pat.filename, nodepath, matched, pat.size, sn)
+		}
+
+		return false, nil
+	})
+}
+
 var errAllPacksFound = errors.New("all packs found")
 
 // packsToBlobs converts the list of pack IDs to a list of blob IDs that
@@ -541,7 +724,7 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 
 	var err error
 	pat := findPattern{pattern: args}
-	if opts.CaseInsensitive {
+	if opts.CaseInsensitive && !opts.Content {
 		for i := range pat.pattern {
 			pat.pattern[i] = strings.ToLower(pat.pattern[i])
 		}
@@ -568,6 +751,10 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 		return errors.Fatal("cannot have several ID types")
 	}
 
+	if opts.Content && (opts.BlobID || opts.TreeID || opts.PackID) {
+		return errors.Fatal("--content cannot be combined with --blob, --tree or --pack")
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -618,7 +805,33 @@ func runFind(ctx context.Context, opts FindOptions, gopts GlobalOptions, args []
 		}
 	}
 
+	if opts.Content {
+		for _, filename := range args {
+			pat, err := newContentPattern(repo.Config(), filename)
+			if err != nil {
+				return err
+			}
+
+			known := 0
+			for id := range pat.chunks {
+				if repo.Index().Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
+					known++
+				}
+			}
+			if !gopts.JSON {
+				Verbosef("%v: %d of %d chunks are stored in the repository\n", filename, known, len(pat.chunks))
+			}
+			f.contents = append(f.contents, pat)
+		}
+	}
+
 	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, opts.Hosts, opts.Tags, opts.Paths, opts.Snapshots) {
+		if f.contents != nil {
+			if err = f.findContent(ctx, sn); err != nil {
+				return err
+			}
+			continue
+		}
 		if f.blobIDs != nil || f.treeIDs != nil {
 			if err = f.findIDs(ctx, sn); err != nil && err.Error() != "OK" {
 				return err
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestContentPatternMatchedBytes(t *testing.T) {
+	a, b, c := restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()
+
+	// the local file consists of the chunks a, b, a
+	pat := contentPattern{
+		size:  250,
+		count: 3,
+		chunks: map[restic.ID]contentChunk{
+			a: {size: 100, count: 2},
+			b: {size: 50, count: 1},
+		},
+	}
+
+	for _, test := range []struct {
+		content  restic.IDs
+		expected uint64
+	}{
+		{nil, 0},
+		{restic.IDs{c}, 0},
+		{restic.IDs{a}, 100},
+		{restic.IDs{a, b, a}, 250},
+		{restic.IDs{b, a, c, a}, 250},
+		// chunks are not counted more often than they occur in the local file
+		{restic.IDs{a, a, a, b, b}, 250},
+		{restic.IDs{b, b}, 50},
+	} {
+		rtest.Equals(t, test.expected, pat.matchedBytes(test.content))
+	}
+}
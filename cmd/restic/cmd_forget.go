@@ -3,7 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -53,12 +57,14 @@ type ForgetOptions struct {
 	KeepTags      restic.TagLists
 
 	snapshotFilterOptions
+	Meta    []string
 	Compact bool
 
 	// Grouping
-	GroupBy string
-	DryRun  bool
-	Prune   bool
+	GroupBy  string
+	DryRun   bool
+	Timeline bool
+	Prune    bool
 }
 
 var forgetOptions ForgetOptions
@@ -88,11 +94,13 @@ func init() {
 		// MarkDeprecated only returns an error when the flag is not found
 		panic(err)
 	}
+	f.StringArrayVar(&forgetOptions.Meta, "meta", nil, "only consider snapshots with the metadata `key[=value]` (can be specified multiple times)")
 
 	f.BoolVarP(&forgetOptions.Compact, "compact", "c", false, "use compact output format")
 
-	f.StringVarP(&forgetOptions.GroupBy, "group-by", "g", "host,paths", "`group` snapshots by host, paths and/or tags, separated by comma (disable grouping with '')")
+	f.StringVarP(&forgetOptions.GroupBy, "group-by", "g", "host,paths", "`group` snapshots by host, paths, tags and/or tag:prefix, separated by comma (disable grouping with '')")
 	f.BoolVarP(&forgetOptions.DryRun, "dry-run", "n", false, "do not delete anything, just print what would be done")
+	f.BoolVar(&forgetOptions.Timeline, "timeline", false, "do not delete anything, but show the kept snapshots grouped by the policy rule which retains them (implies --dry-run)")
 	f.BoolVar(&forgetOptions.Prune, "prune", false, "automatically run the 'prune' command if snapshots have been removed")
 
 	f.SortFlags = false
@@ -105,6 +113,21 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 		return err
 	}
 
+	if opts.Timeline {
+		if len(args) > 0 {
+			return errors.Fatal("--timeline cannot be used with explicit snapshot IDs")
+		}
+		opts.DryRun = true
+	}
+
+	if len(opts.Meta) > 0 && len(args) > 0 {
+		return errors.Fatal("--meta cannot be used with explicit snapshot IDs")
+	}
+
+	if gopts.AppendOnly && !opts.DryRun {
+		return errors.Fatal("forget removes snapshots and is not possible in append-only mode")
+	}
+
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
@@ -115,8 +138,13 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 	}
 
 	if !opts.DryRun || !gopts.NoLock {
+		// prune modifies the data of all hosts
+		scope := ""
+		if !opts.Prune {
+			scope = snapshotLockScope(opts.Hosts, args)
+		}
 		var lock *restic.Lock
-		lock, ctx, err = lockRepoExclusive(ctx, repo)
+		lock, ctx, err = lockRepoExclusiveScoped(ctx, repo, scope)
 		defer unlockRepo(lock)
 		if err != nil {
 			return err
@@ -127,6 +155,9 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 	removeSnIDs := restic.NewIDSet()
 
 	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+		if !sn.HasMetadata(opts.Meta) {
+			continue
+		}
 		snapshots = append(snapshots, sn)
 	}
 
@@ -135,6 +166,10 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 	if len(args) > 0 {
 		// When explicit snapshots args are given, remove them immediately.
 		for _, sn := range snapshots {
+			if sn.Protected {
+				Warnf("snapshot %v is protected, not removing it (use `restic tag --unprotect` first)\n", sn.ID().Str())
+				continue
+			}
 			removeSnIDs.Insert(*sn.ID())
 		}
 	} else {
@@ -170,8 +205,17 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 				Verbosef("Applying Policy: %v\n", policy)
 			}
 
-			for k, snapshotGroup := range snapshotGroups {
-				if gopts.Verbose >= 1 && !gopts.JSON {
+			// process the groups in a stable order, so that the output of a
+			// dry run can be compared with the actual run
+			keys := make([]string, 0, len(snapshotGroups))
+			for k := range snapshotGroups {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				snapshotGroup := snapshotGroups[k]
+				if (gopts.Verbose >= 1 || opts.DryRun) && !gopts.JSON {
 					err = PrintSnapshotGroupHeader(gopts.stdout, k)
 					if err != nil {
 						return err
@@ -190,16 +234,24 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 
 				keep, remove, reasons := restic.ApplyPolicy(snapshotGroup, policy)
 
+				if opts.Timeline {
+					fg.Timeline = newForgetTimeline(reasons)
+				}
+
 				if len(keep) != 0 && !gopts.Quiet && !gopts.JSON {
 					Printf("keep %d snapshots:\n", len(keep))
-					PrintSnapshots(globalOptions.stdout, keep, reasons, opts.Compact)
+					if opts.Timeline {
+						printForgetTimeline(globalOptions.stdout, fg.Timeline)
+					} else {
+						PrintSnapshots(globalOptions.stdout, keep, reasons, nil, opts.Compact)
+					}
 					Printf("\n")
 				}
 				addJSONSnapshots(&fg.Keep, keep)
 
 				if len(remove) != 0 && !gopts.Quiet && !gopts.JSON {
 					Printf("remove %d snapshots:\n", len(remove))
-					PrintSnapshots(globalOptions.stdout, remove, nil, opts.Compact)
+					PrintSnapshots(globalOptions.stdout, remove, nil, nil, opts.Compact)
 					Printf("\n")
 				}
 				addJSONSnapshots(&fg.Remove, remove)
@@ -221,6 +273,7 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 			if err != nil {
 				return err
 			}
+			writeAuditEntry(ctx, gopts, repo, "forget", removeSnIDs.List(), "")
 		} else {
 			if !gopts.JSON {
 				Printf("Would have removed the following snapshots:\n%v\n\n", removeSnIDs)
@@ -248,12 +301,71 @@ func runForget(ctx context.Context, opts ForgetOptions, gopts GlobalOptions, arg
 
 // ForgetGroup helps to print what is forgotten in JSON.
 type ForgetGroup struct {
-	Tags    []string            `json:"tags"`
-	Host    string              `json:"host"`
-	Paths   []string            `json:"paths"`
-	Keep    []Snapshot          `json:"keep"`
-	Remove  []Snapshot          `json:"remove"`
-	Reasons []restic.KeepReason `json:"reasons"`
+	Tags     []string               `json:"tags"`
+	Host     string                 `json:"host"`
+	Paths    []string               `json:"paths"`
+	Keep     []Snapshot             `json:"keep"`
+	Remove   []Snapshot             `json:"remove"`
+	Reasons  []restic.KeepReason    `json:"reasons"`
+	Timeline []ForgetTimelineBucket `json:"timeline,omitempty"`
+}
+
+// ForgetTimelineBucket lists the snapshots retained by one bucket of the
+// policy, e.g. "daily", newest first. A snapshot can be retained by several
+// buckets and is then listed for each of them.
+type ForgetTimelineBucket struct {
+	Bucket    string                   `json:"bucket"`
+	Snapshots []ForgetTimelineSnapshot `json:"snapshots"`
+}
+
+// ForgetTimelineSnapshot is a snapshot in a ForgetTimelineBucket along with
+// all reasons to keep it.
+type ForgetTimelineSnapshot struct {
+	ID      *restic.ID `json:"id"`
+	ShortID string     `json:"short_id"`
+	Time    time.Time  `json:"time"`
+	Reasons []string   `json:"reasons"`
+}
+
+// newForgetTimeline groups the kept snapshots by the policy buckets which
+// retain them. Buckets without snapshots are omitted.
+func newForgetTimeline(reasons []restic.KeepReason) []ForgetTimelineBucket {
+	snapshots := make(map[string][]ForgetTimelineSnapshot)
+	for _, r := range reasons {
+		for _, bucket := range r.Buckets {
+			snapshots[bucket] = append(snapshots[bucket], ForgetTimelineSnapshot{
+				ID:      r.Snapshot.ID(),
+				ShortID: r.Snapshot.ID().Str(),
+				Time:    r.Snapshot.Time,
+				Reasons: r.Matches,
+			})
+		}
+	}
+
+	var timeline []ForgetTimelineBucket
+	for _, bucket := range restic.PolicyBuckets {
+		list, ok := snapshots[bucket]
+		if !ok {
+			continue
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Time.After(list[j].Time)
+		})
+		timeline = append(timeline, ForgetTimelineBucket{Bucket: bucket, Snapshots: list})
+	}
+	return timeline
+}
+
+// printForgetTimeline prints the snapshots of each bucket, annotated with the
+// reasons to keep them.
+func printForgetTimeline(stdout io.Writer, timeline []ForgetTimelineBucket) {
+	for _, b := range timeline {
+		_, _ = fmt.Fprintf(stdout, "%v (%d):\n", b.Bucket, len(b.Snapshots))
+		for _, sn := range b.Snapshots {
+			_, _ = fmt.Fprintf(stdout, "  %v  %v  %v\n", sn.ShortID,
+				sn.Time.Local().Format(TimeFormat), strings.Join(sn.Reasons, ", "))
+		}
+	}
 }
 
 func addJSONSnapshots(js *[]Snapshot, list restic.Snapshots) {
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestForgetTimeline(t *testing.T) {
+	var list restic.Snapshots
+	for _, ts := range []string{
+		"2016-01-01 10:00:00",
+		"2016-01-05 10:00:00",
+		"2016-01-07 10:00:00",
+		"2016-01-07 12:00:00",
+		"2016-01-08 10:00:00",
+	} {
+		tm, err := time.Parse("2006-01-02 15:04:05", ts)
+		rtest.OK(t, err)
+		sn := &restic.Snapshot{Time: tm}
+		restic.TestSetSnapshotID(t, sn, restic.NewRandomID())
+		list = append(list, sn)
+	}
+
+	_, _, reasons := restic.ApplyPolicy(list, restic.ExpirePolicy{Daily: 2, Weekly: 2})
+	timeline := newForgetTimeline(reasons)
+
+	rtest.Equals(t, 2, len(timeline))
+	rtest.Equals(t, "daily", timeline[0].Bucket)
+	rtest.Equals(t, "weekly", timeline[1].Bucket)
+
+	times := func(b ForgetTimelineBucket) []string {
+		var result []string
+		for _, sn := range b.Snapshots {
+			result = append(result, sn.Time.Format("2006-01-02 15:04"))
+		}
+		return result
+	}
+	rtest.Equals(t, []string{"2016-01-08 10:00", "2016-01-07 12:00"}, times(timeline[0]))
+	rtest.Equals(t, []string{"2016-01-08 10:00", "2016-01-01 10:00"}, times(timeline[1]))
+	rtest.Equals(t, []string{"daily snapshot", "weekly snapshot"}, timeline[0].Snapshots[0].Reasons)
+}
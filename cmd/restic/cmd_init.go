@@ -35,6 +35,8 @@ type InitOptions struct {
 	secondaryRepoOptions
 	CopyChunkerParameters bool
 	RepositoryVersion     string
+	ChunkSize             string
+	DefaultPackSize       uint
 }
 
 var initOptions InitOptions
@@ -45,13 +47,15 @@ func init() {
 	f := cmdInit.Flags()
 	initSecondaryRepoOptions(f, &initOptions.secondaryRepoOptions, "secondary", "to copy chunker parameters from")
 	f.BoolVar(&initOptions.CopyChunkerParameters, "copy-chunker-params", false, "copy chunker parameters from the secondary repository (useful with the copy command)")
+	f.StringVar(&initOptions.ChunkSize, "chunk-size", "", "average `size` of the chunks files are split into, a power of two between 256K and 16M (default: 1M, allowed suffixes: k/K, m/M)")
+	f.UintVar(&initOptions.DefaultPackSize, "default-pack-size", 0, "store the target pack `size` in MiB for all later commands which don't set --pack-size (default: 16)")
 	f.StringVar(&initOptions.RepositoryVersion, "repository-version", "stable", "repository format version to use, allowed values are a format version, 'latest' and 'stable'")
 }
 
 func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []string) error {
 	var version uint
 	if opts.RepositoryVersion == "latest" || opts.RepositoryVersion == "" {
-		version = restic.MaxRepoVersion
+		version = restic.LatestRepoVersion
 	} else if opts.RepositoryVersion == "stable" {
 		version = restic.StableRepoVersion
 	} else {
@@ -65,11 +69,37 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return errors.Fatalf("only repository versions between %v and %v are allowed", restic.MinRepoVersion, restic.MaxRepoVersion)
 	}
 
-	chunkerPolynomial, err := maybeReadChunkerPolynomial(ctx, opts, gopts)
+	chunkerPolynomial, averageChunkSize, err := maybeReadChunkerParams(ctx, opts, gopts)
 	if err != nil {
 		return err
 	}
 
+	if opts.ChunkSize != "" {
+		size, err := parseSizeStr(opts.ChunkSize)
+		if err != nil {
+			return errors.Fatalf("invalid chunk size: %v", err)
+		}
+		if opts.CopyChunkerParameters && uint64(size) != averageChunkSize {
+			return errors.Fatalf("the chunk size %v differs from the chunk size %v of the secondary repository, deduplication between both repositories requires the same chunker parameters", size, averageChunkSize)
+		}
+		err = (&restic.Config{Version: version}).SetAverageChunkSize(uint64(size))
+		if err != nil {
+			return errors.Fatal(err.Error())
+		}
+		averageChunkSize = uint64(size)
+	}
+
+	// check the size in MiB first, the size in bytes could overflow
+	if opts.DefaultPackSize > repository.MaxPackSize/1024/1024 {
+		return errors.Fatalf("pack size larger than limit of %v MiB", repository.MaxPackSize/1024/1024)
+	}
+	defaultPackSize := opts.DefaultPackSize * 1024 * 1024
+	if defaultPackSize != 0 {
+		if err := repository.CheckPackSize(defaultPackSize); err != nil {
+			return err
+		}
+	}
+
 	repo, err := ReadRepo(gopts)
 	if err != nil {
 		return err
@@ -82,7 +112,7 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return err
 	}
 
-	be, err := create(ctx, repo, gopts.extended)
+	be, err := create(ctx, repo, gopts, gopts.extended)
 	if err != nil {
 		return errors.Fatalf("create repository at %s failed: %v\n", location.StripPassword(gopts.Repo), err)
 	}
@@ -95,7 +125,7 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return err
 	}
 
-	err = s.Init(ctx, version, gopts.password, chunkerPolynomial)
+	err = s.Init(ctx, version, gopts.password, chunkerPolynomial, averageChunkSize, defaultPackSize)
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", location.StripPassword(gopts.Repo), err)
 	}
@@ -109,24 +139,28 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 	return nil
 }
 
-func maybeReadChunkerPolynomial(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*chunker.Pol, error) {
+// maybeReadChunkerParams returns the chunker polynomial and the average chunk
+// size of the secondary repository if the chunker parameters should be copied.
+// Otherwise, the polynomial is nil and the chunk size zero.
+func maybeReadChunkerParams(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*chunker.Pol, uint64, error) {
 	if opts.CopyChunkerParameters {
 		otherGopts, _, err := fillSecondaryGlobalOpts(opts.secondaryRepoOptions, gopts, "secondary")
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		otherRepo, err := OpenRepository(ctx, otherGopts)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
-		pol := otherRepo.Config().ChunkerPolynomial
-		return &pol, nil
+		cfg := otherRepo.Config()
+		pol := cfg.ChunkerPolynomial
+		return &pol, cfg.AverageChunkSize(), nil
 	}
 
 	if opts.Repo != "" || opts.RepositoryFile != "" || opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" {
-		return nil, errors.Fatal("Secondary repository must only be specified when copying the chunker parameters")
+		return nil, 0, errors.Fatal("Secondary repository must only be specified when copying the chunker parameters")
 	}
-	return nil, nil
+	return nil, 0, nil
 }
@@ -3,11 +3,12 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
 
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -17,11 +18,20 @@ import (
 )
 
 var cmdKey = &cobra.Command{
-	Use:   "key [flags] [list|add|remove|passwd] [ID]",
+	Use:   "key [flags] [list|add|remove|passwd|rotate] [ID]",
 	Short: "Manage keys (passwords)",
 	Long: `
 The "key" command manages keys (passwords) for accessing the repository.
 
+The "rotate" subcommand replaces the master key which encrypts all data in the
+repository. All files are downloaded, re-encrypted with a new master key and
+uploaded again, afterwards all files and keys using the old master key are
+removed. A new key for the new master key is created, the other passwords
+have to be added again using "key add". As this rewrites the whole repository,
+it must be confirmed with --confirm. An interrupted rotation is resumed by
+running the command again on the same host, its state is stored in the cache
+directory.
+
 EXIT STATUS
 ===========
 
@@ -34,9 +44,10 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 }
 
 var (
-	newPasswordFile string
-	keyUsername     string
-	keyHostname     string
+	newPasswordFile  string
+	keyUsername      string
+	keyHostname      string
+	keyRotateConfirm bool
 )
 
 func init() {
@@ -46,6 +57,7 @@ func init() {
 	flags.StringVarP(&newPasswordFile, "new-password-file", "", "", "`file` from which to read the new password")
 	flags.StringVarP(&keyUsername, "user", "", "", "the username for new keys")
 	flags.StringVarP(&keyHostname, "host", "", "", "the hostname for new keys")
+	flags.BoolVar(&keyRotateConfirm, "confirm", false, "confirm re-encrypting the whole repository (with rotate)")
 }
 
 func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions) error {
@@ -141,11 +153,12 @@ func addKey(ctx context.Context, repo *repository.Repository, gopts GlobalOption
 	}
 
 	Verbosef("saved new key as %s\n", id)
+	writeAuditEntry(ctx, gopts, repo, "key-add", nil, "added key "+id.ID().String())
 
 	return nil
 }
 
-func deleteKey(ctx context.Context, repo *repository.Repository, id restic.ID) error {
+func deleteKey(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, id restic.ID) error {
 	if id == repo.KeyID() {
 		return errors.Fatal("refusing to remove key currently used to access repository")
 	}
@@ -157,6 +170,7 @@ func deleteKey(ctx context.Context, repo *repository.Repository, id restic.ID) e
 	}
 
 	Verbosef("removed key %v\n", id)
+	writeAuditEntry(ctx, gopts, repo, "key-remove", nil, "removed key "+id.String())
 	return nil
 }
 
@@ -184,6 +198,7 @@ func changePassword(ctx context.Context, repo *repository.Repository, gopts Glob
 	}
 
 	Verbosef("saved new key as %s\n", id)
+	writeAuditEntry(ctx, gopts, repo, "key-passwd", nil, "replaced key "+oldID.String()+" with "+id.ID().String())
 
 	return nil
 }
@@ -201,6 +216,105 @@ func switchToNewKeyAndRemoveIfBroken(ctx context.Context, repo *repository.Repos
 	return nil
 }
 
+func rotateKey(ctx context.Context, repo *repository.Repository, gopts GlobalOptions) error {
+	if !keyRotateConfirm {
+		return errors.Fatal("rotating the master key downloads, re-encrypts and uploads all files in the repository, pass --confirm to start")
+	}
+
+	if gopts.NoCache {
+		return errors.Fatal("rotating the master key requires the local cache to store the state of the rotation")
+	}
+	cacheDir := gopts.CacheDir
+	if cacheDir == "" {
+		var err error
+		cacheDir, err = cache.DefaultDir()
+		if err != nil {
+			return err
+		}
+	}
+	stateFile := filepath.Join(cacheDir, repo.Config().ID, "key-rotation")
+
+	oldKey, newKey, err := repository.LoadRotationState(stateFile, repo.Key())
+	switch {
+	case err == nil:
+		Verbosef("resuming the interrupted rotation of the master key\n")
+	case errors.Is(err, os.ErrNotExist):
+		oldKey, newKey = repo.Key(), crypto.NewRandomKey()
+		err = repository.SaveRotationState(stateFile, oldKey, newKey)
+		if err != nil {
+			return errors.Fatalf("unable to save the state of the key rotation: %v", err)
+		}
+	default:
+		return errors.Fatalf("unable to load the state of the key rotation: %v", err)
+	}
+
+	kr, err := repository.NewKeyRotation(repo, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+
+	var pw string
+	if !kr.Switched() {
+		pw, err = getNewPassword(gopts)
+		if err != nil {
+			return err
+		}
+	}
+
+	Verbosef("load index files\n")
+	bar := newProgressMax(!gopts.Quiet, 0, "packs checked")
+	resumed, err := kr.LoadIndex(ctx, bar)
+	bar.Done()
+	if err != nil {
+		return err
+	}
+	if resumed > 0 {
+		Verbosef("%d packs have been re-encrypted before\n", resumed)
+	}
+
+	Verbosef("re-encrypt pack files\n")
+	bar = newProgressMax(!gopts.Quiet, 0, "blobs re-encrypted")
+	err = kr.RewritePacks(ctx, bar)
+	bar.Done()
+	if err != nil {
+		return err
+	}
+
+	if !kr.Switched() {
+		Verbosef("switch to the new master key\n")
+		err = kr.SwitchKey(ctx, pw, keyUsername, keyHostname, stateFile+"-config")
+		if err != nil {
+			return err
+		}
+	}
+
+	Verbosef("re-encrypt index and snapshots\n")
+	bar = newProgressMax(!gopts.Quiet, 0, "snapshots re-encrypted")
+	err = kr.RewriteMetadata(ctx, bar)
+	bar.Done()
+	if err != nil {
+		return err
+	}
+
+	Verbosef("remove files of the old master key\n")
+	bar = newProgressMax(!gopts.Quiet, 0, "files removed")
+	err = kr.RemoveOldFiles(ctx, bar)
+	bar.Done()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(stateFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		Warnf("unable to remove the state of the key rotation: %v\n", err)
+	}
+
+	id := kr.Repository().KeyID()
+	Printf("rotated the master key, saved new key as %s\n", id.Str())
+	writeAuditEntry(ctx, gopts, kr.Repository(), "key-rotate", nil, "rotated the master key, new key "+id.String())
+	return nil
+}
+
 func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
 	if len(args) < 1 || (args[0] == "remove" && len(args) != 2) || (args[0] != "remove" && len(args) != 1) {
 		return errors.Fatal("wrong number of arguments")
@@ -240,7 +354,7 @@ func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return deleteKey(ctx, repo, id)
+		return deleteKey(ctx, repo, gopts, id)
 	case "passwd":
 		lock, ctx, err := lockRepoExclusive(ctx, repo)
 		defer unlockRepo(lock)
@@ -249,15 +363,15 @@ func runKey(ctx context.Context, gopts GlobalOptions, args []string) error {
 		}
 
 		return changePassword(ctx, repo, gopts)
+	case "rotate":
+		lock, ctx, err := lockRepoExclusive(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+
+		return rotateKey(ctx, repo, gopts)
 	}
 
 	return nil
 }
-
-func loadPasswordFromFile(pwdFile string) (string, error) {
-	s, err := ioutil.ReadFile(pwdFile)
-	if os.IsNotExist(err) {
-		return "", errors.Fatalf("%s does not exist", pwdFile)
-	}
-	return strings.TrimSpace(string(s)), errors.Wrap(err, "Readfile")
-}
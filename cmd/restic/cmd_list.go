@@ -11,7 +11,7 @@ import (
 )
 
 var cmdList = &cobra.Command{
-	Use:   "list [flags] [blobs|packs|index|snapshots|keys|locks]",
+	Use:   "list [flags] [blobs|packs|index|snapshots|keys|locks|audit|signatures|manifests]",
 	Short: "List objects in the repository",
 	Long: `
 The "list" command allows listing objects in the repository based on type.
@@ -62,6 +62,12 @@ func runList(ctx context.Context, cmd *cobra.Command, opts GlobalOptions, args [
 		t = restic.KeyFile
 	case "locks":
 		t = restic.LockFile
+	case "audit":
+		t = restic.AuditFile
+	case "signatures":
+		t = restic.SignatureFile
+	case "manifests":
+		t = restic.ManifestFile
 	case "blobs":
 		return index.ForAllIndexes(ctx, repo, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
 			if err != nil {
@@ -35,6 +35,10 @@ will allow traversing into matching directories' subfolders.
 Any directory paths specified must be absolute (starting with
 a path separator); paths use the forward slash '/' as separator.
 
+With --long, directories are listed with the total size of all files they
+contain. With --json, one JSON object is printed per line for the snapshot
+and for every listed file and directory, see the documentation for the fields.
+
 EXIT STATUS
 ===========
 
@@ -71,8 +75,9 @@ type lsSnapshot struct {
 	StructType string     `json:"struct_type"` // "snapshot"
 }
 
-// Print node in our custom JSON format, followed by a newline.
-func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
+// Print node in our custom JSON format, followed by a newline. If withSize is
+// set, the size is printed for directories as well.
+func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node, withSize bool) error {
 	n := &struct {
 		Name        string      `json:"name"`
 		Type        string      `json:"type"`
@@ -102,15 +107,59 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		ChangeTime:  node.ChangeTime,
 		StructType:  "node",
 	}
-	// Always print size for regular files, even when empty,
-	// but never for other types.
-	if node.Type == "file" {
+	// Always print size for regular files, even when empty, and for
+	// directories if requested, but never for other types.
+	if node.Type == "file" || (node.Type == "dir" && withSize) {
 		n.Size = &n.size
 	}
 
 	return enc.Encode(n)
 }
 
+// treeSizer computes the total size of the files in a tree. The sizes of the
+// trees are cached, so that each subtree is only loaded once.
+type treeSizer struct {
+	repo  restic.BlobLoader
+	sizes map[restic.ID]uint64
+}
+
+func newTreeSizer(repo restic.BlobLoader) *treeSizer {
+	return &treeSizer{
+		repo:  repo,
+		sizes: make(map[restic.ID]uint64),
+	}
+}
+
+// Size returns the size of all files contained in the tree id and its
+// subtrees. Hard linked files are counted once per link.
+func (s *treeSizer) Size(ctx context.Context, id restic.ID) (uint64, error) {
+	if size, ok := s.sizes[id]; ok {
+		return size, nil
+	}
+
+	tree, err := restic.LoadTree(ctx, s.repo, id)
+	if err != nil {
+		return 0, err
+	}
+
+	var size uint64
+	for _, node := range tree.Nodes {
+		switch {
+		case node.Type == "file":
+			size += node.Size
+		case node.Type == "dir" && node.Subtree != nil:
+			subtreeSize, err := s.Size(ctx, *node.Subtree)
+			if err != nil {
+				return 0, err
+			}
+			size += subtreeSize
+		}
+	}
+
+	s.sizes[id] = size
+	return size, nil
+}
+
 func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []string) error {
 	if len(args) == 0 {
 		return errors.Fatal("no snapshot ID specified, specify snapshot ID or use special ID 'latest'")
@@ -196,7 +245,7 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		}
 
 		printNode = func(path string, node *restic.Node) {
-			err := lsNodeJSON(enc, path, node)
+			err := lsNodeJSON(enc, path, node, opts.ListLong)
 			if err != nil {
 				Warnf("JSON encode failed: %v\n", err)
 			}
@@ -206,17 +255,19 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 			Verbosef("snapshot %s of %v filtered by %v at %s):\n", sn.ID().Str(), sn.Paths, dirs, sn.Time)
 		}
 		printNode = func(path string, node *restic.Node) {
-			Printf("%s\n", formatNode(path, node, lsOptions.ListLong))
+			Printf("%s\n", formatNode(path, node, opts.ListLong))
 		}
 	}
 
-	sn, err := restic.FindFilteredSnapshot(ctx, snapshotLister, repo, opts.Hosts, opts.Tags, opts.Paths, nil, args[0])
+	sn, err := findSingleSnapshot(ctx, snapshotLister, repo, opts.snapshotFilterOptions, args[0])
 	if err != nil {
 		return err
 	}
 
 	printSnapshot(sn)
 
+	sizer := newTreeSizer(repo)
+
 	err = walker.Walk(ctx, repo, *sn.Tree, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
 		if err != nil {
 			return false, err
@@ -226,7 +277,17 @@ func runLs(ctx context.Context, opts LsOptions, gopts GlobalOptions, args []stri
 		}
 
 		if withinDir(nodepath) {
-			// if we're within a dir, print the node
+			// if we're within a dir, print the node, directories carry the
+			// size of their contents in the long format
+			if opts.ListLong && node.Type == "dir" && node.Subtree != nil {
+				size, err := sizer.Size(ctx, *node.Subtree)
+				if err != nil {
+					return false, err
+				}
+				dir := *node
+				dir.Size = size
+				node = &dir
+			}
 			printNode(nodepath, node)
 
 			// if recursive listing is requested, signal the walker that it
@@ -15,7 +15,8 @@ func TestLsNodeJSON(t *testing.T) {
 	for _, c := range []struct {
 		path string
 		restic.Node
-		expect string
+		withSize bool
+		expect   string
 	}{
 		// Mode is omitted when zero.
 		// Permissions, by convention is "-" per mode bit
@@ -77,10 +78,22 @@ func TestLsNodeJSON(t *testing.T) {
 			},
 			expect: `{"name":"directory","type":"dir","path":"/some/directory","uid":0,"gid":0,"mode":2147484141,"permissions":"drwxr-xr-x","mtime":"2020-01-02T03:04:05Z","atime":"2021-02-03T04:05:06.000000007Z","ctime":"2022-03-04T05:06:07.000000008Z","struct_type":"node"}`,
 		},
+
+		// Directories get a size in the long format, even when empty.
+		{
+			path: "/some/empty",
+			Node: restic.Node{
+				Name: "empty",
+				Type: "dir",
+				Mode: os.ModeDir | 0700,
+			},
+			withSize: true,
+			expect:   `{"name":"empty","type":"dir","path":"/some/empty","uid":0,"gid":0,"size":0,"mode":2147484096,"permissions":"drwx------","mtime":"0001-01-01T00:00:00Z","atime":"0001-01-01T00:00:00Z","ctime":"0001-01-01T00:00:00Z","struct_type":"node"}`,
+		},
 	} {
 		buf := new(bytes.Buffer)
 		enc := json.NewEncoder(buf)
-		err := lsNodeJSON(enc, c.path, &c.Node)
+		err := lsNodeJSON(enc, c.path, &c.Node, c.withSize)
 		rtest.OK(t, err)
 		rtest.Equals(t, c.expect+"\n", buf.String())
 
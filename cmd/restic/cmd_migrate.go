@@ -17,6 +17,11 @@ The "migrate" command checks which migrations can be applied for a repository
 and prints a list with available migration names. If one or more migration
 names are specified, these migrations are applied.
 
+Some migrations, for example "upgrade_index", are applied in several steps. The
+repository is consistent after each step, an interrupted migration continues
+with the remaining steps when it is applied again. With --dry-run, the changes
+that would be made are listed without modifying the repository.
+
 EXIT STATUS
 ===========
 
@@ -30,7 +35,8 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 
 // MigrateOptions bundles all options for the 'check' command.
 type MigrateOptions struct {
-	Force bool
+	Force  bool
+	DryRun bool
 }
 
 var migrateOptions MigrateOptions
@@ -39,6 +45,7 @@ func init() {
 	cmdRoot.AddCommand(cmdMigrate)
 	f := cmdMigrate.Flags()
 	f.BoolVarP(&migrateOptions.Force, "force", "f", false, `apply a migration a second time`)
+	f.BoolVarP(&migrateOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
 }
 
 func checkMigrations(ctx context.Context, repo restic.Repository) error {
@@ -86,6 +93,14 @@ func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptio
 					Warnf("check for migration %v failed, continuing anyway\n", m.Name())
 				}
 
+				if opts.DryRun {
+					err = printMigrationChanges(ctx, m, repo)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+
 				if m.RepoCheck() {
 					Printf("checking repository integrity...\n")
 
@@ -100,7 +115,12 @@ func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptio
 				}
 
 				Printf("applying migration %v...\n", m.Name())
-				if err = m.Apply(ctx, repo); err != nil {
+				if sm, ok := m.(migrations.StepMigration); ok {
+					err = applyMigrationSteps(ctx, gopts, sm, repo)
+				} else {
+					err = m.Apply(ctx, repo)
+				}
+				if err != nil {
 					Warnf("migration %v failed: %v\n", m.Name(), err)
 					if firsterr == nil {
 						firsterr = err
@@ -116,13 +136,60 @@ func applyMigrations(ctx context.Context, opts MigrateOptions, gopts GlobalOptio
 	return firsterr
 }
 
+// printMigrationChanges lists the changes the migration would make.
+func printMigrationChanges(ctx context.Context, m migrations.Migration, repo restic.Repository) error {
+	sm, ok := m.(migrations.StepMigration)
+	if !ok {
+		Printf("would apply migration %v: %v\n", m.Name(), m.Desc())
+		return nil
+	}
+
+	steps, err := sm.Steps(ctx, repo)
+	if err != nil {
+		return err
+	}
+	Printf("would apply migration %v in %d steps:\n", m.Name(), len(steps))
+	for _, step := range steps {
+		Printf("  %v\n", step.Desc)
+	}
+	return nil
+}
+
+// applyMigrationSteps applies the remaining steps of the migration one after
+// another and reports the progress.
+func applyMigrationSteps(ctx context.Context, gopts GlobalOptions, m migrations.StepMigration, repo restic.Repository) error {
+	steps, err := m.Steps(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	bar := newProgressMax(!gopts.Quiet, uint64(len(steps)), "steps")
+	for i, step := range steps {
+		Verboseff("%v\n", step.Desc)
+		err = step.Apply(ctx)
+		if err != nil {
+			bar.Done()
+			Warnf("applied %d of %d steps, apply the migration again to continue\n", i, len(steps))
+			return err
+		}
+		bar.Add(1)
+	}
+	bar.Done()
+	return nil
+}
+
 func runMigrate(ctx context.Context, opts MigrateOptions, gopts GlobalOptions, args []string) error {
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
 		return err
 	}
 
-	lock, ctx, err := lockRepoExclusive(ctx, repo)
+	var lock *restic.Lock
+	if opts.DryRun {
+		lock, ctx, err = lockRepo(ctx, repo)
+	} else {
+		lock, ctx, err = lockRepoExclusive(ctx, repo)
+	}
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
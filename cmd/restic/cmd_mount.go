@@ -53,8 +53,13 @@ For path templates, you can use the following patterns which will be replaced:
     %u by username
     %h by hostname
     %t by tags
+    %p by backed up paths
     %T by timestamp as specified by --time-template
 
+Snapshots with several tags or paths appear in one directory for each of
+them, snapshots without tags or paths are not listed for templates using %t
+or %p. Slashes in tags and paths are replaced by underscores.
+
 The default path templates are:
     "ids/%i"
     "snapshots/%T"
@@ -80,6 +85,7 @@ type MountOptions struct {
 	snapshotFilterOptions
 	TimeTemplate  string
 	PathTemplates []string
+	Readahead     int
 }
 
 var mountOptions MountOptions
@@ -98,6 +104,7 @@ func init() {
 	mountFlags.StringVar(&mountOptions.TimeTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
 	mountFlags.StringVar(&mountOptions.TimeTemplate, "time-template", time.RFC3339, "set `template` to use for times")
 	_ = mountFlags.MarkDeprecated("snapshot-template", "use --time-template")
+	mountFlags.IntVar(&mountOptions.Readahead, "readahead", 2, "prefetch the next `n` blobs when a file is read sequentially (0 disables prefetching)")
 }
 
 func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args []string) error {
@@ -109,6 +116,16 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		return errors.Fatal("time template string cannot start or end with '/'")
 	}
 
+	if opts.Readahead < 0 {
+		return errors.Fatal("--readahead must not be negative")
+	}
+
+	for _, templ := range opts.PathTemplates {
+		if err := fuse.ValidatePathTemplate(templ); err != nil {
+			return errors.Fatalf("invalid --path-template: %v", err)
+		}
+	}
+
 	if len(args) == 0 {
 		return errors.Fatal("wrong number of parameters")
 	}
@@ -185,6 +202,7 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		Paths:         opts.Paths,
 		TimeTemplate:  opts.TimeTemplate,
 		PathTemplates: opts.PathTemplates,
+		Readahead:     opts.Readahead,
 	}
 	root := fuse.NewRoot(repo, cfg)
 
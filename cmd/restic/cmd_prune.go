@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -56,6 +58,8 @@ type PruneOptions struct {
 	RepackCachableOnly bool
 	RepackSmall        bool
 	RepackUncompressed bool
+
+	TreeConcurrency uint
 }
 
 var pruneOptions PruneOptions
@@ -71,10 +75,43 @@ func init() {
 func addPruneOptions(c *cobra.Command) {
 	f := c.Flags()
 	f.StringVar(&pruneOptions.MaxUnused, "max-unused", "5%", "tolerate given `limit` of unused data (absolute value in bytes with suffixes k/K, m/M, g/G, t/T, a value in % or the word 'unlimited')")
+	f.Var(newMaxUnusedPercentValue(&pruneOptions.MaxUnused), "max-unused-percent", "tolerate given `percentage` of unused data (same as --max-unused with a value in %)")
 	f.StringVar(&pruneOptions.MaxRepackSize, "max-repack-size", "", "maximum `size` to repack (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.StringVar(&pruneOptions.MaxRepackSize, "max-repack-bytes", "", "maximum `size` to repack (same as --max-repack-size)")
 	f.BoolVar(&pruneOptions.RepackCachableOnly, "repack-cacheable-only", false, "only repack packs which are cacheable")
 	f.BoolVar(&pruneOptions.RepackSmall, "repack-small", false, "repack pack files below 80% of target pack size")
 	f.BoolVar(&pruneOptions.RepackUncompressed, "repack-uncompressed", false, "repack all uncompressed data")
+	f.UintVar(&pruneOptions.TreeConcurrency, "tree-concurrency", 0, "load `n` trees concurrently while finding the data in use (default: number of connections plus number of CPUs)")
+}
+
+// maxUnusedPercentValue implements pflag.Value for --max-unused-percent, the
+// percentage is stored in the format accepted by --max-unused.
+type maxUnusedPercentValue struct {
+	maxUnused *string
+}
+
+func newMaxUnusedPercentValue(maxUnused *string) *maxUnusedPercentValue {
+	return &maxUnusedPercentValue{maxUnused: maxUnused}
+}
+
+func (v *maxUnusedPercentValue) String() string {
+	if !strings.HasSuffix(*v.maxUnused, "%") {
+		return ""
+	}
+	return strings.TrimSuffix(*v.maxUnused, "%")
+}
+
+func (v *maxUnusedPercentValue) Set(s string) error {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "%")
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return errors.Errorf("invalid percentage %q", s)
+	}
+	*v.maxUnused = s + "%"
+	return nil
+}
+
+func (v *maxUnusedPercentValue) Type() string {
+	return "percentage"
 }
 
 func verifyPruneOptions(opts *PruneOptions) error {
@@ -142,6 +179,10 @@ func runPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions) error
 		return err
 	}
 
+	if gopts.AppendOnly && !opts.DryRun {
+		return errors.Fatal("prune removes data and is not possible in append-only mode")
+	}
+
 	if opts.RepackUncompressed && gopts.Compression == repository.CompressionOff {
 		return errors.Fatal("disabled compression and `--repack-uncompressed` are mutually exclusive")
 	}
@@ -201,7 +242,16 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOption
 		return err
 	}
 
-	return doPrune(ctx, opts, gopts, repo, plan)
+	err = doPrune(ctx, opts, gopts, repo, plan)
+	if err != nil {
+		return err
+	}
+
+	if !opts.DryRun {
+		writeAuditEntry(ctx, gopts, repo, "prune", nil, fmt.Sprintf("removed %d packs, repacked %d packs",
+			len(plan.removePacksFirst)+len(plan.removePacks), len(plan.repackPacks)))
+	}
+	return nil
 }
 
 type pruneStats struct {
@@ -221,6 +271,9 @@ type pruneStats struct {
 		repack    uint64
 		repackrm  uint64
 		unref     uint64
+		// unused data in packs which are kept due to --max-unused or
+		// --max-repack-size
+		keepUnused uint64
 	}
 	packs struct {
 		used       uint
@@ -228,6 +281,7 @@ type pruneStats struct {
 		partlyUsed uint
 		unref      uint
 		keep       uint
+		keepUnused uint
 		repack     uint
 		remove     uint
 	}
@@ -239,6 +293,7 @@ type prunePlan struct {
 	keepBlobs        restic.CountedBlobSet // blobs to keep during repacking
 	removePacks      restic.IDSet          // packs to remove
 	ignorePacks      restic.IDSet          // packs to ignore when rebuilding the index
+	snapshots        restic.IDSet          // snapshots which are kept, used to find orphaned signatures
 }
 
 type packInfo struct {
@@ -260,7 +315,7 @@ type packInfoWithID struct {
 func planPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo restic.Repository, ignoreSnapshots restic.IDSet) (prunePlan, pruneStats, error) {
 	var stats pruneStats
 
-	usedBlobs, err := getUsedBlobs(ctx, gopts, repo, ignoreSnapshots)
+	usedBlobs, snapshots, err := getUsedBlobs(ctx, gopts, repo, ignoreSnapshots, int(opts.TreeConcurrency))
 	if err != nil {
 		return prunePlan{}, stats, err
 	}
@@ -297,6 +352,7 @@ func planPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo
 		keepBlobs = nil
 	}
 	plan.keepBlobs = keepBlobs
+	plan.snapshots = snapshots
 
 	return plan, stats, nil
 }
@@ -605,6 +661,14 @@ func decidePackAction(ctx context.Context, opts PruneOptions, gopts GlobalOption
 	// calculate limit for number of unused bytes in the repo after repacking
 	maxUnusedSizeAfter := opts.maxUnusedBytes(stats.size.used)
 
+	keep := func(p packInfo) {
+		stats.packs.keep++
+		if p.unusedSize > 0 {
+			stats.packs.keepUnused++
+			stats.size.keepUnused += p.unusedSize
+		}
+	}
+
 	for _, p := range repackCandidates {
 		reachedUnusedSizeAfter := (stats.size.unused-stats.size.remove-stats.size.repackrm < maxUnusedSizeAfter)
 		reachedRepackSize := stats.size.repack+p.unusedSize+p.usedSize >= opts.MaxRepackBytes
@@ -612,7 +676,7 @@ func decidePackAction(ctx context.Context, opts PruneOptions, gopts GlobalOption
 
 		switch {
 		case reachedRepackSize:
-			stats.packs.keep++
+			keep(p.packInfo)
 
 		case p.tpe != restic.DataBlob, p.uncompressed:
 			// repacking non-data packs / uncompressed-trees is only limited by repackSize
@@ -620,7 +684,7 @@ func decidePackAction(ctx context.Context, opts PruneOptions, gopts GlobalOption
 
 		case reachedUnusedSizeAfter && packIsLargeEnough:
 			// for all other packs stop repacking if tolerated unused size is reached.
-			stats.packs.keep++
+			keep(p.packInfo)
 
 		default:
 			repack(p.ID, p.packInfo)
@@ -663,6 +727,10 @@ func printPruneStats(gopts GlobalOptions, stats pruneStats) error {
 	unusedAfter := unusedSize - stats.size.remove - stats.size.repackrm
 	Verbosef("unused size after prune: %s (%s of remaining size)\n",
 		ui.FormatBytes(unusedAfter), ui.FormatPercent(unusedAfter, totalSize-totalPruneSize))
+	if stats.packs.keepUnused > 0 {
+		Verbosef("left unused:  %10d packs / %s\n",
+			stats.packs.keepUnused, ui.FormatBytes(stats.size.keepUnused))
+	}
 	Verbosef("\n")
 	Verboseff("totally used packs: %10d\n", stats.packs.used)
 	Verboseff("partly used packs:  %10d\n", stats.packs.partlyUsed)
@@ -682,6 +750,7 @@ func printPruneStats(gopts GlobalOptions, stats pruneStats) error {
 // - repack given pack files while keeping the given blobs
 // - rebuild the index while ignoring all files that will be deleted
 // - delete the files
+// - delete the signatures of snapshots which no longer exist
 // plan.removePacks and plan.ignorePacks are modified in this function.
 func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo restic.Repository, plan prunePlan) (err error) {
 	if opts.DryRun {
@@ -700,6 +769,7 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 	if len(plan.removePacksFirst) != 0 {
 		Verbosef("deleting unreferenced packs\n")
 		DeleteFiles(ctx, gopts, repo, plan.removePacksFirst, restic.PackFile)
+		DeletePackManifests(ctx, gopts, repo, plan.removePacksFirst)
 	}
 
 	if len(plan.repackPacks) != 0 {
@@ -749,6 +819,7 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 	if len(plan.removePacks) != 0 {
 		Verbosef("removing %d old packs\n", len(plan.removePacks))
 		DeleteFiles(ctx, gopts, repo, plan.removePacks, restic.PackFile)
+		DeletePackManifests(ctx, gopts, repo, plan.removePacks)
 	}
 
 	if opts.unsafeRecovery {
@@ -758,6 +829,8 @@ func doPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, repo r
 		}
 	}
 
+	DeleteOrphanedSignatures(ctx, gopts, repo, plan.snapshots)
+
 	Verbosef("done\n")
 	return nil
 }
@@ -781,8 +854,12 @@ func rebuildIndexFiles(ctx context.Context, gopts GlobalOptions, repo restic.Rep
 	return DeleteFilesChecked(ctx, gopts, repo, obsoleteIndexes, restic.IndexFile)
 }
 
-func getUsedBlobs(ctx context.Context, gopts GlobalOptions, repo restic.Repository, ignoreSnapshots restic.IDSet) (usedBlobs restic.CountedBlobSet, err error) {
+// getUsedBlobs returns the blobs referenced by the snapshots which are not in
+// ignoreSnapshots, along with the IDs of these snapshots. The trees are loaded
+// by the given number of workers, or the default number if workers is zero.
+func getUsedBlobs(ctx context.Context, gopts GlobalOptions, repo restic.Repository, ignoreSnapshots restic.IDSet, workers int) (usedBlobs restic.CountedBlobSet, snapshots restic.IDSet, err error) {
 	var snapshotTrees restic.IDs
+	snapshots = restic.NewIDSet()
 	Verbosef("loading all snapshots...\n")
 	err = restic.ForAllSnapshots(ctx, repo.Backend(), repo, ignoreSnapshots,
 		func(id restic.ID, sn *restic.Snapshot, err error) error {
@@ -792,26 +869,36 @@ func getUsedBlobs(ctx context.Context, gopts GlobalOptions, repo restic.Reposito
 			}
 			debug.Log("add snapshot %v (tree %v)", id, *sn.Tree)
 			snapshotTrees = append(snapshotTrees, *sn.Tree)
+			snapshots.Insert(id)
 			return nil
 		})
 	if err != nil {
-		return nil, errors.Fatalf("failed loading snapshot: %v", err)
+		return nil, nil, errors.Fatalf("failed loading snapshot: %v", err)
 	}
 
 	Verbosef("finding data that is still in use for %d snapshots\n", len(snapshotTrees))
 
 	usedBlobs = restic.NewCountedBlobSet()
 
-	bar := newProgressMax(!gopts.Quiet, uint64(len(snapshotTrees)), "snapshots")
+	var trees uint64
+	bar := newProgressMaxDetails(!gopts.Quiet, uint64(len(snapshotTrees)), "snapshots", func() string {
+		return fmt.Sprintf("%d trees", atomic.LoadUint64(&trees))
+	})
 	defer bar.Done()
 
-	err = restic.FindUsedBlobs(ctx, repo, snapshotTrees, usedBlobs, bar)
+	opts := restic.FindUsedBlobsOptions{
+		Workers: workers,
+		TreeLoaded: func() {
+			atomic.AddUint64(&trees, 1)
+		},
+	}
+	err = restic.FindUsedBlobsWithOptions(ctx, repo, snapshotTrees, usedBlobs, bar, opts)
 	if err != nil {
 		if repo.Backend().IsNotExist(err) {
-			return nil, errors.Fatal("unable to load a tree from the repository: " + err.Error())
+			return nil, nil, errors.Fatal("unable to load a tree from the repository: " + err.Error())
 		}
 
-		return nil, err
+		return nil, nil, err
 	}
-	return usedBlobs, nil
+	return usedBlobs, snapshots, nil
 }
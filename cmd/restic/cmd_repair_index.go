@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairIndex = &cobra.Command{
+	Use:   "index [flags]",
+	Short: "Build a new index",
+	Long: `
+The "repair index" command creates a new index based on the pack files in the
+repository, like "rebuild-index".
+
+With --compact, the pack files are not listed or read. Instead, the existing
+index is rewritten into as few index files as possible, which speeds up
+loading the index after many backups have each added a few small index files.
+This only changes how the index is split into files, the index still
+references the same blobs in the same pack files.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairIndex(cmd.Context(), repairIndexOptions, globalOptions)
+	},
+}
+
+// RepairIndexOptions collects all options for the 'repair index' command.
+type RepairIndexOptions struct {
+	RebuildIndexOptions
+	Compact bool
+}
+
+var repairIndexOptions RepairIndexOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairIndex)
+	f := cmdRepairIndex.Flags()
+	f.BoolVar(&repairIndexOptions.ReadAllPacks, "read-all-packs", false, "read all pack files to generate new index from scratch")
+	f.BoolVar(&repairIndexOptions.Compact, "compact", false, "only merge the existing index files into as few files as possible")
+}
+
+func runRepairIndex(ctx context.Context, opts RepairIndexOptions, gopts GlobalOptions) error {
+	if opts.Compact && opts.ReadAllPacks {
+		return errors.Fatal("--compact and --read-all-packs cannot be combined")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	lock, ctx, err := lockRepoExclusive(ctx, repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	if opts.Compact {
+		return compactIndex(ctx, gopts, repo)
+	}
+	return rebuildIndex(ctx, opts.RebuildIndexOptions, gopts, repo, restic.NewIDSet())
+}
+
+// listIndexFiles returns the number and the total size of the index files
+// stored in repo.
+func listIndexFiles(ctx context.Context, repo restic.Repository) (int, uint64, error) {
+	var count int
+	var size uint64
+	err := repo.List(ctx, restic.IndexFile, func(_ restic.ID, fileSize int64) error {
+		count++
+		size += uint64(fileSize)
+		return nil
+	})
+	return count, size, err
+}
+
+// compactIndex rewrites the index of repo into as few index files as possible.
+// The blobs and packs in the index are not changed.
+func compactIndex(ctx context.Context, gopts GlobalOptions, repo *repository.Repository) error {
+	Verbosef("loading indexes...\n")
+	err := repo.LoadIndex(ctx)
+	if err != nil {
+		return errors.Fatalf("unable to load the index, run \"restic repair index\" without --compact first: %v", err)
+	}
+
+	if len(repo.Index().(*index.MasterIndex).IDs()) <= 1 {
+		Printf("the index is already compact\n")
+		return nil
+	}
+	countBefore, sizeBefore, err := listIndexFiles(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	err = rebuildIndexFiles(ctx, gopts, repo, restic.NewIDSet(), nil)
+	if err != nil {
+		return err
+	}
+
+	// the loaded index does not know which index files have been written and
+	// removed, list them in the repository instead
+	countAfter, sizeAfter, err := listIndexFiles(ctx, repo)
+	if err != nil {
+		return err
+	}
+	Printf("index files: %d before, %d after\n", countBefore, countAfter)
+	Printf("index size:  %s before, %s after\n", ui.FormatBytes(sizeBefore), ui.FormatBytes(sizeAfter))
+	return nil
+}
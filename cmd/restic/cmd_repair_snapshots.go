@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairSnapshots = &cobra.Command{
+	Use:   "snapshots [flags] [snapshot-ID ...]",
+	Short: "Repair snapshots",
+	Long: `
+The "repair snapshots" command fixes snapshots which reference data that is no
+longer contained in the repository.
+
+With --fix-parents, snapshots whose parent snapshot does not exist anymore,
+for example because it was removed by "forget" or was not copied by "copy",
+are repaired. By default, the reference to the parent is removed. With
+--relink, the newest snapshot of the same host which was created before the
+snapshot and contains all of its paths is used as the new parent instead, like
+"backup" selects a parent snapshot.
+
+Modified snapshots are saved as new snapshots and the old ones are removed. As
+this changes the IDs, the snapshots which use a repaired snapshot as parent are
+updated as well.
+
+When no snapshot-ID is given, all snapshots matching the host, tag and path
+filter criteria are repaired.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairSnapshots(cmd.Context(), repairSnapshotsOptions, globalOptions, args)
+	},
+}
+
+// RepairSnapshotsOptions bundles all options for the 'repair snapshots' command.
+type RepairSnapshotsOptions struct {
+	snapshotFilterOptions
+	FixParents bool
+	Relink     bool
+	DryRun     bool
+}
+
+var repairSnapshotsOptions RepairSnapshotsOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairSnapshots)
+
+	f := cmdRepairSnapshots.Flags()
+	f.BoolVar(&repairSnapshotsOptions.FixParents, "fix-parents", false, "repair snapshots whose parent snapshot does not exist")
+	f.BoolVar(&repairSnapshotsOptions.Relink, "relink", false, "with --fix-parents, use the nearest older snapshot of the same host and paths as parent instead of removing the parent")
+	f.BoolVarP(&repairSnapshotsOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+	initMultiSnapshotFilterOptions(f, &repairSnapshotsOptions.snapshotFilterOptions, true)
+}
+
+// nearestParent returns the newest snapshot in list which was created before
+// sn on the same host and contains all paths of sn. This is the snapshot
+// backup would have selected as parent. It returns nil if there is no such
+// snapshot.
+func nearestParent(list restic.Snapshots, sn *restic.Snapshot) *restic.Snapshot {
+	var parent *restic.Snapshot
+	for _, candidate := range list {
+		if candidate == sn || !candidate.Time.Before(sn.Time) {
+			continue
+		}
+		if candidate.Hostname != sn.Hostname || !candidate.HasPaths(sn.Paths) {
+			continue
+		}
+		if parent == nil || candidate.Time.After(parent.Time) {
+			parent = candidate
+		}
+	}
+	return parent
+}
+
+// replaceSnapshot saves sn as a new snapshot and removes the old one. The ID
+// of the new snapshot is returned, the ID of the first version of the snapshot
+// is retained in sn.Original over all changes.
+func replaceSnapshot(ctx context.Context, repo restic.Repository, sn *restic.Snapshot) (restic.ID, error) {
+	oldID := *sn.ID()
+	if sn.Original == nil {
+		sn.Original = &oldID
+	}
+
+	id, err := restic.SaveSnapshot(ctx, repo, sn)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	debug.Log("new snapshot saved as %v", id)
+
+	h := restic.Handle{Type: restic.SnapshotFile, Name: oldID.String()}
+	if err = repo.Backend().Remove(ctx, h); err != nil {
+		return restic.ID{}, err
+	}
+	debug.Log("old snapshot %v removed", oldID)
+
+	return id, nil
+}
+
+func runRepairSnapshots(ctx context.Context, opts RepairSnapshotsOptions, gopts GlobalOptions, args []string) error {
+	if !opts.FixParents {
+		return errors.Fatal("nothing to do, use --fix-parents")
+	}
+	if gopts.AppendOnly && !opts.DryRun {
+		return errors.Fatal("repair snapshots replaces snapshots and is not possible in append-only mode")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		if opts.DryRun {
+			lock, ctx, err = lockRepo(ctx, repo)
+		} else {
+			Verbosef("create exclusive lock for repository\n")
+			lock, ctx, err = lockRepoExclusive(ctx, repo)
+		}
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	snapshotLister, err := backend.MemorizeList(ctx, repo.Backend(), restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+
+	// all snapshots are candidates for the new parent, only the selected
+	// ones are repaired
+	var all restic.Snapshots
+	existing := restic.NewIDSet()
+	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, nil, nil, nil, nil) {
+		all = append(all, sn)
+		existing.Insert(*sn.ID())
+	}
+	selected := restic.NewIDSet()
+	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+		selected.Insert(*sn.ID())
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// process the snapshots from old to new, so that parents are replaced
+	// before the snapshots referencing them
+	sort.Sort(sort.Reverse(all))
+
+	// replaced maps the IDs of the snapshots which have been saved again to
+	// their new IDs
+	replaced := make(map[restic.ID]restic.ID)
+	var fixed, updated int
+
+	for _, sn := range all {
+		if sn.Parent == nil {
+			continue
+		}
+		id := *sn.ID()
+
+		var newParent *restic.ID
+		if newID, ok := replaced[*sn.Parent]; ok {
+			newParent = &newID
+			Verbosef("snapshot %v: parent %v was replaced by %v\n", id.Str(), sn.Parent.Str(), newID.Str())
+			updated++
+		} else if existing.Has(*sn.Parent) || !selected.Has(id) {
+			continue
+		} else {
+			var parent *restic.Snapshot
+			if opts.Relink {
+				parent = nearestParent(all, sn)
+			}
+
+			if parent != nil {
+				parentID := *parent.ID()
+				if newID, ok := replaced[parentID]; ok {
+					parentID = newID
+				}
+				newParent = &parentID
+				Printf("snapshot %v: parent %v does not exist, relinked to %v\n", id.Str(), sn.Parent.Str(), parentID.Str())
+			} else {
+				Printf("snapshot %v: parent %v does not exist, removed the parent\n", id.Str(), sn.Parent.Str())
+			}
+			fixed++
+		}
+
+		if opts.DryRun {
+			continue
+		}
+
+		sn.Parent = newParent
+		newID, err := replaceSnapshot(ctx, repo, sn)
+		if err != nil {
+			return errors.Fatalf("unable to save the repaired snapshot %v: %v", id.Str(), err)
+		}
+		replaced[id] = newID
+	}
+
+	switch {
+	case fixed == 0:
+		Printf("no snapshots with missing parents found\n")
+	case opts.DryRun:
+		Printf("would repair %d snapshots\n", fixed)
+	default:
+		Printf("repaired %d snapshots, updated the parent of %d other snapshots\n", fixed, updated)
+	}
+	return nil
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/restorer"
+	restoreui "github.com/restic/restic/internal/ui/restore"
+	"github.com/restic/restic/internal/ui/termstatus"
 
 	"github.com/spf13/cobra"
 )
@@ -21,9 +29,19 @@ var cmdRestore = &cobra.Command{
 The "restore" command extracts the data from a snapshot from the repository to
 a directory.
 
+With "--target -", the snapshot is written as an archive to stdout instead,
+nothing is written to the local disk. The format of the archive is selected
+with --archive, either "tar" or "zip". Only files, directories and symlinks are
+contained in the archive, the progress is printed to stderr.
+
 The special snapshot "latest" can be used to restore the latest snapshot in the
 repository.
 
+With "--resume", the files which have been restored completely are recorded in
+the local cache. When an interrupted restore of the same snapshot to the same
+target is run again with "--resume", these files are skipped unless their size
+or modification time has changed since.
+
 EXIT STATUS
 ===========
 
@@ -31,7 +49,28 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runRestore(cmd.Context(), restoreOptions, globalOptions, args)
+		ctx := cmd.Context()
+		var wg sync.WaitGroup
+		cancelCtx, cancel := context.WithCancel(ctx)
+		defer func() {
+			// shutdown termstatus
+			cancel()
+			wg.Wait()
+		}()
+
+		// stdout receives the archive when restoring to "-"
+		stdout := globalOptions.stdout
+		if restoreOptions.Target == "-" {
+			stdout = globalOptions.stderr
+		}
+		term := termstatus.New(stdout, globalOptions.stderr, globalOptions.Quiet)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			term.Run(cancelCtx)
+		}()
+
+		return runRestore(ctx, restoreOptions, globalOptions, term, args)
 	},
 }
 
@@ -42,9 +81,13 @@ type RestoreOptions struct {
 	Include            []string
 	InsensitiveInclude []string
 	Target             string
+	Archive            string
 	snapshotFilterOptions
-	Sparse bool
-	Verify bool
+	Sparse         bool
+	Verify         bool
+	VerifyManifest string
+	SkipUnchanged  bool
+	Resume         bool
 }
 
 var restoreOptions RestoreOptions
@@ -57,14 +100,22 @@ func init() {
 	flags.StringArrayVar(&restoreOptions.InsensitiveExclude, "iexclude", nil, "same as `--exclude` but ignores the casing of filenames")
 	flags.StringArrayVarP(&restoreOptions.Include, "include", "i", nil, "include a `pattern`, exclude everything else (can be specified multiple times)")
 	flags.StringArrayVar(&restoreOptions.InsensitiveInclude, "iinclude", nil, "same as `--include` but ignores the casing of filenames")
-	flags.StringVarP(&restoreOptions.Target, "target", "t", "", "directory to extract data to")
+	flags.StringVarP(&restoreOptions.Target, "target", "t", "", "directory to extract data to, or \"-\" to write an archive to stdout")
+	flags.StringVar(&restoreOptions.Archive, "archive", "tar", "set archive `format` as \"tar\" or \"zip\" for --target -")
 
 	initSingleSnapshotFilterOptions(flags, &restoreOptions.snapshotFilterOptions)
-	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore files as sparse")
+	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore all files containing blocks of zeros as sparse, not only files which were sparse at backup time")
 	flags.BoolVar(&restoreOptions.Verify, "verify", false, "verify restored files content")
+	flags.StringVar(&restoreOptions.VerifyManifest, "verify-manifest", "", "write the SHA-256 hash of each verified file to `file`, implies --verify")
+	flags.BoolVar(&restoreOptions.SkipUnchanged, "skip-unchanged", false, "do not rewrite existing files in the target whose content already matches the snapshot")
+	flags.BoolVar(&restoreOptions.Resume, "resume", false, "record restored files and skip the files restored by a previous, interrupted restore of the snapshot to the same target")
 }
 
-func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, args []string) error {
+// resumeStateInterval is the interval in which the state of the restore is
+// written with --resume.
+const resumeStateInterval = time.Minute
+
+func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
 	hasExcludes := len(opts.Exclude) > 0 || len(opts.InsensitiveExclude) > 0
 	hasIncludes := len(opts.Include) > 0 || len(opts.InsensitiveInclude) > 0
 
@@ -113,6 +164,25 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
+	if opts.VerifyManifest != "" {
+		opts.Verify = true
+	}
+
+	toArchive := opts.Target == "-"
+	if toArchive {
+		switch opts.Archive {
+		case "tar", "zip":
+		default:
+			return errors.Fatalf("unknown archive format %q", opts.Archive)
+		}
+		if opts.Sparse || opts.Verify || opts.SkipUnchanged || opts.Resume {
+			return errors.Fatal("--sparse, --verify, --skip-unchanged and --resume cannot be used with --target -")
+		}
+		if err := checkStdoutArchive(); err != nil {
+			return errors.Fatal(err.Error())
+		}
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -131,7 +201,7 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		}
 	}
 
-	sn, err := restic.FindFilteredSnapshot(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, nil, snapshotIDString)
+	sn, err := findSingleSnapshot(ctx, repo.Backend(), repo, opts.snapshotFilterOptions, snapshotIDString)
 	if err != nil {
 		Exitf(1, "failed to find snapshot: %v", err)
 	}
@@ -141,13 +211,48 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		return err
 	}
 
-	res := restorer.NewRestorer(ctx, repo, sn, opts.Sparse)
+	var progressPrinter restoreui.ProgressPrinter
+	if gopts.JSON {
+		progressPrinter = restoreui.NewJSONProgress(term, gopts.verbosity)
+	} else {
+		progressPrinter = restoreui.NewTextProgress(term, gopts.verbosity)
+	}
+	interval := calculateProgressInterval(!gopts.Quiet, gopts.JSON)
+	if toArchive {
+		// the progress is printed to stderr
+		interval = progressInterval(!gopts.Quiet, gopts.JSON, term.StatusMode())
+	}
+	progress := restoreui.NewProgress(progressPrinter, interval)
+
+	res := restorer.NewRestorer(ctx, repo, sn, opts.Sparse, progress)
+	res.SkipUnchanged = opts.SkipUnchanged
+
+	var stateFile string
+	// stateRemoved is set once the restore has completed, it is accessed
+	// atomically
+	var stateRemoved int32
+	if opts.Resume {
+		res.Resume, stateFile, err = loadResumeState(repo, *sn.ID(), opts.Target)
+		if err != nil {
+			return err
+		}
+		if n := res.Resume.Len(); n > 0 && !gopts.JSON {
+			Verbosef("resuming restore, %d files have been restored before\n", n)
+		}
+
+		// also keep the state when the restore is interrupted
+		AddCleanupHandler(func(code int) (int, error) {
+			if code == 0 || atomic.LoadInt32(&stateRemoved) != 0 {
+				return code, nil
+			}
+			return code, res.Resume.Save(stateFile)
+		})
+	}
 
 	totalErrors := 0
 	res.Error = func(location string, err error) error {
-		Warnf("ignoring error for %s: %s\n", location, err)
 		totalErrors++
-		return nil
+		return progress.Error(location, err)
 	}
 
 	excludePatterns := filter.ParsePatterns(opts.Exclude)
@@ -198,31 +303,194 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, a
 		res.SelectFilter = selectIncludeFilter
 	}
 
-	Verbosef("restoring %s to %s\n", res.Snapshot(), opts.Target)
+	if toArchive {
+		progressPrinter.V("restoring %s as %s archive to stdout\n", res.Snapshot(), opts.Archive)
+	} else if !gopts.JSON {
+		Verbosef("restoring %s to %s\n", res.Snapshot(), opts.Target)
+	}
 
-	err = res.RestoreTo(ctx, opts.Target)
-	if err != nil {
-		return err
+	progressCtx, cancelProgress := context.WithCancel(ctx)
+	var manifest *verifyManifest
+	if opts.VerifyManifest != "" {
+		manifest, err = newVerifyManifest(opts.VerifyManifest)
+		if err != nil {
+			cancelProgress()
+			return err
+		}
+		res.VerifiedFile = manifest.add
 	}
 
-	if totalErrors > 0 {
-		return errors.Fatalf("There were %d errors\n", totalErrors)
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		progress.Run(progressCtx)
+	}()
+
+	stateDone := make(chan struct{})
+	if res.Resume != nil {
+		go func() {
+			defer close(stateDone)
+			writeResumeStates(progressCtx, res.Resume, stateFile)
+		}()
+	} else {
+		close(stateDone)
 	}
 
-	if opts.Verify {
-		Verbosef("verifying files in %s\n", opts.Target)
+	if toArchive {
+		err = res.RestoreToArchive(ctx, opts.Archive, gopts.stdout)
+	} else {
+		err = res.RestoreTo(ctx, opts.Target)
+	}
+	var mismatches uint64
+	if err == nil && opts.Verify {
+		progressPrinter.V("verifying files in %s\n", opts.Target)
+		// collect the mismatches, they are listed at the end
+		res.Error = func(location string, err error) error {
+			atomic.AddUint64(&mismatches, 1)
+			progress.AddMismatch(location, err)
+			return nil
+		}
 		var count int
 		t0 := time.Now()
 		count, err = res.VerifyFiles(ctx, opts.Target)
-		if err != nil {
-			return err
+		if err == nil {
+			progressPrinter.V("finished verifying %d files in %s (took %s)\n", count, opts.Target,
+				time.Since(t0).Round(time.Millisecond))
 		}
-		if totalErrors > 0 {
-			return errors.Fatalf("There were %d errors\n", totalErrors)
+	}
+	cancelProgress()
+	<-progressDone
+	<-stateDone
+	if res.Resume != nil {
+		if err != nil || totalErrors > 0 {
+			// keep the files restored so far for the next attempt
+			if serr := res.Resume.Save(stateFile); serr != nil {
+				Warnf("unable to write the restore state: %v\n", serr)
+			}
+		} else {
+			atomic.StoreInt32(&stateRemoved, 1)
+			if rerr := os.Remove(stateFile); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+				Warnf("unable to remove the restore state: %v\n", rerr)
+			}
 		}
-		Verbosef("finished verifying %d files in %s (took %s)\n", count, opts.Target,
-			time.Since(t0).Round(time.Millisecond))
+	}
+	if manifest != nil {
+		cerr := manifest.Close()
+		if err == nil && cerr != nil {
+			err = errors.Fatalf("writing the verify manifest failed: %v", cerr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	progress.SetBackendStats(backendAccounting.Stats())
+	progress.Finish()
+
+	if totalErrors > 0 {
+		return errors.Fatalf("There were %d errors\n", totalErrors)
+	}
+	if mismatches > 0 {
+		return errors.Fatalf("verification failed for %d files", mismatches)
 	}
 
 	return nil
 }
+
+// loadResumeState loads the state of a restore of the snapshot with the given
+// id to target from the cache directory and returns it along with its
+// filename. If the state belongs to a different snapshot, an empty state is
+// returned.
+func loadResumeState(repo *repository.Repository, id restic.ID, target string) (*restorer.ResumeState, string, error) {
+	if repo.Cache == nil {
+		return nil, "", errors.Fatal("--resume requires the local cache")
+	}
+
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return nil, "", err
+	}
+
+	targetID := restic.Hash([]byte(absTarget))
+	name := "restore-state-" + targetID.Str() + ".json"
+	filename := filepath.Join(repo.Cache.BaseDir(), repo.Config().ID, name)
+
+	state, err := restorer.LoadResumeState(filename, id, absTarget)
+	if err != nil {
+		Warnf("unable to load the restore state, starting from scratch: %v\n", err)
+		state = restorer.NewResumeState(id, absTarget)
+	}
+	return state, filename, nil
+}
+
+// writeResumeStates periodically writes the state until ctx is cancelled.
+func writeResumeStates(ctx context.Context, state *restorer.ResumeState, filename string) {
+	ticker := time.NewTicker(resumeStateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			debug.Log("writing restore state with %d files", state.Len())
+			if err := state.Save(filename); err != nil {
+				Warnf("unable to write the restore state: %v\n", err)
+			}
+		}
+	}
+}
+
+// verifyManifest writes the hashes of the verified files to a file, in the
+// format used by sha256sum. The paths are relative to the target directory.
+type verifyManifest struct {
+	mu  sync.Mutex
+	f   *os.File
+	wr  *bufio.Writer
+	err error
+}
+
+func newVerifyManifest(filename string) (*verifyManifest, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Fatalf("unable to create the verify manifest: %v", err)
+	}
+	return &verifyManifest{f: f, wr: bufio.NewWriter(f)}, nil
+}
+
+// formatManifestEntry returns the line for the file at path. Like sha256sum,
+// backslashes and newlines in the path are escaped and the line starts with
+// a backslash in this case.
+func formatManifestEntry(hash restic.ID, path string) string {
+	prefix := ""
+	if strings.ContainsAny(path, "\\\n") {
+		prefix = "\\"
+		path = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(path)
+	}
+	return prefix + hash.String() + "  " + path + "\n"
+}
+
+// add records the hash of the file at location within the snapshot.
+func (m *verifyManifest) add(location string, hash restic.ID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return
+	}
+	path := strings.TrimPrefix(location, string(filepath.Separator))
+	_, m.err = m.wr.WriteString(formatManifestEntry(hash, path))
+}
+
+// Close flushes the manifest and returns the first error which occurred while
+// writing it.
+func (m *verifyManifest) Close() error {
+	err := m.wr.Flush()
+	if m.err == nil {
+		m.err = err
+	}
+	err = m.f.Close()
+	if m.err == nil {
+		m.err = err
+	}
+	return m.err
+}
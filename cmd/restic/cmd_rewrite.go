@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+var cmdRewrite = &cobra.Command{
+	Use:   "rewrite [flags] [snapshot-ID ...]",
+	Short: "Change the hostname or paths recorded in snapshots",
+	Long: `
+The "rewrite" command changes the metadata of existing snapshots, for example
+after a machine was renamed or the data was moved, so that "forget" and
+"backup" group the old snapshots together with the new ones.
+
+With --set-host the hostname is replaced, with --set-paths the list of paths
+which were backed up. For each selected snapshot a new snapshot with the
+changed metadata is saved. It references the same tree, so the contents of the
+snapshot are neither changed nor copied. The original snapshots are kept,
+unless --forget is given.
+
+When no snapshot-ID is given, all snapshots matching the host, tag and path
+filter criteria are rewritten.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRewrite(cmd.Context(), rewriteOptions, globalOptions, args)
+	},
+}
+
+// RewriteOptions bundles all options for the 'rewrite' command.
+type RewriteOptions struct {
+	snapshotFilterOptions
+	SetHost  string
+	SetPaths []string
+	Forget   bool
+	DryRun   bool
+}
+
+var rewriteOptions RewriteOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdRewrite)
+
+	f := cmdRewrite.Flags()
+	f.StringVar(&rewriteOptions.SetHost, "set-host", "", "replace the hostname of the snapshots with `hostname`")
+	f.StringArrayVar(&rewriteOptions.SetPaths, "set-paths", nil, "replace the paths of the snapshots with `path` (can be specified multiple times)")
+	f.BoolVar(&rewriteOptions.Forget, "forget", false, "remove the original snapshots")
+	f.BoolVarP(&rewriteOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+	initMultiSnapshotFilterOptions(f, &rewriteOptions.snapshotFilterOptions, true)
+}
+
+// rewriteMetadata applies the changes selected in opts to sn. It returns false
+// if the snapshot already has the requested metadata.
+func rewriteMetadata(sn *restic.Snapshot, opts RewriteOptions) bool {
+	changed := false
+	if opts.SetHost != "" && sn.Hostname != opts.SetHost {
+		sn.Hostname = opts.SetHost
+		changed = true
+	}
+	if len(opts.SetPaths) > 0 && !sameStrings(sn.Paths, opts.SetPaths) {
+		sn.Paths = append([]string(nil), opts.SetPaths...)
+		changed = true
+	}
+	return changed
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func runRewrite(ctx context.Context, opts RewriteOptions, gopts GlobalOptions, args []string) error {
+	if opts.SetHost == "" && len(opts.SetPaths) == 0 {
+		return errors.Fatal("nothing to do, use --set-host or --set-paths")
+	}
+	for i, p := range opts.SetPaths {
+		if p == "" {
+			return errors.Fatal("empty path for --set-paths")
+		}
+		// backup records absolute paths, see restic.NewSnapshot
+		if abs, err := filepath.Abs(p); err == nil {
+			opts.SetPaths[i] = abs
+		}
+	}
+	if opts.Forget && gopts.AppendOnly && !opts.DryRun {
+		return errors.Fatal("rewrite --forget removes snapshots and is not possible in append-only mode")
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		if opts.Forget && !opts.DryRun {
+			Verbosef("create exclusive lock for repository\n")
+			lock, ctx, err = lockRepoExclusive(ctx, repo)
+		} else {
+			lock, ctx, err = lockRepo(ctx, repo)
+		}
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	rewritten := 0
+	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+		oldID := *sn.ID()
+		if !rewriteMetadata(sn, opts) {
+			Verbosef("snapshot %v already has the requested metadata\n", oldID.Str())
+			continue
+		}
+		rewritten++
+
+		if opts.DryRun {
+			Printf("would rewrite snapshot %v\n", oldID.Str())
+			continue
+		}
+
+		var newID restic.ID
+		if opts.Forget {
+			newID, err = replaceSnapshot(ctx, repo, sn)
+		} else {
+			if sn.Original == nil {
+				sn.Original = &oldID
+			}
+			newID, err = restic.SaveSnapshot(ctx, repo, sn)
+		}
+		if err != nil {
+			return errors.Fatalf("unable to save the rewritten snapshot %v: %v", oldID.Str(), err)
+		}
+
+		if opts.Forget {
+			Printf("snapshot %v replaced by %v\n", oldID.Str(), newID.Str())
+		} else {
+			Printf("snapshot %v rewritten as %v\n", oldID.Str(), newID.Str())
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	switch {
+	case rewritten == 0:
+		Printf("no snapshots were modified\n")
+	case opts.DryRun:
+		Printf("would rewrite %d snapshots\n", rewritten)
+	default:
+		Printf("rewrote %d snapshots\n", rewritten)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	scrubui "github.com/restic/restic/internal/ui/scrub"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+var cmdScrub = &cobra.Command{
+	Use:   "scrub [flags]",
+	Short: "Read all pack files and verify their integrity",
+	Long: `
+The "scrub" command reads the pack files in the repository and verifies the
+hashes of the packs and of all blobs they contain. The progress is shown while
+the packs are read. Damaged packs are listed at the end, they can be removed
+from the index with "restic rebuild-index --read-all-packs".
+
+With --read-percentage, only a random sample of the packs is verified. With
+--resume, the verified packs are recorded in the local cache, an interrupted
+scrub then continues with the remaining packs.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if scrubOptions.ReadPercentage <= 0 || scrubOptions.ReadPercentage > 100 {
+			return errors.Fatal("--read-percentage must be above 0 and at most 100")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		var wg sync.WaitGroup
+		cancelCtx, cancel := context.WithCancel(ctx)
+		defer func() {
+			// shutdown termstatus
+			cancel()
+			wg.Wait()
+		}()
+
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			term.Run(cancelCtx)
+		}()
+
+		return runScrub(ctx, scrubOptions, globalOptions, term, args)
+	},
+}
+
+// ScrubOptions bundles all options for the 'scrub' command.
+type ScrubOptions struct {
+	ReadPercentage float64
+	Resume         bool
+}
+
+var scrubOptions ScrubOptions
+
+// scrubStateInterval is the interval in which the state is written with
+// --resume.
+const scrubStateInterval = time.Minute
+
+func init() {
+	cmdRoot.AddCommand(cmdScrub)
+
+	f := cmdScrub.Flags()
+	f.Float64Var(&scrubOptions.ReadPercentage, "read-percentage", 100, "verify a random sample of `percent` of the packs")
+	f.BoolVar(&scrubOptions.Resume, "resume", false, "record the verified packs and continue a previous, interrupted scrub")
+}
+
+func runScrub(ctx context.Context, opts ScrubOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if len(args) != 0 {
+		return errors.Fatal("the scrub command expects no arguments, only options - please see `restic help scrub` for usage and flags")
+	}
+
+	var stateDir string
+	if opts.Resume {
+		var err error
+		stateDir, err = checkStateDir(gopts, "--resume")
+		if err != nil {
+			return err
+		}
+	}
+
+	// the packs must be read from the repository, tree packs would otherwise
+	// be served from the local cache
+	gopts.NoCache = true
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	var progressPrinter scrubui.ProgressPrinter
+	if gopts.JSON {
+		progressPrinter = scrubui.NewJSONProgress(term, gopts.verbosity)
+	} else {
+		progressPrinter = scrubui.NewTextProgress(term, gopts.verbosity)
+	}
+
+	chkr := checker.New(repo, false)
+	progressPrinter.V("load indexes\n")
+	_, errs := chkr.LoadIndex(ctx)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			Warnf("error: %v\n", err)
+		}
+		return errors.Fatal("LoadIndex returned errors")
+	}
+	allPacks := chkr.GetPacks()
+
+	var state *checker.CheckState
+	var stateFile string
+	if opts.Resume {
+		stateFile = checker.CheckStateFile(stateDir, repo.Config().ID, checker.ScrubScope)
+		state, err = checker.LoadCheckState(stateFile)
+		if err != nil {
+			Warnf("unable to load scrub state, starting from scratch: %v\n", err)
+			state = nil
+		}
+		if state != nil {
+			// packs removed since the interrupted scrub, probably by prune,
+			// cannot be verified anymore
+			state.DropRemoved(allPacks)
+			progressPrinter.P("resuming scrub, %d of %d packs have been verified before\n",
+				len(state.Packs())-len(state.Remaining()), len(state.Packs()))
+		}
+	}
+
+	if state == nil {
+		packs := allPacks
+		if opts.ReadPercentage < 100 {
+			packs = selectRandomPacksByPercentage(allPacks, opts.ReadPercentage)
+			progressPrinter.V("verify %.1f%% of the packs\n", opts.ReadPercentage)
+		}
+		state = checker.NewCheckState(time.Now(), packs)
+	}
+
+	progress := scrubui.NewProgress(progressPrinter, calculateProgressInterval(!gopts.Quiet, gopts.JSON))
+	remaining := state.Remaining()
+	corrupt := state.Corrupt()
+	for id, size := range state.Packs() {
+		progress.AddPack(uint64(size))
+		if _, ok := remaining[id]; !ok {
+			progress.ResumePack(id, uint64(size), corrupt[id])
+		}
+	}
+
+	progressCtx, cancelProgress := context.WithCancel(ctx)
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		progress.Run(progressCtx)
+	}()
+
+	stateDone := make(chan struct{})
+	go func() {
+		defer close(stateDone)
+		if opts.Resume {
+			writeScrubStates(progressCtx, state, stateFile)
+		}
+	}()
+
+	err = chkr.VerifyPacks(ctx, remaining, func(id restic.ID, size int64, err error) {
+		state.Checked(id, err)
+		_ = progress.CompletePack(id, uint64(size), err)
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	cancelProgress()
+	<-progressDone
+	<-stateDone
+
+	if opts.Resume {
+		if err != nil {
+			if serr := state.Save(stateFile); serr != nil {
+				Warnf("unable to write scrub state: %v\n", serr)
+			}
+		} else if rerr := os.Remove(stateFile); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			Warnf("unable to remove scrub state: %v\n", rerr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	progress.Finish()
+
+	if n := len(state.Corrupt()); n > 0 {
+		return errors.Fatalf("%d packs are damaged", n)
+	}
+	return nil
+}
+
+// writeScrubStates periodically writes the scrub state until ctx is cancelled.
+func writeScrubStates(ctx context.Context, state *checker.CheckState, filename string) {
+	ticker := time.NewTicker(scrubStateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			debug.Log("writing scrub state, %d packs remaining", len(state.Remaining()))
+			if err := state.Save(filename); err != nil {
+				Warnf("unable to write scrub state: %v\n", err)
+			}
+		}
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/table"
 	"github.com/spf13/cobra"
 )
@@ -33,10 +36,13 @@ Exit status is 0 if the command was successful, and non-zero if there was any er
 // SnapshotOptions bundles all options for the snapshots command.
 type SnapshotOptions struct {
 	snapshotFilterOptions
-	Compact bool
-	Last    bool // This option should be removed in favour of Latest.
-	Latest  int
-	GroupBy string
+	PathPrefixes []string
+	Meta         []string
+	Compact      bool
+	Last         bool // This option should be removed in favour of Latest.
+	Latest       int
+	GroupBy      string
+	Size         bool
 }
 
 var snapshotOptions SnapshotOptions
@@ -46,6 +52,8 @@ func init() {
 
 	f := cmdSnapshots.Flags()
 	initMultiSnapshotFilterOptions(f, &snapshotOptions.snapshotFilterOptions, true)
+	f.StringArrayVar(&snapshotOptions.PathPrefixes, "path-prefix", nil, "only consider snapshots which contain `path`, that is one of their paths is equal to or a parent directory of it (can be specified multiple times)")
+	f.StringArrayVar(&snapshotOptions.Meta, "meta", nil, "only consider snapshots with the metadata `key[=value]` (can be specified multiple times)")
 	f.BoolVarP(&snapshotOptions.Compact, "compact", "c", false, "use compact output format")
 	f.BoolVar(&snapshotOptions.Last, "last", false, "only show the last snapshot for each host and path")
 	err := f.MarkDeprecated("last", "use --latest 1")
@@ -54,7 +62,8 @@ func init() {
 		panic(err)
 	}
 	f.IntVar(&snapshotOptions.Latest, "latest", 0, "only show the last `n` snapshots for each host and path")
-	f.StringVarP(&snapshotOptions.GroupBy, "group-by", "g", "", "`group` snapshots by host, paths and/or tags, separated by comma")
+	f.StringVarP(&snapshotOptions.GroupBy, "group-by", "g", "", "`group` snapshots by host, paths, tags and/or tag:prefix, separated by comma")
+	f.BoolVar(&snapshotOptions.Size, "size", false, "show the total and unique size of each snapshot")
 }
 
 func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions, args []string) error {
@@ -72,8 +81,16 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 		}
 	}
 
+	prefixes, err := normalizePathPrefixes(opts.PathPrefixes)
+	if err != nil {
+		return err
+	}
+
 	var snapshots restic.Snapshots
 	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+		if !sn.HasPathPrefix(prefixes) || !sn.HasMetadata(opts.Meta) {
+			continue
+		}
 		snapshots = append(snapshots, sn)
 	}
 	snapshotGroups, grouped, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
@@ -93,8 +110,25 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 		snapshotGroups[k] = list
 	}
 
+	var sizes map[string]snapshotSize
+	if opts.Size {
+		var list restic.Snapshots
+		for _, l := range snapshotGroups {
+			list = append(list, l...)
+		}
+
+		var cacheDir string
+		if repo.Cache != nil {
+			cacheDir = repo.Cache.BaseDir()
+		}
+		sizes, err = snapshotSizes(ctx, repo, gopts, list, cacheDir)
+		if err != nil {
+			return err
+		}
+	}
+
 	if gopts.JSON {
-		err := printSnapshotGroupJSON(gopts.stdout, snapshotGroups, grouped)
+		err := printSnapshotGroupJSON(gopts.stdout, snapshotGroups, sizes, grouped)
 		if err != nil {
 			Warnf("error printing snapshots: %v\n", err)
 		}
@@ -109,12 +143,33 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 				return nil
 			}
 		}
-		PrintSnapshots(gopts.stdout, list, nil, opts.Compact)
+		PrintSnapshots(gopts.stdout, list, nil, sizes, opts.Compact)
 	}
 
 	return nil
 }
 
+// normalizePathPrefixes returns the cleaned prefixes. Relative prefixes are
+// returned both as given and as absolute path, so that they match snapshots
+// which store either form.
+func normalizePathPrefixes(prefixes []string) ([]string, error) {
+	var result []string
+	for _, prefix := range prefixes {
+		prefix = filepath.Clean(prefix)
+		result = append(result, prefix)
+		if filepath.IsAbs(prefix) {
+			continue
+		}
+
+		abs, err := filepath.Abs(prefix)
+		if err != nil {
+			return nil, errors.Fatalf("invalid path prefix %q: %v", prefix, err)
+		}
+		result = append(result, abs)
+	}
+	return result, nil
+}
+
 // filterLastSnapshotsKey is used by FilterLastSnapshots.
 type filterLastSnapshotsKey struct {
 	Hostname    string
@@ -152,8 +207,9 @@ func FilterLastestSnapshots(list restic.Snapshots, limit int) restic.Snapshots {
 	return results
 }
 
-// PrintSnapshots prints a text table of the snapshots in list to stdout.
-func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.KeepReason, compact bool) {
+// PrintSnapshots prints a text table of the snapshots in list to stdout. If
+// sizes is not nil, the sizes of the snapshots are printed as well.
+func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.KeepReason, sizes map[string]snapshotSize, compact bool) {
 	// keep the reasons a snasphot is being kept in a map, so that it doesn't
 	// get lost when the list of snapshots is sorted
 	keepReasons := make(map[restic.ID]restic.KeepReason, len(reasons))
@@ -189,6 +245,9 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 		tab.AddColumn("Time", "{{ .Timestamp }}")
 		tab.AddColumn("Host", "{{ .Hostname }}")
 		tab.AddColumn("Tags  ", `{{ join .Tags "\n" }}`)
+		if sizes != nil {
+			tab.AddColumn("Size", "{{ .Total }}")
+		}
 	} else {
 		tab.AddColumn("ID", "{{ .ID }}")
 		tab.AddColumn("Time", "{{ .Timestamp }}")
@@ -198,6 +257,10 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 			tab.AddColumn("Reasons", `{{ join .Reasons "\n" }}`)
 		}
 		tab.AddColumn("Paths", `{{ join .Paths "\n" }}`)
+		if sizes != nil {
+			tab.AddColumn("Total", "{{ .Total }}")
+			tab.AddColumn("Unique", "{{ .Unique }}")
+		}
 	}
 
 	type snapshot struct {
@@ -207,6 +270,8 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 		Tags      []string
 		Reasons   []string
 		Paths     []string
+		Total     string
+		Unique    string
 	}
 
 	var multiline bool
@@ -224,6 +289,12 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 			data.Reasons = keepReasons[*id].Matches
 		}
 
+		if sizes != nil && sn.Tree != nil {
+			size := sizes[sn.Tree.String()]
+			data.Total = ui.FormatBytes(size.Total)
+			data.Unique = ui.FormatBytes(size.Unique)
+		}
+
 		if len(sn.Paths) > 1 && !compact {
 			multiline = true
 		}
@@ -259,19 +330,31 @@ func PrintSnapshots(stdout io.Writer, list restic.Snapshots, reasons []restic.Ke
 // following snapshots belong to.
 // Prints nothing, if we did not group at all.
 func PrintSnapshotGroupHeader(stdout io.Writer, groupKeyJSON string) error {
-	var key restic.SnapshotGroupKey
-
-	err := json.Unmarshal([]byte(groupKeyJSON), &key)
+	desc, err := snapshotGroupDescription(groupKeyJSON)
 	if err != nil {
 		return err
 	}
-
-	if key.Hostname == "" && key.Tags == nil && key.Paths == nil {
+	if desc == "" {
 		return nil
 	}
 
 	// Info
-	fmt.Fprintf(stdout, "snapshots")
+	fmt.Fprintf(stdout, "snapshots for (%s):\n", desc)
+
+	return nil
+}
+
+// snapshotGroupDescription returns a description of the group of the
+// group-by option, for example "host [foo], paths [/home]". It is empty if
+// the snapshots were not grouped.
+func snapshotGroupDescription(groupKeyJSON string) (string, error) {
+	var key restic.SnapshotGroupKey
+
+	err := json.Unmarshal([]byte(groupKeyJSON), &key)
+	if err != nil {
+		return "", err
+	}
+
 	var infoStrings []string
 	if key.Hostname != "" {
 		infoStrings = append(infoStrings, "host ["+key.Hostname+"]")
@@ -282,20 +365,16 @@ func PrintSnapshotGroupHeader(stdout io.Writer, groupKeyJSON string) error {
 	if key.Paths != nil {
 		infoStrings = append(infoStrings, "paths ["+strings.Join(key.Paths, ", ")+"]")
 	}
-	if infoStrings != nil {
-		fmt.Fprintf(stdout, " for (%s)", strings.Join(infoStrings, ", "))
-	}
-	fmt.Fprintf(stdout, ":\n")
-
-	return nil
+	return strings.Join(infoStrings, ", "), nil
 }
 
 // Snapshot helps to print Snaphots as JSON with their ID included.
 type Snapshot struct {
 	*restic.Snapshot
 
-	ID      *restic.ID `json:"id"`
-	ShortID string     `json:"short_id"`
+	ID      *restic.ID    `json:"id"`
+	ShortID string        `json:"short_id"`
+	Size    *snapshotSize `json:"size,omitempty"`
 }
 
 // SnapshotGroup helps to print SnaphotGroups as JSON with their GroupReasons included.
@@ -304,8 +383,24 @@ type SnapshotGroup struct {
 	Snapshots []Snapshot              `json:"snapshots"`
 }
 
+// newSnapshotJSON returns the JSON representation of sn, including the size if
+// it is contained in sizes.
+func newSnapshotJSON(sn *restic.Snapshot, sizes map[string]snapshotSize) Snapshot {
+	k := Snapshot{
+		Snapshot: sn,
+		ID:       sn.ID(),
+		ShortID:  sn.ID().Str(),
+	}
+	if sn.Tree != nil {
+		if size, ok := sizes[sn.Tree.String()]; ok {
+			k.Size = &size
+		}
+	}
+	return k
+}
+
 // printSnapshotsJSON writes the JSON representation of list to stdout.
-func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]restic.Snapshots, grouped bool) error {
+func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]restic.Snapshots, sizes map[string]snapshotSize, grouped bool) error {
 	if grouped {
 		snapshotGroups := []SnapshotGroup{}
 
@@ -320,12 +415,7 @@ func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]restic.Snapsho
 			}
 
 			for _, sn := range list {
-				k := Snapshot{
-					Snapshot: sn,
-					ID:       sn.ID(),
-					ShortID:  sn.ID().Str(),
-				}
-				snapshots = append(snapshots, k)
+				snapshots = append(snapshots, newSnapshotJSON(sn, sizes))
 			}
 
 			group := SnapshotGroup{
@@ -343,12 +433,7 @@ func printSnapshotGroupJSON(stdout io.Writer, snGroups map[string]restic.Snapsho
 
 	for _, list := range snGroups {
 		for _, sn := range list {
-			k := Snapshot{
-				Snapshot: sn,
-				ID:       sn.ID(),
-				ShortID:  sn.ID().Str(),
-			}
-			snapshots = append(snapshots, k)
+			snapshots = append(snapshots, newSnapshotJSON(sn, sizes))
 		}
 	}
 
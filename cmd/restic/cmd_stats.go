@@ -4,12 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/bits"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
 	"github.com/restic/restic/internal/walker"
 
 	"github.com/minio/sha256-simd"
@@ -38,7 +43,13 @@ The modes are:
    considered unique if it has unique contents.
 * raw-data: Counts the size of blobs in the repository, regardless of
   how many files reference them.
-* blobs-per-file: A combination of files-by-contents and raw-data.
+* blobs-per-file: A combination of files-by-contents and raw-data. It also
+  shows a histogram of the number of blobs per file and the average blob size.
+* growth: Lists the snapshots in chronological order along with the size of
+  the blobs each snapshot added to the repository.
+* fragmentation: Reports for each pack the ratio of blobs which are still
+  referenced by any snapshot, and the share of unused data in the repository.
+  This mode always considers all snapshots.
 
 Refer to the online manual for more details about each mode.
 
@@ -66,7 +77,7 @@ var statsOptions StatsOptions
 func init() {
 	cmdRoot.AddCommand(cmdStats)
 	f := cmdStats.Flags()
-	f.StringVar(&statsOptions.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file or raw-data")
+	f.StringVar(&statsOptions.countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file, raw-data, growth or fragmentation")
 	initMultiSnapshotFilterOptions(f, &statsOptions.snapshotFilterOptions, true)
 }
 
@@ -107,14 +118,45 @@ func runStats(ctx context.Context, gopts GlobalOptions, args []string) error {
 	stats := &statsContainer{
 		uniqueFiles:    make(map[fileID]struct{}),
 		fileBlobs:      make(map[string]restic.IDSet),
+		blobCounts:     make(map[int]uint64),
 		blobs:          restic.NewBlobSet(),
 		SnapshotsCount: 0,
 	}
 
-	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, statsOptions.Hosts, statsOptions.Tags, statsOptions.Paths, args) {
-		err = statsWalkSnapshot(ctx, sn, repo, stats)
-		if err != nil {
-			return fmt.Errorf("error walking snapshot: %v", err)
+	if statsOptions.countMode == countModeFragmentation {
+		for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, nil, nil, nil, nil) {
+			if sn.Tree == nil {
+				return fmt.Errorf("snapshot %s has nil tree", sn.ID().Str())
+			}
+			stats.SnapshotsCount++
+			err = restic.FindUsedBlobs(ctx, repo, restic.IDs{*sn.Tree}, stats.blobs, nil)
+			if err != nil {
+				return fmt.Errorf("error walking snapshot: %v", err)
+			}
+		}
+		statsFragmentation(ctx, repo, stats)
+	} else if statsOptions.countMode == countModeGrowth {
+		var snapshots restic.Snapshots
+		for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, statsOptions.Hosts, statsOptions.Tags, statsOptions.Paths, args) {
+			snapshots = append(snapshots, sn)
+		}
+		// the growth is attributed to the first snapshot referencing a blob
+		sort.SliceStable(snapshots, func(i, j int) bool {
+			return snapshots[i].Time.Before(snapshots[j].Time)
+		})
+
+		for _, sn := range snapshots {
+			err = statsGrowthSnapshot(ctx, sn, repo, stats)
+			if err != nil {
+				return fmt.Errorf("error walking snapshot: %v", err)
+			}
+		}
+	} else {
+		for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, statsOptions.Hosts, statsOptions.Tags, statsOptions.Paths, args) {
+			err = statsWalkSnapshot(ctx, sn, repo, stats)
+			if err != nil {
+				return fmt.Errorf("error walking snapshot: %v", err)
+			}
 		}
 	}
 
@@ -148,6 +190,10 @@ func runStats(ctx context.Context, gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	if statsOptions.countMode == countModeBlobsPerFile {
+		stats.BlobsPerFile = newStatsBlobsPerFile(stats)
+	}
+
 	if gopts.JSON {
 		err = json.NewEncoder(globalOptions.stdout).Encode(stats)
 		if err != nil {
@@ -156,6 +202,16 @@ func runStats(ctx context.Context, gopts GlobalOptions, args []string) error {
 		return nil
 	}
 
+	if statsOptions.countMode == countModeGrowth {
+		printStatsGrowth(stats)
+	}
+	if statsOptions.countMode == countModeFragmentation {
+		printStatsFragmentation(stats)
+	}
+	if statsOptions.countMode == countModeBlobsPerFile {
+		printStatsBlobsPerFile(stats.BlobsPerFile)
+	}
+
 	Printf("Stats in %s mode:\n", statsOptions.countMode)
 	Printf("     Snapshots processed:  %d\n", stats.SnapshotsCount)
 	if stats.TotalBlobCount > 0 {
@@ -203,6 +259,244 @@ func statsWalkSnapshot(ctx context.Context, snapshot *restic.Snapshot, repo rest
 	return nil
 }
 
+// growthBlobSet records the blobs which were not contained in the set before.
+type growthBlobSet struct {
+	restic.BlobSet
+	added []restic.BlobHandle
+}
+
+func (s *growthBlobSet) Insert(h restic.BlobHandle) {
+	if !s.BlobSet.Has(h) {
+		s.added = append(s.added, h)
+	}
+	s.BlobSet.Insert(h)
+}
+
+// statsGrowthSnapshot adds the blobs referenced by snapshot which have not
+// been referenced by any of the previously processed snapshots.
+func statsGrowthSnapshot(ctx context.Context, snapshot *restic.Snapshot, repo restic.Repository, stats *statsContainer) error {
+	if snapshot.Tree == nil {
+		return fmt.Errorf("snapshot %s has nil tree", snapshot.ID().Str())
+	}
+
+	stats.SnapshotsCount++
+
+	// already seen trees are not walked again, thus only new blobs are found
+	blobs := &growthBlobSet{BlobSet: stats.blobs}
+	err := restic.FindUsedBlobs(ctx, repo, restic.IDs{*snapshot.Tree}, blobs, nil)
+	if err != nil {
+		return err
+	}
+
+	growth := statsGrowth{
+		SnapshotID: snapshot.ID().String(),
+		Time:       snapshot.Time,
+		Paths:      snapshot.Paths,
+	}
+	for _, h := range blobs.added {
+		pbs := repo.Index().Lookup(h)
+		if len(pbs) == 0 {
+			return fmt.Errorf("blob %v not found", h)
+		}
+		growth.AddedSize += uint64(pbs[0].Length)
+		growth.AddedBlobs++
+	}
+
+	stats.TotalSize += growth.AddedSize
+	stats.TotalBlobCount += growth.AddedBlobs
+	growth.TotalSize = stats.TotalSize
+	stats.Growth = append(stats.Growth, growth)
+	return nil
+}
+
+// printStatsGrowth prints a table with the growth per snapshot.
+func printStatsGrowth(stats *statsContainer) {
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ID }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Added Blobs", "{{ .AddedBlobs }}")
+	tab.AddColumn("Added Size", "{{ .AddedSize }}")
+	tab.AddColumn("Total Size", "{{ .TotalSize }}")
+	tab.AddColumn("Paths", "{{ .Paths }}")
+
+	type data struct {
+		ID         string
+		Time       string
+		AddedBlobs string
+		AddedSize  string
+		TotalSize  string
+		Paths      string
+	}
+
+	var largest *statsGrowth
+	for i, g := range stats.Growth {
+		if largest == nil || g.AddedSize > largest.AddedSize {
+			largest = &stats.Growth[i]
+		}
+		tab.AddRow(data{
+			ID:         g.SnapshotID[:8],
+			Time:       g.Time.Format(TimeFormat),
+			AddedBlobs: fmt.Sprintf("%11d", g.AddedBlobs),
+			AddedSize:  fmt.Sprintf("%10s", ui.FormatBytes(g.AddedSize)),
+			TotalSize:  fmt.Sprintf("%10s", ui.FormatBytes(g.TotalSize)),
+			Paths:      strings.Join(g.Paths, ", "),
+		})
+	}
+
+	_ = tab.Write(globalOptions.stdout)
+	if largest != nil {
+		Printf("snapshot %s from %s added the most data: %s\n",
+			largest.SnapshotID[:8], largest.Time.Format(TimeFormat), ui.FormatBytes(largest.AddedSize))
+	}
+	Printf("\n")
+}
+
+// statsFragmentation computes the number and size of the live blobs of each
+// pack in the index. A blob is live if it is contained in stats.blobs, if it is
+// stored in several packs, only its first occurrence is live.
+func statsFragmentation(ctx context.Context, repo restic.Repository, stats *statsContainer) {
+	packs := make(map[restic.ID]*statsPack)
+	live := restic.NewBlobSet()
+	repo.Index().Each(ctx, func(pb restic.PackedBlob) {
+		p, ok := packs[pb.PackID]
+		if !ok {
+			p = &statsPack{PackID: pb.PackID.String(), Type: pb.Type.String()}
+			packs[pb.PackID] = p
+		}
+		p.TotalBlobs++
+		p.TotalSize += uint64(pb.Length)
+		if stats.blobs.Has(pb.BlobHandle) && !live.Has(pb.BlobHandle) {
+			live.Insert(pb.BlobHandle)
+			p.LiveBlobs++
+			p.LiveSize += uint64(pb.Length)
+		}
+	})
+
+	f := &statsFragmentationInfo{Packs: make([]statsPack, 0, len(packs))}
+	for _, p := range packs {
+		p.LiveRatio = float64(p.LiveSize) / float64(p.TotalSize)
+		f.TotalPacks++
+		if p.LiveBlobs < p.TotalBlobs {
+			f.FragmentedPacks++
+		}
+		f.TotalBlobs += p.TotalBlobs
+		f.LiveBlobs += p.LiveBlobs
+		f.TotalSize += p.TotalSize
+		f.LiveSize += p.LiveSize
+		f.Packs = append(f.Packs, *p)
+	}
+	if f.TotalSize > 0 {
+		f.Fragmentation = 100 * float64(f.TotalSize-f.LiveSize) / float64(f.TotalSize)
+	}
+
+	// the most fragmented packs first
+	sort.Slice(f.Packs, func(i, j int) bool {
+		if f.Packs[i].LiveRatio != f.Packs[j].LiveRatio {
+			return f.Packs[i].LiveRatio < f.Packs[j].LiveRatio
+		}
+		return f.Packs[i].PackID < f.Packs[j].PackID
+	})
+
+	stats.TotalBlobCount = f.TotalBlobs
+	stats.TotalSize = f.TotalSize
+	stats.Fragmentation = f
+}
+
+// printStatsFragmentation prints a table with the packs which contain unused
+// blobs and a summary for the whole repository.
+func printStatsFragmentation(stats *statsContainer) {
+	f := stats.Fragmentation
+
+	tab := table.New()
+	tab.AddColumn("Pack", "{{ .ID }}")
+	tab.AddColumn("Type", "{{ .Type }}")
+	tab.AddColumn("Live Blobs", "{{ .Blobs }}")
+	tab.AddColumn("Live Size", "{{ .Size }}")
+	tab.AddColumn("Live", "{{ .Ratio }}")
+
+	type data struct {
+		ID    string
+		Type  string
+		Blobs string
+		Size  string
+		Ratio string
+	}
+
+	for _, p := range f.Packs {
+		if p.LiveBlobs == p.TotalBlobs {
+			continue
+		}
+		tab.AddRow(data{
+			ID:    p.PackID[:8],
+			Type:  p.Type,
+			Blobs: fmt.Sprintf("%6d / %6d", p.LiveBlobs, p.TotalBlobs),
+			Size:  fmt.Sprintf("%10s / %10s", ui.FormatBytes(p.LiveSize), ui.FormatBytes(p.TotalSize)),
+			Ratio: fmt.Sprintf("%7.2f%%", 100*p.LiveRatio),
+		})
+	}
+
+	if f.FragmentedPacks > 0 {
+		_ = tab.Write(globalOptions.stdout)
+	}
+	Printf("%d of %d packs contain unused blobs\n", f.FragmentedPacks, f.TotalPacks)
+	Printf("unused: %d of %d blobs, %s of %s (%.2f%% fragmentation)\n",
+		f.TotalBlobs-f.LiveBlobs, f.TotalBlobs,
+		ui.FormatBytes(f.TotalSize-f.LiveSize), ui.FormatBytes(f.TotalSize), f.Fragmentation)
+	Printf("\n")
+}
+
+// newStatsBlobsPerFile sorts the files into buckets by their number of blobs.
+// The buckets are powers of two, from a single blob up to the largest number
+// of blobs of a file.
+func newStatsBlobsPerFile(stats *statsContainer) *statsBlobsPerFile {
+	b := &statsBlobsPerFile{Buckets: []statsBlobCountBucket{}}
+
+	var files, blobs uint64
+	for count, n := range stats.blobCounts {
+		i := bits.Len(uint(count)) - 1
+		for len(b.Buckets) <= i {
+			min := uint64(1) << uint(len(b.Buckets))
+			b.Buckets = append(b.Buckets, statsBlobCountBucket{MinBlobs: min, MaxBlobs: 2*min - 1})
+		}
+		b.Buckets[i].Files += n
+		files += n
+		blobs += n * uint64(count)
+	}
+
+	if files > 0 {
+		b.AverageBlobsPerFile = float64(blobs) / float64(files)
+	}
+	if stats.TotalBlobCount > 0 {
+		b.AverageBlobSize = float64(stats.TotalSize) / float64(stats.TotalBlobCount)
+	}
+	return b
+}
+
+// printStatsBlobsPerFile prints the histogram of the number of blobs per file.
+func printStatsBlobsPerFile(b *statsBlobsPerFile) {
+	const barWidth = 40
+
+	var max uint64
+	for _, bucket := range b.Buckets {
+		if bucket.Files > max {
+			max = bucket.Files
+		}
+	}
+
+	Printf("Blobs per file:\n")
+	for _, bucket := range b.Buckets {
+		blobs := fmt.Sprintf("%d", bucket.MinBlobs)
+		if bucket.MaxBlobs > bucket.MinBlobs {
+			blobs = fmt.Sprintf("%d-%d", bucket.MinBlobs, bucket.MaxBlobs)
+		}
+		bar := strings.Repeat("#", int((bucket.Files*barWidth+max-1)/max))
+		Printf("%15s:  %10d files  %s\n", blobs, bucket.Files, bar)
+	}
+	Printf("Average blobs per file:  %.2f\n", b.AverageBlobsPerFile)
+	Printf("     Average blob size:  %s\n", ui.FormatBytes(uint64(b.AverageBlobSize)))
+	Printf("\n")
+}
+
 func statsWalkTree(repo restic.Repository, stats *statsContainer, uniqueInodes map[uint64]struct{}) walker.WalkFunc {
 	return func(parentTreeID restic.ID, npath string, node *restic.Node, nodeErr error) (bool, error) {
 		if nodeErr != nil {
@@ -225,6 +519,10 @@ func statsWalkTree(repo restic.Repository, stats *statsContainer, uniqueInodes m
 					stats.TotalFileCount++
 				}
 				if statsOptions.countMode == countModeBlobsPerFile {
+					if len(node.Content) > 0 {
+						stats.blobCounts[len(node.Content)]++
+					}
+
 					// count the size of each unique blob reference, which is
 					// by unique file (unique by contents and file path)
 					for _, blobID := range node.Content {
@@ -291,6 +589,12 @@ func verifyStatsInput(gopts GlobalOptions, args []string) error {
 	case countModeUniqueFilesByContents:
 	case countModeBlobsPerFile:
 	case countModeRawData:
+	case countModeGrowth:
+	case countModeFragmentation:
+		// unused blobs are only known when all snapshots are considered
+		if len(args) > 0 || len(statsOptions.Hosts) > 0 || len(statsOptions.Tags) > 0 || len(statsOptions.Paths) > 0 {
+			return fmt.Errorf("the fragmentation mode always considers all snapshots, it cannot be used with snapshot IDs or filters")
+		}
 	default:
 		return fmt.Errorf("unknown counting mode: %s (use the -h flag to get a list of supported modes)", statsOptions.countMode)
 	}
@@ -313,6 +617,12 @@ type statsContainer struct {
 	TotalBlobCount                       uint64  `json:"total_blob_count,omitempty"`
 	// holds count of all considered snapshots
 	SnapshotsCount int `json:"snapshots_count"`
+	// holds the growth per snapshot in growth mode
+	Growth []statsGrowth `json:"growth,omitempty"`
+	// holds the live blobs per pack in fragmentation mode
+	Fragmentation *statsFragmentationInfo `json:"fragmentation,omitempty"`
+	// holds the distribution of blobs per file in blobs-per-file mode
+	BlobsPerFile *statsBlobsPerFile `json:"blobs_per_file,omitempty"`
 
 	// uniqueFiles marks visited files according to their
 	// contents (hashed sequence of content blob IDs)
@@ -325,6 +635,60 @@ type statsContainer struct {
 	// blobs is used to count individual unique blobs,
 	// independent of references to files
 	blobs restic.BlobSet
+
+	// blobCounts maps the number of blobs of a file to the number of unique
+	// files with that many blobs
+	blobCounts map[int]uint64
+}
+
+// statsGrowth holds the size of the blobs a snapshot added to the repository.
+type statsGrowth struct {
+	SnapshotID string    `json:"snapshot_id"`
+	Time       time.Time `json:"time"`
+	Paths      []string  `json:"paths"`
+	AddedBlobs uint64    `json:"added_blobs"`
+	AddedSize  uint64    `json:"added_size"`
+	TotalSize  uint64    `json:"total_size"`
+}
+
+// statsFragmentationInfo holds the number and size of the live blobs in the
+// repository and in each pack.
+type statsFragmentationInfo struct {
+	TotalPacks      uint64 `json:"total_packs"`
+	FragmentedPacks uint64 `json:"fragmented_packs"`
+	TotalBlobs      uint64 `json:"total_blobs"`
+	LiveBlobs       uint64 `json:"live_blobs"`
+	TotalSize       uint64 `json:"total_size"`
+	LiveSize        uint64 `json:"live_size"`
+	// Fragmentation is the percentage of the size of the unused blobs
+	Fragmentation float64     `json:"fragmentation"`
+	Packs         []statsPack `json:"packs"`
+}
+
+// statsBlobsPerFile holds the distribution of the number of blobs per file.
+type statsBlobsPerFile struct {
+	Buckets             []statsBlobCountBucket `json:"buckets"`
+	AverageBlobsPerFile float64                `json:"average_blobs_per_file"`
+	AverageBlobSize     float64                `json:"average_blob_size"`
+}
+
+// statsBlobCountBucket holds the number of files with at least MinBlobs and at
+// most MaxBlobs blobs.
+type statsBlobCountBucket struct {
+	MinBlobs uint64 `json:"min_blobs"`
+	MaxBlobs uint64 `json:"max_blobs"`
+	Files    uint64 `json:"files"`
+}
+
+// statsPack holds the number and size of the live blobs in a pack.
+type statsPack struct {
+	PackID     string  `json:"pack_id"`
+	Type       string  `json:"type"`
+	TotalBlobs uint64  `json:"total_blobs"`
+	LiveBlobs  uint64  `json:"live_blobs"`
+	TotalSize  uint64  `json:"total_size"`
+	LiveSize   uint64  `json:"live_size"`
+	LiveRatio  float64 `json:"live_ratio"`
 }
 
 // fileID is a 256-bit hash that distinguishes unique files.
@@ -335,4 +699,6 @@ const (
 	countModeUniqueFilesByContents = "files-by-contents"
 	countModeBlobsPerFile          = "blobs-per-file"
 	countModeRawData               = "raw-data"
+	countModeGrowth                = "growth"
+	countModeFragmentation         = "fragmentation"
 )
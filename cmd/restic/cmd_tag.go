@@ -5,7 +5,6 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -20,6 +19,10 @@ The "tag" command allows you to modify tags on exiting snapshots.
 You can either set/replace the entire set of tags on a snapshot, or
 add tags to/remove tags from the existing set.
 
+With --protect, snapshots are marked as protected. Protected snapshots are
+never removed by "forget", regardless of the policy. Use --unprotect to remove
+the mark again.
+
 When no snapshot-ID is given, all snapshots matching the host, tag and path filter criteria are modified.
 
 EXIT STATUS
@@ -39,6 +42,8 @@ type TagOptions struct {
 	SetTags    restic.TagLists
 	AddTags    restic.TagLists
 	RemoveTags restic.TagLists
+	Protect    bool
+	Unprotect  bool
 }
 
 var tagOptions TagOptions
@@ -50,10 +55,12 @@ func init() {
 	tagFlags.Var(&tagOptions.SetTags, "set", "`tags` which will replace the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	tagFlags.Var(&tagOptions.AddTags, "add", "`tags` which will be added to the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	tagFlags.Var(&tagOptions.RemoveTags, "remove", "`tags` which will be removed from the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
+	tagFlags.BoolVar(&tagOptions.Protect, "protect", false, "protect the snapshots from being removed by forget")
+	tagFlags.BoolVar(&tagOptions.Unprotect, "unprotect", false, "remove the protection from the snapshots")
 	initMultiSnapshotFilterOptions(tagFlags, &tagOptions.snapshotFilterOptions, true)
 }
 
-func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string) (bool, error) {
+func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string, protect, unprotect bool) (bool, error) {
 	var changed bool
 
 	if len(setTags) != 0 {
@@ -70,38 +77,33 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 		}
 	}
 
-	if changed {
-		// Retain the original snapshot id over all tag changes.
-		if sn.Original == nil {
-			sn.Original = sn.ID()
-		}
+	if (protect && !sn.Protected) || (unprotect && sn.Protected) {
+		sn.Protected = protect
+		changed = true
+	}
 
-		// Save the new snapshot.
-		id, err := restic.SaveSnapshot(ctx, repo, sn)
+	if changed {
+		_, err := replaceSnapshot(ctx, repo, sn)
 		if err != nil {
 			return false, err
 		}
-
-		debug.Log("new snapshot saved as %v", id)
-
-		// Remove the old snapshot.
-		h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
-		if err = repo.Backend().Remove(ctx, h); err != nil {
-			return false, err
-		}
-
-		debug.Log("old snapshot %v removed", sn.ID())
 	}
 	return changed, nil
 }
 
 func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []string) error {
-	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 {
+	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 && !opts.Protect && !opts.Unprotect {
 		return errors.Fatal("nothing to do!")
 	}
+	if opts.Protect && opts.Unprotect {
+		return errors.Fatal("--protect and --unprotect cannot be given at the same time")
+	}
 	if len(opts.SetTags) != 0 && (len(opts.AddTags) != 0 || len(opts.RemoveTags) != 0) {
 		return errors.Fatal("--set and --add/--remove cannot be given at the same time")
 	}
+	if gopts.AppendOnly {
+		return errors.Fatal("tag replaces snapshots and is not possible in append-only mode")
+	}
 
 	repo, err := OpenRepository(ctx, gopts)
 	if err != nil {
@@ -109,9 +111,14 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []st
 	}
 
 	if !gopts.NoLock {
-		Verbosef("create exclusive lock for repository\n")
+		scope := snapshotLockScope(opts.Hosts, args)
+		if scope != "" {
+			Verbosef("create exclusive lock for %v\n", scope)
+		} else {
+			Verbosef("create exclusive lock for repository\n")
+		}
 		var lock *restic.Lock
-		lock, ctx, err = lockRepoExclusive(ctx, repo)
+		lock, ctx, err = lockRepoExclusiveScoped(ctx, repo, scope)
 		defer unlockRepo(lock)
 		if err != nil {
 			return err
@@ -120,7 +127,7 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, args []st
 
 	changeCnt := 0
 	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, args) {
-		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten())
+		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten(), opts.Protect, opts.Unprotect)
 		if err != nil {
 			Warnf("unable to modify the tags for snapshot ID %q, ignoring: %v\n", sn.ID(), err)
 			continue
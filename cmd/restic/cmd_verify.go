@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/restorer"
+	"github.com/spf13/cobra"
+)
+
+var cmdVerify = &cobra.Command{
+	Use:   "verify [flags] snapshotID dir",
+	Short: "Verify that a local directory matches a snapshot",
+	Long: `
+The "verify" command compares the contents of a local directory with a
+snapshot, for example after the snapshot has been restored to it. The directory
+corresponds to the target directory of "restore", so the files of a snapshot
+of "/home/user" are expected below "dir/home/user".
+
+Each difference is listed with a prefix like "diff" does:
+
+  +  the item only exists in the directory
+  -  the item is missing in the directory
+  M  the contents of the file or the target of the symlink differ
+  U  the metadata (mode, ownership, modification time) differs
+  T  the type of the item differs
+
+The contents of files are compared by hashing the local files and comparing
+them with the hashes of the data in the snapshot, so all files are read. With
+--metadata-only, only the structure and the metadata including the size of
+files are compared, which is much faster.
+
+The special snapshot "latest" can be used to use the latest snapshot in the
+repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the directory matches the snapshot, and non-zero if there
+was any difference or error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVerify(cmd.Context(), verifyOptions, globalOptions, args)
+	},
+}
+
+// VerifyOptions bundles all options for the 'verify' command.
+type VerifyOptions struct {
+	snapshotFilterOptions
+	MetadataOnly bool
+}
+
+var verifyOptions VerifyOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdVerify)
+
+	f := cmdVerify.Flags()
+	initSingleSnapshotFilterOptions(f, &verifyOptions.snapshotFilterOptions)
+	f.BoolVar(&verifyOptions.MetadataOnly, "metadata-only", false, "only compare the structure and metadata, don't read the contents of files")
+}
+
+// metadataChanged returns true if the metadata of the local item target
+// differs from node. Only the metadata which restore sets is compared.
+func metadataChanged(target string, fi os.FileInfo, node *restic.Node) (bool, error) {
+	live, err := restic.NodeFromFileInfo(target, fi)
+	if err != nil {
+		return false, err
+	}
+
+	if live.UID != node.UID || live.GID != node.GID {
+		return true, nil
+	}
+	if node.Type == "file" && live.Size != node.Size {
+		return true, nil
+	}
+	if (node.Type == "dev" || node.Type == "chardev") && live.Device != node.Device {
+		return true, nil
+	}
+	// restore cannot set the mode of symlinks and does not set their
+	// modification time on all platforms
+	if node.Type != "symlink" && (live.Mode != node.Mode || !live.ModTime.Equal(node.ModTime)) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// verifyItem compares the local item target with node, which have the same
+// type. Directories are compared recursively.
+func (c *liveComparer) verifyItem(ctx context.Context, snPath, target string, fi os.FileInfo, node *restic.Node) error {
+	modifier := ""
+
+	switch {
+	case fi.Mode().IsRegular():
+		switch {
+		case uint64(fi.Size()) != node.Size:
+			modifier = "M"
+		case !c.metadataOnly:
+			var err error
+			c.buf, err = restorer.VerifyFile(c.repo, target, node, c.buf)
+			var mismatch *restorer.ContentMismatchError
+			if errors.As(err, &mismatch) {
+				modifier = "M"
+			} else if err != nil {
+				c.warn(target, err)
+				return nil
+			}
+		}
+
+	case fi.Mode()&os.ModeSymlink != 0:
+		linkTarget, err := fs.Readlink(target)
+		if err != nil {
+			c.warn(target, err)
+			return nil
+		}
+		if linkTarget != node.LinkTarget {
+			modifier = "M"
+		}
+	}
+
+	if modifier == "" {
+		changed, err := metadataChanged(target, fi, node)
+		if err != nil {
+			c.warn(target, err)
+		} else if changed {
+			modifier = "U"
+		}
+	}
+
+	switch modifier {
+	case "M":
+		c.printChange(NewChange(snPath, "M"))
+		c.stats.Changed++
+		c.stats.ChangedBytes += uint64(fi.Size())
+	case "U":
+		c.printChange(NewChange(c.formatPath(snPath, node.Type), "U"))
+		c.stats.MetadataOnly++
+	}
+
+	if fi.IsDir() {
+		subtree, err := c.loadSubtree(ctx, node)
+		if err != nil {
+			return err
+		}
+		return c.compareDir(ctx, snPath, target, subtree)
+	}
+	return nil
+}
+
+func runVerify(ctx context.Context, opts VerifyOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 2 {
+		return errors.Fatal("specify a snapshot ID and a directory")
+	}
+
+	dir := args[1]
+	fi, err := fs.Stat(dir)
+	if err != nil {
+		return errors.Fatalf("unable to access %v: %v", dir, err)
+	}
+	if !fi.IsDir() {
+		return errors.Fatalf("%v is not a directory", dir)
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	sn, err := findSingleSnapshot(ctx, repo.Backend(), repo, opts.snapshotFilterOptions, args[0])
+	if err != nil {
+		return errors.Fatalf("failed to find snapshot: %v", err)
+	}
+	if sn.Tree == nil {
+		return errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+
+	if !gopts.JSON {
+		Verbosef("comparing snapshot %v to %v:\n\n", sn.ID().Str(), dir)
+	}
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	root, err := restic.LoadTree(ctx, repo, *sn.Tree)
+	if err != nil {
+		return err
+	}
+
+	c := &liveComparer{
+		repo:         repo,
+		verify:       true,
+		metadataOnly: opts.MetadataOnly,
+		stats: &LiveDiffStats{
+			MessageType: "statistics",
+			Snapshot:    sn.ID().Str(),
+		},
+		printChange: func(change *Change) {
+			Printf("%-5s%v\n", change.Modifier, change.Path)
+		},
+	}
+
+	if gopts.JSON {
+		enc := json.NewEncoder(gopts.stdout)
+		c.printChange = func(change *Change) {
+			err := enc.Encode(change)
+			if err != nil {
+				Warnf("JSON encode failed: %v\n", err)
+			}
+		}
+	}
+
+	if gopts.Quiet {
+		c.printChange = func(change *Change) {}
+	}
+
+	err = c.compareDir(ctx, "/", dir, root)
+	if err != nil {
+		return err
+	}
+
+	stats := c.stats
+	if gopts.JSON {
+		err := json.NewEncoder(gopts.stdout).Encode(stats)
+		if err != nil {
+			Warnf("JSON encode failed: %v\n", err)
+		}
+	} else {
+		Printf("\n")
+		Printf("Items:       %5d new, %5d removed, %5d changed\n", stats.Added, stats.Removed, stats.Changed)
+		Printf("Metadata:    %5d changed\n", stats.MetadataOnly)
+	}
+
+	if stats.ErrorsReading > 0 {
+		return errors.Fatalf("%d items could not be read", stats.ErrorsReading)
+	}
+	if n := stats.Added + stats.Removed + stats.Changed + stats.MetadataOnly; n > 0 {
+		return errors.Fatalf("%v does not match snapshot %v, %d items differ", dir, sn.ID().Str(), n)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdVerifySignatures = &cobra.Command{
+	Use:   "verify-signatures [flags] [snapshotID ...]",
+	Short: "Verify the signatures of snapshots",
+	Long: `
+The "verify-signatures" command verifies the detached signatures which
+"backup --sign-command" stores for the snapshots. If no snapshot IDs are given,
+all snapshots matching the filter options are verified.
+
+The signed payload is the JSON document of the snapshot. For each signature,
+the verify command is run with the names of two files appended: the first one
+contains the signature, the second one the payload. A signature is valid if the
+command exits successfully, for example with --verify-command "gpg --verify".
+
+Snapshots without a signature are reported, but only lead to an error with
+--require-signature.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any
+error or a snapshot has an invalid signature.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVerifySignatures(cmd.Context(), verifySignaturesOptions, globalOptions, args)
+	},
+}
+
+// VerifySignaturesOptions bundles all options for the 'verify-signatures' command.
+type VerifySignaturesOptions struct {
+	snapshotFilterOptions
+	VerifyCommand    string
+	RequireSignature bool
+}
+
+var verifySignaturesOptions VerifySignaturesOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdVerifySignatures)
+
+	f := cmdVerifySignatures.Flags()
+	f.StringVar(&verifySignaturesOptions.VerifyCommand, "verify-command", os.Getenv("RESTIC_VERIFY_COMMAND"), "verify signatures with `command`, which is called with the signature and the snapshot file (default: $RESTIC_VERIFY_COMMAND)")
+	f.BoolVar(&verifySignaturesOptions.RequireSignature, "require-signature", false, "treat snapshots without a signature as an error")
+	initMultiSnapshotFilterOptions(f, &verifySignaturesOptions.snapshotFilterOptions, true)
+}
+
+// The results of verifying the signatures of a snapshot.
+const (
+	signatureValid    = "valid"
+	signatureInvalid  = "invalid"
+	signatureUnsigned = "unsigned"
+)
+
+// signatureStatusJSON is the JSON representation of the result for a snapshot.
+type signatureStatusJSON struct {
+	Snapshot restic.ID `json:"snapshot"`
+	Status   string    `json:"status"`
+}
+
+func runVerifySignatures(ctx context.Context, opts VerifySignaturesOptions, gopts GlobalOptions, args []string) error {
+	if opts.VerifyCommand == "" {
+		return errors.Fatal("please specify the command to verify signatures with --verify-command")
+	}
+	if _, err := splitCommand(opts.VerifyCommand); err != nil {
+		return errors.Fatalf("invalid argument for --verify-command: %v", err)
+	}
+
+	repo, err := OpenRepository(ctx, gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		lock, ctx, err = lockRepo(ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	signatures := make(map[restic.ID][]*restic.Signature)
+	err = restic.ForAllSignatures(ctx, repo.Backend(), repo, func(id restic.ID, sig *restic.Signature, err error) error {
+		if err != nil {
+			Warnf("unable to load signature %v: %v\n", id.Str(), err)
+			return nil
+		}
+		signatures[sig.Snapshot] = append(signatures[sig.Snapshot], sig)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var results []signatureStatusJSON
+	invalid, unsigned := 0, 0
+	for sn := range FindFilteredSnapshots(ctx, repo.Backend(), repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+		id := *sn.ID()
+		status := signatureUnsigned
+		if sigs := signatures[id]; len(sigs) > 0 {
+			status, err = verifySnapshotSignatures(ctx, repo, opts.VerifyCommand, id, sigs)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch status {
+		case signatureInvalid:
+			invalid++
+		case signatureUnsigned:
+			unsigned++
+		}
+		results = append(results, signatureStatusJSON{Snapshot: id, Status: status})
+
+		if !gopts.JSON {
+			switch status {
+			case signatureValid:
+				Verbosef("snapshot %s: valid signature\n", id.Str())
+			case signatureInvalid:
+				Printf("snapshot %s: INVALID signature\n", id.Str())
+			case signatureUnsigned:
+				Printf("snapshot %s: not signed\n", id.Str())
+			}
+		}
+	}
+
+	if gopts.JSON {
+		if results == nil {
+			results = []signatureStatusJSON{}
+		}
+		err = json.NewEncoder(gopts.stdout).Encode(results)
+		if err != nil {
+			return err
+		}
+	} else {
+		Printf("%d snapshots verified, %d invalid, %d not signed\n", len(results), invalid, unsigned)
+	}
+
+	if invalid > 0 {
+		return errors.Fatalf("%d snapshots have an invalid signature", invalid)
+	}
+	if unsigned > 0 && opts.RequireSignature {
+		return errors.Fatalf("%d snapshots are not signed", unsigned)
+	}
+	return nil
+}
+
+// verifySnapshotSignatures verifies the signatures of the snapshot with the
+// given id. The snapshot is valid if one of the signatures is valid.
+func verifySnapshotSignatures(ctx context.Context, repo restic.Repository, command string, id restic.ID, sigs []*restic.Signature) (string, error) {
+	payload, err := repo.LoadUnpacked(ctx, restic.SnapshotFile, id, nil)
+	if err != nil {
+		return "", errors.Fatalf("unable to load snapshot %s: %v", id.Str(), err)
+	}
+
+	for _, sig := range sigs {
+		err := runVerifyCommand(ctx, command, payload, sig.Signature)
+		if err == nil {
+			return signatureValid, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		Verboseff("signature %s of snapshot %s: %v\n", sig.ID().Str(), id.Str(), err)
+	}
+	return signatureInvalid, nil
+}
@@ -66,3 +66,55 @@ func deleteFiles(ctx context.Context, gopts GlobalOptions, ignoreError bool, rep
 	err := wg.Wait()
 	return err
 }
+
+// DeletePackManifests deletes the manifests of the given packs, packs without a
+// manifest are skipped. Like DeleteFiles, it only prints a warning if the
+// manifests cannot be listed or removed. Manifests are optional, servers which
+// don't support them may reject listing them.
+func DeletePackManifests(ctx context.Context, gopts GlobalOptions, repo restic.Repository, packs restic.IDSet) {
+	manifests := restic.NewIDSet()
+	err := repo.List(ctx, restic.ManifestFile, func(id restic.ID, size int64) error {
+		if packs.Has(id) {
+			manifests.Insert(id)
+		}
+		return nil
+	})
+	if err != nil {
+		if !gopts.JSON {
+			Warnf("unable to list the pack manifests, they are not removed: %v\n", err)
+		}
+		return
+	}
+
+	if len(manifests) != 0 {
+		DeleteFiles(ctx, gopts, repo, manifests, restic.ManifestFile)
+	}
+}
+
+// DeleteOrphanedSignatures deletes the signatures of all snapshots which are not
+// contained in snapshots. Signatures are stored separately, commands which
+// remove or replace a snapshot leave its signatures behind. Like DeleteFiles,
+// it only prints a warning if the signatures cannot be loaded or removed.
+func DeleteOrphanedSignatures(ctx context.Context, gopts GlobalOptions, repo restic.Repository, snapshots restic.IDSet) {
+	orphaned := restic.NewIDSet()
+	err := restic.ForAllSignatures(ctx, repo.Backend(), repo, func(id restic.ID, sig *restic.Signature, err error) error {
+		if err != nil {
+			return err
+		}
+		if !snapshots.Has(sig.Snapshot) {
+			orphaned.Insert(id)
+		}
+		return nil
+	})
+	if err != nil {
+		if !gopts.JSON {
+			Warnf("unable to load the signatures, they are not removed: %v\n", err)
+		}
+		return
+	}
+
+	if len(orphaned) != 0 {
+		Verbosef("deleting %d signatures of removed snapshots\n", len(orphaned))
+		DeleteFiles(ctx, gopts, repo, orphaned, restic.SignatureFile)
+	}
+}
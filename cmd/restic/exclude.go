@@ -10,19 +10,34 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/textfile"
 	"github.com/spf13/pflag"
 )
 
+// rejectionCache records for each directory visited during a backup whether
+// it contains the exclusion tagfile. It is only used for a single backup run,
+// so tagfiles which are added or removed later are seen by the next run.
 type rejectionCache struct {
 	m   map[string]bool
 	mtx sync.Mutex
+
+	// inodes holds the same information keyed by the device and inode of the
+	// directories, it is used when the same directory is reached through
+	// different paths, e.g. symlinks or bind mounts
+	inodes map[dirID]bool
+}
+
+// dirID identifies a directory independently of the path used to access it.
+type dirID struct {
+	device, inode uint64
 }
 
 // Lock locks the mutex in rc.
@@ -64,6 +79,40 @@ func (rc *rejectionCache) Store(dir string, rejected bool) {
 	rc.m[dir] = rejected
 }
 
+// GetByID returns the last stored value for the directory id, like Get.
+func (rc *rejectionCache) GetByID(id dirID) (bool, bool) {
+	if rc == nil || rc.inodes == nil {
+		return false, false
+	}
+	v, ok := rc.inodes[id]
+	return v, ok
+}
+
+// StoreByID stores a new value for the directory id, like Store.
+func (rc *rejectionCache) StoreByID(id dirID, rejected bool) {
+	if rc == nil {
+		return
+	}
+	if rc.inodes == nil {
+		rc.inodes = make(map[dirID]bool)
+	}
+	rc.inodes[id] = rejected
+}
+
+// lookupDirID returns the device and inode of dir. ok is false if they are not
+// available, e.g. on Windows.
+func lookupDirID(dir string) (id dirID, ok bool) {
+	fi, err := fs.Lstat(dir)
+	if err != nil || !fi.IsDir() {
+		return dirID{}, false
+	}
+	st := fs.ExtendedStat(fi)
+	if st.Inode == 0 {
+		return dirID{}, false
+	}
+	return dirID{device: st.DeviceID, inode: st.Inode}, true
+}
+
 // RejectByNameFunc is a function that takes a filename of a
 // file that would be included in the backup. The function returns true if it
 // should be excluded (rejected) from the backup.
@@ -93,6 +142,23 @@ func rejectByPattern(patterns []string) RejectByNameFunc {
 	}
 }
 
+// dereferenceByPattern returns a function which returns true for all symlinks
+// matching one of the patterns, these are followed during the backup.
+func dereferenceByPattern(patterns []string) func(item string) bool {
+	parsedPatterns := filter.ParsePatterns(patterns)
+	return func(item string) bool {
+		matched, err := filter.List(parsedPatterns, item)
+		if err != nil {
+			Warnf("error for dereference pattern: %v", err)
+		}
+
+		if matched {
+			debug.Log("symlink %q is dereferenced", item)
+		}
+		return matched
+	}
+}
+
 // Same as `rejectByPattern` but case insensitive.
 func rejectByInsensitivePattern(patterns []string) RejectByNameFunc {
 	for index, path := range patterns {
@@ -155,12 +221,14 @@ func isExcludedByFile(filename, tagFilename, header string, rc *rejectionCache)
 	if visited {
 		return rejected
 	}
-	rejected = isDirExcludedByFile(dir, tagFilename, header)
+	rejected = isDirExcludedByFile(dir, tagFilename, header, rc)
 	rc.Store(dir, rejected)
 	return rejected
 }
 
-func isDirExcludedByFile(dir, tagFilename, header string) bool {
+// isDirExcludedByFile returns true if dir contains the tagfile tagFilename
+// which starts with header. The caller must hold the lock of rc.
+func isDirExcludedByFile(dir, tagFilename, header string, rc *rejectionCache) bool {
 	tf := filepath.Join(dir, tagFilename)
 	_, err := fs.Lstat(tf)
 	if os.IsNotExist(err) {
@@ -175,6 +243,32 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 	if len(header) == 0 {
 		return true
 	}
+
+	// Checking the header requires opening and reading the tagfile, which is
+	// more expensive than looking up the inode of the directory. The result is
+	// reused when the directory is reached through a different path. In all
+	// other cases the stat of the tagfile above is all that is needed.
+	var id dirID
+	var haveID bool
+	if rc != nil {
+		id, haveID = lookupDirID(dir)
+	}
+	if haveID {
+		if rejected, visited := rc.GetByID(id); visited {
+			debug.Log("directory %v was checked before under a different path", dir)
+			return rejected
+		}
+	}
+
+	rejected := hasTagFileHeader(tf, header)
+	if haveID {
+		rc.StoreByID(id, rejected)
+	}
+	return rejected
+}
+
+// hasTagFileHeader returns true if the tagfile tf starts with header.
+func hasTagFileHeader(tf, header string) bool {
 	// From this stage, errors mean tagFilename exists but it is malformed.
 	// Warnings will be generated so that the user is informed that the
 	// indented ignore-action is not performed.
@@ -363,10 +457,26 @@ func rejectResticCache(repo *repository.Repository) (RejectByNameFunc, error) {
 	}, nil
 }
 
-func rejectBySize(maxSizeStr string) (RejectFunc, error) {
-	maxSize, err := parseSizeStr(maxSizeStr)
-	if err != nil {
-		return nil, err
+// rejectBySize returns a RejectFunc which rejects files larger than
+// maxSizeStr and regular files smaller than minSizeStr. An empty string
+// disables the respective bound. Directories are never rejected.
+func rejectBySize(minSizeStr, maxSizeStr string) (RejectFunc, error) {
+	var minSize, maxSize int64
+	var err error
+	if minSizeStr != "" {
+		minSize, err = parseSizeStr(minSizeStr)
+		if err != nil {
+			return nil, errors.Fatalf("invalid argument for --exclude-smaller-than: %v", err)
+		}
+	}
+	if maxSizeStr != "" {
+		maxSize, err = parseSizeStr(maxSizeStr)
+		if err != nil {
+			return nil, errors.Fatalf("invalid argument for --exclude-larger-than: %v", err)
+		}
+		if maxSize < minSize {
+			return nil, errors.Fatal("--exclude-smaller-than must not be larger than --exclude-larger-than")
+		}
 	}
 
 	return func(item string, fi os.FileInfo) bool {
@@ -376,10 +486,133 @@ func rejectBySize(maxSizeStr string) (RejectFunc, error) {
 		}
 
 		filesize := fi.Size()
-		if filesize > maxSize {
+		if maxSizeStr != "" && filesize > maxSize {
 			debug.Log("file %s is oversize: %d", item, filesize)
 			return true
 		}
+		// symlinks and special files are small, only reject regular files
+		if fi.Mode().IsRegular() && filesize < minSize {
+			debug.Log("file %s is undersize: %d", item, filesize)
+			return true
+		}
+
+		return false
+	}, nil
+}
+
+// parseAgeLimit parses a relative duration like 90d or 1y6m, which is counted
+// back from now, or an absolute time in one of the formats of parseTime.
+func parseAgeLimit(s string, now time.Time) (time.Time, error) {
+	d, err := restic.ParseDuration(s)
+	if err == nil && !d.Zero() {
+		return now.AddDate(-d.Years, -d.Months, -d.Days).Add(-time.Duration(d.Hours) * time.Hour), nil
+	}
+
+	t, err := parseTime(s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%q is neither a duration like 90d nor a time like 2006-01-02", s)
+	}
+	return t, nil
+}
+
+// rejectByAge returns a RejectFunc which rejects regular files last modified
+// before olderThanStr and after newerThanStr, both are parsed relative to now
+// by parseAgeLimit. An empty string disables the respective bound.
+// Directories are never rejected, so that the files in them are still
+// considered.
+func rejectByAge(olderThanStr, newerThanStr string, now time.Time) (RejectFunc, error) {
+	var oldest, newest time.Time
+	var err error
+	if olderThanStr != "" {
+		oldest, err = parseAgeLimit(olderThanStr, now)
+		if err != nil {
+			return nil, errors.Fatalf("invalid argument for --exclude-older-than: %v", err)
+		}
+	}
+	if newerThanStr != "" {
+		newest, err = parseAgeLimit(newerThanStr, now)
+		if err != nil {
+			return nil, errors.Fatalf("invalid argument for --exclude-newer-than: %v", err)
+		}
+		if newest.Before(oldest) {
+			return nil, errors.Fatal("--exclude-newer-than must be more recent than --exclude-older-than")
+		}
+	}
+
+	return func(item string, fi os.FileInfo) bool {
+		if !fi.Mode().IsRegular() {
+			return false
+		}
+
+		mtime := fi.ModTime()
+		if olderThanStr != "" && mtime.Before(oldest) {
+			debug.Log("file %s is too old: %v", item, mtime)
+			return true
+		}
+		if newerThanStr != "" && mtime.After(newest) {
+			debug.Log("file %s is too new: %v", item, mtime)
+			return true
+		}
+
+		return false
+	}, nil
+}
+
+// rejectByXattr returns a RejectFunc which rejects files and directories with
+// one of the extended attributes in specs. A spec has the form name or
+// name=value, the latter only matches if the attribute has the given value.
+func rejectByXattr(specs []string) (RejectFunc, error) {
+	type xattrSpec struct {
+		name     string
+		value    []byte
+		hasValue bool
+	}
+
+	var attrs []xattrSpec
+	for _, spec := range specs {
+		name, value, hasValue := spec, "", false
+		if i := strings.IndexByte(spec, '='); i >= 0 {
+			name, value, hasValue = spec[:i], spec[i+1:], true
+		}
+		if name == "" {
+			return nil, errors.Fatalf("invalid --exclude-if-xattr %q: empty attribute name", spec)
+		}
+		attrs = append(attrs, xattrSpec{name: name, value: []byte(value), hasValue: hasValue})
+	}
+
+	return func(item string, fi os.FileInfo) bool {
+		// the attributes of a symlink cannot be read without following it
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return false
+		}
+
+		names, err := restic.Listxattr(item)
+		if err != nil {
+			debug.Log("unable to list extended attributes of %v: %v", item, err)
+			return false
+		}
+
+		for _, attr := range attrs {
+			for _, name := range names {
+				if name != attr.name {
+					continue
+				}
+				if !attr.hasValue {
+					debug.Log("%v has extended attribute %v", item, name)
+					return true
+				}
+
+				value, err := restic.Getxattr(item, name)
+				if err != nil {
+					debug.Log("unable to read extended attribute %v of %v: %v", name, item, err)
+					continue
+				}
+				if bytes.Equal(value, attr.value) {
+					debug.Log("%v has extended attribute %v=%q", item, name, value)
+					return true
+				}
+			}
+		}
 
 		return false
 	}, nil
@@ -4,8 +4,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
 )
 
@@ -190,6 +193,38 @@ func TestMultipleIsExcludedByFile(t *testing.T) {
 	}
 }
 
+// TestIsExcludedByFileInodeCache checks that a directory which is reached
+// through a different path is not checked again during the same run.
+func TestIsExcludedByFileInodeCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are not available on Windows")
+	}
+
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	const header = "Signature: 8a477f597d28d172789f06886806bc55"
+	cacheDir := filepath.Join(tempDir, "real", "cache")
+	test.OK(t, os.MkdirAll(cacheDir, 0700))
+	tagFile := filepath.Join(cacheDir, "CACHEDIR.TAG")
+	test.OK(t, ioutil.WriteFile(tagFile, []byte(header), 0600))
+	test.OK(t, os.Symlink(filepath.Join(tempDir, "real"), filepath.Join(tempDir, "alias")))
+
+	reject, err := rejectIfPresent("CACHEDIR.TAG:" + header)
+	test.OK(t, err)
+	test.Assert(t, reject(filepath.Join(cacheDir, "foo")), "file in cache directory not excluded")
+
+	// the header is not read again for the other path, the changed tagfile
+	// is not noticed
+	test.OK(t, ioutil.WriteFile(tagFile, []byte("invalid"), 0600))
+	test.Assert(t, reject(filepath.Join(tempDir, "alias", "cache", "foo")), "cached result not used for other path")
+
+	// a new run reads the header again and notices the changed tagfile
+	reject, err = rejectIfPresent("CACHEDIR.TAG:" + header)
+	test.OK(t, err)
+	test.Assert(t, !reject(filepath.Join(tempDir, "alias", "cache", "foo")), "file excluded after tagfile was changed")
+}
+
 func TestParseSizeStr(t *testing.T) {
 	sizeStrTests := []struct {
 		in       string
@@ -290,7 +325,7 @@ func TestIsExcludedByFileSize(t *testing.T) {
 	test.OKs(t, errs) // see if anything went wrong during the creation
 
 	// create rejection function
-	sizeExclude, _ := rejectBySize(maxSizeStr)
+	sizeExclude, _ := rejectBySize("", maxSizeStr)
 
 	// To mock the archiver scanning walk, we create filepath.WalkFn
 	// that tests against the two rejection functions and stores
@@ -319,6 +354,154 @@ func TestIsExcludedByFileSize(t *testing.T) {
 	}
 }
 
+func TestRejectBySizeRange(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	files := map[string]int64{
+		"empty": 0,
+		"small": 4095,
+		"min":   4096,
+		"max":   1024 * 1024,
+		"large": 1024*1024 + 1,
+	}
+	for name, size := range files {
+		f, err := os.Create(filepath.Join(tempDir, name))
+		test.OK(t, err)
+		test.OK(t, f.Truncate(size))
+		test.OK(t, f.Close())
+	}
+	test.OK(t, os.Mkdir(filepath.Join(tempDir, "dir"), 0700))
+
+	reject, err := rejectBySize("4K", "1M")
+	test.OK(t, err)
+
+	for name, want := range map[string]bool{
+		"empty": true,
+		"small": true,
+		"min":   false,
+		"max":   false,
+		"large": true,
+		"dir":   false,
+	} {
+		p := filepath.Join(tempDir, name)
+		fi, err := os.Lstat(p)
+		test.OK(t, err)
+		if got := reject(p, fi); got != want {
+			t.Errorf("%v: want rejected %v, got %v", name, want, got)
+		}
+	}
+
+	for _, args := range [][2]string{{"1M", "4K"}, {"foo", ""}, {"", "1X"}} {
+		_, err := rejectBySize(args[0], args[1])
+		test.Assert(t, err != nil, "expected error for min %q, max %q", args[0], args[1])
+	}
+}
+
+func TestRejectByAge(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.Local)
+	files := map[string]time.Time{
+		"ancient": time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local),
+		"old":     now.AddDate(0, 0, -89),
+		"recent":  now.Add(-2 * time.Hour),
+		"new":     now.Add(-30 * time.Minute),
+	}
+	for name, mtime := range files {
+		p := filepath.Join(tempDir, name)
+		test.OK(t, ioutil.WriteFile(p, []byte(name), 0600))
+		test.OK(t, os.Chtimes(p, mtime, mtime))
+	}
+	dir := filepath.Join(tempDir, "dir")
+	test.OK(t, os.Mkdir(dir, 0700))
+	test.OK(t, os.Chtimes(dir, files["ancient"], files["ancient"]))
+
+	for _, c := range []struct {
+		olderThan, newerThan string
+		rejected             []string
+	}{
+		{"90d", "", []string{"ancient"}},
+		{"", "1h", []string{"new"}},
+		{"90d", "1h", []string{"ancient", "new"}},
+		{"2022-01-01", "", []string{"ancient"}},
+		{"1m", "2022-06-15 10:30", []string{"ancient", "new", "old"}},
+	} {
+		reject, err := rejectByAge(c.olderThan, c.newerThan, now)
+		test.OK(t, err)
+
+		var rejected []string
+		for _, name := range []string{"ancient", "dir", "new", "old", "recent"} {
+			p := filepath.Join(tempDir, name)
+			fi, err := os.Lstat(p)
+			test.OK(t, err)
+			if reject(p, fi) {
+				rejected = append(rejected, name)
+			}
+		}
+		test.Equals(t, c.rejected, rejected)
+	}
+
+	for _, args := range [][2]string{{"1h", "90d"}, {"foo", ""}, {"", "10x"}, {"0d", ""}} {
+		_, err := rejectByAge(args[0], args[1], now)
+		test.Assert(t, err != nil, "expected error for older than %q, newer than %q", args[0], args[1])
+	}
+}
+
+func TestRejectByXattr(t *testing.T) {
+	if !restic.XattrSupported {
+		t.Skip("extended attributes are not supported on this platform")
+	}
+
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	files := []struct {
+		name  string
+		attrs map[string]string
+		incl  bool
+	}{
+		{"plain", nil, true},
+		{"nobackup", map[string]string{"user.nobackup": ""}, false},
+		{"other", map[string]string{"user.other": "1"}, true},
+		{"class-skip", map[string]string{"user.class": "skip"}, false},
+		{"class-keep", map[string]string{"user.class": "keep"}, true},
+	}
+
+	for _, f := range files {
+		filename := filepath.Join(tempDir, f.name)
+		test.OK(t, ioutil.WriteFile(filename, []byte(f.name), 0600))
+		for name, value := range f.attrs {
+			test.OK(t, restic.Setxattr(filename, name, []byte(value)))
+		}
+	}
+
+	// Setxattr silently ignores file systems without support for extended
+	// attributes
+	names, err := restic.Listxattr(filepath.Join(tempDir, "nobackup"))
+	test.OK(t, err)
+	if len(names) == 0 {
+		t.Skip("extended attributes are not supported by the file system")
+	}
+
+	reject, err := rejectByXattr([]string{"user.nobackup", "user.class=skip"})
+	test.OK(t, err)
+
+	for _, f := range files {
+		filename := filepath.Join(tempDir, f.name)
+		fi, err := os.Lstat(filename)
+		test.OK(t, err)
+
+		if excluded := reject(filename, fi); excluded == f.incl {
+			t.Errorf("wrong result for %v: excluded %v", f.name, excluded)
+		}
+	}
+
+	_, err = rejectByXattr([]string{"=foo"})
+	test.Assert(t, err != nil, "expected error for empty attribute name")
+}
+
 func TestDeviceMap(t *testing.T) {
 	deviceMap := DeviceMap{
 		filepath.FromSlash("/"):          1,
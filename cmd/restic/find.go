@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/pflag"
 )
@@ -12,6 +16,10 @@ type snapshotFilterOptions struct {
 	Hosts []string
 	Tags  restic.TagLists
 	Paths []string
+
+	// GroupBy is only used by commands that work on a single snapshot, see
+	// findSingleSnapshot
+	GroupBy string
 }
 
 // initMultiSnapshotFilterOptions is used for commands that work on multiple snapshots
@@ -32,6 +40,71 @@ func initSingleSnapshotFilterOptions(flags *pflag.FlagSet, options *snapshotFilt
 	flags.StringArrayVarP(&options.Hosts, "host", "H", nil, "only consider snapshots for this `host`, when snapshot ID \"latest\" is given (can be specified multiple times)")
 	flags.Var(&options.Tags, "tag", "only consider snapshots including `tag[,tag,...]`, when snapshot ID \"latest\" is given (can be specified multiple times)")
 	flags.StringArrayVar(&options.Paths, "path", nil, "only consider snapshots including this (absolute) `path`, when snapshot ID \"latest\" is given (can be specified multiple times)")
+	flags.StringVarP(&options.GroupBy, "group-by", "g", "", "`group` snapshots by host, paths, tags and/or tag:prefix like forget does, when snapshot ID \"latest\" is given the matching snapshots must belong to a single group")
+}
+
+// findSingleSnapshot returns the snapshot selected by snapshotID and the filter
+// options. For "latest" with --group-by, the snapshots matching the filter are
+// grouped like for forget and the latest snapshot is only returned if they all
+// belong to the same group. Otherwise it is unclear which group was meant.
+// When grouping by paths, --path selects the snapshots with exactly these
+// paths, and likewise for tags.
+func findSingleSnapshot(ctx context.Context, be restic.Lister, loader restic.LoaderUnpacked, opts snapshotFilterOptions, snapshotID string) (*restic.Snapshot, error) {
+	if snapshotID != "latest" || opts.GroupBy == "" {
+		return restic.FindFilteredSnapshot(ctx, be, loader, opts.Hosts, opts.Tags, opts.Paths, nil, snapshotID)
+	}
+
+	// snapshots record absolute paths, as for restic.FindFilteredSnapshot
+	paths := make([]string, 0, len(opts.Paths))
+	for _, p := range opts.Paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "Abs")
+		}
+		paths = append(paths, filepath.Clean(abs))
+	}
+
+	var snapshots restic.Snapshots
+	err := restic.FindFilteredSnapshots(ctx, be, loader, opts.Hosts, opts.Tags, paths, nil, func(id string, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return errors.Errorf("Error loading snapshot %v: %v", id, err)
+		}
+		snapshots = append(snapshots, sn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	snapshots = filterExactGroup(snapshots, opts.GroupBy, paths, opts.Tags)
+	if len(snapshots) == 0 {
+		return nil, errors.Errorf("no snapshot matched given filter (Paths:%v Tags:%v Hosts:%v)", paths, opts.Tags, opts.Hosts)
+	}
+
+	groups, _, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) > 1 {
+		var descriptions []string
+		for k := range groups {
+			desc, err := snapshotGroupDescription(k)
+			if err != nil {
+				return nil, err
+			}
+			descriptions = append(descriptions, desc)
+		}
+		sort.Strings(descriptions)
+		return nil, errors.Errorf("the snapshots matching the filter belong to %d groups when grouped by %q, select one with --host, --path or --tag:\n  %v",
+			len(groups), opts.GroupBy, strings.Join(descriptions, "\n  "))
+	}
+
+	latest := snapshots[0]
+	for _, sn := range snapshots[1:] {
+		if sn.Time.After(latest.Time) {
+			latest = sn
+		}
+	}
+	return latest, nil
 }
 
 // FindFilteredSnapshots yields Snapshots, either given explicitly by `snapshotIDs` or filtered from the list of all snapshots.
@@ -63,3 +136,47 @@ func FindFilteredSnapshots(ctx context.Context, be restic.Lister, loader restic.
 	}()
 	return out
 }
+
+// filterExactGroup returns the snapshots whose paths and tags are equal to the
+// filter, if the snapshots are grouped by them. The filters usually match all
+// snapshots which include the paths and tags, which would select several
+// groups.
+func filterExactGroup(snapshots restic.Snapshots, groupBy string, paths []string, tags restic.TagLists) restic.Snapshots {
+	var byPaths, byTags bool
+	for _, option := range strings.Split(groupBy, ",") {
+		switch option {
+		case "path", "paths":
+			byPaths = len(paths) > 0
+		case "tag", "tags":
+			byTags = len(tags) == 1
+		}
+	}
+
+	res := snapshots[:0]
+	for _, sn := range snapshots {
+		if byPaths && !sameStringSet(sn.Paths, paths) {
+			continue
+		}
+		if byTags && !sameStringSet(sn.Tags, tags[0]) {
+			continue
+		}
+		res = append(res, sn)
+	}
+	return res
+}
+
+// sameStringSet returns true if a and b contain the same strings.
+func sameStringSet(a, b []string) bool {
+	set := make(map[string]struct{}, len(a))
+	for _, s := range a {
+		set[s] = struct{}{}
+	}
+	other := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		if _, ok := set[s]; !ok {
+			return false
+		}
+		other[s] = struct{}{}
+	}
+	return len(set) == len(other)
+}
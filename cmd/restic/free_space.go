@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/ui"
+)
+
+// minFreeSpace is the amount of space which must remain free in the
+// repository, either an absolute size or a percentage of the file system.
+type minFreeSpace struct {
+	bytes   uint64
+	percent float64
+}
+
+// parseMinFreeSpace parses a size like "10G" or a percentage like "5%".
+func parseMinFreeSpace(s string) (minFreeSpace, error) {
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil {
+			return minFreeSpace{}, err
+		}
+		if percent < 0 || percent > 100 {
+			return minFreeSpace{}, errors.Errorf("percentage %v is not between 0 and 100", s)
+		}
+		return minFreeSpace{percent: percent}, nil
+	}
+
+	size, err := parseSizeStr(s)
+	if err != nil {
+		return minFreeSpace{}, err
+	}
+	if size < 0 {
+		return minFreeSpace{}, errors.Errorf("size %v must not be negative", s)
+	}
+	return minFreeSpace{bytes: uint64(size)}, nil
+}
+
+// required returns the number of bytes which must remain free on a file
+// system with the given size.
+func (m minFreeSpace) required(total uint64) uint64 {
+	if m.percent > 0 {
+		return uint64(float64(total) * m.percent / 100)
+	}
+	return m.bytes
+}
+
+func (m minFreeSpace) String() string {
+	if m.percent > 0 {
+		return fmt.Sprintf("%v%%", m.percent)
+	}
+	return ui.FormatBytes(m.bytes)
+}
+
+// freeSpaceCheckInterval is the interval in which the free space in the
+// repository is checked for --min-free-space.
+const freeSpaceCheckInterval = 10 * time.Second
+
+// errNotEnoughFreeSpace is returned when less space than required is free.
+type errNotEnoughFreeSpace struct {
+	free, required uint64
+}
+
+func (e errNotEnoughFreeSpace) Error() string {
+	return fmt.Sprintf("not enough free space in the repository: %v free, at least %v required",
+		ui.FormatBytes(e.free), ui.FormatBytes(e.required))
+}
+
+// checkFreeSpace returns an errNotEnoughFreeSpace if less space than required
+// by min is free in the backend.
+func checkFreeSpace(ctx context.Context, be backend.FreeSpacer, min minFreeSpace) error {
+	free, total, err := be.FreeSpace(ctx)
+	if err != nil {
+		return err
+	}
+	debug.Log("%d of %d bytes free", free, total)
+
+	required := min.required(total)
+	if free < required {
+		return errNotEnoughFreeSpace{free: free, required: required}
+	}
+	return nil
+}
+
+// watchFreeSpace checks the free space in the backend every interval until
+// ctx is cancelled. Once less space than required by min is free, exceeded is
+// called with the error and watchFreeSpace returns. Errors determining the
+// free space are ignored, the backup is not aborted for them.
+func watchFreeSpace(ctx context.Context, be backend.FreeSpacer, min minFreeSpace, interval time.Duration, exceeded func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := checkFreeSpace(ctx, be, min)
+		var spaceErr errNotEnoughFreeSpace
+		if errors.As(err, &spaceErr) {
+			exceeded(err)
+			return
+		}
+		if err != nil {
+			debug.Log("unable to check the free space: %v", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseMinFreeSpace(t *testing.T) {
+	var tests = []struct {
+		s        string
+		min      minFreeSpace
+		total    uint64
+		required uint64
+	}{
+		{"1024", minFreeSpace{bytes: 1024}, 100, 1024},
+		{"10G", minFreeSpace{bytes: 10 << 30}, 1 << 40, 10 << 30},
+		{"5%", minFreeSpace{percent: 5}, 1000, 50},
+		{"0.5%", minFreeSpace{percent: 0.5}, 1000, 5},
+		{"0", minFreeSpace{}, 1000, 0},
+	}
+
+	for _, test := range tests {
+		min, err := parseMinFreeSpace(test.s)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.min, min)
+		rtest.Equals(t, test.required, min.required(test.total))
+	}
+
+	for _, s := range []string{"", "%", "x%", "-1%", "101%", "-5G", "10X"} {
+		_, err := parseMinFreeSpace(s)
+		rtest.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+// testFreeSpacer returns the free space received from free.
+type testFreeSpacer struct {
+	free chan uint64
+}
+
+func (be testFreeSpacer) FreeSpace(ctx context.Context) (uint64, uint64, error) {
+	select {
+	case free := <-be.free:
+		return free, 1000, nil
+	case <-ctx.Done():
+		return 0, 0, ctx.Err()
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	be := testFreeSpacer{free: make(chan uint64, 1)}
+
+	be.free <- 100
+	rtest.OK(t, checkFreeSpace(context.TODO(), be, minFreeSpace{percent: 10}))
+
+	be.free <- 99
+	err := checkFreeSpace(context.TODO(), be, minFreeSpace{percent: 10})
+	var spaceErr errNotEnoughFreeSpace
+	rtest.Assert(t, errors.As(err, &spaceErr), "unexpected error %v", err)
+	rtest.Equals(t, errNotEnoughFreeSpace{free: 99, required: 100}, spaceErr)
+}
+
+func TestWatchFreeSpace(t *testing.T) {
+	be := testFreeSpacer{free: make(chan uint64)}
+	exceeded := make(chan error, 1)
+
+	done := make(chan struct{})
+	go func() {
+		watchFreeSpace(context.TODO(), be, minFreeSpace{bytes: 500}, time.Millisecond, func(err error) {
+			exceeded <- err
+		})
+		close(done)
+	}()
+
+	be.free <- 800
+	be.free <- 500
+	select {
+	case err := <-exceeded:
+		t.Fatalf("unexpected error %v", err)
+	default:
+	}
+
+	be.free <- 499
+	<-done
+	err := <-exceeded
+	rtest.Equals(t, errNotEnoughFreeSpace{free: 499, required: 500}, err)
+}
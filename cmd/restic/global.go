@@ -5,15 +5,19 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/accounting"
+	"github.com/restic/restic/internal/backend/appendonly"
 	"github.com/restic/restic/internal/backend/azure"
 	"github.com/restic/restic/internal/backend/b2"
 	"github.com/restic/restic/internal/backend/gs"
@@ -27,6 +31,7 @@ import (
 	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/backend/swift"
 	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/credential"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/options"
@@ -36,6 +41,7 @@ import (
 	"github.com/restic/restic/internal/ui/termstatus"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/keyprovider"
 
 	"os/exec"
 
@@ -55,16 +61,26 @@ type GlobalOptions struct {
 	RepositoryFile  string
 	PasswordFile    string
 	PasswordCommand string
+	KeyProvider     string
+	CredentialCmd   string
 	KeyHint         string
 	Quiet           bool
 	Verbose         int
 	NoLock          bool
+	AppendOnly      bool
+	AuditLog        bool
+	StaleLockAge    time.Duration
 	JSON            bool
 	CacheDir        string
 	NoCache         bool
 	CleanupCache    bool
 	Compression     repository.CompressionMode
 	PackSize        uint
+	PackManifests   bool
+	LowMemoryIndex  bool
+
+	RetryMaxAttempts int
+	RetryMaxElapsed  time.Duration
 
 	backend.TransportOptions
 	limiter.Limits
@@ -93,6 +109,14 @@ var globalOptions = GlobalOptions{
 }
 
 var isReadingPassword bool
+
+// backendAccounting counts the requests to the backend of the repository
+// opened last by OpenRepository.
+var backendAccounting *accounting.Backend
+
+// backendFreeSpace reports the free space of the backend of the repository
+// opened last, it is nil if the backend cannot report it.
+var backendFreeSpace backend.FreeSpacer
 var internalGlobalCtx context.Context
 
 func init() {
@@ -111,9 +135,14 @@ func init() {
 	f.StringVarP(&globalOptions.PasswordFile, "password-file", "p", "", "`file` to read the repository password from (default: $RESTIC_PASSWORD_FILE)")
 	f.StringVarP(&globalOptions.KeyHint, "key-hint", "", "", "`key` ID of key to try decrypting first (default: $RESTIC_KEY_HINT)")
 	f.StringVarP(&globalOptions.PasswordCommand, "password-command", "", "", "shell `command` to obtain the repository password from (default: $RESTIC_PASSWORD_COMMAND)")
+	f.StringVar(&globalOptions.KeyProvider, "key-provider", "", "obtain the repository password from the key `provider`, e.g. a PKCS#11 URI (default: $RESTIC_KEY_PROVIDER)")
+	f.StringVar(&globalOptions.CredentialCmd, "credential-command", "", "shell `command` to obtain the backend credentials from (default: $RESTIC_CREDENTIAL_COMMAND)")
 	f.BoolVarP(&globalOptions.Quiet, "quiet", "q", false, "do not output comprehensive progress report")
 	f.CountVarP(&globalOptions.Verbose, "verbose", "v", "be verbose (specify multiple times or a level using --verbose=`n`, max level/times is 3)")
 	f.BoolVar(&globalOptions.NoLock, "no-lock", false, "do not lock the repository, this allows some operations on read-only repositories")
+	f.BoolVar(&globalOptions.AppendOnly, "append-only", false, "do not remove or overwrite any files in the repository except locks")
+	f.BoolVar(&globalOptions.AuditLog, "audit-log", false, "record backups, forget, prune and key changes in the audit log of the repository (default: $RESTIC_AUDIT_LOG)")
+	f.DurationVar(&globalOptions.StaleLockAge, "stale-lock-age", 0, "automatically remove stale locks which have not been refreshed for `duration` (at least 30m, default: disabled)")
 	f.BoolVarP(&globalOptions.JSON, "json", "", false, "set output mode to JSON for commands that support it")
 	f.StringVar(&globalOptions.CacheDir, "cache-dir", "", "set the cache `directory`. (default: use system default cache directory)")
 	f.BoolVar(&globalOptions.NoCache, "no-cache", false, "do not use a local cache")
@@ -121,10 +150,14 @@ func init() {
 	f.StringVar(&globalOptions.TLSClientCertKeyFilename, "tls-client-cert", "", "path to a `file` containing PEM encoded TLS client certificate and private key")
 	f.BoolVar(&globalOptions.InsecureTLS, "insecure-tls", false, "skip TLS certificate verification when connecting to the repository (insecure)")
 	f.BoolVar(&globalOptions.CleanupCache, "cleanup-cache", false, "auto remove old cache directories")
-	f.Var(&globalOptions.Compression, "compression", "compression mode (only available for repository format version 2), one of (auto|off|max)")
+	f.Var(&globalOptions.Compression, "compression", "compression mode (only available for repository format version 2), one of (auto|off|max|fast)")
 	f.IntVar(&globalOptions.Limits.UploadKb, "limit-upload", 0, "limits uploads to a maximum `rate` in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.Limits.DownloadKb, "limit-download", 0, "limits downloads to a maximum `rate` in KiB/s. (default: unlimited)")
 	f.UintVar(&globalOptions.PackSize, "pack-size", 0, "set target pack `size` in MiB, created pack files may be larger (default: $RESTIC_PACK_SIZE)")
+	f.BoolVar(&globalOptions.PackManifests, "pack-manifests", false, "store an encrypted manifest of the blobs for each new pack file, which check uses to locate damaged blobs (default: $RESTIC_PACK_MANIFESTS)")
+	f.BoolVar(&globalOptions.LowMemoryIndex, "low-memory-index", false, "store the repository index in temporary files instead of memory, which is slower but reduces the memory usage")
+	f.IntVar(&globalOptions.RetryMaxAttempts, "retry-max-attempts", 10, "retry failed backend operations at most `n` times")
+	f.DurationVar(&globalOptions.RetryMaxElapsed, "retry-max-elapsed", retry.DefaultMaxElapsedTime, "stop retrying a failed backend operation after `duration`, 0 means no limit")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
 	// Use our "generate" command instead of the cobra provided "completion" command
 	cmdRoot.CompletionOptions.DisableDefaultCmd = true
@@ -134,6 +167,11 @@ func init() {
 	globalOptions.PasswordFile = os.Getenv("RESTIC_PASSWORD_FILE")
 	globalOptions.KeyHint = os.Getenv("RESTIC_KEY_HINT")
 	globalOptions.PasswordCommand = os.Getenv("RESTIC_PASSWORD_COMMAND")
+	globalOptions.KeyProvider = os.Getenv("RESTIC_KEY_PROVIDER")
+	globalOptions.CredentialCmd = os.Getenv("RESTIC_CREDENTIAL_COMMAND")
+	// parse the audit log setting from env, on error the log is not written
+	globalOptions.AuditLog, _ = strconv.ParseBool(os.Getenv("RESTIC_AUDIT_LOG"))
+	globalOptions.PackManifests, _ = strconv.ParseBool(os.Getenv("RESTIC_PACK_MANIFESTS"))
 	comp := os.Getenv("RESTIC_COMPRESSION")
 	if comp != "" {
 		// ignore error as there's no good way to handle it
@@ -175,6 +213,10 @@ func stdoutCanUpdateStatus() bool {
 	return termstatus.CanUpdateStatus(os.Stdout.Fd())
 }
 
+func stdoutStatusMode() termstatus.StatusMode {
+	return termstatus.DetectStatusMode(os.Stdout.Fd())
+}
+
 func stdoutTerminalWidth() int {
 	w, _, err := term.GetSize(int(os.Stdout.Fd()))
 	if err != nil {
@@ -297,6 +339,16 @@ func resolvePassword(opts GlobalOptions, envStr string) (string, error) {
 	if opts.PasswordFile != "" && opts.PasswordCommand != "" {
 		return "", errors.Fatalf("Password file and command are mutually exclusive options")
 	}
+	if opts.KeyProvider != "" {
+		if opts.PasswordFile != "" || opts.PasswordCommand != "" {
+			return "", errors.Fatalf("Key provider and password file or command are mutually exclusive options")
+		}
+		provider, err := keyprovider.Parse(opts.KeyProvider)
+		if err != nil {
+			return "", err
+		}
+		return provider.Secret(internalGlobalCtx)
+	}
 	if opts.PasswordCommand != "" {
 		args, err := backend.SplitShellStrings(opts.PasswordCommand)
 		if err != nil {
@@ -311,11 +363,7 @@ func resolvePassword(opts GlobalOptions, envStr string) (string, error) {
 		return (strings.TrimSpace(string(output))), nil
 	}
 	if opts.PasswordFile != "" {
-		s, err := textfile.Read(opts.PasswordFile)
-		if errors.Is(err, os.ErrNotExist) {
-			return "", errors.Fatalf("%s does not exist", opts.PasswordFile)
-		}
-		return strings.TrimSpace(string(s)), errors.Wrap(err, "Readfile")
+		return loadPasswordFromFile(opts.PasswordFile)
 	}
 
 	if pwd := os.Getenv(envStr); pwd != "" {
@@ -325,6 +373,60 @@ func resolvePassword(opts GlobalOptions, envStr string) (string, error) {
 	return "", nil
 }
 
+// maxPasswordFileSize is the maximum amount of data read from a named pipe
+// containing the password.
+const maxPasswordFileSize = 64 * 1024
+
+// loadPasswordFromFile reads the password from pwdFile, which is either a
+// regular file or a named pipe (FIFO). For a named pipe, this waits until
+// the password has been written and the writer has closed the pipe, so that
+// a secrets manager can pass the password without storing it on disk.
+func loadPasswordFromFile(pwdFile string) (string, error) {
+	fi, err := os.Stat(pwdFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errors.Fatalf("%s does not exist", pwdFile)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Stat")
+	}
+
+	var s []byte
+	if fi.Mode()&os.ModeNamedPipe != 0 {
+		s, err = readNamedPipe(pwdFile)
+	} else {
+		s, err = textfile.Read(pwdFile)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Readfile")
+	}
+	return strings.TrimSpace(string(s)), nil
+}
+
+// readNamedPipe reads all data from the named pipe filename and closes it
+// again. Opening a named pipe blocks until a writer has opened it as well, the
+// data is complete once the writer has closed the pipe.
+func readNamedPipe(filename string) ([]byte, error) {
+	debug.Log("waiting for data to be written to the named pipe %v", filename)
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, maxPasswordFileSize+1))
+	cerr := f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if cerr != nil {
+		return nil, cerr
+	}
+	if len(data) > maxPasswordFileSize {
+		return nil, errors.Errorf("more than %d bytes were written to the named pipe", maxPasswordFileSize)
+	}
+
+	return textfile.Decode(data)
+}
+
 // readPassword reads the password from the given reader directly.
 func readPassword(in io.Reader) (password string, err error) {
 	sc := bufio.NewScanner(in)
@@ -435,18 +537,35 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		return nil, err
 	}
 
+	if opts.RetryMaxAttempts < 0 {
+		return nil, errors.Fatal("--retry-max-attempts must not be negative")
+	}
+	if opts.RetryMaxElapsed < 0 {
+		return nil, errors.Fatal("--retry-max-elapsed must not be negative")
+	}
+
 	be, err := open(ctx, repo, opts, opts.extended)
 	if err != nil {
 		return nil, err
 	}
 
+	// count below the retry backend so that each attempt is a request
+	backendAccounting = accounting.New(be)
+	be = backendAccounting
+
 	report := func(msg string, err error, d time.Duration) {
 		Warnf("%v returned error, retrying after %v: %v\n", msg, d, err)
 	}
 	success := func(msg string, retries int) {
 		Warnf("%v operation successful after %d retries\n", msg, retries)
 	}
-	be = retry.New(be, 10, report, success)
+	retryBackend := retry.New(be, opts.RetryMaxAttempts, report, success)
+	retryBackend.MaxElapsedTime = opts.RetryMaxElapsed
+	be = retryBackend
+
+	if opts.AppendOnly {
+		be = appendonly.New(be)
+	}
 
 	// wrap backend if a test specified a hook
 	if opts.backendTestHook != nil {
@@ -457,8 +576,10 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 	}
 
 	s, err := repository.New(be, repository.Options{
-		Compression: opts.Compression,
-		PackSize:    opts.PackSize * 1024 * 1024,
+		Compression:    opts.Compression,
+		PackSize:       opts.PackSize * 1024 * 1024,
+		PackManifests:  opts.PackManifests,
+		LowMemoryIndex: opts.LowMemoryIndex,
 	})
 	if err != nil {
 		return nil, err
@@ -515,6 +636,9 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 	if c.Created && !opts.JSON && stdoutIsTerminal() {
 		Verbosef("created new cache in %v\n", c.Base)
 	}
+	c.OnDisable = func(err error) {
+		Warnf("%v, continuing without cache\n", err)
+	}
 
 	// start using the cache
 	s.UseCache(c)
@@ -551,10 +675,35 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 	return s, nil
 }
 
-func parseConfig(loc location.Location, opts options.Options) (interface{}, error) {
+func parseConfig(loc location.Location, opts options.Options, creds *credential.Command) (interface{}, error) {
 	// only apply options for a particular backend here
 	opts = opts.Extract(loc.Scheme)
 
+	// values printed by the credential command take precedence over the
+	// environment
+	getenv := os.Getenv
+	switch loc.Scheme {
+	case "s3", "gs", "azure", "swift", "b2":
+		if creds == nil {
+			break
+		}
+		values, err := creds.Get(internalGlobalCtx)
+		if err != nil {
+			return nil, errors.Fatalf("unable to obtain the credentials: %v", err)
+		}
+		// only the s3 backend obtains the credentials again when they
+		// expire, the other backends would fail once they have expired
+		if loc.Scheme != "s3" && !creds.Expires().IsZero() {
+			return nil, errors.Fatalf("the credential command returned credentials which expire, this is only supported for s3")
+		}
+		getenv = func(name string) string {
+			if v, ok := values[name]; ok {
+				return v
+			}
+			return os.Getenv(name)
+		}
+	}
+
 	switch loc.Scheme {
 	case "local":
 		cfg := loc.Config.(local.Config)
@@ -577,11 +726,11 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 	case "s3":
 		cfg := loc.Config.(s3.Config)
 		if cfg.KeyID == "" {
-			cfg.KeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+			cfg.KeyID = getenv("AWS_ACCESS_KEY_ID")
 		}
 
 		if cfg.Secret.String() == "" {
-			cfg.Secret = options.NewSecretString(os.Getenv("AWS_SECRET_ACCESS_KEY"))
+			cfg.Secret = options.NewSecretString(getenv("AWS_SECRET_ACCESS_KEY"))
 		}
 
 		if cfg.KeyID == "" && cfg.Secret.String() != "" {
@@ -591,20 +740,25 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 		}
 
 		if cfg.Region == "" {
-			cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+			cfg.Region = getenv("AWS_DEFAULT_REGION")
 		}
 
 		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
 			return nil, err
 		}
 
+		if creds != nil {
+			// allows refreshing expired credentials
+			cfg.Credentials = creds
+		}
+
 		debug.Log("opening s3 repository at %#v", cfg)
 		return cfg, nil
 
 	case "gs":
 		cfg := loc.Config.(gs.Config)
 		if cfg.ProjectID == "" {
-			cfg.ProjectID = os.Getenv("GOOGLE_PROJECT_ID")
+			cfg.ProjectID = getenv("GOOGLE_PROJECT_ID")
 		}
 
 		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
@@ -617,15 +771,15 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 	case "azure":
 		cfg := loc.Config.(azure.Config)
 		if cfg.AccountName == "" {
-			cfg.AccountName = os.Getenv("AZURE_ACCOUNT_NAME")
+			cfg.AccountName = getenv("AZURE_ACCOUNT_NAME")
 		}
 
 		if cfg.AccountKey.String() == "" {
-			cfg.AccountKey = options.NewSecretString(os.Getenv("AZURE_ACCOUNT_KEY"))
+			cfg.AccountKey = options.NewSecretString(getenv("AZURE_ACCOUNT_KEY"))
 		}
 
 		if cfg.AccountSAS.String() == "" {
-			cfg.AccountSAS = options.NewSecretString(os.Getenv("AZURE_ACCOUNT_SAS"))
+			cfg.AccountSAS = options.NewSecretString(getenv("AZURE_ACCOUNT_SAS"))
 		}
 
 		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
@@ -638,7 +792,7 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 	case "swift":
 		cfg := loc.Config.(swift.Config)
 
-		if err := swift.ApplyEnvironment("", &cfg); err != nil {
+		if err := swift.ApplyEnvironmentFrom("", &cfg, getenv); err != nil {
 			return nil, err
 		}
 
@@ -653,7 +807,7 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 		cfg := loc.Config.(b2.Config)
 
 		if cfg.AccountID == "" {
-			cfg.AccountID = os.Getenv("B2_ACCOUNT_ID")
+			cfg.AccountID = getenv("B2_ACCOUNT_ID")
 		}
 
 		if cfg.AccountID == "" {
@@ -661,7 +815,7 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 		}
 
 		if cfg.Key.String() == "" {
-			cfg.Key = options.NewSecretString(os.Getenv("B2_ACCOUNT_KEY"))
+			cfg.Key = options.NewSecretString(getenv("B2_ACCOUNT_KEY"))
 		}
 
 		if cfg.Key.String() == "" {
@@ -695,6 +849,43 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 	return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
 }
 
+// transportOptions returns the options for the HTTP transport of the backend
+// config cfg.
+func transportOptions(cfg interface{}) backend.TransportOptions {
+	if cfg, ok := cfg.(rest.Config); ok {
+		return cfg.TransportOptions(globalOptions.TransportOptions)
+	}
+	return globalOptions.TransportOptions
+}
+
+// credentialCommands caches the credential commands, so that the command is
+// only run again if the credentials have expired.
+var credentialCommands = struct {
+	sync.Mutex
+	m map[string]*credential.Command
+}{m: make(map[string]*credential.Command)}
+
+// credentialCommand returns the credential command configured in gopts, it is
+// nil if no command is configured.
+func credentialCommand(gopts GlobalOptions) (*credential.Command, error) {
+	if gopts.CredentialCmd == "" {
+		return nil, nil
+	}
+
+	credentialCommands.Lock()
+	defer credentialCommands.Unlock()
+
+	if c, ok := credentialCommands.m[gopts.CredentialCmd]; ok {
+		return c, nil
+	}
+	c, err := credential.NewCommand(gopts.CredentialCmd)
+	if err != nil {
+		return nil, errors.Fatalf("invalid credential command: %v", err)
+	}
+	credentialCommands.m[gopts.CredentialCmd] = c
+	return c, nil
+}
+
 // Open the backend specified by a location config.
 func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
 	debug.Log("parsing location %v", location.StripPassword(s))
@@ -705,12 +896,17 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 
 	var be restic.Backend
 
-	cfg, err := parseConfig(loc, opts)
+	creds, err := credentialCommand(gopts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := parseConfig(loc, opts, creds)
 	if err != nil {
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.TransportOptions)
+	rt, err := backend.Transport(transportOptions(cfg))
 	if err != nil {
 		return nil, err
 	}
@@ -747,6 +943,15 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		return nil, errors.Fatalf("unable to open repository at %v: %v", location.StripPassword(s), err)
 	}
 
+	if rb, ok := be.(*rest.Backend); ok {
+		AddCleanupHandler(func(code int) (int, error) {
+			stats := rb.ConnectionStats()
+			debug.Log("rest backend connections: %+v", stats)
+			Verboseff("REST backend: %d requests opened a new connection, %d reused an idle connection\n", stats.Opened, stats.Reused)
+			return code, nil
+		})
+	}
+
 	// wrap backend if a test specified an inner hook
 	if gopts.backendInnerTestHook != nil {
 		be, err = gopts.backendInnerTestHook(be)
@@ -755,6 +960,8 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		}
 	}
 
+	backendFreeSpace, _ = be.(backend.FreeSpacer)
+
 	if loc.Scheme == "local" || loc.Scheme == "sftp" {
 		// wrap the backend in a LimitBackend so that the throughput is limited
 		be = limiter.LimitBackend(be, lim)
@@ -774,19 +981,24 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 }
 
 // Create the backend specified by URI.
-func create(ctx context.Context, s string, opts options.Options) (restic.Backend, error) {
+func create(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
 	debug.Log("parsing location %v", s)
 	loc, err := location.Parse(s)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg, err := parseConfig(loc, opts)
+	creds, err := credentialCommand(gopts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := parseConfig(loc, opts, creds)
 	if err != nil {
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.TransportOptions)
+	rt, err := backend.Transport(transportOptions(cfg))
 	if err != nil {
 		return nil, err
 	}
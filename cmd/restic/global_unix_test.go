@@ -0,0 +1,66 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sys/unix"
+)
+
+func TestLoadPasswordFromNamedPipe(t *testing.T) {
+	tempDir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	fifo := filepath.Join(tempDir, "password")
+	rtest.OK(t, unix.Mkfifo(fifo, 0600))
+
+	// the writer blocks until the password is read
+	done := make(chan error, 1)
+	go func() {
+		done <- ioutil.WriteFile(fifo, []byte("secret\n"), 0600)
+	}()
+
+	password, err := loadPasswordFromFile(fifo)
+	rtest.OK(t, err)
+	rtest.Equals(t, "secret", password)
+	rtest.OK(t, <-done)
+
+	// the pipe can be used again for the next password
+	go func() {
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			done <- err
+			return
+		}
+		for _, part := range []string{"sec", "ond\n"} {
+			if _, err = f.WriteString(part); err != nil {
+				break
+			}
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		done <- err
+	}()
+
+	password, err = loadPasswordFromFile(fifo)
+	rtest.OK(t, err)
+	rtest.Equals(t, "second", password)
+	rtest.OK(t, <-done)
+
+	// regular files are still supported
+	file := filepath.Join(tempDir, "file")
+	rtest.OK(t, ioutil.WriteFile(file, []byte("regular\n"), 0600))
+	password, err = loadPasswordFromFile(file)
+	rtest.OK(t, err)
+	rtest.Equals(t, "regular", password)
+
+	_, err = loadPasswordFromFile(filepath.Join(tempDir, "missing"))
+	rtest.Assert(t, err != nil, "expected error for a missing password file")
+}
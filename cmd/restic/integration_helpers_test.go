@@ -191,13 +191,14 @@ func withTestEnvironment(t testing.TB) (env *testEnvironment, cleanup func()) {
 	rtest.OK(t, os.MkdirAll(env.repo, 0700))
 
 	env.gopts = GlobalOptions{
-		Repo:     env.repo,
-		Quiet:    true,
-		CacheDir: env.cache,
-		password: rtest.TestPassword,
-		stdout:   os.Stdout,
-		stderr:   os.Stderr,
-		extended: make(options.Options),
+		Repo:             env.repo,
+		Quiet:            true,
+		CacheDir:         env.cache,
+		RetryMaxAttempts: 10,
+		password:         rtest.TestPassword,
+		stdout:           os.Stdout,
+		stderr:           os.Stderr,
+		extended:         make(options.Options),
 
 		// replace this hook with "nil" if listing a filetype more than once is necessary
 		backendTestHook: func(r restic.Backend) (restic.Backend, error) { return newOrderedListOnceBackend(r), nil },
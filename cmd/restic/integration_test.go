@@ -1,6 +1,7 @@
 package main
 
 import (
+	"archive/tar"
 	"bufio"
 	"bytes"
 	"context"
@@ -14,12 +15,17 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/accounting"
+	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
@@ -113,7 +119,7 @@ func testRunRestoreLatest(t testing.TB, gopts GlobalOptions, dir string, paths [
 		},
 	}
 
-	rtest.OK(t, runRestore(context.TODO(), opts, gopts, []string{"latest"}))
+	rtest.OK(t, testRunRestoreAssumeFailure(t, "latest", opts, gopts))
 }
 
 func testRunRestoreExcludes(t testing.TB, gopts GlobalOptions, dir string, snapshotID restic.ID, excludes []string) {
@@ -122,7 +128,7 @@ func testRunRestoreExcludes(t testing.TB, gopts GlobalOptions, dir string, snaps
 		Exclude: excludes,
 	}
 
-	rtest.OK(t, runRestore(context.TODO(), opts, gopts, []string{snapshotID.String()}))
+	rtest.OK(t, testRunRestoreAssumeFailure(t, snapshotID.String(), opts, gopts))
 }
 
 func testRunRestoreIncludes(t testing.TB, gopts GlobalOptions, dir string, snapshotID restic.ID, includes []string) {
@@ -131,13 +137,27 @@ func testRunRestoreIncludes(t testing.TB, gopts GlobalOptions, dir string, snaps
 		Include: includes,
 	}
 
-	rtest.OK(t, runRestore(context.TODO(), opts, gopts, []string{snapshotID.String()}))
+	rtest.OK(t, testRunRestoreAssumeFailure(t, snapshotID.String(), opts, gopts))
 }
 
 func testRunRestoreAssumeFailure(t testing.TB, snapshotID string, opts RestoreOptions, gopts GlobalOptions) error {
-	err := runRestore(context.TODO(), opts, gopts, []string{snapshotID})
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var wg errgroup.Group
+	term := termstatus.New(gopts.stdout, gopts.stderr, gopts.Quiet)
+	wg.Go(func() error { term.Run(ctx); return nil })
+
+	restoreErr := runRestore(ctx, opts, gopts, term, []string{snapshotID})
+
+	cancel()
+
+	err := wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	return err
+	return restoreErr
 }
 
 func testRunCheck(t testing.TB, gopts GlobalOptions) {
@@ -164,7 +184,31 @@ func testRunCheckOutput(gopts GlobalOptions) (string, error) {
 	return buf.String(), err
 }
 
+func testRunScrub(t testing.TB, opts ScrubOptions, gopts GlobalOptions) error {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var wg errgroup.Group
+	term := termstatus.New(gopts.stdout, gopts.stderr, gopts.Quiet)
+	wg.Go(func() error { term.Run(ctx); return nil })
+
+	scrubErr := runScrub(ctx, opts, gopts, term, nil)
+
+	cancel()
+
+	err := wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return scrubErr
+}
+
 func testRunDiffOutput(gopts GlobalOptions, firstSnapshotID string, secondSnapshotID string) (string, error) {
+	return testRunDiffOutputWithOptions(gopts, DiffOptions{}, firstSnapshotID, secondSnapshotID)
+}
+
+func testRunDiffOutputWithOptions(gopts GlobalOptions, opts DiffOptions, firstSnapshotID string, secondSnapshotID string) (string, error) {
 	buf := bytes.NewBuffer(nil)
 
 	globalOptions.stdout = buf
@@ -175,9 +219,6 @@ func testRunDiffOutput(gopts GlobalOptions, firstSnapshotID string, secondSnapsh
 		gopts.stdout = oldStdout
 	}()
 
-	opts := DiffOptions{
-		ShowMetadata: false,
-	}
 	err := runDiff(context.TODO(), opts, gopts, []string{firstSnapshotID, secondSnapshotID})
 	return buf.String(), err
 }
@@ -414,6 +455,136 @@ func TestDryRunBackup(t *testing.T) {
 	rtest.Equals(t, indexIDs, indexIDsAfter)
 }
 
+func TestBackupJSONLog(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	logfile := filepath.Join(env.base, "backup.json")
+	opts := BackupOptions{JSONLog: logfile}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	buf, err := ioutil.ReadFile(logfile)
+	rtest.OK(t, err)
+
+	var summary bool
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		var msg struct {
+			MessageType string `json:"message_type"`
+			SnapshotID  string `json:"snapshot_id"`
+		}
+		rtest.OK(t, json.Unmarshal([]byte(line), &msg))
+		if msg.MessageType == "summary" {
+			summary = true
+			rtest.Assert(t, msg.SnapshotID != "", "summary without snapshot ID")
+		}
+	}
+	rtest.Assert(t, summary, "no summary in JSON log:\n%s", buf)
+}
+
+func TestBackupExportManifest(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "manifestdata")
+	rtest.OK(t, os.MkdirAll(filepath.Join(datadir, "sub"), 0755))
+	same := rtest.Random(23, 5000)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "a"), same, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "sub", "b"), same, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "c"), []byte("other"), 0644))
+
+	manifest := filepath.Join(env.base, "manifest.json")
+	opts := BackupOptions{ExportManifest: manifest}
+	testRunBackup(t, env.base, []string{"manifestdata"}, opts, env.gopts)
+
+	buf, err := ioutil.ReadFile(manifest)
+	rtest.OK(t, err)
+	entries := make(map[string]manifestEntry)
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		var entry manifestEntry
+		rtest.OK(t, json.Unmarshal([]byte(line), &entry))
+		entries[entry.Path] = entry
+	}
+
+	rtest.Equals(t, 3, len(entries))
+	a, b, c := entries["/manifestdata/a"], entries["/manifestdata/sub/b"], entries["/manifestdata/c"]
+	rtest.Equals(t, uint64(len(same)), a.Size)
+	rtest.Equals(t, uint64(5), c.Size)
+	rtest.Assert(t, a.Hash == b.Hash, "files with the same content have different hashes %v and %v", a.Hash, b.Hash)
+	rtest.Assert(t, a.Hash != c.Hash, "files with different content have the same hash %v", a.Hash)
+}
+
+func testRunVerifySignatures(t testing.TB, gopts GlobalOptions, opts VerifySignaturesOptions) ([]signatureStatusJSON, error) {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+
+	err := runVerifySignatures(context.TODO(), opts, gopts, nil)
+	var results []signatureStatusJSON
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &results))
+	return results, err
+}
+
+func TestBackupSignCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the sign and verify commands require a shell")
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testSetupBackupData(t, env)
+
+	// the "signature" is the hash of the snapshot, the verify command gets
+	// the signature and the snapshot file as $0 and $1
+	signCommand := "sh -c sha256sum"
+	verifyCommand := `sh -c '[ "$(sha256sum < "$1")" = "$(cat "$0")" ]'`
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{SignCommand: signCommand}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 2, len(snapshotIDs))
+	rtest.Equals(t, 1, len(testRunList(t, "signatures", env.gopts)))
+
+	results, err := testRunVerifySignatures(t, env.gopts, VerifySignaturesOptions{VerifyCommand: verifyCommand})
+	rtest.OK(t, err)
+	status := make(map[string]int)
+	for _, res := range results {
+		status[res.Status]++
+	}
+	rtest.Equals(t, map[string]int{signatureValid: 1, signatureUnsigned: 1}, status)
+
+	_, err = testRunVerifySignatures(t, env.gopts, VerifySignaturesOptions{VerifyCommand: verifyCommand, RequireSignature: true})
+	rtest.Assert(t, err != nil, "unsigned snapshot not reported as an error")
+
+	results, err = testRunVerifySignatures(t, env.gopts, VerifySignaturesOptions{VerifyCommand: "false"})
+	rtest.Assert(t, err != nil, "invalid signature not reported as an error")
+	status = make(map[string]int)
+	for _, res := range results {
+		status[res.Status]++
+	}
+	rtest.Equals(t, map[string]int{signatureInvalid: 1, signatureUnsigned: 1}, status)
+
+	// changing the tags replaces the signed snapshot, prune removes the
+	// signature left behind but keeps that of the new snapshot
+	testRunTag(t, TagOptions{AddTags: restic.TagLists{[]string{"foo"}}}, env.gopts)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{SignCommand: signCommand}, env.gopts)
+	rtest.Equals(t, 2, len(testRunList(t, "signatures", env.gopts)))
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "5%"})
+	rtest.Equals(t, 1, len(testRunList(t, "signatures", env.gopts)))
+
+	results, err = testRunVerifySignatures(t, env.gopts, VerifySignaturesOptions{VerifyCommand: verifyCommand})
+	rtest.OK(t, err)
+	status = make(map[string]int)
+	for _, res := range results {
+		status[res.Status]++
+	}
+	rtest.Equals(t, map[string]int{signatureValid: 1, signatureUnsigned: 2}, status)
+}
+
 func TestBackupNonExistingFile(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -624,6 +795,58 @@ func TestBackupExclude(t *testing.T) {
 		"expected file %q not in first snapshot, but it's included", "passwords.txt")
 }
 
+func TestLsJSONDirectorySize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	for name, size := range map[string]int{"a": 100, "sub/b": 200, "sub/deeper/c": 300} {
+		p := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, ioutil.WriteFile(p, make([]byte, size), 0644))
+	}
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "empty"), 0755))
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.stdout = buf
+	gopts.JSON = true
+	opts := LsOptions{ListLong: true, Recursive: true}
+	rtest.OK(t, runLs(context.TODO(), opts, gopts, []string{snapshotIDs[0].String()}))
+
+	sizes := make(map[string]uint64)
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var node struct {
+			Path       string  `json:"path"`
+			Type       string  `json:"type"`
+			Size       *uint64 `json:"size"`
+			StructType string  `json:"struct_type"`
+		}
+		rtest.OK(t, dec.Decode(&node))
+		if node.StructType != "node" {
+			continue
+		}
+		rtest.Assert(t, node.Size != nil, "node %v has no size", node.Path)
+		sizes[node.Path] = *node.Size
+	}
+
+	for path, size := range map[string]uint64{
+		"/testdata":              600,
+		"/testdata/a":            100,
+		"/testdata/empty":        0,
+		"/testdata/sub":          500,
+		"/testdata/sub/deeper":   300,
+		"/testdata/sub/deeper/c": 300,
+	} {
+		rtest.Assert(t, sizes[path] == size, "wrong size for %v, want %v, got %v", path, size, sizes[path])
+	}
+}
+
 func TestBackupErrors(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		return
@@ -656,6 +879,187 @@ const (
 	incrementalThirdWrite  = 1 * 1042 * 1024
 )
 
+func testRunAnalyze(t testing.TB, gopts GlobalOptions, files ...string) []analyzeResult {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+	rtest.OK(t, runAnalyze(context.TODO(), gopts, files))
+
+	var results []analyzeResult
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &results))
+	return results
+}
+
+func TestAnalyze(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	stored := filepath.Join(env.testdata, "stored")
+	rtest.OK(t, appendRandomData(stored, 8*1024*1024))
+	testRunBackup(t, "", []string{stored}, BackupOptions{}, env.gopts)
+
+	results := testRunAnalyze(t, env.gopts, stored)
+	rtest.Equals(t, 1, len(results))
+	res := results[0]
+	rtest.Equals(t, uint64(8*1024*1024), res.Size)
+	rtest.Assert(t, res.Chunks > 0, "no chunks found")
+	rtest.Equals(t, res.Chunks, res.ExistingChunks)
+	rtest.Equals(t, 0, res.NewChunks)
+	rtest.Equals(t, 1.0, res.DedupRatio)
+
+	// a file which only consists of new data
+	fresh := filepath.Join(env.testdata, "fresh")
+	rtest.OK(t, appendRandomData(fresh, 4*1024*1024))
+	res = testRunAnalyze(t, env.gopts, fresh)[0]
+	rtest.Equals(t, 0, res.ExistingChunks)
+	rtest.Equals(t, res.Size, res.NewBytes)
+	rtest.Equals(t, 0.0, res.DedupRatio)
+
+	err := runAnalyze(context.TODO(), env.gopts, []string{filepath.Join(env.testdata, "missing")})
+	rtest.Assert(t, err != nil, "expected error for a missing file")
+}
+
+func testRunDryrunDiff(t testing.TB, gopts GlobalOptions, opts DryrunDiffOptions, args ...string) (map[string]string, LiveDiffStats) {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+	// quiet suppresses the list of changes
+	gopts.Quiet = false
+	rtest.OK(t, runDryrunDiff(context.TODO(), opts, gopts, args))
+
+	// the statistics are printed as the last line
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	changes := make(map[string]string)
+	for _, line := range lines[:len(lines)-1] {
+		var change Change
+		rtest.OK(t, json.Unmarshal([]byte(line), &change))
+		changes[change.Path] = change.Modifier
+	}
+	var stats LiveDiffStats
+	rtest.OK(t, json.Unmarshal([]byte(lines[len(lines)-1]), &stats))
+	return changes, stats
+}
+
+func TestDryrunDiff(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	dir := filepath.Join(env.testdata, "dir")
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "sub"), 0700))
+	for _, name := range []string{"modified", "removed", "touched", "sub/unchanged"} {
+		rtest.OK(t, appendRandomData(filepath.Join(dir, name), 1024))
+	}
+	testRunBackup(t, "", []string{dir}, BackupOptions{}, env.gopts)
+
+	rtest.OK(t, appendRandomData(filepath.Join(dir, "modified"), 100))
+	rtest.OK(t, os.Remove(filepath.Join(dir, "removed")))
+	rtest.OK(t, appendRandomData(filepath.Join(dir, "added"), 2048))
+	mtime := time.Now().Add(time.Hour)
+	rtest.OK(t, os.Chtimes(filepath.Join(dir, "touched"), mtime, mtime))
+
+	snPath := "/" + strings.Join(archiver.SnapshotPath(fs.Local{}, dir), "/")
+
+	changes, stats := testRunDryrunDiff(t, env.gopts, DryrunDiffOptions{}, "latest", dir)
+	rtest.Equals(t, map[string]string{
+		snPath + "/added":    "+",
+		snPath + "/modified": "M",
+		snPath + "/removed":  "-",
+		snPath + "/touched":  "M",
+	}, changes)
+	rtest.Equals(t, 1, stats.Added)
+	rtest.Equals(t, 1, stats.Removed)
+	rtest.Equals(t, 2, stats.Changed)
+	rtest.Equals(t, uint64(2048+1124+1024), stats.ChangedBytes)
+
+	// reading the contents detects that only the metadata of touched changed
+	changes, stats = testRunDryrunDiff(t, env.gopts, DryrunDiffOptions{ReadContent: true}, "latest", dir)
+	rtest.Equals(t, "U", changes[snPath+"/touched"])
+	rtest.Equals(t, "M", changes[snPath+"/modified"])
+	rtest.Equals(t, 1, stats.Changed)
+	rtest.Equals(t, 1, stats.MetadataOnly)
+	rtest.Equals(t, uint64(2048+1124), stats.ChangedBytes)
+
+	err := runDryrunDiff(context.TODO(), DryrunDiffOptions{}, env.gopts, []string{"latest"})
+	rtest.Assert(t, err != nil, "expected error without a path")
+}
+
+func testRunVerify(t testing.TB, gopts GlobalOptions, opts VerifyOptions, args ...string) (map[string]string, LiveDiffStats, error) {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+	gopts.Quiet = false
+	err := runVerify(context.TODO(), opts, gopts, args)
+
+	// the statistics are printed as the last line
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	changes := make(map[string]string)
+	for _, line := range lines[:len(lines)-1] {
+		var change Change
+		rtest.OK(t, json.Unmarshal([]byte(line), &change))
+		changes[change.Path] = change.Modifier
+	}
+	var stats LiveDiffStats
+	rtest.OK(t, json.Unmarshal([]byte(lines[len(lines)-1]), &stats))
+	return changes, stats, err
+}
+
+func TestVerify(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	dir := filepath.Join(env.testdata, "dir")
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "sub"), 0700))
+	for _, name := range []string{"modified", "removed", "sub/unchanged"} {
+		rtest.OK(t, appendRandomData(filepath.Join(dir, name), 1024))
+	}
+	testRunBackup(t, "", []string{dir}, BackupOptions{}, env.gopts)
+
+	target := filepath.Join(env.base, "restore")
+	testRunRestoreLatest(t, env.gopts, target, nil, nil)
+
+	changes, _, err := testRunVerify(t, env.gopts, VerifyOptions{}, "latest", target)
+	rtest.OK(t, err)
+	rtest.Equals(t, map[string]string{}, changes)
+
+	pc := archiver.SnapshotPath(fs.Local{}, dir)
+	snPath := "/" + strings.Join(pc, "/")
+	restored := filepath.Join(append([]string{target}, pc...)...)
+
+	// change the contents of a file without changing its size or modification time
+	fi, err := os.Stat(filepath.Join(restored, "modified"))
+	rtest.OK(t, err)
+	f, err := os.OpenFile(filepath.Join(restored, "modified"), os.O_WRONLY, 0)
+	rtest.OK(t, err)
+	_, err = f.WriteAt([]byte("changed"), 100)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	rtest.OK(t, os.Chtimes(filepath.Join(restored, "modified"), fi.ModTime(), fi.ModTime()))
+	rtest.OK(t, os.Remove(filepath.Join(restored, "removed")))
+	rtest.OK(t, appendRandomData(filepath.Join(restored, "sub", "added"), 10))
+
+	changes, stats, err := testRunVerify(t, env.gopts, VerifyOptions{}, "latest", target)
+	rtest.Assert(t, err != nil, "expected error for differences")
+	rtest.Equals(t, "M", changes[snPath+"/modified"])
+	rtest.Equals(t, "-", changes[snPath+"/removed"])
+	rtest.Equals(t, "+", changes[snPath+"/sub/added"])
+	rtest.Equals(t, 1, stats.Added)
+	rtest.Equals(t, 1, stats.Removed)
+	rtest.Equals(t, 1, stats.Changed)
+
+	// the modified file is only detected by reading its contents
+	changes, stats, err = testRunVerify(t, env.gopts, VerifyOptions{MetadataOnly: true}, "latest", target)
+	rtest.Assert(t, err != nil, "expected error for differences")
+	_, ok := changes[snPath+"/modified"]
+	rtest.Assert(t, !ok, "modified file reported with --metadata-only")
+	rtest.Equals(t, 0, stats.Changed)
+
+	err = runVerify(context.TODO(), VerifyOptions{}, env.gopts, []string{"latest"})
+	rtest.Assert(t, err != nil, "expected error without a directory")
+}
+
 func appendRandomData(filename string, bytes uint) error {
 	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
@@ -751,105 +1155,402 @@ func TestBackupTags(t *testing.T) {
 		"expected parent to be %v, got %v", parent.ID, newest.Parent)
 }
 
-func testRunCopy(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions) {
-	gopts := srcGopts
-	gopts.Repo = dstGopts.Repo
-	gopts.password = dstGopts.password
-	copyOpts := CopyOptions{
-		secondaryRepoOptions: secondaryRepoOptions{
-			Repo:     srcGopts.Repo,
-			password: srcGopts.password,
-		},
+func TestBackupTagTemplates(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{
+		Host:      "example",
+		TimeStamp: "2021-03-07 14:05:09",
+		Tags:      restic.TagLists{[]string{"host-{host}-{date:2006-01-02}", "{{literal}}"}},
+	}
+
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	newest, _ := testRunSnapshots(t, env.gopts)
+	if newest == nil {
+		t.Fatal("expected a backup, got nil")
 	}
 
-	rtest.OK(t, runCopy(context.TODO(), copyOpts, gopts, nil))
+	rtest.Equals(t, restic.TagList{"host-example-2021-03-07", "{literal}"}, restic.TagList(newest.Tags))
+
+	opts.Tags = restic.TagLists{[]string{"{unknown}"}}
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for invalid tag template")
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
 }
 
-func TestCopy(t *testing.T) {
+func testRunSnapshotsSize(t testing.TB, gopts GlobalOptions) []Snapshot {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+
+	opts := SnapshotOptions{Size: true}
+	rtest.OK(t, runSnapshots(context.TODO(), opts, gopts, []string{}))
+
+	snapshots := []Snapshot{}
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &snapshots))
+	return snapshots
+}
+
+func TestSnapshotsSize(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
-	env2, cleanup2 := withTestEnvironment(t)
-	defer cleanup2()
 
-	testSetupBackupData(t, env)
-	opts := BackupOptions{}
-	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
-	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
-	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env.gopts)
-	testRunCheck(t, env.gopts)
+	testRunInit(t, env.gopts)
 
-	testRunInit(t, env2.gopts)
-	testRunCopy(t, env.gopts, env2.gopts)
+	// two files with the same content, which is only stored once
+	data := rtest.Random(23, 100*1024)
+	rtest.OK(t, os.MkdirAll(env.testdata, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "foo"), data, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "bar"), data, 0644))
 
-	snapshotIDs := testRunList(t, "snapshots", env.gopts)
-	copiedSnapshotIDs := testRunList(t, "snapshots", env2.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
 
-	// Check that the copies size seems reasonable
-	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "expected %v snapshots, found %v",
-		len(snapshotIDs), len(copiedSnapshotIDs))
-	stat := dirStats(env.repo)
-	stat2 := dirStats(env2.repo)
-	sizeDiff := int64(stat.size) - int64(stat2.size)
-	if sizeDiff < 0 {
-		sizeDiff = -sizeDiff
-	}
-	rtest.Assert(t, sizeDiff < int64(stat.size)/50, "expected less than 2%% size difference: %v vs. %v",
-		stat.size, stat2.size)
+	snapshots := testRunSnapshotsSize(t, env.gopts)
+	rtest.Equals(t, 1, len(snapshots))
+	size := snapshots[0].Size
+	rtest.Assert(t, size != nil, "snapshot size missing")
+	rtest.Equals(t, uint64(2), size.Files)
+	rtest.Equals(t, uint64(2*len(data)), size.Total)
+	rtest.Assert(t, size.Unique > uint64(len(data)) && size.Unique < size.Total,
+		"unexpected unique size %d for total size %d", size.Unique, size.Total)
+
+	// the sizes are cached
+	files, err := filepath.Glob(filepath.Join(env.cache, "*", treeSizesFile))
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(files))
 
-	// Check integrity of the copy
-	testRunCheck(t, env2.gopts)
+	sizes := loadTreeSizes(files[0])
+	rtest.Equals(t, *size, sizes[snapshots[0].Tree.String()])
 
-	// Check that the copied snapshots have the same tree contents as the old ones (= identical tree hash)
-	origRestores := make(map[string]struct{})
-	for i, snapshotID := range snapshotIDs {
-		restoredir := filepath.Join(env.base, fmt.Sprintf("restore%d", i))
-		origRestores[restoredir] = struct{}{}
-		testRunRestore(t, env.gopts, restoredir, snapshotID)
-	}
-	for i, snapshotID := range copiedSnapshotIDs {
-		restoredir := filepath.Join(env2.base, fmt.Sprintf("restore%d", i))
-		testRunRestore(t, env2.gopts, restoredir, snapshotID)
-		foundMatch := false
-		for cmpdir := range origRestores {
-			diff := directoriesContentsDiff(restoredir, cmpdir)
-			if diff == "" {
-				delete(origRestores, cmpdir)
-				foundMatch = true
-			}
-		}
+	// a cached size is used as is
+	sizes[snapshots[0].Tree.String()] = snapshotSize{Total: 42}
+	rtest.OK(t, saveTreeSizes(files[0], sizes))
+	snapshots = testRunSnapshotsSize(t, env.gopts)
+	rtest.Equals(t, uint64(42), snapshots[0].Size.Total)
 
-		rtest.Assert(t, foundMatch, "found no counterpart for snapshot %v", snapshotID)
+	// without --size, no sizes are printed
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	for _, sn := range snapmap {
+		rtest.Assert(t, sn.Size == nil, "unexpected size for snapshot %v", sn.ShortID)
 	}
-
-	rtest.Assert(t, len(origRestores) == 0, "found not copied snapshots")
 }
 
-func TestCopyIncremental(t *testing.T) {
+func TestBackupMetadata(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
-	env2, cleanup2 := withTestEnvironment(t)
-	defer cleanup2()
 
 	testSetupBackupData(t, env)
-	opts := BackupOptions{}
-	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
-	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	opts := BackupOptions{Meta: []string{"ticket=OPS-17", "owner=db team"}}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	opts.Meta = []string{"ticket=OPS-18"}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
 	testRunCheck(t, env.gopts)
 
-	testRunInit(t, env2.gopts)
-	testRunCopy(t, env.gopts, env2.gopts)
+	_, snapshots := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, len(snapshots) == 2, "expected two snapshots, got %v", len(snapshots))
+	var first restic.ID
+	for id, sn := range snapshots {
+		if sn.Metadata["ticket"] == "OPS-17" {
+			first = id
+			rtest.Equals(t, map[string]string{"ticket": "OPS-17", "owner": "db team"}, sn.Metadata)
+		}
+	}
+	rtest.Assert(t, !first.IsNull(), "snapshot with metadata ticket=OPS-17 not found")
 
+	opts.Meta = []string{"invalid"}
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for invalid metadata")
+
+	// only the snapshot with the metadata is considered, it has no tag "none"
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Meta: []string{"owner"}, KeepTags: restic.TagLists{{"none"}}}, env.gopts, nil))
 	snapshotIDs := testRunList(t, "snapshots", env.gopts)
-	copiedSnapshotIDs := testRunList(t, "snapshots", env2.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	rtest.Assert(t, !snapshotIDs[0].Equal(first), "snapshot with metadata owner was not removed")
 
-	// Check that the copies size seems reasonable
-	testRunCheck(t, env2.gopts)
-	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "expected %v snapshots, found %v",
-		len(snapshotIDs), len(copiedSnapshotIDs))
+	err = runForget(context.TODO(), ForgetOptions{Meta: []string{"owner"}}, env.gopts, []string{snapshotIDs[0].String()})
+	rtest.Assert(t, err != nil, "expected error for --meta with explicit snapshot IDs")
+}
 
-	// check that no snapshots are copied, as there are no new ones
-	testRunCopy(t, env.gopts, env2.gopts)
-	testRunCheck(t, env2.gopts)
+func TestBackupResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{Resume: true}
+
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	// the checkpoint is removed after a successful backup
+	matches, err := filepath.Glob(filepath.Join(env.cache, "*", "backup-checkpoint-*"))
+	rtest.OK(t, err)
+	rtest.Assert(t, len(matches) == 0, "checkpoint was not removed: %v", matches)
+
+	opts.Stdin = true
+	err = testRunBackupAssumeFailure(t, "", nil, opts, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for --resume with --stdin")
+}
+
+// testRunBackupStdin saves data read from stdin as filename and returns the
+// summary of the backup.
+func testRunBackupStdin(t testing.TB, data []byte, filename string, gopts GlobalOptions) (summary struct {
+	FilesChanged     uint              `json:"files_changed"`
+	ReusedFileBlobs  uint64            `json:"reused_file_blobs"`
+	ParentReuseRatio float64           `json:"parent_reuse_ratio"`
+	Backend          *accounting.Stats `json:"backend"`
+}) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	f, err := os.Create(filepath.Join(tempdir, "stdin"))
+	rtest.OK(t, err)
+	defer func() { _ = f.Close() }()
+	_, err = f.Write(data)
+	rtest.OK(t, err)
+	_, err = f.Seek(0, 0)
+	rtest.OK(t, err)
+
+	oldStdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = oldStdin }()
+
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+	testRunBackup(t, "", nil, BackupOptions{Stdin: true, StdinFilename: filename}, gopts)
+
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var sniffer typeSniffer
+		rtest.OK(t, json.Unmarshal(scanner.Bytes(), &sniffer))
+		if sniffer.MessageType == "summary" {
+			rtest.OK(t, json.Unmarshal(scanner.Bytes(), &summary))
+			return summary
+		}
+	}
+	t.Fatalf("no summary found in output %q", buf.String())
+	return summary
+}
+
+func TestBackupStdinParent(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	data := rtest.Random(23, 16*1024*1024)
+	summary := testRunBackupStdin(t, data, "db.sql", env.gopts)
+	rtest.Equals(t, uint(0), summary.FilesChanged)
+
+	// a stream with a different name has no parent
+	summary = testRunBackupStdin(t, data, "other.sql", env.gopts)
+	rtest.Equals(t, uint(0), summary.FilesChanged)
+
+	// change a few bytes in the middle, most chunks are reused from the parent
+	copy(data[8*1024*1024:], "modified")
+	summary = testRunBackupStdin(t, data, "db.sql", env.gopts)
+	rtest.Equals(t, uint(1), summary.FilesChanged)
+	rtest.Assert(t, summary.ReusedFileBlobs > 0 && summary.ParentReuseRatio > 0.5 && summary.ParentReuseRatio < 1,
+		"unexpected reuse of the parent, %v blobs, ratio %v", summary.ReusedFileBlobs, summary.ParentReuseRatio)
+}
+
+func TestBackupBackendStats(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	// random data is not compressible, all of it is uploaded
+	data := rtest.Random(23, 4*1024*1024)
+	summary := testRunBackupStdin(t, data, "db.sql", env.gopts)
+	rtest.Assert(t, summary.Backend != nil, "summary contains no backend counters")
+	rtest.Assert(t, summary.Backend.Save.Requests > 0 && summary.Backend.Save.Bytes > uint64(len(data)),
+		"unexpected uploads: %+v", summary.Backend.Save)
+	rtest.Assert(t, summary.Backend.Load.Requests > 0, "no download requests: %+v", summary.Backend.Load)
+	rtest.Assert(t, summary.Backend.List.Requests > 0, "no list requests: %+v", summary.Backend.List)
+}
+
+func testRunCopy(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions) {
+	gopts := srcGopts
+	gopts.Repo = dstGopts.Repo
+	gopts.password = dstGopts.password
+	copyOpts := CopyOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			Repo:     srcGopts.Repo,
+			password: srcGopts.password,
+		},
+	}
+
+	rtest.OK(t, testRunCopyWithOptions(copyOpts, gopts))
+}
+
+func testRunCopyWithOptions(opts CopyOptions, gopts GlobalOptions) error {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var wg errgroup.Group
+	term := termstatus.New(gopts.stdout, gopts.stderr, gopts.Quiet)
+	wg.Go(func() error { term.Run(ctx); return nil })
+
+	copyErr := runCopy(ctx, opts, gopts, term, nil)
+
+	cancel()
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+	return copyErr
+}
+
+func TestCopy(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	testRunInit(t, env2.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	copiedSnapshotIDs := testRunList(t, "snapshots", env2.gopts)
+
+	// Check that the copies size seems reasonable
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "expected %v snapshots, found %v",
+		len(snapshotIDs), len(copiedSnapshotIDs))
+	stat := dirStats(env.repo)
+	stat2 := dirStats(env2.repo)
+	sizeDiff := int64(stat.size) - int64(stat2.size)
+	if sizeDiff < 0 {
+		sizeDiff = -sizeDiff
+	}
+	rtest.Assert(t, sizeDiff < int64(stat.size)/50, "expected less than 2%% size difference: %v vs. %v",
+		stat.size, stat2.size)
+
+	// Check integrity of the copy
+	testRunCheck(t, env2.gopts)
+
+	// Check that the copied snapshots have the same tree contents as the old ones (= identical tree hash)
+	origRestores := make(map[string]struct{})
+	for i, snapshotID := range snapshotIDs {
+		restoredir := filepath.Join(env.base, fmt.Sprintf("restore%d", i))
+		origRestores[restoredir] = struct{}{}
+		testRunRestore(t, env.gopts, restoredir, snapshotID)
+	}
+	for i, snapshotID := range copiedSnapshotIDs {
+		restoredir := filepath.Join(env2.base, fmt.Sprintf("restore%d", i))
+		testRunRestore(t, env2.gopts, restoredir, snapshotID)
+		foundMatch := false
+		for cmpdir := range origRestores {
+			diff := directoriesContentsDiff(restoredir, cmpdir)
+			if diff == "" {
+				delete(origRestores, cmpdir)
+				foundMatch = true
+			}
+		}
+
+		rtest.Assert(t, foundMatch, "found no counterpart for snapshot %v", snapshotID)
+	}
+
+	rtest.Assert(t, len(origRestores) == 0, "found not copied snapshots")
+}
+
+type testCopySummary struct {
+	MessageType     string `json:"message_type"`
+	SnapshotsCopied uint   `json:"snapshots_copied"`
+	BlobsCopied     uint64 `json:"blobs_copied"`
+	ExistingBlobs   uint64 `json:"existing_blobs"`
+}
+
+func testRunCopySummary(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions) testCopySummary {
+	buf := bytes.NewBuffer(nil)
+	gopts := srcGopts
+	gopts.Repo = dstGopts.Repo
+	gopts.password = dstGopts.password
+	gopts.JSON = true
+	gopts.stdout = buf
+	copyOpts := CopyOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			Repo:     srcGopts.Repo,
+			password: srcGopts.password,
+		},
+	}
+	rtest.OK(t, testRunCopyWithOptions(copyOpts, gopts))
+
+	var summary testCopySummary
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var msg testCopySummary
+		rtest.OK(t, json.Unmarshal([]byte(line), &msg))
+		if msg.MessageType == "summary" {
+			summary = msg
+		}
+	}
+	rtest.Equals(t, "summary", summary.MessageType)
+	return summary
+}
+
+func TestCopyProgressResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	testRunInit(t, env2.gopts)
+
+	summary := testRunCopySummary(t, env.gopts, env2.gopts)
+	rtest.Equals(t, uint(1), summary.SnapshotsCopied)
+	rtest.Assert(t, summary.BlobsCopied > 0, "expected blobs to be copied")
+	rtest.Equals(t, uint64(0), summary.ExistingBlobs)
+	copied := summary.BlobsCopied
+
+	// simulate an interrupted copy, the data is present but the snapshot is missing
+	for _, id := range testRunList(t, "snapshots", env2.gopts) {
+		rtest.OK(t, os.Remove(filepath.Join(env2.repo, "snapshots", id.String())))
+	}
+
+	summary = testRunCopySummary(t, env.gopts, env2.gopts)
+	rtest.Equals(t, uint(1), summary.SnapshotsCopied)
+	rtest.Equals(t, uint64(0), summary.BlobsCopied)
+	rtest.Equals(t, copied, summary.ExistingBlobs)
+	testRunCheck(t, env2.gopts)
+}
+
+func TestCopyIncremental(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	testRunInit(t, env2.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	copiedSnapshotIDs := testRunList(t, "snapshots", env2.gopts)
+
+	// Check that the copies size seems reasonable
+	testRunCheck(t, env2.gopts)
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "expected %v snapshots, found %v",
+		len(snapshotIDs), len(copiedSnapshotIDs))
+
+	// check that no snapshots are copied, as there are no new ones
+	testRunCopy(t, env.gopts, env2.gopts)
+	testRunCheck(t, env2.gopts)
 	copiedSnapshotIDs = testRunList(t, "snapshots", env2.gopts)
 	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "still expected %v snapshots, found %v",
 		len(snapshotIDs), len(copiedSnapshotIDs))
@@ -920,6 +1621,184 @@ func TestInitCopyChunkerParams(t *testing.T) {
 		otherRepo.Config().ChunkerPolynomial)
 }
 
+func TestBackupAlsoRepo(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	initOpts := InitOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			Repo:     env.gopts.Repo,
+			password: env.gopts.password,
+		},
+		CopyChunkerParameters: true,
+	}
+	rtest.OK(t, runInit(context.TODO(), initOpts, env2.gopts, nil))
+
+	opts := BackupOptions{AlsoRepo: []string{env2.gopts.Repo}}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+	testRunCheck(t, env2.gopts)
+
+	for _, gopts := range []GlobalOptions{env.gopts, env2.gopts} {
+		snapshotIDs := testRunList(t, "snapshots", gopts)
+		rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	}
+	// the snapshot of the second repository contains the same files
+	testRunRestoreLatest(t, env2.gopts, filepath.Join(env.base, "restore"), nil, nil)
+	diff := directoriesContentsDiff(filepath.Join(env.testdata, "0", "0", "9"),
+		filepath.Join(env.base, "restore", env.testdata, "0", "0", "9"))
+	rtest.Assert(t, diff == "", "directories are not equal: %v", diff)
+
+	// a repository with different chunker parameters is rejected
+	env3, cleanup3 := withTestEnvironment(t)
+	defer cleanup3()
+	testRunInit(t, env3.gopts)
+	opts = BackupOptions{AlsoRepo: []string{env3.gopts.Repo}}
+	err := testRunBackupAssumeFailure(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.Assert(t, err != nil, "expected backup to a repository with different chunker parameters to fail")
+}
+
+func TestInitChunkSize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+
+	rtest.Assert(t, runInit(context.TODO(), InitOptions{ChunkSize: "3M"}, env.gopts, nil) != nil,
+		"expected invalid chunk size to fail")
+	rtest.OK(t, runInit(context.TODO(), InitOptions{ChunkSize: "4M"}, env.gopts, nil))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(4*1024*1024), repo.Config().AverageChunkSize())
+	rtest.Equals(t, uint(restic.ChunkerSizesRepoVersion), repo.Config().Version)
+
+	err = runInit(context.TODO(), InitOptions{ChunkSize: "2M"}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected changing the chunk size of an existing repository to fail")
+
+	rtest.SetupTarTestFixture(t, env.testdata, filepath.Join("testdata", "backup-data.tar.gz"))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+}
+
+func TestInitLatestRepoVersion(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+
+	for _, test := range []struct {
+		version  string
+		expected uint
+	}{
+		{"latest", restic.LatestRepoVersion},
+		{"3", restic.ChunkerSizesRepoVersion},
+	} {
+		t.Run(test.version, func(t *testing.T) {
+			env, cleanup := withTestEnvironment(t)
+			defer cleanup()
+
+			rtest.OK(t, runInit(context.TODO(), InitOptions{RepositoryVersion: test.version}, env.gopts, nil))
+			repo, err := OpenRepository(context.TODO(), env.gopts)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.expected, repo.Config().Version)
+		})
+	}
+}
+
+func TestInitDefaultPackSize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+
+	// the size in bytes overflows to zero
+	overflow := ^uint(0)/1024/1024 + 1
+	rtest.Assert(t, runInit(context.TODO(), InitOptions{DefaultPackSize: overflow}, env.gopts, nil) != nil,
+		"expected a pack size of %v MiB to fail", overflow)
+	rtest.Assert(t, runInit(context.TODO(), InitOptions{DefaultPackSize: 1}, env.gopts, nil) != nil,
+		"expected a pack size below the minimum to fail")
+	rtest.OK(t, runInit(context.TODO(), InitOptions{DefaultPackSize: 32}, env.gopts, nil))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(32*1024*1024), repo.Config().PackSize)
+}
+
+func testRunRepairSnapshots(t testing.TB, opts RepairSnapshotsOptions, gopts GlobalOptions) {
+	rtest.OK(t, runRepairSnapshots(context.TODO(), opts, gopts, nil))
+}
+
+// testListSnapshotsByTime returns all snapshots sorted from old to new.
+func testListSnapshotsByTime(t testing.TB, gopts GlobalOptions) []Snapshot {
+	_, snapmap := testRunSnapshots(t, gopts)
+	var list []Snapshot
+	for _, sn := range snapmap {
+		list = append(list, sn)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	return list
+}
+
+func TestRepairSnapshotsFixParents(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	for i := 0; i < 4; i++ {
+		testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	}
+	list := testListSnapshotsByTime(t, env.gopts)
+	rtest.Equals(t, 4, len(list))
+	for i := 1; i < len(list); i++ {
+		rtest.Assert(t, list[i].Parent != nil && list[i].Parent.Equal(*list[i-1].ID),
+			"snapshot %d has the wrong parent %v", i, list[i].Parent)
+	}
+
+	// remove the second snapshot, the parent of the third is then missing
+	testRunForget(t, env.gopts, list[1].ID.String())
+
+	opts := RepairSnapshotsOptions{FixParents: true, Relink: true, DryRun: true}
+	testRunRepairSnapshots(t, opts, env.gopts)
+	rtest.Equals(t, []Snapshot{list[0], list[2], list[3]}, testListSnapshotsByTime(t, env.gopts))
+
+	// the parent is replaced by the first snapshot, the fourth snapshot
+	// then references the new version of the third
+	opts.DryRun = false
+	testRunRepairSnapshots(t, opts, env.gopts)
+	repaired := testListSnapshotsByTime(t, env.gopts)
+	rtest.Equals(t, 3, len(repaired))
+	rtest.Equals(t, *list[0].ID, *repaired[0].ID)
+	rtest.Equals(t, *list[0].ID, *repaired[1].Parent)
+	rtest.Equals(t, *list[2].ID, *repaired[1].Original)
+	rtest.Equals(t, *repaired[1].ID, *repaired[2].Parent)
+	rtest.Equals(t, *list[3].ID, *repaired[2].Original)
+	// the blobs of the removed snapshot are unused, so only run the
+	// default checks
+	_, err := testRunCheckOutput(env.gopts)
+	rtest.OK(t, err)
+
+	// without an older snapshot, the parent is removed
+	testRunForget(t, env.gopts, repaired[0].ID.String())
+	testRunRepairSnapshots(t, opts, env.gopts)
+	repaired = testListSnapshotsByTime(t, env.gopts)
+	rtest.Equals(t, 2, len(repaired))
+	rtest.Assert(t, repaired[0].Parent == nil, "unexpected parent %v", repaired[0].Parent)
+	rtest.Equals(t, *repaired[0].ID, *repaired[1].Parent)
+
+	// nothing left to repair
+	testRunRepairSnapshots(t, opts, env.gopts)
+	rtest.Equals(t, repaired, testListSnapshotsByTime(t, env.gopts))
+}
+
 func testRunTag(t testing.TB, opts TagOptions, gopts GlobalOptions) {
 	rtest.OK(t, runTag(context.TODO(), opts, gopts, []string{}))
 }
@@ -1005,6 +1884,90 @@ func TestTag(t *testing.T) {
 		"expected original ID to be set to the first snapshot id")
 }
 
+func TestTagProtect(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	older, _ := testRunSnapshots(t, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	err := runTag(context.TODO(), TagOptions{Protect: true, Unprotect: true}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for --protect combined with --unprotect")
+
+	rtest.OK(t, runTag(context.TODO(), TagOptions{Protect: true}, env.gopts, []string{older.ID.String()}))
+	var protectedID restic.ID
+	_, snapshots := testRunSnapshots(t, env.gopts)
+	for id, sn := range snapshots {
+		if sn.Protected {
+			protectedID = id
+		}
+	}
+	rtest.Assert(t, !protectedID.IsNull(), "no protected snapshot found")
+
+	// neither the policy nor explicit IDs remove the protected snapshot
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Last: 1}, env.gopts, nil))
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+	testRunForget(t, env.gopts, protectedID.String())
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+
+	rtest.OK(t, runTag(context.TODO(), TagOptions{Unprotect: true}, env.gopts, nil))
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Last: 1}, env.gopts, nil))
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+}
+
+func TestRewrite(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	original, _ := testRunSnapshots(t, env.gopts)
+
+	err := runRewrite(context.TODO(), RewriteOptions{}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected error without changes")
+
+	// the original snapshot is kept by default
+	rtest.OK(t, runRewrite(context.TODO(), RewriteOptions{SetHost: "newhost"}, env.gopts, nil))
+	_, snapshots := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 2, len(snapshots))
+	var rewritten Snapshot
+	for id, sn := range snapshots {
+		if !id.Equal(*original.ID) {
+			rewritten = sn
+		}
+	}
+	rtest.Equals(t, "newhost", rewritten.Hostname)
+	rtest.Equals(t, original.Paths, rewritten.Paths)
+	rtest.Equals(t, *original.Tree, *rewritten.Tree)
+	rtest.Equals(t, *original.ID, *rewritten.Original)
+
+	// with --forget, the snapshot is replaced
+	newPath := filepath.Join(env.base, "moved")
+	rtest.OK(t, runRewrite(context.TODO(), RewriteOptions{
+		snapshotFilterOptions: snapshotFilterOptions{Hosts: []string{"newhost"}},
+		SetPaths:              []string{newPath},
+		Forget:                true,
+	}, env.gopts, nil))
+	_, snapshots = testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 2, len(snapshots))
+	_, ok := snapshots[*rewritten.ID]
+	rtest.Assert(t, !ok, "rewritten snapshot %v was not removed", rewritten.ID.Str())
+	for _, sn := range snapshots {
+		rtest.Equals(t, *original.Tree, *sn.Tree)
+		if sn.Hostname == "newhost" {
+			rtest.Equals(t, []string{newPath}, sn.Paths)
+			rtest.Equals(t, *original.ID, *sn.Original)
+		}
+	}
+
+	testRunCheck(t, env.gopts)
+}
+
 func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
 	buf := bytes.NewBuffer(nil)
 
@@ -1142,6 +2105,145 @@ func TestKeyProblems(t *testing.T) {
 	testRunCheck(t, env.gopts)
 }
 
+func testRunKeyRotate(t testing.TB, newPassword string, gopts GlobalOptions) error {
+	testKeyNewPassword = newPassword
+	keyRotateConfirm = true
+	defer func() {
+		testKeyNewPassword = ""
+		keyRotateConfirm = false
+	}()
+
+	return runKey(context.TODO(), gopts, []string{"rotate"})
+}
+
+func testKeyRotateVerify(t testing.TB, env *testEnvironment, oldPacks restic.IDs, snapshots int) {
+	testRunCheck(t, env.gopts)
+
+	rtest.Equals(t, 0, len(testRunKeyListOtherIDs(t, env.gopts)))
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, snapshots, len(snapshotIDs))
+
+	packs := restic.NewIDSet(testRunList(t, "packs", env.gopts)...)
+	for _, id := range oldPacks {
+		rtest.Assert(t, !packs.Has(id), "pack %v of the old master key was not removed", id.Str())
+	}
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotIDs[0])
+	diff := directoriesContentsDiff(env.testdata, filepath.Join(restoredir, "testdata"))
+	rtest.Assert(t, diff == "", "directories are not equal: %v", diff)
+}
+
+func TestKeyRotate(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list files more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	env.gopts.AuditLog = true
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+	testRunKeyAddNewKey(t, "geheim2", env.gopts)
+	oldPacks := testRunList(t, "packs", env.gopts)
+
+	err := runKey(context.TODO(), env.gopts, []string{"rotate"})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--confirm"),
+		"expected rotate to fail without --confirm, got %v", err)
+
+	oldPassword := env.gopts.password
+	rtest.OK(t, testRunKeyRotate(t, "rotated", env.gopts))
+
+	_, err = OpenRepository(context.TODO(), env.gopts)
+	rtest.Assert(t, err != nil, "repository can still be opened with the old password")
+	env.gopts.password = "geheim2"
+	_, err = OpenRepository(context.TODO(), env.gopts)
+	rtest.Assert(t, err != nil, "repository can still be opened with the second old password")
+
+	env.gopts.password = "rotated"
+	testKeyRotateVerify(t, env, oldPacks, 1)
+
+	// the audit log is re-encrypted with the new key
+	var actions []string
+	for _, e := range testRunAudit(t, AuditOptions{}, env.gopts) {
+		actions = append(actions, e.Action)
+	}
+	rtest.Equals(t, []string{"backup", "key-add", "key-rotate"}, actions)
+
+	env.gopts.password = oldPassword
+	rtest.Assert(t, testRunKeyRotate(t, "rotated2", env.gopts) != nil,
+		"expected rotate to fail with the old password")
+}
+
+type failSnapshotSaveBackend struct {
+	restic.Backend
+	failed bool
+}
+
+func (b *failSnapshotSaveBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type == restic.SnapshotFile && !b.failed {
+		b.failed = true
+		return errors.New("snapshot upload failed")
+	}
+	return b.Backend.Save(ctx, h, rd)
+}
+
+func TestKeyRotateResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+	oldPacks := testRunList(t, "packs", env.gopts)
+
+	env.gopts.backendTestHook = func(r restic.Backend) (restic.Backend, error) {
+		return &failSnapshotSaveBackend{Backend: r}, nil
+	}
+	err := testRunKeyRotate(t, "rotated", env.gopts)
+	rtest.Assert(t, err != nil, "expected the rotation to fail")
+	env.gopts.backendTestHook = nil
+
+	// the config has been switched before the snapshots are rewritten
+	env.gopts.password = "rotated"
+	rtest.OK(t, testRunKeyRotate(t, "", env.gopts))
+	testKeyRotateVerify(t, env, oldPacks, 2)
+}
+
+func TestAppendOnly(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+
+	env.gopts.AppendOnly = true
+	testRunBackup(t, env.base, []string{"testdata"}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 2, len(snapshotIDs))
+
+	err := runForget(context.TODO(), ForgetOptions{Last: 1}, env.gopts, nil)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "append-only"),
+		"expected forget to fail, got %v", err)
+	rtest.OK(t, runForget(context.TODO(), ForgetOptions{Last: 1, DryRun: true}, env.gopts, nil))
+
+	err = runPrune(context.TODO(), PruneOptions{MaxUnused: "5%"}, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "append-only"),
+		"expected prune to fail, got %v", err)
+
+	// keys can be added, but not removed
+	testRunKeyAddNewKey(t, "geheim2", env.gopts)
+	otherIDs := testRunKeyListOtherIDs(t, env.gopts)
+	rtest.Equals(t, 1, len(otherIDs))
+	err = runKey(context.TODO(), env.gopts, []string{"remove", otherIDs[0]})
+	rtest.Assert(t, err != nil, "expected key remove to fail")
+	rtest.Equals(t, otherIDs, testRunKeyListOtherIDs(t, env.gopts))
+
+	rtest.Equals(t, snapshotIDs, testRunList(t, "snapshots", env.gopts))
+	testRunCheck(t, env.gopts)
+}
+
 func testFileSize(filename string, size int64) error {
 	fi, err := os.Stat(filename)
 	if err != nil {
@@ -1230,6 +2332,107 @@ func TestRestore(t *testing.T) {
 	rtest.Assert(t, diff == "", "directories are not equal %v", diff)
 }
 
+func TestRestoreToArchive(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for i := 0; i < 5; i++ {
+		p := filepath.Join(env.testdata, fmt.Sprintf("foo/bar/testfile%v", i))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, uint(mrand.Intn(2<<20))))
+	}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+
+	buf := bytes.NewBuffer(nil)
+	env.gopts.stdout = buf
+	rtest.OK(t, testRunRestoreAssumeFailure(t, "latest", RestoreOptions{Target: "-", Archive: "tar"}, env.gopts))
+
+	files := 0
+	rd := tar.NewReader(buf)
+	for {
+		hdr, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(rd)
+		rtest.OK(t, err)
+		expected, err := ioutil.ReadFile(filepath.Join(filepath.Dir(env.testdata), filepath.FromSlash(hdr.Name)))
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(expected, data), "wrong content for %v", hdr.Name)
+		files++
+	}
+	rtest.Equals(t, 5, files)
+
+	err := testRunRestoreAssumeFailure(t, "latest", RestoreOptions{Target: "-", Archive: "7z"}, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for an unknown archive format")
+}
+
+func TestRestoreResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for i := 0; i < 5; i++ {
+		p := filepath.Join(env.testdata, fmt.Sprintf("foo/bar/testfile%v", i))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, uint(mrand.Intn(2<<20))))
+	}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	rtest.OK(t, testRunRestoreAssumeFailure(t, "latest", RestoreOptions{Target: restoredir, Resume: true}, env.gopts))
+	diff := directoriesContentsDiff(env.testdata, filepath.Join(restoredir, filepath.Base(env.testdata)))
+	rtest.Assert(t, diff == "", "directories are not equal %v", diff)
+
+	// the state is removed once the restore has completed
+	states, err := filepath.Glob(filepath.Join(env.cache, "*", "restore-state-*"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(states))
+
+	err = testRunRestoreAssumeFailure(t, "latest", RestoreOptions{Target: "-", Resume: true}, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for --resume with --target -")
+}
+
+func TestRestoreVerifyManifest(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for i := 0; i < 5; i++ {
+		p := filepath.Join(env.testdata, fmt.Sprintf("foo/bar/testfile%v", i))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, uint(mrand.Intn(2<<20))))
+	}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	manifest := filepath.Join(env.base, "manifest")
+	rtest.OK(t, testRunRestoreAssumeFailure(t, "latest", RestoreOptions{Target: restoredir, VerifyManifest: manifest}, env.gopts))
+
+	data, err := ioutil.ReadFile(manifest)
+	rtest.OK(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	rtest.Equals(t, 5, len(lines))
+	for _, line := range lines {
+		fields := strings.SplitN(line, "  ", 2)
+		rtest.Equals(t, 2, len(fields))
+		buf, err := ioutil.ReadFile(filepath.Join(restoredir, fields[1]))
+		rtest.OK(t, err)
+		rtest.Equals(t, restic.Hash(buf).String(), fields[0])
+	}
+
+	rtest.Equals(t, "\\"+restic.ID{}.String()+"  a\\nb\\\\c\n", formatManifestEntry(restic.ID{}, "a\nb\\c"))
+}
+
 func TestRestoreLatest(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1297,6 +2500,51 @@ func TestRestoreLatest(t *testing.T) {
 	}
 }
 
+func TestFindSingleSnapshotGroupBy(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	other := filepath.Join(env.base, "other")
+	rtest.OK(t, os.Mkdir(other, 0755))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{Host: "a"}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{Host: "b"}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata, other}, BackupOptions{Host: "a"}, env.gopts)
+	list := testListSnapshotsByTime(t, env.gopts)
+	rtest.Equals(t, 3, len(list))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	// the test backend only allows listing the snapshots once
+	be, err := backend.MemorizeList(context.TODO(), repo.Backend(), restic.SnapshotFile)
+	rtest.OK(t, err)
+
+	for _, test := range []struct {
+		opts snapshotFilterOptions
+		want int
+		err  string
+	}{
+		// without --group-by the latest matching snapshot is used
+		{snapshotFilterOptions{}, 2, ""},
+		{snapshotFilterOptions{Hosts: []string{"a"}, Paths: []string{env.testdata}}, 2, ""},
+		{snapshotFilterOptions{GroupBy: "host,paths"}, 0, "belong to 3 groups"},
+		{snapshotFilterOptions{Hosts: []string{"a"}, GroupBy: "host"}, 2, ""},
+		{snapshotFilterOptions{Hosts: []string{"a"}, GroupBy: "host,paths"}, 0, "belong to 2 groups"},
+		// --path selects the group with exactly these paths
+		{snapshotFilterOptions{Hosts: []string{"a"}, Paths: []string{env.testdata}, GroupBy: "host,paths"}, 0, ""},
+		{snapshotFilterOptions{Hosts: []string{"c"}, GroupBy: "host"}, 0, "no snapshot matched"},
+	} {
+		sn, err := findSingleSnapshot(context.TODO(), be, repo, test.opts, "latest")
+		if test.err != "" {
+			rtest.Assert(t, err != nil && strings.Contains(err.Error(), test.err),
+				"%+v: expected error containing %q, got %v", test.opts, test.err, err)
+			continue
+		}
+		rtest.OK(t, err)
+		rtest.Equals(t, *list[test.want].ID, *sn.ID())
+	}
+}
+
 func TestRestoreWithPermissionFailure(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1432,11 +2680,73 @@ func TestFindJSON(t *testing.T) {
 	rtest.Assert(t, len(matches[0].Matches) == 1, "expected a single file to match (%v)", datafile)
 	rtest.Assert(t, matches[0].Hits == 1, "expected hits to show 1 match (%v)", datafile)
 
-	results = testRunFind(t, true, env.gopts, "testfile*")
-	rtest.OK(t, json.Unmarshal(results, &matches))
-	rtest.Assert(t, len(matches) == 1, "expected a single snapshot in repo (%v)", datafile)
-	rtest.Assert(t, len(matches[0].Matches) == 3, "expected 3 files to match (%v)", datafile)
-	rtest.Assert(t, matches[0].Hits == 3, "expected hits to show 3 matches (%v)", datafile)
+	results = testRunFind(t, true, env.gopts, "testfile*")
+	rtest.OK(t, json.Unmarshal(results, &matches))
+	rtest.Assert(t, len(matches) == 1, "expected a single snapshot in repo (%v)", datafile)
+	rtest.Assert(t, len(matches[0].Matches) == 3, "expected 3 files to match (%v)", datafile)
+	rtest.Assert(t, matches[0].Hits == 3, "expected hits to show 3 matches (%v)", datafile)
+}
+
+type testContentMatch struct {
+	ObjectType   string  `json:"object_type"`
+	File         string  `json:"file"`
+	Path         string  `json:"path"`
+	SnapshotID   string  `json:"snapshot"`
+	MatchedBytes uint64  `json:"matched_bytes"`
+	Percentage   float64 `json:"percentage"`
+}
+
+func testRunFindContent(t testing.TB, gopts GlobalOptions, files ...string) []testContentMatch {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	globalOptions.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		globalOptions.JSON = false
+	}()
+
+	opts := FindOptions{Content: true}
+	rtest.OK(t, runFind(context.TODO(), opts, gopts, files))
+
+	var matches []testContentMatch
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &matches))
+	return matches
+}
+
+func TestFindContent(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	data := rtest.Random(23, 6*1024*1024)
+	rtest.OK(t, os.MkdirAll(env.testdata, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "file"), data, 0644))
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+
+	// a copy of the file matches completely
+	same := filepath.Join(env.base, "same")
+	rtest.OK(t, ioutil.WriteFile(same, data, 0644))
+	matches := testRunFindContent(t, env.gopts, same)
+	rtest.Equals(t, 1, len(matches))
+	rtest.Equals(t, "content", matches[0].ObjectType)
+	rtest.Equals(t, same, matches[0].File)
+	rtest.Equals(t, "/testdata/file", matches[0].Path)
+	rtest.Equals(t, uint64(len(data)), matches[0].MatchedBytes)
+	rtest.Equals(t, float64(100), matches[0].Percentage)
+
+	// a file sharing only the beginning matches partially
+	partial := filepath.Join(env.base, "partial")
+	rtest.OK(t, ioutil.WriteFile(partial, append(data[:4*1024*1024:4*1024*1024], rtest.Random(42, 4*1024*1024)...), 0644))
+	matches = testRunFindContent(t, env.gopts, partial)
+	rtest.Equals(t, 1, len(matches))
+	rtest.Assert(t, matches[0].Percentage > 0 && matches[0].Percentage < 100,
+		"expected partial match, got %v%%", matches[0].Percentage)
+
+	// unrelated content does not match
+	other := filepath.Join(env.base, "other")
+	rtest.OK(t, ioutil.WriteFile(other, rtest.Random(5, 2*1024*1024), 0644))
+	matches = testRunFindContent(t, env.gopts, other)
+	rtest.Equals(t, 0, len(matches))
 }
 
 func testRebuildIndex(t *testing.T, backendTestHook backendWrapper) {
@@ -1447,6 +2757,7 @@ func testRebuildIndex(t *testing.T, backendTestHook backendWrapper) {
 	rtest.SetupTarTestFixture(t, env.base, datafile)
 
 	out, err := testRunCheckOutput(env.gopts)
+	t.Log(err)
 	if !strings.Contains(out, "contained in several indexes") {
 		t.Fatalf("did not find checker hint for packs in several indexes")
 	}
@@ -1526,6 +2837,50 @@ func TestRebuildIndexDamage(t *testing.T) {
 	})
 }
 
+func TestRepairIndexCompact(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// must list the index files again after compacting
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	dir := filepath.Join(env.testdata, "dir")
+	rtest.OK(t, os.MkdirAll(dir, 0755))
+	opts := BackupOptions{}
+	for i := 0; i < 4; i++ {
+		rtest.OK(t, appendRandomData(filepath.Join(dir, fmt.Sprintf("file%d", i)), 1024+uint(i)))
+		testRunBackup(t, "", []string{dir}, opts, env.gopts)
+	}
+	rtest.Equals(t, 4, len(testRunList(t, "index", env.gopts)))
+
+	indexedBlobs := func() map[restic.PackedBlob]struct{} {
+		repo, err := OpenRepository(context.TODO(), env.gopts)
+		rtest.OK(t, err)
+		rtest.OK(t, repo.LoadIndex(context.TODO()))
+		blobs := make(map[restic.PackedBlob]struct{})
+		repo.Index().Each(context.TODO(), func(pb restic.PackedBlob) {
+			blobs[pb] = struct{}{}
+		})
+		return blobs
+	}
+	before := indexedBlobs()
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	err := runRepairIndex(context.TODO(), RepairIndexOptions{Compact: true}, env.gopts)
+	globalOptions.stdout = os.Stdout
+	rtest.OK(t, err)
+
+	rtest.Equals(t, 1, len(testRunList(t, "index", env.gopts)))
+	rtest.Assert(t, strings.Contains(buf.String(), "index files: 4 before, 1 after\n"),
+		"unexpected output %q", buf.String())
+	rtest.Equals(t, before, indexedBlobs())
+	testRunCheck(t, env.gopts)
+
+	err = runRepairIndex(context.TODO(), RepairIndexOptions{RebuildIndexOptions: RebuildIndexOptions{ReadAllPacks: true}, Compact: true}, env.gopts)
+	rtest.Assert(t, err != nil, "expected error for --compact with --read-all-packs")
+}
+
 type appendOnlyBackend struct {
 	restic.Backend
 }
@@ -1584,6 +2939,125 @@ func TestCheckRestoreNoLock(t *testing.T) {
 	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
 }
 
+func testRunCheckIncremental(t testing.TB, gopts GlobalOptions) string {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	opts := CheckOptions{
+		ReadData:    true,
+		Incremental: true,
+	}
+	rtest.OK(t, runCheck(context.TODO(), opts, gopts, nil))
+	return buf.String()
+}
+
+func TestCheckIncremental(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+
+	// the first check reads all packs, IncrementalSample is zero so that no
+	// previously verified packs are read again
+	out := testRunCheckIncremental(t, env.gopts)
+	rtest.Assert(t, !strings.Contains(out, "skipped"), "first check should read all packs, output: %q", out)
+
+	packs := len(testRunList(t, "packs", env.gopts))
+	out = testRunCheckIncremental(t, env.gopts)
+	rtest.Assert(t, strings.Contains(out, fmt.Sprintf("read 0 new packs and 0 of %d previously verified packs", packs)),
+		"expected no packs to be read, output: %q", out)
+	rtest.Assert(t, strings.Contains(out, fmt.Sprintf("skipped %d packs", packs)),
+		"expected all packs to be skipped, output: %q", out)
+
+	extra := filepath.Join(env.base, "extra")
+	rtest.OK(t, appendRandomData(extra, 3*1024*1024))
+	testRunBackup(t, "", []string{extra}, opts, env.gopts)
+	newPacks := len(testRunList(t, "packs", env.gopts)) - packs
+	rtest.Assert(t, newPacks > 0, "backup should have added packs")
+	out = testRunCheckIncremental(t, env.gopts)
+	rtest.Assert(t, strings.Contains(out, fmt.Sprintf("read %d new packs", newPacks)),
+		"expected %d new packs to be read, output: %q", newPacks, out)
+
+	// after prune, the state is discarded
+	newest, _ := testRunSnapshots(t, env.gopts)
+	testRunForget(t, env.gopts, newest.ID.String())
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	out = testRunCheckIncremental(t, env.gopts)
+	rtest.Assert(t, strings.Contains(out, "packs were removed since the last incremental check"),
+		"expected the state to be discarded after prune, output: %q", out)
+}
+
+func testRunCheckOrphaned(gopts GlobalOptions, remove, confirm bool) (string, error) {
+	buf := bytes.NewBuffer(nil)
+
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	opts := CheckOptions{Orphaned: true, Remove: remove, Confirm: confirm}
+	err := runCheck(context.TODO(), opts, gopts, nil)
+	return buf.String(), err
+}
+
+func TestCheckOrphaned(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	packs := restic.NewIDSet(testRunList(t, "packs", env.gopts)...)
+	indexes := restic.NewIDSet(testRunList(t, "index", env.gopts)...)
+
+	out, err := testRunCheckOrphaned(env.gopts, false, false)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out, "no orphaned packs found"), "unexpected output: %q", out)
+
+	// the packs of the second backup become orphaned when its index and
+	// snapshot are removed
+	extra := filepath.Join(env.base, "extra")
+	rtest.OK(t, appendRandomData(extra, 3*1024*1024))
+	testRunBackup(t, "", []string{extra}, opts, env.gopts)
+	for _, id := range testRunList(t, "index", env.gopts) {
+		if !indexes.Has(id) {
+			rtest.OK(t, os.Remove(filepath.Join(env.repo, "index", id.String())))
+		}
+	}
+	newest, _ := testRunSnapshots(t, env.gopts)
+	testRunForget(t, env.gopts, newest.ID.String())
+
+	var orphaned restic.IDs
+	for _, id := range testRunList(t, "packs", env.gopts) {
+		if !packs.Has(id) {
+			orphaned = append(orphaned, id)
+		}
+	}
+	rtest.Assert(t, len(orphaned) > 0, "backup should have added packs")
+
+	out, err = testRunCheckOrphaned(env.gopts, false, false)
+	rtest.OK(t, err)
+	for _, id := range orphaned {
+		rtest.Assert(t, strings.Contains(out, id.String()), "orphaned pack %v not listed, output: %q", id, out)
+	}
+	rtest.Assert(t, strings.Contains(out, fmt.Sprintf("%d orphaned packs", len(orphaned))), "unexpected output: %q", out)
+
+	_, err = testRunCheckOrphaned(env.gopts, true, false)
+	rtest.Assert(t, err != nil, "removing without --confirm should fail")
+	rtest.Equals(t, len(packs)+len(orphaned), len(testRunList(t, "packs", env.gopts)))
+
+	out, err = testRunCheckOrphaned(env.gopts, true, true)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out, fmt.Sprintf("removed %d orphaned packs", len(orphaned))), "unexpected output: %q", out)
+	rtest.Equals(t, packs, restic.NewIDSet(testRunList(t, "packs", env.gopts)...))
+	testRunCheck(t, env.gopts)
+}
+
 func TestPrune(t *testing.T) {
 	testPruneVariants(t, false)
 	testPruneVariants(t, true)
@@ -1606,6 +3080,14 @@ func testPruneVariants(t *testing.T, unsafeNoSpaceRecovery bool) {
 		testPrune(t, opts, checkOpts)
 	})
 
+	t.Run("Percent"+suffix, func(t *testing.T) {
+		opts := PruneOptions{unsafeRecovery: unsafeNoSpaceRecovery}
+		rtest.OK(t, newMaxUnusedPercentValue(&opts.MaxUnused).Set("20"))
+		rtest.Equals(t, "20%", opts.MaxUnused)
+		checkOpts := CheckOptions{ReadData: true}
+		testPrune(t, opts, checkOpts)
+	})
+
 	t.Run("unlimited"+suffix, func(t *testing.T) {
 		opts := PruneOptions{MaxUnused: "unlimited", unsafeRecovery: unsafeNoSpaceRecovery}
 		checkOpts := CheckOptions{ReadData: true}
@@ -2092,6 +3574,57 @@ func TestDiff(t *testing.T) {
 	rtest.Assert(t, len(outQuiet) < len(out), "expected shorter output on quiet mode %v vs. %v", len(outQuiet), len(out))
 }
 
+func TestDiffOnly(t *testing.T) {
+	env, cleanup, firstSnapshotID, secondSnapshotID := setupDiffRepo(t)
+	defer cleanup()
+
+	env.gopts.Quiet = false
+	env.gopts.JSON = true
+
+	diff := func(opts DiffOptions) (modifiers map[string]int, stat DiffStatsContainer) {
+		out, err := testRunDiffOutputWithOptions(env.gopts, opts, firstSnapshotID, secondSnapshotID)
+		rtest.OK(t, err)
+
+		modifiers = make(map[string]int)
+		scanner := bufio.NewScanner(strings.NewReader(out))
+		for scanner.Scan() {
+			var change Change
+			rtest.OK(t, json.Unmarshal(scanner.Bytes(), &change))
+			switch change.MessageType {
+			case "change":
+				modifiers[change.Modifier]++
+			case "statistics":
+				rtest.OK(t, json.Unmarshal(scanner.Bytes(), &stat))
+			}
+		}
+		return modifiers, stat
+	}
+
+	modifiers, stat := diff(DiffOptions{Only: []string{"added"}})
+	rtest.Equals(t, map[string]int{"+": 5}, modifiers)
+	rtest.Assert(t, stat.Added.Files == 2 && stat.Added.Dirs == 3 &&
+		stat.Removed.Files == 0 && stat.Removed.Dirs == 0 && stat.ChangedFiles == 0,
+		"unexpected statistics %+v", stat)
+
+	modifiers, stat = diff(DiffOptions{Only: []string{"removed", "modified-content"}, AllStats: true})
+	rtest.Equals(t, 0, modifiers["+"])
+	rtest.Equals(t, 3, modifiers["-"])
+	rtest.Equals(t, 1, modifiers["M"])
+	rtest.Assert(t, stat.Added.Files == 2 && stat.Added.Dirs == 3 &&
+		stat.Removed.Files == 1 && stat.Removed.Dirs == 2 && stat.ChangedFiles == 1,
+		"unexpected statistics %+v", stat)
+
+	// metadata changes are detected without --metadata
+	modifiers, _ = diff(DiffOptions{Only: []string{"modified-metadata"}})
+	for modifier := range modifiers {
+		rtest.Assert(t, strings.ContainsAny(modifier, "UB"), "unexpected change %q", modifier)
+	}
+	rtest.Assert(t, modifiers["U"] > 0, "no metadata changes found")
+
+	_, err := testRunDiffOutputWithOptions(env.gopts, DiffOptions{Only: []string{"foo"}}, firstSnapshotID, secondSnapshotID)
+	rtest.Assert(t, err != nil, "expected error for invalid category")
+}
+
 type typeSniffer struct {
 	MessageType string `json:"message_type"`
 }
@@ -2141,6 +3674,56 @@ func TestDiffJSON(t *testing.T) {
 	rtest.Assert(t, stat.SourceSnapshot == firstSnapshotID && stat.TargetSnapshot == secondSnapshotID, "unexpected snapshot ids")
 }
 
+func TestDiffContent(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "diffdata")
+	rtest.OK(t, os.Mkdir(datadir, 0755))
+	notes := filepath.Join(datadir, "notes.txt")
+	binary := filepath.Join(datadir, "data.bin")
+	rtest.OK(t, ioutil.WriteFile(notes, []byte("first\nsecond\nthird\n"), 0644))
+	rtest.OK(t, ioutil.WriteFile(binary, []byte("bin\x00ary"), 0644))
+
+	testRunBackup(t, env.base, []string{"diffdata"}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	firstSnapshotID := snapshotIDs[0].String()
+
+	rtest.OK(t, ioutil.WriteFile(notes, []byte("first\n2nd\nthird\nfourth\n"), 0644))
+	rtest.OK(t, ioutil.WriteFile(binary, []byte("bin\x00ary data"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, "new.txt"), []byte("new\n"), 0644))
+	testRunBackup(t, env.base, []string{"diffdata"}, BackupOptions{}, env.gopts)
+
+	var secondSnapshotID string
+	for _, id := range testRunList(t, "snapshots", env.gopts) {
+		if id.String() != firstSnapshotID {
+			secondSnapshotID = id.String()
+		}
+	}
+
+	env.gopts.Quiet = false
+	opts := DiffOptions{Content: []string{"/diffdata/notes.txt", "/diffdata/data.bin", "/diffdata/new.txt"}}
+	out, err := testRunDiffOutputWithOptions(env.gopts, opts, firstSnapshotID, secondSnapshotID)
+	rtest.OK(t, err)
+
+	expected := "--- " + firstSnapshotID[:8] + ":/diffdata/notes.txt\n" +
+		"+++ " + secondSnapshotID[:8] + ":/diffdata/notes.txt\n" +
+		"@@ -1,3 +1,4 @@\n first\n-second\n+2nd\n third\n+fourth\n" +
+		"binary file /diffdata/data.bin differs\n" +
+		"--- /dev/null\n" +
+		"+++ " + secondSnapshotID[:8] + ":/diffdata/new.txt\n" +
+		"@@ -0,0 +1 @@\n+new\n"
+	rtest.Assert(t, strings.HasSuffix(out, expected), "unexpected output, want suffix\n%v\ngot\n%v", expected, out)
+
+	for _, p := range []string{"/diffdata", "/diffdata/missing.txt"} {
+		opts := DiffOptions{Content: []string{p}}
+		_, err = testRunDiffOutputWithOptions(env.gopts, opts, firstSnapshotID, secondSnapshotID)
+		rtest.Assert(t, err != nil, "expected error for %v", p)
+	}
+}
+
 type writeToOnly struct {
 	rd io.Reader
 }
@@ -2221,3 +3804,329 @@ func TestFindListOnce(t *testing.T) {
 	// the snapshots can only be listed once, if both lists match then the there has been only a single List() call
 	rtest.Equals(t, thirdSnapshot, snapshotIDs)
 }
+
+func TestScrub(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	rtest.OK(t, testRunScrub(t, ScrubOptions{ReadPercentage: 100, Resume: true}, env.gopts))
+	rtest.OK(t, testRunScrub(t, ScrubOptions{ReadPercentage: 10}, env.gopts))
+
+	// damage one of the packs
+	packs := testRunList(t, "packs", env.gopts)
+	rtest.Assert(t, len(packs) > 0, "no packs found")
+	filename := filepath.Join(env.repo, "data", packs[0].String()[:2], packs[0].String())
+	rtest.OK(t, os.Chmod(filename, 0644))
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	rtest.OK(t, err)
+	_, err = f.WriteAt([]byte("damaged"), 0)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+
+	err = testRunScrub(t, ScrubOptions{ReadPercentage: 100}, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "1 packs are damaged"),
+		"expected one damaged pack, got %v", err)
+}
+
+func testRunCacheWarm(t testing.TB, opts CacheWarmOptions, gopts GlobalOptions, snapshotID string) string {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	gopts.Quiet = true
+	rtest.OK(t, runCacheWarm(context.TODO(), opts, gopts, []string{snapshotID}))
+	return buf.String()
+}
+
+func countCachedPacks(t testing.TB, dir string) int {
+	n := 0
+	err := filepath.Walk(filepath.Join(dir, "data"), func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			n++
+		}
+		return nil
+	})
+	rtest.OK(t, err)
+	return n
+}
+
+func TestCacheWarm(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	packs := testRunList(t, "packs", env.gopts)
+
+	dirs, err := cache.All(env.cache)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(dirs) == 1, "expected one cache dir, got %d", len(dirs))
+	cacheDir := filepath.Join(env.cache, dirs[0].Name())
+
+	// start with an empty cache
+	rtest.OK(t, os.RemoveAll(filepath.Join(cacheDir, "data")))
+
+	out := testRunCacheWarm(t, CacheWarmOptions{}, env.gopts, "latest")
+	rtest.Assert(t, strings.Contains(out, "0 packs were cached already"), "unexpected output: %q", out)
+	treePacks := countCachedPacks(t, cacheDir)
+	rtest.Assert(t, treePacks > 0 && treePacks < len(packs),
+		"expected only tree packs in the cache, got %d of %d packs", treePacks, len(packs))
+
+	out = testRunCacheWarm(t, CacheWarmOptions{Data: true}, env.gopts, "latest")
+	rtest.Assert(t, strings.Contains(out, fmt.Sprintf("%d packs were cached already", treePacks)),
+		"unexpected output: %q", out)
+	rtest.Equals(t, len(packs), countCachedPacks(t, cacheDir))
+
+	// nothing is downloaded if the cache is full
+	rtest.OK(t, os.RemoveAll(filepath.Join(cacheDir, "data")))
+	out = testRunCacheWarm(t, CacheWarmOptions{Data: true, MaxSize: "1"}, env.gopts, "latest")
+	rtest.Assert(t, strings.Contains(out, "warmed 0 packs"), "unexpected output: %q", out)
+	rtest.Equals(t, 0, countCachedPacks(t, cacheDir))
+}
+
+func TestCheckBackend(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.JSON = true
+	gopts.stdout = buf
+	rtest.OK(t, runCheckBackend(context.TODO(), gopts, nil))
+
+	var result checkBackendResult
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &result))
+	rtest.Assert(t, result.Success, "backend check failed: %v", result)
+
+	var ops []string
+	for _, op := range result.Operations {
+		rtest.Equals(t, "", op.Error)
+		ops = append(ops, op.Operation)
+	}
+	rtest.Equals(t, []string{"list", "save", "load", "remove"}, ops)
+
+	// the temporary lock is removed
+	rtest.Equals(t, 0, len(testRunList(t, "locks", env.gopts)))
+}
+
+func TestStatsGrowth(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	// the second backup has the same contents and adds hardly any data
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "0", "0", "9", "0"), 1024*1024))
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+
+	defer func(mode string) { statsOptions.countMode = mode }(statsOptions.countMode)
+	statsOptions.countMode = countModeGrowth
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.JSON = true
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+	rtest.OK(t, runStats(context.TODO(), gopts, nil))
+
+	var stats statsContainer
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &stats))
+	rtest.Equals(t, 3, len(stats.Growth))
+
+	first, second, third := stats.Growth[0], stats.Growth[1], stats.Growth[2]
+	rtest.Assert(t, first.AddedSize > 0, "first snapshot did not add data")
+	rtest.Assert(t, !second.Time.Before(first.Time) && !third.Time.Before(second.Time),
+		"snapshots not in chronological order")
+	rtest.Assert(t, second.AddedSize < first.AddedSize/10, "second snapshot added %d bytes", second.AddedSize)
+	rtest.Assert(t, third.AddedSize >= 1024*1024, "third snapshot added %d bytes", third.AddedSize)
+	rtest.Equals(t, first.AddedSize+second.AddedSize+third.AddedSize, third.TotalSize)
+	rtest.Equals(t, third.TotalSize, stats.TotalSize)
+}
+
+func testRunStatsFragmentation(t testing.TB, gopts GlobalOptions) statsContainer {
+	defer func(mode string) { statsOptions.countMode = mode }(statsOptions.countMode)
+	statsOptions.countMode = countModeFragmentation
+
+	buf := bytes.NewBuffer(nil)
+	gopts.JSON = true
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+	rtest.OK(t, runStats(context.TODO(), gopts, nil))
+
+	var stats statsContainer
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &stats))
+	rtest.Assert(t, stats.Fragmentation != nil, "no fragmentation in output %q", buf.String())
+	return stats
+}
+
+func TestStatsFragmentation(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "0", "0", "9", "0"), 1024*1024))
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+
+	f := testRunStatsFragmentation(t, env.gopts).Fragmentation
+	rtest.Equals(t, uint64(0), f.FragmentedPacks)
+	rtest.Equals(t, f.TotalSize, f.LiveSize)
+	rtest.Equals(t, 0.0, f.Fragmentation)
+	rtest.Equals(t, f.TotalPacks, uint64(len(f.Packs)))
+
+	// forgetting the second snapshot leaves the appended data unused
+	newest, _ := testRunSnapshots(t, env.gopts)
+	testRunForget(t, env.gopts, newest.ID.String())
+
+	stats := testRunStatsFragmentation(t, env.gopts)
+	f = stats.Fragmentation
+	rtest.Equals(t, 1, stats.SnapshotsCount)
+	rtest.Assert(t, f.FragmentedPacks > 0, "no fragmented packs found")
+	rtest.Assert(t, f.TotalSize-f.LiveSize >= 1024*1024, "unexpected unused size %d", f.TotalSize-f.LiveSize)
+	rtest.Assert(t, f.Fragmentation > 0 && f.Fragmentation < 100, "unexpected fragmentation %v", f.Fragmentation)
+	rtest.Assert(t, f.Packs[0].LiveRatio < 1, "packs are not sorted by live ratio")
+
+	// filters would hide unused blobs
+	defer func(mode string) { statsOptions.countMode = mode }(statsOptions.countMode)
+	statsOptions.countMode = countModeFragmentation
+	err := runStats(context.TODO(), env.gopts, []string{"latest"})
+	rtest.Assert(t, err != nil, "expected error for snapshot IDs in fragmentation mode")
+}
+
+func TestStatsBlobsPerFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	dir := filepath.Join(env.testdata, "dir")
+	rtest.OK(t, os.MkdirAll(dir, 0700))
+	// small files consist of a single blob, empty files have none
+	for i := 0; i < 3; i++ {
+		rtest.OK(t, appendRandomData(filepath.Join(dir, fmt.Sprintf("small%d", i)), 1024))
+	}
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "empty"), nil, 0600))
+	large := filepath.Join(dir, "large")
+	rtest.OK(t, appendRandomData(large, 10*1024*1024))
+	testRunBackup(t, "", []string{dir}, BackupOptions{}, env.gopts)
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	pat, err := newContentPattern(repo.Config(), large)
+	rtest.OK(t, err)
+	rtest.Assert(t, pat.count > 1, "large file was not split into several blobs")
+
+	defer func(mode string) { statsOptions.countMode = mode }(statsOptions.countMode)
+	statsOptions.countMode = countModeBlobsPerFile
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.JSON = true
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+	rtest.OK(t, runStats(context.TODO(), gopts, nil))
+
+	var stats statsContainer
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &stats))
+	b := stats.BlobsPerFile
+	rtest.Assert(t, b != nil, "no blobs per file in output %q", buf.String())
+
+	// the large file is in the bucket which contains its number of blobs, the
+	// buckets in between are empty
+	bucket := 0
+	for min := pat.count; min > 1; min >>= 1 {
+		bucket++
+	}
+	rtest.Equals(t, bucket+1, len(b.Buckets))
+	for i, bk := range b.Buckets {
+		rtest.Equals(t, uint64(1)<<uint(i), bk.MinBlobs)
+		rtest.Equals(t, uint64(2)<<uint(i)-1, bk.MaxBlobs)
+		switch i {
+		case 0:
+			rtest.Equals(t, uint64(3), bk.Files)
+		case bucket:
+			rtest.Equals(t, uint64(1), bk.Files)
+		default:
+			rtest.Equals(t, uint64(0), bk.Files)
+		}
+	}
+	rtest.Equals(t, float64(3+pat.count)/4, b.AverageBlobsPerFile)
+	rtest.Equals(t, uint64(3+pat.count), stats.TotalBlobCount)
+	rtest.Equals(t, float64(stats.TotalSize)/float64(stats.TotalBlobCount), b.AverageBlobSize)
+
+	// the text output shows the same histogram, the longest bar is full
+	buf.Reset()
+	rtest.OK(t, runStats(context.TODO(), env.gopts, nil))
+	out := buf.String()
+	for _, line := range []string{
+		fmt.Sprintf("%15s:  %10d files  %s\n", "1", 3, strings.Repeat("#", 40)),
+		fmt.Sprintf("Average blobs per file:  %.2f\n", b.AverageBlobsPerFile),
+	} {
+		rtest.Assert(t, strings.Contains(out, line), "line %q not found in output %q", line, out)
+	}
+}
+
+func testRunAudit(t testing.TB, opts AuditOptions, gopts GlobalOptions) []auditEntryJSON {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+	rtest.OK(t, runAudit(context.TODO(), opts, gopts, nil))
+
+	var entries []auditEntryJSON
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &entries))
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	// adding a key must list the keys more than once
+	env.gopts.backendTestHook = nil
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+
+	// nothing is recorded unless the audit log is enabled
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	rtest.Equals(t, 0, len(testRunAudit(t, AuditOptions{}, env.gopts)))
+
+	env.gopts.AuditLog = true
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	newest, _ := testRunSnapshots(t, env.gopts)
+	testRunForget(t, env.gopts, newest.ID.String())
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "5%"})
+	testRunKeyAddNewKey(t, "geheim2", env.gopts)
+
+	entries := testRunAudit(t, AuditOptions{}, env.gopts)
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		rtest.Equals(t, version, e.Version)
+		rtest.Assert(t, e.Hostname != "", "entry %v has no hostname", e.ID)
+	}
+	rtest.Equals(t, []string{"backup", "forget", "prune", "key-add"}, actions)
+	rtest.Equals(t, restic.IDs{*newest.ID}, entries[0].Snapshots)
+	rtest.Equals(t, restic.IDs{*newest.ID}, entries[1].Snapshots)
+
+	entries = testRunAudit(t, AuditOptions{Actions: []string{"forget"}}, env.gopts)
+	rtest.Equals(t, 1, len(entries))
+	rtest.Equals(t, "forget", entries[0].Action)
+}
@@ -22,32 +22,65 @@ var globalLocks struct {
 }
 
 func lockRepo(ctx context.Context, repo restic.Repository) (*restic.Lock, context.Context, error) {
-	return lockRepository(ctx, repo, false)
+	return lockRepository(ctx, repo, "", false)
 }
 
 func lockRepoExclusive(ctx context.Context, repo restic.Repository) (*restic.Lock, context.Context, error) {
-	return lockRepository(ctx, repo, true)
+	return lockRepository(ctx, repo, "", true)
+}
+
+// lockRepoScoped creates a non-exclusive lock which only covers the given
+// scope, see restic.NewScopedLock.
+func lockRepoScoped(ctx context.Context, repo restic.Repository, scope string) (*restic.Lock, context.Context, error) {
+	return lockRepository(ctx, repo, scope, false)
+}
+
+// lockRepoExclusiveScoped creates an exclusive lock which only covers the
+// given scope, see restic.NewScopedExclusiveLock.
+func lockRepoExclusiveScoped(ctx context.Context, repo restic.Repository, scope string) (*restic.Lock, context.Context, error) {
+	return lockRepository(ctx, repo, scope, true)
+}
+
+// snapshotLockScope returns the lock scope for an operation which only
+// modifies the snapshots selected by the host filter, or the empty scope if
+// the snapshots of several hosts may be selected. Explicit snapshot IDs are not
+// restricted by the host filter.
+func snapshotLockScope(hosts []string, snapshotIDs []string) string {
+	if len(hosts) != 1 || len(snapshotIDs) != 0 {
+		return ""
+	}
+	return restic.HostLockScope(hosts[0])
 }
 
 // lockRepository wraps the ctx such that it is cancelled when the repository is unlocked
 // cancelling the original context also stops the lock refresh
-func lockRepository(ctx context.Context, repo restic.Repository, exclusive bool) (*restic.Lock, context.Context, error) {
+func lockRepository(ctx context.Context, repo restic.Repository, scope string, exclusive bool) (*restic.Lock, context.Context, error) {
 	// make sure that a repository is unlocked properly and after cancel() was
 	// called by the cleanup handler in global.go
 	globalLocks.Do(func() {
 		AddCleanupHandler(unlockAll)
 	})
 
-	lockFn := restic.NewLock
+	lockFn := restic.NewScopedLock
 	if exclusive {
-		lockFn = restic.NewExclusiveLock
+		lockFn = restic.NewScopedExclusiveLock
 	}
 
-	lock, err := lockFn(ctx, repo)
+	lock, err := lockFn(ctx, repo, scope)
+	if restic.IsAlreadyLocked(err) && globalOptions.StaleLockAge > 0 {
+		n, rerr := restic.RemoveExpiredLocks(ctx, repo, globalOptions.StaleLockAge, func(l *restic.Lock) {
+			Warnf("removed stale lock, it was not refreshed for %v: %v\n", time.Since(l.Time).Round(time.Second), l)
+		})
+		if rerr != nil {
+			Warnf("unable to remove stale locks: %v\n", rerr)
+		} else if n > 0 {
+			lock, err = lockFn(ctx, repo, scope)
+		}
+	}
 	if err != nil {
 		return nil, ctx, fmt.Errorf("unable to create lock in backend: %w", err)
 	}
-	debug.Log("create lock %p (exclusive %v)", lock, exclusive)
+	debug.Log("create lock %p (exclusive %v, scope %q)", lock, exclusive, scope)
 
 	ctx, cancel := context.WithCancel(ctx)
 	lockInfo := &lockContext{
@@ -152,3 +152,30 @@ func TestLockSuccessfulRefresh(t *testing.T) {
 	// unlockRepo should not crash
 	unlockRepo(lock)
 }
+
+func TestLockRemoveExpired(t *testing.T) {
+	repo, cleanup, _ := openTestRepo(t, nil)
+	defer cleanup()
+
+	old := &restic.Lock{Time: time.Now().Add(-2 * time.Hour), Exclusive: true, Hostname: "crashed-host", PID: 42}
+	id, err := restic.SaveJSONUnpacked(context.TODO(), repo, restic.LockFile, old)
+	rtest.OK(t, err)
+
+	_, _, err = lockRepo(context.Background(), repo)
+	rtest.Assert(t, restic.IsAlreadyLocked(err), "expected lock conflict, got %v", err)
+
+	defer func() {
+		globalOptions.StaleLockAge = 0
+	}()
+	// the lock is younger than the threshold
+	globalOptions.StaleLockAge = 3 * time.Hour
+	_, _, err = lockRepo(context.Background(), repo)
+	rtest.Assert(t, restic.IsAlreadyLocked(err), "expected lock conflict, got %v", err)
+
+	globalOptions.StaleLockAge = time.Hour
+	lock, _ := checkedLockRepo(context.Background(), t, repo)
+	unlockRepo(lock)
+
+	_, err = restic.LoadLock(context.TODO(), repo, id)
+	rtest.Assert(t, err != nil, "expired lock was not removed")
+}
@@ -35,6 +35,9 @@ directories in an encrypted repository stored on different backends.
 		if globalOptions.Quiet && globalOptions.Verbose > 0 {
 			return errors.Fatal("--quiet and --verbose cannot be specified at the same time")
 		}
+		if globalOptions.StaleLockAge != 0 && globalOptions.StaleLockAge < restic.StaleLockTimeout {
+			return errors.Fatalf("--stale-lock-age must be at least %v", restic.StaleLockTimeout)
+		}
 
 		switch {
 		case globalOptions.Verbose >= 2:
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// errPriorityUnsupported is returned by the platform specific functions which
+// are not implemented for the current platform.
+var errPriorityUnsupported = errors.New("not supported on this platform")
+
+// I/O scheduling classes, the values match the ones used by Linux.
+const (
+	ioClassBestEffort = 2
+	ioClassIdle       = 3
+)
+
+// ioPriority is the I/O scheduling class and the priority level within the
+// class, from 0 (highest) to 7 (lowest). The level is only used for the
+// best-effort class.
+type ioPriority struct {
+	class int
+	level int
+}
+
+// parseIOPriority parses the argument of --ionice, which is either "idle",
+// "best-effort" or "best-effort:level".
+func parseIOPriority(s string) (ioPriority, error) {
+	class, level := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		class, level = s[:i], s[i+1:]
+	}
+
+	switch class {
+	case "idle":
+		if level != "" {
+			return ioPriority{}, errors.Fatalf("invalid I/O priority %q: the idle class has no levels", s)
+		}
+		return ioPriority{class: ioClassIdle}, nil
+	case "best-effort":
+		if level == "" {
+			// the default level of the class
+			return ioPriority{class: ioClassBestEffort, level: 4}, nil
+		}
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 0 || n > 7 {
+			return ioPriority{}, errors.Fatalf("invalid I/O priority %q: the level must be between 0 and 7", s)
+		}
+		return ioPriority{class: ioClassBestEffort, level: n}, nil
+	default:
+		return ioPriority{}, errors.Fatalf("invalid I/O priority %q: unknown class %q, use idle or best-effort", s, class)
+	}
+}
+
+// setBackupPriority lowers the CPU and I/O priority of the process as
+// requested with --nice and --ionice. Failures are reported as warnings, the
+// backup then just runs with the unchanged priority.
+func setBackupPriority(opts BackupOptions) {
+	if opts.Nice != 0 {
+		debug.Log("set niceness to %d", opts.Nice)
+		if err := setNiceness(opts.Nice); err != nil {
+			Warnf("unable to set the CPU priority to %d: %v\n", opts.Nice, err)
+		}
+	}
+
+	if opts.IONice != "" {
+		// the argument is validated by BackupOptions.Check
+		prio, _ := parseIOPriority(opts.IONice)
+		debug.Log("set I/O priority to %v", prio)
+		if err := setIOPriority(prio); err != nil {
+			Warnf("unable to set the I/O priority to %v: %v\n", opts.IONice, err)
+		}
+	}
+}
+
+// loadCheckInterval is the interval in which the load average is checked for
+// --max-load.
+const loadCheckInterval = 10 * time.Second
+
+// limitReadersByLoad checks the system load average returned by loadAvg every
+// interval until ctx is cancelled. While it exceeds maxLoad, only a single
+// file is read at a time, otherwise the limit is reset to readers. changed is
+// called whenever the limit changes.
+func limitReadersByLoad(ctx context.Context, limiter *archiver.ReadLimiter, loadAvg func() (float64, error), maxLoad float64, readers uint, interval time.Duration, changed func(limit uint, load float64)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		load, err := loadAvg()
+		if err != nil {
+			debug.Log("unable to get the load average: %v", err)
+		} else {
+			limit := readers
+			if load > maxLoad {
+				limit = 1
+			}
+			if limit != limiter.Limit() {
+				limiter.SetLimit(limit)
+				changed(limit, load)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const ioprioWhoProcess = 1
+
+// forEachThread calls fn for the ID of each thread of the process. On Linux,
+// priorities are set per thread and only inherited by threads created later,
+// so all existing threads must be changed. Threads which are started while
+// the list is processed are picked up by the next pass.
+func forEachThread(fn func(tid int) error) error {
+	done := make(map[int]struct{})
+	for {
+		entries, err := ioutil.ReadDir("/proc/self/task")
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, entry := range entries {
+			tid, err := strconv.Atoi(entry.Name())
+			if err != nil {
+				continue
+			}
+			if _, ok := done[tid]; ok {
+				continue
+			}
+
+			found = true
+			done[tid] = struct{}{}
+			if err := fn(tid); err != nil {
+				return err
+			}
+		}
+
+		if !found {
+			return nil
+		}
+	}
+}
+
+// setNiceness sets the CPU scheduling priority of all threads.
+func setNiceness(nice int) error {
+	return forEachThread(func(tid int) error {
+		return unix.Setpriority(unix.PRIO_PROCESS, tid, nice)
+	})
+}
+
+// setIOPriority sets the I/O scheduling class and level of all threads.
+func setIOPriority(prio ioPriority) error {
+	value := uintptr(prio.class<<13 | prio.level)
+	return forEachThread(func(tid int) error {
+		_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), value)
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+// loadAverage returns the system load average of the last minute.
+func loadAverage() (float64, error) {
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+	return float64(info.Loads[0]) / (1 << unix.SI_LOAD_SHIFT), nil
+}
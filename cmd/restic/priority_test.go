@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseIOPriority(t *testing.T) {
+	var tests = []struct {
+		s    string
+		prio ioPriority
+	}{
+		{"idle", ioPriority{class: ioClassIdle}},
+		{"best-effort", ioPriority{class: ioClassBestEffort, level: 4}},
+		{"best-effort:0", ioPriority{class: ioClassBestEffort, level: 0}},
+		{"best-effort:7", ioPriority{class: ioClassBestEffort, level: 7}},
+	}
+
+	for _, test := range tests {
+		prio, err := parseIOPriority(test.s)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.prio, prio)
+	}
+
+	for _, s := range []string{"", "realtime", "idle:3", "best-effort:8", "best-effort:-1", "best-effort:x"} {
+		_, err := parseIOPriority(s)
+		rtest.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+func TestLimitReadersByLoad(t *testing.T) {
+	loads := make(chan float64)
+	limits := make(chan uint)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	limiter := archiver.NewReadLimiter(4)
+	done := make(chan struct{})
+	go func() {
+		limitReadersByLoad(ctx, limiter, func() (float64, error) {
+			return <-loads, nil
+		}, 2.5, 4, time.Millisecond, func(limit uint, load float64) {
+			limits <- limit
+		})
+		close(done)
+	}()
+
+	loads <- 1
+	loads <- 3
+	rtest.Equals(t, uint(1), <-limits)
+	loads <- 4
+	loads <- 2.5
+	rtest.Equals(t, uint(4), <-limits)
+	rtest.Equals(t, uint(4), limiter.Limit())
+
+	cancel()
+	// the last load check may still be waiting for a value
+	select {
+	case loads <- 0:
+	case <-done:
+	}
+	<-done
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// setNiceness sets the CPU scheduling priority of the process.
+func setNiceness(nice int) error {
+	return unix.Setpriority(unix.PRIO_PROCESS, 0, nice)
+}
+
+// setIOPriority is not implemented for this platform.
+func setIOPriority(ioPriority) error {
+	return errPriorityUnsupported
+}
+
+// loadAverage is not implemented for this platform.
+func loadAverage() (float64, error) {
+	return 0, errPriorityUnsupported
+}
@@ -0,0 +1,30 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// setNiceness sets the priority class of the process which corresponds best
+// to the niceness, Windows only knows a few priority classes.
+func setNiceness(nice int) error {
+	var class uint32
+	switch {
+	case nice >= 10:
+		class = windows.IDLE_PRIORITY_CLASS
+	case nice > 0:
+		class = windows.BELOW_NORMAL_PRIORITY_CLASS
+	case nice < 0:
+		class = windows.ABOVE_NORMAL_PRIORITY_CLASS
+	default:
+		class = windows.NORMAL_PRIORITY_CLASS
+	}
+	return windows.SetPriorityClass(windows.CurrentProcess(), class)
+}
+
+// setIOPriority is not implemented for this platform.
+func setIOPriority(ioPriority) error {
+	return errPriorityUnsupported
+}
+
+// loadAverage is not implemented for this platform.
+func loadAverage() (float64, error) {
+	return 0, errPriorityUnsupported
+}
@@ -13,9 +13,16 @@ import (
 )
 
 // calculateProgressInterval returns the interval configured via RESTIC_PROGRESS_FPS
-// or if unset returns an interval for 60fps on interactive terminals and 0 (=disabled)
-// for non-interactive terminals or when run using the --quiet flag
+// or if unset returns an interval for 60fps on interactive terminals, one second
+// for terminals without cursor control and 0 (=disabled) for non-interactive
+// terminals or when run using the --quiet flag
 func calculateProgressInterval(show bool, json bool) time.Duration {
+	return progressInterval(show, json, stdoutStatusMode())
+}
+
+// progressInterval works like calculateProgressInterval for a status which
+// is displayed using mode.
+func progressInterval(show bool, json bool, mode termstatus.StatusMode) time.Duration {
 	interval := time.Second / 60
 	fps, err := strconv.ParseFloat(os.Getenv("RESTIC_PROGRESS_FPS"), 64)
 	if err == nil && fps > 0 {
@@ -23,19 +30,34 @@ func calculateProgressInterval(show bool, json bool) time.Duration {
 			fps = 60
 		}
 		interval = time.Duration(float64(time.Second) / fps)
-	} else if !json && !stdoutCanUpdateStatus() || !show {
+	} else if !show {
 		interval = 0
+	} else if !json {
+		switch mode {
+		case termstatus.StatusCarriageReturn:
+			// the whole line is rewritten for each update, which is slow
+			// over basic SSH sessions
+			interval = time.Second
+		case termstatus.StatusLines:
+			interval = 0
+		}
 	}
 	return interval
 }
 
 // newProgressMax returns a progress.Counter that prints to stdout.
 func newProgressMax(show bool, max uint64, description string) *progress.Counter {
+	return newProgressMaxDetails(show, max, description, nil)
+}
+
+// newProgressMaxDetails works like newProgressMax, the string returned by
+// details is appended to the status.
+func newProgressMaxDetails(show bool, max uint64, description string, details func() string) *progress.Counter {
 	if !show {
 		return nil
 	}
 	interval := calculateProgressInterval(show, false)
-	canUpdateStatus := stdoutCanUpdateStatus()
+	mode := stdoutStatusMode()
 
 	return progress.New(interval, max, func(v uint64, max uint64, d time.Duration, final bool) {
 		var status string
@@ -46,15 +68,43 @@ func newProgressMax(show bool, max uint64, description string) *progress.Counter
 			status = fmt.Sprintf("[%s] %s  %d / %d %s",
 				ui.FormatDuration(d), ui.FormatPercent(v, max), v, max, description)
 		}
+		if details != nil {
+			status += ", " + details()
+		}
 
-		printProgress(status, canUpdateStatus)
+		printProgress(status, mode)
 		if final {
 			fmt.Print("\n")
 		}
 	})
 }
 
-func printProgress(status string, canUpdateStatus bool) {
+// newProgressBytes returns a progress.Counter for a number of bytes that prints
+// to stdout, the status includes the average throughput.
+func newProgressBytes(show bool, max uint64, description string) *progress.Counter {
+	if !show {
+		return nil
+	}
+	interval := calculateProgressInterval(show, false)
+	mode := stdoutStatusMode()
+
+	return progress.New(interval, max, func(v uint64, max uint64, d time.Duration, final bool) {
+		var rate uint64
+		if d > 0 {
+			rate = uint64(float64(v) / d.Seconds())
+		}
+		status := fmt.Sprintf("[%s] %s  %s / %s %s, %s/s",
+			ui.FormatDuration(d), ui.FormatPercent(v, max), ui.FormatBytes(v),
+			ui.FormatBytes(max), description, ui.FormatBytes(rate))
+
+		printProgress(status, mode)
+		if final {
+			fmt.Print("\n")
+		}
+	})
+}
+
+func printProgress(status string, mode termstatus.StatusMode) {
 	w := stdoutTerminalWidth()
 	if w > 0 {
 		if w < 3 {
@@ -69,12 +119,19 @@ func printProgress(status string, canUpdateStatus bool) {
 
 	var carriageControl, clear string
 
-	if canUpdateStatus {
+	switch mode {
+	case termstatus.StatusANSI:
 		clear = clearLine(w)
+	case termstatus.StatusCarriageReturn:
+		// overwrite the previous status with spaces
+		if w <= 0 {
+			w = 80
+		}
+		clear = strings.Repeat(" ", w-1) + "\r"
 	}
 
 	if !(strings.HasSuffix(status, "\r") || strings.HasSuffix(status, "\n")) {
-		if canUpdateStatus {
+		if mode != termstatus.StatusLines {
 			carriageControl = "\r"
 		} else {
 			carriageControl = "\n"
@@ -14,6 +14,7 @@ type secondaryRepoOptions struct {
 	RepositoryFile  string
 	PasswordFile    string
 	PasswordCommand string
+	KeyProvider     string
 	KeyHint         string
 	// repo2 options
 	LegacyRepo            string
@@ -48,12 +49,14 @@ func initSecondaryRepoOptions(f *pflag.FlagSet, opts *secondaryRepoOptions, repo
 	f.StringVarP(&opts.PasswordFile, "from-password-file", "", "", "`file` to read the source repository password from (default: $RESTIC_FROM_PASSWORD_FILE)")
 	f.StringVarP(&opts.KeyHint, "from-key-hint", "", "", "key ID of key to try decrypting the source repository first (default: $RESTIC_FROM_KEY_HINT)")
 	f.StringVarP(&opts.PasswordCommand, "from-password-command", "", "", "shell `command` to obtain the source repository password from (default: $RESTIC_FROM_PASSWORD_COMMAND)")
+	f.StringVar(&opts.KeyProvider, "from-key-provider", "", "obtain the source repository password from the key `provider` (default: $RESTIC_FROM_KEY_PROVIDER)")
 
 	opts.Repo = os.Getenv("RESTIC_FROM_REPOSITORY")
 	opts.RepositoryFile = os.Getenv("RESTIC_FROM_REPOSITORY_FILE")
 	opts.PasswordFile = os.Getenv("RESTIC_FROM_PASSWORD_FILE")
 	opts.KeyHint = os.Getenv("RESTIC_FROM_KEY_HINT")
 	opts.PasswordCommand = os.Getenv("RESTIC_FROM_PASSWORD_COMMAND")
+	opts.KeyProvider = os.Getenv("RESTIC_FROM_KEY_PROVIDER")
 }
 
 func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, repoPrefix string) (GlobalOptions, bool, error) {
@@ -62,7 +65,7 @@ func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, rep
 	}
 
 	hasFromRepo := opts.Repo != "" || opts.RepositoryFile != "" || opts.PasswordFile != "" ||
-		opts.KeyHint != "" || opts.PasswordCommand != ""
+		opts.KeyHint != "" || opts.PasswordCommand != "" || opts.KeyProvider != ""
 	hasRepo2 := opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" || opts.LegacyPasswordFile != "" ||
 		opts.LegacyKeyHint != "" || opts.LegacyPasswordCommand != ""
 
@@ -83,6 +86,7 @@ func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, rep
 		dstGopts.RepositoryFile = opts.RepositoryFile
 		dstGopts.PasswordFile = opts.PasswordFile
 		dstGopts.PasswordCommand = opts.PasswordCommand
+		dstGopts.KeyProvider = opts.KeyProvider
 		dstGopts.KeyHint = opts.KeyHint
 
 		pwdEnv = "RESTIC_FROM_PASSWORD"
@@ -96,6 +100,7 @@ func fillSecondaryGlobalOpts(opts secondaryRepoOptions, gopts GlobalOptions, rep
 		dstGopts.RepositoryFile = opts.LegacyRepositoryFile
 		dstGopts.PasswordFile = opts.LegacyPasswordFile
 		dstGopts.PasswordCommand = opts.LegacyPasswordCommand
+		dstGopts.KeyProvider = ""
 		dstGopts.KeyHint = opts.LegacyKeyHint
 
 		pwdEnv = "RESTIC_PASSWORD2"
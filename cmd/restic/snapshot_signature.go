@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// splitCommand splits command into the program and its arguments like the
+// password command.
+func splitCommand(command string) ([]string, error) {
+	args, err := backend.SplitShellStrings(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("command is empty")
+	}
+	return args, nil
+}
+
+// runSignCommand passes payload to the signing command on stdin and returns
+// the detached signature printed to stdout, e.g. by `gpg --detach-sign`.
+func runSignCommand(ctx context.Context, command string, payload []byte) ([]byte, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+
+	debug.Log("running sign command %v", args[0])
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = os.Stderr
+	signature, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("sign command failed: %v", err)
+	}
+	if len(signature) == 0 {
+		return nil, errors.New("sign command did not print a signature")
+	}
+	return signature, nil
+}
+
+// runVerifyCommand runs the verification command with the names of two files
+// appended, the first contains the signature and the second the payload, as
+// expected by e.g. `gpg --verify`. The signature is valid if the command exits
+// successfully.
+func runVerifyCommand(ctx context.Context, command string, payload, signature []byte) error {
+	args, err := splitCommand(command)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "restic-verify-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	sigFile := filepath.Join(dir, "snapshot.sig")
+	payloadFile := filepath.Join(dir, "snapshot.json")
+	if err := ioutil.WriteFile(sigFile, signature, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(payloadFile, payload, 0600); err != nil {
+		return err
+	}
+
+	debug.Log("running verify command %v", args[0])
+	args = append(args, sigFile, payloadFile)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		debug.Log("verify command output: %s", output)
+		return errors.Errorf("verify command failed: %v", err)
+	}
+	return nil
+}
+
+// signedSnapshot is a snapshot which is signed by signSnapshot.
+type signedSnapshot struct {
+	repo *repository.Repository
+	id   restic.ID
+}
+
+// signSnapshot signs the snapshot with the sign command and saves the
+// signature. The snapshot may have been saved to several repositories, it is
+// only loaded from the first one, the signature is saved to all of them.
+func signSnapshot(ctx context.Context, command string, snapshots []signedSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	payload, err := snapshots[0].repo.LoadUnpacked(ctx, restic.SnapshotFile, snapshots[0].id, nil)
+	if err != nil {
+		return err
+	}
+	signature, err := runSignCommand(ctx, command, payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, sn := range snapshots {
+		_, err := restic.SaveSignature(ctx, sn.repo, restic.NewSignature(sn.id, signature, now))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
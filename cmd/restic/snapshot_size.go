@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+)
+
+// snapshotSize is the size of the tree of a snapshot.
+type snapshotSize struct {
+	// Total is the sum of the sizes of all files, as they would be restored.
+	Total uint64 `json:"total"`
+	// Unique is the size of the distinct tree and data blobs referenced by
+	// the tree, data contained several times is only counted once.
+	Unique uint64 `json:"unique"`
+	Files  uint64 `json:"files"`
+}
+
+// treeSizesFile is the name of the file in the cache directory of the
+// repository which contains the sizes of the trees computed before. As trees
+// are identified by their contents, the entries are never outdated.
+const treeSizesFile = "tree-sizes.json"
+
+// loadTreeSizes loads the tree sizes from filename. A missing or damaged file
+// is treated like an empty one, the sizes are computed again in this case.
+func loadTreeSizes(filename string) map[string]snapshotSize {
+	sizes := make(map[string]snapshotSize)
+
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Warnf("unable to read the cached tree sizes: %v\n", err)
+		}
+		return sizes
+	}
+
+	err = json.Unmarshal(buf, &sizes)
+	if err != nil {
+		debug.Log("invalid tree sizes file %v: %v", filename, err)
+		return make(map[string]snapshotSize)
+	}
+	return sizes
+}
+
+// saveTreeSizes writes the tree sizes to filename.
+func saveTreeSizes(filename string, sizes map[string]snapshotSize) error {
+	buf, err := json.Marshal(sizes)
+	if err != nil {
+		return err
+	}
+
+	// concurrent runs never see a partially written file
+	return fs.WriteFileAtomic(filename, buf)
+}
+
+// computeTreeSize walks the tree and sums up the sizes of the files and of the
+// blobs it references. The index of repo must be loaded.
+func computeTreeSize(ctx context.Context, repo restic.Repository, tree restic.ID) (snapshotSize, error) {
+	var size snapshotSize
+	blobs := restic.NewBlobSet()
+
+	addBlob := func(h restic.BlobHandle) {
+		if blobs.Has(h) {
+			return
+		}
+		blobs.Insert(h)
+		if length, found := repo.LookupBlobSize(h.ID, h.Type); found {
+			size.Unique += uint64(length)
+		}
+	}
+	addBlob(restic.BlobHandle{ID: tree, Type: restic.TreeBlob})
+
+	err := walker.Walk(ctx, repo, tree, nil, func(_ restic.ID, _ string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		if node == nil {
+			return false, nil
+		}
+
+		switch node.Type {
+		case "file":
+			size.Files++
+			size.Total += node.Size
+			for _, id := range node.Content {
+				addBlob(restic.BlobHandle{ID: id, Type: restic.DataBlob})
+			}
+		case "dir":
+			addBlob(restic.BlobHandle{ID: *node.Subtree, Type: restic.TreeBlob})
+		}
+		return false, nil
+	})
+	return size, err
+}
+
+// snapshotSizes returns the sizes of the trees of the snapshots in list, the
+// map is indexed by the string representation of the tree ID. The sizes are
+// cached in the cache directory of the repository, only the sizes of
+// new trees are computed.
+func snapshotSizes(ctx context.Context, repo restic.Repository, gopts GlobalOptions, list restic.Snapshots, cacheDir string) (map[string]snapshotSize, error) {
+	var filename string
+	sizes := make(map[string]snapshotSize)
+	if cacheDir != "" {
+		filename = filepath.Join(cacheDir, repo.Config().ID, treeSizesFile)
+		sizes = loadTreeSizes(filename)
+	}
+
+	var missing restic.IDs
+	seen := restic.NewIDSet()
+	for _, sn := range list {
+		if sn.Tree == nil || seen.Has(*sn.Tree) {
+			continue
+		}
+		seen.Insert(*sn.Tree)
+		if _, ok := sizes[sn.Tree.String()]; !ok {
+			missing = append(missing, *sn.Tree)
+		}
+	}
+
+	if len(missing) == 0 {
+		return sizes, nil
+	}
+
+	err := repo.LoadIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bar := newProgressMax(!gopts.Quiet && !gopts.JSON, uint64(len(missing)), "snapshot sizes computed")
+	for _, id := range missing {
+		size, err := computeTreeSize(ctx, repo, id)
+		if err != nil {
+			bar.Done()
+			return nil, err
+		}
+		sizes[id.String()] = size
+		bar.Add(1)
+	}
+	bar.Done()
+
+	if filename != "" {
+		err = saveTreeSizes(filename, sizes)
+		if err != nil {
+			Warnf("unable to save the tree sizes: %v\n", err)
+		}
+	}
+	return sizes, nil
+}
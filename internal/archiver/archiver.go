@@ -36,6 +36,11 @@ type ItemStats struct {
 	TreeBlobs      int    // number of new tree blobs added for this item
 	TreeSize       uint64 // sum of the sizes of all new tree blobs
 	TreeSizeInRepo uint64 // sum of the bytes added to the repo (including compression and crypto overhead)
+
+	DataBlobsDuplicate int    // number of data blobs which were already added to the repo during this backup
+	DataSizeDuplicate  uint64 // sum of the sizes of these data blobs
+	DataBlobsExisting  int    // number of data blobs which were already present in the repo before this backup
+	DataSizeExisting   uint64 // sum of the sizes of these data blobs
 }
 
 // Add adds other to the current ItemStats.
@@ -46,6 +51,10 @@ func (s *ItemStats) Add(other ItemStats) {
 	s.TreeBlobs += other.TreeBlobs
 	s.TreeSize += other.TreeSize
 	s.TreeSizeInRepo += other.TreeSizeInRepo
+	s.DataBlobsDuplicate += other.DataBlobsDuplicate
+	s.DataSizeDuplicate += other.DataSizeDuplicate
+	s.DataBlobsExisting += other.DataBlobsExisting
+	s.DataSizeExisting += other.DataSizeExisting
 }
 
 // Archiver saves a directory structure to the repo.
@@ -78,16 +87,81 @@ type Archiver struct {
 	// StartFile is called when a file is being processed by a worker.
 	StartFile func(filename string)
 
+	// StartTarget is called with the path within the snapshot before one of
+	// the targets is saved. All items passed to CompleteItem afterwards
+	// which start with this path belong to the target.
+	StartTarget func(item string)
+
 	// CompleteBlob is called for all saved blobs for files.
 	CompleteBlob func(bytes uint64)
 
+	// ChangedDuringRead is called for files which grew or shrank while they
+	// were read, size is the size when the file was opened and read the
+	// number of bytes which were actually read and saved.
+	ChangedDuringRead func(item string, size, read uint64)
+
+	// ParallelRead is called for files which are read by several concurrent
+	// readers, see Options.ParallelReadSize.
+	ParallelRead func(item string, readers uint)
+
+	// BlobSaved is called for all data blobs once they have been saved. known
+	// is true if the blob was already present in the repository. For
+	// unchanged files, it is called once with the size of the file.
+	BlobSaved func(bytes uint64, known bool)
+
+	// ResumeFile is called for files which are not read again because they
+	// have already been saved according to Checkpoint. CompleteItem is
+	// called for these files afterwards.
+	ResumeFile func(item string)
+
+	// Checkpoint, if set, records all files which have been saved. Files
+	// contained in the checkpoint are not read again.
+	Checkpoint *Checkpoint
+
+	// SkipItem is called for all files and dirs which are excluded by
+	// SelectByName or Select. The parameter fi is nil for items excluded by
+	// SelectByName, they are excluded before running Lstat, so their type is
+	// not known.
+	SkipItem func(item string, fi os.FileInfo, reason string)
+
+	// FilesystemBoundary is called for all directories which are located on
+	// a different file system than their parent directory, for example mount
+	// points. If FilesystemBoundary is nil, the additional Lstat call for the
+	// parent directory is omitted.
+	FilesystemBoundary func(item string)
+
+	// Dereference is called with the absolute path of all symlinks. If it
+	// returns true, the target of the symlink is saved in place of the
+	// symlink. If Dereference is nil, all symlinks are saved as such.
+	Dereference func(item string) bool
+
+	// Dereferenced is called for all symlinks which have been followed,
+	// target is the path the symlink points to.
+	Dereferenced func(item, target string)
+
+	// SymlinkLoop is called for symlinks selected by Dereference which point
+	// to a directory containing the symlink. Following them would never end,
+	// so they are saved as symlinks.
+	SymlinkLoop func(item string)
+
 	// WithAtime configures if the access time for files and directories should
 	// be saved. Enabling it may result in much metadata, so it's off by
 	// default.
 	WithAtime bool
 
+	// WithBtime configures if the birth time of files and directories should
+	// be saved, if the platform and the file system record it.
+	WithBtime bool
+
 	// Flags controlling change detection. See doc/040_backup.rst for details.
 	ChangeIgnoreFlags uint
+
+	// PauseGate, if set, allows pausing reading and saving data.
+	PauseGate *PauseGate
+
+	// ReadLimiter, if set, limits the number of files read concurrently
+	// below Options.ReadConcurrency while the archiver is running.
+	ReadLimiter *ReadLimiter
 }
 
 // Flags for the ChangeIgnoreFlags bitfield.
@@ -111,6 +185,22 @@ type Options struct {
 	// SaveTreeConcurrency sets how many trees are marshalled and saved to the
 	// repo concurrently.
 	SaveTreeConcurrency uint
+
+	// ReadTimeout is the maximum duration a single read from a file may
+	// take. Files for which a read does not complete in time are skipped. If
+	// it's set to zero, reads never time out.
+	ReadTimeout time.Duration
+
+	// ParallelReadSize is the size from which on a file is read by
+	// ParallelReaders concurrent reads of consecutive ranges, which are then
+	// passed to the chunker in order. This speeds up reading single large
+	// files from fast storage. If it's set to zero, each file is read by a
+	// single reader.
+	ParallelReadSize uint64
+
+	// ParallelReaders is the number of concurrent reads for files larger
+	// than ParallelReadSize. If it's set to zero, four readers are used.
+	ParallelReaders uint
 }
 
 // ApplyDefaults returns a copy of o with the default options set for all unset
@@ -123,6 +213,10 @@ func (o Options) ApplyDefaults() Options {
 		o.ReadConcurrency = 2
 	}
 
+	if o.ParallelReaders == 0 {
+		o.ParallelReaders = 4
+	}
+
 	if o.SaveBlobConcurrency == 0 {
 		// blob saving is CPU bound due to hash checking and encryption
 		// the actual upload is handled by the repository itself
@@ -152,12 +246,67 @@ func New(repo restic.Repository, fs fs.FS, opts Options) *Archiver {
 
 		CompleteItem: func(string, *restic.Node, *restic.Node, ItemStats, time.Duration) {},
 		StartFile:    func(string) {},
+		StartTarget:  func(string) {},
 		CompleteBlob: func(uint64) {},
+		BlobSaved:    func(uint64, bool) {},
+
+		ChangedDuringRead: func(string, uint64, uint64) {},
+		ParallelRead:      func(string, uint) {},
+		ResumeFile:        func(string) {},
 	}
 
 	return arch
 }
 
+// skipItem calls arch.SkipItem if it is set. Directories get a trailing
+// slash, like for CompleteItem.
+func (arch *Archiver) skipItem(snPath string, fi os.FileInfo, reason string) {
+	if arch.SkipItem == nil {
+		return
+	}
+
+	if fi != nil && fi.IsDir() {
+		snPath += "/"
+	}
+	arch.SkipItem(snPath, fi, reason)
+}
+
+// checkBoundary calls arch.FilesystemBoundary if it is set and the directory
+// abstarget is on a different device than its parent directory. Errors are
+// ignored, the check is a no-op on platforms without device IDs.
+func (arch *Archiver) checkBoundary(snPath, abstarget string, fi os.FileInfo) {
+	if arch.FilesystemBoundary == nil {
+		return
+	}
+
+	parent := arch.FS.Dir(abstarget)
+	if parent == abstarget {
+		// the root directory has no parent
+		return
+	}
+
+	id, err := fs.DeviceID(fi)
+	if err != nil {
+		return
+	}
+
+	parentFI, err := arch.FS.Lstat(parent)
+	if err != nil {
+		debug.Log("lstat() for parent dir %v returned error: %v", parent, err)
+		return
+	}
+
+	parentID, err := fs.DeviceID(parentFI)
+	if err != nil {
+		return
+	}
+
+	if id != parentID {
+		debug.Log("%v is on device %v, its parent on %v", abstarget, id, parentID)
+		arch.FilesystemBoundary(snPath + "/")
+	}
+}
+
 // error calls arch.Error if it is set and the error is different from context.Canceled.
 func (arch *Archiver) error(item string, err error) error {
 	if arch.Error == nil || err == nil {
@@ -181,6 +330,11 @@ func (arch *Archiver) nodeFromFileInfo(snPath, filename string, fi os.FileInfo)
 	if !arch.WithAtime {
 		node.AccessTime = node.ModTime
 	}
+	if arch.WithBtime && node != nil {
+		if btime, ok := restic.BirthTime(filename, fi); ok {
+			node.BirthTime = btime
+		}
+	}
 	// overwrite name to match that within the snapshot
 	node.Name = path.Base(snPath)
 	return node, errors.Wrap(err, "NodeFromFileInfo")
@@ -215,6 +369,11 @@ func (arch *Archiver) wrapLoadTreeError(id restic.ID, err error) error {
 // SaveDir stores a directory in the repo and returns the node. snPath is the
 // path within the current snapshot.
 func (arch *Archiver) SaveDir(ctx context.Context, snPath string, dir string, fi os.FileInfo, previous *restic.Tree, complete CompleteFunc) (d FutureNode, err error) {
+	return arch.saveDir(ctx, snPath, dir, fi, fs.O_NOFOLLOW, previous, complete)
+}
+
+// saveDir implements SaveDir, the directory is opened with openFlags.
+func (arch *Archiver) saveDir(ctx context.Context, snPath string, dir string, fi os.FileInfo, openFlags int, previous *restic.Tree, complete CompleteFunc) (d FutureNode, err error) {
 	debug.Log("%v %v", snPath, dir)
 
 	treeNode, err := arch.nodeFromFileInfo(snPath, dir, fi)
@@ -222,7 +381,7 @@ func (arch *Archiver) SaveDir(ctx context.Context, snPath string, dir string, fi
 		return FutureNode{}, err
 	}
 
-	names, err := readdirnames(arch.FS, dir, fs.O_NOFOLLOW)
+	names, err := readdirnames(arch.FS, dir, openFlags)
 	if err != nil {
 		return FutureNode{}, err
 	}
@@ -343,6 +502,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 	// exclude files by path before running Lstat to reduce number of lstat calls
 	if !arch.SelectByName(abstarget) {
 		debug.Log("%v is excluded by path", target)
+		arch.skipItem(snPath, nil, "excluded by path")
 		return FutureNode{}, true, nil
 	}
 
@@ -358,9 +518,27 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 	}
 	if !arch.Select(abstarget, fi) {
 		debug.Log("%v is excluded", target)
+		arch.skipItem(snPath, fi, "excluded by file info")
 		return FutureNode{}, true, nil
 	}
 
+	// files are opened without following symlinks, unless the symlink is
+	// to be dereferenced
+	openFlags := fs.O_NOFOLLOW
+	if fi.Mode()&os.ModeSymlink != 0 && arch.Dereference != nil && arch.Dereference(abstarget) {
+		linkFI, err := arch.dereference(snPath, target, abstarget)
+		if err != nil {
+			err = arch.error(abstarget, err)
+			if err != nil {
+				return FutureNode{}, false, err
+			}
+		}
+		if linkFI != nil {
+			fi = linkFI
+			openFlags = 0
+		}
+	}
+
 	switch {
 	case fs.IsRegularFile(fi):
 		debug.Log("  %v regular file", target)
@@ -372,6 +550,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 				debug.Log("%v hasn't changed, using old list of blobs", target)
 				arch.CompleteItem(snPath, previous, previous, ItemStats{}, time.Since(start))
 				arch.CompleteBlob(previous.Size)
+				arch.BlobSaved(previous.Size, true)
 				node, err := arch.nodeFromFileInfo(snPath, target, fi)
 				if err != nil {
 					return FutureNode{}, false, err
@@ -397,9 +576,37 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 			}
 		}
 
+		// check if the file was saved by a previous, interrupted backup
+		if arch.Checkpoint != nil {
+			if content, ok := arch.Checkpoint.lookup(snPath, fi); ok {
+				node, err := arch.nodeFromFileInfo(snPath, target, fi)
+				if err != nil {
+					return FutureNode{}, false, err
+				}
+				node.Content = content
+
+				if arch.allBlobsPresent(node) {
+					debug.Log("%v has been saved before, using list of blobs from checkpoint", target)
+					arch.ResumeFile(snPath)
+					arch.CompleteItem(snPath, previous, node, ItemStats{}, time.Since(start))
+					arch.CompleteBlob(node.Size)
+					arch.BlobSaved(node.Size, true)
+
+					fn = newFutureNodeWithResult(futureNodeResult{
+						snPath: snPath,
+						target: target,
+						node:   node,
+					})
+					return fn, false, nil
+				}
+
+				debug.Log("%v is contained in the checkpoint, but contents are missing", target)
+			}
+		}
+
 		// reopen file and do an fstat() on the open file to check it is still
 		// a file (and has not been exchanged for e.g. a symlink)
-		file, err := arch.FS.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+		file, err := arch.FS.OpenFile(target, fs.O_RDONLY|openFlags, 0)
 		if err != nil {
 			debug.Log("Openfile() for %v returned error: %v", target, err)
 			err = arch.error(abstarget, err)
@@ -437,6 +644,10 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		}, func() {
 			arch.CompleteItem(snPath, nil, nil, ItemStats{}, 0)
 		}, func(node *restic.Node, stats ItemStats) {
+			// files which changed while they were read are read again
+			if node != nil && arch.Checkpoint != nil && node.Size == uint64(fi.Size()) {
+				arch.Checkpoint.add(snPath, node)
+			}
 			arch.CompleteItem(snPath, previous, node, stats, time.Since(start))
 		})
 
@@ -444,6 +655,8 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		debug.Log("  %v dir", target)
 
 		snItem := snPath + "/"
+		arch.checkBoundary(snPath, abstarget, fi)
+
 		oldSubtree, err := arch.loadSubtree(ctx, previous)
 		if err != nil {
 			err = arch.error(abstarget, err)
@@ -452,7 +665,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 			return FutureNode{}, false, err
 		}
 
-		fn, err = arch.SaveDir(ctx, snPath, target, fi, oldSubtree,
+		fn, err = arch.saveDir(ctx, snPath, target, fi, openFlags, oldSubtree,
 			func(node *restic.Node, stats ItemStats) {
 				arch.CompleteItem(snItem, previous, node, stats, time.Since(start))
 			})
@@ -514,11 +727,70 @@ func fileChanged(fi os.FileInfo, node *restic.Node, ignoreFlags uint) bool {
 	return false
 }
 
+// FileChanged reports whether the file described by fi is considered changed
+// compared to node. This uses the same rules as the archiver for deciding
+// whether the contents of a file need to be read again, ignoreFlags is a
+// combination of the ChangeIgnore* flags.
+func FileChanged(fi os.FileInfo, node *restic.Node, ignoreFlags uint) bool {
+	return fileChanged(fi, node, ignoreFlags)
+}
+
 // join returns all elements separated with a forward slash.
 func join(elem ...string) string {
 	return path.Join(elem...)
 }
 
+// dereference returns the file info of the item the symlink target points to.
+// If the symlink cannot be followed, nil is returned together with the error
+// and the symlink is saved as such.
+func (arch *Archiver) dereference(snPath, target, abstarget string) (os.FileInfo, error) {
+	fi, loop, err := followSymlink(arch.FS, target, abstarget)
+	if err != nil {
+		debug.Log("unable to follow symlink %v: %v", target, err)
+		return nil, errors.Wrap(err, "Stat")
+	}
+	if loop {
+		debug.Log("symlink %v points to a parent directory", target)
+		if arch.SymlinkLoop != nil {
+			arch.SymlinkLoop(snPath)
+		}
+		return nil, nil
+	}
+
+	if arch.Dereferenced != nil {
+		linkTarget, err := fs.Readlink(target)
+		if err != nil {
+			linkTarget = "?"
+		}
+		arch.Dereferenced(snPath, linkTarget)
+	}
+	return fi, nil
+}
+
+// followSymlink returns the file info of the item the symlink target points
+// to, abstarget is the absolute path of the symlink. loop is true if the
+// symlink points to one of the directories which contain it, either directly
+// or via other symlinks which have been followed.
+func followSymlink(filesystem fs.FS, target, abstarget string) (fi os.FileInfo, loop bool, err error) {
+	fi, err = filesystem.Stat(target)
+	if err != nil {
+		return nil, false, err
+	}
+	if !fi.IsDir() {
+		return fi, false, nil
+	}
+
+	for dir := filesystem.Dir(abstarget); ; dir = filesystem.Dir(dir) {
+		dirFI, err := filesystem.Stat(dir)
+		if err == nil && os.SameFile(fi, dirFI) {
+			return fi, true, nil
+		}
+		if filesystem.Dir(dir) == dir {
+			return fi, false, nil
+		}
+	}
+}
+
 // statDir returns the file info for the directory. Symbolic links are
 // resolved. If the target directory is not a directory, an error is returned.
 func (arch *Archiver) statDir(dir string) (os.FileInfo, error) {
@@ -575,6 +847,7 @@ func (arch *Archiver) SaveTree(ctx context.Context, snPath string, atree *Tree,
 
 		// this is a leaf node
 		if subatree.Leaf() {
+			arch.StartTarget(join(snPath, name))
 			fn, excluded, err := arch.Save(ctx, join(snPath, name), subatree.Path, previous.Find(name))
 
 			if err != nil {
@@ -676,6 +949,7 @@ func resolveRelativeTargets(filesys fs.FS, targets []string) ([]string, error) {
 // SnapshotOptions collect attributes for a new snapshot.
 type SnapshotOptions struct {
 	Tags           restic.TagList
+	Metadata       map[string]string
 	Hostname       string
 	Excludes       []string
 	Time           time.Time
@@ -706,13 +980,22 @@ func (arch *Archiver) loadParentTree(ctx context.Context, sn *restic.Snapshot) *
 // runWorkers starts the worker pools, which are stopped when the context is cancelled.
 func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group) {
 	arch.blobSaver = NewBlobSaver(ctx, wg, arch.Repo, arch.Options.SaveBlobConcurrency)
+	arch.blobSaver.Pause = arch.PauseGate
 
 	arch.fileSaver = NewFileSaver(ctx, wg,
 		arch.blobSaver.Save,
-		arch.Repo.Config().ChunkerPolynomial,
+		arch.Repo.Config(),
 		arch.Options.ReadConcurrency, arch.Options.SaveBlobConcurrency)
 	arch.fileSaver.CompleteBlob = arch.CompleteBlob
+	arch.fileSaver.BlobSaved = arch.BlobSaved
+	arch.fileSaver.ChangedDuringRead = arch.ChangedDuringRead
 	arch.fileSaver.NodeFromFileInfo = arch.nodeFromFileInfo
+	arch.fileSaver.ReadTimeout = arch.Options.ReadTimeout
+	arch.fileSaver.ParallelReadSize = arch.Options.ParallelReadSize
+	arch.fileSaver.ParallelReaders = arch.Options.ParallelReaders
+	arch.fileSaver.ParallelRead = arch.ParallelRead
+	arch.fileSaver.Pause = arch.PauseGate
+	arch.fileSaver.Limit = arch.ReadLimiter
 
 	arch.treeSaver = NewTreeSaver(ctx, wg, arch.Options.SaveTreeConcurrency, arch.blobSaver.Save, arch.Error)
 }
@@ -738,6 +1021,19 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
+	// create the snapshot first so that invalid tags are reported before any
+	// data is saved
+	sn, err := restic.NewSnapshot(targets, opts.Tags, opts.Hostname, opts.Time)
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+	sn.Metadata = opts.Metadata
+
+	err = sn.ExpandTagTemplates()
+	if err != nil {
+		return nil, restic.ID{}, err
+	}
+
 	var rootTreeID restic.ID
 
 	wgUp, wgUpCtx := errgroup.WithContext(ctx)
@@ -791,11 +1087,6 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
-	sn, err := restic.NewSnapshot(targets, opts.Tags, opts.Hostname, opts.Time)
-	if err != nil {
-		return nil, restic.ID{}, err
-	}
-
 	sn.Excludes = opts.Excludes
 	if opts.ParentSnapshot != nil {
 		sn.Parent = opts.ParentSnapshot.ID()
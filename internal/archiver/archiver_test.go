@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -1037,7 +1038,7 @@ func TestArchiverSaveTree(t *testing.T) {
 			want: TestDir{
 				"targetfile": TestFile{Content: string("foobar")},
 			},
-			stat: ItemStats{1, 6, 32 + 6, 0, 0, 0},
+			stat: ItemStats{1, 6, 32 + 6, 0, 0, 0, 0, 0, 0, 0},
 		},
 		{
 			src: TestDir{
@@ -1049,7 +1050,7 @@ func TestArchiverSaveTree(t *testing.T) {
 				"targetfile":  TestFile{Content: string("foobar")},
 				"filesymlink": TestSymlink{Target: "targetfile"},
 			},
-			stat: ItemStats{1, 6, 32 + 6, 0, 0, 0},
+			stat: ItemStats{1, 6, 32 + 6, 0, 0, 0, 0, 0, 0, 0},
 		},
 		{
 			src: TestDir{
@@ -1069,7 +1070,7 @@ func TestArchiverSaveTree(t *testing.T) {
 					"symlink": TestSymlink{Target: "subdir"},
 				},
 			},
-			stat: ItemStats{0, 0, 0, 1, 0x154, 0x16a},
+			stat: ItemStats{0, 0, 0, 1, 0x154, 0x16a, 0, 0, 0, 0},
 		},
 		{
 			src: TestDir{
@@ -1093,7 +1094,7 @@ func TestArchiverSaveTree(t *testing.T) {
 					},
 				},
 			},
-			stat: ItemStats{1, 6, 32 + 6, 3, 0x47f, 0x4c1},
+			stat: ItemStats{1, 6, 32 + 6, 3, 0x47f, 0x4c1, 0, 0, 0, 0},
 		},
 	}
 
@@ -1599,6 +1600,170 @@ func TestArchiverSnapshotSelect(t *testing.T) {
 	}
 }
 
+func TestArchiverSkipItem(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"work": TestDir{
+			"foo":     TestFile{Content: "foo"},
+			"foo.txt": TestFile{Content: "foo text file"},
+			"subdir": TestDir{
+				"other": TestFile{Content: "other in subdir"},
+			},
+		},
+	}
+
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, src)
+	defer cleanup()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.SelectByName = func(item string) bool {
+		return filepath.Base(item) != "subdir"
+	}
+	arch.Select = func(item string, fi os.FileInfo) bool {
+		return filepath.Ext(item) != ".txt"
+	}
+
+	var m sync.Mutex
+	skipped := make(map[string]string)
+	arch.SkipItem = func(item string, fi os.FileInfo, reason string) {
+		m.Lock()
+		defer m.Unlock()
+		if (fi == nil) != (reason == "excluded by path") {
+			t.Errorf("unexpected file info %v for %v excluded %v", fi, item, reason)
+		}
+		skipped[item] = reason
+	}
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	_, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"/work/subdir":  "excluded by path",
+		"/work/foo.txt": "excluded by file info",
+	}
+	if !cmp.Equal(want, skipped) {
+		t.Error(cmp.Diff(want, skipped))
+	}
+}
+
+func TestArchiverBlobSaved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"foo": TestFile{Content: "foo content"},
+		"bar": TestFile{Content: "foo content"},
+	}
+
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, src)
+	defer cleanup()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+
+	var m sync.Mutex
+	var newBytes, knownBytes uint64
+	arch.BlobSaved = func(bytes uint64, known bool) {
+		m.Lock()
+		defer m.Unlock()
+		if known {
+			knownBytes += bytes
+		} else {
+			newBytes += bytes
+		}
+	}
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	_, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both files have the same content, so one blob is new and one is known
+	if newBytes != 11 || knownBytes != 11 {
+		t.Errorf("wrong blob sizes, want 11 new and 11 known bytes, got %d and %d", newBytes, knownBytes)
+	}
+}
+
+func TestArchiverCheckpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"foo": TestFile{Content: "foo content"},
+		"sub": TestDir{
+			"bar": TestFile{Content: "bar content"},
+		},
+	}
+
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, src)
+	defer cleanup()
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	checkpoint := NewCheckpoint([]string{tempdir})
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.Checkpoint = checkpoint
+	arch.ResumeFile = func(item string) {
+		t.Errorf("unexpected resumed file %v in first backup", item)
+	}
+
+	firstSnapshot, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checkpoint.Len() != 2 {
+		t.Fatalf("expected two files in the checkpoint, got %d", checkpoint.Len())
+	}
+
+	// the second backup without a parent must not read the files again
+	testFS := &MockFS{
+		FS:        fs.Track{FS: fs.Local{}},
+		bytesRead: make(map[string]int),
+	}
+
+	arch = New(repo, testFS, Options{})
+	arch.Checkpoint = checkpoint
+
+	var m sync.Mutex
+	var resumed []string
+	arch.ResumeFile = func(item string) {
+		m.Lock()
+		defer m.Unlock()
+		resumed = append(resumed, item)
+	}
+
+	secondSnapshot, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(resumed)
+	want := []string{"/foo", "/sub/bar"}
+	if !cmp.Equal(want, resumed) {
+		t.Error(cmp.Diff(want, resumed))
+	}
+
+	if len(testFS.bytesRead) != 0 {
+		t.Errorf("files were read again: %v", testFS.bytesRead)
+	}
+
+	if !firstSnapshot.Tree.Equal(*secondSnapshot.Tree) {
+		t.Errorf("trees differ: %v and %v", firstSnapshot.Tree, secondSnapshot.Tree)
+	}
+}
+
 // MockFS keeps track which files are read.
 type MockFS struct {
 	fs.FS
@@ -2279,3 +2444,37 @@ func TestRacyFileSwap(t *testing.T) {
 		t.Errorf("Save() excluded the node, that's unexpected")
 	}
 }
+
+func TestArchiverWithBtime(t *testing.T) {
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, TestDir{"file": TestFile{Content: "foo"}})
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "file")
+	fi, err := os.Lstat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	btime, ok := restic.BirthTime(filename, fi)
+	if !ok {
+		t.Skip("birth time is not supported by the file system")
+	}
+
+	arch := New(repo, fs.Local{}, Options{})
+	node, err := arch.nodeFromFileInfo("/file", filename, fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.BirthTime.IsZero() {
+		t.Errorf("birth time %v saved without WithBtime", node.BirthTime)
+	}
+
+	arch.WithBtime = true
+	node, err = arch.nodeFromFileInfo("/file", filename, fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.BirthTime.Equal(btime) {
+		t.Errorf("wrong birth time, want %v, got %v", btime, node.BirthTime)
+	}
+}
@@ -4,9 +4,15 @@
 package archiver
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	restictest "github.com/restic/restic/internal/test"
 )
 
 type wrappedFileInfo struct {
@@ -40,3 +46,116 @@ func wrapFileInfo(t testing.TB, fi os.FileInfo) os.FileInfo {
 
 	return res
 }
+
+func TestArchiverFilesystemBoundary(t *testing.T) {
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, TestDir{
+		"mnt": TestDir{
+			"file": TestFile{Content: "foo"},
+		},
+		"other": TestDir{
+			"file": TestFile{Content: "bar"},
+		},
+	})
+	defer cleanup()
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	// pretend that mnt is located on a different device
+	fi, err := os.Lstat("mnt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := *fi.Sys().(*syscall.Stat_t)
+	stat.Dev++
+
+	testFS := &StatFS{
+		FS: fs.Local{},
+		OverrideLstat: map[string]os.FileInfo{
+			"mnt": wrappedFileInfo{FileInfo: fi, sys: &stat, mode: fi.Mode()},
+		},
+	}
+
+	var boundaries []string
+	arch := New(repo, testFS, Options{})
+	arch.FilesystemBoundary = func(item string) {
+		boundaries = append(boundaries, item)
+	}
+
+	_, _, err = arch.Snapshot(context.TODO(), []string{"."}, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(boundaries) != 1 || boundaries[0] != "/mnt/" {
+		t.Fatalf("wrong file system boundaries reported, want [/mnt/], got %v", boundaries)
+	}
+}
+
+func TestArchiverDereference(t *testing.T) {
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, TestDir{
+		"data": TestDir{
+			"file": TestFile{Content: "foo"},
+			"loop": TestSymlink{Target: "."},
+		},
+		"datalink": TestSymlink{Target: "data"},
+		"filelink": TestSymlink{Target: "data/file"},
+		"other":    TestSymlink{Target: "data"},
+		"missing":  TestSymlink{Target: "does-not-exist"},
+	})
+	defer cleanup()
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	dereference := func(item string) bool {
+		return filepath.Base(item) != "other"
+	}
+
+	sc := NewScanner(fs.Track{FS: fs.Local{}})
+	sc.Dereference = dereference
+	var stats ScanStats
+	sc.Result = func(item string, s ScanStats) {
+		if item == "" {
+			stats = s
+		}
+	}
+	sc.Error = func(item string, err error) error { return nil }
+	restictest.OK(t, sc.Scan(context.TODO(), []string{"."}))
+	restictest.Equals(t, ScanStats{Files: 3, Dirs: 2, Others: 4, Bytes: 9}, stats)
+
+	var dereferenced, loops, errs []string
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.Dereference = dereference
+	arch.Dereferenced = func(item, target string) {
+		dereferenced = append(dereferenced, item+" -> "+target)
+	}
+	arch.SymlinkLoop = func(item string) {
+		loops = append(loops, item)
+	}
+	arch.Error = func(item string, err error) error {
+		errs = append(errs, filepath.Base(item))
+		return nil
+	}
+
+	_, id, err := arch.Snapshot(context.TODO(), []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+
+	restictest.Equals(t, []string{"/datalink -> data", "/filelink -> data/file"}, dereferenced)
+	restictest.Equals(t, []string{"/data/loop", "/datalink/loop"}, loops)
+	restictest.Equals(t, []string{"missing"}, errs)
+
+	TestEnsureSnapshot(t, repo, id, TestDir{
+		"data": TestDir{
+			"file": TestFile{Content: "foo"},
+			"loop": TestSymlink{Target: "."},
+		},
+		"datalink": TestDir{
+			"file": TestFile{Content: "foo"},
+			"loop": TestSymlink{Target: "."},
+		},
+		"filelink": TestFile{Content: "foo"},
+		"other":    TestSymlink{Target: "data"},
+		"missing":  TestSymlink{Target: "does-not-exist"},
+	})
+}
@@ -2,8 +2,11 @@ package archiver
 
 import (
 	"context"
+	"encoding/binary"
+	"sync"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
 )
@@ -17,6 +20,30 @@ type Saver interface {
 type BlobSaver struct {
 	repo Saver
 	ch   chan<- saveBlobJob
+
+	// Pause is waited for before saving each blob.
+	Pause *PauseGate
+
+	// written contains the blobs which were added to the repo by this
+	// BlobSaver, pending the blobs currently being saved. The channel is
+	// closed once saving the blob has finished. written is only used for the
+	// statistics, it holds a prefix of the IDs of at most maxWrittenBlobs
+	// blobs.
+	m       sync.Mutex
+	written map[uint64]struct{}
+	pending map[restic.ID]chan struct{}
+}
+
+// maxWrittenBlobs limits the memory used to recognize blobs which are saved
+// several times in the same backup to about 40 MiB. Once the limit is reached,
+// further blobs written by the BlobSaver are reported as known to the repo
+// when they are saved again.
+const maxWrittenBlobs = 1 << 20
+
+// writtenKey returns the key of id in BlobSaver.written. Two blobs with the same
+// key are very unlikely, they would only be counted wrongly in the statistics.
+func writtenKey(id restic.ID) uint64 {
+	return binary.LittleEndian.Uint64(id[:8])
 }
 
 // NewBlobSaver returns a new blob. A worker pool is started, it is stopped
@@ -24,8 +51,10 @@ type BlobSaver struct {
 func NewBlobSaver(ctx context.Context, wg *errgroup.Group, repo Saver, workers uint) *BlobSaver {
 	ch := make(chan saveBlobJob)
 	s := &BlobSaver{
-		repo: repo,
-		ch:   ch,
+		repo:    repo,
+		ch:      ch,
+		written: make(map[uint64]struct{}),
+		pending: make(map[restic.ID]chan struct{}),
 	}
 
 	for i := uint(0); i < workers; i++ {
@@ -62,10 +91,18 @@ type SaveBlobResponse struct {
 	length     int
 	sizeInRepo int
 	known      bool
+	// duplicate is set if the blob is known because it was added to the
+	// repo earlier by the same BlobSaver.
+	duplicate bool
 }
 
 func (s *BlobSaver) saveBlob(ctx context.Context, t restic.BlobType, buf []byte) (SaveBlobResponse, error) {
-	id, known, sizeInRepo, err := s.repo.SaveBlob(ctx, t, buf, restic.ID{}, false)
+	id := repository.BlobID(buf)
+	duplicate, done := s.claim(ctx, id)
+	id, known, sizeInRepo, err := s.repo.SaveBlob(ctx, t, buf, id, false)
+	if done != nil {
+		done(err == nil && !known)
+	}
 
 	if err != nil {
 		return SaveBlobResponse{}, err
@@ -76,9 +113,48 @@ func (s *BlobSaver) saveBlob(ctx context.Context, t restic.BlobType, buf []byte)
 		length:     len(buf),
 		sizeInRepo: sizeInRepo,
 		known:      known,
+		duplicate:  known && duplicate,
 	}, nil
 }
 
+// claim returns true if the blob id was already added to the repo by s. If
+// the blob is saved concurrently, claim waits until saving it has finished.
+// Otherwise, done is returned, which must be called once the blob was saved,
+// with written set if it was added to the repo.
+func (s *BlobSaver) claim(ctx context.Context, id restic.ID) (duplicate bool, done func(written bool)) {
+	s.m.Lock()
+	for {
+		ch, ok := s.pending[id]
+		if !ok {
+			break
+		}
+		s.m.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false, nil
+		}
+		s.m.Lock()
+	}
+	defer s.m.Unlock()
+
+	if _, ok := s.written[writtenKey(id)]; ok {
+		return true, nil
+	}
+
+	ch := make(chan struct{})
+	s.pending[id] = ch
+	return false, func(written bool) {
+		s.m.Lock()
+		defer s.m.Unlock()
+		if written && len(s.written) < maxWrittenBlobs {
+			s.written[writtenKey(id)] = struct{}{}
+		}
+		delete(s.pending, id)
+		close(ch)
+	}
+}
+
 func (s *BlobSaver) worker(ctx context.Context, jobs <-chan saveBlobJob) error {
 	for {
 		var job saveBlobJob
@@ -92,6 +168,10 @@ func (s *BlobSaver) worker(ctx context.Context, jobs <-chan saveBlobJob) error {
 			}
 		}
 
+		if err := s.Pause.Wait(ctx); err != nil {
+			return nil
+		}
+
 		res, err := s.saveBlob(ctx, job.BlobType, job.buf.Data)
 		if err != nil {
 			debug.Log("saveBlob returned error, exiting: %v", err)
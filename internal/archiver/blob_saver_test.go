@@ -117,3 +117,72 @@ func TestBlobSaverError(t *testing.T) {
 		})
 	}
 }
+
+// dedupSaver behaves like a repository which already contains the blobs in
+// existing.
+type dedupSaver struct {
+	m     sync.Mutex
+	blobs restic.IDSet
+}
+
+func (s *dedupSaver) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte, id restic.ID, storeDuplicates bool) (restic.ID, bool, int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.blobs.Has(id) {
+		return id, true, 0, nil
+	}
+	s.blobs.Insert(id)
+	return id, false, len(buf), nil
+}
+
+func TestBlobSaverDuplicate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	existing := []byte("existing")
+	saver := &dedupSaver{blobs: restic.NewIDSet(restic.Hash(existing))}
+
+	wg, ctx := errgroup.WithContext(ctx)
+	b := NewBlobSaver(ctx, wg, saver, uint(runtime.NumCPU()))
+
+	var m sync.Mutex
+	var wait sync.WaitGroup
+	var results []SaveBlobResponse
+	for i := 0; i < 20; i++ {
+		data := []byte("new")
+		if i%2 == 0 {
+			data = existing
+		}
+		wait.Add(1)
+		b.Save(ctx, restic.DataBlob, &Buffer{Data: data}, func(res SaveBlobResponse) {
+			m.Lock()
+			results = append(results, res)
+			m.Unlock()
+			wait.Done()
+		})
+	}
+	wait.Wait()
+
+	var written, duplicate, known int
+	for _, res := range results {
+		switch {
+		case !res.known:
+			written++
+		case res.duplicate:
+			duplicate++
+			if res.id != restic.Hash([]byte("new")) {
+				t.Errorf("blob %v already present in the repo reported as duplicate", res.id)
+			}
+		default:
+			known++
+		}
+	}
+	if written != 1 || duplicate != 9 || known != 10 {
+		t.Errorf("wrong categories, want 1 written, 9 duplicate and 10 known, got %v, %v and %v", written, duplicate, known)
+	}
+
+	b.TriggerShutdown()
+	if err := wg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,139 @@
+package archiver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Checkpoint records the files which have been saved completely during a
+// backup. When an interrupted backup is resumed with the same targets, these
+// files are not read again if their modification time and size did not
+// change and all their blobs are present in the repository index.
+type Checkpoint struct {
+	mu      sync.Mutex
+	targets []string
+	files   map[string]checkpointFile
+}
+
+// checkpointFile is a file which has been saved, the key in the map of files
+// is the path within the snapshot.
+type checkpointFile struct {
+	ModTime time.Time  `json:"mtime"`
+	Size    uint64     `json:"size"`
+	Content restic.IDs `json:"content"`
+}
+
+// checkpointData is the format of the checkpoint on disk.
+type checkpointData struct {
+	Targets []string                  `json:"targets"`
+	Files   map[string]checkpointFile `json:"files"`
+}
+
+// NewCheckpoint returns an empty checkpoint for a backup of targets.
+func NewCheckpoint(targets []string) *Checkpoint {
+	sorted := make([]string, len(targets))
+	copy(sorted, targets)
+	sort.Strings(sorted)
+
+	return &Checkpoint{
+		targets: sorted,
+		files:   make(map[string]checkpointFile),
+	}
+}
+
+// LoadCheckpoint loads the checkpoint from filename. If the file does not
+// exist or the checkpoint was written for a different set of targets, an
+// empty checkpoint is returned.
+func LoadCheckpoint(filename string, targets []string) (*Checkpoint, error) {
+	c := NewCheckpoint(targets)
+
+	buf, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile")
+	}
+
+	var data checkpointData
+	err = json.Unmarshal(buf, &data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	if !equalTargets(c.targets, data.Targets) {
+		debug.Log("targets changed from %v to %v, ignoring checkpoint", data.Targets, c.targets)
+		return c, nil
+	}
+
+	if data.Files != nil {
+		c.files = data.Files
+	}
+	return c, nil
+}
+
+func equalTargets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Save writes the checkpoint to filename. The file is replaced atomically so
+// that an interrupted write does not destroy the previous checkpoint.
+func (c *Checkpoint) Save(filename string) error {
+	c.mu.Lock()
+	buf, err := json.Marshal(checkpointData{Targets: c.targets, Files: c.files})
+	c.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	return errors.WithStack(fs.WriteFileAtomic(filename, buf))
+}
+
+// Len returns the number of files in the checkpoint.
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.files)
+}
+
+// add records that the file at snPath has been saved as node.
+func (c *Checkpoint) add(snPath string, node *restic.Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files[snPath] = checkpointFile{
+		ModTime: node.ModTime,
+		Size:    node.Size,
+		Content: node.Content,
+	}
+}
+
+// lookup returns the list of blobs for the file at snPath if it has been
+// saved before and its modification time and size match fi.
+func (c *Checkpoint) lookup(snPath string, fi os.FileInfo) (restic.IDs, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.files[snPath]
+	if !ok || !f.ModTime.Equal(fi.ModTime()) || f.Size != uint64(fi.Size()) {
+		return nil, false
+	}
+	return f.Content, true
+}
@@ -0,0 +1,64 @@
+package archiver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+type checkpointFileInfo struct {
+	os.FileInfo
+	modTime time.Time
+	size    int64
+}
+
+func (fi checkpointFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi checkpointFileInfo) Size() int64        { return fi.size }
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	tempdir, cleanup := restictest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "sub", "checkpoint")
+	modTime := time.Date(2021, 3, 7, 14, 5, 9, 123456789, time.UTC)
+	content := restic.IDs{restic.NewRandomID(), restic.NewRandomID()}
+
+	c := NewCheckpoint([]string{"/b", "/a"})
+	c.add("/a/foo", &restic.Node{ModTime: modTime, Size: 23, Content: content})
+	restictest.OK(t, c.Save(filename))
+
+	// the order of the targets does not matter
+	c, err := LoadCheckpoint(filename, []string{"/a", "/b"})
+	restictest.OK(t, err)
+	restictest.Equals(t, 1, c.Len())
+
+	ids, ok := c.lookup("/a/foo", checkpointFileInfo{modTime: modTime.Local(), size: 23})
+	restictest.Assert(t, ok, "file not found in checkpoint")
+	restictest.Equals(t, content, ids)
+
+	// modified files are not resumed
+	_, ok = c.lookup("/a/foo", checkpointFileInfo{modTime: modTime.Add(time.Second), size: 23})
+	restictest.Assert(t, !ok, "file with different mtime found in checkpoint")
+	_, ok = c.lookup("/a/foo", checkpointFileInfo{modTime: modTime, size: 24})
+	restictest.Assert(t, !ok, "file with different size found in checkpoint")
+	_, ok = c.lookup("/a/bar", checkpointFileInfo{modTime: modTime, size: 23})
+	restictest.Assert(t, !ok, "unknown file found in checkpoint")
+
+	// the checkpoint is invalidated if the targets change
+	c, err = LoadCheckpoint(filename, []string{"/a"})
+	restictest.OK(t, err)
+	restictest.Equals(t, 0, c.Len())
+}
+
+func TestCheckpointLoadMissing(t *testing.T) {
+	tempdir, cleanup := restictest.TempDir(t)
+	defer cleanup()
+
+	c, err := LoadCheckpoint(filepath.Join(tempdir, "missing"), []string{"/a"})
+	restictest.OK(t, err)
+	restictest.Equals(t, 0, c.Len())
+}
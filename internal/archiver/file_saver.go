@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/debug"
@@ -22,31 +23,73 @@ type FileSaver struct {
 	saveFilePool *BufferPool
 	saveBlob     SaveBlobFn
 
-	pol chunker.Pol
+	fileWorkers      uint
+	parallelReadOnce sync.Once
+	parallelReadPool *BufferPool
+
+	pol              chunker.Pol
+	minSize, maxSize uint
+	averageBits      int
 
 	ch chan<- saveFileJob
 
 	CompleteBlob func(bytes uint64)
 
+	// ChangedDuringRead is called for files for which the number of bytes
+	// read differs from the size reported when the file was opened.
+	ChangedDuringRead func(snPath string, size, read uint64)
+
+	// BlobSaved is called for each data blob once it has been saved, known
+	// is true if the blob was already present in the repository.
+	BlobSaved func(bytes uint64, known bool)
+
+	// Files of at least ParallelReadSize bytes are read by ParallelReaders
+	// concurrent readers and ParallelRead is called for them. A
+	// ParallelReadSize of zero disables parallel reads.
+	ParallelRead     func(snPath string, readers uint)
+	ParallelReadSize uint64
+	ParallelReaders  uint
+
 	NodeFromFileInfo func(snPath, filename string, fi os.FileInfo) (*restic.Node, error)
+
+	// ReadTimeout aborts reading a file if a single read takes longer. Zero
+	// disables the timeout.
+	ReadTimeout time.Duration
+
+	// Pause is waited for before reading each chunk of a file.
+	Pause *PauseGate
+
+	// Limit is acquired by the workers before reading each file.
+	Limit *ReadLimiter
 }
 
-// NewFileSaver returns a new file saver. A worker pool with fileWorkers is
-// started, it is stopped when ctx is cancelled.
-func NewFileSaver(ctx context.Context, wg *errgroup.Group, save SaveBlobFn, pol chunker.Pol, fileWorkers, blobWorkers uint) *FileSaver {
+// NewFileSaver returns a new file saver. Files are split into chunks with the
+// chunker parameters from the repository config cfg. A worker pool with
+// fileWorkers is started, it is stopped when ctx is cancelled.
+func NewFileSaver(ctx context.Context, wg *errgroup.Group, save SaveBlobFn, cfg restic.Config, fileWorkers, blobWorkers uint) *FileSaver {
 	ch := make(chan saveFileJob)
 
 	debug.Log("new file saver with %v file workers and %v blob workers", fileWorkers, blobWorkers)
 
 	poolSize := fileWorkers + blobWorkers
 
+	minSize, maxSize, averageBits := cfg.ChunkerSizes()
+
 	s := &FileSaver{
 		saveBlob:     save,
-		saveFilePool: NewBufferPool(int(poolSize), chunker.MaxSize),
-		pol:          pol,
+		saveFilePool: NewBufferPool(int(poolSize), int(maxSize)),
+		fileWorkers:  fileWorkers,
+		pol:          cfg.ChunkerPolynomial,
+		minSize:      minSize,
+		maxSize:      maxSize,
+		averageBits:  averageBits,
 		ch:           ch,
 
 		CompleteBlob: func(uint64) {},
+		BlobSaved:    func(uint64, bool) {},
+
+		ChangedDuringRead: func(string, uint64, uint64) {},
+		ParallelRead:      func(string, uint) {},
 	}
 
 	for i := uint(0); i < fileWorkers; i++ {
@@ -59,6 +102,16 @@ func NewFileSaver(ctx context.Context, wg *errgroup.Group, save SaveBlobFn, pol
 	return s
 }
 
+// parallelReadBuffers returns the pool of buffers for parallel reads. It is
+// created when a file is read in parallel for the first time, ParallelReaders
+// cannot change anymore then, and keeps enough buffers for all workers.
+func (s *FileSaver) parallelReadBuffers() *BufferPool {
+	s.parallelReadOnce.Do(func() {
+		s.parallelReadPool = NewBufferPool(int(s.fileWorkers*(s.ParallelReaders+1)), parallelReadBlockSize)
+	})
+	return s.parallelReadPool
+}
+
 func (s *FileSaver) TriggerShutdown() {
 	close(s.ch)
 }
@@ -163,13 +216,38 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 		return
 	}
 
-	// reuse the chunker
-	chnker.Reset(f, s.pol)
+	var rd io.Reader = f
+	if s.ParallelReadSize > 0 && s.ParallelReaders > 1 && uint64(fi.Size()) >= s.ParallelReadSize {
+		// files which are not read from the local file system, e.g. stdin,
+		// may not support reading at an offset
+		if ra, ok := f.(io.ReaderAt); ok {
+			debug.Log("%v: reading with %d parallel readers", snPath, s.ParallelReaders)
+			pr := newParallelReader(ctx, ra, int(s.ParallelReaders), s.parallelReadBuffers())
+			defer func() {
+				_ = pr.Close()
+			}()
+			rd = pr
+			s.ParallelRead(snPath, s.ParallelReaders)
+		}
+	}
+	if s.ReadTimeout > 0 {
+		rd = newTimeoutReader(rd, target, s.ReadTimeout)
+	}
+
+	// reuse the chunker, resetting it also resets the average chunk size
+	chnker.ResetWithBoundaries(rd, s.pol, s.minSize, s.maxSize)
+	chnker.SetAverageBits(s.averageBits)
 
 	node.Content = []restic.ID{}
 	node.Size = 0
 	var idx int
 	for {
+		if err := s.Pause.Wait(ctx); err != nil {
+			_ = f.Close()
+			completeError(err)
+			return
+		}
+
 		buf := s.saveFilePool.Get()
 		chunk, err := chnker.Next(buf.Data)
 		if err == io.EOF {
@@ -198,15 +276,24 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 
 		s.saveBlob(ctx, restic.DataBlob, buf, func(sbr SaveBlobResponse) {
 			lock.Lock()
-			if !sbr.known {
+			switch {
+			case !sbr.known:
 				fnr.stats.DataBlobs++
 				fnr.stats.DataSize += uint64(sbr.length)
 				fnr.stats.DataSizeInRepo += uint64(sbr.sizeInRepo)
+			case sbr.duplicate:
+				fnr.stats.DataBlobsDuplicate++
+				fnr.stats.DataSizeDuplicate += uint64(sbr.length)
+			default:
+				fnr.stats.DataBlobsExisting++
+				fnr.stats.DataSizeExisting += uint64(sbr.length)
 			}
 
 			node.Content[pos] = sbr.id
 			lock.Unlock()
 
+			s.BlobSaved(uint64(sbr.length), sbr.known)
+
 			completeBlob()
 		})
 		idx++
@@ -221,6 +308,11 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 		s.CompleteBlob(uint64(len(chunk.Data)))
 	}
 
+	if node.Size != uint64(fi.Size()) {
+		debug.Log("%v: size changed during read, expected %d bytes, read %d", snPath, fi.Size(), node.Size)
+		s.ChangedDuringRead(snPath, uint64(fi.Size()), node.Size)
+	}
+
 	err = f.Close()
 	if err != nil {
 		completeError(err)
@@ -239,7 +331,7 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 
 func (s *FileSaver) worker(ctx context.Context, jobs <-chan saveFileJob) {
 	// a worker has one chunker which is reused for each file (because it contains a rather large buffer)
-	chnker := chunker.New(nil, s.pol)
+	chnker := chunker.NewWithBoundaries(nil, s.pol, s.minSize, s.maxSize)
 
 	for {
 		var job saveFileJob
@@ -253,6 +345,13 @@ func (s *FileSaver) worker(ctx context.Context, jobs <-chan saveFileJob) {
 			}
 		}
 
+		if err := s.Limit.Acquire(ctx); err != nil {
+			debug.Log("not reading file, context is cancelled: %v", err)
+			_ = job.file.Close()
+			close(job.ch)
+			continue
+		}
+
 		s.saveFile(ctx, chnker, job.snPath, job.target, job.file, job.fi, job.start, func() {
 			if job.completeReading != nil {
 				job.completeReading()
@@ -264,5 +363,6 @@ func (s *FileSaver) worker(ctx context.Context, jobs <-chan saveFileJob) {
 			job.ch <- res
 			close(job.ch)
 		})
+		s.Limit.Release()
 	}
 }
@@ -44,7 +44,7 @@ func startFileSaver(ctx context.Context, t testing.TB) (*FileSaver, context.Cont
 		t.Fatal(err)
 	}
 
-	s := NewFileSaver(ctx, wg, saveBlob, pol, workers, workers)
+	s := NewFileSaver(ctx, wg, saveBlob, restic.Config{ChunkerPolynomial: pol}, workers, workers)
 	s.NodeFromFileInfo = func(snPath, filename string, fi os.FileInfo) (*restic.Node, error) {
 		return restic.NodeFromFileInfo(filename, fi)
 	}
@@ -97,3 +97,120 @@ func TestFileSaver(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFileSaverChangedDuringRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	files, cleanup := createTestFiles(t, 1)
+	defer cleanup()
+	filename := files[0]
+
+	s, ctx, wg := startFileSaver(ctx, t)
+
+	var changed []string
+	var size, read uint64
+	s.ChangedDuringRead = func(snPath string, s, r uint64) {
+		changed = append(changed, snPath)
+		size, read = s, r
+	}
+
+	f, err := fs.Local{}.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file grows after it has been opened
+	err = ioutil.WriteFile(filename, []byte("testfile-0 and some more data"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ff := s.Save(ctx, "/file", filename, f, fi, func() {}, func() {}, func(*restic.Node, ItemStats) {})
+	fnr := ff.take(ctx)
+	if fnr.err != nil {
+		t.Fatal(fnr.err)
+	}
+
+	s.TriggerShutdown()
+	if err := wg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changed) != 1 || changed[0] != "/file" {
+		t.Fatalf("expected change for /file, got %v", changed)
+	}
+	if size != 10 || read != 29 {
+		t.Errorf("wrong sizes, want 10 and 29, got %d and %d", size, read)
+	}
+	if fnr.node.Size != read {
+		t.Errorf("node size %d does not match bytes read %d", fnr.node.Size, read)
+	}
+}
+
+func TestFileSaverParallelRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, cleanup := test.TempDir(t)
+	defer cleanup()
+	filename := filepath.Join(tempdir, "large")
+	err := ioutil.WriteFile(filename, test.Random(42, parallelReadBlockSize*2+123), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg, ctx := errgroup.WithContext(ctx)
+	saveBlob := func(ctx context.Context, tpe restic.BlobType, buf *Buffer, cb func(SaveBlobResponse)) {
+		cb(SaveBlobResponse{id: restic.Hash(buf.Data), length: len(buf.Data)})
+	}
+	pol, err := chunker.RandomPolynomial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewFileSaver(ctx, wg, saveBlob, restic.Config{ChunkerPolynomial: pol}, 1, 1)
+	s.NodeFromFileInfo = func(snPath, filename string, fi os.FileInfo) (*restic.Node, error) {
+		return restic.NodeFromFileInfo(filename, fi)
+	}
+
+	var parallel []string
+	s.ParallelRead = func(snPath string, readers uint) {
+		parallel = append(parallel, snPath)
+	}
+
+	save := func() *restic.Node {
+		f, err := fs.Local{}.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ff := s.Save(ctx, "/large", filename, f, fi, func() {}, func() {}, func(*restic.Node, ItemStats) {})
+		fnr := ff.take(ctx)
+		if fnr.err != nil {
+			t.Fatal(fnr.err)
+		}
+		return fnr.node
+	}
+
+	sequential := save()
+	s.ParallelReadSize = 1
+	s.ParallelReaders = 3
+	node := save()
+
+	s.TriggerShutdown()
+	if err := wg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	test.Equals(t, []string{"/large"}, parallel)
+	test.Equals(t, sequential.Size, node.Size)
+	test.Equals(t, sequential.Content, node.Content)
+}
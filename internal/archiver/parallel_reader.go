@@ -0,0 +1,147 @@
+package archiver
+
+import (
+	"context"
+	"io"
+)
+
+// parallelReadBlockSize is the size of the ranges of a file which are read
+// concurrently by a parallelReader.
+const parallelReadBlockSize = 8 * 1024 * 1024
+
+// parallelReader reads consecutive ranges of a file with several concurrent
+// ReadAt calls and returns the data in the original order. The content
+// defined chunker needs a continuous stream of bytes to find the same chunk
+// boundaries, so only the reads are parallelized, not the chunking.
+type parallelReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	pool   *BufferPool
+
+	// pending holds the ranges in the order of their offsets
+	pending chan chan rangeRead
+	// slots limits the number of buffers in use and thereby the amount of
+	// data read ahead
+	slots chan struct{}
+
+	buf *Buffer // buffer of the current range, released when done
+	cur []byte  // remaining data of the current range
+	err error
+}
+
+type rangeRead struct {
+	buf *Buffer
+	n   int
+	err error
+}
+
+// newParallelReader starts reading rd with readers concurrent reads. The
+// buffers are taken from pool, each read fills a whole buffer. Close must be
+// called to stop reading.
+func newParallelReader(ctx context.Context, rd io.ReaderAt, readers int, pool *BufferPool) *parallelReader {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &parallelReader{
+		ctx:     ctx,
+		cancel:  cancel,
+		pool:    pool,
+		pending: make(chan chan rangeRead, readers),
+		slots:   make(chan struct{}, readers+1),
+	}
+
+	go r.readAhead(ctx, rd, int64(pool.defaultSize))
+	return r
+}
+
+// readAhead starts reading the next range whenever a slot is free. It does
+// not know where the file ends, so a few ranges after the end may be read
+// before the reader is closed. When it stops, the ranges which have not been
+// consumed are discarded.
+func (r *parallelReader) readAhead(ctx context.Context, rd io.ReaderAt, blockSize int64) {
+	defer r.discardPending()
+
+	for offset := int64(0); ; offset += blockSize {
+		select {
+		case r.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		ch := make(chan rangeRead, 1)
+		select {
+		case r.pending <- ch:
+		case <-ctx.Done():
+			<-r.slots
+			return
+		}
+
+		buf := r.pool.Get()
+		go func(offset int64) {
+			n, err := rd.ReadAt(buf.Data, offset)
+			ch <- rangeRead{buf: buf, n: n, err: err}
+		}(offset)
+	}
+}
+
+// release returns buf to the pool and frees its slot.
+func (r *parallelReader) release(buf *Buffer) {
+	buf.Release()
+	<-r.slots
+}
+
+// discardPending releases the buffers of all pending ranges once their reads
+// have completed, without waiting for the reads.
+func (r *parallelReader) discardPending() {
+	for {
+		select {
+		case ch := <-r.pending:
+			go func() {
+				res := <-ch
+				r.release(res.buf)
+			}()
+		default:
+			return
+		}
+	}
+}
+
+func (r *parallelReader) Read(p []byte) (int, error) {
+	for len(r.cur) == 0 {
+		if r.buf != nil {
+			r.release(r.buf)
+			r.buf = nil
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		var ch chan rangeRead
+		select {
+		case ch = <-r.pending:
+		case <-r.ctx.Done():
+			r.err = r.ctx.Err()
+			return 0, r.err
+		}
+
+		res := <-ch
+		r.buf = res.buf
+		r.cur = res.buf.Data[:res.n]
+		// a short read marks the end of the file or an error, the ranges
+		// after it are not needed anymore
+		r.err = res.err
+		if r.err != nil {
+			r.cancel()
+		}
+	}
+
+	n := copy(p, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+// Close stops reading ahead. It does not wait for running reads, a read which
+// hangs must not block the caller. The buffers of the running reads are
+// returned to the pool once the reads complete.
+func (r *parallelReader) Close() error {
+	r.cancel()
+	return nil
+}
@@ -0,0 +1,105 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParallelReader(t *testing.T) {
+	for _, size := range []int{0, 1, 4096, 4096*10 + 17} {
+		data := rtest.Random(23, size)
+
+		for _, readers := range []int{1, 2, 5} {
+			rd := newParallelReader(context.TODO(), bytes.NewReader(data), readers, NewBufferPool(readers+1, 4096))
+			buf, err := ioutil.ReadAll(rd)
+			rtest.OK(t, err)
+			rtest.OK(t, rd.Close())
+
+			if !bytes.Equal(data, buf) {
+				t.Errorf("size %d, %d readers: wrong data returned", size, readers)
+			}
+		}
+	}
+}
+
+// failingReaderAt returns an error for reads at or after offset.
+type failingReaderAt struct {
+	rd     io.ReaderAt
+	offset int64
+}
+
+var errReadFailed = errors.New("read failed")
+
+func (r failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.offset {
+		return 0, errReadFailed
+	}
+	return r.rd.ReadAt(p, off)
+}
+
+func TestParallelReaderError(t *testing.T) {
+	data := rtest.Random(23, 4096*10)
+	rd := newParallelReader(context.TODO(), failingReaderAt{bytes.NewReader(data), 4096 * 3}, 3, NewBufferPool(4, 4096))
+	defer func() {
+		_ = rd.Close()
+	}()
+
+	buf, err := ioutil.ReadAll(rd)
+	rtest.Assert(t, errors.Is(err, errReadFailed), "wrong error %v", err)
+	rtest.Equals(t, data[:4096*3], buf)
+}
+
+func TestParallelReaderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rd := newParallelReader(ctx, bytes.NewReader(rtest.Random(23, 4096*10)), 2, NewBufferPool(3, 4096))
+	defer func() {
+		_ = rd.Close()
+	}()
+
+	cancel()
+	// data which has been read already may be returned before the error
+	_, err := ioutil.ReadAll(rd)
+	rtest.Assert(t, errors.Is(err, context.Canceled), "wrong error %v", err)
+}
+
+// blockingReaderAt blocks all reads at or after offset until unblock is closed.
+type blockingReaderAt struct {
+	rd      io.ReaderAt
+	offset  int64
+	unblock chan struct{}
+}
+
+func (r blockingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.offset {
+		<-r.unblock
+	}
+	return r.rd.ReadAt(p, off)
+}
+
+func TestParallelReaderClose(t *testing.T) {
+	pool := NewBufferPool(3, 4096)
+	unblock := make(chan struct{})
+	rd := newParallelReader(context.TODO(), blockingReaderAt{bytes.NewReader(rtest.Random(23, 4096*10)), 4096, unblock}, 2, pool)
+
+	_, err := io.ReadFull(rd, make([]byte, 4096))
+	rtest.OK(t, err)
+
+	// Close must not wait for the hanging reads
+	rtest.OK(t, rd.Close())
+
+	// the buffers of the pending ranges are returned once the reads complete,
+	// the buffer of the current range is kept by the closed reader
+	close(unblock)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pool.ch) != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	rtest.Equals(t, 2, len(pool.ch))
+}
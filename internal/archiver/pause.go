@@ -0,0 +1,80 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+)
+
+// PauseGate allows pausing the workers of an archiver. While paused, workers
+// block before reading the next chunk of a file or saving the next blob. A nil
+// PauseGate is never paused.
+type PauseGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+}
+
+// NewPauseGate returns a new PauseGate which is not paused.
+func NewPauseGate() *PauseGate {
+	g := &PauseGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// Toggle pauses the gate if it is running and resumes it otherwise. It
+// returns true if the gate is now paused.
+func (g *PauseGate) Toggle() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.paused = !g.paused
+	if !g.paused {
+		g.cond.Broadcast()
+	}
+	return g.paused
+}
+
+// Paused returns true if the gate is paused.
+func (g *PauseGate) Paused() bool {
+	if g == nil {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// Wait blocks while the gate is paused. It returns early with an error when
+// ctx is cancelled.
+func (g *PauseGate) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.paused {
+		return nil
+	}
+
+	// wake up the waiting goroutine when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			g.mu.Lock()
+			g.cond.Broadcast()
+			g.mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	for g.paused && ctx.Err() == nil {
+		g.cond.Wait()
+	}
+
+	return ctx.Err()
+}
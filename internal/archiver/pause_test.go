@@ -0,0 +1,62 @@
+package archiver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPauseGateNil(t *testing.T) {
+	var g *PauseGate
+	if g.Paused() {
+		t.Error("nil gate must not be paused")
+	}
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPauseGate(t *testing.T) {
+	g := NewPauseGate()
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !g.Toggle() {
+		t.Fatal("gate not paused")
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- g.Wait(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Wait returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if g.Toggle() {
+		t.Fatal("gate still paused")
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPauseGateCancel(t *testing.T) {
+	g := NewPauseGate()
+	g.Toggle()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- g.Wait(ctx)
+	}()
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
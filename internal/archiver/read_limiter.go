@@ -0,0 +1,103 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+)
+
+// ReadLimiter limits the number of files which are read concurrently. The
+// limit can be changed while the archiver is running, workers which would
+// exceed it block before reading the next file. A nil ReadLimiter does not
+// limit anything.
+type ReadLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  uint
+	active uint
+}
+
+// NewReadLimiter returns a new ReadLimiter which allows reading limit files
+// concurrently.
+func NewReadLimiter(limit uint) *ReadLimiter {
+	l := &ReadLimiter{}
+	l.cond = sync.NewCond(&l.mu)
+	l.SetLimit(limit)
+	return l
+}
+
+// SetLimit changes the number of files which may be read concurrently. At
+// least one file can always be read. Files which are already being read when
+// the limit is lowered are read to the end.
+func (l *ReadLimiter) SetLimit(limit uint) {
+	if limit == 0 {
+		limit = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit > l.limit {
+		l.cond.Broadcast()
+	}
+	l.limit = limit
+}
+
+// Limit returns the current limit.
+func (l *ReadLimiter) Limit() uint {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Acquire blocks until another file may be read. It returns early with an
+// error when ctx is cancelled. Each successful call must be followed by a call
+// to Release once the file has been read.
+func (l *ReadLimiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active < l.limit {
+		l.active++
+		return nil
+	}
+
+	// wake up the waiting goroutine when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.cond.Broadcast()
+			l.mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	for l.active >= l.limit && ctx.Err() == nil {
+		l.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	l.active++
+	return nil
+}
+
+// Release marks a file which was started with Acquire as read completely.
+func (l *ReadLimiter) Release() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.cond.Signal()
+}
@@ -0,0 +1,75 @@
+package archiver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReadLimiterNil(t *testing.T) {
+	var l *ReadLimiter
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+}
+
+func TestReadLimiter(t *testing.T) {
+	l := NewReadLimiter(2)
+	for i := 0; i < 2; i++ {
+		if err := l.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- l.Acquire(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Acquire returned while the limit is reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// lowering the limit does not unblock the waiting reader
+	l.SetLimit(1)
+	l.Release()
+	select {
+	case <-done:
+		t.Fatal("Acquire returned while the lowered limit is reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.SetLimit(3)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if l.Limit() != 3 {
+		t.Fatalf("unexpected limit %d", l.Limit())
+	}
+
+	l.SetLimit(0)
+	if l.Limit() != 1 {
+		t.Fatalf("limit 0 was not raised to 1, got %d", l.Limit())
+	}
+}
+
+func TestReadLimiterCancel(t *testing.T) {
+	l := NewReadLimiter(1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Acquire(ctx)
+	}()
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
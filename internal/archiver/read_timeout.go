@@ -0,0 +1,70 @@
+package archiver
+
+import (
+	"io"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ErrReadTimeout is returned when a single read from a file does not complete
+// within the configured read timeout.
+var ErrReadTimeout = errors.New("read timeout")
+
+type readResult struct {
+	n   int
+	err error
+}
+
+// timeoutReader wraps a reader and aborts every read call which takes longer
+// than timeout. A read which has timed out cannot be cancelled, it is left
+// running in the background and all further reads return an error.
+type timeoutReader struct {
+	rd      io.Reader
+	name    string
+	timeout time.Duration
+
+	buf []byte
+	err error
+}
+
+func newTimeoutReader(rd io.Reader, name string, timeout time.Duration) *timeoutReader {
+	return &timeoutReader{
+		rd:      rd,
+		name:    name,
+		timeout: timeout,
+	}
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	// read into a separate buffer, p must not be written to by a read which
+	// is still hanging after this function has returned
+	if cap(r.buf) < len(p) {
+		r.buf = make([]byte, len(p))
+	}
+	buf := r.buf[:len(p)]
+
+	ch := make(chan readResult, 1)
+	go func() {
+		n, err := r.rd.Read(buf)
+		ch <- readResult{n: n, err: err}
+	}()
+
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-ch:
+		copy(p, buf[:res.n])
+		return res.n, res.err
+	case <-timer.C:
+		// the buffer is still owned by the hanging read
+		r.buf = nil
+		r.err = errors.Wrapf(ErrReadTimeout, "reading %v did not complete within %v", r.name, r.timeout)
+		return 0, r.err
+	}
+}
@@ -0,0 +1,60 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// blockingReader returns data from rd until it is empty and then blocks
+// until unblock is closed.
+type blockingReader struct {
+	rd      io.Reader
+	unblock chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	if err == io.EOF {
+		<-r.unblock
+	}
+	return n, err
+}
+
+func TestTimeoutReader(t *testing.T) {
+	data := []byte("foobar")
+	rd := newTimeoutReader(bytes.NewReader(data), "file", time.Second)
+
+	buf, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Errorf("wrong data returned, want %q, got %q", data, buf)
+	}
+}
+
+func TestTimeoutReaderTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	data := []byte("foobar")
+	rd := newTimeoutReader(&blockingReader{rd: bytes.NewReader(data), unblock: unblock}, "file", 10*time.Millisecond)
+
+	buf, err := ioutil.ReadAll(rd)
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Errorf("wrong data returned, want %q, got %q", data, buf)
+	}
+
+	// all further reads must fail immediately
+	_, err = rd.Read(make([]byte, 10))
+	if !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
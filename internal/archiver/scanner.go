@@ -3,8 +3,10 @@ package archiver
 import (
 	"context"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"sync"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
@@ -12,13 +14,28 @@ import (
 
 // Scanner  traverses the targets and calls the function Result with cumulated
 // stats concerning the files and folders found. Select is used to decide which
-// items should be included. Error is called when an error occurs.
+// items should be included. Error is called when an error occurs. The
+// callbacks are never called concurrently.
 type Scanner struct {
 	FS           fs.FS
 	SelectByName SelectByNameFunc
 	Select       SelectFunc
 	Error        ErrorFunc
 	Result       func(item string, s ScanStats)
+
+	// TopLevel, if set, is called once a top-level item has been scanned,
+	// with the stats for this item only. Top-level items are the entries of
+	// all targets which are directories and the targets which are not a
+	// directory. The item is the path within the snapshot, like for
+	// Archiver.CompleteItem but without a trailing slash.
+	TopLevel func(item string, s ScanStats)
+
+	// Dereference, if set, selects the symlinks which are followed, like
+	// for Archiver.Dereference.
+	Dereference func(item string) bool
+
+	// Concurrency is the number of targets which are scanned in parallel.
+	Concurrency uint
 }
 
 // NewScanner initializes a new Scanner.
@@ -29,6 +46,7 @@ func NewScanner(fs fs.FS) *Scanner {
 		Select:       func(item string, fi os.FileInfo) bool { return true },
 		Error:        func(item string, err error) error { return err },
 		Result:       func(item string, s ScanStats) {},
+		Concurrency:  2,
 	}
 }
 
@@ -38,40 +56,103 @@ type ScanStats struct {
 	Bytes               uint64
 }
 
-func (s *Scanner) scanTree(ctx context.Context, stats ScanStats, tree Tree) (ScanStats, error) {
-	// traverse the path in the file system for all leaf nodes
-	if tree.Leaf() {
-		abstarget, err := s.FS.Abs(tree.Path)
-		if err != nil {
-			return ScanStats{}, err
-		}
+// sub returns the difference between s and before.
+func (s ScanStats) sub(before ScanStats) ScanStats {
+	return ScanStats{
+		Files:  s.Files - before.Files,
+		Dirs:   s.Dirs - before.Dirs,
+		Others: s.Others - before.Others,
+		Bytes:  s.Bytes - before.Bytes,
+	}
+}
 
-		stats, err = s.scan(ctx, stats, abstarget)
-		if err != nil {
-			return ScanStats{}, err
-		}
+// scanTarget is a leaf of the tree which is scanned by one of the workers.
+type scanTarget struct {
+	path   string
+	snPath string
+}
 
-		return stats, nil
+// collectTargets returns the leaf nodes of tree in a deterministic order,
+// snPath is the path of tree within the snapshot.
+func collectTargets(snPath string, tree Tree) []scanTarget {
+	if tree.Leaf() {
+		return []scanTarget{{path: tree.Path, snPath: snPath}}
 	}
 
-	// otherwise recurse into the nodes in a deterministic order
+	var targets []scanTarget
 	for _, name := range tree.NodeNames() {
-		var err error
-		stats, err = s.scanTree(ctx, stats, tree.Nodes[name])
-		if err != nil {
-			return ScanStats{}, err
-		}
+		targets = append(targets, collectTargets(path.Join(snPath, name), tree.Nodes[name])...)
+	}
+	return targets
+}
 
-		if ctx.Err() != nil {
-			return stats, nil
-		}
+// scanResult merges the stats of all workers. It also makes sure that the
+// callbacks of the Scanner are never called concurrently.
+type scanResult struct {
+	mu    sync.Mutex
+	total ScanStats
+	err   error
+}
+
+// scanJob scans a single target, reported contains the stats of the target
+// which have already been added to the total.
+type scanJob struct {
+	*Scanner
+	res      *scanResult
+	reported ScanStats
+}
+
+// result adds the new stats of the target to the total and reports the
+// total to s.Result.
+func (j *scanJob) result(item string, stats ScanStats) {
+	j.res.mu.Lock()
+	defer j.res.mu.Unlock()
+
+	j.res.total.Files += stats.Files - j.reported.Files
+	j.res.total.Dirs += stats.Dirs - j.reported.Dirs
+	j.res.total.Others += stats.Others - j.reported.Others
+	j.res.total.Bytes += stats.Bytes - j.reported.Bytes
+	j.reported = stats
+
+	j.Result(item, j.res.total)
+}
+
+func (j *scanJob) error(item string, err error) error {
+	j.res.mu.Lock()
+	defer j.res.mu.Unlock()
+	return j.Error(item, err)
+}
+
+func (j *scanJob) topLevel(item string, stats ScanStats) {
+	j.res.mu.Lock()
+	defer j.res.mu.Unlock()
+	j.TopLevel(item, stats)
+}
+
+// run scans target. An error only stops the scan of this target, the first
+// error is recorded in j.res.
+func (j *scanJob) run(ctx context.Context, target scanTarget) {
+	abstarget, err := j.FS.Abs(target.path)
+	if err == nil {
+		_, err = j.scan(ctx, ScanStats{}, abstarget, target.snPath)
+	}
+	if err == nil {
+		return
 	}
 
-	return stats, nil
+	debug.Log("scan of %v failed: %v", target.path, err)
+	j.res.mu.Lock()
+	if j.res.err == nil {
+		j.res.err = err
+	}
+	j.res.mu.Unlock()
 }
 
 // Scan traverses the targets. The function Result is called for each new item
-// found, the complete result is also returned by Scan.
+// found with the cumulated stats of all targets. Up to Concurrency targets
+// are scanned in parallel, an error while scanning one target does not stop
+// the scan of the others. The first error is returned once all targets have
+// been scanned.
 func (s *Scanner) Scan(ctx context.Context, targets []string) error {
 	debug.Log("start scan for %v", targets)
 
@@ -88,59 +169,112 @@ func (s *Scanner) Scan(ctx context.Context, targets []string) error {
 		return err
 	}
 
-	stats, err := s.scanTree(ctx, ScanStats{}, *tree)
-	if err != nil {
-		return err
+	ch := make(chan scanTarget)
+	res := &scanResult{}
+
+	workers := int(s.Concurrency)
+	if workers < 1 {
+		workers = 1
 	}
 
-	s.Result("", stats)
-	debug.Log("result: %+v", stats)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range ch {
+				if ctx.Err() != nil {
+					continue
+				}
+				job := &scanJob{Scanner: s, res: res}
+				job.run(ctx, target)
+			}
+		}()
+	}
+
+	for _, target := range collectTargets("/", *tree) {
+		ch <- target
+	}
+	close(ch)
+	wg.Wait()
+
+	if res.err != nil {
+		return res.err
+	}
+
+	s.Result("", res.total)
+	debug.Log("result: %+v", res.total)
 	return nil
 }
 
-func (s *Scanner) scan(ctx context.Context, stats ScanStats, target string) (ScanStats, error) {
+// scan traverses target. If snPath is not empty, target is one of the
+// targets and snPath is its path within the snapshot, the top-level items
+// are then reported to TopLevel.
+func (j *scanJob) scan(ctx context.Context, stats ScanStats, target, snPath string) (ScanStats, error) {
 	if ctx.Err() != nil {
 		return stats, nil
 	}
+	if j.TopLevel == nil {
+		snPath = ""
+	}
+	before := stats
 
 	// exclude files by path before running stat to reduce number of lstat calls
-	if !s.SelectByName(target) {
+	if !j.SelectByName(target) {
 		return stats, nil
 	}
 
 	// get file information
-	fi, err := s.FS.Lstat(target)
+	fi, err := j.FS.Lstat(target)
 	if err != nil {
-		return stats, s.Error(target, err)
+		return stats, j.error(target, err)
 	}
 
 	// run remaining select functions that require file information
-	if !s.Select(target, fi) {
+	if !j.Select(target, fi) {
 		return stats, nil
 	}
 
+	openFlags := fs.O_NOFOLLOW
+	if fi.Mode()&os.ModeSymlink != 0 && j.Dereference != nil && j.Dereference(target) {
+		// errors and loops are reported by the archiver
+		linkFI, loop, err := followSymlink(j.FS, target, target)
+		if err == nil && !loop {
+			fi = linkFI
+			openFlags = 0
+		}
+	}
+
 	switch {
 	case fi.Mode().IsRegular():
 		stats.Files++
 		stats.Bytes += uint64(fi.Size())
 	case fi.Mode().IsDir():
-		names, err := readdirnames(s.FS, target, fs.O_NOFOLLOW)
+		names, err := readdirnames(j.FS, target, openFlags)
 		if err != nil {
-			return stats, s.Error(target, err)
+			return stats, j.error(target, err)
 		}
 		sort.Strings(names)
 
 		for _, name := range names {
-			stats, err = s.scan(ctx, stats, filepath.Join(target, name))
+			entryBefore := stats
+			stats, err = j.scan(ctx, stats, filepath.Join(target, name), "")
 			if err != nil {
 				return stats, err
 			}
+			if snPath != "" && stats != entryBefore && ctx.Err() == nil {
+				j.topLevel(path.Join(snPath, name), stats.sub(entryBefore))
+			}
 		}
 		stats.Dirs++
 	default:
 		stats.Others++
 	}
 
-	s.Result(target, stats)
+	if snPath != "" && !fi.IsDir() {
+		j.topLevel(snPath, stats.sub(before))
+	}
+
+	j.result(target, stats)
 	return stats, nil
 }
@@ -306,6 +306,9 @@ func TestScannerCancel(t *testing.T) {
 	}
 
 	sc := NewScanner(fs.Track{FS: fs.Local{}})
+	// the scan is cancelled after a specific item, so the targets must be
+	// scanned in order
+	sc.Concurrency = 1
 	var lastStats ScanStats
 	sc.Result = func(item string, s ScanStats) {
 		lastStats = s
@@ -325,3 +328,110 @@ func TestScannerCancel(t *testing.T) {
 		t.Errorf("wrong final result, want\n  %#v\ngot:\n  %#v", result, lastStats)
 	}
 }
+
+func TestScannerTopLevel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, cleanup := restictest.TempDir(t)
+	defer cleanup()
+
+	TestCreateFiles(t, tempdir, TestDir{
+		"other": TestFile{Content: "another file"},
+		"work": TestDir{
+			"foo":     TestFile{Content: "foo"},
+			"foo.txt": TestFile{Content: "foo text file"},
+			"subdir": TestDir{
+				"other":   TestFile{Content: "other in subdir"},
+				"bar.txt": TestFile{Content: "bar.txt in subdir"},
+			},
+		},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	sc := NewScanner(fs.Track{FS: fs.Local{}})
+	results := make(map[string]ScanStats)
+	sc.TopLevel = func(item string, s ScanStats) {
+		results[item] = s
+	}
+
+	err := sc.Scan(ctx, []string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]ScanStats{
+		"/other":        {Files: 1, Bytes: 12},
+		"/work/foo":     {Files: 1, Bytes: 3},
+		"/work/foo.txt": {Files: 1, Bytes: 13},
+		"/work/subdir":  {Files: 2, Dirs: 1, Bytes: 32},
+	}
+	if !cmp.Equal(want, results) {
+		t.Error(cmp.Diff(want, results))
+	}
+}
+
+func TestScannerMultipleTargets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, cleanup := restictest.TempDir(t)
+	defer cleanup()
+
+	TestCreateFiles(t, tempdir, TestDir{
+		"a": TestDir{
+			"foo": TestFile{Content: "foo"},
+			"sub": TestDir{
+				"bar": TestFile{Content: "bar in sub"},
+			},
+		},
+		"b": TestDir{
+			"baz": TestFile{Content: "baz"},
+		},
+		"c": TestFile{Content: "file c"},
+	})
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	for _, concurrency := range []uint{1, 2, 8} {
+		sc := NewScanner(fs.Track{FS: fs.Local{}})
+		sc.Concurrency = concurrency
+
+		var errors []string
+		sc.Error = func(item string, err error) error {
+			errors = append(errors, filepath.Base(item))
+			return err
+		}
+
+		var results []ScanStats
+		sc.Result = func(item string, s ScanStats) {
+			results = append(results, s)
+		}
+
+		err := sc.Scan(ctx, []string{"a", "missing", "b", "c"})
+		if err == nil {
+			t.Fatal("expected error for missing target")
+		}
+
+		if len(errors) != 1 || errors[0] != "missing" {
+			t.Errorf("unexpected errors %v", errors)
+		}
+
+		// the totals only increase and the last one contains all other targets
+		var last ScanStats
+		for _, s := range results {
+			if s.Files < last.Files || s.Dirs < last.Dirs || s.Bytes < last.Bytes {
+				t.Errorf("total decreased from %#v to %#v", last, s)
+			}
+			last = s
+		}
+
+		want := ScanStats{Files: 4, Dirs: 3, Bytes: 22}
+		if last != want {
+			t.Errorf("concurrency %d: wrong total, want %#v, got %#v", concurrency, want, last)
+		}
+	}
+}
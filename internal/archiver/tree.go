@@ -71,6 +71,13 @@ func pathComponents(fs fs.FS, p string, includeRelative bool) (components []stri
 	return components, virtualPrefix
 }
 
+// SnapshotPath returns the path components of the location in a snapshot
+// where the archiver saves target.
+func SnapshotPath(fs fs.FS, target string) []string {
+	pc, _ := pathComponents(fs, fs.Clean(target), false)
+	return pc
+}
+
 // rootDirectory returns the directory which contains the first element of target.
 func rootDirectory(fs fs.FS, target string) string {
 	if target == "" {
@@ -0,0 +1,169 @@
+// Package accounting implements a backend wrapper which counts the requests
+// and the transferred bytes.
+package accounting
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Operation contains the number of requests and transferred bytes for one
+// type of operation.
+type Operation struct {
+	Requests uint64 `json:"requests"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// Stats contains the counters for all operation types. Stat includes the
+// requests made by Test, Remove those made by Delete.
+type Stats struct {
+	Save   Operation `json:"save"`
+	Load   Operation `json:"load"`
+	Stat   Operation `json:"stat"`
+	List   Operation `json:"list"`
+	Remove Operation `json:"remove"`
+}
+
+// Requests returns the number of requests of all operations.
+func (s Stats) Requests() uint64 {
+	return s.Save.Requests + s.Load.Requests + s.Stat.Requests + s.List.Requests + s.Remove.Requests
+}
+
+// Backend passes all operations through to the underlying backend and counts
+// them. Each call is counted as a request, a call which is retried by a
+// wrapping backend is counted once per attempt. The uploaded and downloaded
+// bytes are counted as they are read by the backend and the caller,
+// respectively. It is safe for concurrent use.
+type Backend struct {
+	// the counters are accessed atomically, keep them at the start of the
+	// struct so that they are 64 bit aligned
+	stats Stats
+
+	restic.Backend
+}
+
+// statically ensure that Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+
+// New returns a new backend wrapping be which counts all requests.
+func New(be restic.Backend) *Backend {
+	debug.Log("created new accounting backend")
+	return &Backend{Backend: be}
+}
+
+// Stats returns a snapshot of the counters.
+func (be *Backend) Stats() Stats {
+	load := func(op *Operation) Operation {
+		return Operation{
+			Requests: atomic.LoadUint64(&op.Requests),
+			Bytes:    atomic.LoadUint64(&op.Bytes),
+		}
+	}
+
+	return Stats{
+		Save:   load(&be.stats.Save),
+		Load:   load(&be.stats.Load),
+		Stat:   load(&be.stats.Stat),
+		List:   load(&be.stats.List),
+		Remove: load(&be.stats.Remove),
+	}
+}
+
+// countingReader adds the number of bytes read to a counter.
+type countingReader struct {
+	io.Reader
+	bytes *uint64
+}
+
+func (rd countingReader) Read(p []byte) (int, error) {
+	n, err := rd.Reader.Read(p)
+	atomic.AddUint64(rd.bytes, uint64(n))
+	return n, err
+}
+
+// countingWriterTo is a countingReader which also passes WriteTo through to
+// the underlying reader.
+type countingWriterTo struct {
+	countingReader
+	writerTo io.WriterTo
+}
+
+func (rd countingWriterTo) WriteTo(w io.Writer) (int64, error) {
+	n, err := rd.writerTo.WriteTo(w)
+	atomic.AddUint64(rd.bytes, uint64(n))
+	return n, err
+}
+
+// newCountingReader returns a reader which adds the number of bytes read from
+// rd to bytes. It implements io.WriterTo if rd does.
+func newCountingReader(rd io.Reader, bytes *uint64) io.Reader {
+	crd := countingReader{Reader: rd, bytes: bytes}
+	if wt, ok := rd.(io.WriterTo); ok {
+		return countingWriterTo{countingReader: crd, writerTo: wt}
+	}
+	return crd
+}
+
+// countingRewindReader adds the number of bytes read to a counter, data read
+// again after Rewind is counted again.
+type countingRewindReader struct {
+	restic.RewindReader
+	rd countingReader
+}
+
+func (rd countingRewindReader) Read(p []byte) (int, error) {
+	return rd.rd.Read(p)
+}
+
+// Save stores the data from rd under the given handle.
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	atomic.AddUint64(&be.stats.Save.Requests, 1)
+	return be.Backend.Save(ctx, h, countingRewindReader{
+		RewindReader: rd,
+		rd:           countingReader{Reader: rd, bytes: &be.stats.Save.Bytes},
+	})
+}
+
+// Load runs fn with a reader that yields the contents of the file at h at the
+// given offset.
+func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	atomic.AddUint64(&be.stats.Load.Requests, 1)
+	return be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		return fn(newCountingReader(rd, &be.stats.Load.Bytes))
+	})
+}
+
+// Stat returns information about the file identified by h.
+func (be *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	atomic.AddUint64(&be.stats.Stat.Requests, 1)
+	return be.Backend.Stat(ctx, h)
+}
+
+// Test returns whether a file exists.
+func (be *Backend) Test(ctx context.Context, h restic.Handle) (bool, error) {
+	atomic.AddUint64(&be.stats.Stat.Requests, 1)
+	return be.Backend.Test(ctx, h)
+}
+
+// List runs fn for each file in the backend which has the type t. The whole
+// listing is counted as a single request.
+func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	atomic.AddUint64(&be.stats.List.Requests, 1)
+	return be.Backend.List(ctx, t, fn)
+}
+
+// Remove removes the file identified by h.
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	atomic.AddUint64(&be.stats.Remove.Requests, 1)
+	return be.Backend.Remove(ctx, h)
+}
+
+// Delete removes all data in the backend.
+func (be *Backend) Delete(ctx context.Context) error {
+	atomic.AddUint64(&be.stats.Remove.Requests, 1)
+	return be.Backend.Delete(ctx)
+}
@@ -0,0 +1,68 @@
+package accounting_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/accounting"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestAccounting(t *testing.T) {
+	ctx := context.TODO()
+	be := accounting.New(mem.New())
+
+	data := rtest.Random(23, 1000)
+	h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data, be.Hasher())))
+
+	err := be.Load(ctx, h, 100, 0, func(rd io.Reader) error {
+		_, err := io.Copy(ioutil.Discard, rd)
+		return err
+	})
+	rtest.OK(t, err)
+
+	_, err = be.Stat(ctx, h)
+	rtest.OK(t, err)
+	_, err = be.Test(ctx, h)
+	rtest.OK(t, err)
+	rtest.OK(t, be.List(ctx, restic.PackFile, func(restic.FileInfo) error {
+		return nil
+	}))
+	rtest.OK(t, be.Remove(ctx, h))
+
+	stats := be.Stats()
+	rtest.Equals(t, accounting.Stats{
+		Save:   accounting.Operation{Requests: 1, Bytes: 1000},
+		Load:   accounting.Operation{Requests: 1, Bytes: 100},
+		Stat:   accounting.Operation{Requests: 2},
+		List:   accounting.Operation{Requests: 1},
+		Remove: accounting.Operation{Requests: 1},
+	}, stats)
+	rtest.Equals(t, uint64(6), stats.Requests())
+}
+
+func TestAccountingConcurrent(t *testing.T) {
+	ctx := context.TODO()
+	be := accounting.New(mem.New())
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := rtest.Random(i, 100)
+			h := restic.Handle{Type: restic.PackFile, Name: restic.Hash(data).String()}
+			rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data, be.Hasher())))
+		}(i)
+	}
+	wg.Wait()
+
+	rtest.Equals(t, accounting.Operation{Requests: workers, Bytes: workers * 100}, be.Stats().Save)
+}
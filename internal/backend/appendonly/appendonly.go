@@ -0,0 +1,70 @@
+// Package appendonly implements a backend wrapper which prevents removing or
+// overwriting files in the repository.
+package appendonly
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ErrNotAllowed is returned for operations which would remove or overwrite
+// files.
+var ErrNotAllowed = errors.New("not allowed in append-only mode")
+
+// Backend passes all operations through to the underlying backend, except
+// removing files and overwriting existing files, which fail with
+// ErrNotAllowed. As lock files must be removed once an operation is complete,
+// they are exempt. This is used for `--append-only`.
+type Backend struct {
+	restic.Backend
+}
+
+// statically ensure that Backend implements restic.Backend.
+var _ restic.Backend = &Backend{}
+
+// New returns a new append-only backend wrapping be.
+func New(be restic.Backend) *Backend {
+	debug.Log("created new append-only backend")
+	return &Backend{Backend: be}
+}
+
+// Save stores the data from rd under the given handle, unless a file with
+// this handle exists already.
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type != restic.LockFile {
+		exists, err := be.Backend.Test(ctx, h)
+		if err != nil {
+			return err
+		}
+		if exists {
+			debug.Log("refusing to overwrite %v", h)
+			return fmt.Errorf("overwriting %v: %w", h, ErrNotAllowed)
+		}
+	}
+
+	return be.Backend.Save(ctx, h, rd)
+}
+
+// Remove removes a lock file, all other files are kept.
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type != restic.LockFile {
+		debug.Log("refusing to remove %v", h)
+		return fmt.Errorf("removing %v: %w", h, ErrNotAllowed)
+	}
+
+	return be.Backend.Remove(ctx, h)
+}
+
+// Delete fails, the repository cannot be removed in append-only mode.
+func (be *Backend) Delete(ctx context.Context) error {
+	return fmt.Errorf("deleting the repository: %w", ErrNotAllowed)
+}
+
+// Location returns the location of the backend.
+func (be *Backend) Location() string {
+	return "APPEND-ONLY:" + be.Backend.Location()
+}
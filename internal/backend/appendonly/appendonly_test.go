@@ -0,0 +1,48 @@
+package appendonly_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/appendonly"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestAppendOnly(t *testing.T) {
+	ctx := context.TODO()
+	m := mem.New()
+	be := appendonly.New(m)
+
+	data := []byte("foo")
+	for _, tpe := range []restic.FileType{restic.PackFile, restic.SnapshotFile, restic.ConfigFile, restic.LockFile} {
+		h := restic.Handle{Type: tpe, Name: restic.Hash(data).String()}
+		if tpe == restic.ConfigFile {
+			h.Name = ""
+		}
+
+		rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data, be.Hasher())))
+		exists, err := m.Test(ctx, h)
+		rtest.OK(t, err)
+		rtest.Assert(t, exists, "%v was not saved", h)
+
+		if tpe == restic.LockFile {
+			rtest.OK(t, be.Remove(ctx, h))
+			continue
+		}
+
+		err = be.Save(ctx, h, restic.NewByteReader(data, be.Hasher()))
+		rtest.Assert(t, errors.Is(err, appendonly.ErrNotAllowed), "overwriting %v returned %v", h, err)
+		err = be.Remove(ctx, h)
+		rtest.Assert(t, errors.Is(err, appendonly.ErrNotAllowed), "removing %v returned %v", h, err)
+
+		exists, err = m.Test(ctx, h)
+		rtest.OK(t, err)
+		rtest.Assert(t, exists, "%v was removed", h)
+	}
+
+	err := be.Delete(ctx)
+	rtest.Assert(t, errors.Is(err, appendonly.ErrNotAllowed), "delete returned %v", err)
+}
@@ -385,7 +385,10 @@ func (be *b2Backend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.AuditFile,
+		restic.SignatureFile,
+		restic.ManifestFile}
 
 	for _, t := range alltypes {
 		err := be.removeKeys(ctx, t)
@@ -425,7 +425,10 @@ func (be *Backend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.AuditFile,
+		restic.SignatureFile,
+		restic.ManifestFile}
 
 	for _, t := range alltypes {
 		err := be.removeKeys(ctx, t)
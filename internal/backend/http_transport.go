@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
@@ -12,6 +13,8 @@ import (
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/net/http2"
 )
 
 // TransportOptions collects various options which can be set for an HTTP based
@@ -25,6 +28,18 @@ type TransportOptions struct {
 
 	// Skip TLS certificate verification
 	InsecureTLS bool
+
+	// MaxIdleConnsPerHost limits the number of idle connections which are kept
+	// open per host, zero keeps the default of 100.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is the time after which idle connections are closed,
+	// zero keeps the default of 90 seconds.
+	IdleConnTimeout time.Duration
+
+	// ForceHTTP2 uses HTTP/2 for all requests. Unencrypted connections use
+	// HTTP/2 with prior knowledge (h2c), which the server must support.
+	ForceHTTP2 bool
 }
 
 // readPEMCertKey reads a file and returns the PEM encoded certificate and key
@@ -65,14 +80,16 @@ func readPEMCertKey(filename string) (certs []byte, key []byte, err error) {
 // a custom rootCertFilename is non-empty, it must point to a valid PEM file,
 // otherwise the function will return an error.
 func Transport(opts TransportOptions) (http.RoundTripper, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		DualStack: true,
+	}
+
 	// copied from net/http
 	tr := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
 		MaxIdleConnsPerHost:   100,
@@ -116,6 +133,71 @@ func Transport(opts TransportOptions) (http.RoundTripper, error) {
 		tr.TLSClientConfig.RootCAs = pool
 	}
 
+	if opts.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		if tr.MaxIdleConns < opts.MaxIdleConnsPerHost {
+			tr.MaxIdleConns = opts.MaxIdleConnsPerHost
+		}
+	}
+
+	if opts.IdleConnTimeout > 0 {
+		tr.IdleConnTimeout = opts.IdleConnTimeout
+	}
+
+	if opts.ForceHTTP2 {
+		rt, err := newHTTP2Transport(tr, dialer)
+		if err != nil {
+			return nil, err
+		}
+		return debug.RoundTripper(rt), nil
+	}
+
 	// wrap in the debug round tripper (if active)
 	return debug.RoundTripper(tr), nil
 }
+
+// http2Transport sends all requests using HTTP/2, connections to servers which
+// don't support HTTP/2 fail. The proxy settings are not used.
+type http2Transport struct {
+	tls   *http2.Transport
+	clear *http2.Transport
+}
+
+func newHTTP2Transport(tr *http.Transport, dialer *net.Dialer) (*http2Transport, error) {
+	// ConfigureTransports links the HTTP/2 transports to copies of tr, so
+	// that settings like the idle timeout are used. It expects that tr dials
+	// the connections, reset the pool so that the HTTP/2 transports dial
+	// themselves.
+	configure := func() (*http2.Transport, error) {
+		t2, err := http2.ConfigureTransports(tr.Clone())
+		if err != nil {
+			return nil, errors.Wrap(err, "ConfigureTransports")
+		}
+		t2.ConnPool = nil
+		return t2, nil
+	}
+
+	clear, err := configure()
+	if err != nil {
+		return nil, err
+	}
+	clear.AllowHTTP = true
+	clear.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	t2, err := configure()
+	if err != nil {
+		return nil, err
+	}
+	t2.TLSClientConfig = tr.TLSClientConfig.Clone()
+
+	return &http2Transport{tls: t2, clear: clear}, nil
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.clear.RoundTrip(req)
+	}
+	return t.tls.RoundTrip(req)
+}
@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func protoHandler(w http.ResponseWriter, req *http.Request) {
+	_, _ = w.Write([]byte(req.Proto))
+}
+
+func getProto(t *testing.T, rt http.RoundTripper, url string) string {
+	client := http.Client{Transport: rt}
+	resp, err := client.Get(url)
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, resp.Body.Close())
+	}()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	rtest.OK(t, err)
+	return string(buf)
+}
+
+func TestTransportForceHTTP2(t *testing.T) {
+	clear := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(protoHandler), &http2.Server{}))
+	defer clear.Close()
+
+	tls := httptest.NewUnstartedServer(http.HandlerFunc(protoHandler))
+	tls.EnableHTTP2 = true
+	tls.StartTLS()
+	defer tls.Close()
+
+	rt, err := Transport(TransportOptions{InsecureTLS: true})
+	rtest.OK(t, err)
+	rtest.Equals(t, "HTTP/1.1", getProto(t, rt, clear.URL))
+
+	rt, err = Transport(TransportOptions{InsecureTLS: true, ForceHTTP2: true})
+	rtest.OK(t, err)
+	rtest.Equals(t, "HTTP/2.0", getProto(t, rt, clear.URL))
+	rtest.Equals(t, "HTTP/2.0", getProto(t, rt, tls.URL))
+}
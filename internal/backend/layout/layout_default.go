@@ -16,11 +16,14 @@ type DefaultLayout struct {
 }
 
 var defaultLayoutPaths = map[restic.FileType]string{
-	restic.PackFile:     "data",
-	restic.SnapshotFile: "snapshots",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "locks",
-	restic.KeyFile:      "keys",
+	restic.PackFile:      "data",
+	restic.SnapshotFile:  "snapshots",
+	restic.IndexFile:     "index",
+	restic.LockFile:      "locks",
+	restic.KeyFile:       "keys",
+	restic.AuditFile:     "audit",
+	restic.SignatureFile: "signatures",
+	restic.ManifestFile:  "manifests",
 }
 
 func (l *DefaultLayout) String() string {
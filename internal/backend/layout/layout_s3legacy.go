@@ -11,11 +11,14 @@ type S3LegacyLayout struct {
 }
 
 var s3LayoutPaths = map[restic.FileType]string{
-	restic.PackFile:     "data",
-	restic.SnapshotFile: "snapshot",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "lock",
-	restic.KeyFile:      "key",
+	restic.PackFile:      "data",
+	restic.SnapshotFile:  "snapshot",
+	restic.IndexFile:     "index",
+	restic.LockFile:      "lock",
+	restic.KeyFile:       "key",
+	restic.AuditFile:     "audit",
+	restic.SignatureFile: "signature",
+	restic.ManifestFile:  "manifest",
 }
 
 func (l *S3LegacyLayout) String() string {
@@ -111,6 +111,9 @@ func TestDefaultLayout(t *testing.T) {
 			filepath.Join(tempdir, "index"),
 			filepath.Join(tempdir, "locks"),
 			filepath.Join(tempdir, "keys"),
+			filepath.Join(tempdir, "audit"),
+			filepath.Join(tempdir, "signatures"),
+			filepath.Join(tempdir, "manifests"),
 		}
 
 		for i := 0; i < 256; i++ {
@@ -188,6 +191,9 @@ func TestRESTLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "locks"),
 			filepath.Join(path, "keys"),
+			filepath.Join(path, "audit"),
+			filepath.Join(path, "signatures"),
+			filepath.Join(path, "manifests"),
 		}
 
 		sort.Strings(want)
@@ -334,6 +340,9 @@ func TestS3LegacyLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "lock"),
 			filepath.Join(path, "key"),
+			filepath.Join(path, "audit"),
+			filepath.Join(path, "signature"),
+			filepath.Join(path, "manifest"),
 		}
 
 		sort.Strings(want)
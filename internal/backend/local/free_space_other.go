@@ -0,0 +1,11 @@
+//go:build !darwin && !freebsd && !linux && !windows
+// +build !darwin,!freebsd,!linux,!windows
+
+package local
+
+import "github.com/restic/restic/internal/errors"
+
+// freeSpace is not supported on this platform.
+func freeSpace(dir string) (free, total uint64, err error) {
+	return 0, 0, errors.New("determining the free space is not supported on this platform")
+}
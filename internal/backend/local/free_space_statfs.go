@@ -0,0 +1,20 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package local
+
+import (
+	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns the space available to unprivileged users and the total
+// size of the file system dir is on.
+func freeSpace(dir string) (free, total uint64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, 0, errors.Wrap(err, "Statfs")
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
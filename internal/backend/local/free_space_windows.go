@@ -0,0 +1,22 @@
+package local
+
+import (
+	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace returns the space available to the current user and the total
+// size of the volume dir is on.
+func freeSpace(dir string) (free, total uint64, err error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return 0, 0, errors.Wrap(err, "GetDiskFreeSpaceEx")
+	}
+	return free, total, nil
+}
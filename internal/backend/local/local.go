@@ -30,6 +30,7 @@ type Local struct {
 
 // ensure statically that *Local implements restic.Backend.
 var _ restic.Backend = &Local{}
+var _ backend.FreeSpacer = &Local{}
 
 const defaultLayout = "default"
 
@@ -407,6 +408,13 @@ func (b *Local) Delete(ctx context.Context) error {
 	return fs.RemoveAll(b.Path)
 }
 
+// FreeSpace returns the free space and the size of the file system the
+// repository is stored on.
+func (b *Local) FreeSpace(ctx context.Context) (free, total uint64, err error) {
+	debug.Log("FreeSpace()")
+	return freeSpace(b.Path)
+}
+
 // Close closes all open files.
 func (b *Local) Close() error {
 	debug.Log("Close()")
@@ -136,3 +136,19 @@ func TestOpenNotExistingDirectory(t *testing.T) {
 	removeAll(t, filepath.Join(dir, "data"))
 	empty(t, dir)
 }
+
+func TestFreeSpace(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	be, err := local.Open(context.TODO(), local.Config{Path: dir, Connections: 2})
+	rtest.OK(t, err)
+	defer func() {
+		rtest.OK(t, be.Close())
+	}()
+
+	free, total, err := be.FreeSpace(context.TODO())
+	rtest.OK(t, err)
+	rtest.Assert(t, total > 0, "file system size is zero")
+	rtest.Assert(t, free <= total, "free space %d exceeds file system size %d", free, total)
+}
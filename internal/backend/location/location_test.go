@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/backend/b2"
 	"github.com/restic/restic/internal/backend/local"
@@ -292,8 +293,10 @@ var parseTests = []struct {
 		"rest:http://hostname.foo:1234/",
 		Location{Scheme: "rest",
 			Config: rest.Config{
-				URL:         parseURL("http://hostname.foo:1234/"),
-				Connections: 5,
+				URL:                parseURL("http://hostname.foo:1234/"),
+				Connections:        5,
+				MaxIdleConnections: 100,
+				IdleTimeout:        90 * time.Second,
 			},
 		},
 	},
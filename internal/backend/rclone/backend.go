@@ -6,7 +6,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
-	"math/rand"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
@@ -133,34 +133,51 @@ func wrapConn(c *StdioConn, lim limiter.Limiter) *wrappedConn {
 	return wc
 }
 
-// New initializes a Backend and starts the process.
-func newBackend(cfg Config, lim limiter.Limiter) (*Backend, error) {
-	var (
-		args []string
-		err  error
-	)
-
-	// build program args, start with the program
-	if cfg.Program != "" {
-		a, err := backend.SplitShellStrings(cfg.Program)
+// buildArgs returns the command line to start rclone: the program, the
+// arguments, the extra arguments and finally the remote.
+func buildArgs(cfg Config) ([]string, error) {
+	var args []string
+	for _, s := range []string{cfg.Program, cfg.Args, cfg.ExtraArgs} {
+		if s == "" {
+			continue
+		}
+		a, err := backend.SplitShellStrings(s)
 		if err != nil {
 			return nil, err
 		}
 		args = append(args, a...)
 	}
 
-	// then add the arguments
-	if cfg.Args != "" {
-		a, err := backend.SplitShellStrings(cfg.Args)
-		if err != nil {
-			return nil, err
-		}
+	if len(args) == 0 {
+		return nil, errors.New("no program configured to start rclone")
+	}
+	return append(args, cfg.Remote), nil
+}
 
-		args = append(args, a...)
+// checkProtocol verifies the response to the list request sent after rclone
+// was started. rclone must answer using version 2 of the REST protocol, which
+// includes the file sizes in the list. The list fails if the repository does
+// not exist yet.
+func checkProtocol(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusOK:
+		if ct := res.Header.Get("Content-Type"); ct != rest.ContentTypeV2 {
+			return errors.Errorf("rclone does not support version 2 of the REST protocol (content type %q), please upgrade rclone", ct)
+		}
+		return nil
+	case http.StatusNotFound:
+		return nil
+	default:
+		return errors.Errorf("unexpected response from rclone: %v", res.Status)
 	}
+}
 
-	// finally, add the remote
-	args = append(args, cfg.Remote)
+// New initializes a Backend and starts the process.
+func newBackend(cfg Config, lim limiter.Limiter) (*Backend, error) {
+	args, err := buildArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
 	arg0, args := args[0], args[1:]
 
 	debug.Log("running command: %v %v", arg0, args)
@@ -220,9 +237,9 @@ func newBackend(cfg Config, lim limiter.Limiter) (*Backend, error) {
 		Timeout:   cfg.Timeout,
 	}
 
-	// request a random file which does not exist. we just want to test when
-	// rclone is able to accept HTTP requests.
-	url := fmt.Sprintf("http://localhost/file-%d", rand.Uint64())
+	// list the keys to test when rclone is able to accept HTTP requests and
+	// that it speaks the expected protocol version
+	url := "http://localhost/keys/"
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -231,6 +248,10 @@ func newBackend(cfg Config, lim limiter.Limiter) (*Backend, error) {
 	req.Header.Set("Accept", rest.ContentTypeV2)
 
 	res, err := client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}
 	if err != nil {
 		// ignore subsequent errors
 		_ = bg()
@@ -246,6 +267,14 @@ func newBackend(cfg Config, lim limiter.Limiter) (*Backend, error) {
 		return nil, fmt.Errorf("error talking HTTP to rclone: %w", err)
 	}
 
+	err = checkProtocol(res)
+	if err != nil {
+		_ = bg()
+		_ = cmd.Process.Kill()
+		wg.Wait()
+		return nil, err
+	}
+
 	debug.Log("HTTP status %q returned, moving instance to background", res.Status)
 	err = bg()
 	if err != nil {
@@ -12,6 +12,7 @@ import (
 type Config struct {
 	Program     string `option:"program" help:"path to rclone (default: rclone)"`
 	Args        string `option:"args"    help:"arguments for running rclone (default: serve restic --stdio --b2-hard-delete)"`
+	ExtraArgs   string `option:"extra-args" help:"additional arguments for rclone, appended to the args, e.g. flags for the remote"`
 	Remote      string
 	Connections uint          `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
 	Timeout     time.Duration `option:"timeout"     help:"set a timeout limit to wait for rclone to establish a connection (default: 1m)"`
@@ -2,9 +2,11 @@ package rclone
 
 import (
 	"context"
+	"net/http"
 	"os/exec"
 	"testing"
 
+	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -54,3 +56,47 @@ func TestRcloneFailedStart(t *testing.T) {
 		rtest.OK(t, err)
 	}
 }
+
+func TestBuildArgs(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Program = "/opt/rclone/bin/rclone"
+	cfg.ExtraArgs = "--s3-acl private --transfers 8"
+	cfg.Remote = "s3:bucket/repo"
+
+	args, err := buildArgs(cfg)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"/opt/rclone/bin/rclone", "serve", "restic", "--stdio", "--b2-hard-delete",
+		"--s3-acl", "private", "--transfers", "8", "s3:bucket/repo"}, args)
+
+	cfg.ExtraArgs = "--unterminated 'quote"
+	_, err = buildArgs(cfg)
+	rtest.Assert(t, err != nil, "expected error for invalid extra args")
+
+	_, err = buildArgs(Config{Remote: "foo"})
+	rtest.Assert(t, err != nil, "expected error without program")
+}
+
+func TestCheckProtocol(t *testing.T) {
+	var tests = []struct {
+		status      int
+		contentType string
+		ok          bool
+	}{
+		{http.StatusOK, rest.ContentTypeV2, true},
+		{http.StatusOK, "application/json", false},
+		{http.StatusNotFound, "", true},
+		{http.StatusInternalServerError, "", false},
+	}
+
+	for _, test := range tests {
+		res := &http.Response{
+			StatusCode: test.status,
+			Status:     http.StatusText(test.status),
+			Header:     http.Header{},
+		}
+		res.Header.Set("Content-Type", test.contentType)
+		err := checkProtocol(res)
+		rtest.Assert(t, (err == nil) == test.ok, "status %v, content type %q: unexpected result %v",
+			test.status, test.contentType, err)
+	}
+}
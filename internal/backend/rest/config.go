@@ -3,15 +3,20 @@ package rest
 import (
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
 )
 
 // Config contains all configuration necessary to connect to a REST server.
 type Config struct {
-	URL         *url.URL
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	URL                *url.URL
+	Connections        uint          `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	MaxIdleConnections uint          `option:"max-idle-connections" help:"set a limit for the number of idle connections kept open (default: 100)"`
+	IdleTimeout        time.Duration `option:"idle-timeout" help:"close connections after being idle for this duration (default: 90s)"`
+	HTTP2              bool          `option:"http2" help:"use HTTP/2 for all requests, also for unencrypted connections"`
 }
 
 func init() {
@@ -21,10 +26,21 @@ func init() {
 // NewConfig returns a new Config with the default values filled in.
 func NewConfig() Config {
 	return Config{
-		Connections: 5,
+		Connections:        5,
+		MaxIdleConnections: 100,
+		IdleTimeout:        90 * time.Second,
 	}
 }
 
+// TransportOptions returns opts with the connection settings of the config
+// applied.
+func (cfg Config) TransportOptions(opts backend.TransportOptions) backend.TransportOptions {
+	opts.MaxIdleConnsPerHost = int(cfg.MaxIdleConnections)
+	opts.IdleConnTimeout = cfg.IdleTimeout
+	opts.ForceHTTP2 = cfg.HTTP2
+	return opts
+}
+
 // ParseConfig parses the string s and extracts the REST server URL.
 func ParseConfig(s string) (interface{}, error) {
 	if !strings.HasPrefix(s, "rest:") {
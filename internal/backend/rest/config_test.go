@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func parseURL(s string) *url.URL {
@@ -22,15 +23,19 @@ var configTests = []struct {
 	{
 		s: "rest:http://localhost:1234",
 		cfg: Config{
-			URL:         parseURL("http://localhost:1234/"),
-			Connections: 5,
+			URL:                parseURL("http://localhost:1234/"),
+			Connections:        5,
+			MaxIdleConnections: 100,
+			IdleTimeout:        90 * time.Second,
 		},
 	},
 	{
 		s: "rest:http://localhost:1234/",
 		cfg: Config{
-			URL:         parseURL("http://localhost:1234/"),
-			Connections: 5,
+			URL:                parseURL("http://localhost:1234/"),
+			Connections:        5,
+			MaxIdleConnections: 100,
+			IdleTimeout:        90 * time.Second,
 		},
 	},
 }
@@ -8,11 +8,13 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"net/textproto"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/restic/restic/internal/backend/layout"
 	"github.com/restic/restic/internal/backend/sema"
@@ -32,9 +34,37 @@ type Backend struct {
 	connections uint
 	sem         sema.Semaphore
 	client      http.Client
+	conns       *ConnectionStats
 	layout.Layout
 }
 
+// ConnectionStats counts the connections used for requests to the server.
+type ConnectionStats struct {
+	// Opened is the number of requests which required a new connection.
+	Opened uint64
+	// Reused is the number of requests which used an existing connection.
+	Reused uint64
+}
+
+// connTracker records whether the connection used for a request was reused.
+type connTracker struct {
+	rt    http.RoundTripper
+	stats *ConnectionStats
+}
+
+func (t connTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint64(&t.stats.Reused, 1)
+			} else {
+				atomic.AddUint64(&t.stats.Opened, 1)
+			}
+		},
+	}
+	return t.rt.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
 // the REST API protocol version is decided by HTTP request headers, these are the constants.
 const (
 	ContentTypeV1 = "application/vnd.x.restic.rest.v1"
@@ -54,9 +84,11 @@ func Open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 		url = url[:len(url)-1]
 	}
 
+	conns := &ConnectionStats{}
 	be := &Backend{
 		url:         cfg.URL,
-		client:      http.Client{Transport: rt},
+		client:      http.Client{Transport: connTracker{rt: rt, stats: conns}},
+		conns:       conns,
 		Layout:      &layout.RESTLayout{URL: url, Join: path.Join},
 		connections: cfg.Connections,
 		sem:         sem,
@@ -65,6 +97,15 @@ func Open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 	return be, nil
 }
 
+// ConnectionStats returns how many requests opened a new connection and how
+// many reused an existing one.
+func (b *Backend) ConnectionStats() ConnectionStats {
+	return ConnectionStats{
+		Opened: atomic.LoadUint64(&b.conns.Opened),
+		Reused: atomic.LoadUint64(&b.conns.Reused),
+	}
+}
+
 // Create creates a new REST on server configured in config.
 func Create(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
 	be, err := Open(cfg, rt)
@@ -161,7 +202,7 @@ func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRea
 	}
 
 	if resp.StatusCode != 200 {
-		return errors.Errorf("server response unexpected: %v (%v)", resp.Status, resp.StatusCode)
+		return newResponseError(resp, "server response unexpected: %v (%v)", resp.Status, resp.StatusCode)
 	}
 
 	return errors.Wrap(cerr, "Close")
@@ -177,6 +218,27 @@ func (e *notExistError) Error() string {
 	return fmt.Sprintf("%v does not exist", e.Handle)
 }
 
+// responseError is returned for unexpected responses of the server. It
+// carries the status code, which allows the retry backend to recognize rate
+// limits.
+type responseError struct {
+	msg  string
+	code int
+}
+
+func (e *responseError) Error() string {
+	return e.msg
+}
+
+// StatusCode returns the HTTP status code of the response.
+func (e *responseError) StatusCode() int {
+	return e.code
+}
+
+func newResponseError(resp *http.Response, format string, args ...interface{}) error {
+	return errors.WithStack(&responseError{msg: fmt.Sprintf(format, args...), code: resp.StatusCode})
+}
+
 // IsNotExist returns true if the error was caused by a non-existing file.
 func (b *Backend) IsNotExist(err error) bool {
 	var e *notExistError
@@ -298,7 +360,7 @@ func (b *Backend) openReader(ctx context.Context, h restic.Handle, length int, o
 
 	if resp.StatusCode != 200 && resp.StatusCode != 206 {
 		_ = resp.Body.Close()
-		return nil, errors.Errorf("unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
+		return nil, newResponseError(resp, "unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
 	}
 
 	// workaround https://github.com/golang/go/issues/46071
@@ -342,7 +404,7 @@ func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, e
 	}
 
 	if resp.StatusCode != 200 {
-		return restic.FileInfo{}, errors.Errorf("unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
+		return restic.FileInfo{}, newResponseError(resp, "unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
 	}
 
 	if resp.ContentLength < 0 {
@@ -393,7 +455,7 @@ func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	}
 
 	if resp.StatusCode != 200 {
-		return errors.Errorf("blob not removed, server response: %v (%v)", resp.Status, resp.StatusCode)
+		return newResponseError(resp, "blob not removed, server response: %v (%v)", resp.Status, resp.StatusCode)
 	}
 
 	_, err = io.Copy(ioutil.Discard, resp.Body)
@@ -427,7 +489,7 @@ func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.Fi
 	}
 
 	if resp.StatusCode != 200 {
-		return errors.Errorf("List failed, server response: %v (%v)", resp.Status, resp.StatusCode)
+		return newResponseError(resp, "List failed, server response: %v (%v)", resp.Status, resp.StatusCode)
 	}
 
 	if resp.Header.Get("Content-Type") == ContentTypeV2 {
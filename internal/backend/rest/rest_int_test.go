@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/restic"
 )
@@ -148,3 +149,40 @@ func TestListAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestConnectionStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", "23")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	srvURL, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := backend.Transport(rest.NewConfig().TransportOptions(backend.TransportOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := rest.NewConfig()
+	cfg.URL = srvURL
+	be, err := rest.Open(cfg, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err = be.Stat(context.TODO(), restic.Handle{Type: restic.ConfigFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := rest.ConnectionStats{Opened: 1, Reused: 4}
+	if stats := be.ConnectionStats(); stats != want {
+		t.Fatalf("wrong connection stats, want %+v, got %+v", want, stats)
+	}
+}
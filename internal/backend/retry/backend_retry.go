@@ -4,20 +4,30 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math/rand"
+	"net/http"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
+// DefaultMaxElapsedTime is the default duration after which an operation is
+// not retried any more.
+const DefaultMaxElapsedTime = 15 * time.Minute
+
 // Backend retries operations on the backend in case of an error with a
 // backoff.
 type Backend struct {
 	restic.Backend
 	MaxTries int
-	Report   func(string, error, time.Duration)
-	Success  func(string, int)
+	// MaxElapsedTime is the duration after which an operation is not retried
+	// any more, zero means no limit.
+	MaxElapsedTime time.Duration
+	Report         func(string, error, time.Duration)
+	Success        func(string, int)
 }
 
 // statically ensure that RetryBackend implements restic.Backend.
@@ -29,11 +39,82 @@ var _ restic.Backend = &Backend{}
 // (it is not called if it succeeded on the first try)
 func New(be restic.Backend, maxTries int, report func(string, error, time.Duration), success func(string, int)) *Backend {
 	return &Backend{
-		Backend:  be,
-		MaxTries: maxTries,
-		Report:   report,
-		Success:  success,
+		Backend:        be,
+		MaxTries:       maxTries,
+		MaxElapsedTime: DefaultMaxElapsedTime,
+		Report:         report,
+		Success:        success,
+	}
+}
+
+// StatusCoder is implemented by errors which carry the HTTP status code of the
+// response that caused them.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// isRateLimited returns true if err signals that the server is overloaded or
+// limits the request rate.
+func isRateLimited(err error) bool {
+	var sc StatusCoder
+	if !errors.As(err, &sc) {
+		return false
 	}
+	code := sc.StatusCode()
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// rateLimitInitialInterval is the initial delay after a request has been
+// rejected by a rate limit, the server is unlikely to accept requests
+// again right away.
+const rateLimitInitialInterval = 5 * time.Second
+
+// jitterBackOff computes exponentially growing delays with full jitter: each
+// delay is chosen randomly between zero and the current interval, so that
+// concurrent operations don't retry all at the same time. Separate
+// intervals are used for rate limited requests and for other errors.
+type jitterBackOff struct {
+	network, rateLimit *backoff.ExponentialBackOff
+	lastErr            error
+}
+
+func newJitterBackOff(maxElapsed time.Duration) *jitterBackOff {
+	newExponential := func(initial time.Duration) *backoff.ExponentialBackOff {
+		bo := backoff.NewExponentialBackOff()
+		bo.InitialInterval = initial
+		bo.RandomizationFactor = 0
+		bo.MaxElapsedTime = maxElapsed
+		if fastRetries {
+			// speed up integration tests
+			bo.InitialInterval = 1 * time.Millisecond
+		}
+		bo.Reset()
+		return bo
+	}
+
+	return &jitterBackOff{
+		network:   newExponential(backoff.DefaultInitialInterval),
+		rateLimit: newExponential(rateLimitInitialInterval),
+	}
+}
+
+func (b *jitterBackOff) NextBackOff() time.Duration {
+	bo := b.network
+	if isRateLimited(b.lastErr) {
+		bo = b.rateLimit
+	}
+
+	d := bo.NextBackOff()
+	if d == backoff.Stop || d <= 0 {
+		return d
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func (b *jitterBackOff) Reset() {
+	b.network.Reset()
+	b.rateLimit.Reset()
+	b.lastErr = nil
 }
 
 // retryNotifyErrorWithSuccess is an extension of backoff.RetryNotify with notification of success after an error.
@@ -68,15 +149,21 @@ func (be *Backend) retry(ctx context.Context, msg string, f func() error) error
 		return ctx.Err()
 	}
 
-	bo := backoff.NewExponentialBackOff()
-	if fastRetries {
-		// speed up integration tests
-		bo.InitialInterval = 1 * time.Millisecond
+	bo := newJitterBackOff(be.MaxElapsedTime)
+	operation := func() error {
+		err := f()
+		// the delay depends on the kind of the error
+		bo.lastErr = err
+		return err
 	}
+	attempt := 0
 
-	err := retryNotifyErrorWithSuccess(f,
+	err := retryNotifyErrorWithSuccess(operation,
 		backoff.WithContext(backoff.WithMaxRetries(bo, uint64(be.MaxTries)), ctx),
 		func(err error, d time.Duration) {
+			attempt++
+			debug.Log("%v: attempt %d failed (rate limited: %v), retrying after %v: %v",
+				msg, attempt, isRateLimited(err), d, err)
 			if be.Report != nil {
 				be.Report(msg, err, d)
 			}
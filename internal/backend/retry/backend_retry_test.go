@@ -3,8 +3,10 @@ package retry
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"testing"
 	"time"
 
@@ -363,3 +365,90 @@ func TestNotifyWithSuccessIsCalled(t *testing.T) {
 		t.Fatalf("Success should have been called only once, but was called %d times instead", successCalled)
 	}
 }
+
+type statusError int
+
+func (e statusError) Error() string   { return fmt.Sprintf("status %d", int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+func TestJitterBackOff(t *testing.T) {
+	defer func(v bool) { fastRetries = v }(fastRetries)
+	fastRetries = false
+
+	bo := newJitterBackOff(0)
+	for i := 0; i < 20; i++ {
+		d := bo.NextBackOff()
+		if d < 0 || d > bo.network.MaxInterval {
+			t.Fatalf("delay %v out of range", d)
+		}
+	}
+
+	// delays for rate limited requests must not advance the backoff for
+	// other errors
+	bo.Reset()
+	bo.lastErr = errors.Wrap(statusError(http.StatusTooManyRequests), "Load")
+	for i := 0; i < 3; i++ {
+		if d := bo.NextBackOff(); d > bo.rateLimit.MaxInterval {
+			t.Fatalf("delay %v out of range", d)
+		}
+	}
+	test.Equals(t, backoff.DefaultInitialInterval, bo.network.NextBackOff())
+}
+
+func TestIsRateLimited(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection reset"), false},
+		{statusError(http.StatusInternalServerError), false},
+		{statusError(http.StatusTooManyRequests), true},
+		{errors.Wrap(statusError(http.StatusServiceUnavailable), "Save"), true},
+	} {
+		if got := isRateLimited(test.err); got != test.want {
+			t.Errorf("isRateLimited(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestBackendRetryMaxTries(t *testing.T) {
+	calls := 0
+	be := &mock.Backend{
+		StatFn: func(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+			calls++
+			return restic.FileInfo{}, statusError(http.StatusServiceUnavailable)
+		},
+	}
+
+	TestFastRetries(t)
+	retryBackend := New(be, 2, nil, nil)
+
+	_, err := retryBackend.Stat(context.TODO(), restic.Handle{})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	test.Equals(t, 3, calls)
+}
+
+func TestBackendRetryMaxElapsed(t *testing.T) {
+	calls := 0
+	be := &mock.Backend{
+		StatFn: func(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+			calls++
+			time.Sleep(5 * time.Millisecond)
+			return restic.FileInfo{}, errors.New("injected error")
+		},
+	}
+
+	TestFastRetries(t)
+	retryBackend := New(be, 1000, nil, nil)
+	retryBackend.MaxElapsedTime = 20 * time.Millisecond
+
+	_, err := retryBackend.Stat(context.TODO(), restic.Handle{})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if calls >= 1000 {
+		t.Fatalf("operation was retried %d times despite the time limit", calls)
+	}
+}
@@ -1,6 +1,7 @@
 package s3
 
 import (
+	"context"
 	"net/url"
 	"path"
 	"strings"
@@ -19,13 +20,26 @@ type Config struct {
 	Bucket       string
 	Prefix       string
 	Layout       string `option:"layout" help:"use this backend layout (default: auto-detect)"`
-	StorageClass string `option:"storage-class" help:"set S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING or REDUCED_REDUNDANCY)"`
+	StorageClass string `option:"storage-class" help:"set S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING, GLACIER_IR, GLACIER, DEEP_ARCHIVE or REDUCED_REDUNDANCY)"`
+
+	MetadataStorageClass string `option:"metadata-storage-class" help:"set S3 storage class for all files except packs containing file data (default: same as storage-class)"`
 
 	Connections   uint   `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
 	MaxRetries    uint   `option:"retries" help:"set the number of retries attempted"`
 	Region        string `option:"region" help:"set region"`
 	BucketLookup  string `option:"bucket-lookup" help:"bucket lookup style: 'auto', 'dns', or 'path'"`
 	ListObjectsV1 bool   `option:"list-objects-v1" help:"use deprecated V1 api for ListObjects calls"`
+
+	// Credentials, if set, is used before all other sources of credentials.
+	// The credentials are obtained again once they have expired.
+	Credentials CredentialSource
+}
+
+// CredentialSource provides credentials which may expire. The values use the
+// names of the environment variables, e.g. AWS_ACCESS_KEY_ID.
+type CredentialSource interface {
+	Get(ctx context.Context) (map[string]string, error)
+	Expired() bool
 }
 
 // NewConfig returns a new Config with the default values filled in.
@@ -37,6 +37,32 @@ var _ restic.Backend = &Backend{}
 
 const defaultLayout = "default"
 
+// sourceProvider returns the credentials from a CredentialSource.
+type sourceProvider struct {
+	src CredentialSource
+}
+
+func (p sourceProvider) Retrieve() (credentials.Value, error) {
+	values, err := p.src.Get(context.TODO())
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	if values["AWS_ACCESS_KEY_ID"] == "" || values["AWS_SECRET_ACCESS_KEY"] == "" {
+		return credentials.Value{}, errors.New("the credential command did not return AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	return credentials.Value{
+		AccessKeyID:     values["AWS_ACCESS_KEY_ID"],
+		SecretAccessKey: values["AWS_SECRET_ACCESS_KEY"],
+		SessionToken:    values["AWS_SESSION_TOKEN"],
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+func (p sourceProvider) IsExpired() bool {
+	return p.src.Expired()
+}
+
 func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
 	debug.Log("open, config %#v", cfg)
 
@@ -45,6 +71,7 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 	}
 
 	// Chains all credential types, in the following order:
+	//	- Credentials from the credential command
 	// 	- Static credentials provided by user
 	//	- AWS env vars (i.e. AWS_ACCESS_KEY_ID)
 	//  - Minio env vars (i.e. MINIO_ACCESS_KEY)
@@ -53,7 +80,11 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 	//  - IAM profile based credentials. (performs an HTTP
 	//    call to a pre-defined endpoint, only valid inside
 	//    configured ec2 instances)
-	creds := credentials.NewChainCredentials([]credentials.Provider{
+	var providers []credentials.Provider
+	if cfg.Credentials != nil {
+		providers = append(providers, sourceProvider{cfg.Credentials})
+	}
+	creds := credentials.NewChainCredentials(append(providers,
 		&credentials.EnvAWS{},
 		&credentials.Static{
 			Value: credentials.Value{
@@ -69,7 +100,7 @@ func open(ctx context.Context, cfg Config, rt http.RoundTripper) (*Backend, erro
 				Transport: http.DefaultTransport,
 			},
 		},
-	})
+	))
 
 	c, err := creds.Get()
 	if err != nil {
@@ -288,7 +319,7 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	be.sem.GetToken()
 	defer be.sem.ReleaseToken()
 
-	opts := minio.PutObjectOptions{StorageClass: be.cfg.StorageClass}
+	opts := minio.PutObjectOptions{StorageClass: be.storageClass(h)}
 	opts.ContentType = "application/octet-stream"
 	// the only option with the high-level api is to let the library handle the checksum computation
 	opts.SendContentMd5 = true
@@ -308,6 +339,19 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRe
 	return errors.Wrap(err, "client.PutObject")
 }
 
+// storageClass returns the storage class for the file h. Packs containing data
+// blobs use the configured storage class, all other files use the metadata
+// storage class if one is set.
+func (be *Backend) storageClass(h restic.Handle) string {
+	if be.cfg.MetadataStorageClass == "" {
+		return be.cfg.StorageClass
+	}
+	if h.Type == restic.PackFile && h.ContainedBlobType != restic.TreeBlob {
+		return be.cfg.StorageClass
+	}
+	return be.cfg.MetadataStorageClass
+}
+
 // Load runs fn with a reader that yields the contents of the file at h at the
 // given offset.
 func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
@@ -352,12 +396,22 @@ func (be *Backend) openReader(ctx context.Context, h restic.Handle, length int,
 	if err != nil {
 		cancel()
 		be.sem.ReleaseToken()
+		if isArchived(err) {
+			// retrying does not help until the object is restored
+			return nil, backoff.Permanent(errors.Errorf("%v is stored in an archive storage class (for example GLACIER or DEEP_ARCHIVE) and must be restored in the bucket before it can be read", objName))
+		}
 		return nil, err
 	}
 
 	return be.sem.ReleaseTokenOnClose(rd, cancel), err
 }
 
+// isArchived returns true if the error was caused by reading an object from an
+// archive storage class which has not been restored.
+func isArchived(err error) bool {
+	return minio.ToErrorResponse(err).Code == "InvalidObjectState"
+}
+
 // Stat returns information about a blob.
 func (be *Backend) Stat(ctx context.Context, h restic.Handle) (bi restic.FileInfo, err error) {
 	debug.Log("%v", h)
@@ -499,7 +553,10 @@ func (be *Backend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.AuditFile,
+		restic.SignatureFile,
+		restic.ManifestFile}
 
 	for _, t := range alltypes {
 		err := be.removeKeys(ctx, t)
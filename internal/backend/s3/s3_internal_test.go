@@ -0,0 +1,36 @@
+package s3
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestStorageClass(t *testing.T) {
+	dataPack := restic.Handle{Type: restic.PackFile, Name: "foo", ContainedBlobType: restic.DataBlob}
+	treePack := restic.Handle{Type: restic.PackFile, Name: "foo", ContainedBlobType: restic.TreeBlob}
+	index := restic.Handle{Type: restic.IndexFile, Name: "foo"}
+	lock := restic.Handle{Type: restic.LockFile, Name: "foo"}
+
+	be := &Backend{cfg: Config{StorageClass: "GLACIER_IR"}}
+	for _, h := range []restic.Handle{dataPack, treePack, index, lock} {
+		rtest.Equals(t, "GLACIER_IR", be.storageClass(h))
+	}
+
+	be.cfg.MetadataStorageClass = "STANDARD"
+	rtest.Equals(t, "GLACIER_IR", be.storageClass(dataPack))
+	for _, h := range []restic.Handle{treePack, index, lock} {
+		rtest.Equals(t, "STANDARD", be.storageClass(h))
+	}
+}
+
+func TestIsArchived(t *testing.T) {
+	err := minio.ErrorResponse{Code: "InvalidObjectState", StatusCode: http.StatusForbidden}
+	rtest.Assert(t, isArchived(err), "expected archived error for %v", err)
+	rtest.Assert(t, !isArchived(minio.ErrorResponse{Code: "AccessDenied"}), "unexpected archived error")
+	rtest.Assert(t, !isArchived(errors.New("network error")), "unexpected archived error")
+}
@@ -42,6 +42,7 @@ type SFTP struct {
 }
 
 var _ restic.Backend = &SFTP{}
+var _ backend.FreeSpacer = &SFTP{}
 
 const defaultLayout = "default"
 
@@ -495,6 +496,24 @@ func (r *SFTP) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, erro
 	return restic.FileInfo{Size: fi.Size(), Name: h.Name}, nil
 }
 
+// FreeSpace returns the free space and the size of the file system the
+// repository is stored on. The server must support the statvfs extension.
+func (r *SFTP) FreeSpace(ctx context.Context) (free, total uint64, err error) {
+	debug.Log("FreeSpace()")
+	if err := r.clientError(); err != nil {
+		return 0, 0, err
+	}
+
+	r.sem.GetToken()
+	defer r.sem.ReleaseToken()
+
+	st, err := r.c.StatVFS(r.p)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "StatVFS")
+	}
+	return st.Bavail * st.Frsize, st.Blocks * st.Frsize, nil
+}
+
 // Test returns true if a blob of the given type and name exists in the backend.
 func (r *SFTP) Test(ctx context.Context, h restic.Handle) (bool, error) {
 	debug.Log("Test(%v)", h)
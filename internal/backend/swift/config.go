@@ -79,6 +79,12 @@ func ParseConfig(s string) (interface{}, error) {
 
 // ApplyEnvironment saves values from the environment to the config.
 func ApplyEnvironment(prefix string, cfg interface{}) error {
+	return ApplyEnvironmentFrom(prefix, cfg, os.Getenv)
+}
+
+// ApplyEnvironmentFrom works like ApplyEnvironment, but obtains the values of
+// the environment variables from getenv.
+func ApplyEnvironmentFrom(prefix string, cfg interface{}, getenv func(string) string) error {
 	c := cfg.(*Config)
 	for _, val := range []struct {
 		s   *string
@@ -118,7 +124,7 @@ func ApplyEnvironment(prefix string, cfg interface{}) error {
 		{&c.DefaultContainerPolicy, prefix + "SWIFT_DEFAULT_CONTAINER_POLICY"},
 	} {
 		if *val.s == "" {
-			*val.s = os.Getenv(val.env)
+			*val.s = getenv(val.env)
 		}
 	}
 	for _, val := range []struct {
@@ -129,7 +135,7 @@ func ApplyEnvironment(prefix string, cfg interface{}) error {
 		{&c.AuthToken, prefix + "OS_AUTH_TOKEN"},
 	} {
 		if val.s.String() == "" {
-			*val.s = options.NewSecretString(os.Getenv(val.env))
+			*val.s = options.NewSecretString(getenv(val.env))
 		}
 	}
 	return nil
@@ -114,3 +114,11 @@ func MemorizeList(ctx context.Context, be restic.Lister, t restic.FileType) (res
 		tpe:       t,
 	}, nil
 }
+
+// FreeSpacer is implemented by backends which can determine the free space of
+// the file system they store the files on.
+type FreeSpacer interface {
+	// FreeSpace returns the number of bytes available for new files and the
+	// total size of the file system.
+	FreeSpace(ctx context.Context) (free, total uint64, err error)
+}
@@ -5,7 +5,9 @@ import (
 	"io"
 	"sync"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -33,6 +35,7 @@ func newBackend(be restic.Backend, c *Cache) *Backend {
 }
 
 // Remove deletes a file from the backend and the cache if it has been cached.
+// When the file cannot be removed from the cache, the cache is disabled.
 func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	debug.Log("cache Remove(%v)", h)
 	err := b.Backend.Remove(ctx, h)
@@ -40,7 +43,10 @@ func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
 		return err
 	}
 
-	return b.Cache.remove(h)
+	if err := b.Cache.remove(h); err != nil {
+		b.Cache.disable(err)
+	}
+	return nil
 }
 
 func autoCacheTypes(h restic.Handle) bool {
@@ -55,7 +61,7 @@ func autoCacheTypes(h restic.Handle) bool {
 
 // Save stores a new file in the backend and the cache.
 func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
-	if !autoCacheTypes(h) {
+	if !autoCacheTypes(h) || b.Cache.isDisabled() {
 		return b.Backend.Save(ctx, h, rd)
 	}
 
@@ -82,6 +88,9 @@ func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRea
 	err = b.Cache.Save(h, rd)
 	if err != nil {
 		debug.Log("unable to save %v to cache: %v", h, err)
+		if isWriteError(err) {
+			b.Cache.disable(err)
+		}
 		_ = b.Cache.remove(h)
 		return nil
 	}
@@ -89,7 +98,15 @@ func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRea
 	return nil
 }
 
+// errDisabled is returned when a file cannot be cached because the cache was
+// disabled.
+var errDisabled = errors.New("the cache is disabled after writing to it failed")
+
 func (b *Backend) cacheFile(ctx context.Context, h restic.Handle) error {
+	if b.Cache.isDisabled() {
+		return errDisabled
+	}
+
 	finish := make(chan struct{})
 
 	b.inProgressMutex.Lock()
@@ -107,12 +124,19 @@ func (b *Backend) cacheFile(ctx context.Context, h restic.Handle) error {
 	}
 
 	// test again, maybe the file was cached in the meantime
+	var err error
 	if !b.Cache.Has(h) {
 
 		// nope, it's still not in the cache, pull it from the repo and save it
 
-		err := b.Backend.Load(ctx, h, 0, 0, func(rd io.Reader) error {
-			return b.Cache.Save(h, rd)
+		err = b.Backend.Load(ctx, h, 0, 0, func(rd io.Reader) error {
+			err := b.Cache.Save(h, rd)
+			if isWriteError(err) {
+				// retrying the download does not help
+				b.Cache.disable(err)
+				return backoff.Permanent(err)
+			}
+			return err
 		})
 		if err != nil {
 			// try to remove from the cache, ignore errors
@@ -128,7 +152,20 @@ func (b *Backend) cacheFile(ctx context.Context, h restic.Handle) error {
 	delete(b.inProgress, h)
 	b.inProgressMutex.Unlock()
 
-	return nil
+	return err
+}
+
+// Warm downloads the file h into the cache unless it is cached already. In
+// contrast to Load, files of all types are stored in the cache, for example
+// packs containing data blobs.
+func (b *Backend) Warm(ctx context.Context, h restic.Handle) error {
+	if !b.Cache.canBeCached(h.Type) {
+		return errors.Errorf("files of type %v cannot be cached", h.Type)
+	}
+	if b.Cache.Has(h) {
+		return nil
+	}
+	return b.cacheFile(ctx, h)
 }
 
 // loadFromCache will try to load the file from the cache.
@@ -148,6 +185,10 @@ func (b *Backend) loadFromCache(ctx context.Context, h restic.Handle, length int
 
 // Load loads a file from the cache or the backend.
 func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, consumer func(rd io.Reader) error) error {
+	if b.Cache.isDisabled() {
+		return b.Backend.Load(ctx, h, length, offset, consumer)
+	}
+
 	b.inProgressMutex.Lock()
 	waitForFinish, inProgress := b.inProgress[h]
 	b.inProgressMutex.Unlock()
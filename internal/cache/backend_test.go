@@ -6,6 +6,8 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -117,6 +119,47 @@ func TestBackend(t *testing.T) {
 	}
 }
 
+func TestBackendWarm(t *testing.T) {
+	be := mem.New()
+
+	c, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	wbe := c.Wrap(be).(*Backend)
+
+	_, data := randomData(5234142)
+	h := restic.Handle{
+		Type:              restic.PackFile,
+		Name:              restic.Hash(data).String(),
+		ContainedBlobType: restic.DataBlob,
+	}
+	save(t, be, h, data)
+
+	// data packs are not cached by Load
+	loadAndCompare(t, wbe, h, data)
+	if c.Has(h) {
+		t.Errorf("cache has data pack after load")
+	}
+
+	if err := wbe.Warm(context.TODO(), h); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Has(h) {
+		t.Errorf("cache doesn't have file after warm")
+	}
+	loadAndCompare(t, wbe, h, data)
+
+	// warming a file which does not exist fails
+	missing, _ := randomData(100)
+	missing.Type = restic.PackFile
+	if err := wbe.Warm(context.TODO(), missing); err == nil {
+		t.Errorf("expected error for missing file, got nil")
+	}
+	if c.Has(missing) {
+		t.Errorf("cache has missing file after warm")
+	}
+}
+
 type loadErrorBackend struct {
 	restic.Backend
 	loadError error
@@ -209,3 +252,34 @@ func TestBackendRemoveBroken(t *testing.T) {
 		t.Fatalf("wrong data cache")
 	}
 }
+
+func TestBackendWriteError(t *testing.T) {
+	be := mem.New()
+
+	c, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	var disabled []error
+	c.OnDisable = func(err error) {
+		disabled = append(disabled, err)
+	}
+
+	// files cannot be stored in the cache any more
+	dir := filepath.Join(c.path, cacheLayoutPaths[restic.IndexFile])
+	test.OK(t, os.RemoveAll(dir))
+	test.OK(t, ioutil.WriteFile(dir, []byte("foo"), 0644))
+
+	wbe := c.Wrap(be)
+	h, data := randomData(5234142)
+	save(t, wbe, h, data)
+	test.Equals(t, 1, len(disabled))
+	test.Assert(t, isWriteError(disabled[0]), "unexpected error %v", disabled[0])
+
+	// the cache is bypassed for all following operations
+	h2, data2 := randomData(1234)
+	save(t, be, h2, data2)
+	loadAndCompare(t, wbe, h, data)
+	loadAndCompare(t, wbe, h2, data2)
+	remove(t, wbe, h)
+	test.Equals(t, 1, len(disabled))
+}
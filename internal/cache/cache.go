@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -20,6 +22,13 @@ type Cache struct {
 	path    string
 	Base    string
 	Created bool
+
+	// OnDisable is called once when writing to the cache failed. The cache
+	// is not used any more afterwards.
+	OnDisable func(err error)
+
+	disabled    int32
+	disableOnce sync.Once
 }
 
 const dirMode = 0700
@@ -142,6 +151,10 @@ func New(id string, basedir string) (c *Cache, err error) {
 		}
 	}
 
+	if err = checkWritable(cachedir); err != nil {
+		return nil, err
+	}
+
 	c = &Cache{
 		path:    cachedir,
 		Base:    basedir,
@@ -151,6 +164,16 @@ func New(id string, basedir string) (c *Cache, err error) {
 	return c, nil
 }
 
+// checkWritable returns an error if no files can be created in dir.
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return errors.Errorf("cache directory %v is not writable: %v", dir, err)
+	}
+	_ = f.Close()
+	return errors.WithStack(fs.Remove(f.Name()))
+}
+
 // updateTimestamp sets the modification timestamp (mtime and atime) for the
 // directory d to the current time.
 func updateTimestamp(d string) error {
@@ -240,6 +263,22 @@ func IsOld(t time.Time, maxAge time.Duration) bool {
 	return t.Before(oldest)
 }
 
+// disable stops using the cache after writing to it failed with err.
+func (c *Cache) disable(err error) {
+	c.disableOnce.Do(func() {
+		debug.Log("disabling the cache: %v", err)
+		atomic.StoreInt32(&c.disabled, 1)
+		if c.OnDisable != nil {
+			c.OnDisable(err)
+		}
+	})
+}
+
+// isDisabled returns true if the cache is not used any more.
+func (c *Cache) isDisabled() bool {
+	return atomic.LoadInt32(&c.disabled) != 0
+}
+
 // Wrap returns a backend with a cache.
 func (c *Cache) Wrap(be restic.Backend) restic.Backend {
 	return newBackend(be, c)
@@ -34,6 +34,40 @@ func (c *Cache) canBeCached(t restic.FileType) bool {
 	return true
 }
 
+// writeError is returned by Save when the file could not be written to the
+// cache, as opposed to an error reading the data.
+type writeError struct {
+	err error
+}
+
+func (e *writeError) Error() string {
+	return "unable to write to the cache: " + e.err.Error()
+}
+
+func (e *writeError) Unwrap() error {
+	return e.err
+}
+
+// isWriteError returns true if err was caused by writing to the cache.
+func isWriteError(err error) bool {
+	var werr *writeError
+	return errors.As(err, &werr)
+}
+
+// errWriter records the errors returned by the underlying writer.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
 type readCloser struct {
 	io.Reader
 	io.Closer
@@ -101,20 +135,24 @@ func (c *Cache) Save(h restic.Handle, rd io.Reader) error {
 	dir := filepath.Dir(finalname)
 	err := fs.Mkdir(dir, 0700)
 	if err != nil && !errors.Is(err, os.ErrExist) {
-		return err
+		return &writeError{err}
 	}
 
 	// First save to a temporary location. This allows multiple concurrent
 	// restics to use a single cache dir.
 	f, err := ioutil.TempFile(dir, "tmp-")
 	if err != nil {
-		return err
+		return &writeError{err}
 	}
 
-	n, err := io.Copy(f, rd)
+	wr := &errWriter{w: f}
+	n, err := io.Copy(wr, rd)
 	if err != nil {
 		_ = f.Close()
 		_ = fs.Remove(f.Name())
+		if wr.err != nil {
+			return &writeError{wr.err}
+		}
 		return errors.Wrap(err, "Copy")
 	}
 
@@ -128,7 +166,7 @@ func (c *Cache) Save(h restic.Handle, rd io.Reader) error {
 	// Close, then rename. Windows doesn't like the reverse order.
 	if err = f.Close(); err != nil {
 		_ = fs.Remove(f.Name())
-		return errors.WithStack(err)
+		return &writeError{err}
 	}
 
 	err = fs.Rename(f.Name(), finalname)
@@ -144,8 +182,11 @@ func (c *Cache) Save(h restic.Handle, rd io.Reader) error {
 		// and the other process has written the desired contents to f.
 		err = nil
 	}
+	if err != nil {
+		return &writeError{err}
+	}
 
-	return errors.WithStack(err)
+	return nil
 }
 
 // Remove deletes a file. When the file is not cache, no error is returned.
@@ -0,0 +1,215 @@
+package checker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// The scopes of the check state, the states of incremental checks and of
+// resumable scrubs are kept in separate files.
+const (
+	CheckScope = "check"
+	ScrubScope = "scrub"
+)
+
+// CheckStateFile returns the name of the file in dir which holds the check
+// state of the repository with the given ID for scope.
+func CheckStateFile(dir, repoID, scope string) string {
+	return filepath.Join(dir, repoID, scope+"-state.json")
+}
+
+// CheckState records which packs have been verified and when. The next
+// incremental check only needs to read the packs added since then, and an
+// interrupted scrub only needs to read the packs which have not been verified
+// yet.
+type CheckState struct {
+	// Time is the time when the verification has started.
+	Time time.Time
+
+	mu      sync.Mutex
+	packs   map[restic.ID]int64
+	checked restic.IDSet
+	corrupt map[restic.ID]string
+}
+
+// checkStatePack is the format of a pack in the check state on disk.
+type checkStatePack struct {
+	ID      restic.ID `json:"id"`
+	Size    int64     `json:"size"`
+	Checked bool      `json:"checked,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// checkStateData is the format of the check state on disk.
+type checkStateData struct {
+	Time  time.Time        `json:"time"`
+	Packs []checkStatePack `json:"packs"`
+}
+
+// NewCheckState returns a state for the verification of packs started at time
+// t, none of the packs has been verified so far.
+func NewCheckState(t time.Time, packs map[restic.ID]int64) *CheckState {
+	selected := make(map[restic.ID]int64, len(packs))
+	for id, size := range packs {
+		selected[id] = size
+	}
+
+	return &CheckState{
+		Time:    t,
+		packs:   selected,
+		checked: restic.NewIDSet(),
+		corrupt: make(map[restic.ID]string),
+	}
+}
+
+// LoadCheckState loads the state from filename. If the file does not exist,
+// nil is returned.
+func LoadCheckState(filename string) (*CheckState, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile")
+	}
+
+	var data checkStateData
+	err = json.Unmarshal(buf, &data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	s := NewCheckState(data.Time, nil)
+	for _, pack := range data.Packs {
+		s.packs[pack.ID] = pack.Size
+		if pack.Checked {
+			s.checked.Insert(pack.ID)
+		}
+		if pack.Error != "" {
+			s.corrupt[pack.ID] = pack.Error
+		}
+	}
+	return s, nil
+}
+
+// Save writes the state to filename. The file is replaced atomically so that
+// an interrupted write does not destroy the previous state.
+func (s *CheckState) Save(filename string) error {
+	s.mu.Lock()
+	data := checkStateData{Time: s.Time}
+	for id, size := range s.packs {
+		data.Packs = append(data.Packs, checkStatePack{
+			ID:      id,
+			Size:    size,
+			Checked: s.checked.Has(id),
+			Error:   s.corrupt[id],
+		})
+	}
+	s.mu.Unlock()
+
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	return errors.WithStack(fs.WriteFileAtomic(filename, buf))
+}
+
+// Valid reports whether all packs recorded in the state are still contained in
+// allPacks. Packs are only removed by prune, which may have repacked their
+// blobs into packs that look new but were written before the state. The state
+// must not be used anymore in that case.
+func (s *CheckState) Valid(allPacks map[restic.ID]int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.packs {
+		if _, ok := allPacks[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// DropRemoved removes the packs which are not contained in allPacks anymore,
+// for example because they were removed by prune, from the state. A scrub
+// which is resumed only verifies the packs which still exist.
+func (s *CheckState) DropRemoved(allPacks map[restic.ID]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.packs {
+		if _, ok := allPacks[id]; !ok {
+			delete(s.packs, id)
+			s.checked.Delete(id)
+			delete(s.corrupt, id)
+		}
+	}
+}
+
+// Packs returns all packs recorded in the state.
+func (s *CheckState) Packs() map[restic.ID]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	packs := make(map[restic.ID]int64, len(s.packs))
+	for id, size := range s.packs {
+		packs[id] = size
+	}
+	return packs
+}
+
+// Verified returns the packs which have been verified.
+func (s *CheckState) Verified() restic.IDSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return restic.NewIDSet(s.checked.List()...)
+}
+
+// Remaining returns the packs which have not been verified yet.
+func (s *CheckState) Remaining() map[restic.ID]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	packs := make(map[restic.ID]int64)
+	for id, size := range s.packs {
+		if !s.checked.Has(id) {
+			packs[id] = size
+		}
+	}
+	return packs
+}
+
+// Corrupt returns the packs for which the verification failed along with the
+// error message.
+func (s *CheckState) Corrupt() map[restic.ID]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	corrupt := make(map[restic.ID]string, len(s.corrupt))
+	for id, msg := range s.corrupt {
+		corrupt[id] = msg
+	}
+	return corrupt
+}
+
+// Checked records that the pack id has been verified, err is the result of
+// the verification.
+func (s *CheckState) Checked(id restic.ID, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checked.Insert(id)
+	if err != nil {
+		s.corrupt[id] = err.Error()
+	}
+}
@@ -0,0 +1,48 @@
+package checker
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCheckState(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	filename := CheckStateFile(tempdir, "repo", CheckScope)
+	rtest.Equals(t, filepath.Join(tempdir, "repo", "check-state.json"), filename)
+
+	state, err := LoadCheckState(filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, state == nil, "expected no state for missing file, got %v", state)
+
+	ids := []restic.ID{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	packs := map[restic.ID]int64{ids[0]: 10, ids[1]: 20, ids[2]: 30}
+	now := time.Unix(1600000000, 0).UTC()
+
+	state = NewCheckState(now, packs)
+	state.Checked(ids[0], nil)
+	state.Checked(ids[1], errors.New("damaged"))
+	rtest.Equals(t, map[restic.ID]int64{ids[2]: 30}, state.Remaining())
+	rtest.OK(t, state.Save(filename))
+
+	state, err = LoadCheckState(filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, state.Time.Equal(now), "wrong time, want %v, got %v", now, state.Time)
+	rtest.Equals(t, packs, state.Packs())
+	rtest.Equals(t, restic.NewIDSet(ids[0], ids[1]), state.Verified())
+	rtest.Equals(t, map[restic.ID]int64{ids[2]: 30}, state.Remaining())
+	rtest.Equals(t, map[restic.ID]string{ids[1]: "damaged"}, state.Corrupt())
+
+	// new packs don't invalidate the state
+	allPacks := map[restic.ID]int64{ids[0]: 10, ids[1]: 20, ids[2]: 30, ids[3]: 40}
+	rtest.Assert(t, state.Valid(allPacks), "state should be valid with additional packs")
+
+	// removed packs do
+	delete(allPacks, ids[1])
+	rtest.Assert(t, !state.Valid(allPacks), "state should be invalid after a pack was removed")
+}
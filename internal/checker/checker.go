@@ -43,6 +43,10 @@ type Checker struct {
 	snapshots   restic.Lister
 
 	repo restic.Repository
+
+	// ReadConcurrency is the number of packs downloaded concurrently by
+	// VerifyPacks, zero means one per backend connection.
+	ReadConcurrency uint
 }
 
 // New returns a new checker which runs on repo.
@@ -284,6 +288,23 @@ func (c *Checker) Packs(ctx context.Context, errChan chan<- error) {
 	}
 }
 
+// OrphanedPacks lists the packs in the repository and returns the IDs and
+// sizes of the packs which are not referenced in any index. LoadIndex must be
+// called before.
+func (c *Checker) OrphanedPacks(ctx context.Context) (map[restic.ID]int64, error) {
+	orphaned := make(map[restic.ID]int64)
+	err := c.repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		if _, ok := c.packs[id]; !ok {
+			orphaned[id] = size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orphaned, nil
+}
+
 // Error is an error that occurred while checking a repository.
 type Error struct {
 	TreeID restic.ID
@@ -497,8 +518,11 @@ func (c *Checker) GetPacks() map[restic.ID]int64 {
 	return c.packs
 }
 
+// packLoader runs fn with a reader that yields the complete pack file.
+type packLoader func(ctx context.Context, fn func(rd io.Reader) error) error
+
 // checkPack reads a pack and checks the integrity of all blobs.
-func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []restic.Blob, size int64, bufRd *bufio.Reader) error {
+func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []restic.Blob, size int64, bufRd *bufio.Reader, load packLoader) error {
 	debug.Log("checking pack %v", id.String())
 
 	if len(blobs) == 0 {
@@ -530,7 +554,7 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, blobs []r
 	var hash restic.ID
 	var hdrBuf []byte
 	hashingLoader := func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
-		return r.Backend().Load(ctx, h, int(size), 0, func(rd io.Reader) error {
+		return load(ctx, func(rd io.Reader) error {
 			hrd := hashing.NewReader(rd, sha256.New())
 			bufRd.Reset(hrd)
 
@@ -622,51 +646,136 @@ func (c *Checker) ReadData(ctx context.Context, errChan chan<- error) {
 	c.ReadPacks(ctx, c.packs, nil, errChan)
 }
 
-// ReadPacks loads data from specified packs and checks the integrity.
+// ReadPacks loads data from specified packs and checks the integrity. The
+// progress p is advanced by the size of each checked pack.
 func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *progress.Counter, errChan chan<- error) {
 	defer close(errChan)
 
+	err := c.VerifyPacks(ctx, packs, func(id restic.ID, size int64, err error) {
+		p.Add(uint64(size))
+		if err == nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case errChan <- err:
+		}
+	})
+	if err != nil {
+		select {
+		case <-ctx.Done():
+			return
+		case errChan <- err:
+		}
+	}
+}
+
+// VerifyPacks loads data from the specified packs and checks the integrity.
+// The function done is called for each pack once it has been checked, err is
+// nil if the pack is intact. It is called concurrently from several
+// goroutines.
+//
+// The packs are downloaded by ReadConcurrency workers and verified by a
+// separate set of workers, so that the connections to the backend are not
+// idle while the contents are checked. At most twice ReadConcurrency packs are
+// held in memory at the same time.
+func (c *Checker) VerifyPacks(ctx context.Context, packs map[restic.ID]int64, done func(id restic.ID, size int64, err error)) error {
 	g, ctx := errgroup.WithContext(ctx)
 	type checkTask struct {
 		id    restic.ID
 		size  int64
 		blobs []restic.Blob
+		buf   []byte
+		err   error
 	}
 	ch := make(chan checkTask)
+	downloaded := make(chan checkTask)
 
-	// as packs are streamed the concurrency is limited by IO
-	workerCount := int(c.repo.Connections())
-	// run workers
-	for i := 0; i < workerCount; i++ {
-		g.Go(func() error {
-			// create a buffer that is large enough to be reused by repository.StreamPack
-			// this ensures that we can read the pack header later on
-			bufRd := bufio.NewReaderSize(nil, repository.MaxStreamBufferSize)
-			for {
-				var ps checkTask
-				var ok bool
+	downloadWorkers := int(c.ReadConcurrency)
+	if downloadWorkers == 0 {
+		downloadWorkers = int(c.repo.Connections())
+	}
+	verifyWorkers := runtime.GOMAXPROCS(0)
+	if verifyWorkers > downloadWorkers {
+		verifyWorkers = downloadWorkers
+	}
+
+	// buffers holds the buffers which can be reused for downloading packs,
+	// taking a buffer limits the number of packs in flight
+	maxInFlight := downloadWorkers + verifyWorkers
+	buffers := make(chan []byte, maxInFlight)
+	for i := 0; i < maxInFlight; i++ {
+		buffers <- nil
+	}
 
+	var downloadWg sync.WaitGroup
+	for i := 0; i < downloadWorkers; i++ {
+		downloadWg.Add(1)
+		g.Go(func() error {
+			defer downloadWg.Done()
+			for ps := range ch {
+				var buf []byte
 				select {
 				case <-ctx.Done():
 					return nil
-				case ps, ok = <-ch:
-					if !ok {
-						return nil
-					}
+				case buf = <-buffers:
 				}
 
-				err := checkPack(ctx, c.repo, ps.id, ps.blobs, ps.size, bufRd)
-				p.Add(1)
-				if err == nil {
-					continue
+				if cap(buf) < int(ps.size) {
+					buf = make([]byte, ps.size)
 				}
+				ps.buf = buf[:ps.size]
+
+				h := restic.Handle{Type: restic.PackFile, Name: ps.id.String()}
+				ps.err = c.repo.Backend().Load(ctx, h, int(ps.size), 0, func(rd io.Reader) error {
+					_, err := io.ReadFull(rd, ps.buf)
+					return err
+				})
 
 				select {
 				case <-ctx.Done():
 					return nil
-				case errChan <- err:
+				case downloaded <- ps:
+				}
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		downloadWg.Wait()
+		close(downloaded)
+		return nil
+	})
+
+	for i := 0; i < verifyWorkers; i++ {
+		g.Go(func() error {
+			// create a buffer that is large enough to be reused by repository.StreamPack
+			// this ensures that we can read the pack header later on
+			bufRd := bufio.NewReaderSize(nil, repository.MaxStreamBufferSize)
+			for ps := range downloaded {
+				err := ps.err
+				if err != nil {
+					debug.Log("  error downloading pack: %v", err)
+					err = errors.Errorf("pack %v failed to download: %v", ps.id, err)
+				} else {
+					err = checkPack(ctx, c.repo, ps.id, ps.blobs, ps.size, bufRd, func(ctx context.Context, fn func(rd io.Reader) error) error {
+						return fn(bytes.NewReader(ps.buf))
+					})
+					if err != nil && ctx.Err() == nil {
+						err = checkPackManifest(ctx, c.repo, ps.id, ps.buf, err)
+					}
+				}
+				buffers <- ps.buf
+
+				if ctx.Err() != nil {
+					// the pack was not checked completely
+					continue
 				}
+				done(ps.id, ps.size, err)
 			}
+			return nil
 		})
 	}
 
@@ -686,12 +795,5 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 	}
 	close(ch)
 
-	err := g.Wait()
-	if err != nil {
-		select {
-		case <-ctx.Done():
-			return
-		case errChan <- err:
-		}
-	}
+	return g.Wait()
 }
@@ -9,11 +9,13 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/hashing"
@@ -153,6 +155,16 @@ func TestUnreferencedPack(t *testing.T) {
 	} else {
 		t.Errorf("expected error returned by checker.Packs() to be PackError, got %v", err)
 	}
+
+	orphaned, err := chkr.OrphanedPacks(context.TODO())
+	test.OK(t, err)
+	test.Equals(t, 1, len(orphaned))
+	for id, size := range orphaned {
+		test.Equals(t, packID, id.String())
+		fi, err := repo.Backend().Stat(context.TODO(), restic.Handle{Type: restic.PackFile, Name: packID})
+		test.OK(t, err)
+		test.Equals(t, fi.Size, size)
+	}
 }
 
 func TestUnreferencedBlobs(t *testing.T) {
@@ -383,6 +395,93 @@ func TestCheckerModifiedData(t *testing.T) {
 	}
 }
 
+func TestCheckerReadConcurrency(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	archiver.TestSnapshot(t, repo, ".", nil)
+
+	// damage one of the packs
+	var damaged restic.ID
+	var packCount int
+	test.OK(t, repo.List(context.TODO(), restic.PackFile, func(id restic.ID, size int64) error {
+		packCount++
+		damaged = id
+		return nil
+	}))
+	h := restic.Handle{Type: restic.PackFile, Name: damaged.String()}
+	buf, err := backend.LoadAll(context.TODO(), nil, repo.Backend(), h)
+	test.OK(t, err)
+	buf[0] ^= 0xff
+	test.OK(t, repo.Backend().Remove(context.TODO(), h))
+	test.OK(t, repo.Backend().Save(context.TODO(), h, restic.NewByteReader(buf, repo.Backend().Hasher())))
+
+	for _, concurrency := range []uint{1, 3, 8} {
+		chkr := checker.New(repo, false)
+		chkr.ReadConcurrency = concurrency
+		_, errs := chkr.LoadIndex(context.TODO())
+		test.OKs(t, errs)
+
+		var mu sync.Mutex
+		verified := restic.NewIDSet()
+		var failed restic.IDs
+		test.OK(t, chkr.VerifyPacks(context.TODO(), chkr.GetPacks(), func(id restic.ID, size int64, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			verified.Insert(id)
+			if err != nil {
+				failed = append(failed, id)
+			}
+		}))
+
+		test.Equals(t, packCount, len(verified))
+		test.Equals(t, restic.IDs{damaged}, failed)
+	}
+}
+
+func TestCheckerPackManifest(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+	_, cleanupRepo := repository.TestRepositoryWithBackend(t, be, 0)
+	defer cleanupRepo()
+
+	repo, err := repository.New(be, repository.Options{PackManifests: true})
+	test.OK(t, err)
+	test.OK(t, repo.SearchKey(context.TODO(), test.TestPassword, 5, ""))
+	archiver.TestSnapshot(t, repo, ".", nil)
+
+	// damage a single blob of one of the data packs
+	test.OK(t, repo.LoadIndex(context.TODO()))
+	var damaged restic.PackedBlob
+	repo.Index().Each(context.TODO(), func(pb restic.PackedBlob) {
+		if pb.Type == restic.DataBlob {
+			damaged = pb
+		}
+	})
+	h := restic.Handle{Type: restic.PackFile, Name: damaged.PackID.String()}
+	buf, err := backend.LoadAll(context.TODO(), nil, be, h)
+	test.OK(t, err)
+	buf[damaged.Offset+damaged.Length/2] ^= 0xff
+	test.OK(t, be.Remove(context.TODO(), h))
+	test.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(buf, be.Hasher())))
+
+	chkr := checker.New(repo, false)
+	_, errs := chkr.LoadIndex(context.TODO())
+	test.OKs(t, errs)
+
+	errs = checkData(chkr)
+	test.Equals(t, 1, len(errs))
+	msg := errs[0].Error()
+	test.Assert(t, strings.Contains(msg, "1 of "), "manifest check missing in error %q", msg)
+	test.Assert(t, strings.Contains(msg, damaged.ID.String()), "damaged blob missing in error %q", msg)
+
+	// the manifest is only a hint, a pack without it is still checked
+	test.OK(t, be.Remove(context.TODO(), restic.Handle{Type: restic.ManifestFile, Name: damaged.PackID.String()}))
+	errs = checkData(chkr)
+	test.Equals(t, 1, len(errs))
+	test.Assert(t, !strings.Contains(errs[0].Error(), "manifest"), "unexpected manifest check in error %q", errs[0])
+}
+
 // loadTreesOnceRepository allows each tree to be loaded only once
 type loadTreesOnceRepository struct {
 	restic.Repository
@@ -0,0 +1,63 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// checkPackManifest is called for the pack id which failed the check with
+// packErr, buf holds the contents of the pack. If the pack has a manifest, the
+// blobs listed in it are verified independently of the pack header and the
+// index, so that the error can be narrowed down to the damaged blobs.
+func checkPackManifest(ctx context.Context, r restic.Repository, id restic.ID, buf []byte, packErr error) error {
+	m, err := repository.LoadPackManifest(ctx, r.Backend(), r.Key(), id)
+	if r.Backend().IsNotExist(err) {
+		return packErr
+	}
+	if err != nil {
+		debug.Log("  error loading manifest: %v", err)
+		return errors.Errorf("%v\nthe manifest of the pack could not be loaded: %v", packErr, err)
+	}
+
+	var damaged []string
+	blobs := make([]restic.Blob, 0, len(m.Blobs))
+	for _, blob := range m.PackBlobs() {
+		if int64(blob.Offset)+int64(blob.Length) > int64(len(buf)) {
+			damaged = append(damaged, fmt.Sprintf("%v blob %v at offset %d: missing, the pack is truncated", blob.Type, blob.ID, blob.Offset))
+			continue
+		}
+		blobs = append(blobs, blob)
+	}
+
+	offsets := make(map[restic.BlobHandle]uint, len(blobs))
+	for _, blob := range blobs {
+		offsets[blob.BlobHandle] = blob.Offset
+	}
+
+	load := func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		return fn(bytes.NewReader(buf[offset : offset+int64(length)]))
+	}
+	err = repository.StreamPack(ctx, load, r.Key(), id, blobs, func(blob restic.BlobHandle, _ []byte, err error) error {
+		if err != nil {
+			damaged = append(damaged, fmt.Sprintf("%v blob %v at offset %d: %v", blob.Type, blob.ID, offsets[blob], err))
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Errorf("%v\nverifying the blobs listed in the manifest failed: %v", packErr, err)
+	}
+
+	if len(damaged) == 0 {
+		return errors.Errorf("%v\nall %d blobs listed in the manifest are intact", packErr, len(m.Blobs))
+	}
+	return errors.Errorf("%v\n%d of %d blobs listed in the manifest are damaged:\n  %v",
+		packErr, len(damaged), len(m.Blobs), strings.Join(damaged, "\n  "))
+}
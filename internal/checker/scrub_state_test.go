@@ -0,0 +1,46 @@
+package checker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestScrubState(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	filename := CheckStateFile(tempdir, "repo", ScrubScope)
+
+	state, err := LoadCheckState(filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, state == nil, "expected no state for missing file, got %v", state)
+
+	ids := []restic.ID{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	allPacks := map[restic.ID]int64{ids[0]: 10, ids[1]: 20, ids[2]: 30, ids[3]: 40}
+	packs := map[restic.ID]int64{ids[0]: 10, ids[1]: 20, ids[2]: 30}
+
+	state = NewCheckState(time.Now(), packs)
+	state.Checked(ids[0], nil)
+	state.Checked(ids[1], errors.New("damaged"))
+	rtest.Equals(t, map[restic.ID]int64{ids[2]: 30}, state.Remaining())
+	rtest.OK(t, state.Save(filename))
+
+	state, err = LoadCheckState(filename)
+	rtest.OK(t, err)
+	state.DropRemoved(allPacks)
+	rtest.Equals(t, packs, state.Packs())
+	rtest.Equals(t, map[restic.ID]int64{ids[2]: 30}, state.Remaining())
+	rtest.Equals(t, map[restic.ID]string{ids[1]: "damaged"}, state.Corrupt())
+
+	// packs which were removed from the repository are dropped
+	delete(allPacks, ids[1])
+	state, err = LoadCheckState(filename)
+	rtest.OK(t, err)
+	state.DropRemoved(allPacks)
+	rtest.Equals(t, map[restic.ID]int64{ids[0]: 10, ids[2]: 30}, state.Packs())
+	rtest.Equals(t, restic.NewIDSet(ids[0]), state.Verified())
+	rtest.Equals(t, map[restic.ID]string{}, state.Corrupt())
+}
@@ -0,0 +1,193 @@
+// Package credential obtains the credentials for backends from an external
+// command, so that they don't have to be stored in the environment.
+package credential
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// expiryMargin is the time before the expiration at which the credentials are
+// considered expired, so that they are not used for requests which take long.
+const expiryMargin = time.Minute
+
+// awsNames maps the fields of the AWS credential_process format to the names
+// of the environment variables.
+var awsNames = map[string]string{
+	"AccessKeyId":     "AWS_ACCESS_KEY_ID",
+	"SecretAccessKey": "AWS_SECRET_ACCESS_KEY",
+	"SessionToken":    "AWS_SESSION_TOKEN",
+}
+
+// Command runs an external command to obtain credentials. The command prints
+// the credentials using the names of the environment variables which would
+// otherwise be used, either as a JSON object or as key=value lines. The result
+// is cached until the time given in the optional "Expiration" value, or for the
+// lifetime of the process if no expiration is given.
+type Command struct {
+	args []string
+
+	mu      sync.Mutex
+	values  map[string]string
+	expires time.Time
+
+	// now returns the current time, it is replaced in tests.
+	now func() time.Time
+}
+
+// NewCommand returns a Command which runs command, the arguments are split
+// like for the password command.
+func NewCommand(command string) (*Command, error) {
+	args, err := backend.SplitShellStrings(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("credential command is empty")
+	}
+
+	return &Command{args: args, now: time.Now}, nil
+}
+
+// expired returns true if the credentials have to be obtained again. c.mu must
+// be held.
+func (c *Command) expired() bool {
+	if c.values == nil {
+		return true
+	}
+	return !c.expires.IsZero() && !c.now().Add(expiryMargin).Before(c.expires)
+}
+
+// Expired returns true if the cached credentials have expired, the next call to
+// Get runs the command again.
+func (c *Command) Expired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expired()
+}
+
+// Expires returns the time when the cached credentials expire, it is zero if
+// no expiration was given.
+func (c *Command) Expires() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expires
+}
+
+// Get returns the credentials, the command is only run if no credentials are
+// cached or the cached credentials have expired.
+func (c *Command) Get(ctx context.Context) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.expired() {
+		return c.values, nil
+	}
+
+	debug.Log("running credential command %v", c.args[0])
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("credential command failed: %v", err)
+	}
+
+	values, expires, err := parse(output)
+	if err != nil {
+		return nil, err
+	}
+	if !expires.IsZero() && !c.now().Add(expiryMargin).Before(expires) {
+		return nil, errors.Errorf("credential command returned credentials which expire at %v", expires)
+	}
+
+	c.values = values
+	c.expires = expires
+	return values, nil
+}
+
+// Lookup returns the value for name, it returns false if the command did not
+// print a value for name.
+func (c *Command) Lookup(ctx context.Context, name string) (string, bool, error) {
+	values, err := c.Get(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	v, ok := values[name]
+	return v, ok, nil
+}
+
+// parse parses the output of the command, either a JSON object or key=value
+// lines. Empty lines and lines starting with # are ignored in the latter.
+func parse(output []byte) (values map[string]string, expires time.Time, err error) {
+	values = make(map[string]string)
+
+	output = bytes.TrimSpace(output)
+	if bytes.HasPrefix(output, []byte("{")) {
+		var obj map[string]interface{}
+		err := json.Unmarshal(output, &obj)
+		if err != nil {
+			return nil, time.Time{}, errors.Errorf("unable to parse the output of the credential command: %v", err)
+		}
+		for k, v := range obj {
+			switch v := v.(type) {
+			case string:
+				values[k] = v
+			case float64, bool:
+				values[k] = fmt.Sprint(v)
+			default:
+				return nil, time.Time{}, errors.Errorf("invalid value for %q in the output of the credential command", k)
+			}
+		}
+	} else {
+		sc := bufio.NewScanner(bytes.NewReader(output))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				return nil, time.Time{}, errors.Errorf("invalid line in the output of the credential command, expected key=value")
+			}
+			values[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		if err := sc.Err(); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	for from, to := range awsNames {
+		if v, ok := values[from]; ok {
+			if _, ok := values[to]; !ok {
+				values[to] = v
+			}
+			delete(values, from)
+		}
+	}
+
+	for _, name := range []string{"Expiration", "EXPIRATION", "expiration"} {
+		s, ok := values[name]
+		if !ok {
+			continue
+		}
+		expires, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, time.Time{}, errors.Errorf("invalid expiration %q in the output of the credential command: %v", s, err)
+		}
+		delete(values, name)
+	}
+
+	return values, expires, nil
+}
@@ -0,0 +1,122 @@
+package credential
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParse(t *testing.T) {
+	expires := time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	var tests = []struct {
+		output  string
+		values  map[string]string
+		expires time.Time
+	}{
+		{
+			output: "B2_ACCOUNT_ID=id\nB2_ACCOUNT_KEY = key=with=equal\n\n# comment\n",
+			values: map[string]string{"B2_ACCOUNT_ID": "id", "B2_ACCOUNT_KEY": "key=with=equal"},
+		},
+		{
+			output:  `{"AZURE_ACCOUNT_NAME": "name", "AZURE_ACCOUNT_KEY": "key", "expiration": "2022-05-06T07:08:09Z"}`,
+			values:  map[string]string{"AZURE_ACCOUNT_NAME": "name", "AZURE_ACCOUNT_KEY": "key"},
+			expires: expires,
+		},
+		{
+			// the AWS credential_process format
+			output: `{"Version": 1, "AccessKeyId": "id", "SecretAccessKey": "secret", "SessionToken": "token", "Expiration": "2022-05-06T07:08:09Z"}`,
+			values: map[string]string{
+				"Version":               "1",
+				"AWS_ACCESS_KEY_ID":     "id",
+				"AWS_SECRET_ACCESS_KEY": "secret",
+				"AWS_SESSION_TOKEN":     "token",
+			},
+			expires: expires,
+		},
+	}
+
+	for _, test := range tests {
+		values, exp, err := parse([]byte(test.output))
+		rtest.OK(t, err)
+		rtest.Equals(t, test.values, values)
+		rtest.Assert(t, exp.Equal(test.expires), "wrong expiration %v, want %v", exp, test.expires)
+	}
+
+	for _, output := range []string{
+		"no key value pair",
+		"=value",
+		`{"foo": `,
+		`{"foo": ["bar"]}`,
+		`{"Expiration": "tomorrow"}`,
+	} {
+		_, _, err := parse([]byte(output))
+		rtest.Assert(t, err != nil, "expected error for %q", output)
+	}
+}
+
+func TestCommandExpiry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a shell script")
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// the script prints the number of times it has been called, the
+	// credentials expire n hours after 10:00
+	counter := filepath.Join(tempdir, "counter")
+	script := filepath.Join(tempdir, "creds")
+	rtest.OK(t, ioutil.WriteFile(script, []byte("#!/bin/sh\necho x >> "+counter+"\nn=$(wc -l < "+counter+" | tr -d ' ')\necho \"KEY=$n\"\necho \"EXPIRATION=2022-05-06T1${n}:00:00Z\"\n"), 0700))
+
+	c, err := NewCommand(script)
+	rtest.OK(t, err)
+
+	now := time.Date(2022, 5, 6, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	v, ok, err := c.Lookup(context.TODO(), "KEY")
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "KEY not found")
+	rtest.Equals(t, "1", v)
+	rtest.Assert(t, !c.Expired(), "credentials expired too early")
+	rtest.Equals(t, time.Date(2022, 5, 6, 11, 0, 0, 0, time.UTC), c.Expires())
+
+	// the cached credentials are used
+	now = now.Add(30 * time.Minute)
+	v, _, err = c.Lookup(context.TODO(), "KEY")
+	rtest.OK(t, err)
+	rtest.Equals(t, "1", v)
+
+	_, ok, err = c.Lookup(context.TODO(), "MISSING")
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "unexpected value for MISSING")
+
+	// shortly before the expiration, the command is run again
+	now = time.Date(2022, 5, 6, 10, 59, 30, 0, time.UTC)
+	rtest.Assert(t, c.Expired(), "credentials should be expired")
+	v, _, err = c.Lookup(context.TODO(), "KEY")
+	rtest.OK(t, err)
+	rtest.Equals(t, "2", v)
+	rtest.Assert(t, !c.Expired(), "new credentials should not be expired")
+
+	// credentials which are expired already are rejected
+	now = time.Date(2022, 5, 6, 14, 0, 0, 0, time.UTC)
+	_, err = c.Get(context.TODO())
+	rtest.Assert(t, err != nil, "expected error for expired credentials")
+}
+
+func TestCommandFailure(t *testing.T) {
+	_, err := NewCommand("")
+	rtest.Assert(t, err != nil, "expected error for an empty command")
+
+	c, err := NewCommand("restic-credential-command-does-not-exist")
+	rtest.OK(t, err)
+	_, err = c.Get(context.TODO())
+	rtest.Assert(t, err != nil, "expected error for a missing command")
+}
@@ -18,6 +18,10 @@ type Dumper struct {
 	format string
 	repo   restic.Repository
 	w      io.Writer
+
+	// WriteProgress, if set, is called with the number of bytes of the
+	// contents of node written to the archive.
+	WriteProgress func(node *restic.Node, bytes uint64)
 }
 
 func New(format string, repo restic.Repository, w io.Writer) *Dumper {
@@ -37,6 +41,13 @@ func (d *Dumper) DumpTree(ctx context.Context, tree *restic.Tree, rootPath strin
 	ch := make(chan *restic.Node, 10)
 	go sendTrees(ctx, d.repo, tree, rootPath, ch)
 
+	return d.DumpNodes(ctx, ch)
+}
+
+// DumpNodes writes the nodes received from ch to the archive until ch is
+// closed. The Path of each node is used as its name in the archive, the nodes
+// of a directory must follow the directory itself.
+func (d *Dumper) DumpNodes(ctx context.Context, ch <-chan *restic.Node) error {
 	switch d.format {
 	case "tar":
 		return d.dumpTar(ctx, ch)
@@ -103,29 +114,100 @@ func (d *Dumper) WriteNode(ctx context.Context, node *restic.Node) error {
 }
 
 func (d *Dumper) writeNode(ctx context.Context, w io.Writer, node *restic.Node) error {
+	var buf []byte
+	for _, id := range node.Content {
+		blob, err := d.loadBlob(ctx, id, &buf)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(blob); err != nil {
+			return errors.Wrap(err, "Write")
+		}
+		if d.WriteProgress != nil {
+			d.WriteProgress(node, uint64(len(blob)))
+		}
+	}
+
+	return nil
+}
+
+// WriteNodeRange writes length bytes of the contents of a file node, starting
+// at offset, directly to d's Writer. Only the blobs which contain parts of the
+// range are loaded. If the range extends beyond the end of the file, the data
+// up to the end is written. A length of zero selects all data up to the end.
+func (d *Dumper) WriteNodeRange(ctx context.Context, node *restic.Node, offset, length uint64) error {
+	if offset > node.Size {
+		return errors.Errorf("offset %d is beyond the end of the file (size %d)", offset, node.Size)
+	}
+
+	end := node.Size
+	if length > 0 && length < end-offset {
+		end = offset + length
+	}
+
 	var (
 		buf []byte
-		err error
+		pos uint64 // offset of the current blob within the file
 	)
 	for _, id := range node.Content {
-		blob, ok := d.cache.Get(id)
+		if pos >= end {
+			break
+		}
+
+		size, ok := d.repo.LookupBlobSize(id, restic.DataBlob)
 		if !ok {
-			blob, err = d.repo.LoadBlob(ctx, restic.DataBlob, id, buf)
-			if err != nil {
-				return err
-			}
+			return errors.Errorf("data blob %v not found in the index", id.Str())
+		}
+		blobEnd := pos + uint64(size)
+		if blobEnd <= offset {
+			pos = blobEnd
+			continue
+		}
+
+		blob, err := d.loadBlob(ctx, id, &buf)
+		if err != nil {
+			return err
+		}
+		if uint64(len(blob)) != uint64(size) {
+			return errors.Errorf("data blob %v has size %d, the index lists %d", id.Str(), len(blob), size)
+		}
 
-			buf = d.cache.Add(id, blob) // Reuse evicted buffer.
+		// trim the blob to the part within the range
+		start := uint64(0)
+		if offset > pos {
+			start = offset - pos
+		}
+		stop := uint64(len(blob))
+		if end < blobEnd {
+			stop = end - pos
 		}
 
-		if _, err := w.Write(blob); err != nil {
+		if _, err := d.w.Write(blob[start:stop]); err != nil {
 			return errors.Wrap(err, "Write")
 		}
+		pos = blobEnd
 	}
 
 	return nil
 }
 
+// loadBlob returns the data blob with the given id from the cache or the
+// repository. buf holds a buffer which may be reused for loading the blob.
+func (d *Dumper) loadBlob(ctx context.Context, id restic.ID, buf *[]byte) ([]byte, error) {
+	blob, ok := d.cache.Get(id)
+	if ok {
+		return blob, nil
+	}
+
+	blob, err := d.repo.LoadBlob(ctx, restic.DataBlob, id, *buf)
+	if err != nil {
+		return nil, err
+	}
+	*buf = d.cache.Add(id, blob) // Reuse evicted buffer.
+	return blob, nil
+}
+
 // IsDir checks if the given node is a directory.
 func IsDir(node *restic.Node) bool {
 	return node.Type == "dir"
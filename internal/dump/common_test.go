@@ -102,3 +102,55 @@ func WriteTest(t *testing.T, format string, cd CheckDump) {
 		})
 	}
 }
+
+func TestWriteNodeRange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data := rtest.Random(23, 5*1024*1024)
+	tmpdir, repo, cleanup := prepareTempdirRepoSrc(t, archiver.TestDir{
+		"file": archiver.TestFile{Content: string(data)},
+	})
+	defer cleanup()
+
+	back := rtest.Chdir(t, tmpdir)
+	defer back()
+
+	arch := archiver.New(repo, fs.Track{FS: fs.Local{}}, archiver.Options{})
+	sn, _, err := arch.Snapshot(ctx, []string{"."}, archiver.SnapshotOptions{})
+	rtest.OK(t, err)
+
+	tree, err := restic.LoadTree(ctx, repo, *sn.Tree)
+	rtest.OK(t, err)
+	node := tree.Find("file")
+	rtest.Assert(t, node != nil && len(node.Content) > 1, "file is not split into several blobs")
+
+	size, _ := repo.LookupBlobSize(node.Content[0], restic.DataBlob)
+	boundary := uint64(size)
+
+	end := uint64(len(data))
+	for _, test := range []struct {
+		offset, length uint64
+		want           []byte
+	}{
+		{0, 0, data},
+		{0, 10, data[:10]},
+		{100, 50, data[100:150]},
+		{boundary - 5, 10, data[boundary-5 : boundary+5]},
+		{boundary, 10, data[boundary : boundary+10]},
+		{boundary - 10, 10, data[boundary-10 : boundary]},
+		{10, 1 << 40, data[10:]},
+		{end - 1, 0, data[end-1:]},
+		{end, 0, []byte{}},
+	} {
+		buf := &bytes.Buffer{}
+		d := New("tar", repo, buf)
+		rtest.OK(t, d.WriteNodeRange(ctx, node, test.offset, test.length))
+		rtest.Assert(t, bytes.Equal(test.want, buf.Bytes()),
+			"wrong data for offset %d, length %d: got %d bytes, want %d", test.offset, test.length, buf.Len(), len(test.want))
+	}
+
+	d := New("tar", repo, &bytes.Buffer{})
+	err = d.WriteNodeRange(ctx, node, end+1, 0)
+	rtest.Assert(t, err != nil, "expected error for an offset beyond the end")
+}
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -116,6 +117,36 @@ func RemoveIfExists(filename string) error {
 	return err
 }
 
+// WriteFileAtomic writes data to the file filename, which is only readable by
+// the current user. The data is written to a temporary file in the same
+// directory first, which then replaces filename. Readers never see a partially
+// written file and an interrupted write leaves the previous file intact. The
+// directory is created if it does not exist.
+func WriteFileAtomic(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+	err := MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(fixpath(dir), filepath.Base(filename)+"-tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fixpath(filename))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
 // Chtimes changes the access and modification times of the named file,
 // similar to the Unix utime() or utimes() functions.
 //
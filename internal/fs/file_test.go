@@ -0,0 +1,29 @@
+package fs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	dir := filepath.Join(tempdir, "sub", "dir")
+	filename := filepath.Join(dir, "file")
+	rtest.OK(t, WriteFileAtomic(filename, []byte("foo")))
+	rtest.OK(t, WriteFileAtomic(filename, []byte("foobar")))
+
+	buf, err := ioutil.ReadFile(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, "foobar", string(buf))
+
+	// no temporary files are left behind
+	entries, err := ioutil.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+	rtest.Equals(t, "file", entries[0].Name())
+}
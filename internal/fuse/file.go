@@ -6,6 +6,7 @@ package fuse
 import (
 	"context"
 	"sort"
+	"sync"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -34,6 +35,13 @@ type openFile struct {
 	file
 	// cumsize[i] holds the cumulative size of blobs[:i].
 	cumsize []uint64
+
+	mu sync.Mutex
+	// nextOffset is the offset following the last read, a read starting
+	// there is considered sequential
+	nextOffset uint64
+	// readahead is the index of the first blob which has not been prefetched
+	readahead int
 }
 
 func newFile(root *Root, inode uint64, node *restic.Node) (fusefile *file, err error) {
@@ -113,9 +121,18 @@ func (f *openFile) getBlobAt(ctx context.Context, i int) (blob []byte, err error
 	return blob, nil
 }
 
+// blobAt returns the index of the blob containing offset and the offset
+// within this blob. For offsets beyond the end of the file, the number of
+// blobs is returned.
+func (f *openFile) blobAt(offset uint64) (int, uint64) {
+	i := -1 + sort.Search(len(f.cumsize), func(i int) bool {
+		return f.cumsize[i] > offset
+	})
+	return i, offset - f.cumsize[i]
+}
+
 func (f *openFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
 	debug.Log("Read(%v, %v, %v), file size %v", f.node.Name, req.Size, req.Offset, f.node.Size)
-	offset := uint64(req.Offset)
 
 	// as stated in https://godoc.org/bazil.org/fuse/fs#HandleReader there
 	// is no need to check if offset > size
@@ -127,10 +144,7 @@ func (f *openFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.R
 	}
 
 	// Skip blobs before the offset
-	startContent := -1 + sort.Search(len(f.cumsize), func(i int) bool {
-		return f.cumsize[i] > offset
-	})
-	offset -= f.cumsize[startContent]
+	startContent, offset := f.blobAt(uint64(req.Offset))
 
 	dst := resp.Data[0:req.Size]
 	readBytes := 0
@@ -144,7 +158,8 @@ func (f *openFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.R
 	//
 	// However, no lock needed here as getBlobAt can be called conurrently
 	// (blobCache has it's own locking)
-	for i := startContent; remainingBytes > 0 && i < len(f.cumsize)-1; i++ {
+	i := startContent
+	for ; remainingBytes > 0 && i < len(f.cumsize)-1; i++ {
 		blob, err := f.getBlobAt(ctx, i)
 		if err != nil {
 			return err
@@ -163,9 +178,55 @@ func (f *openFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.R
 	}
 	resp.Data = resp.Data[:readBytes]
 
+	f.startReadahead(uint64(req.Offset), uint64(readBytes), i)
+
 	return nil
 }
 
+// startReadahead prefetches the blobs following a sequential read into the
+// blob cache. The read covered length bytes at offset, next is the index of
+// the blob following the last blob of the read.
+func (f *openFile) startReadahead(offset, length uint64, next int) {
+	if f.root.cfg.Readahead <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	sequential := offset == f.nextOffset
+	f.nextOffset = offset + length
+
+	if !sequential {
+		f.mu.Unlock()
+		return
+	}
+
+	start := next
+	if start < f.readahead {
+		start = f.readahead
+	}
+	end := next + f.root.cfg.Readahead
+	if end > len(f.node.Content) {
+		end = len(f.node.Content)
+	}
+	if start >= end {
+		f.mu.Unlock()
+		return
+	}
+	f.readahead = end
+	f.mu.Unlock()
+
+	debug.Log("readahead %v: blobs %d to %d", f.node.Name, start, end)
+	go func() {
+		// the request context is cancelled once Read returns
+		ctx := context.Background()
+		for i := start; i < end; i++ {
+			if _, err := f.getBlobAt(ctx, i); err != nil {
+				return
+			}
+		}
+	}()
+}
+
 func (f *file) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
 	debug.Log("Listxattr(%v, %v)", f.node.Name, req.Size)
 	for _, attr := range f.node.ExtendedAttributes {
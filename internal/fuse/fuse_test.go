@@ -17,6 +17,7 @@ import (
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
+	"golang.org/x/sync/errgroup"
 
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -147,6 +148,72 @@ func TestFuseFile(t *testing.T) {
 	}
 }
 
+func TestFuseFileReadahead(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+
+	var content restic.IDs
+	var memfile []byte
+	for i := 0; i < 5; i++ {
+		buf := rtest.Random(i, 1000+i)
+		id, _, _, err := repo.SaveBlob(ctx, restic.DataBlob, buf, restic.ID{}, false)
+		rtest.OK(t, err)
+		content = append(content, id)
+		memfile = append(memfile, buf...)
+	}
+	rtest.OK(t, repo.Flush(ctx))
+
+	node := &restic.Node{
+		Name:    "disk.img",
+		Size:    uint64(len(memfile)),
+		Content: content,
+	}
+	root := &Root{repo: repo, cfg: Config{Readahead: 2}, blobCache: bloblru.New(blobCacheSize)}
+
+	f, err := newFile(root, fs.GenerateDynamicInode(1, "disk.img"), node)
+	rtest.OK(t, err)
+	h, err := f.Open(ctx, nil, nil)
+	rtest.OK(t, err)
+	of := h.(*openFile)
+
+	// offsets at blob boundaries must map to the start of the next blob
+	i, offset := of.blobAt(1000)
+	rtest.Equals(t, 1, i)
+	rtest.Equals(t, uint64(0), offset)
+	i, offset = of.blobAt(999)
+	rtest.Equals(t, 0, i)
+	rtest.Equals(t, uint64(999), offset)
+
+	// a sequential read of the first blob prefetches the next two blobs
+	buf := make([]byte, 1000)
+	testRead(t, h, 0, 1000, buf)
+	rtest.Equals(t, memfile[:1000], buf)
+
+	waitCached := func(id restic.ID) bool {
+		for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(time.Millisecond) {
+			if _, ok := root.blobCache.Get(id); ok {
+				return true
+			}
+		}
+		return false
+	}
+	rtest.Assert(t, waitCached(content[1]), "blob 1 was not prefetched")
+	rtest.Assert(t, waitCached(content[2]), "blob 2 was not prefetched")
+	_, ok := root.blobCache.Get(content[3])
+	rtest.Assert(t, !ok, "blob 3 was prefetched")
+
+	// a read spanning a blob boundary returns the data of both blobs
+	buf = make([]byte, 1500)
+	testRead(t, h, 1500, 1500, buf)
+	rtest.Equals(t, memfile[1500:3000], buf)
+}
+
 func TestFuseDir(t *testing.T) {
 	repo, cleanup := repository.TestRepository(t)
 	defer cleanup()
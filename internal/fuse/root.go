@@ -21,6 +21,9 @@ type Config struct {
 	Paths         []string
 	TimeTemplate  string
 	PathTemplates []string
+	// Readahead is the number of blobs which are prefetched into the blob
+	// cache when a file is read sequentially
+	Readahead int
 }
 
 // Root is the root node of the fuse mount of a repository.
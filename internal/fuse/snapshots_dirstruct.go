@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -89,23 +90,29 @@ func pathsFromSn(pathTemplate string, timeTemplate string, sn *restic.Snapshot)
 			writeTime = true
 			continue
 
-		case 't':
-			if len(sn.Tags) == 0 {
+		case 't', 'p':
+			var names []string
+			if c == 't' {
+				for _, tag := range sn.Tags {
+					names = append(names, filenameFromTag(tag))
+				}
+			} else {
+				for _, p := range sn.Paths {
+					names = append(names, filenameFromPath(p))
+				}
+			}
+			if len(names) == 0 {
 				return nil, ""
 			}
-			if len(sn.Tags) != 1 {
-				// needs special treatment: Rebuild the string builders
-				newout := make([]strings.Builder, len(out)*len(sn.Tags))
-				for i, tag := range sn.Tags {
-					tag = filenameFromTag(tag)
-					for j := range out {
-						newout[i*len(out)+j].WriteString(out[j].String() + tag)
-					}
+			// needs special treatment: Rebuild the string builders
+			newout := make([]strings.Builder, len(out)*len(names))
+			for i, name := range names {
+				for j := range out {
+					newout[i*len(out)+j].WriteString(out[j].String() + name)
 				}
-				out = newout
-				continue
 			}
-			repl = sn.Tags[0]
+			out = newout
+			continue
 
 		case 'i':
 			repl = sn.ID().Str()
@@ -158,6 +165,38 @@ func filenameFromTag(tag string) string {
 	return strings.ReplaceAll(tag, "/", "_")
 }
 
+// filenameFromPath returns the filename used for a path of a snapshot, the
+// leading slash is removed and all other slashes are replaced by underscores.
+func filenameFromPath(p string) string {
+	return filenameFromTag(strings.TrimPrefix(p, "/"))
+}
+
+// ValidatePathTemplate returns an error if the path template contains an
+// unknown pattern.
+func ValidatePathTemplate(pathTemplate string) error {
+	if pathTemplate == "" {
+		return errors.New("path template is empty")
+	}
+
+	inVerb := false
+	for _, c := range pathTemplate {
+		if !inVerb {
+			inVerb = c == '%'
+			continue
+		}
+		inVerb = false
+		switch c {
+		case 'i', 'I', 'u', 'h', 't', 'p', 'T', '%':
+		default:
+			return errors.Errorf("path template %q contains the unknown pattern %%%c", pathTemplate, c)
+		}
+	}
+	if inVerb {
+		return errors.Errorf("path template %q ends with an incomplete pattern", pathTemplate)
+	}
+	return nil
+}
+
 // determine static path prefix
 func staticPrefix(pathTemplate string) (prefix string) {
 	inVerb := false
@@ -172,7 +211,7 @@ outer:
 		}
 		inVerb = false
 		switch c {
-		case 'i', 'I', 'u', 'h', 't', 'T':
+		case 'i', 'I', 'u', 'h', 't', 'p', 'T':
 			patternStart = i
 			break outer
 		}
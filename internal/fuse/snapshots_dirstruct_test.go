@@ -52,6 +52,30 @@ func TestPathsFromSn(t *testing.T) {
 	p, s = pathsFromSn("%T/%i", "2006/01", sn1)
 	test.Equals(t, []string{"2021/01/12345678"}, p)
 	test.Equals(t, "", s)
+
+	sn2 := &restic.Snapshot{Hostname: "host", Paths: []string{"/home/user", "/etc"}, Tags: []string{"a/b"}, Time: time1}
+	restic.TestSetSnapshotID(t, sn2, id1)
+
+	p, s = pathsFromSn("paths/%p/%T", "2006-01-02T15:04:05", sn2)
+	test.Equals(t, []string{"paths/home_user/", "paths/etc/"}, p)
+	test.Equals(t, "2021-01-01T00:00:01", s)
+
+	p, s = pathsFromSn("tags/%t/%i", "2006-01-02T15:04:05", sn2)
+	test.Equals(t, []string{"tags/a_b/12345678"}, p)
+	test.Equals(t, "", s)
+
+	p, s = pathsFromSn("paths/%p/%T", "2006-01-02T15:04:05", sn1)
+	test.Equals(t, 0, len(p))
+	test.Equals(t, "", s)
+}
+
+func TestValidatePathTemplate(t *testing.T) {
+	for _, templ := range []string{"ids/%i", "tags/%t/%h/%T", "paths/%p/%T", "100%%/%I", "snapshots"} {
+		test.OK(t, ValidatePathTemplate(templ))
+	}
+	for _, templ := range []string{"", "tags/%x/%T", "ids/%i/%"} {
+		test.Assert(t, ValidatePathTemplate(templ) != nil, "expected error for template %q", templ)
+	}
 }
 
 func TestMakeDirs(t *testing.T) {
@@ -0,0 +1,520 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// The diskIndex is an alternative storage for the entries of final indexes
+// for machines on which the in-memory index is too large. The entries are
+// stored in temporary files as tables of fixed-size records sorted by blob ID.
+// Only the pack IDs and a fanout table of 256 KiB per table and blob type are
+// kept in memory. With about 100 bytes per pack ID, including the map to look
+// them up, and at least 8 blobs per pack, this amounts to fewer than 16 bytes
+// per blob instead of the 64 bytes of the in-memory index (see index.go).
+//
+// A lookup first uses the fanout table to determine the range of records
+// which start with the same two bytes as the blob ID. This range is then
+// narrowed by binary search, reading single records from the file, until it
+// is small enough to be read at once. The files are accessed using the page
+// cache of the operating system, which hence decides on how much of the index
+// is held in memory.
+//
+// Final indexes are first merged into the in-memory index as usual. Once it
+// contains diskIndexFlushEntries entries, they are written to a new table. To
+// bound the number of tables which have to be searched for each lookup, the
+// tables are merged into a single one when there are more than
+// diskIndexMaxTables of them.
+
+var (
+	// diskIndexFlushEntries is the number of entries of the in-memory final
+	// index after which they are moved to the disk index.
+	diskIndexFlushEntries uint = 1 << 18
+	// diskIndexMaxTables is the number of tables per blob type after which
+	// the tables are merged.
+	diskIndexMaxTables = 4
+)
+
+const (
+	// diskEntrySize is the size of an encoded diskEntry: the blob ID followed
+	// by the pack index, offset, length and uncompressed length of the blob.
+	// All numbers are encoded big endian, so that the encoded entries sort
+	// like the entries themselves.
+	diskEntrySize = len(restic.ID{}) + 4*4
+
+	// diskFanoutBits is the number of bits of the blob ID used for the
+	// fanout table.
+	diskFanoutBits = 16
+
+	// diskReadEntries is the number of entries up to which a range of the
+	// table is read at once instead of continuing the binary search.
+	diskReadEntries = 64
+)
+
+type diskEntry struct {
+	id                 restic.ID
+	packIndex          uint32 // Position in the packs field of the diskIndex.
+	offset             uint32
+	length             uint32
+	uncompressedLength uint32
+}
+
+func (e *diskEntry) encode(buf []byte) {
+	copy(buf, e.id[:])
+	n := len(e.id)
+	binary.BigEndian.PutUint32(buf[n:], e.packIndex)
+	binary.BigEndian.PutUint32(buf[n+4:], e.offset)
+	binary.BigEndian.PutUint32(buf[n+8:], e.length)
+	binary.BigEndian.PutUint32(buf[n+12:], e.uncompressedLength)
+}
+
+func (e *diskEntry) decode(buf []byte) {
+	copy(e.id[:], buf)
+	n := len(e.id)
+	e.packIndex = binary.BigEndian.Uint32(buf[n:])
+	e.offset = binary.BigEndian.Uint32(buf[n+4:])
+	e.length = binary.BigEndian.Uint32(buf[n+8:])
+	e.uncompressedLength = binary.BigEndian.Uint32(buf[n+12:])
+}
+
+// less returns true if e sorts before e2, all fields are compared so that
+// exact duplicates end up next to each other.
+func (e *diskEntry) less(e2 *diskEntry) bool {
+	if c := bytes.Compare(e.id[:], e2.id[:]); c != 0 {
+		return c < 0
+	}
+	if e.packIndex != e2.packIndex {
+		return e.packIndex < e2.packIndex
+	}
+	if e.offset != e2.offset {
+		return e.offset < e2.offset
+	}
+	if e.length != e2.length {
+		return e.length < e2.length
+	}
+	return e.uncompressedLength < e2.uncompressedLength
+}
+
+func fanoutBucket(id restic.ID) int {
+	return int(id[0])<<8 | int(id[1])
+}
+
+// diskTable is a file containing sorted entries of a single blob type.
+type diskTable struct {
+	f *os.File
+	n uint32
+	// fanout[i] is the number of entries whose ID starts with a value lower
+	// than i, hence the entries of bucket i are in [fanout[i], fanout[i+1]).
+	fanout []uint32
+}
+
+// writeDiskTable writes the entries returned by next, which must be sorted, to
+// a new temporary file. Duplicate entries are only written once.
+func writeDiskTable(next func() (diskEntry, bool, error)) (*diskTable, error) {
+	f, err := fs.TempFile("", "restic-index-")
+	if err != nil {
+		return nil, errors.Wrap(err, "TempFile")
+	}
+
+	t := &diskTable{f: f, fanout: make([]uint32, 1<<diskFanoutBits+1)}
+	wr := bufio.NewWriter(f)
+	buf := make([]byte, diskEntrySize)
+
+	var last diskEntry
+	for {
+		e, ok, err := next()
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if t.n > 0 && e == last {
+			continue
+		}
+
+		e.encode(buf)
+		if _, err := wr.Write(buf); err != nil {
+			_ = f.Close()
+			return nil, errors.Wrap(err, "Write")
+		}
+		t.fanout[fanoutBucket(e.id)+1]++
+		t.n++
+		last = e
+	}
+
+	if err := wr.Flush(); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "Flush")
+	}
+
+	for i := 1; i < len(t.fanout); i++ {
+		t.fanout[i] += t.fanout[i-1]
+	}
+	return t, nil
+}
+
+func (t *diskTable) read(pos uint32, buf []byte) {
+	_, err := t.f.ReadAt(buf, int64(pos)*int64(diskEntrySize))
+	if err != nil {
+		// the file is local and was written by us, the entries cannot be
+		// treated as missing as this would lead to wrong decisions
+		panic(fmt.Sprintf("unable to read the index from %v: %v", t.f.Name(), err))
+	}
+}
+
+// foreachWithID calls fn for all entries with the given id.
+func (t *diskTable) foreachWithID(id restic.ID, fn func(*diskEntry)) {
+	b := fanoutBucket(id)
+	lo, end := t.fanout[b], t.fanout[b+1]
+
+	// find the first entry which is not lower than id
+	hi := end
+	buf := make([]byte, diskReadEntries*diskEntrySize)
+	for hi-lo > diskReadEntries {
+		mid := lo + (hi-lo)/2
+		t.read(mid, buf[:len(id)])
+		if bytes.Compare(buf[:len(id)], id[:]) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	var e diskEntry
+	for lo < end {
+		n := end - lo
+		if n > diskReadEntries {
+			n = diskReadEntries
+		}
+		t.read(lo, buf[:n*uint32(diskEntrySize)])
+
+		for i := uint32(0); i < n; i++ {
+			e.decode(buf[i*uint32(diskEntrySize):])
+			switch c := bytes.Compare(e.id[:], id[:]); {
+			case c > 0:
+				return
+			case c == 0:
+				fn(&e)
+			}
+		}
+		lo += n
+	}
+}
+
+// reader returns a function which returns the entries of the table in order.
+func (t *diskTable) reader() func() (diskEntry, bool, error) {
+	rd := bufio.NewReader(io.NewSectionReader(t.f, 0, int64(t.n)*int64(diskEntrySize)))
+	buf := make([]byte, diskEntrySize)
+
+	return func() (diskEntry, bool, error) {
+		var e diskEntry
+		_, err := io.ReadFull(rd, buf)
+		if err == io.EOF {
+			return e, false, nil
+		}
+		if err != nil {
+			return e, false, errors.Wrap(err, "ReadFull")
+		}
+		e.decode(buf)
+		return e, true, nil
+	}
+}
+
+// diskIndex holds the tables of entries moved out of the in-memory index and
+// the pack IDs referenced by them.
+type diskIndex struct {
+	packs     restic.IDs
+	packIndex map[restic.ID]uint32
+	tables    [restic.NumBlobTypes][]*diskTable
+	ids       restic.IDs
+}
+
+func newDiskIndex() *diskIndex {
+	return &diskIndex{packIndex: make(map[restic.ID]uint32)}
+}
+
+func (d *diskIndex) addToPacks(id restic.ID) uint32 {
+	if i, ok := d.packIndex[id]; ok {
+		return i
+	}
+	d.packs = append(d.packs, id)
+	i := uint32(len(d.packs) - 1)
+	d.packIndex[id] = i
+	return i
+}
+
+// store moves all entries of the final index idx to new tables.
+func (d *diskIndex) store(idx *Index) error {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	if !idx.final {
+		return errors.New("index to store on disk is not final")
+	}
+
+	// translate the pack indexes of idx to the ones of the diskIndex
+	packIndex := make([]uint32, len(idx.packs))
+	for i, id := range idx.packs {
+		packIndex[i] = d.addToPacks(id)
+	}
+
+	for typ := range idx.byType {
+		m := &idx.byType[typ]
+		if m.len() == 0 {
+			continue
+		}
+
+		entries := make([]diskEntry, 0, m.len())
+		m.foreach(func(e *indexEntry) bool {
+			entries = append(entries, diskEntry{
+				id:                 e.id,
+				packIndex:          packIndex[e.packIndex],
+				offset:             e.offset,
+				length:             e.length,
+				uncompressedLength: e.uncompressedLength,
+			})
+			return true
+		})
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].less(&entries[j])
+		})
+
+		t, err := writeDiskTable(func() (diskEntry, bool, error) {
+			if len(entries) == 0 {
+				return diskEntry{}, false, nil
+			}
+			e := entries[0]
+			entries = entries[1:]
+			return e, true, nil
+		})
+		if err != nil {
+			return err
+		}
+		d.tables[typ] = append(d.tables[typ], t)
+
+		if len(d.tables[typ]) > diskIndexMaxTables {
+			err = d.compact(restic.BlobType(typ))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	d.ids = append(d.ids, idx.ids...)
+	return nil
+}
+
+// compact merges all tables for the blob type into a single one.
+func (d *diskIndex) compact(typ restic.BlobType) error {
+	tables := d.tables[typ]
+	debug.Log("merging %d tables for %v", len(tables), typ)
+
+	type head struct {
+		next func() (diskEntry, bool, error)
+		e    diskEntry
+	}
+	var heads []*head
+	for _, t := range tables {
+		h := &head{next: t.reader()}
+		e, ok, err := h.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.e = e
+			heads = append(heads, h)
+		}
+	}
+
+	// the number of tables is small, so searching for the lowest entry is
+	// cheaper than maintaining a heap
+	merged, err := writeDiskTable(func() (diskEntry, bool, error) {
+		if len(heads) == 0 {
+			return diskEntry{}, false, nil
+		}
+		min := 0
+		for i := 1; i < len(heads); i++ {
+			if heads[i].e.less(&heads[min].e) {
+				min = i
+			}
+		}
+
+		h := heads[min]
+		e := h.e
+		next, ok, err := h.next()
+		if err != nil {
+			return e, false, err
+		}
+		if ok {
+			h.e = next
+		} else {
+			heads = append(heads[:min], heads[min+1:]...)
+		}
+		return e, true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		_ = t.f.Close()
+	}
+	d.tables[typ] = []*diskTable{merged}
+	return nil
+}
+
+// compactAll merges the tables of all blob types, such that each blob type
+// has at most one table and the index does not contain duplicates.
+func (d *diskIndex) compactAll() error {
+	for typ := range d.tables {
+		if len(d.tables[typ]) > 1 {
+			if err := d.compact(restic.BlobType(typ)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// len returns the number of entries, which may include duplicates contained
+// in different tables.
+func (d *diskIndex) len() uint {
+	var n uint
+	for typ := range d.tables {
+		for _, t := range d.tables[typ] {
+			n += uint(t.n)
+		}
+	}
+	return n
+}
+
+func (d *diskIndex) toPackedBlob(e *diskEntry, t restic.BlobType) restic.PackedBlob {
+	return restic.PackedBlob{
+		Blob: restic.Blob{
+			BlobHandle: restic.BlobHandle{
+				ID:   e.id,
+				Type: t},
+			Length:             uint(e.length),
+			Offset:             uint(e.offset),
+			UncompressedLength: uint(e.uncompressedLength),
+		},
+		PackID: d.packs[e.packIndex],
+	}
+}
+
+// Lookup adds all entries for the blob to pbs and returns the result.
+func (d *diskIndex) Lookup(bh restic.BlobHandle, pbs []restic.PackedBlob) []restic.PackedBlob {
+	for _, t := range d.tables[bh.Type] {
+		t.foreachWithID(bh.ID, func(e *diskEntry) {
+			pbs = append(pbs, d.toPackedBlob(e, bh.Type))
+		})
+	}
+	return pbs
+}
+
+// get returns the first entry for the blob.
+func (d *diskIndex) get(bh restic.BlobHandle) (entry diskEntry, found bool) {
+	for _, t := range d.tables[bh.Type] {
+		t.foreachWithID(bh.ID, func(e *diskEntry) {
+			if !found {
+				entry, found = *e, true
+			}
+		})
+		if found {
+			break
+		}
+	}
+	return entry, found
+}
+
+// Has returns true iff the blob is contained in the index.
+func (d *diskIndex) Has(bh restic.BlobHandle) bool {
+	_, found := d.get(bh)
+	return found
+}
+
+// LookupSize returns the length of the plaintext content of the blob.
+func (d *diskIndex) LookupSize(bh restic.BlobHandle) (plaintextLength uint, found bool) {
+	e, found := d.get(bh)
+	if !found {
+		return 0, false
+	}
+	if e.uncompressedLength != 0 {
+		return uint(e.uncompressedLength), true
+	}
+	return uint(crypto.PlaintextLength(int(e.length))), true
+}
+
+// Each passes all blobs known to the index to the callback fn.
+func (d *diskIndex) Each(ctx context.Context, fn func(restic.PackedBlob)) {
+	for typ := range d.tables {
+		for _, t := range d.tables[typ] {
+			next := t.reader()
+			for ctx.Err() == nil {
+				e, ok, err := next()
+				if err != nil {
+					// see diskTable.read
+					panic(fmt.Sprintf("unable to read the index from %v: %v", t.f.Name(), err))
+				}
+				if !ok {
+					break
+				}
+				fn(d.toPackedBlob(&e, restic.BlobType(typ)))
+			}
+		}
+	}
+}
+
+// Packs returns all packs referenced by the index.
+func (d *diskIndex) Packs() restic.IDSet {
+	return restic.NewIDSet(d.packs...)
+}
+
+// EachByPack returns a channel that yields all blobs known to the index
+// grouped by packID but ignoring blobs with a packID in packBlacklist. To
+// keep the memory overhead bounded, the packs are grouped in several passes
+// over the index. When the context is cancelled, the background goroutine
+// terminates.
+func (d *diskIndex) EachByPack(ctx context.Context, packBlacklist restic.IDSet) <-chan EachByPackResult {
+	ch := make(chan EachByPackResult)
+
+	go func() {
+		defer close(ch)
+
+		for i := uint32(0); i < 16; i++ {
+			byPack := make(map[uint32][]restic.Blob)
+			d.Each(ctx, func(pb restic.PackedBlob) {
+				packIndex := d.packIndex[pb.PackID]
+				if packIndex&0xf == i && !packBlacklist.Has(pb.PackID) {
+					byPack[packIndex] = append(byPack[packIndex], pb.Blob)
+				}
+			})
+
+			for packIndex, blobs := range byPack {
+				// allow GC once entry is no longer necessary
+				delete(byPack, packIndex)
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- EachByPackResult{PackID: d.packs[packIndex], Blobs: blobs}:
+				}
+			}
+		}
+	}()
+
+	return ch
+}
@@ -0,0 +1,236 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func randomTestID(rng *rand.Rand) restic.ID {
+	var id restic.ID
+	rng.Read(id[:])
+	return id
+}
+
+// createDiskTestIndexes returns final indexes with random blobs. Some IDs
+// share the first two bytes, so that the fanout buckets are searched, and some
+// entries are contained in several indexes.
+func createDiskTestIndexes(t testing.TB, rng *rand.Rand, num int) []*Index {
+	var indexes []*Index
+	var last restic.PackedBlob
+
+	for i := 0; i < num; i++ {
+		idx := NewIndex()
+		for p := 0; p < 10; p++ {
+			var blobs []restic.Blob
+			for b := 0; b < 1+rng.Intn(20); b++ {
+				id := randomTestID(rng)
+				if rng.Intn(2) == 0 {
+					id[0], id[1] = 0, 0
+				}
+				blobs = append(blobs, restic.Blob{
+					BlobHandle:         restic.BlobHandle{ID: id, Type: restic.BlobType(1 + rng.Intn(2))},
+					Offset:             uint(rng.Intn(1 << 20)),
+					Length:             uint(1 + rng.Intn(1<<20)),
+					UncompressedLength: uint(rng.Intn(2) * rng.Intn(1<<20)),
+				})
+			}
+			if i > 0 && p == 0 {
+				// an exact duplicate and the same blob in another pack
+				idx.StorePack(last.PackID, []restic.Blob{last.Blob})
+				blobs = append(blobs, last.Blob)
+			}
+
+			packID := randomTestID(rng)
+			idx.StorePack(packID, blobs)
+			last = restic.PackedBlob{PackID: packID, Blob: blobs[0]}
+		}
+
+		idx.Finalize()
+		rtest.OK(t, idx.SetID(randomTestID(rng)))
+		indexes = append(indexes, idx)
+	}
+	return indexes
+}
+
+func sortPackedBlobs(pbs []restic.PackedBlob) []restic.PackedBlob {
+	sort.Slice(pbs, func(i, j int) bool {
+		if c := bytes.Compare(pbs[i].ID[:], pbs[j].ID[:]); c != 0 {
+			return c < 0
+		}
+		if pbs[i].Type != pbs[j].Type {
+			return pbs[i].Type < pbs[j].Type
+		}
+		if c := bytes.Compare(pbs[i].PackID[:], pbs[j].PackID[:]); c != 0 {
+			return c < 0
+		}
+		return pbs[i].Offset < pbs[j].Offset
+	})
+	return pbs
+}
+
+// uniquePackedBlobs removes duplicates from the sorted list pbs.
+func uniquePackedBlobs(pbs []restic.PackedBlob) []restic.PackedBlob {
+	var unique []restic.PackedBlob
+	for i, pb := range pbs {
+		if i == 0 || pb != pbs[i-1] {
+			unique = append(unique, pb)
+		}
+	}
+	return unique
+}
+
+func allBlobs(mi *MasterIndex) []restic.PackedBlob {
+	var pbs []restic.PackedBlob
+	mi.Each(context.TODO(), func(pb restic.PackedBlob) {
+		pbs = append(pbs, pb)
+	})
+	return sortPackedBlobs(pbs)
+}
+
+func testSetDiskIndexLimits(flushEntries uint, maxTables int) func() {
+	oldFlush, oldMax := diskIndexFlushEntries, diskIndexMaxTables
+	diskIndexFlushEntries, diskIndexMaxTables = flushEntries, maxTables
+	return func() {
+		diskIndexFlushEntries, diskIndexMaxTables = oldFlush, oldMax
+	}
+}
+
+func TestDiskIndex(t *testing.T) {
+	defer testSetDiskIndexLimits(150, 2)()
+
+	rng := rand.New(rand.NewSource(42))
+	indexes := createDiskTestIndexes(t, rng, 20)
+
+	mem := NewMasterIndex()
+	disk := NewMasterIndex()
+	disk.UseDiskIndex()
+
+	// compare the results for all blobs, unknown blobs and the metadata
+	compare := func(expectDuplicates bool) {
+		for _, pb := range allBlobs(mem) {
+			bh := pb.BlobHandle
+			rtest.Assert(t, disk.Has(bh), "blob %v not found", bh)
+
+			pbs := sortPackedBlobs(disk.Lookup(bh))
+			if expectDuplicates {
+				pbs = uniquePackedBlobs(pbs)
+			}
+			rtest.Equals(t, sortPackedBlobs(mem.Lookup(bh)), pbs)
+
+			size, found := mem.LookupSize(bh)
+			diskSize, diskFound := disk.LookupSize(bh)
+			rtest.Equals(t, found, diskFound)
+			rtest.Equals(t, size, diskSize)
+		}
+
+		for i := 0; i < 100; i++ {
+			bh := restic.BlobHandle{ID: randomTestID(rng), Type: restic.DataBlob}
+			if i%2 == 0 {
+				bh.ID[0], bh.ID[1] = 0, 0
+			}
+			rtest.Assert(t, !disk.Has(bh), "unknown blob %v found", bh)
+			rtest.Assert(t, disk.Lookup(bh) == nil, "unknown blob %v found", bh)
+		}
+
+		if !expectDuplicates {
+			rtest.Equals(t, allBlobs(mem), allBlobs(disk))
+		}
+		rtest.Equals(t, mem.IDs(), disk.IDs())
+		rtest.Equals(t, mem.Packs(nil), disk.Packs(nil))
+	}
+
+	for _, idx := range indexes {
+		mem.Insert(idx)
+		disk.Insert(idx)
+		rtest.OK(t, disk.MergeFinalIndexes())
+	}
+	rtest.OK(t, mem.MergeFinalIndexes())
+	rtest.OK(t, disk.MergeFinalIndexes())
+
+	rtest.Assert(t, disk.disk.len() > 0, "no entries were moved to disk")
+	// before the tables are merged, duplicates may be contained in several
+	// tables
+	compare(true)
+
+	rtest.OK(t, disk.CompactDiskIndex())
+	rtest.Equals(t, uint(0), disk.idx[0].len())
+	for typ := range disk.disk.tables {
+		rtest.Assert(t, len(disk.disk.tables[typ]) <= 1, "tables for %v were not merged", restic.BlobType(typ))
+	}
+	compare(false)
+
+	// new blobs are still added to the in-memory index
+	bh := restic.BlobHandle{ID: randomTestID(rng), Type: restic.TreeBlob}
+	rtest.Assert(t, disk.AddPending(bh), "unknown blob was not added")
+	disk.StorePack(randomTestID(rng), []restic.Blob{{BlobHandle: bh, Length: 10}})
+	rtest.Equals(t, 1, len(disk.Lookup(bh)))
+	rtest.Assert(t, !disk.AddPending(allBlobs(mem)[0].BlobHandle), "known blob was added")
+}
+
+type indexSaver struct {
+	m       sync.Mutex
+	indexes []*Index
+}
+
+func (s *indexSaver) Connections() uint {
+	return 2
+}
+
+func (s *indexSaver) SaveUnpacked(_ context.Context, _ restic.FileType, buf []byte) (restic.ID, error) {
+	id := restic.Hash(buf)
+	idx, _, err := DecodeIndex(buf, id)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.indexes = append(s.indexes, idx)
+	return id, nil
+}
+
+func TestDiskIndexSave(t *testing.T) {
+	defer testSetDiskIndexLimits(100, 2)()
+
+	rng := rand.New(rand.NewSource(23))
+	indexes := createDiskTestIndexes(t, rng, 10)
+
+	mem := NewMasterIndex()
+	disk := NewMasterIndex()
+	disk.UseDiskIndex()
+	for _, idx := range indexes {
+		mem.Insert(idx)
+		disk.Insert(idx)
+		rtest.OK(t, disk.MergeFinalIndexes())
+	}
+	rtest.OK(t, mem.MergeFinalIndexes())
+	rtest.OK(t, disk.MergeFinalIndexes())
+	rtest.OK(t, disk.CompactDiskIndex())
+
+	blacklist := restic.NewIDSet(indexes[3].packs[2], indexes[7].packs[5])
+
+	memSaver := &indexSaver{}
+	memObsolete, err := mem.Save(context.TODO(), memSaver, blacklist, nil, nil)
+	rtest.OK(t, err)
+
+	diskSaver := &indexSaver{}
+	diskObsolete, err := disk.Save(context.TODO(), diskSaver, blacklist, nil, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, memObsolete, diskObsolete)
+
+	saved := func(s *indexSaver) []restic.PackedBlob {
+		mi := NewMasterIndex()
+		for _, idx := range s.indexes {
+			mi.Insert(idx)
+		}
+		return allBlobs(mi)
+	}
+	rtest.Equals(t, saved(memSaver), saved(diskSaver))
+}
@@ -79,6 +79,18 @@ func (idx *Index) store(packIndex int, blob restic.Blob) {
 	m.add(blob.ID, packIndex, uint32(blob.Offset), uint32(blob.Length), uint32(blob.UncompressedLength))
 }
 
+// len returns the number of entries in the index.
+func (idx *Index) len() uint {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	var n uint
+	for typ := range idx.byType {
+		n += idx.byType[typ].len()
+	}
+	return n
+}
+
 // Final returns true iff the index is already written to the repository, it is
 // finalized.
 func (idx *Index) Final() bool {
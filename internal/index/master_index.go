@@ -19,6 +19,10 @@ type MasterIndex struct {
 	pendingBlobs restic.BlobSet
 	idxMutex     sync.RWMutex
 	compress     bool
+
+	// disk stores the entries of final indexes on disk, if enabled by
+	// UseDiskIndex.
+	disk *diskIndex
 }
 
 // NewMasterIndex creates a new master index.
@@ -35,6 +39,18 @@ func (mi *MasterIndex) MarkCompressed() {
 	mi.compress = true
 }
 
+// UseDiskIndex enables storing the entries of final indexes in temporary
+// files instead of memory, see diskIndex. This reduces the memory usage at the
+// cost of slower lookups.
+func (mi *MasterIndex) UseDiskIndex() {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+
+	if mi.disk == nil {
+		mi.disk = newDiskIndex()
+	}
+}
+
 // Lookup queries all known Indexes for the ID and returns all matches.
 func (mi *MasterIndex) Lookup(bh restic.BlobHandle) (pbs []restic.PackedBlob) {
 	mi.idxMutex.RLock()
@@ -43,6 +59,9 @@ func (mi *MasterIndex) Lookup(bh restic.BlobHandle) (pbs []restic.PackedBlob) {
 	for _, idx := range mi.idx {
 		pbs = idx.Lookup(bh, pbs)
 	}
+	if mi.disk != nil {
+		pbs = mi.disk.Lookup(bh, pbs)
+	}
 
 	return pbs
 }
@@ -57,6 +76,9 @@ func (mi *MasterIndex) LookupSize(bh restic.BlobHandle) (uint, bool) {
 			return size, found
 		}
 	}
+	if mi.disk != nil {
+		return mi.disk.LookupSize(bh)
+	}
 
 	return 0, false
 }
@@ -80,6 +102,9 @@ func (mi *MasterIndex) AddPending(bh restic.BlobHandle) bool {
 			return false
 		}
 	}
+	if mi.disk != nil && mi.disk.Has(bh) {
+		return false
+	}
 
 	// really not known -> insert
 	mi.pendingBlobs.Insert(bh)
@@ -102,6 +127,9 @@ func (mi *MasterIndex) Has(bh restic.BlobHandle) bool {
 			return true
 		}
 	}
+	if mi.disk != nil {
+		return mi.disk.Has(bh)
+	}
 
 	return false
 }
@@ -125,6 +153,11 @@ func (mi *MasterIndex) IDs() restic.IDSet {
 			ids.Insert(id)
 		}
 	}
+	if mi.disk != nil {
+		for _, id := range mi.disk.ids {
+			ids.Insert(id)
+		}
+	}
 	return ids
 }
 
@@ -143,6 +176,9 @@ func (mi *MasterIndex) Packs(packBlacklist restic.IDSet) restic.IDSet {
 		}
 		packs.Merge(idxPacks)
 	}
+	if mi.disk != nil {
+		packs.Merge(mi.disk.Packs().Sub(packBlacklist))
+	}
 
 	return packs
 }
@@ -231,6 +267,9 @@ func (mi *MasterIndex) Each(ctx context.Context, fn func(restic.PackedBlob)) {
 	for _, idx := range mi.idx {
 		idx.Each(ctx, fn)
 	}
+	if mi.disk != nil {
+		mi.disk.Each(ctx, fn)
+	}
 }
 
 // MergeFinalIndexes merges all final indexes together.
@@ -262,9 +301,50 @@ func (mi *MasterIndex) MergeFinalIndexes() error {
 	}
 	mi.idx = newIdx
 
+	// move the entries of the merged index to disk once there are enough of
+	// them, such that the memory usage stays bounded
+	if mi.disk != nil && mi.idx[0].len() >= diskIndexFlushEntries {
+		return mi.flushToDisk()
+	}
+
 	return nil
 }
 
+// flushToDisk moves the entries of the first, merged final index to the disk
+// index. The caller must hold the write lock.
+func (mi *MasterIndex) flushToDisk() error {
+	debug.Log("moving %d entries to the disk index", mi.idx[0].len())
+	err := mi.disk.store(mi.idx[0])
+	if err != nil {
+		return fmt.Errorf("unable to store the index on disk: %w", err)
+	}
+
+	idx := NewIndex()
+	idx.Finalize()
+	mi.idx[0] = idx
+	return nil
+}
+
+// CompactDiskIndex moves all entries of the merged final index to the disk
+// index and merges its tables, which removes duplicate entries and makes
+// lookups faster. It should be called after all index files are loaded. If
+// the disk index is not enabled, nothing is done.
+func (mi *MasterIndex) CompactDiskIndex() error {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+
+	if mi.disk == nil {
+		return nil
+	}
+
+	if mi.idx[0].len() > 0 {
+		if err := mi.flushToDisk(); err != nil {
+			return err
+		}
+	}
+	return mi.disk.compactAll()
+}
+
 // Save saves all known indexes to index files, leaving out any
 // packs whose ID is contained in packBlacklist from finalized indexes.
 // The new index contains the IDs of all known indexes in the "supersedes"
@@ -289,6 +369,41 @@ func (mi *MasterIndex) Save(ctx context.Context, repo restic.SaverUnpacked, pack
 
 	wg.Go(func() error {
 		defer close(ch)
+
+		addPacks := func(packs <-chan EachByPackResult) error {
+			for pbs := range packs {
+				newIndex.StorePack(pbs.PackID, pbs.Blobs)
+				p.Add(1)
+				if IndexFull(newIndex, mi.compress) {
+					select {
+					case ch <- newIndex:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					newIndex = NewIndex()
+				}
+			}
+			return nil
+		}
+
+		if mi.disk != nil {
+			// the entries on disk are final, make sure that they do not
+			// contain duplicates
+			if err := mi.disk.compactAll(); err != nil {
+				return err
+			}
+
+			debug.Log("adding disk index ids %v to supersedes field", mi.disk.ids)
+			if err := newIndex.AddToSupersedes(mi.disk.ids...); err != nil {
+				return err
+			}
+			obsolete.Merge(restic.NewIDSet(mi.disk.ids...))
+
+			if err := addPacks(mi.disk.EachByPack(ctx, packBlacklist)); err != nil {
+				return err
+			}
+		}
+
 		for i, idx := range mi.idx {
 			if idx.Final() {
 				ids, err := idx.IDs()
@@ -310,17 +425,8 @@ func (mi *MasterIndex) Save(ctx context.Context, repo restic.SaverUnpacked, pack
 
 			debug.Log("adding index %d", i)
 
-			for pbs := range idx.EachByPack(ctx, packBlacklist) {
-				newIndex.StorePack(pbs.PackID, pbs.Blobs)
-				p.Add(1)
-				if IndexFull(newIndex, mi.compress) {
-					select {
-					case ch <- newIndex:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					newIndex = NewIndex()
-				}
+			if err := addPacks(idx.EachByPack(ctx, packBlacklist)); err != nil {
+				return err
 			}
 		}
 
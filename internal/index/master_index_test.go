@@ -216,6 +216,13 @@ func createRandomMasterIndex(t testing.TB, rng *rand.Rand, num, size int) (*inde
 	return mIdx, lookupBh
 }
 
+func createRandomDiskMasterIndex(t testing.TB, rng *rand.Rand, num, size int) (*index.MasterIndex, restic.BlobHandle) {
+	mIdx, lookupBh := createRandomMasterIndex(t, rng, num, size)
+	mIdx.UseDiskIndex()
+	rtest.OK(t, mIdx.CompactDiskIndex())
+	return mIdx, lookupBh
+}
+
 func BenchmarkMasterIndexAlloc(b *testing.B) {
 	rng := rand.New(rand.NewSource(0))
 	b.ReportAllocs()
@@ -235,6 +242,16 @@ func BenchmarkMasterIndexLookupSingleIndex(b *testing.B) {
 	}
 }
 
+func BenchmarkMasterIndexLookupSingleIndexDisk(b *testing.B) {
+	mIdx, lookupBh := createRandomDiskMasterIndex(b, rand.New(rand.NewSource(0)), 1, 200000)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mIdx.Lookup(lookupBh)
+	}
+}
+
 func BenchmarkMasterIndexLookupMultipleIndex(b *testing.B) {
 	mIdx, lookupBh := createRandomMasterIndex(b, rand.New(rand.NewSource(0)), 100, 10000)
 
@@ -257,6 +274,17 @@ func BenchmarkMasterIndexLookupSingleIndexUnknown(b *testing.B) {
 	}
 }
 
+func BenchmarkMasterIndexLookupSingleIndexUnknownDisk(b *testing.B) {
+	lookupBh := restic.NewRandomBlobHandle()
+	mIdx, _ := createRandomDiskMasterIndex(b, rand.New(rand.NewSource(0)), 1, 200000)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mIdx.Lookup(lookupBh)
+	}
+}
+
 func BenchmarkMasterIndexLookupMultipleIndexUnknown(b *testing.B) {
 	lookupBh := restic.NewRandomBlobHandle()
 	mIdx, _ := createRandomMasterIndex(b, rand.New(rand.NewSource(0)), 100, 10000)
@@ -323,6 +351,20 @@ func BenchmarkMasterIndexEach(b *testing.B) {
 	}
 }
 
+func BenchmarkMasterIndexEachDisk(b *testing.B) {
+	rng := rand.New(rand.NewSource(0))
+	mIdx, _ := createRandomDiskMasterIndex(b, rand.New(rng), 5, 200000)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		entries := 0
+		mIdx.Each(context.TODO(), func(pb restic.PackedBlob) {
+			entries++
+		})
+	}
+}
+
 var (
 	snapshotTime = time.Unix(1470492820, 207401672)
 	depth        = 3
@@ -0,0 +1,47 @@
+// Package keyprovider implements sources for the secret which unlocks the keys
+// of a repository, as an alternative to entering a password.
+package keyprovider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Provider returns the secret which is used instead of a password to unlock a
+// key of the repository.
+type Provider interface {
+	// Secret returns the secret, it must not be empty.
+	Secret(ctx context.Context) (string, error)
+	// String returns a description of the provider without sensitive
+	// information.
+	String() string
+}
+
+type parser struct {
+	scheme string
+	parse  func(string) (Provider, error)
+}
+
+// parsers is the list of supported providers, selected by the scheme of the
+// provider specification.
+var parsers = []parser{
+	{"pkcs11", parsePKCS11},
+}
+
+// Parse returns the provider for the specification s, which starts with the
+// scheme of the provider followed by a colon, e.g. "pkcs11:token=foo".
+func Parse(s string) (Provider, error) {
+	for _, p := range parsers {
+		if strings.HasPrefix(s, p.scheme+":") {
+			return p.parse(s)
+		}
+	}
+
+	schemes := make([]string, 0, len(parsers))
+	for _, p := range parsers {
+		schemes = append(schemes, p.scheme)
+	}
+	return nil, errors.Errorf("invalid key provider %q, supported are: %v", s, strings.Join(schemes, ", "))
+}
@@ -0,0 +1,193 @@
+package keyprovider
+
+import (
+	"context"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/textfile"
+)
+
+// pkcs11Tool is the program used to access the PKCS#11 token, it is
+// pkcs11-tool from OpenSC.
+var pkcs11Tool = "pkcs11-tool"
+
+// pkcs11PINEnv is the environment variable used to pass the PIN to
+// pkcs11-tool, so that it does not show up in the process list.
+const pkcs11PINEnv = "RESTIC_PKCS11_PIN"
+
+// PKCS11 reads the secret from a data object stored on a PKCS#11 token, e.g. a
+// smartcard or an HSM.
+type PKCS11 struct {
+	// Module is the path of the PKCS#11 module (shared library) of the token.
+	Module string
+	// Token is the label of the token.
+	Token string
+	// Slot is the ID of the slot containing the token.
+	Slot string
+	// Object is the label of the data object.
+	Object string
+	// ID is the ID of the data object.
+	ID []byte
+	// PIN is the user PIN. If both PIN and PINSource are empty, the PIN is
+	// requested by pkcs11-tool.
+	PIN string
+	// PINSource is the path of a file to read the user PIN from.
+	PINSource string
+}
+
+// parsePKCS11 parses a PKCS#11 URI as described in RFC 7512, for example
+// "pkcs11:token=restic;object=repo?module-path=/usr/lib/opensc-pkcs11.so".
+// The path attributes token, slot-id, object and id select the data object,
+// the query attributes module-path, pin-value and pin-source configure how
+// the token is accessed.
+func parsePKCS11(s string) (Provider, error) {
+	s = strings.TrimPrefix(s, "pkcs11:")
+	path, query := s, ""
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		path, query = s[:i], s[i+1:]
+	}
+
+	p := &PKCS11{}
+	attrs := map[string]*string{
+		"token":       &p.Token,
+		"slot-id":     &p.Slot,
+		"object":      &p.Object,
+		"module-path": &p.Module,
+		"pin-value":   &p.PIN,
+		"pin-source":  &p.PINSource,
+	}
+
+	parse := func(attributes, sep string, allowed ...string) error {
+		if attributes == "" {
+			return nil
+		}
+		for _, attr := range strings.Split(attributes, sep) {
+			kv := strings.SplitN(attr, "=", 2)
+			if len(kv) != 2 {
+				return errors.Errorf("invalid PKCS#11 attribute %q", attr)
+			}
+			name := kv[0]
+			value, err := url.PathUnescape(kv[1])
+			if err != nil {
+				return errors.Errorf("invalid value for PKCS#11 attribute %q: %v", name, err)
+			}
+
+			known := false
+			for _, a := range allowed {
+				known = known || a == name
+			}
+			if !known {
+				return errors.Errorf("unsupported PKCS#11 attribute %q", name)
+			}
+
+			if name == "id" {
+				p.ID = []byte(value)
+				continue
+			}
+			*attrs[name] = value
+		}
+		return nil
+	}
+
+	err := parse(path, ";", "token", "slot-id", "object", "id")
+	if err != nil {
+		return nil, err
+	}
+	err = parse(query, "&", "module-path", "pin-value", "pin-source")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Module == "" {
+		return nil, errors.New("PKCS#11 key provider requires the module-path attribute")
+	}
+	if p.Object == "" && len(p.ID) == 0 {
+		return nil, errors.New("PKCS#11 key provider requires the object or id attribute")
+	}
+	if p.PIN != "" && p.PINSource != "" {
+		return nil, errors.New("PKCS#11 attributes pin-value and pin-source are mutually exclusive")
+	}
+	p.PINSource = strings.TrimPrefix(p.PINSource, "file:")
+
+	return p, nil
+}
+
+// args returns the arguments for pkcs11-tool to read the data object. If
+// withPIN is set, pkcs11-tool reads the PIN from the environment variable
+// pkcs11PINEnv.
+func (p *PKCS11) args(withPIN bool) []string {
+	args := []string{"--module", p.Module, "--read-object", "--type", "data"}
+	if p.Token != "" {
+		args = append(args, "--token-label", p.Token)
+	}
+	if p.Slot != "" {
+		args = append(args, "--slot", p.Slot)
+	}
+	if p.Object != "" {
+		args = append(args, "--label", p.Object)
+	}
+	if len(p.ID) > 0 {
+		args = append(args, "--id", hex.EncodeToString(p.ID))
+	}
+
+	args = append(args, "--login")
+	if withPIN {
+		args = append(args, "--pin", "env:"+pkcs11PINEnv)
+	}
+	return args
+}
+
+// Secret reads the data object from the token.
+func (p *PKCS11) Secret(ctx context.Context) (string, error) {
+	pin := p.PIN
+	if p.PINSource != "" {
+		buf, err := textfile.Read(p.PINSource)
+		if err != nil {
+			return "", errors.Wrap(err, "reading PIN failed")
+		}
+		pin = strings.TrimSpace(string(buf))
+	}
+
+	debug.Log("reading secret from %v", p)
+	cmd := exec.CommandContext(ctx, pkcs11Tool, p.args(pin != "")...)
+	if pin != "" {
+		cmd.Env = append(os.Environ(), pkcs11PINEnv+"="+pin)
+	}
+	// pkcs11-tool asks for the PIN on the terminal when none is given
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", errors.Errorf("reading the secret from the PKCS#11 token failed: %v", err)
+	}
+
+	// the data object is used as is, it may contain arbitrary bytes
+	if len(output) == 0 {
+		return "", errors.New("the data object on the PKCS#11 token is empty")
+	}
+	return string(output), nil
+}
+
+// String returns a description of the token and the object, without the PIN.
+func (p *PKCS11) String() string {
+	var attrs []string
+	if p.Token != "" {
+		attrs = append(attrs, "token="+url.PathEscape(p.Token))
+	}
+	if p.Slot != "" {
+		attrs = append(attrs, "slot-id="+url.PathEscape(p.Slot))
+	}
+	if p.Object != "" {
+		attrs = append(attrs, "object="+url.PathEscape(p.Object))
+	}
+	if len(p.ID) > 0 {
+		attrs = append(attrs, "id="+url.PathEscape(string(p.ID)))
+	}
+	return "pkcs11:" + strings.Join(attrs, ";") + "?module-path=" + p.Module
+}
@@ -0,0 +1,99 @@
+package keyprovider
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParsePKCS11(t *testing.T) {
+	var tests = []struct {
+		s    string
+		p    PKCS11
+		args []string
+	}{
+		{
+			s: "pkcs11:object=restic?module-path=/usr/lib/opensc-pkcs11.so",
+			p: PKCS11{Module: "/usr/lib/opensc-pkcs11.so", Object: "restic"},
+			args: []string{"--module", "/usr/lib/opensc-pkcs11.so", "--read-object", "--type", "data",
+				"--label", "restic", "--login"},
+		},
+		{
+			s: "pkcs11:token=My%20Token;slot-id=2;id=%01%a0?module-path=/lib/p11.so&pin-value=1234",
+			p: PKCS11{Module: "/lib/p11.so", Token: "My Token", Slot: "2", ID: []byte{0x01, 0xa0}, PIN: "1234"},
+			args: []string{"--module", "/lib/p11.so", "--read-object", "--type", "data",
+				"--token-label", "My Token", "--slot", "2", "--id", "01a0", "--login", "--pin", "env:RESTIC_PKCS11_PIN"},
+		},
+		{
+			s: "pkcs11:object=restic?module-path=/lib/p11.so&pin-source=file:/etc/pin",
+			p: PKCS11{Module: "/lib/p11.so", Object: "restic", PINSource: "/etc/pin"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			provider, err := Parse(test.s)
+			rtest.OK(t, err)
+			p, ok := provider.(*PKCS11)
+			rtest.Assert(t, ok, "wrong provider type %T", provider)
+			rtest.Equals(t, test.p, *p)
+			if test.args != nil {
+				rtest.Equals(t, test.args, p.args(p.PIN != ""))
+			}
+			rtest.Assert(t, !strings.Contains(p.String(), "1234"), "description %q contains the PIN", p.String())
+		})
+	}
+}
+
+func TestParsePKCS11Invalid(t *testing.T) {
+	for _, s := range []string{
+		"tpm:foo",
+		"pkcs11:object=restic",
+		"pkcs11:?module-path=/lib/p11.so",
+		"pkcs11:object=restic;type=data?module-path=/lib/p11.so",
+		"pkcs11:object?module-path=/lib/p11.so",
+		"pkcs11:object=restic?module-path=/lib/p11.so&pin-value=1&pin-source=/etc/pin",
+		"pkcs11:module-path=/lib/p11.so;object=restic",
+	} {
+		_, err := Parse(s)
+		rtest.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+func TestPKCS11Secret(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a shell script")
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	tool := filepath.Join(tempdir, "pkcs11-tool")
+	// the fake tool prints the PIN from the environment variable it was
+	// called with as the secret
+	rtest.OK(t, ioutil.WriteFile(tool, []byte("#!/bin/sh\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = --pin ]; then eval \"echo secret-\\$${2#env:}\"; fi\n  shift\ndone\n"), 0700))
+	pinFile := filepath.Join(tempdir, "pin")
+	rtest.OK(t, ioutil.WriteFile(pinFile, []byte("4321\n"), 0600))
+
+	defer func(old string) {
+		pkcs11Tool = old
+	}(pkcs11Tool)
+	pkcs11Tool = tool
+
+	p, err := Parse("pkcs11:object=restic?module-path=/lib/p11.so&pin-source=" + pinFile)
+	rtest.OK(t, err)
+	secret, err := p.Secret(context.TODO())
+	rtest.OK(t, err)
+	// the secret is not trimmed
+	rtest.Equals(t, "secret-4321\n", secret)
+
+	// without a PIN the fake tool prints nothing
+	p, err = Parse("pkcs11:object=restic?module-path=/lib/p11.so")
+	rtest.OK(t, err)
+	_, err = p.Secret(context.TODO())
+	rtest.Assert(t, err != nil, "expected error for an empty secret")
+}
@@ -22,3 +22,22 @@ type Migration interface {
 	// Descr returns a description what the migration does.
 	Desc() string
 }
+
+// Step is a single step of a StepMigration.
+type Step struct {
+	// Desc describes the change made by the step.
+	Desc string
+
+	// Apply applies the change to the repository.
+	Apply func(context.Context) error
+}
+
+// StepMigration is a migration which is applied in independent steps. The
+// repository is consistent and can be used after each step. If the migration
+// is interrupted, applying it again continues with the remaining steps.
+type StepMigration interface {
+	Migration
+
+	// Steps returns the steps which remain to be applied to a repo.
+	Steps(context.Context, restic.Repository) ([]Step, error)
+}
@@ -0,0 +1,130 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&UpgradeIndex{})
+}
+
+// UpgradeIndex rewrites all index files which still use the old index format,
+// one index file at a time.
+type UpgradeIndex struct{}
+
+func (*UpgradeIndex) Name() string {
+	return "upgrade_index"
+}
+
+func (*UpgradeIndex) Desc() string {
+	return "rewrite index files in the old format using the current format"
+}
+
+// oldIndexes returns the IDs of all index files in the old format.
+func (*UpgradeIndex) oldIndexes(ctx context.Context, repo restic.Repository) (restic.IDs, error) {
+	var ids restic.IDs
+	err := index.ForAllIndexes(ctx, repo, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
+		if err != nil {
+			return fmt.Errorf("index %v: %w", id.Str(), err)
+		}
+		if oldFormat {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(ids)
+	return ids, nil
+}
+
+// Check tests whether the migration can be applied.
+func (m *UpgradeIndex) Check(ctx context.Context, repo restic.Repository) (bool, string, error) {
+	ids, err := m.oldIndexes(ctx, repo)
+	if err != nil {
+		return false, "", err
+	}
+	if len(ids) == 0 {
+		return false, "all index files use the current format", nil
+	}
+	return true, "", nil
+}
+
+func (*UpgradeIndex) RepoCheck() bool {
+	return false
+}
+
+// Steps returns a step for each index file in the old format.
+func (m *UpgradeIndex) Steps(ctx context.Context, repo restic.Repository) ([]Step, error) {
+	ids, err := m.oldIndexes(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]Step, 0, len(ids))
+	for _, id := range ids {
+		id := id
+		steps = append(steps, Step{
+			Desc: fmt.Sprintf("rewrite index file %v", id.Str()),
+			Apply: func(ctx context.Context) error {
+				return m.rewrite(ctx, repo, id)
+			},
+		})
+	}
+	return steps, nil
+}
+
+// rewrite saves the contents of the index file id in the current format and
+// removes the file afterwards. If the migration is interrupted in between, both
+// files contain the same entries, which is harmless.
+func (*UpgradeIndex) rewrite(ctx context.Context, repo restic.Repository, id restic.ID) error {
+	buf, err := repo.LoadUnpacked(ctx, restic.IndexFile, id, nil)
+	if err != nil {
+		return fmt.Errorf("load index %v failed: %w", id.Str(), err)
+	}
+
+	idx, oldFormat, err := index.DecodeIndex(buf, id)
+	if err != nil {
+		return fmt.Errorf("decode index %v failed: %w", id.Str(), err)
+	}
+	if !oldFormat {
+		debug.Log("index %v already uses the current format", id)
+		return nil
+	}
+
+	newID, err := index.SaveIndex(ctx, repo, idx)
+	if err != nil {
+		return fmt.Errorf("save index failed: %w", err)
+	}
+	debug.Log("index %v rewritten as %v", id, newID)
+
+	err = repo.Backend().Remove(ctx, restic.Handle{Type: restic.IndexFile, Name: id.String()})
+	if err != nil {
+		return fmt.Errorf("remove index %v failed: %w", id.Str(), err)
+	}
+	return nil
+}
+
+// Apply rewrites all index files in the old format.
+func (m *UpgradeIndex) Apply(ctx context.Context, repo restic.Repository) error {
+	steps, err := m.Steps(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		err = step.Apply(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
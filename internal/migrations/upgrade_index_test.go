@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestUpgradeIndex(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	packID := restic.NewRandomID()
+	blobID := restic.NewRandomID()
+	oldIndex := fmt.Sprintf(`[{"id":"%v","blobs":[{"id":"%v","type":"data","offset":0,"length":42}]}]`, packID, blobID)
+	oldID, err := repo.SaveUnpacked(ctx, restic.IndexFile, []byte(oldIndex))
+	rtest.OK(t, err)
+
+	m := &UpgradeIndex{}
+	ok, _, err := m.Check(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "migration check returned false")
+
+	steps, err := m.Steps(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(steps))
+
+	rtest.OK(t, m.Apply(ctx, repo))
+
+	ok, _, err = m.Check(ctx, repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "migration can be applied a second time")
+
+	var ids restic.IDs
+	rtest.OK(t, index.ForAllIndexes(ctx, repo, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
+		rtest.OK(t, err)
+		rtest.Assert(t, !oldFormat, "index %v still uses the old format", id)
+		rtest.Assert(t, idx.Has(restic.BlobHandle{ID: blobID, Type: restic.DataBlob}), "blob missing from index %v", id)
+		ids = append(ids, id)
+		return nil
+	}))
+	rtest.Equals(t, 1, len(ids))
+	rtest.Assert(t, !ids[0].Equal(oldID), "old index file was not removed")
+
+	// an already rewritten index file is skipped
+	rtest.OK(t, m.rewrite(ctx, repo, ids[0]))
+}
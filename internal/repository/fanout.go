@@ -0,0 +1,382 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Fanout is a repository which saves all blobs and files to several
+// repositories at once, such that the data to back up only needs to be read
+// and chunked once. All repositories must use the same chunker parameters.
+// Everything else is read from the first repository, the primary.
+//
+// When saving data to one of the repositories fails, the repository is not
+// used any more, and only returned errors once saving to all repositories
+// failed. The errors for the individual repositories are returned by Results.
+type Fanout struct {
+	m       sync.Mutex
+	members []*fanoutMember
+}
+
+type fanoutMember struct {
+	repo *Repository
+	// ctx is cancelled when uploading packs to the repository failed
+	ctx context.Context
+	res FanoutResult
+}
+
+// FanoutResult describes what was saved to one of the repositories of a
+// Fanout.
+type FanoutResult struct {
+	// Err is the error which stopped saving data to the repository, or nil.
+	Err error
+	// DataBlobs and TreeBlobs are the numbers of new blobs.
+	DataBlobs, TreeBlobs uint
+	// DataAdded is the plaintext size of the new blobs, DataAddedPacked
+	// is the size they occupy in the repository.
+	DataAdded, DataAddedPacked uint64
+	// Unpacked are the IDs of the files saved with SaveUnpacked. Files are
+	// encrypted for each repository, so their IDs differ.
+	Unpacked restic.IDs
+}
+
+// NewFanout returns a new Fanout for the given repositories. The first one is
+// the primary repository.
+func NewFanout(repos ...*Repository) (*Fanout, error) {
+	if len(repos) == 0 {
+		return nil, errors.New("no repositories given")
+	}
+
+	f := &Fanout{}
+	for i, repo := range repos {
+		if !SameChunker(repo.Config(), repos[0].Config()) {
+			return nil, errors.Errorf("repository %d uses different chunker parameters than the first repository", i+1)
+		}
+		f.members = append(f.members, &fanoutMember{repo: repo, ctx: context.Background()})
+	}
+	return f, nil
+}
+
+// SameChunker returns true if both configs split files into the same chunks.
+// The files are only chunked once for all repositories, with different
+// parameters the blobs would not deduplicate with those chunked for a
+// repository on its own.
+func SameChunker(a, b restic.Config) bool {
+	aMin, aMax, aBits := a.ChunkerSizes()
+	bMin, bMax, bBits := b.ChunkerSizes()
+	return a.ChunkerPolynomial == b.ChunkerPolynomial &&
+		aMin == bMin && aMax == bMax && aBits == bBits
+}
+
+// Results returns the result for each repository, in the order they were
+// passed to NewFanout.
+func (f *Fanout) Results() []FanoutResult {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	results := make([]FanoutResult, 0, len(f.members))
+	for _, m := range f.members {
+		results = append(results, m.res)
+	}
+	return results
+}
+
+// failed records err for m, unless an error was already recorded.
+func (f *Fanout) failed(m *fanoutMember, err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if m.res.Err == nil {
+		m.res.Err = err
+	}
+}
+
+// active returns the repositories which can still be used.
+func (f *Fanout) active() []*fanoutMember {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	var members []*fanoutMember
+	for _, m := range f.members {
+		if m.res.Err == nil {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// lastError returns the error of the repositories once all of them failed,
+// and nil otherwise.
+func (f *Fanout) lastError() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	for _, m := range f.members {
+		if m.res.Err == nil {
+			return nil
+		}
+	}
+	return f.members[0].res.Err
+}
+
+func (f *Fanout) primary() *Repository {
+	return f.members[0].repo
+}
+
+// Backend returns the backend of the primary repository.
+func (f *Fanout) Backend() restic.Backend {
+	return f.primary().Backend()
+}
+
+// Connections returns the number of connections of the primary repository.
+func (f *Fanout) Connections() uint {
+	return f.primary().Connections()
+}
+
+// Key returns the key of the primary repository.
+func (f *Fanout) Key() *crypto.Key {
+	return f.primary().Key()
+}
+
+// Config returns the config of the primary repository.
+func (f *Fanout) Config() restic.Config {
+	return f.primary().Config()
+}
+
+// PackSize returns the pack size of the primary repository.
+func (f *Fanout) PackSize() uint {
+	return f.primary().PackSize()
+}
+
+// Index returns an index which only contains the blobs which are known to
+// all repositories still in use, lookups are answered by the primary index.
+func (f *Fanout) Index() restic.MasterIndex {
+	return fanoutIndex{MasterIndex: f.primary().Index(), f: f}
+}
+
+// LoadIndex loads the indexes of all repositories.
+func (f *Fanout) LoadIndex(ctx context.Context) error {
+	for _, m := range f.members {
+		if err := m.repo.LoadIndex(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetIndex is not supported for a Fanout.
+func (f *Fanout) SetIndex(restic.MasterIndex) error {
+	return errors.New("setting the index of a fanout repository is not supported")
+}
+
+// LookupBlobSize looks up the size of a blob in the primary repository.
+func (f *Fanout) LookupBlobSize(id restic.ID, tpe restic.BlobType) (uint, bool) {
+	return f.primary().LookupBlobSize(id, tpe)
+}
+
+// List lists the files of the primary repository.
+func (f *Fanout) List(ctx context.Context, t restic.FileType, fn func(restic.ID, int64) error) error {
+	return f.primary().List(ctx, t, fn)
+}
+
+// ListPack lists a pack of the primary repository.
+func (f *Fanout) ListPack(ctx context.Context, id restic.ID, size int64) ([]restic.Blob, uint32, error) {
+	return f.primary().ListPack(ctx, id, size)
+}
+
+// LoadBlob loads a blob from the primary repository.
+func (f *Fanout) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	return f.primary().LoadBlob(ctx, t, id, buf)
+}
+
+// LoadUnpacked loads a file from the primary repository.
+func (f *Fanout) LoadUnpacked(ctx context.Context, t restic.FileType, id restic.ID, buf []byte) ([]byte, error) {
+	return f.primary().LoadUnpacked(ctx, t, id, buf)
+}
+
+// SaveBlob saves the blob to all repositories. The blob is only reported as
+// known if all of them already contain it, the returned size is the sum of
+// the sizes in the individual repositories.
+func (f *Fanout) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte, id restic.ID, storeDuplicate bool) (restic.ID, bool, int, error) {
+	if id.IsNull() {
+		id = BlobID(buf)
+	}
+
+	allKnown := true
+	var total int
+	for _, m := range f.active() {
+		if ctx.Err() != nil {
+			return restic.ID{}, false, 0, ctx.Err()
+		}
+
+		_, known, size, err := m.repo.SaveBlob(m.ctx, t, buf, id, storeDuplicate)
+		if err != nil {
+			f.failed(m, err)
+			continue
+		}
+		if known && !storeDuplicate {
+			continue
+		}
+
+		allKnown = allKnown && known
+		total += size
+
+		f.m.Lock()
+		if t == restic.TreeBlob {
+			m.res.TreeBlobs++
+		} else {
+			m.res.DataBlobs++
+		}
+		m.res.DataAdded += uint64(len(buf))
+		m.res.DataAddedPacked += uint64(size)
+		f.m.Unlock()
+	}
+
+	if err := f.lastError(); err != nil {
+		return restic.ID{}, false, 0, err
+	}
+	return id, allKnown, total, nil
+}
+
+// StartPackUploader starts the pack uploaders of all repositories. When
+// uploading to one of them fails, it is not used any more; wg only receives
+// an error once uploading to all repositories failed.
+func (f *Fanout) StartPackUploader(ctx context.Context, wg *errgroup.Group) {
+	for _, m := range f.members {
+		m := m
+		// unlike the context of an errgroup, the context must not be
+		// cancelled when all uploads have completed, the index is saved
+		// afterwards
+		var innerWg errgroup.Group
+		innerCtx, cancel := context.WithCancel(ctx)
+		m.ctx = innerCtx
+		m.repo.StartPackUploader(innerCtx, &innerWg)
+
+		wg.Go(func() error {
+			err := innerWg.Wait()
+			if err == nil {
+				return nil
+			}
+			cancel()
+
+			// the upload error is the reason for all following errors
+			f.m.Lock()
+			if m.res.Err == nil || errors.Is(m.res.Err, context.Canceled) {
+				m.res.Err = err
+			}
+			f.m.Unlock()
+			return f.lastError()
+		})
+	}
+}
+
+// Flush saves the remaining packs and the index of all repositories.
+func (f *Fanout) Flush(ctx context.Context) error {
+	for _, m := range f.active() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err := m.repo.Flush(m.ctx)
+		if err != nil {
+			f.failed(m, err)
+		}
+	}
+	return f.lastError()
+}
+
+// SaveUnpacked saves the file to all repositories. It returns the ID of the
+// file in the first repository which is still in use, the IDs for all
+// repositories are recorded in the results. The parent of a snapshot is a
+// snapshot in the primary repository, it is removed from the snapshots saved to
+// the other repositories.
+func (f *Fanout) SaveUnpacked(ctx context.Context, t restic.FileType, buf []byte) (restic.ID, error) {
+	var other []byte
+	if t == restic.SnapshotFile {
+		var err error
+		other, err = withoutParent(buf)
+		if err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	var first restic.ID
+	for _, m := range f.active() {
+		data := buf
+		if other != nil && m != f.members[0] {
+			data = other
+		}
+
+		id, err := m.repo.SaveUnpacked(ctx, t, data)
+		if err != nil {
+			f.failed(m, err)
+			continue
+		}
+
+		f.m.Lock()
+		m.res.Unpacked = append(m.res.Unpacked, id)
+		f.m.Unlock()
+		if first.IsNull() {
+			first = id
+		}
+	}
+
+	if err := f.lastError(); err != nil {
+		return restic.ID{}, err
+	}
+	return first, nil
+}
+
+// withoutParent returns the snapshot in buf with the parent removed.
+func withoutParent(buf []byte) ([]byte, error) {
+	var sn restic.Snapshot
+	err := json.Unmarshal(buf, &sn)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+	if sn.Parent == nil {
+		return buf, nil
+	}
+
+	sn.Parent = nil
+	buf, err = json.Marshal(&sn)
+	if err != nil {
+		return nil, errors.Wrap(err, "Marshal")
+	}
+	return buf, nil
+}
+
+// fanoutIndex is the index returned by Fanout.Index.
+type fanoutIndex struct {
+	restic.MasterIndex
+	f *Fanout
+}
+
+// Has returns true if all repositories still in use contain the blob.
+func (idx fanoutIndex) Has(bh restic.BlobHandle) bool {
+	members := idx.f.active()
+	if len(members) == 0 {
+		return false
+	}
+	for _, m := range members {
+		if !m.repo.Index().Has(bh) {
+			return false
+		}
+	}
+	return true
+}
+
+// Save is not supported for a Fanout.
+func (idx fanoutIndex) Save(context.Context, restic.SaverUnpacked, restic.IDSet, restic.IDs, *progress.Counter) (restic.IDSet, error) {
+	return nil, errors.New("saving the index of a fanout repository is not supported")
+}
+
+var _ restic.Repository = &Fanout{}
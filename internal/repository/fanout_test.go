@@ -0,0 +1,185 @@
+package repository_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
+)
+
+// failingPackBackend fails to save pack files once fail is set.
+type failingPackBackend struct {
+	restic.Backend
+	fail bool
+}
+
+func (be *failingPackBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if be.fail && h.Type == restic.PackFile {
+		return errors.New("disk is full")
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func testFanoutRepos(t *testing.T, backends ...restic.Backend) []*repository.Repository {
+	var repos []*repository.Repository
+	for _, be := range backends {
+		repo, cleanup := repository.TestRepositoryWithBackend(t, be, 0)
+		t.Cleanup(cleanup)
+		repos = append(repos, repo.(*repository.Repository))
+	}
+	return repos
+}
+
+func saveFanoutBlobs(t *testing.T, f *repository.Fanout, bufs [][]byte) (restic.IDs, error) {
+	var wg errgroup.Group
+	f.StartPackUploader(context.TODO(), &wg)
+
+	var ids restic.IDs
+	for _, buf := range bufs {
+		id, known, _, err := f.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{}, false)
+		if err != nil {
+			return nil, err
+		}
+		rtest.Assert(t, !known, "new blob %v reported as known", id)
+		ids = append(ids, id)
+	}
+	if err := f.Flush(context.TODO()); err != nil {
+		return nil, err
+	}
+	return ids, wg.Wait()
+}
+
+func TestFanout(t *testing.T) {
+	repos := testFanoutRepos(t, mem.New(), mem.New())
+	f, err := repository.NewFanout(repos...)
+	rtest.OK(t, err)
+
+	var bufs [][]byte
+	for i := 0; i < 5; i++ {
+		bufs = append(bufs, rtest.Random(i, 100*1024))
+	}
+	ids, err := saveFanoutBlobs(t, f, bufs)
+	rtest.OK(t, err)
+
+	for _, repo := range repos {
+		for i, id := range ids {
+			buf, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+			rtest.OK(t, err)
+			rtest.Equals(t, bufs[i], buf)
+		}
+	}
+
+	// a blob is only known if all repositories contain it
+	bh := restic.BlobHandle{ID: ids[0], Type: restic.DataBlob}
+	rtest.Assert(t, f.Index().Has(bh), "blob %v not found", bh)
+	other := restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.DataBlob}
+	repos[1].Index().(*index.MasterIndex).StorePack(restic.NewRandomID(), []restic.Blob{{BlobHandle: other, Length: 10}})
+	rtest.Assert(t, repos[1].Index().Has(other), "blob %v not added to the index", other)
+	rtest.Assert(t, !f.Index().Has(other), "blob %v found", other)
+
+	sn := []byte(`{"time":"2022-01-01T00:00:00Z"}`)
+	snID, err := f.SaveUnpacked(context.TODO(), restic.SnapshotFile, sn)
+	rtest.OK(t, err)
+
+	for i, res := range f.Results() {
+		rtest.OK(t, res.Err)
+		rtest.Equals(t, 1, len(res.Unpacked))
+		if i == 0 {
+			rtest.Equals(t, snID, res.Unpacked[0])
+		}
+		buf, err := repos[i].LoadUnpacked(context.TODO(), restic.SnapshotFile, res.Unpacked[0], nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, sn, buf)
+
+		rtest.Equals(t, uint(len(bufs)), res.DataBlobs)
+		rtest.Equals(t, uint64(len(bufs)*100*1024), res.DataAdded)
+		rtest.Assert(t, res.DataAddedPacked > 0, "no stored size recorded")
+	}
+}
+
+func TestFanoutSnapshotParent(t *testing.T) {
+	repos := testFanoutRepos(t, mem.New(), mem.New())
+	f, err := repository.NewFanout(repos...)
+	rtest.OK(t, err)
+
+	parent := restic.NewRandomID()
+	sn, err := restic.NewSnapshot([]string{"/home"}, nil, "host", time.Unix(1640995200, 0))
+	rtest.OK(t, err)
+	sn.Parent = &parent
+	_, err = restic.SaveSnapshot(context.TODO(), f, sn)
+	rtest.OK(t, err)
+
+	// the parent only exists in the primary repository
+	for i, res := range f.Results() {
+		rtest.OK(t, res.Err)
+		loaded, err := restic.LoadSnapshot(context.TODO(), repos[i], res.Unpacked[0])
+		rtest.OK(t, err)
+		rtest.Equals(t, sn.Paths, loaded.Paths)
+		if i == 0 {
+			rtest.Equals(t, &parent, loaded.Parent)
+		} else {
+			rtest.Assert(t, loaded.Parent == nil, "repository %d: unexpected parent %v", i+1, loaded.Parent)
+		}
+	}
+}
+
+func TestFanoutFailure(t *testing.T) {
+	failing := &failingPackBackend{Backend: mem.New()}
+	repos := testFanoutRepos(t, mem.New(), failing)
+	failing.fail = true
+
+	f, err := repository.NewFanout(repos...)
+	rtest.OK(t, err)
+
+	rng := rand.New(rand.NewSource(23))
+	var bufs [][]byte
+	for i := 0; i < 10; i++ {
+		buf := make([]byte, 1024*1024)
+		rng.Read(buf)
+		bufs = append(bufs, buf)
+	}
+
+	// saving to the first repository succeeds
+	ids, err := saveFanoutBlobs(t, f, bufs)
+	rtest.OK(t, err)
+	for _, id := range ids {
+		rtest.Assert(t, repos[0].Index().Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}), "blob %v is missing", id)
+	}
+
+	results := f.Results()
+	rtest.OK(t, results[0].Err)
+	rtest.Assert(t, results[1].Err != nil, "failure of the second repository was not reported")
+
+	_, err = f.SaveUnpacked(context.TODO(), restic.SnapshotFile, []byte(`{}`))
+	rtest.OK(t, err)
+	results = f.Results()
+	rtest.Equals(t, 1, len(results[0].Unpacked))
+	rtest.Equals(t, 0, len(results[1].Unpacked))
+}
+
+func TestFanoutChunkerParams(t *testing.T) {
+	repos := testFanoutRepos(t, mem.New())
+	other, err := repository.New(mem.New(), repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, other.Init(context.TODO(), restic.StableRepoVersion, rtest.TestPassword, nil, 0, 0))
+
+	_, err = repository.NewFanout(repos[0], other)
+	rtest.Assert(t, err != nil, "expected error for different chunker parameters")
+
+	// the same polynomial with different chunk sizes
+	pol := repos[0].Config().ChunkerPolynomial
+	other, err = repository.New(mem.New(), repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, other.Init(context.TODO(), restic.StableRepoVersion, rtest.TestPassword, &pol, 4*1024*1024, 0))
+
+	_, err = repository.NewFanout(repos[0], other)
+	rtest.Assert(t, err != nil, "expected error for different chunk sizes")
+}
@@ -113,6 +113,14 @@ func OpenKey(ctx context.Context, s *Repository, id restic.ID, password string)
 // maxKeys is reached, ErrMaxKeysReached is returned. When setting maxKeys to
 // zero, all keys in the repo are checked.
 func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int, keyHint string) (k *Key, err error) {
+	return searchKey(ctx, s, password, maxKeys, keyHint, nil)
+}
+
+// searchKey works like SearchKey. If check is not nil, it is called for each
+// key which could be decrypted, keys for which check returns
+// crypto.ErrUnauthenticated are skipped. This happens for example while the
+// master key is rotated, when the password opens both the old and the new key.
+func searchKey(ctx context.Context, s *Repository, password string, maxKeys int, keyHint string, check func(*Key) error) (k *Key, err error) {
 	checked := 0
 
 	if len(keyHint) > 0 {
@@ -120,6 +128,9 @@ func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int,
 
 		if err == nil {
 			key, err := OpenKey(ctx, s, id, password)
+			if err == nil && check != nil {
+				err = check(key)
+			}
 
 			if err == nil {
 				debug.Log("successfully opened hinted key %v", id)
@@ -155,6 +166,17 @@ func SearchKey(ctx context.Context, s *Repository, password string, maxKeys int,
 			return err
 		}
 
+		if check != nil {
+			err = check(key)
+			if errors.Is(err, crypto.ErrUnauthenticated) {
+				debug.Log("key %v does not match the repository: %v", id.String(), err)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+
 		debug.Log("successfully opened key %v", id.String())
 		k = key
 		cancel()
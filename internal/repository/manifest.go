@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// PackManifest lists the blobs of a pack file independently of the pack
+// header and the index. It is stored encrypted as a file of type ManifestFile
+// with the same name as the pack, so that damaged blobs can still be located
+// if the pack header is damaged. The ID of a blob is the SHA-256 hash of its
+// plaintext.
+type PackManifest struct {
+	Pack  restic.ID      `json:"pack"`
+	Blobs []manifestBlob `json:"blobs"`
+}
+
+type manifestBlob struct {
+	ID                 restic.ID       `json:"id"`
+	Type               restic.BlobType `json:"type"`
+	Offset             uint            `json:"offset"`
+	Length             uint            `json:"length"`
+	UncompressedLength uint            `json:"uncompressed_length,omitempty"`
+}
+
+// NewPackManifest returns the manifest for the pack id containing blobs.
+func NewPackManifest(id restic.ID, blobs []restic.Blob) *PackManifest {
+	m := &PackManifest{
+		Pack:  id,
+		Blobs: make([]manifestBlob, 0, len(blobs)),
+	}
+	for _, blob := range blobs {
+		m.Blobs = append(m.Blobs, manifestBlob{
+			ID:                 blob.ID,
+			Type:               blob.Type,
+			Offset:             blob.Offset,
+			Length:             blob.Length,
+			UncompressedLength: blob.UncompressedLength,
+		})
+	}
+	return m
+}
+
+// PackBlobs returns the blobs listed in the manifest.
+func (m *PackManifest) PackBlobs() []restic.Blob {
+	blobs := make([]restic.Blob, 0, len(m.Blobs))
+	for _, blob := range m.Blobs {
+		blobs = append(blobs, restic.Blob{
+			BlobHandle:         restic.BlobHandle{ID: blob.ID, Type: blob.Type},
+			Offset:             blob.Offset,
+			Length:             blob.Length,
+			UncompressedLength: blob.UncompressedLength,
+		})
+	}
+	return blobs
+}
+
+// savePackManifest stores the manifest for the pack id containing blobs. The
+// manifest is not compressed, it is small compared to the pack.
+func (r *Repository) savePackManifest(ctx context.Context, id restic.ID, blobs []restic.Blob) error {
+	buf, err := json.Marshal(NewPackManifest(id, blobs))
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	ciphertext := crypto.NewBlobBuffer(len(buf))
+	ciphertext = ciphertext[:0]
+	nonce := crypto.NewRandomNonce()
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = r.key.Seal(ciphertext, nonce, buf, nil)
+
+	h := restic.Handle{Type: restic.ManifestFile, Name: id.String()}
+	err = r.be.Save(ctx, h, restic.NewByteReader(ciphertext, r.be.Hasher()))
+	if err != nil {
+		debug.Log("error saving manifest %v: %v", h, err)
+		return err
+	}
+	return nil
+}
+
+// LoadPackManifest loads and decrypts the manifest of the pack id. If the pack
+// has no manifest, the error returned by the backend is passed on, which can
+// be tested with be.IsNotExist.
+func LoadPackManifest(ctx context.Context, be restic.Backend, key *crypto.Key, id restic.ID) (*PackManifest, error) {
+	h := restic.Handle{Type: restic.ManifestFile, Name: id.String()}
+	var buf []byte
+	err := be.Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		wr := bytes.NewBuffer(buf[:0])
+		_, err := io.Copy(wr, rd)
+		buf = wr.Bytes()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < key.NonceSize() {
+		return nil, errors.Errorf("manifest of pack %v is too short", id.Str())
+	}
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decrypting manifest of pack %v", id.Str())
+	}
+
+	m := &PackManifest{}
+	err = json.Unmarshal(plaintext, m)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decoding manifest of pack %v", id.Str())
+	}
+	if !m.Pack.Equal(id) {
+		return nil, errors.Errorf("manifest %v belongs to pack %v", id.Str(), m.Pack.Str())
+	}
+	return m, nil
+}
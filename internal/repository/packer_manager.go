@@ -175,6 +175,15 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 
 	debug.Log("saved as %v", h)
 
+	// the manifest is saved after the pack, a pack without a manifest is
+	// still valid
+	if r.opts.PackManifests {
+		err = r.savePackManifest(ctx, id, p.Packer.Blobs())
+		if err != nil {
+			return err
+		}
+	}
+
 	err = p.tmpfile.Close()
 	if err != nil {
 		return errors.Wrap(err, "close tempfile")
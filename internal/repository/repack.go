@@ -34,10 +34,18 @@ func Repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 
 	wg, wgCtx := errgroup.WithContext(ctx)
 
+	// as packs are streamed the concurrency is limited by IO
+	// reduce by one to ensure that uploading is always possible
+	workers := int(repo.Connections() - 1)
+	if repo != dstRepo {
+		// no need to share the upload and download connections for different repositories
+		workers = int(repo.Connections())
+	}
+
 	dstRepo.StartPackUploader(wgCtx, wg)
 	wg.Go(func() error {
 		var err error
-		obsoletePacks, err = repack(wgCtx, repo, dstRepo, packs, keepBlobs, p)
+		obsoletePacks, err = repack(wgCtx, repo, dstRepo, packs, keepBlobs, p, workers, true, nil)
 		return err
 	})
 
@@ -47,7 +55,39 @@ func Repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 	return obsoletePacks, nil
 }
 
-func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Repository, packs restic.IDSet, keepBlobs repackBlobSet, p *progress.Counter) (obsoletePacks restic.IDSet, err error) {
+// CopyBlobs copies the blobs listed in keepBlobs from the packs in repo to
+// dstRepo using the given number of workers. Blobs which are already present
+// in dstRepo are not uploaded again, this allows resuming an interrupted
+// copy. For each blob, blobSaved is called with the blob, its plaintext size
+// and whether it was already known. It must be safe to call blobSaved from
+// concurrent goroutines.
+//
+// The map keepBlobs is modified by CopyBlobs, it is used to keep track of which
+// blobs have been processed.
+func CopyBlobs(ctx context.Context, repo restic.Repository, dstRepo restic.Repository, packs restic.IDSet, keepBlobs repackBlobSet, workers int, blobSaved func(blob restic.BlobHandle, size uint, known bool)) error {
+	debug.Log("copying %d blobs from %d packs using %d workers", keepBlobs.Len(), len(packs), workers)
+
+	if repo == dstRepo {
+		return errors.New("source and destination repository must differ")
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+
+	dstRepo.StartPackUploader(wgCtx, wg)
+	wg.Go(func() error {
+		_, err := repack(wgCtx, repo, dstRepo, packs, keepBlobs, nil, workers, false, blobSaved)
+		return err
+	})
+
+	return wg.Wait()
+}
+
+func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Repository, packs restic.IDSet, keepBlobs repackBlobSet, p *progress.Counter,
+	workers int, storeDuplicates bool, blobSaved func(blob restic.BlobHandle, size uint, known bool)) (obsoletePacks restic.IDSet, err error) {
+
 	wg, wgCtx := errgroup.WithContext(ctx)
 
 	var keepMutex sync.Mutex
@@ -100,11 +140,14 @@ func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 					return nil
 				}
 
-				// We do want to save already saved blobs!
-				_, _, _, err = dstRepo.SaveBlob(wgCtx, blob.Type, buf, blob.ID, true)
+				// When repacking, we do want to save already saved blobs!
+				_, known, _, err := dstRepo.SaveBlob(wgCtx, blob.Type, buf, blob.ID, storeDuplicates)
 				if err != nil {
 					return err
 				}
+				if blobSaved != nil {
+					blobSaved(blob, uint(len(buf)), known)
+				}
 
 				debug.Log("  saved blob %v", blob.ID)
 				return nil
@@ -117,14 +160,7 @@ func repack(ctx context.Context, repo restic.Repository, dstRepo restic.Reposito
 		return nil
 	}
 
-	// as packs are streamed the concurrency is limited by IO
-	// reduce by one to ensure that uploading is always possible
-	repackWorkerCount := int(repo.Connections() - 1)
-	if repo != dstRepo {
-		// no need to share the upload and download connections for different repositories
-		repackWorkerCount = int(repo.Connections())
-	}
-	for i := 0; i < repackWorkerCount; i++ {
+	for i := 0; i < workers; i++ {
 		wg.Go(worker)
 	}
 
@@ -60,6 +60,12 @@ type Repository struct {
 type Options struct {
 	Compression CompressionMode
 	PackSize    uint
+	// LowMemoryIndex stores the loaded index in temporary files instead of
+	// memory, which makes lookups slower.
+	LowMemoryIndex bool
+	// PackManifests stores a manifest of the blobs for each new pack, see
+	// PackManifest.
+	PackManifests bool
 }
 
 // CompressionMode configures if data should be compressed.
@@ -70,6 +76,7 @@ const (
 	CompressionAuto CompressionMode = 0
 	CompressionOff  CompressionMode = 1
 	CompressionMax  CompressionMode = 2
+	CompressionFast CompressionMode = 3
 )
 
 // Set implements the method needed for pflag command flag parsing.
@@ -81,8 +88,10 @@ func (c *CompressionMode) Set(s string) error {
 		*c = CompressionOff
 	case "max":
 		*c = CompressionMax
+	case "fast":
+		*c = CompressionFast
 	default:
-		return fmt.Errorf("invalid compression mode %q, must be one of (auto|off|max)", s)
+		return fmt.Errorf("invalid compression mode %q, must be one of (auto|off|max|fast)", s)
 	}
 
 	return nil
@@ -96,6 +105,8 @@ func (c *CompressionMode) String() string {
 		return "off"
 	case CompressionMax:
 		return "max"
+	case CompressionFast:
+		return "fast"
 	default:
 		return "invalid"
 	}
@@ -105,15 +116,22 @@ func (c *CompressionMode) Type() string {
 	return "mode"
 }
 
+// CheckPackSize returns an error if size is not a valid target pack size.
+func CheckPackSize(size uint) error {
+	if size > MaxPackSize {
+		return errors.Fatalf("pack size larger than limit of %v MiB", MaxPackSize/1024/1024)
+	} else if size < MinPackSize {
+		return errors.Fatalf("pack size smaller than minimum of %v MiB", MinPackSize/1024/1024)
+	}
+	return nil
+}
+
 // New returns a new repository with backend be.
 func New(be restic.Backend, opts Options) (*Repository, error) {
-	if opts.PackSize == 0 {
-		opts.PackSize = DefaultPackSize
-	}
-	if opts.PackSize > MaxPackSize {
-		return nil, errors.Fatalf("pack size larger than limit of %v MiB", MaxPackSize/1024/1024)
-	} else if opts.PackSize < MinPackSize {
-		return nil, errors.Fatalf("pack size smaller than minimum of %v MiB", MinPackSize/1024/1024)
+	if opts.PackSize != 0 {
+		if err := CheckPackSize(opts.PackSize); err != nil {
+			return nil, err
+		}
 	}
 
 	repo := &Repository{
@@ -121,6 +139,9 @@ func New(be restic.Backend, opts Options) (*Repository, error) {
 		opts: opts,
 		idx:  index.NewMasterIndex(),
 	}
+	if opts.LowMemoryIndex {
+		repo.idx.UseDiskIndex()
+	}
 
 	return repo, nil
 }
@@ -144,9 +165,16 @@ func (r *Repository) Config() restic.Config {
 	return r.cfg
 }
 
-// PackSize return the target size of a pack file when uploading
+// PackSize return the target size of a pack file when uploading. The pack size
+// from the options takes precedence over the one stored in the config.
 func (r *Repository) PackSize() uint {
-	return r.opts.PackSize
+	if r.opts.PackSize != 0 {
+		return r.opts.PackSize
+	}
+	if r.cfg.PackSize != 0 && CheckPackSize(r.cfg.PackSize) == nil {
+		return r.cfg.PackSize
+	}
+	return DefaultPackSize
 }
 
 // UseCache replaces the backend with the wrapped cache.
@@ -340,9 +368,14 @@ func (r *Repository) LookupBlobSize(id restic.ID, tpe restic.BlobType) (uint, bo
 
 func (r *Repository) getZstdEncoder() *zstd.Encoder {
 	r.allocEnc.Do(func() {
+		// the level only affects the encoder, data compressed with any level
+		// can be decompressed the same way
 		level := zstd.SpeedDefault
-		if r.opts.Compression == CompressionMax {
+		switch r.opts.Compression {
+		case CompressionMax:
 			level = zstd.SpeedBestCompression
+		case CompressionFast:
+			level = zstd.SpeedFastest
 		}
 
 		opts := []zstd.EOption{
@@ -507,6 +540,15 @@ func (r *Repository) Flush(ctx context.Context) error {
 	return r.idx.SaveIndex(ctx, r)
 }
 
+// SaveIndex saves the index for all pack files which have been uploaded so
+// far. It can be called while blobs are still being saved.
+func (r *Repository) SaveIndex(ctx context.Context) error {
+	if r.noAutoIndexUpdate {
+		return nil
+	}
+	return r.idx.SaveIndex(ctx, r)
+}
+
 func (r *Repository) StartPackUploader(ctx context.Context, wg *errgroup.Group) {
 	if r.packerWg != nil {
 		panic("uploader already started")
@@ -578,6 +620,11 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 			return err
 		}
 		r.idx.Insert(idx)
+		if r.opts.LowMemoryIndex {
+			// merge right away, such that the entries are moved to disk
+			// before all index files are loaded
+			return r.idx.MergeFinalIndexes()
+		}
 		return nil
 	})
 
@@ -590,6 +637,11 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 		return err
 	}
 
+	err = r.idx.CompactDiskIndex()
+	if err != nil {
+		return err
+	}
+
 	if r.cfg.Version < 2 {
 		// sanity check
 		ctx, cancel := context.WithCancel(ctx)
@@ -703,27 +755,40 @@ func (r *Repository) prepareCache() error {
 // SearchKey finds a key with the supplied password, afterwards the config is
 // read and parsed. It tries at most maxKeys key files in the repo.
 func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int, keyHint string) error {
-	key, err := SearchKey(ctx, r, password, maxKeys, keyHint)
+	var cfg restic.Config
+	// the key which failed to decrypt the config, if any
+	var damaged *Key
+	key, err := searchKey(ctx, r, password, maxKeys, keyHint, func(key *Key) error {
+		r.key = key.master
+		var err error
+		cfg, err = restic.LoadConfig(ctx, r)
+		if err == crypto.ErrUnauthenticated {
+			damaged = key
+			return err
+		} else if err != nil {
+			return errors.Fatalf("config cannot be loaded: %v", err)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrNoKeyFound) && damaged != nil {
+		return errors.Fatalf("config or key %v is damaged: %v", damaged.ID(), crypto.ErrUnauthenticated)
+	}
 	if err != nil {
+		r.key = nil
 		return err
 	}
 
 	r.key = key.master
 	r.keyID = key.ID()
-	cfg, err := restic.LoadConfig(ctx, r)
-	if err == crypto.ErrUnauthenticated {
-		return errors.Fatalf("config or key %v is damaged: %v", key.ID(), err)
-	} else if err != nil {
-		return errors.Fatalf("config cannot be loaded: %v", err)
-	}
-
 	r.setConfig(cfg)
 	return nil
 }
 
 // Init creates a new master key with the supplied password, initializes and
-// saves the repository config.
-func (r *Repository) Init(ctx context.Context, version uint, password string, chunkerPolynomial *chunker.Pol) error {
+// saves the repository config. If averageChunkSize is zero, the default chunk
+// size is used. A non-zero packSize is stored as the default target pack size
+// of the repository.
+func (r *Repository) Init(ctx context.Context, version uint, password string, chunkerPolynomial *chunker.Pol, averageChunkSize uint64, packSize uint) error {
 	if version > restic.MaxRepoVersion {
 		return fmt.Errorf("repository version %v too high", version)
 	}
@@ -737,6 +802,9 @@ func (r *Repository) Init(ctx context.Context, version uint, password string, ch
 		return err
 	}
 	if has {
+		if chunkerPolynomial != nil || averageChunkSize != 0 {
+			return errors.New("repository already initialized, the chunker parameters of an existing repository cannot be changed because this would prevent deduplication with the data already stored")
+		}
 		return errors.New("repository master key and config already initialized")
 	}
 
@@ -747,6 +815,19 @@ func (r *Repository) Init(ctx context.Context, version uint, password string, ch
 	if chunkerPolynomial != nil {
 		cfg.ChunkerPolynomial = *chunkerPolynomial
 	}
+	if averageChunkSize != 0 {
+		err = cfg.SetAverageChunkSize(averageChunkSize)
+		if err != nil {
+			return err
+		}
+	}
+	if packSize != 0 {
+		err = CheckPackSize(packSize)
+		if err != nil {
+			return err
+		}
+		cfg.PackSize = packSize
+	}
 
 	return r.init(ctx, password, cfg)
 }
@@ -806,6 +887,17 @@ func (r *Repository) Close() error {
 	return r.be.Close()
 }
 
+// BlobID returns the plaintext hash of the blob buf, the ID of the blob.
+func BlobID(buf []byte) restic.ID {
+	// Special case the hash calculation for all zero chunks. This is especially
+	// useful for sparse files containing large all zero regions. For these we can
+	// process chunks as fast as we can read the from disk.
+	if len(buf) == chunker.MinSize && restic.ZeroPrefixLen(buf) == chunker.MinSize {
+		return ZeroChunk()
+	}
+	return restic.Hash(buf)
+}
+
 // SaveBlob saves a blob of type t into the repository.
 // It takes care that no duplicates are saved; this can be overwritten
 // by setting storeDuplicate to true.
@@ -817,14 +909,7 @@ func (r *Repository) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte
 
 	// compute plaintext hash if not already set
 	if id.IsNull() {
-		// Special case the hash calculation for all zero chunks. This is especially
-		// useful for sparse files containing large all zero regions. For these we can
-		// process chunks as fast as we can read the from disk.
-		if len(buf) == chunker.MinSize && restic.ZeroPrefixLen(buf) == chunker.MinSize {
-			newID = ZeroChunk()
-		} else {
-			newID = restic.Hash(buf)
-		}
+		newID = BlobID(buf)
 	} else {
 		newID = id
 	}
@@ -1,12 +1,15 @@
 package repository
 
 import (
+	"bytes"
+	"context"
 	"math/rand"
 	"sort"
 	"testing"
 
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
 )
 
 type mapcache map[restic.Handle]bool
@@ -72,3 +75,49 @@ func BenchmarkSortCachedPacksFirst(b *testing.B) {
 		sortCachedPacksFirst(cache, cpy[:])
 	}
 }
+
+func TestCompressionModeSet(t *testing.T) {
+	for _, s := range []string{"auto", "off", "max", "fast"} {
+		var mode CompressionMode
+		rtest.OK(t, mode.Set(s))
+		rtest.Equals(t, s, mode.String())
+	}
+
+	var mode CompressionMode
+	rtest.Assert(t, mode.Set("best") != nil, "expected error for invalid compression mode")
+}
+
+func TestSaveBlobCompressionModes(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible data "), 10000)
+
+	for _, mode := range []CompressionMode{CompressionAuto, CompressionOff, CompressionMax, CompressionFast} {
+		t.Run(mode.String(), func(t *testing.T) {
+			r, cleanup := TestRepositoryWithVersion(t, 2)
+			defer cleanup()
+			repo := r.(*Repository)
+			repo.opts.Compression = mode
+
+			var wg errgroup.Group
+			repo.StartPackUploader(context.TODO(), &wg)
+
+			dataID, _, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{}, false)
+			rtest.OK(t, err)
+			treeID, _, _, err := repo.SaveBlob(context.TODO(), restic.TreeBlob, data, restic.ID{}, false)
+			rtest.OK(t, err)
+			rtest.OK(t, repo.Flush(context.TODO()))
+
+			dataBlobs := repo.Index().Lookup(restic.BlobHandle{ID: dataID, Type: restic.DataBlob})
+			rtest.Equals(t, 1, len(dataBlobs))
+			rtest.Equals(t, mode != CompressionOff, dataBlobs[0].IsCompressed())
+
+			// metadata is compressed even if data compression is disabled
+			treeBlobs := repo.Index().Lookup(restic.BlobHandle{ID: treeID, Type: restic.TreeBlob})
+			rtest.Equals(t, 1, len(treeBlobs))
+			rtest.Assert(t, treeBlobs[0].IsCompressed(), "tree blob is not compressed")
+
+			buf, err := repo.LoadBlob(context.TODO(), restic.DataBlob, dataID, nil)
+			rtest.OK(t, err)
+			rtest.Assert(t, bytes.Equal(data, buf), "loaded data does not match")
+		})
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -338,6 +340,108 @@ func TestRepositoryLoadUnpackedRetryBroken(t *testing.T) {
 	rtest.OK(t, repo.LoadIndex(context.TODO()))
 }
 
+func TestRepositoryPackSize(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	repo, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(repository.DefaultPackSize), repo.PackSize())
+
+	err = repo.Init(context.TODO(), restic.StableRepoVersion, test.TestPassword, nil, 0, 1024)
+	rtest.Assert(t, err != nil, "expected error for a pack size below the minimum")
+
+	err = repo.Init(context.TODO(), restic.StableRepoVersion, test.TestPassword, nil, 0, 32*1024*1024)
+	rtest.OK(t, err)
+
+	// the pack size stored in the config is used by default
+	repo, err = repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.SearchKey(context.TODO(), test.TestPassword, 10, ""))
+	rtest.Equals(t, uint(32*1024*1024), repo.PackSize())
+
+	// the pack size of the options takes precedence
+	repo, err = repository.New(be, repository.Options{PackSize: 8 * 1024 * 1024})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.SearchKey(context.TODO(), test.TestPassword, 10, ""))
+	rtest.Equals(t, uint(8*1024*1024), repo.PackSize())
+
+	_, err = repository.New(be, repository.Options{PackSize: 256 * 1024 * 1024})
+	rtest.Assert(t, err != nil, "expected error for a pack size above the maximum")
+}
+
+func TestPackManifests(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	repo, err := repository.New(be, repository.Options{PackManifests: true})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Init(context.TODO(), restic.StableRepoVersion, test.TestPassword, nil, 0, 0))
+
+	saveRandomDataBlobs(t, repo, 200, 1<<18)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	packIDs := restic.NewIDSet()
+	rtest.OK(t, repo.List(context.TODO(), restic.PackFile, func(id restic.ID, size int64) error {
+		packIDs.Insert(id)
+		return nil
+	}))
+
+	packs := 0
+	for pb := range repo.Index().ListPacks(context.TODO(), packIDs) {
+		packs++
+		m, err := repository.LoadPackManifest(context.TODO(), be, repo.Key(), pb.PackID)
+		rtest.OK(t, err)
+		rtest.Equals(t, pb.PackID, m.Pack)
+
+		blobs := m.PackBlobs()
+		sort.Slice(blobs, func(i, j int) bool { return blobs[i].Offset < blobs[j].Offset })
+		sort.Slice(pb.Blobs, func(i, j int) bool { return pb.Blobs[i].Offset < pb.Blobs[j].Offset })
+		rtest.Equals(t, pb.Blobs, blobs)
+	}
+	rtest.Assert(t, packs > 0, "no packs were saved")
+
+	manifests := 0
+	rtest.OK(t, be.List(context.TODO(), restic.ManifestFile, func(restic.FileInfo) error {
+		manifests++
+		return nil
+	}))
+	rtest.Equals(t, packs, manifests)
+
+	// the manifest of another pack is rejected
+	var ids restic.IDs
+	rtest.OK(t, be.List(context.TODO(), restic.ManifestFile, func(fi restic.FileInfo) error {
+		id, err := restic.ParseID(fi.Name)
+		rtest.OK(t, err)
+		ids = append(ids, id)
+		return nil
+	}))
+	other := restic.NewRandomID()
+	var buf []byte
+	rtest.OK(t, be.Load(context.TODO(), restic.Handle{Type: restic.ManifestFile, Name: ids[0].String()}, 0, 0, func(rd io.Reader) error {
+		buf, err = ioutil.ReadAll(rd)
+		return err
+	}))
+	rtest.OK(t, be.Save(context.TODO(), restic.Handle{Type: restic.ManifestFile, Name: other.String()}, restic.NewByteReader(buf, be.Hasher())))
+	_, err = repository.LoadPackManifest(context.TODO(), be, repo.Key(), other)
+	rtest.Assert(t, err != nil, "expected error for the manifest of a different pack")
+
+	// packs of a repository without the option have no manifest
+	be, cleanup = repository.TestBackend(t)
+	defer cleanup()
+	repo, err = repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Init(context.TODO(), restic.StableRepoVersion, test.TestPassword, nil, 0, 0))
+	saveRandomDataBlobs(t, repo, 10, 1<<18)
+	rtest.OK(t, repo.Flush(context.TODO()))
+	rtest.OK(t, be.List(context.TODO(), restic.ManifestFile, func(fi restic.FileInfo) error {
+		t.Errorf("unexpected manifest %v", fi.Name)
+		return nil
+	}))
+}
+
 func BenchmarkLoadIndex(b *testing.B) {
 	repository.BenchmarkAllVersions(b, benchmarkLoadIndex)
 }
@@ -534,7 +638,7 @@ func testStreamPack(t *testing.T, version uint) {
 	switch version {
 	case 1:
 		compress = false
-	case 2:
+	case 2, 3:
 		compress = true
 	default:
 		t.Fatal("test does not suport repository version", version)
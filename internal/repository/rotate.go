@@ -0,0 +1,574 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+	"golang.org/x/sync/errgroup"
+)
+
+// KeyRotation re-encrypts all files of a repository with a new master key.
+//
+// First, the pack files are written again using the new key while the
+// repository stays usable with the old key. Then a key file for the new master
+// key is added and the config is switched to the new key. Afterwards, the
+// index and the snapshots are written with the new key and the files of the
+// old key are removed.
+//
+// An interrupted rotation can be resumed with the same old and new master key,
+// before or after the config has been switched. Files which have already been
+// written with the new key are reused.
+type KeyRotation struct {
+	src *Repository
+	dst *Repository
+
+	switched bool
+}
+
+// NewKeyRotation prepares rotating the master key of repo from oldKey to
+// newKey. The repository must have been opened with one of both keys.
+func NewKeyRotation(repo *Repository, oldKey, newKey *crypto.Key) (*KeyRotation, error) {
+	if !oldKey.Valid() || !newKey.Valid() {
+		return nil, errors.New("invalid master key")
+	}
+
+	kr := &KeyRotation{}
+	switch {
+	case sameKey(repo.key, oldKey):
+	case sameKey(repo.key, newKey):
+		kr.switched = true
+	default:
+		return nil, errors.New("repository is not encrypted with the old or the new master key")
+	}
+
+	repos := make([]*Repository, 0, 2)
+	for _, key := range []*crypto.Key{oldKey, newKey} {
+		r, err := New(repo.be, repo.opts)
+		if err != nil {
+			return nil, err
+		}
+		r.key = key
+		r.setConfig(repo.cfg)
+		// the index is written once the config has been switched, clients
+		// using the old key would otherwise fail to load it
+		r.DisableAutoIndexUpdate()
+		repos = append(repos, r)
+	}
+	kr.src, kr.dst = repos[0], repos[1]
+
+	if kr.switched {
+		kr.dst.keyID = repo.keyID
+	}
+	return kr, nil
+}
+
+func sameKey(a, b *crypto.Key) bool {
+	return a.EncryptionKey == b.EncryptionKey && a.MACKey.K == b.MACKey.K && a.MACKey.R == b.MACKey.R
+}
+
+// Switched returns true if the config is encrypted with the new key.
+func (kr *KeyRotation) Switched() bool {
+	return kr.switched
+}
+
+// Repository returns the repository using the new master key.
+func (kr *KeyRotation) Repository() *Repository {
+	return kr.dst
+}
+
+// LoadIndex loads the index files encrypted with the old key and searches for
+// the pack files which have been re-encrypted by an interrupted rotation. It
+// returns the number of packs found. The counter p is advanced for each pack
+// which is not contained in the old index.
+func (kr *KeyRotation) LoadIndex(ctx context.Context, p *progress.Counter) (int, error) {
+	err := index.ForAllIndexes(ctx, kr.src, func(id restic.ID, idx *index.Index, oldFormat bool, err error) error {
+		if errors.Is(err, crypto.ErrUnauthenticated) {
+			// written with the new key by an interrupted rotation
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		kr.src.idx.Insert(idx)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	known := kr.src.idx.Packs(restic.NewIDSet())
+	candidates := make(map[restic.ID]int64)
+	err = kr.src.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		if !known.Has(id) {
+			candidates[id] = size
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	p.SetMax(uint64(len(candidates)))
+
+	var m sync.Mutex
+	found := 0
+	type packInfo struct {
+		id   restic.ID
+		size int64
+	}
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	ch := make(chan packInfo)
+	wg.Go(func() error {
+		defer close(ch)
+		for id, size := range candidates {
+			select {
+			case ch <- packInfo{id: id, size: size}:
+			case <-wgCtx.Done():
+				return wgCtx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < int(kr.src.Connections()); i++ {
+		wg.Go(func() error {
+			for fi := range ch {
+				blobs, _, err := kr.dst.ListPack(wgCtx, fi.id, fi.size)
+				p.Add(1)
+				if err != nil {
+					// the pack was not written by the rotation
+					debug.Log("pack %v cannot be read with the new key: %v", fi.id, err)
+					continue
+				}
+				kr.dst.idx.StorePack(fi.id, blobs)
+				m.Lock()
+				found++
+				m.Unlock()
+			}
+			return nil
+		})
+	}
+
+	return found, wg.Wait()
+}
+
+// RewritePacks re-encrypts all blobs which are not yet contained in packs
+// written with the new key. The counter p is advanced for each blob.
+func (kr *KeyRotation) RewritePacks(ctx context.Context, p *progress.Counter) error {
+	blobs := restic.NewBlobSet()
+	packs := restic.NewIDSet()
+	kr.src.idx.Each(ctx, func(pb restic.PackedBlob) {
+		if kr.dst.idx.Has(pb.BlobHandle) {
+			return
+		}
+		blobs.Insert(pb.BlobHandle)
+		packs.Insert(pb.PackID)
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	debug.Log("re-encrypting %d blobs from %d packs", len(blobs), len(packs))
+	p.SetMax(uint64(len(blobs)))
+	return CopyBlobs(ctx, kr.src, kr.dst, packs, blobs, int(kr.src.Connections()),
+		func(blob restic.BlobHandle, size uint, known bool) {
+			p.Add(1)
+		})
+}
+
+// SwitchKey adds a key file for the new master key with the given password and
+// saves the config encrypted with the new key. Afterwards, the repository can
+// only be opened with the new key. A copy of the original config file is
+// stored as backupFile first. It must be called after RewritePacks.
+func (kr *KeyRotation) SwitchKey(ctx context.Context, password, username, hostname, backupFile string) error {
+	if kr.switched {
+		return nil
+	}
+
+	key, err := AddKey(ctx, kr.dst, password, username, hostname, kr.dst.key)
+	if err != nil {
+		return fmt.Errorf("creating new key failed: %w", err)
+	}
+	kr.dst.keyID = key.ID()
+
+	h := restic.Handle{Type: restic.ConfigFile}
+
+	var rawConfig []byte
+	err = kr.src.be.Load(ctx, h, 0, 0, func(rd io.Reader) (err error) {
+		rawConfig, err = ioutil.ReadAll(rd)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("load config file failed: %w", err)
+	}
+
+	err = fs.MkdirAll(filepath.Dir(backupFile), 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(backupFile, rawConfig, 0600)
+	if err != nil {
+		return fmt.Errorf("write config file backup failed: %w", err)
+	}
+
+	if !kr.src.be.HasAtomicReplace() {
+		// remove the original file for backends which do not support atomic overwriting
+		err = kr.src.be.Remove(ctx, h)
+		if err != nil {
+			return fmt.Errorf("remove config failed: %w", err)
+		}
+	}
+
+	err = restic.SaveConfig(ctx, kr.dst, kr.dst.cfg)
+	if err != nil {
+		// try to restore the original config
+		_ = kr.src.be.Remove(ctx, h)
+		rerr := kr.src.be.Save(ctx, h, restic.NewByteReader(rawConfig, nil))
+		if rerr != nil {
+			return fmt.Errorf("save new config file failed: %w, restoring the original config failed as well: %v, a backup of the config file is stored in %v", err, rerr, backupFile)
+		}
+		return fmt.Errorf("save new config file failed: %w", err)
+	}
+
+	kr.switched = true
+	return os.Remove(backupFile)
+}
+
+// RewriteMetadata writes the index, the snapshots and the audit log with the
+// new key. It must be called after SwitchKey. The snapshots get new IDs, the
+// previous ID is recorded as the original ID unless a snapshot already has one.
+// The counter p is advanced for each snapshot.
+func (kr *KeyRotation) RewriteMetadata(ctx context.Context, p *progress.Counter) error {
+	if !kr.switched {
+		return errors.New("the config has not been switched to the new key")
+	}
+
+	// index files written by an interrupted rotation are replaced
+	err := removeFiles(ctx, kr.dst, restic.IndexFile, func(err error) bool {
+		return err == nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	err = kr.dst.idx.SaveIndex(ctx, kr.dst)
+	if err != nil {
+		return fmt.Errorf("saving index failed: %w", err)
+	}
+
+	var ids restic.IDs
+	rotated := restic.NewIDSet()
+	err = kr.src.List(ctx, restic.SnapshotFile, func(id restic.ID, size int64) error {
+		buf, err := kr.dst.LoadUnpacked(ctx, restic.SnapshotFile, id, nil)
+		if err == nil {
+			// written by an interrupted rotation
+			rotated.Insert(restic.Hash(buf))
+			return nil
+		}
+		if !errors.Is(err, crypto.ErrUnauthenticated) {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	p.SetMax(uint64(len(ids)))
+	for _, id := range ids {
+		sn, err := restic.LoadSnapshot(ctx, kr.src, id)
+		if err != nil {
+			return err
+		}
+		if sn.Original == nil {
+			original := id
+			sn.Original = &original
+		}
+
+		buf, err := json.Marshal(sn)
+		if err != nil {
+			return errors.Wrap(err, "json.Marshal")
+		}
+		if !rotated.Has(restic.Hash(buf)) {
+			_, err = kr.dst.SaveUnpacked(ctx, restic.SnapshotFile, buf)
+			if err != nil {
+				return err
+			}
+		}
+		p.Add(1)
+	}
+
+	return kr.rewriteAuditLog(ctx)
+}
+
+// rewriteAuditLog writes the entries of the audit log with the new key, their
+// content is not modified.
+func (kr *KeyRotation) rewriteAuditLog(ctx context.Context) error {
+	var ids restic.IDs
+	rotated := restic.NewIDSet()
+	err := kr.src.List(ctx, restic.AuditFile, func(id restic.ID, size int64) error {
+		buf, err := kr.dst.LoadUnpacked(ctx, restic.AuditFile, id, nil)
+		if err == nil {
+			// written by an interrupted rotation
+			rotated.Insert(restic.Hash(buf))
+			return nil
+		}
+		if !errors.Is(err, crypto.ErrUnauthenticated) {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		buf, err := kr.src.LoadUnpacked(ctx, restic.AuditFile, id, nil)
+		if err != nil {
+			return err
+		}
+		if !rotated.Has(restic.Hash(buf)) {
+			_, err = kr.dst.SaveUnpacked(ctx, restic.AuditFile, buf)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveOldFiles removes the pack, index, snapshot, audit and signature files
+// which cannot be decrypted with the new master key, the manifests of the
+// removed packs, and all key files except the one for the new master key. It
+// must be called after RewriteMetadata. The counter p is advanced for each
+// removed file.
+func (kr *KeyRotation) RemoveOldFiles(ctx context.Context, p *progress.Counter) error {
+	repo := kr.dst
+	isOldKey := func(err error) bool {
+		return errors.Is(err, crypto.ErrUnauthenticated)
+	}
+
+	err := removeFiles(ctx, repo, restic.IndexFile, isOldKey, p)
+	if err != nil {
+		return err
+	}
+
+	packs := repo.idx.Packs(restic.NewIDSet())
+	err = repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		if packs.Has(id) {
+			return nil
+		}
+		_, _, err := repo.ListPack(ctx, id, size)
+		if !isOldKey(err) {
+			return nil
+		}
+		debug.Log("removing pack %v", id)
+		err = repo.be.Remove(ctx, restic.Handle{Type: restic.PackFile, Name: id.String()})
+		if err != nil {
+			return err
+		}
+		p.Add(1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = removeFiles(ctx, repo, restic.SnapshotFile, isOldKey, p)
+	if err != nil {
+		return err
+	}
+
+	err = removeFiles(ctx, repo, restic.AuditFile, isOldKey, p)
+	if err != nil {
+		return err
+	}
+
+	// the rewritten snapshots differ from the signed ones
+	err = removeFiles(ctx, repo, restic.SignatureFile, isOldKey, p)
+	if err != nil {
+		return err
+	}
+
+	// manifests are named after their pack, those of the removed packs are
+	// no longer needed
+	var removeErr error
+	err = repo.List(ctx, restic.ManifestFile, func(id restic.ID, size int64) error {
+		if packs.Has(id) {
+			return nil
+		}
+		debug.Log("removing manifest %v", id)
+		removeErr = repo.be.Remove(ctx, restic.Handle{Type: restic.ManifestFile, Name: id.String()})
+		if removeErr != nil {
+			return removeErr
+		}
+		p.Add(1)
+		return nil
+	})
+	if removeErr != nil {
+		return removeErr
+	}
+	if err != nil {
+		// manifests are optional, servers which don't know them may reject
+		// listing them, in which case there are none to remove
+		debug.Log("unable to list manifests: %v", err)
+	}
+
+	return repo.List(ctx, restic.KeyFile, func(id restic.ID, size int64) error {
+		if id == repo.keyID {
+			return nil
+		}
+		debug.Log("removing key %v", id)
+		err := repo.be.Remove(ctx, restic.Handle{Type: restic.KeyFile, Name: id.String()})
+		if err != nil {
+			return err
+		}
+		p.Add(1)
+		return nil
+	})
+}
+
+// removeFiles removes all files of type t for which remove returns true. It is
+// called with the error returned when loading the file with the key of repo.
+func removeFiles(ctx context.Context, repo *Repository, t restic.FileType, remove func(err error) bool, p *progress.Counter) error {
+	var ids restic.IDs
+	err := repo.List(ctx, t, func(id restic.ID, size int64) error {
+		_, err := repo.LoadUnpacked(ctx, t, id, nil)
+		if remove(err) {
+			ids = append(ids, id)
+		} else if err != nil && !errors.Is(err, crypto.ErrUnauthenticated) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		debug.Log("removing %v %v", t, id)
+		err := repo.be.Remove(ctx, restic.Handle{Type: t, Name: id.String()})
+		if err != nil {
+			return err
+		}
+		p.Add(1)
+	}
+	return nil
+}
+
+// rotationState is stored locally while the master key is rotated. Each key is
+// encrypted with the other one, so that the state can be loaded using either
+// key.
+type rotationState struct {
+	// NewKey is the new master key, encrypted with the old key.
+	NewKey []byte `json:"new_key"`
+	// OldKey is the old master key, encrypted with the new key.
+	OldKey []byte `json:"old_key"`
+}
+
+// SaveRotationState stores the master keys of a key rotation in filename.
+func SaveRotationState(filename string, oldKey, newKey *crypto.Key) error {
+	var state rotationState
+	var err error
+	state.NewKey, err = sealKey(oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	state.OldKey, err = sealKey(newKey, oldKey)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	err = fs.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf, 0600)
+}
+
+// LoadRotationState loads the master keys of an interrupted key rotation from
+// filename, current must be one of them. If neither key can be decrypted with
+// current, crypto.ErrUnauthenticated is returned.
+func LoadRotationState(filename string, current *crypto.Key) (oldKey, newKey *crypto.Key, err error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var state rotationState
+	err = json.Unmarshal(buf, &state)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	newKey, err = openKey(current, state.NewKey)
+	if err == nil {
+		return current, newKey, nil
+	}
+	if !errors.Is(err, crypto.ErrUnauthenticated) {
+		return nil, nil, err
+	}
+
+	oldKey, err = openKey(current, state.OldKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return oldKey, current, nil
+}
+
+// sealKey encrypts the master key k with key.
+func sealKey(key, k *crypto.Key) ([]byte, error) {
+	buf, err := json.Marshal(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, crypto.CiphertextLength(len(buf)))
+	ciphertext = append(ciphertext, nonce...)
+	return key.Seal(ciphertext, nonce, buf, nil), nil
+}
+
+// openKey decrypts a master key encrypted with sealKey.
+func openKey(key *crypto.Key, ciphertext []byte) (*crypto.Key, error) {
+	if len(ciphertext) < crypto.CiphertextLength(0) {
+		return nil, errors.New("encrypted master key is too short")
+	}
+
+	nonce, ciphertext := ciphertext[:key.NonceSize()], ciphertext[key.NonceSize():]
+	buf, err := key.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &crypto.Key{}
+	err = json.Unmarshal(buf, k)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+	if !k.Valid() {
+		return nil, errors.New("invalid master key")
+	}
+	return k, nil
+}
@@ -0,0 +1,83 @@
+package restic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// AuditEntry records an operation which modified the repository. The entries
+// are stored as separate files of type AuditFile, encrypted and authenticated
+// with the master key like snapshots. Entries are only ever added, so that
+// writing them works with append-only backends.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Hostname  string    `json:"hostname,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	Version   string    `json:"version"`
+	Snapshots IDs       `json:"snapshots,omitempty"`
+	Details   string    `json:"details,omitempty"`
+
+	id *ID
+}
+
+// NewAuditEntry returns an entry for action performed by the current user on
+// this host at time t, version is the version of the client.
+func NewAuditEntry(action, version string, t time.Time) *AuditEntry {
+	e := &AuditEntry{
+		Time:    t,
+		Action:  action,
+		Version: version,
+	}
+
+	e.Hostname, _ = os.Hostname()
+	if usr, err := user.Current(); err == nil {
+		e.Username = usr.Username
+	}
+	return e
+}
+
+// LoadAuditEntry loads the audit log entry with the id.
+func LoadAuditEntry(ctx context.Context, loader LoaderUnpacked, id ID) (*AuditEntry, error) {
+	e := &AuditEntry{id: &id}
+	err := LoadJSONUnpacked(ctx, loader, AuditFile, id, e)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// SaveAuditEntry saves e in the audit log and returns its ID.
+func SaveAuditEntry(ctx context.Context, repo SaverUnpacked, e *AuditEntry) (ID, error) {
+	return SaveJSONUnpacked(ctx, repo, AuditFile, e)
+}
+
+// ForAllAuditEntries reads all audit log entries in parallel and calls the
+// given function. It is guaranteed that the function is not run concurrently.
+// If the called function returns an error, this function is cancelled and
+// also returns this error.
+func ForAllAuditEntries(ctx context.Context, be Lister, loader LoaderUnpacked, fn func(ID, *AuditEntry, error) error) error {
+	var m sync.Mutex
+
+	return ParallelList(ctx, be, AuditFile, loader.Connections(), func(ctx context.Context, id ID, size int64) error {
+		e, err := LoadAuditEntry(ctx, loader, id)
+		m.Lock()
+		defer m.Unlock()
+		return fn(id, e, err)
+	})
+}
+
+// ID returns the ID of the audit log entry.
+func (e AuditEntry) ID() *ID {
+	return e.id
+}
+
+func (e AuditEntry) String() string {
+	return fmt.Sprintf("<AuditEntry %s %s at %s by %s@%s>",
+		e.id.Str(), e.Action, e.Time, e.Username, e.Hostname)
+}
@@ -0,0 +1,48 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestAuditEntries(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	snID := restic.NewRandomID()
+	entries := []*restic.AuditEntry{
+		restic.NewAuditEntry("backup", "1.0", time.Unix(1600000000, 0).UTC()),
+		restic.NewAuditEntry("forget", "1.0", time.Unix(1600000100, 0).UTC()),
+	}
+	entries[0].Snapshots = restic.IDs{snID}
+	entries[1].Details = "details"
+
+	ids := restic.NewIDSet()
+	for _, e := range entries {
+		id, err := restic.SaveAuditEntry(context.TODO(), repo, e)
+		rtest.OK(t, err)
+		ids.Insert(id)
+	}
+
+	found := make(map[string]*restic.AuditEntry)
+	err := restic.ForAllAuditEntries(context.TODO(), repo.Backend(), repo, func(id restic.ID, e *restic.AuditEntry, err error) error {
+		rtest.OK(t, err)
+		rtest.Assert(t, ids.Has(id), "unexpected entry %v", id)
+		rtest.Equals(t, id, *e.ID())
+		found[e.Action] = e
+		return nil
+	})
+	rtest.OK(t, err)
+
+	rtest.Equals(t, 2, len(found))
+	rtest.Equals(t, restic.IDs{snID}, found["backup"].Snapshots)
+	rtest.Equals(t, "details", found["forget"].Details)
+	rtest.Equals(t, "1.0", found["forget"].Version)
+	rtest.Equals(t, entries[1].Hostname, found["forget"].Hostname)
+	rtest.Assert(t, found["forget"].Time.Equal(entries[1].Time), "wrong time %v", found["forget"].Time)
+}
@@ -16,15 +16,48 @@ type Config struct {
 	Version           uint        `json:"version"`
 	ID                string      `json:"id"`
 	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+
+	// The chunk sizes are only set for repositories which use a custom
+	// average chunk size, see SetAverageChunkSize.
+	ChunkerMinSize     uint `json:"chunker_min_size,omitempty"`
+	ChunkerMaxSize     uint `json:"chunker_max_size,omitempty"`
+	ChunkerAverageBits uint `json:"chunker_average_bits,omitempty"`
+
+	// PackSize is the target size of new pack files in bytes, it is used
+	// unless a different pack size is requested for a single run.
+	PackSize uint `json:"pack_size,omitempty"`
 }
 
+// The limits for the average chunk size, the chunker aims for chunks of about
+// 1 MiB by default.
+const (
+	DefaultAverageChunkSize = 1 << defaultChunkerAverageBits
+	MinAverageChunkSize     = 1 << minChunkerAverageBits
+	MaxAverageChunkSize     = 1 << maxChunkerAverageBits
+
+	defaultChunkerAverageBits = 20
+	minChunkerAverageBits     = 18
+	maxChunkerAverageBits     = 24
+)
+
 const MinRepoVersion = 1
-const MaxRepoVersion = 2
+const MaxRepoVersion = 3
 
 // StableRepoVersion is the version that is written to the config when a repository
 // is newly created with Init().
 const StableRepoVersion = 2
 
+// LatestRepoVersion is the version used for `init --repository-version latest`.
+// Version 3 only adds custom chunk sizes, which are not supported by restic
+// 0.14.0, so it is only used if set explicitly or for a custom chunk size.
+const LatestRepoVersion = 2
+
+// ChunkerSizesRepoVersion is the repository version which is required for a
+// custom average chunk size. Older restic versions ignore the chunk sizes in
+// the config and would split files with the default sizes, the version makes
+// them refuse to access the repository instead.
+const ChunkerSizesRepoVersion = 3
+
 // JSONUnpackedLoader loads unpacked JSON.
 type JSONUnpackedLoader interface {
 	LoadJSONUnpacked(context.Context, FileType, ID, interface{}) error
@@ -50,6 +83,78 @@ func CreateConfig(version uint) (Config, error) {
 	return cfg, nil
 }
 
+// SetAverageChunkSize configures the chunker to aim for chunks of size bytes
+// on average. The size must be a power of two between MinAverageChunkSize and
+// MaxAverageChunkSize. Chunks are at least half and at most eight times as
+// large as the average, like for the default size. Changing the chunk size of
+// an existing repository would prevent deduplication with the data already
+// stored, so this must only be used for new repositories. A custom chunk size
+// raises the version of the config to ChunkerSizesRepoVersion, it cannot be
+// used with version 1.
+func (cfg *Config) SetAverageChunkSize(size uint64) error {
+	if size < MinAverageChunkSize || size > MaxAverageChunkSize || size&(size-1) != 0 {
+		return errors.Errorf("invalid average chunk size %d, must be a power of two between %d and %d",
+			size, uint64(MinAverageChunkSize), uint64(MaxAverageChunkSize))
+	}
+
+	if size == DefaultAverageChunkSize {
+		// keep the config compatible with older versions
+		cfg.ChunkerMinSize, cfg.ChunkerMaxSize, cfg.ChunkerAverageBits = 0, 0, 0
+		return nil
+	}
+
+	if cfg.Version < 2 {
+		return errors.Errorf("a custom average chunk size requires repository version %d, it cannot be used with version %d",
+			ChunkerSizesRepoVersion, cfg.Version)
+	}
+	cfg.Version = ChunkerSizesRepoVersion
+
+	bits := uint(0)
+	for s := size; s > 1; s >>= 1 {
+		bits++
+	}
+
+	cfg.ChunkerMinSize = uint(size / 2)
+	cfg.ChunkerMaxSize = uint(size * 8)
+	cfg.ChunkerAverageBits = bits
+	return nil
+}
+
+// ChunkerSizes returns the minimal and maximal chunk size and the number of
+// bits of the average chunk size which are used to split files into chunks.
+func (cfg Config) ChunkerSizes() (minSize, maxSize uint, averageBits int) {
+	if cfg.ChunkerAverageBits == 0 {
+		return chunker.MinSize, chunker.MaxSize, defaultChunkerAverageBits
+	}
+	return cfg.ChunkerMinSize, cfg.ChunkerMaxSize, int(cfg.ChunkerAverageBits)
+}
+
+// AverageChunkSize returns the size the chunker aims for on average.
+func (cfg Config) AverageChunkSize() uint64 {
+	_, _, bits := cfg.ChunkerSizes()
+	return 1 << uint(bits)
+}
+
+// checkChunkerSizes returns an error if the chunk sizes are invalid, for
+// example because they were set by a version with different limits.
+func (cfg Config) checkChunkerSizes() error {
+	if cfg.ChunkerMinSize == 0 && cfg.ChunkerMaxSize == 0 && cfg.ChunkerAverageBits == 0 {
+		return nil
+	}
+
+	if cfg.Version < ChunkerSizesRepoVersion {
+		return errors.Errorf("chunker parameters are set in a config with repository version %d, they require version %d",
+			cfg.Version, ChunkerSizesRepoVersion)
+	}
+
+	if cfg.ChunkerAverageBits < minChunkerAverageBits || cfg.ChunkerAverageBits > maxChunkerAverageBits ||
+		cfg.ChunkerMinSize == 0 || cfg.ChunkerMinSize >= cfg.ChunkerMaxSize {
+		return errors.Errorf("invalid chunker parameters: min size %d, max size %d, average bits %d",
+			cfg.ChunkerMinSize, cfg.ChunkerMaxSize, cfg.ChunkerAverageBits)
+	}
+	return nil
+}
+
 // TestCreateConfig creates a config for use within tests.
 func TestCreateConfig(t testing.TB, pol chunker.Pol, version uint) (cfg Config) {
 	cfg.ChunkerPolynomial = pol
@@ -96,6 +201,10 @@ func LoadConfig(ctx context.Context, r LoaderUnpacked) (Config, error) {
 		}
 	}
 
+	if err := cfg.checkChunkerSizes(); err != nil {
+		return Config{}, err
+	}
+
 	return cfg, nil
 }
 
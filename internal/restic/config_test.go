@@ -2,6 +2,7 @@ package restic_test
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/restic/restic/internal/restic"
@@ -63,3 +64,54 @@ func TestConfig(t *testing.T) {
 	rtest.Assert(t, cfg1 == cfg2,
 		"configs aren't equal: %v != %v", cfg1, cfg2)
 }
+
+func TestConfigAverageChunkSize(t *testing.T) {
+	cfg, err := restic.CreateConfig(restic.StableRepoVersion)
+	rtest.OK(t, err)
+
+	minSize, maxSize, bits := cfg.ChunkerSizes()
+	rtest.Assert(t, minSize == 512*1024 && maxSize == 8*1024*1024 && bits == 20,
+		"wrong default chunker sizes %v %v %v", minSize, maxSize, bits)
+
+	for _, size := range []uint64{0, 1000, 3 * 1024 * 1024, restic.MinAverageChunkSize / 2, restic.MaxAverageChunkSize * 2} {
+		rtest.Assert(t, cfg.SetAverageChunkSize(size) != nil, "expected error for average chunk size %v", size)
+	}
+
+	rtest.OK(t, cfg.SetAverageChunkSize(4*1024*1024))
+	minSize, maxSize, bits = cfg.ChunkerSizes()
+	rtest.Assert(t, minSize == 2*1024*1024 && maxSize == 32*1024*1024 && bits == 22,
+		"wrong chunker sizes %v %v %v", minSize, maxSize, bits)
+	rtest.Equals(t, uint64(4*1024*1024), cfg.AverageChunkSize())
+	// older versions must not access a repository with a custom chunk size
+	rtest.Equals(t, uint(restic.ChunkerSizesRepoVersion), cfg.Version)
+
+	var buf []byte
+	err = restic.SaveConfig(context.TODO(), saver{func(tpe restic.FileType, data []byte) (restic.ID, error) {
+		buf = data
+		return restic.ID{}, nil
+	}}, cfg)
+	rtest.OK(t, err)
+
+	cfg2, err := restic.LoadConfig(context.TODO(), loader{func(tpe restic.FileType, id restic.ID, in []byte) ([]byte, error) {
+		return buf, nil
+	}})
+	rtest.OK(t, err)
+	rtest.Equals(t, cfg, cfg2)
+
+	// the default size does not change the config
+	rtest.OK(t, cfg.SetAverageChunkSize(restic.DefaultAverageChunkSize))
+	rtest.Assert(t, cfg.ChunkerMinSize == 0 && cfg.ChunkerMaxSize == 0 && cfg.ChunkerAverageBits == 0,
+		"unexpected chunker sizes in config %#v", cfg)
+
+	v1, err := restic.CreateConfig(1)
+	rtest.OK(t, err)
+	rtest.Assert(t, v1.SetAverageChunkSize(4*1024*1024) != nil, "expected error for a custom chunk size with version 1")
+
+	// a config with chunk sizes but an older version is rejected
+	v2 := cfg2
+	v2.Version = 2
+	_, err = restic.LoadConfig(context.TODO(), loader{func(tpe restic.FileType, id restic.ID, in []byte) ([]byte, error) {
+		return json.Marshal(v2)
+	}})
+	rtest.Assert(t, err != nil, "expected error for chunker parameters in a version 2 config")
+}
@@ -17,6 +17,9 @@ const (
 	SnapshotFile
 	IndexFile
 	ConfigFile
+	AuditFile
+	SignatureFile
+	ManifestFile
 )
 
 func (t FileType) String() string {
@@ -35,6 +38,12 @@ func (t FileType) String() string {
 		s = "index"
 	case ConfigFile:
 		s = "config"
+	case AuditFile:
+		s = "audit"
+	case SignatureFile:
+		s = "signature"
+	case ManifestFile:
+		s = "manifest"
 	}
 	return s
 }
@@ -63,6 +72,9 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case AuditFile:
+	case SignatureFile:
+	case ManifestFile:
 	default:
 		return errors.Errorf("invalid Type %d", h.Type)
 	}
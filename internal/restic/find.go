@@ -23,10 +23,27 @@ type findBlobSet interface {
 // FindUsedBlobs traverses the tree ID and adds all seen blobs (trees and data
 // blobs) to the set blobs. Already seen tree blobs will not be visited again.
 func FindUsedBlobs(ctx context.Context, repo Loader, treeIDs IDs, blobs findBlobSet, p *progress.Counter) error {
+	return FindUsedBlobsWithOptions(ctx, repo, treeIDs, blobs, p, FindUsedBlobsOptions{})
+}
+
+// FindUsedBlobsOptions configures the traversal of FindUsedBlobsWithOptions.
+type FindUsedBlobsOptions struct {
+	// Workers is the number of trees which are loaded concurrently. If it is
+	// zero, the number depends on the connections of the repository and the
+	// number of CPUs.
+	Workers int
+	// TreeLoaded is called for each tree which was loaded. The calls are
+	// never concurrent.
+	TreeLoaded func()
+}
+
+// FindUsedBlobsWithOptions works like FindUsedBlobs. Trees which are shared
+// by several of the treeIDs are only loaded once.
+func FindUsedBlobsWithOptions(ctx context.Context, repo Loader, treeIDs IDs, blobs findBlobSet, p *progress.Counter, opts FindUsedBlobsOptions) error {
 	var lock sync.Mutex
 
 	wg, ctx := errgroup.WithContext(ctx)
-	treeStream := StreamTrees(ctx, wg, repo, treeIDs, func(treeID ID) bool {
+	treeStream := streamTrees(ctx, wg, repo, treeIDs, opts.Workers, func(treeID ID) bool {
 		// locking is necessary the goroutine below concurrently adds data blobs
 		lock.Lock()
 		h := BlobHandle{ID: treeID, Type: TreeBlob}
@@ -42,6 +59,9 @@ func FindUsedBlobs(ctx context.Context, repo Loader, treeIDs IDs, blobs findBlob
 			if tree.Error != nil {
 				return tree.Error
 			}
+			if opts.TreeLoaded != nil {
+				opts.TreeLoaded()
+			}
 
 			lock.Lock()
 			for _, node := range tree.Nodes {
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -162,6 +163,64 @@ func TestMultiFindUsedBlobs(t *testing.T) {
 	}
 }
 
+// countingLoader counts how often each blob is loaded.
+type countingLoader struct {
+	restic.Loader
+	m     sync.Mutex
+	loads map[restic.ID]int
+}
+
+func (l *countingLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	l.m.Lock()
+	l.loads[id]++
+	l.m.Unlock()
+	return l.Loader.LoadBlob(ctx, t, id, buf)
+}
+
+func TestFindUsedBlobsWithOptions(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	var snapshotTrees restic.IDs
+	for i := 0; i < findTestSnapshots; i++ {
+		sn := restic.TestCreateSnapshot(t, repo, findTestTime.Add(time.Duration(i)*time.Second), findTestDepth, 0)
+		snapshotTrees = append(snapshotTrees, *sn.Tree)
+	}
+	// the same snapshot twice shares all trees
+	snapshotTrees = append(snapshotTrees, snapshotTrees[0])
+
+	want := restic.NewBlobSet()
+	for i := 0; i < findTestSnapshots; i++ {
+		goldenFilename := filepath.Join("testdata", fmt.Sprintf("used_blobs_snapshot%d", i))
+		want.Merge(loadIDSet(t, goldenFilename))
+	}
+	wantTrees := 0
+	for bh := range want {
+		if bh.Type == restic.TreeBlob {
+			wantTrees++
+		}
+	}
+
+	for _, workers := range []int{1, 4} {
+		loader := &countingLoader{Loader: repo, loads: make(map[restic.ID]int)}
+		treesLoaded := 0
+		opts := restic.FindUsedBlobsOptions{
+			Workers:    workers,
+			TreeLoaded: func() { treesLoaded++ },
+		}
+
+		usedBlobs := restic.NewBlobSet()
+		test.OK(t, restic.FindUsedBlobsWithOptions(context.TODO(), loader, snapshotTrees, usedBlobs, nil, opts))
+		test.Assert(t, want.Equals(usedBlobs), "wrong list of blobs returned:\n  missing blobs: %v\n  extra blobs: %v",
+			want.Sub(usedBlobs), usedBlobs.Sub(want))
+
+		test.Equals(t, wantTrees, treesLoaded)
+		for id, n := range loader.loads {
+			test.Assert(t, n == 1, "tree %v was loaded %d times", id.Str(), n)
+		}
+	}
+}
+
 type ForbiddenRepo struct{}
 
 func (r ForbiddenRepo) LoadBlob(context.Context, restic.BlobType, restic.ID, []byte) ([]byte, error) {
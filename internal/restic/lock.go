@@ -23,11 +23,18 @@ import (
 // different non-exclusive locks, but at most one exclusive lock, which can
 // only be acquired while no non-exclusive lock is held.
 //
+// A lock can be restricted to a scope, e.g. the snapshots of a single host,
+// see HostLockScope. Locks with different scopes never conflict, while a lock
+// without a scope covers the whole repository and conflicts with the locks of
+// all scopes. Operations which modify structures shared by all hosts, like the
+// index, must therefore use locks without a scope.
+//
 // A lock must be refreshed regularly to not be considered stale, this must be
 // triggered by regularly calling Refresh.
 type Lock struct {
 	Time      time.Time `json:"time"`
 	Exclusive bool      `json:"exclusive"`
+	Scope     string    `json:"scope,omitempty"`
 	Hostname  string    `json:"hostname"`
 	Username  string    `json:"username"`
 	PID       int       `json:"pid"`
@@ -49,6 +56,9 @@ func (e *alreadyLockedError) Error() string {
 	if e.otherLock.Exclusive {
 		s = "exclusively "
 	}
+	if e.otherLock.Scope != "" {
+		s += fmt.Sprintf("for %v ", e.otherLock.Scope)
+	}
 	return fmt.Sprintf("repository is already locked %sby %v", s, e.otherLock)
 }
 
@@ -63,14 +73,33 @@ func IsAlreadyLocked(err error) bool {
 // exclusive lock is already held by another process, it returns an error
 // that satisfies IsAlreadyLocked.
 func NewLock(ctx context.Context, repo Repository) (*Lock, error) {
-	return newLock(ctx, repo, false)
+	return newLock(ctx, repo, "", false)
 }
 
 // NewExclusiveLock returns a new, exclusive lock for the repository. If
 // another lock (normal and exclusive) is already held by another process,
 // it returns an error that satisfies IsAlreadyLocked.
 func NewExclusiveLock(ctx context.Context, repo Repository) (*Lock, error) {
-	return newLock(ctx, repo, true)
+	return newLock(ctx, repo, "", true)
+}
+
+// NewScopedLock returns a new, non-exclusive lock for the given scope. It only
+// conflicts with exclusive locks for the same scope or for the whole
+// repository.
+func NewScopedLock(ctx context.Context, repo Repository, scope string) (*Lock, error) {
+	return newLock(ctx, repo, scope, false)
+}
+
+// NewScopedExclusiveLock returns a new, exclusive lock for the given scope. It
+// conflicts with all locks for the same scope or for the whole repository.
+func NewScopedExclusiveLock(ctx context.Context, repo Repository, scope string) (*Lock, error) {
+	return newLock(ctx, repo, scope, true)
+}
+
+// HostLockScope returns the lock scope for operations which only access the
+// snapshots of the given host.
+func HostLockScope(host string) string {
+	return "host " + host
 }
 
 var waitBeforeLockCheck = 200 * time.Millisecond
@@ -81,11 +110,12 @@ func TestSetLockTimeout(t testing.TB, d time.Duration) {
 	waitBeforeLockCheck = d
 }
 
-func newLock(ctx context.Context, repo Repository, excl bool) (*Lock, error) {
+func newLock(ctx context.Context, repo Repository, scope string, excl bool) (*Lock, error) {
 	lock := &Lock{
 		Time:      time.Now(),
 		PID:       os.Getpid(),
 		Exclusive: excl,
+		Scope:     scope,
 		repo:      repo,
 	}
 
@@ -130,12 +160,20 @@ func (l *Lock) fillUserInfo() error {
 	return err
 }
 
+// conflicts returns true if l and other cannot be held at the same time.
+func (l *Lock) conflicts(other *Lock) bool {
+	if !l.Exclusive && !other.Exclusive {
+		return false
+	}
+	return l.Scope == "" || other.Scope == "" || l.Scope == other.Scope
+}
+
 // checkForOtherLocks looks for other locks that currently exist in the repository.
 //
 // If an exclusive lock is to be created, checkForOtherLocks returns an error
-// if there are any other locks, regardless if exclusive or not. If a
-// non-exclusive lock is to be created, an error is only returned when an
-// exclusive lock is found.
+// if there are any other locks with an overlapping scope, regardless if
+// exclusive or not. If a non-exclusive lock is to be created, an error is
+// only returned when an exclusive lock with an overlapping scope is found.
 func (l *Lock) checkForOtherLocks(ctx context.Context) error {
 	var err error
 	// retry locking a few times
@@ -148,11 +186,7 @@ func (l *Lock) checkForOtherLocks(ctx context.Context) error {
 				return errors.Fatal(err.Error())
 			}
 
-			if l.Exclusive {
-				return &alreadyLockedError{otherLock: lock}
-			}
-
-			if !l.Exclusive && lock.Exclusive {
+			if l.conflicts(lock) {
 				return &alreadyLockedError{otherLock: lock}
 			}
 
@@ -247,6 +281,9 @@ func (l Lock) String() string {
 		l.PID, l.Hostname, l.Username, l.UID, l.GID,
 		l.Time.Format("2006-01-02 15:04:05"), time.Since(l.Time),
 		l.lockID.Str())
+	if l.Scope != "" {
+		text += fmt.Sprintf("\nlock scope %v", l.Scope)
+	}
 
 	return text
 }
@@ -300,6 +337,54 @@ func RemoveStaleLocks(ctx context.Context, repo Repository) (uint, error) {
 	return processed, err
 }
 
+// Expired returns true if the lock has not been refreshed for longer than age,
+// which must be at least StaleLockTimeout. As the owner of a lock stops working
+// once it cannot refresh the lock in time, the owner is either gone or
+// unreachable. Locks held by processes on the current host which are still
+// running never expire.
+func (l *Lock) Expired(age time.Duration) bool {
+	if age < StaleLockTimeout || time.Since(l.Time) <= age {
+		return false
+	}
+
+	hn, err := os.Hostname()
+	if err != nil {
+		debug.Log("unable to find current hostname: %v", err)
+		return false
+	}
+	if hn == l.Hostname && l.processExists() {
+		debug.Log("lock %v is old, but process %d is still running", l.lockID, l.PID)
+		return false
+	}
+	return true
+}
+
+// RemoveExpiredLocks deletes all locks from the repository which are expired
+// after age, see Lock.Expired. The callback fn is called for each removed
+// lock.
+func RemoveExpiredLocks(ctx context.Context, repo Repository, age time.Duration, fn func(*Lock)) (uint, error) {
+	var processed uint
+	err := ForAllLocks(ctx, repo, nil, func(id ID, lock *Lock, err error) error {
+		if err != nil {
+			// ignore locks that cannot be loaded
+			debug.Log("ignore lock %v: %v", id, err)
+			return nil
+		}
+
+		if !lock.Expired(age) {
+			return nil
+		}
+		err = repo.Backend().Remove(ctx, Handle{Type: LockFile, Name: id.String()})
+		if err != nil {
+			return err
+		}
+		processed++
+		fn(lock)
+		return nil
+	})
+	return processed, err
+}
+
 // RemoveAllLocks removes all locks forcefully.
 func RemoveAllLocks(ctx context.Context, repo Repository) (uint, error) {
 	var processed uint32
@@ -191,6 +191,54 @@ func TestLockStale(t *testing.T) {
 	}
 }
 
+func TestLockExpired(t *testing.T) {
+	hostname, err := os.Hostname()
+	rtest.OK(t, err)
+
+	var tests = []struct {
+		lock    restic.Lock
+		age     time.Duration
+		expired bool
+	}{
+		{restic.Lock{Time: time.Now().Add(-2 * time.Hour), Hostname: "other-" + hostname}, time.Hour, true},
+		{restic.Lock{Time: time.Now().Add(-2 * time.Hour), Hostname: "other-" + hostname}, 3 * time.Hour, false},
+		// the age must be above the stale lock timeout
+		{restic.Lock{Time: time.Now().Add(-2 * time.Hour), Hostname: "other-" + hostname}, time.Minute, false},
+		{restic.Lock{Time: time.Now().Add(-2 * time.Hour), Hostname: hostname, PID: os.Getpid()}, time.Hour, false},
+		{restic.Lock{Time: time.Now().Add(-2 * time.Hour), Hostname: hostname, PID: os.Getpid() + 500000}, time.Hour, true},
+		{restic.Lock{Time: time.Now().Add(-time.Minute), Hostname: hostname, PID: os.Getpid() + 500000}, time.Hour, false},
+	}
+
+	for i, test := range tests {
+		rtest.Assert(t, test.lock.Expired(test.age) == test.expired,
+			"test %d failed: expected expired: %v, got %v", i, test.expired, !test.expired)
+	}
+}
+
+func TestRemoveExpiredLocks(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	id1, err := createFakeLock(repo, time.Now().Add(-2*time.Hour), os.Getpid()+500000)
+	rtest.OK(t, err)
+	id2, err := createFakeLock(repo, time.Now().Add(-2*time.Hour), os.Getpid())
+	rtest.OK(t, err)
+	id3, err := createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid()+500000)
+	rtest.OK(t, err)
+
+	var removed []*restic.Lock
+	processed, err := restic.RemoveExpiredLocks(context.TODO(), repo, time.Hour, func(lock *restic.Lock) {
+		removed = append(removed, lock)
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), processed)
+	rtest.Equals(t, 1, len(removed))
+
+	rtest.Assert(t, !lockExists(repo, t, id1), "expired lock still exists")
+	rtest.Assert(t, lockExists(repo, t, id2), "lock of a running process was removed")
+	rtest.Assert(t, lockExists(repo, t, id3), "recent lock was removed")
+}
+
 func lockExists(repo restic.Repository, t testing.TB, id restic.ID) bool {
 	h := restic.Handle{Type: restic.LockFile, Name: id.String()}
 	exists, err := repo.Backend().Test(context.TODO(), h)
@@ -298,3 +346,76 @@ func TestLockRefresh(t *testing.T) {
 		"expected a later timestamp after lock refresh")
 	rtest.OK(t, lock.Unlock())
 }
+
+func TestScopedLocks(t *testing.T) {
+	hostA := restic.HostLockScope("a")
+	hostB := restic.HostLockScope("b")
+
+	var tests = []struct {
+		scope1, scope2 string
+		excl1, excl2   bool
+		conflict       bool
+	}{
+		{hostA, hostB, true, true, false},
+		{hostA, hostB, true, false, false},
+		{hostA, hostA, false, false, false},
+		{hostA, hostA, true, false, true},
+		{hostA, hostA, false, true, true},
+		{hostA, "", true, false, true},
+		{"", hostA, true, false, true},
+		{"", hostA, false, true, true},
+		{"", hostA, false, false, false},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			repo, cleanup := repository.TestRepository(t)
+			defer cleanup()
+
+			newLock := func(scope string, excl bool) (*restic.Lock, error) {
+				if excl {
+					return restic.NewScopedExclusiveLock(context.TODO(), repo, scope)
+				}
+				return restic.NewScopedLock(context.TODO(), repo, scope)
+			}
+
+			lock1, err := newLock(test.scope1, test.excl1)
+			rtest.OK(t, err)
+			lock2, err := newLock(test.scope2, test.excl2)
+			if test.conflict {
+				rtest.Assert(t, restic.IsAlreadyLocked(err), "expected lock conflict, got %v", err)
+			} else {
+				rtest.OK(t, err)
+			}
+
+			rtest.OK(t, lock2.Unlock())
+			rtest.OK(t, lock1.Unlock())
+		})
+	}
+}
+
+func TestRemoveStaleScopedLocks(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	hostname, err := os.Hostname()
+	rtest.OK(t, err)
+
+	stale := &restic.Lock{Time: time.Now().Add(-time.Minute), PID: os.Getpid() + 500000,
+		Hostname: hostname, Exclusive: true, Scope: restic.HostLockScope(hostname)}
+	id, err := restic.SaveJSONUnpacked(context.TODO(), repo, restic.LockFile, stale)
+	rtest.OK(t, err)
+
+	// the stale lock conflicts until it is removed
+	_, err = restic.NewScopedLock(context.TODO(), repo, stale.Scope)
+	rtest.Assert(t, restic.IsAlreadyLocked(err), "expected lock conflict, got %v", err)
+
+	processed, err := restic.RemoveStaleLocks(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), processed)
+	rtest.Assert(t, !lockExists(repo, t, id), "stale scoped lock still exists")
+
+	lock, err := restic.NewScopedLock(context.TODO(), repo, stale.Scope)
+	rtest.OK(t, err)
+	rtest.OK(t, lock.Unlock())
+}
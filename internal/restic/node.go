@@ -34,6 +34,7 @@ type Node struct {
 	ModTime            time.Time           `json:"mtime,omitempty"`
 	AccessTime         time.Time           `json:"atime,omitempty"`
 	ChangeTime         time.Time           `json:"ctime,omitempty"`
+	BirthTime          time.Time           `json:"-"` // only saved if set, see MarshalJSON
 	UID                uint32              `json:"uid"`
 	GID                uint32              `json:"gid"`
 	User               string              `json:"user,omitempty"`
@@ -42,6 +43,7 @@ type Node struct {
 	DeviceID           uint64              `json:"device_id,omitempty"` // device id of the file, stat.st_dev
 	Size               uint64              `json:"size,omitempty"`
 	Links              uint64              `json:"links,omitempty"`
+	Sparse             bool                `json:"sparse,omitempty"`
 	LinkTarget         string              `json:"linktarget,omitempty"`
 	ExtendedAttributes []ExtendedAttribute `json:"extended_attributes,omitempty"`
 	Device             uint64              `json:"device,omitempty"` // in case of Type == "dev", stat.st_rdev
@@ -103,6 +105,16 @@ func NodeFromFileInfo(path string, fi os.FileInfo) (*Node, error) {
 	return node, err
 }
 
+// BirthTime returns the time the item at path was created. ok is false if
+// the platform or the file system does not record it.
+func BirthTime(path string, fi os.FileInfo) (btime time.Time, ok bool) {
+	stat, ok := toStatT(fi.Sys())
+	if !ok {
+		return time.Time{}, false
+	}
+	return birthTime(path, stat)
+}
+
 func nodeTypeFromFileInfo(fi os.FileInfo) string {
 	switch fi.Mode() & (os.ModeType | os.ModeCharDevice) {
 	case 0:
@@ -211,6 +223,15 @@ func (node Node) restoreMetadata(path string) error {
 		}
 	}
 
+	if !node.BirthTime.IsZero() {
+		if err := node.restoreBirthTime(path); err != nil {
+			debug.Log("error restoring birth time for %v: %v", path, err)
+			if firsterr == nil {
+				firsterr = err
+			}
+		}
+	}
+
 	if err := node.restoreExtendedAttributes(path); err != nil {
 		debug.Log("error restoring extended attributes for %v: %v", path, err)
 		if firsterr != nil {
@@ -350,19 +371,37 @@ func (node Node) MarshalJSON() ([]byte, error) {
 	name := strconv.Quote(node.Name)
 	nj.Name = name[1 : len(name)-1]
 
-	return json.Marshal(nj)
+	// the birth time is omitted if it is not set, so that the serialization
+	// (and thus the ID of the tree) does not change for nodes without it.
+	var btime *time.Time
+	if !node.BirthTime.IsZero() {
+		t := FixTime(node.BirthTime)
+		btime = &t
+	}
+
+	return json.Marshal(struct {
+		nodeJSON
+		BirthTime *time.Time `json:"btime,omitempty"`
+	}{nj, btime})
 }
 
 func (node *Node) UnmarshalJSON(data []byte) error {
 	type nodeJSON Node
-	nj := (*nodeJSON)(node)
+	nj := struct {
+		*nodeJSON
+		BirthTime *time.Time `json:"btime"`
+	}{nodeJSON: (*nodeJSON)(node)}
 
-	err := json.Unmarshal(data, nj)
+	err := json.Unmarshal(data, &nj)
 	if err != nil {
 		return errors.Wrap(err, "Unmarshal")
 	}
 
-	nj.Name, err = strconv.Unquote(`"` + nj.Name + `"`)
+	if nj.BirthTime != nil {
+		node.BirthTime = *nj.BirthTime
+	}
+
+	node.Name, err = strconv.Unquote(`"` + node.Name + `"`)
 	return errors.Wrap(err, "Unquote")
 }
 
@@ -385,6 +424,9 @@ func (node Node) Equals(other Node) bool {
 	if !node.ChangeTime.Equal(other.ChangeTime) {
 		return false
 	}
+	if !node.BirthTime.Equal(other.BirthTime) {
+		return false
+	}
 	if node.UID != other.UID {
 		return false
 	}
@@ -409,6 +451,9 @@ func (node Node) Equals(other Node) bool {
 	if node.Links != other.Links {
 		return false
 	}
+	if node.Sparse != other.Sparse {
+		return false
+	}
 	if node.LinkTarget != other.LinkTarget {
 		return false
 	}
@@ -590,6 +635,7 @@ func (node *Node) fillExtra(path string, fi os.FileInfo) error {
 	case "file":
 		node.Size = uint64(stat.size())
 		node.Links = uint64(stat.nlink())
+		node.Sparse = stat.sparse()
 	case "dir":
 	case "symlink":
 		var err error
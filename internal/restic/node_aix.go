@@ -3,7 +3,10 @@
 
 package restic
 
-import "syscall"
+import (
+	"syscall"
+	"time"
+)
 
 func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespec) error {
 	return nil
@@ -20,6 +23,10 @@ func (s statT) atim() syscall.Timespec { return toTimespec(s.Atim) }
 func (s statT) mtim() syscall.Timespec { return toTimespec(s.Mtim) }
 func (s statT) ctim() syscall.Timespec { return toTimespec(s.Ctim) }
 
+// XattrSupported is false, extended attributes are not supported on this
+// platform.
+const XattrSupported = false
+
 // Getxattr is a no-op on AIX.
 func Getxattr(path, name string) ([]byte, error) {
 	return nil, nil
@@ -34,3 +41,8 @@ func Listxattr(path string) ([]string, error) {
 func Setxattr(path, name string, data []byte) error {
 	return nil
 }
+
+// birthTime is not supported on AIX.
+func birthTime(path string, stat *statT) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -1,6 +1,9 @@
 package restic
 
-import "syscall"
+import (
+	"syscall"
+	"time"
+)
 
 func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespec) error {
 	return nil
@@ -9,3 +12,7 @@ func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespe
 func (s statT) atim() syscall.Timespec { return s.Atimespec }
 func (s statT) mtim() syscall.Timespec { return s.Mtimespec }
 func (s statT) ctim() syscall.Timespec { return s.Ctimespec }
+
+func birthTime(path string, stat *statT) (time.Time, bool) {
+	return time.Unix(stat.Birthtimespec.Unix()), true
+}
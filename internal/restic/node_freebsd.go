@@ -3,7 +3,10 @@
 
 package restic
 
-import "syscall"
+import (
+	"syscall"
+	"time"
+)
 
 func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespec) error {
 	return nil
@@ -16,3 +19,7 @@ func mknod(path string, mode uint32, dev uint64) (err error) {
 func (s statT) atim() syscall.Timespec { return s.Atimespec }
 func (s statT) mtim() syscall.Timespec { return s.Mtimespec }
 func (s statT) ctim() syscall.Timespec { return s.Ctimespec }
+
+func birthTime(path string, stat *statT) (time.Time, bool) {
+	return time.Unix(stat.Birthtimespec.Unix()), true
+}
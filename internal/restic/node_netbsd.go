@@ -1,6 +1,9 @@
 package restic
 
-import "syscall"
+import (
+	"syscall"
+	"time"
+)
 
 func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespec) error {
 	return nil
@@ -10,6 +13,10 @@ func (s statT) atim() syscall.Timespec { return s.Atimespec }
 func (s statT) mtim() syscall.Timespec { return s.Mtimespec }
 func (s statT) ctim() syscall.Timespec { return s.Ctimespec }
 
+// XattrSupported is false, extended attributes are not supported on this
+// platform.
+const XattrSupported = false
+
 // Getxattr retrieves extended attribute data associated with path.
 func Getxattr(path, name string) ([]byte, error) {
 	return nil, nil
@@ -25,3 +32,7 @@ func Listxattr(path string) ([]string, error) {
 func Setxattr(path, name string, data []byte) error {
 	return nil
 }
+
+func birthTime(path string, stat *statT) (time.Time, bool) {
+	return time.Unix(stat.Birthtimespec.Unix()), true
+}
@@ -1,7 +1,9 @@
 package restic_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -296,3 +298,32 @@ func TestFixTime(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeMarshalBirthTime(t *testing.T) {
+	node := restic.Node{
+		Name:    "foo",
+		Type:    "file",
+		ModTime: parseTimeNano(t, "2005-05-14T21:07:03.111+02:00"),
+	}
+
+	// nodes without birth time are serialized like before
+	buf, err := json.Marshal(node)
+	rtest.OK(t, err)
+	rtest.Assert(t, !bytes.Contains(buf, []byte("btime")), "unexpected btime in %s", buf)
+
+	var res restic.Node
+	rtest.OK(t, json.Unmarshal(buf, &res))
+	rtest.Assert(t, res.BirthTime.IsZero(), "unexpected birth time %v", res.BirthTime)
+	rtest.Assert(t, node.Equals(res), "nodes differ: %v and %v", node, res)
+
+	node.BirthTime = parseTimeNano(t, "2004-03-02T01:02:03.456+02:00")
+	buf, err = json.Marshal(node)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Contains(buf, []byte(`"btime":"2004-03-02T01:02:03.456+02:00"`)), "btime missing in %s", buf)
+
+	res = restic.Node{}
+	rtest.OK(t, json.Unmarshal(buf, &res))
+	rtest.Assert(t, node.BirthTime.Equal(res.BirthTime), "wrong birth time %v", res.BirthTime)
+	rtest.Assert(t, node.Equals(res), "nodes differ: %v and %v", node, res)
+	rtest.Equals(t, "foo", res.Name)
+}
@@ -14,6 +14,11 @@ func lchown(name string, uid, gid int) error {
 
 type statT syscall.Stat_t
 
+// restoreBirthTime is a no-op, the birth time cannot be set on this platform.
+func (node Node) restoreBirthTime(path string) error {
+	return nil
+}
+
 func toStatT(i interface{}) (*statT, bool) {
 	s, ok := i.(*syscall.Stat_t)
 	if ok && s != nil {
@@ -29,3 +34,9 @@ func (s statT) uid() uint32   { return uint32(s.Uid) }
 func (s statT) gid() uint32   { return uint32(s.Gid) }
 func (s statT) rdev() uint64  { return uint64(s.Rdev) }
 func (s statT) size() int64   { return int64(s.Size) }
+
+// sparse returns true if at least one block of the file is not allocated. The
+// number of blocks is given in units of 512 bytes.
+func (s statT) sparse() bool {
+	return int64(s.Size)-int64(s.Blocks)*512 >= 4096
+}
@@ -4,11 +4,15 @@
 package restic
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/restic/restic/internal/test"
 )
 
 func stat(t testing.TB, filename string) (fi os.FileInfo, ok bool) {
@@ -136,3 +140,49 @@ func TestNodeFromFileInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeFromFileInfoSparse(t *testing.T) {
+	tempdir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	for _, sparse := range []bool{false, true} {
+		filename := filepath.Join(tempdir, fmt.Sprintf("file-%v", sparse))
+		f, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, 64*1024)
+		data[0] = 1
+		if sparse {
+			// only the first block is allocated
+			_, err = f.Write(data[:1])
+			if err == nil {
+				err = f.Truncate(int64(len(data)))
+			}
+		} else {
+			_, err = f.Write(data)
+		}
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Lstat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, ok := fi.Sys().(*syscall.Stat_t); sparse && ok && int64(s.Blocks)*512 >= fi.Size() {
+			t.Skip("file system does not support sparse files")
+		}
+
+		node, err := NodeFromFileInfo(filename, fi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node.Sparse != sparse {
+			t.Errorf("expected sparse %v for %v, got %v", sparse, filename, node.Sparse)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package restic
 
 import (
 	"syscall"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/windows"
 )
 
 // mknod is not supported on Windows.
@@ -20,6 +22,10 @@ func (node Node) restoreSymlinkTimestamps(path string, utimes [2]syscall.Timespe
 	return nil
 }
 
+// XattrSupported is false, extended attributes are not supported on this
+// platform.
+const XattrSupported = false
+
 // Getxattr retrieves extended attribute data associated with path.
 func Getxattr(path, name string) ([]byte, error) {
 	return nil, nil
@@ -57,6 +63,10 @@ func (s statT) size() int64 {
 	return int64(s.FileSizeLow) | (int64(s.FileSizeHigh) << 32)
 }
 
+func (s statT) sparse() bool {
+	return s.FileAttributes&windows.FILE_ATTRIBUTE_SPARSE_FILE != 0
+}
+
 func (s statT) atim() syscall.Timespec {
 	return syscall.NsecToTimespec(s.LastAccessTime.Nanoseconds())
 }
@@ -69,3 +79,30 @@ func (s statT) ctim() syscall.Timespec {
 	// Windows does not have the concept of a "change time" in the sense Unix uses it, so we're using the LastWriteTime here.
 	return syscall.NsecToTimespec(s.LastWriteTime.Nanoseconds())
 }
+
+func birthTime(path string, stat *statT) (time.Time, bool) {
+	return time.Unix(0, stat.CreationTime.Nanoseconds()), true
+}
+
+// restoreBirthTime sets the creation time of the file at path.
+func (node Node) restoreBirthTime(path string) error {
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return errors.Wrap(err, "UTF16PtrFromString")
+	}
+
+	h, err := syscall.CreateFile(pathp, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_WRITE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return errors.Wrap(err, "CreateFile")
+	}
+
+	ctime := syscall.NsecToFiletime(node.BirthTime.UnixNano())
+	err = syscall.SetFileTime(h, &ctime, nil, nil)
+	if err != nil {
+		_ = syscall.Close(h)
+		return errors.Wrap(err, "SetFileTime")
+	}
+
+	return errors.Wrap(syscall.Close(h), "Close")
+}
@@ -11,6 +11,10 @@ import (
 	"github.com/pkg/xattr"
 )
 
+// XattrSupported is true if extended attributes are supported on this
+// platform.
+const XattrSupported = true
+
 // Getxattr retrieves extended attribute data associated with path.
 func Getxattr(path, name string) ([]byte, error) {
 	b, err := xattr.Get(path, name)
@@ -0,0 +1,70 @@
+package restic
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Signature is a detached signature of a snapshot, produced by an external
+// signer. The signed payload is the JSON document of the snapshot as stored in
+// the repository. Signatures are stored as separate files of type
+// SignatureFile, so that snapshots without a signature remain valid.
+type Signature struct {
+	Snapshot  ID        `json:"snapshot"`
+	Time      time.Time `json:"time"`
+	Signature []byte    `json:"signature"`
+
+	id *ID
+}
+
+// NewSignature returns a signature for the snapshot with the given id.
+func NewSignature(snapshot ID, signature []byte, t time.Time) *Signature {
+	return &Signature{
+		Snapshot:  snapshot,
+		Time:      t,
+		Signature: signature,
+	}
+}
+
+// LoadSignature loads the signature with the id.
+func LoadSignature(ctx context.Context, loader LoaderUnpacked, id ID) (*Signature, error) {
+	sig := &Signature{id: &id}
+	err := LoadJSONUnpacked(ctx, loader, SignatureFile, id, sig)
+	if err != nil {
+		return nil, err
+	}
+
+	return sig, nil
+}
+
+// SaveSignature saves sig in the repository and returns its ID.
+func SaveSignature(ctx context.Context, repo SaverUnpacked, sig *Signature) (ID, error) {
+	return SaveJSONUnpacked(ctx, repo, SignatureFile, sig)
+}
+
+// ForAllSignatures reads all signatures in parallel and calls the given
+// function. It is guaranteed that the function is not run concurrently. If the
+// called function returns an error, this function is cancelled and also
+// returns this error.
+func ForAllSignatures(ctx context.Context, be Lister, loader LoaderUnpacked, fn func(ID, *Signature, error) error) error {
+	var m sync.Mutex
+
+	return ParallelList(ctx, be, SignatureFile, loader.Connections(), func(ctx context.Context, id ID, size int64) error {
+		sig, err := LoadSignature(ctx, loader, id)
+		m.Lock()
+		defer m.Unlock()
+		return fn(id, sig, err)
+	})
+}
+
+// ID returns the ID of the signature.
+func (sig Signature) ID() *ID {
+	return sig.id
+}
+
+func (sig Signature) String() string {
+	return fmt.Sprintf("<Signature %s of snapshot %s at %s>",
+		sig.id.Str(), sig.Snapshot.Str(), sig.Time)
+}
@@ -0,0 +1,36 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSignatures(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	snID := restic.NewRandomID()
+	sig := restic.NewSignature(snID, []byte("signature\x00data"), time.Unix(1600000000, 0).UTC())
+	id, err := restic.SaveSignature(context.TODO(), repo, sig)
+	rtest.OK(t, err)
+
+	var found []*restic.Signature
+	err = restic.ForAllSignatures(context.TODO(), repo.Backend(), repo, func(sigID restic.ID, sig *restic.Signature, err error) error {
+		rtest.OK(t, err)
+		rtest.Equals(t, id, sigID)
+		rtest.Equals(t, id, *sig.ID())
+		found = append(found, sig)
+		return nil
+	})
+	rtest.OK(t, err)
+
+	rtest.Equals(t, 1, len(found))
+	rtest.Equals(t, snID, found[0].Snapshot)
+	rtest.Equals(t, sig.Signature, found[0].Signature)
+	rtest.Assert(t, found[0].Time.Equal(sig.Time), "wrong time %v", found[0].Time)
+}
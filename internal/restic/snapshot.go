@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 )
 
 // Snapshot is the state of a resource at one point in time.
@@ -25,6 +27,11 @@ type Snapshot struct {
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
 
+	// Protected snapshots are never removed by forget.
+	Protected bool `json:"protected,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+
 	id *ID // plaintext ID, used during restore
 }
 
@@ -194,6 +201,42 @@ func (sn *Snapshot) HasTagList(l []TagList) bool {
 	return false
 }
 
+// HasMetadata returns true if the snapshot matches all filters in l. A filter
+// is either "key=value", which requires the metadata key to have the value, or
+// "key", which only requires the key to be present.
+func (sn *Snapshot) HasMetadata(l []string) bool {
+	for _, filter := range l {
+		kv := strings.SplitN(filter, "=", 2)
+		value, ok := sn.Metadata[kv[0]]
+		if !ok || (len(kv) == 2 && value != kv[1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseMetadata parses a list of "key=value" pairs. Keys must not be empty or
+// given more than once.
+func ParseMetadata(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	m := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("invalid metadata %q, must be key=value", pair)
+		}
+		if _, ok := m[kv[0]]; ok {
+			return nil, errors.Errorf("metadata key %q is given more than once", kv[0])
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
 // HasPaths returns true if the snapshot has all of the paths.
 func (sn *Snapshot) HasPaths(paths []string) bool {
 	m := make(map[string]struct{}, len(sn.Paths))
@@ -209,6 +252,41 @@ func (sn *Snapshot) HasPaths(paths []string) bool {
 	return true
 }
 
+// HasPathPrefix returns true if either
+// - a snapshot path is equal to or an ancestor of one of the given paths, or
+// - the list of given paths is empty
+//
+// Trailing slashes are ignored. A relative snapshot path only matches a
+// relative path, so callers should pass both forms of a relative path.
+func (sn *Snapshot) HasPathPrefix(paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+
+	for _, snPath := range sn.Paths {
+		snPath = filepath.Clean(snPath)
+		for _, p := range paths {
+			if pathHasAncestor(filepath.Clean(p), snPath) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// pathHasAncestor returns true if ancestor is equal to p or one of its parent
+// directories. Both paths must be cleaned.
+func pathHasAncestor(p, ancestor string) bool {
+	if p == ancestor {
+		return true
+	}
+	if !strings.HasSuffix(ancestor, string(filepath.Separator)) {
+		ancestor += string(filepath.Separator)
+	}
+	return strings.HasPrefix(p, ancestor)
+}
+
 // HasHostname returns true if either
 // - the snapshot hostname is in the list of the given hostnames, or
 // - the list of given hostnames is empty
@@ -16,8 +16,27 @@ type SnapshotGroupKey struct {
 	Tags     []string `json:"tags"`
 }
 
+// tagsWithPrefix returns the sorted list of tags which start with one of the
+// prefixes. The list is empty but not nil if there are no such tags.
+func tagsWithPrefix(tags []string, prefixes []string) []string {
+	res := []string{}
+	for _, tag := range tags {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(tag, prefix) {
+				res = append(res, tag)
+				break
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
 // GroupSnapshots takes a list of snapshots and a grouping criteria and creates
-// a group list of snapshots.
+// a group list of snapshots. The option "tag:prefix" groups the snapshots by
+// their tags which start with prefix only, for example "tag:project:" puts
+// all snapshots with the tag "project:a" in one group. Snapshots without such
+// a tag form a separate group.
 func GroupSnapshots(snapshots Snapshots, options string) (map[string]Snapshots, bool, error) {
 	// group by hostname and dirs
 	snapshotGroups := make(map[string]Snapshots)
@@ -25,6 +44,7 @@ func GroupSnapshots(snapshots Snapshots, options string) (map[string]Snapshots,
 	var GroupByTag bool
 	var GroupByHost bool
 	var GroupByPath bool
+	var tagPrefixes []string
 	GroupOptionList := strings.Split(options, ",")
 
 	for _, option := range GroupOptionList {
@@ -37,6 +57,10 @@ func GroupSnapshots(snapshots Snapshots, options string) (map[string]Snapshots,
 			GroupByTag = true
 		case "":
 		default:
+			if strings.HasPrefix(option, "tag:") && option != "tag:" {
+				tagPrefixes = append(tagPrefixes, strings.TrimPrefix(option, "tag:"))
+				continue
+			}
 			return nil, false, errors.Fatal("unknown grouping option: '" + option + "'")
 		}
 	}
@@ -50,6 +74,8 @@ func GroupSnapshots(snapshots Snapshots, options string) (map[string]Snapshots,
 		if GroupByTag {
 			tags = sn.Tags
 			sort.Strings(tags)
+		} else if len(tagPrefixes) > 0 {
+			tags = tagsWithPrefix(sn.Tags, tagPrefixes)
 		}
 		if GroupByHost {
 			hostname = sn.Hostname
@@ -70,5 +96,5 @@ func GroupSnapshots(snapshots Snapshots, options string) (map[string]Snapshots,
 		snapshotGroups[string(k)] = append(snapshotGroups[string(k)], sn)
 	}
 
-	return snapshotGroups, GroupByTag || GroupByHost || GroupByPath, nil
+	return snapshotGroups, GroupByTag || GroupByHost || GroupByPath || len(tagPrefixes) > 0, nil
 }
@@ -0,0 +1,79 @@
+package restic_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type groupCount struct {
+	key restic.SnapshotGroupKey
+	n   int
+}
+
+func TestGroupSnapshotsTagPrefix(t *testing.T) {
+	snapshots := restic.Snapshots{
+		{Hostname: "foo", Tags: []string{"project:a", "daily"}},
+		{Hostname: "foo", Tags: []string{"daily", "project:a"}},
+		{Hostname: "foo", Tags: []string{"project:b"}},
+		{Hostname: "bar", Tags: []string{"project:b", "env:prod"}},
+		{Hostname: "bar", Tags: []string{"weekly"}},
+	}
+
+	var tests = []struct {
+		groupBy string
+		groups  []groupCount
+	}{
+		{
+			groupBy: "tag:project:",
+			groups: []groupCount{
+				{restic.SnapshotGroupKey{Tags: []string{"project:a"}}, 2},
+				{restic.SnapshotGroupKey{Tags: []string{"project:b"}}, 2},
+				{restic.SnapshotGroupKey{Tags: []string{}}, 1},
+			},
+		},
+		{
+			groupBy: "host,tag:project:",
+			groups: []groupCount{
+				{restic.SnapshotGroupKey{Hostname: "foo", Tags: []string{"project:a"}}, 2},
+				{restic.SnapshotGroupKey{Hostname: "foo", Tags: []string{"project:b"}}, 1},
+				{restic.SnapshotGroupKey{Hostname: "bar", Tags: []string{"project:b"}}, 1},
+				{restic.SnapshotGroupKey{Hostname: "bar", Tags: []string{}}, 1},
+			},
+		},
+		{
+			groupBy: "tag:project:,tag:env:",
+			groups: []groupCount{
+				{restic.SnapshotGroupKey{Tags: []string{"project:a"}}, 2},
+				{restic.SnapshotGroupKey{Tags: []string{"project:b"}}, 1},
+				{restic.SnapshotGroupKey{Tags: []string{"env:prod", "project:b"}}, 1},
+				{restic.SnapshotGroupKey{Tags: []string{}}, 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		groups, grouped, err := restic.GroupSnapshots(snapshots, test.groupBy)
+		rtest.OK(t, err)
+		rtest.Assert(t, grouped, "snapshots are not grouped for %q", test.groupBy)
+
+		expected := make(map[string]int)
+		for _, group := range test.groups {
+			k, err := json.Marshal(group.key)
+			rtest.OK(t, err)
+			expected[string(k)] = group.n
+		}
+		got := make(map[string]int)
+		for k, list := range groups {
+			got[k] = len(list)
+		}
+		rtest.Equals(t, expected, got)
+	}
+
+	for _, groupBy := range []string{"tag:", "project"} {
+		_, _, err := restic.GroupSnapshots(snapshots, groupBy)
+		rtest.Assert(t, err != nil, "expected error for %q", groupBy)
+	}
+}
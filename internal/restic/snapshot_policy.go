@@ -175,6 +175,10 @@ type KeepReason struct {
 	// description text which criteria match, e.g. "daily", "monthly"
 	Matches []string `json:"matches"`
 
+	// the policy buckets which retained the snapshot, in the order of
+	// PolicyBuckets
+	Buckets []string `json:"buckets,omitempty"`
+
 	// the counters after evaluating the current snapshot
 	Counters struct {
 		Last    int `json:"last,omitempty"`
@@ -186,9 +190,18 @@ type KeepReason struct {
 	} `json:"counters"`
 }
 
+// PolicyBuckets lists the names of the buckets of an ExpirePolicy which can
+// retain a snapshot.
+var PolicyBuckets = []string{
+	"last", "hourly", "daily", "weekly", "monthly", "yearly",
+	"within", "within-hourly", "within-daily", "within-weekly", "within-monthly", "within-yearly",
+	"tags", "protected",
+}
+
 // ApplyPolicy returns the snapshots from list that are to be kept and removed
 // according to the policy p. list is sorted in the process. reasons contains
 // the reasons to keep each snapshot, it is in the same order as keep.
+// Protected snapshots are always kept.
 func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reasons []KeepReason) {
 	sort.Stable(list)
 
@@ -212,13 +225,14 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 		bucker func(d time.Time, nr int) int
 		Last   int
 		reason string
+		bucket string
 	}{
-		{p.Last, always, -1, "last snapshot"},
-		{p.Hourly, ymdh, -1, "hourly snapshot"},
-		{p.Daily, ymd, -1, "daily snapshot"},
-		{p.Weekly, yw, -1, "weekly snapshot"},
-		{p.Monthly, ym, -1, "monthly snapshot"},
-		{p.Yearly, y, -1, "yearly snapshot"},
+		{p.Last, always, -1, "last snapshot", "last"},
+		{p.Hourly, ymdh, -1, "hourly snapshot", "hourly"},
+		{p.Daily, ymd, -1, "daily snapshot", "daily"},
+		{p.Weekly, yw, -1, "weekly snapshot", "weekly"},
+		{p.Monthly, ym, -1, "monthly snapshot", "monthly"},
+		{p.Yearly, y, -1, "yearly snapshot", "yearly"},
 	}
 
 	// These buckets are for keeping snapshots of given type within duration
@@ -227,12 +241,13 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 		bucker func(d time.Time, nr int) int
 		Last   int
 		reason string
+		bucket string
 	}{
-		{p.WithinHourly, ymdh, -1, "hourly within"},
-		{p.WithinDaily, ymd, -1, "daily within"},
-		{p.WithinWeekly, yw, -1, "weekly within"},
-		{p.WithinMonthly, ym, -1, "monthly within"},
-		{p.WithinYearly, y, -1, "yearly within"},
+		{p.WithinHourly, ymdh, -1, "hourly within", "within-hourly"},
+		{p.WithinDaily, ymd, -1, "daily within", "within-daily"},
+		{p.WithinWeekly, yw, -1, "weekly within", "within-weekly"},
+		{p.WithinMonthly, ym, -1, "monthly within", "within-monthly"},
+		{p.WithinYearly, y, -1, "yearly within", "within-yearly"},
 	}
 
 	latest := findLatestTimestamp(list)
@@ -240,20 +255,31 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 	for nr, cur := range list {
 		var keepSnap bool
 		var keepSnapReasons []string
+		var keepSnapBuckets []string
+		var hasTags bool
 
 		// Tags are handled specially as they are not counted.
 		for _, l := range p.Tags {
 			if cur.HasTags(l) {
 				keepSnap = true
+				hasTags = true
 				keepSnapReasons = append(keepSnapReasons, fmt.Sprintf("has tags %v", l))
 			}
 		}
 
+		// Protected snapshots are always kept.
+		if cur.Protected {
+			keepSnap = true
+			keepSnapReasons = append(keepSnapReasons, "protected")
+		}
+
 		// If the timestamp of the snapshot is within the range, then keep it.
+		var within bool
 		if !p.Within.Zero() {
 			t := latest.AddDate(-p.Within.Years, -p.Within.Months, -p.Within.Days).Add(time.Hour * time.Duration(-p.Within.Hours))
 			if cur.Time.After(t) {
 				keepSnap = true
+				within = true
 				keepSnapReasons = append(keepSnapReasons, fmt.Sprintf("within %v", p.Within))
 			}
 		}
@@ -268,9 +294,13 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 					buckets[i].Last = val
 					buckets[i].Count--
 					keepSnapReasons = append(keepSnapReasons, b.reason)
+					keepSnapBuckets = append(keepSnapBuckets, b.bucket)
 				}
 			}
 		}
+		if within {
+			keepSnapBuckets = append(keepSnapBuckets, "within")
+		}
 
 		// If the timestamp is within range, and the snapshot is an hourly/daily/weekly/monthly/yearly snapshot, then keep it
 		for i, b := range bucketsWithin {
@@ -284,16 +314,24 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 						keepSnap = true
 						bucketsWithin[i].Last = val
 						keepSnapReasons = append(keepSnapReasons, fmt.Sprintf("%v %v", b.reason, b.Within))
+						keepSnapBuckets = append(keepSnapBuckets, b.bucket)
 					}
 				}
 			}
 		}
+		if hasTags {
+			keepSnapBuckets = append(keepSnapBuckets, "tags")
+		}
+		if cur.Protected {
+			keepSnapBuckets = append(keepSnapBuckets, "protected")
+		}
 
 		if keepSnap {
 			keep = append(keep, cur)
 			kr := KeepReason{
 				Snapshot: cur,
 				Matches:  keepSnapReasons,
+				Buckets:  keepSnapBuckets,
 			}
 			kr.Counters.Last = buckets[0].Count
 			kr.Counters.Hourly = buckets[1].Count
@@ -280,3 +280,32 @@ func TestApplyPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyPolicyProtected(t *testing.T) {
+	snapshots := restic.Snapshots{
+		{Time: parseTimeUTC("2014-09-01 10:20:30"), Protected: true},
+		{Time: parseTimeUTC("2014-09-02 10:20:30")},
+		{Time: parseTimeUTC("2014-09-03 10:20:30")},
+		{Time: parseTimeUTC("2014-09-04 10:20:30"), Protected: true},
+	}
+
+	keep, remove, reasons := restic.ApplyPolicy(snapshots, restic.ExpirePolicy{Last: 1})
+	if len(keep) != 2 || len(remove) != 2 {
+		t.Fatalf("wrong number of snapshots kept (%d) or removed (%d)", len(keep), len(remove))
+	}
+	for _, sn := range remove {
+		if sn.Protected {
+			t.Errorf("protected snapshot %v removed", sn.Time)
+		}
+	}
+
+	// the newest snapshot is the last snapshot as well
+	want := []string{"protected", "last snapshot"}
+	if !cmp.Equal(want, reasons[0].Matches) {
+		t.Error(cmp.Diff(want, reasons[0].Matches))
+	}
+	want = []string{"protected"}
+	if !cmp.Equal(want, reasons[1].Matches) {
+		t.Error(cmp.Diff(want, reasons[1].Matches))
+	}
+}
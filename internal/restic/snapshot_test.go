@@ -2,6 +2,7 @@ package restic_test
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -27,6 +28,86 @@ func TestTagList(t *testing.T) {
 	rtest.Assert(t, r, "Failed to match untagged snapshot")
 }
 
+func TestSnapshotHasPathPrefix(t *testing.T) {
+	sn := &restic.Snapshot{Paths: []string{
+		filepath.FromSlash("/home/user/work"),
+		filepath.FromSlash("/srv/"),
+		filepath.FromSlash("data/db"),
+	}}
+
+	var tests = []struct {
+		paths []string
+		match bool
+	}{
+		{nil, true},
+		{[]string{"/home/user/work"}, true},
+		{[]string{"/home/user/work/"}, true},
+		{[]string{"/home/user/work/project/main.go"}, true},
+		{[]string{"/home/user"}, false},
+		{[]string{"/home/user/workspace"}, false},
+		{[]string{"/srv"}, true},
+		{[]string{"/srv/www"}, true},
+		{[]string{"/data/db"}, false},
+		{[]string{"data/db/table"}, true},
+		{[]string{"/tmp", "/srv/www"}, true},
+		{[]string{"/tmp", "/var"}, false},
+	}
+
+	for _, test := range tests {
+		var paths []string
+		for _, p := range test.paths {
+			paths = append(paths, filepath.FromSlash(p))
+		}
+
+		rtest.Equals(t, test.match, sn.HasPathPrefix(paths))
+	}
+
+	root := &restic.Snapshot{Paths: []string{filepath.FromSlash("/")}}
+	rtest.Assert(t, root.HasPathPrefix([]string{filepath.FromSlash("/etc/hosts")}),
+		"root snapshot does not contain /etc/hosts")
+}
+
+func TestSnapshotHasMetadata(t *testing.T) {
+	sn := &restic.Snapshot{Metadata: map[string]string{"ticket": "OPS-17", "empty": ""}}
+
+	var tests = []struct {
+		filters []string
+		match   bool
+	}{
+		{nil, true},
+		{[]string{"ticket"}, true},
+		{[]string{"ticket=OPS-17"}, true},
+		{[]string{"ticket=OPS-18"}, false},
+		{[]string{"ticket="}, false},
+		{[]string{"empty="}, true},
+		{[]string{"empty", "ticket=OPS-17"}, true},
+		{[]string{"owner"}, false},
+		{[]string{"ticket", "owner"}, false},
+	}
+
+	for _, test := range tests {
+		rtest.Equals(t, test.match, sn.HasMetadata(test.filters))
+	}
+
+	rtest.Assert(t, !(&restic.Snapshot{}).HasMetadata([]string{"ticket"}),
+		"snapshot without metadata matches")
+}
+
+func TestParseMetadata(t *testing.T) {
+	m, err := restic.ParseMetadata([]string{"ticket=OPS-17", "note=a=b", "empty="})
+	rtest.OK(t, err)
+	rtest.Equals(t, map[string]string{"ticket": "OPS-17", "note": "a=b", "empty": ""}, m)
+
+	m, err = restic.ParseMetadata(nil)
+	rtest.OK(t, err)
+	rtest.Assert(t, m == nil, "expected nil map, got %v", m)
+
+	for _, pairs := range [][]string{{"ticket"}, {"=value"}, {"a=1", "a=2"}} {
+		_, err := restic.ParseMetadata(pairs)
+		rtest.Assert(t, err != nil, "expected error for %v", pairs)
+	}
+}
+
 func TestLoadJSONUnpacked(t *testing.T) {
 	repository.TestAllVersions(t, testLoadJSONUnpacked)
 }
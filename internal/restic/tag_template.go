@@ -0,0 +1,108 @@
+package restic
+
+import (
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// defaultTagDateFormat is used for the {date} placeholder without a layout.
+const defaultTagDateFormat = "2006-01-02"
+
+// ExpandTagTemplate replaces the placeholders in tag with the values of the
+// snapshot sn. The following placeholders are supported:
+//
+//	{host}         the hostname of the snapshot
+//	{user}         the username of the snapshot
+//	{path}         the path of the snapshot, only for a single path
+//	{date}         the time of the snapshot in the format 2006-01-02
+//	{date:layout}  the time of the snapshot formatted with the Go time layout
+//
+// Literal braces are written as {{ and }}. Unknown placeholders and unmatched
+// braces are an error.
+func ExpandTagTemplate(tag string, sn *Snapshot) (string, error) {
+	var res strings.Builder
+
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		switch {
+		case c == '{' && i+1 < len(tag) && tag[i+1] == '{':
+			res.WriteByte('{')
+			i++
+		case c == '}' && i+1 < len(tag) && tag[i+1] == '}':
+			res.WriteByte('}')
+			i++
+		case c == '}':
+			return "", errors.Errorf("invalid tag %q: unmatched '}', use '}}' for a literal brace", tag)
+		case c == '{':
+			end := strings.IndexByte(tag[i:], '}')
+			if end < 0 {
+				return "", errors.Errorf("invalid tag %q: unmatched '{', use '{{' for a literal brace", tag)
+			}
+
+			value, err := expandTagPlaceholder(tag[i+1:i+end], sn)
+			if err != nil {
+				return "", errors.Errorf("invalid tag %q: %v", tag, err)
+			}
+			res.WriteString(value)
+			i += end
+		default:
+			res.WriteByte(c)
+		}
+	}
+
+	return res.String(), nil
+}
+
+func expandTagPlaceholder(name string, sn *Snapshot) (string, error) {
+	var layout string
+	if strings.HasPrefix(name, "date:") {
+		name, layout = "date", name[len("date:"):]
+		if layout == "" {
+			return "", errors.New("empty layout for placeholder {date:}")
+		}
+	}
+
+	switch name {
+	case "host":
+		return sn.Hostname, nil
+	case "user":
+		return sn.Username, nil
+	case "path":
+		// tags are separated by commas on the command line, a path containing
+		// them could neither be matched with --tag nor set with tag --set
+		if len(sn.Paths) != 1 {
+			return "", errors.Errorf("placeholder {path} requires exactly one path, the snapshot has %d", len(sn.Paths))
+		}
+		if strings.Contains(sn.Paths[0], ",") {
+			return "", errors.Errorf("placeholder {path} cannot be used for path %q, which contains a comma", sn.Paths[0])
+		}
+		return sn.Paths[0], nil
+	case "date":
+		if layout == "" {
+			layout = defaultTagDateFormat
+		}
+		return sn.Time.Format(layout), nil
+	}
+
+	return "", errors.Errorf("unknown placeholder {%s}", name)
+}
+
+// ExpandTagTemplates replaces the placeholders in all tags of the snapshot,
+// see ExpandTagTemplate.
+func (sn *Snapshot) ExpandTagTemplates() error {
+	if len(sn.Tags) == 0 {
+		return nil
+	}
+
+	tags := make([]string, 0, len(sn.Tags))
+	for _, tag := range sn.Tags {
+		expanded, err := ExpandTagTemplate(tag, sn)
+		if err != nil {
+			return err
+		}
+		tags = append(tags, expanded)
+	}
+	sn.Tags = tags
+	return nil
+}
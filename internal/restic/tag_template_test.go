@@ -0,0 +1,100 @@
+package restic
+
+import (
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestExpandTagTemplate(t *testing.T) {
+	sn := &Snapshot{
+		Hostname: "kasimir",
+		Username: "fred",
+		Paths:    []string{"/home/fred"},
+		Time:     time.Date(2021, 3, 7, 14, 5, 9, 0, time.UTC),
+	}
+
+	var tests = []struct {
+		tag  string
+		want string
+	}{
+		{"foo", "foo"},
+		{"", ""},
+		{"host-{host}", "host-kasimir"},
+		{"{user}@{host}", "fred@kasimir"},
+		{"{path}", "/home/fred"},
+		{"{date}", "2021-03-07"},
+		{"host-{host}-{date:2006-01-02}", "host-kasimir-2021-03-07"},
+		{"{date:15:04:05}", "14:05:09"},
+		{"{{host}}", "{host}"},
+		{"{{{host}}}", "{kasimir}"},
+		{"a}}b{{c", "a}b{c"},
+		{"{{}}", "{}"},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			res, err := ExpandTagTemplate(test.tag, sn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res != test.want {
+				t.Errorf("wrong expansion for %q, want %q, got %q", test.tag, test.want, res)
+			}
+		})
+	}
+}
+
+func TestExpandTagTemplateInvalid(t *testing.T) {
+	sn := &Snapshot{Hostname: "kasimir"}
+
+	var tests = []string{
+		"{hostname}",
+		"{}",
+		"{host",
+		"host}",
+		"{date:}",
+		"foo{{host}",
+		"{host}}",
+	}
+
+	for _, tag := range tests {
+		t.Run("", func(t *testing.T) {
+			res, err := ExpandTagTemplate(tag, sn)
+			if err == nil {
+				t.Fatalf("expected error for %q, got %q", tag, res)
+			}
+		})
+	}
+}
+
+func TestExpandTagTemplatePath(t *testing.T) {
+	for _, paths := range [][]string{
+		nil,
+		{"/home/fred", "/etc"},
+		{"/home/fred,wilma"},
+	} {
+		sn := &Snapshot{Paths: paths}
+		res, err := ExpandTagTemplate("{path}", sn)
+		if err == nil {
+			t.Errorf("expected error for paths %q, got %q", paths, res)
+		}
+	}
+}
+
+func TestSnapshotExpandTagTemplates(t *testing.T) {
+	sn := &Snapshot{
+		Hostname: "kasimir",
+		Tags:     []string{"foo", "host-{host}"},
+	}
+
+	orig := sn.Tags
+	rtest.OK(t, sn.ExpandTagTemplates())
+	rtest.Equals(t, []string{"foo", "host-kasimir"}, sn.Tags)
+	rtest.Equals(t, []string{"foo", "host-{host}"}, orig)
+
+	sn.Tags = []string{"{foo}"}
+	rtest.Assert(t, sn.ExpandTagTemplates() != nil, "expected error for unknown placeholder")
+}
@@ -155,6 +155,13 @@ func filterTrees(ctx context.Context, repo Loader, trees IDs, loaderChan chan<-
 // goroutines, either read all items from the channel or cancel the context. Then `Wait()`
 // on the errgroup until all goroutines were stopped.
 func StreamTrees(ctx context.Context, wg *errgroup.Group, repo Loader, trees IDs, skip func(tree ID) bool, p *progress.Counter) <-chan TreeItem {
+	return streamTrees(ctx, wg, repo, trees, 0, skip, p)
+}
+
+// streamTrees works like StreamTrees, the trees are loaded by the given number
+// of workers plus one for huge trees. If workers is zero, the number depends
+// on the connections of repo and the number of CPUs.
+func streamTrees(ctx context.Context, wg *errgroup.Group, repo Loader, trees IDs, workers int, skip func(tree ID) bool, p *progress.Counter) <-chan TreeItem {
 	loaderChan := make(chan trackedID)
 	hugeTreeChan := make(chan trackedID, 10)
 	loadedTreeChan := make(chan trackedTreeItem)
@@ -164,7 +171,10 @@ func StreamTrees(ctx context.Context, wg *errgroup.Group, repo Loader, trees IDs
 
 	// decoding a tree can take quite some time such that this can be both CPU- or IO-bound
 	// one extra worker to handle huge tree blobs
-	workerCount := int(repo.Connections()) + runtime.GOMAXPROCS(0) + 1
+	if workers <= 0 {
+		workers = int(repo.Connections()) + runtime.GOMAXPROCS(0)
+	}
+	workerCount := workers + 1
 	for i := 0; i < workerCount; i++ {
 		workerLoaderChan := loaderChan
 		if i == 0 {
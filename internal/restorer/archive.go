@@ -0,0 +1,83 @@
+package restorer
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/dump"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// RestoreToArchive writes the files, directories and symlinks in the snapshot
+// which are selected by res.SelectFilter to w as an archive in the given format,
+// "tar" or "zip". Other types of items cannot be stored in the archive and are
+// skipped.
+func (res *Restorer) RestoreToArchive(ctx context.Context, format string, w io.Writer) error {
+	switch format {
+	case "tar", "zip":
+	default:
+		return errors.Errorf("unknown archive format %q", format)
+	}
+
+	d := dump.New(format, res.repo, w)
+	d.WriteProgress = func(node *restic.Node, bytes uint64) {
+		res.progress.AddProgress(node.Path, bytes, node.Size)
+	}
+
+	wg, ctx := errgroup.WithContext(ctx)
+	// ch is buffered to deal with variable download/write speeds
+	ch := make(chan *restic.Node, 10)
+
+	send := func(node *restic.Node, location string) error {
+		node.Path = filepath.ToSlash(location)
+		select {
+		case ch <- node:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	wg.Go(func() error {
+		defer close(ch)
+
+		_, err := res.traverseTree(ctx, string(filepath.Separator), string(filepath.Separator), *res.sn.Tree, treeVisitor{
+			enterDir: func(node *restic.Node, target, location string) error {
+				return send(node, location)
+			},
+
+			visitNode: func(node *restic.Node, target, location string) error {
+				switch node.Type {
+				case "file":
+					res.progress.AddFile(node.Size)
+					if node.Size == 0 {
+						res.progress.AddProgress(filepath.ToSlash(location), 0, 0)
+					}
+				case "symlink":
+				default:
+					debug.Log("skipping %v of type %v", location, node.Type)
+					return nil
+				}
+				return send(node, location)
+			},
+
+			filterNode: func(node *restic.Node, location string) {
+				if node.Type == "file" {
+					res.progress.AddFilteredFile(node.Size)
+				}
+			},
+		})
+		return err
+	})
+
+	wg.Go(func() error {
+		return d.DumpNodes(ctx, ch)
+	})
+
+	return wg.Wait()
+}
@@ -0,0 +1,99 @@
+package restorer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestoreToArchive(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	longName := strings.Repeat("x", 150)
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n", Mode: 0600, ModTime: mtime},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					longName:   File{Data: "content: long\n"},
+					"empty":    File{},
+					"excluded": File{Data: "content: excluded\n"},
+				},
+				Mode: 0750,
+			},
+		},
+	})
+
+	expected := map[string]string{
+		"foo":             "content: foo\n",
+		"dir/":            "",
+		"dir/" + longName: "content: long\n",
+		"dir/empty":       "",
+	}
+
+	for _, format := range []string{"tar", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			res := NewRestorer(context.TODO(), repo, sn, false, nil)
+			res.SelectFilter = func(item string, dstpath string, node *restic.Node) (bool, bool) {
+				return !strings.HasSuffix(item, "excluded"), true
+			}
+
+			buf := bytes.NewBuffer(nil)
+			rtest.OK(t, res.RestoreToArchive(context.TODO(), format, buf))
+
+			files := make(map[string]string)
+			switch format {
+			case "tar":
+				rd := tar.NewReader(buf)
+				for {
+					hdr, err := rd.Next()
+					if err == io.EOF {
+						break
+					}
+					rtest.OK(t, err)
+					data, err := ioutil.ReadAll(rd)
+					rtest.OK(t, err)
+					files[hdr.Name] = string(data)
+
+					switch hdr.Name {
+					case "foo":
+						rtest.Equals(t, int64(0600), hdr.Mode)
+						rtest.Assert(t, hdr.ModTime.Equal(mtime), "wrong mtime %v", hdr.ModTime)
+					case "dir/":
+						rtest.Equals(t, byte(tar.TypeDir), hdr.Typeflag)
+						rtest.Equals(t, int64(0750), hdr.Mode)
+					}
+				}
+			case "zip":
+				rd, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+				rtest.OK(t, err)
+				for _, f := range rd.File {
+					r, err := f.Open()
+					rtest.OK(t, err)
+					data, err := ioutil.ReadAll(r)
+					rtest.OK(t, err)
+					rtest.OK(t, r.Close())
+					files[f.Name] = string(data)
+				}
+			}
+
+			rtest.Equals(t, expected, files)
+		})
+	}
+
+	res := NewRestorer(context.TODO(), repo, sn, false, nil)
+	err := res.RestoreToArchive(context.TODO(), "rar", ioutil.Discard)
+	rtest.Assert(t, err != nil, "expected error for an unknown format")
+}
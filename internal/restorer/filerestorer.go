@@ -4,6 +4,7 @@ import (
 	"context"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/sync/errgroup"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	restoreui "github.com/restic/restic/internal/ui/restore"
 )
 
 // TODO if a blob is corrupt, there may be good blob copies in other packs
@@ -31,6 +33,7 @@ type fileInfo struct {
 	size       int64
 	location   string      // file on local filesystem relative to restorer basedir
 	blobs      interface{} // blobs of the file
+	written    int64       // number of bytes written, accessed atomically
 }
 
 type fileBlobInfo struct {
@@ -58,6 +61,11 @@ type fileRestorer struct {
 	dst   string
 	files []*fileInfo
 	Error func(string, error) error
+	// fileComplete, if set, is called once all content of the file at
+	// location has been written. It may be called concurrently.
+	fileComplete func(location string)
+
+	progress *restoreui.Progress
 }
 
 func newFileRestorer(dst string,
@@ -65,7 +73,8 @@ func newFileRestorer(dst string,
 	key *crypto.Key,
 	idx func(restic.BlobHandle) []restic.PackedBlob,
 	connections uint,
-	sparse bool) *fileRestorer {
+	sparse bool,
+	progress *restoreui.Progress) *fileRestorer {
 
 	// as packs are streamed the concurrency is limited by IO
 	workerCount := int(connections)
@@ -80,11 +89,14 @@ func newFileRestorer(dst string,
 		workerCount: workerCount,
 		dst:         dst,
 		Error:       restorerAbortOnAllErrors,
+		progress:    progress,
 	}
 }
 
-func (r *fileRestorer) addFile(location string, content restic.IDs, size int64) {
-	r.files = append(r.files, &fileInfo{location: location, blobs: content, size: size})
+// addFile adds a file to restore. If sparse is set, the file is restored as a
+// sparse file even if sparse files are not enabled for the restorer.
+func (r *fileRestorer) addFile(location string, content restic.IDs, size int64, sparse bool) {
+	r.files = append(r.files, &fileInfo{location: location, blobs: content, size: size, sparse: sparse})
 }
 
 func (r *fileRestorer) targetPath(location string) string {
@@ -139,14 +151,14 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 				packOrder = append(packOrder, packID)
 			}
 			pack.files[file] = struct{}{}
-			if blob.ID.Equal(r.zeroChunk) {
-				file.sparse = r.sparse
+			if blob.ID.Equal(r.zeroChunk) && r.sparse {
+				file.sparse = true
 			}
 		})
-		if len(fileBlobs) == 1 {
+		if len(fileBlobs) == 1 && r.sparse {
 			// no need to preallocate files with a single block, thus we can always consider them to be sparse
 			// in addition, a short chunk will never match r.zeroChunk which would prevent sparseness for short files
-			file.sparse = r.sparse
+			file.sparse = true
 		}
 
 		if err != nil {
@@ -188,7 +200,9 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 		return nil
 	})
 
-	return wg.Wait()
+	err := wg.Wait()
+	r.progress.AddSparseBytes(atomic.LoadUint64(&r.filesWriter.holes))
+	return err
 }
 
 func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
@@ -268,7 +282,14 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 						file.inProgress = true
 						createSize = file.size
 					}
-					return r.filesWriter.writeToFile(r.targetPath(file.location), blobData, offset, createSize, file.sparse)
+					err := r.filesWriter.writeToFile(r.targetPath(file.location), blobData, offset, createSize, file.sparse)
+					if err == nil {
+						r.progress.AddProgress(file.location, uint64(len(blobData)), uint64(file.size))
+						if atomic.AddInt64(&file.written, int64(len(blobData))) == file.size && r.fileComplete != nil {
+							r.fileComplete(file.location)
+						}
+					}
+					return err
 				}
 				err := sanitizeError(file, writeToFile())
 				if err != nil {
@@ -14,6 +14,10 @@ import (
 // TODO I am not 100% convinced this is necessary, i.e. it may be okay
 // to use multiple os.File to write to the same target file
 type filesWriter struct {
+	// holes is the number of bytes which were not written as they only
+	// contain zeros, it is accessed atomically
+	holes uint64
+
 	buckets []filesWriterBucket
 }
 
@@ -26,6 +30,7 @@ type partialFile struct {
 	*os.File
 	users  int // Reference count.
 	sparse bool
+	holes  *uint64
 }
 
 func newFilesWriter(count int) *filesWriter {
@@ -62,7 +67,7 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 			return nil, err
 		}
 
-		wr := &partialFile{File: f, users: 1, sparse: sparse}
+		wr := &partialFile{File: f, users: 1, sparse: sparse, holes: &w.holes}
 		bucket.files[path] = wr
 
 		if createSize >= 0 {
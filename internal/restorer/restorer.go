@@ -2,6 +2,9 @@ package restorer
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
 	"os"
 	"path/filepath"
 	"sync/atomic"
@@ -10,15 +13,33 @@ import (
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
+	restoreui "github.com/restic/restic/internal/ui/restore"
 
 	"golang.org/x/sync/errgroup"
 )
 
 // Restorer is used to restore a snapshot to a directory.
 type Restorer struct {
-	repo   restic.Repository
-	sn     *restic.Snapshot
-	sparse bool
+	repo     restic.Repository
+	sn       *restic.Snapshot
+	sparse   bool
+	progress *restoreui.Progress
+
+	// SkipUnchanged prevents rewriting existing regular files in the target
+	// which already have the content of the file in the snapshot. Their
+	// metadata is restored nevertheless.
+	SkipUnchanged bool
+
+	// Resume, if set, records the files which have been restored completely.
+	// Files recorded by a previous restore are not restored again unless
+	// they have been modified since.
+	Resume *ResumeState
+
+	// VerifiedFile, if set, is called by VerifyFiles for each file which has
+	// been verified successfully, with the location of the file within the
+	// snapshot and the SHA-256 hash of its contents. It may be called
+	// concurrently.
+	VerifiedFile func(location string, hash restic.ID)
 
 	Error        func(location string, err error) error
 	SelectFilter func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool)
@@ -26,11 +47,13 @@ type Restorer struct {
 
 var restorerAbortOnAllErrors = func(location string, err error) error { return err }
 
-// NewRestorer creates a restorer preloaded with the content from the snapshot id.
-func NewRestorer(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, sparse bool) *Restorer {
+// NewRestorer creates a restorer preloaded with the content from the snapshot
+// id. If progress is not nil, it is updated while files are restored.
+func NewRestorer(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, sparse bool, progress *restoreui.Progress) *Restorer {
 	r := &Restorer{
 		repo:         repo,
 		sparse:       sparse,
+		progress:     progress,
 		Error:        restorerAbortOnAllErrors,
 		SelectFilter: func(string, string, *restic.Node) (bool, bool) { return true, true },
 		sn:           sn,
@@ -43,6 +66,9 @@ type treeVisitor struct {
 	enterDir  func(node *restic.Node, target, location string) error
 	visitNode func(node *restic.Node, target, location string) error
 	leaveDir  func(node *restic.Node, target, location string) error
+	// filterNode is called for files and other non-directory nodes which are
+	// not selected by SelectFilter, it may be nil
+	filterNode func(node *restic.Node, location string)
 }
 
 // traverseTree traverses a tree from the repo and calls treeVisitor.
@@ -149,6 +175,8 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 			if err != nil {
 				return hasRestored, err
 			}
+		} else if visitor.filterNode != nil {
+			visitor.filterNode(node, nodeLocation)
 		}
 	}
 
@@ -215,8 +243,14 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	}
 
 	idx := NewHardlinkIndex()
-	filerestorer := newFileRestorer(dst, res.repo.Backend().Load, res.repo.Key(), res.repo.Index().Lookup, res.repo.Connections(), res.sparse)
+	var buf []byte
+	filerestorer := newFileRestorer(dst, res.repo.Backend().Load, res.repo.Key(), res.repo.Index().Lookup, res.repo.Connections(), res.sparse, res.progress)
 	filerestorer.Error = res.Error
+	if res.Resume != nil {
+		filerestorer.fileComplete = func(location string) {
+			res.Resume.add(location, filerestorer.targetPath(location))
+		}
+	}
 
 	debug.Log("first pass for %q", dst)
 
@@ -243,20 +277,44 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 			}
 
 			if node.Size == 0 {
+				res.progress.AddFile(0)
 				return nil // deal with empty files later
 			}
 
 			if node.Links > 1 {
 				if idx.Has(node.Inode, node.DeviceID) {
+					// the hardlink is created in the second pass
+					res.progress.AddFile(0)
 					return nil
 				}
 				idx.Add(node.Inode, node.DeviceID, location)
 			}
 
-			filerestorer.addFile(location, node.Content, int64(node.Size))
+			res.progress.AddFile(node.Size)
+			if res.Resume != nil && res.Resume.restored(location, target, node) {
+				debug.Log("first pass, visitNode: %q has been restored before", location)
+				res.progress.AddResumedFile(node.Size)
+				return nil
+			}
+			if res.SkipUnchanged {
+				var unchanged bool
+				buf, unchanged = res.fileUnchanged(target, node, buf)
+				if unchanged {
+					debug.Log("first pass, visitNode: %q is unchanged", location)
+					res.progress.AddSkippedFile(node.Size)
+					return nil
+				}
+			}
+			filerestorer.addFile(location, node.Content, int64(node.Size), node.Sparse)
 
 			return nil
 		},
+
+		filterNode: func(node *restic.Node, location string) {
+			if node.Type == "file" {
+				res.progress.AddFilteredFile(node.Size)
+			}
+		},
 	})
 	if err != nil {
 		return err
@@ -282,11 +340,19 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 				if node.Links > 1 {
 					idx.Add(node.Inode, node.DeviceID, location)
 				}
-				return res.restoreEmptyFileAt(node, target, location)
+				err := res.restoreEmptyFileAt(node, target, location)
+				if err == nil {
+					res.progress.AddProgress(location, 0, 0)
+				}
+				return err
 			}
 
 			if idx.Has(node.Inode, node.DeviceID) && idx.GetFilename(node.Inode, node.DeviceID) != location {
-				return res.restoreHardlinkAt(node, filerestorer.targetPath(idx.GetFilename(node.Inode, node.DeviceID)), target, location)
+				err := res.restoreHardlinkAt(node, filerestorer.targetPath(idx.GetFilename(node.Inode, node.DeviceID)), target, location)
+				if err == nil {
+					res.progress.AddProgress(location, 0, 0)
+				}
+				return err
 			}
 
 			return res.restoreNodeMetadataTo(node, target, location)
@@ -296,6 +362,23 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	return err
 }
 
+// fileUnchanged returns true if target is a regular file which has the content
+// of node. Files which only partially match are restored completely, holes in
+// sparse files are compared as zeros. Like verifyFile, it uses buf as scratch
+// space and returns it for reuse.
+func (res *Restorer) fileUnchanged(target string, node *restic.Node, buf []byte) ([]byte, bool) {
+	fi, err := fs.Lstat(target)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != int64(node.Size) {
+		return buf, false
+	}
+
+	buf, err = verifyFile(res.repo, target, node, buf, nil)
+	if err != nil {
+		debug.Log("%v does not match: %v", target, err)
+	}
+	return buf, err == nil
+}
+
 // Snapshot returns the snapshot this restorer is configured to use.
 func (res *Restorer) Snapshot() *restic.Snapshot {
 	return res.sn
@@ -305,13 +388,14 @@ func (res *Restorer) Snapshot() *restic.Snapshot {
 const nVerifyWorkers = 8
 
 // VerifyFiles checks whether all regular files in the snapshot res.sn
-// have been successfully written to dst. It stops when it encounters an
-// error. It returns that error and the number of files it has successfully
-// verified.
+// have been successfully written to dst. Failed verifications are passed to
+// res.Error, it stops if res.Error returns an error. It returns that error and
+// the number of files it has successfully verified.
 func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 	type mustCheck struct {
-		node *restic.Node
-		path string
+		node     *restic.Node
+		path     string
+		location string
 	}
 
 	var (
@@ -333,7 +417,7 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
-				case work <- mustCheck{node, target}:
+				case work <- mustCheck{node, target, location}:
 					return nil
 				}
 			},
@@ -344,15 +428,27 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 	for i := 0; i < nVerifyWorkers; i++ {
 		g.Go(func() (err error) {
 			var buf []byte
+			var h hash.Hash
+			if res.VerifiedFile != nil {
+				h = sha256.New()
+			}
 			for job := range work {
-				buf, err = res.verifyFile(job.path, job.node, buf)
-				if err != nil {
+				if h != nil {
+					h.Reset()
+				}
+				buf, err = verifyFile(res.repo, job.path, job.node, buf, h)
+				if err == nil {
+					atomic.AddUint64(&nchecked, 1)
+					res.progress.AddVerifiedFile(job.node.Size)
+					if h != nil {
+						res.VerifiedFile(job.location, restic.IDFromHash(h.Sum(nil)))
+					}
+				} else {
 					err = res.Error(job.path, err)
 				}
 				if err != nil || ctx.Err() != nil {
 					break
 				}
-				atomic.AddUint64(&nchecked, 1)
 			}
 			return err
 		})
@@ -361,12 +457,32 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 	return int(nchecked), g.Wait()
 }
 
-// Verify that the file target has the contents of node.
+// ContentMismatchError is returned when the contents of a file differ from
+// the contents of the node in the snapshot.
+type ContentMismatchError struct {
+	Path   string
+	Offset int64
+}
+
+func (e *ContentMismatchError) Error() string {
+	return fmt.Sprintf("Unexpected content in %s, starting at offset %d", e.Path, e.Offset)
+}
+
+// VerifyFile checks that the file target has the contents of node by
+// comparing the hashes of its chunks with the blobs of node. It returns a
+// *ContentMismatchError if the contents differ. buf is scratch space like for
+// verifyFile.
+func VerifyFile(repo restic.Repository, target string, node *restic.Node, buf []byte) ([]byte, error) {
+	return verifyFile(repo, target, node, buf, nil)
+}
+
+// Verify that the file target has the contents of node. If h is not nil, the
+// contents of the file are written to it.
 //
 // buf and the first return value are scratch space, passed around for reuse.
 // Reusing buffers prevents the verifier goroutines allocating all of RAM and
 // flushing the filesystem cache (at least on Linux).
-func (res *Restorer) verifyFile(target string, node *restic.Node, buf []byte) ([]byte, error) {
+func verifyFile(repo restic.Repository, target string, node *restic.Node, buf []byte, h hash.Hash) ([]byte, error) {
 	f, err := os.Open(target)
 	if err != nil {
 		return buf, err
@@ -386,7 +502,7 @@ func (res *Restorer) verifyFile(target string, node *restic.Node, buf []byte) ([
 
 	var offset int64
 	for _, blobID := range node.Content {
-		length, found := res.repo.LookupBlobSize(blobID, restic.DataBlob)
+		length, found := repo.LookupBlobSize(blobID, restic.DataBlob)
 		if !found {
 			return buf, errors.Errorf("Unable to fetch blob %s", blobID)
 		}
@@ -401,9 +517,10 @@ func (res *Restorer) verifyFile(target string, node *restic.Node, buf []byte) ([
 			return buf, err
 		}
 		if !blobID.Equal(restic.Hash(buf)) {
-			return buf, errors.Errorf(
-				"Unexpected content in %s, starting at offset %d",
-				target, offset)
+			return buf, &ContentMismatchError{Path: target, Offset: offset}
+		}
+		if h != nil {
+			_, _ = h.Write(buf)
 		}
 		offset += int64(length)
 	}
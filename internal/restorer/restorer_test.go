@@ -17,6 +17,7 @@ import (
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+	restoreui "github.com/restic/restic/internal/ui/restore"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -326,7 +327,7 @@ func TestRestorer(t *testing.T) {
 			sn, id := saveSnapshot(t, repo, test.Snapshot)
 			t.Logf("snapshot saved as %v", id.Str())
 
-			res := NewRestorer(context.TODO(), repo, sn, false)
+			res := NewRestorer(context.TODO(), repo, sn, false, nil)
 
 			tempdir, cleanup := rtest.TempDir(t)
 			defer cleanup()
@@ -446,7 +447,7 @@ func TestRestorerRelative(t *testing.T) {
 			sn, id := saveSnapshot(t, repo, test.Snapshot)
 			t.Logf("snapshot saved as %v", id.Str())
 
-			res := NewRestorer(context.TODO(), repo, sn, false)
+			res := NewRestorer(context.TODO(), repo, sn, false, nil)
 
 			tempdir, cleanup := rtest.TempDir(t)
 			defer cleanup()
@@ -678,7 +679,7 @@ func TestRestorerTraverseTree(t *testing.T) {
 			defer cleanup()
 			sn, _ := saveSnapshot(t, repo, test.Snapshot)
 
-			res := NewRestorer(context.TODO(), repo, sn, false)
+			res := NewRestorer(context.TODO(), repo, sn, false, nil)
 
 			res.SelectFilter = test.Select
 
@@ -757,7 +758,7 @@ func TestRestorerConsistentTimestampsAndPermissions(t *testing.T) {
 		},
 	})
 
-	res := NewRestorer(context.TODO(), repo, sn, false)
+	res := NewRestorer(context.TODO(), repo, sn, false, nil)
 
 	res.SelectFilter = func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		switch filepath.ToSlash(item) {
@@ -816,7 +817,7 @@ func TestVerifyCancel(t *testing.T) {
 
 	sn, _ := saveSnapshot(t, repo, snapshot)
 
-	res := NewRestorer(context.TODO(), repo, sn, false)
+	res := NewRestorer(context.TODO(), repo, sn, false, nil)
 
 	tempdir, cleanup := rtest.TempDir(t)
 	defer cleanup()
@@ -841,6 +842,51 @@ func TestVerifyCancel(t *testing.T) {
 	rtest.Assert(t, strings.Contains(errs[0].Error(), "Invalid file size for"), "wrong error %q", errs[0].Error())
 }
 
+// VerifyFiles must continue after a mismatch if res.Error returns nil.
+func TestVerifyContinueAfterMismatch(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+			"bar": File{Data: "content: bar\n"},
+		},
+	}
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	sn, _ := saveSnapshot(t, repo, snapshot)
+
+	prnt := &progressPrinter{}
+	progress := restoreui.NewProgress(prnt, 0)
+	res := NewRestorer(context.TODO(), repo, sn, false, progress)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go progress.Run(ctx)
+
+	rtest.OK(t, res.RestoreTo(ctx, tempdir))
+	err := ioutil.WriteFile(filepath.Join(tempdir, "foo"), []byte("content: baz\n"), 0644)
+	rtest.OK(t, err)
+
+	var errs []string
+	res.Error = func(filename string, err error) error {
+		errs = append(errs, filename)
+		return nil
+	}
+
+	nverified, err := res.VerifyFiles(ctx, tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, nverified)
+	rtest.Equals(t, []string{filepath.Join(tempdir, "foo")}, errs)
+
+	cancel()
+	progress.Finish()
+	rtest.Equals(t, restoreui.Counter{Files: 1, Bytes: 13}, prnt.Verified)
+}
+
 func TestRestorerSparseFiles(t *testing.T) {
 	repo, cleanup := repository.TestRepository(t)
 	defer cleanup()
@@ -861,16 +907,24 @@ func TestRestorerSparseFiles(t *testing.T) {
 		archiver.SnapshotOptions{})
 	rtest.OK(t, err)
 
-	res := NewRestorer(context.TODO(), repo, sn, true)
+	prnt := &progressPrinter{}
+	progress := restoreui.NewProgress(prnt, 0)
+	res := NewRestorer(context.TODO(), repo, sn, true, progress)
 
 	tempdir, cleanup := rtest.TempDir(t)
 	defer cleanup()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	go progress.Run(ctx)
 
 	err = res.RestoreTo(ctx, tempdir)
 	rtest.OK(t, err)
+	cancel()
+	progress.Finish()
+	if runtime.GOOS != "windows" {
+		rtest.Equals(t, uint64(len(zeros)), prnt.SparseBytes)
+	}
 
 	filename := filepath.Join(tempdir, "zeros")
 	content, err := ioutil.ReadFile(filename)
@@ -894,3 +948,228 @@ func TestRestorerSparseFiles(t *testing.T) {
 	t.Logf("wrote %d zeros as %d blocks, %.1f%% sparse",
 		len(zeros), blocks, 100*sparsity)
 }
+
+type progressPrinter struct {
+	restoreui.Summary
+}
+
+func (p *progressPrinter) Update(start time.Time, summary *restoreui.Summary, secs uint64) {}
+func (p *progressPrinter) Error(item string, err error) error                              { return err }
+func (p *progressPrinter) Finish(start time.Time, summary *restoreui.Summary) {
+	p.Summary = *summary
+}
+func (p *progressPrinter) Reset()                            {}
+func (p *progressPrinter) P(msg string, args ...interface{}) {}
+func (p *progressPrinter) V(msg string, args ...interface{}) {}
+
+func TestRestorerProgress(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo":   File{Data: "content: foo\n"},
+			"empty": File{Data: ""},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"bar": File{Data: "content: bar\n", Links: 2, Inode: 1},
+					"baz": File{Data: "content: bar\n", Links: 2, Inode: 1},
+				},
+			},
+		},
+	})
+
+	prnt := &progressPrinter{}
+	progress := restoreui.NewProgress(prnt, 0)
+	res := NewRestorer(context.TODO(), repo, sn, false, progress)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go progress.Run(ctx)
+
+	err := res.RestoreTo(ctx, tempdir)
+	rtest.OK(t, err)
+
+	cancel()
+	progress.Finish()
+
+	want := restoreui.Counter{Files: 4, Bytes: 26}
+	rtest.Equals(t, want, prnt.Total)
+	rtest.Equals(t, want, prnt.Processed)
+}
+
+func TestRestorerProgressFiltered(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"main.go":   File{Data: "package main\n"},
+			"README.md": File{Data: "readme\n"},
+			"vendor": Dir{
+				Nodes: map[string]Node{
+					"lib": Dir{
+						Nodes: map[string]Node{
+							"lib.go":  File{Data: "package lib\n"},
+							"lib.txt": File{Data: "text\n"},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	prnt := &progressPrinter{}
+	progress := restoreui.NewProgress(prnt, 0)
+	res := NewRestorer(context.TODO(), repo, sn, false, progress)
+	res.SelectFilter = func(item, dstpath string, node *restic.Node) (bool, bool) {
+		if node.Type == "dir" {
+			return false, true
+		}
+		return filepath.Ext(item) == ".go", false
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go progress.Run(ctx)
+
+	err := res.RestoreTo(ctx, tempdir)
+	rtest.OK(t, err)
+
+	cancel()
+	progress.Finish()
+
+	rtest.Equals(t, restoreui.Counter{Files: 2, Bytes: 25}, prnt.Total)
+	rtest.Equals(t, restoreui.Counter{Files: 2, Bytes: 12}, prnt.Filtered)
+
+	_, err = os.Stat(filepath.Join(tempdir, "vendor", "lib", "lib.go"))
+	rtest.OK(t, err)
+	_, err = os.Stat(filepath.Join(tempdir, "vendor", "lib", "lib.txt"))
+	rtest.Assert(t, os.IsNotExist(err), "unexpected error %v", err)
+}
+
+func TestRestorerSkipUnchanged(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"same":    File{Data: "content: same\n"},
+			"partial": File{Data: "content: partial\n"},
+			"shorter": File{Data: "content: shorter\n"},
+			"missing": File{Data: "content: missing\n"},
+			"dir":     Dir{Nodes: map[string]Node{"file": File{Data: "content: dir\n"}}},
+		},
+	})
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	existing := map[string]string{
+		"same":    "content: same\n",
+		"partial": "content: PARTIAL\n",
+		"shorter": "content: shorter\nand more\n",
+	}
+	for name, data := range existing {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(tempdir, name), []byte(data), 0600))
+	}
+	// a directory is not a matching file
+	rtest.OK(t, os.MkdirAll(filepath.Join(tempdir, "dir", "file"), 0700))
+
+	prnt := &progressPrinter{}
+	progress := restoreui.NewProgress(prnt, 0)
+	res := NewRestorer(context.TODO(), repo, sn, false, progress)
+	res.SkipUnchanged = true
+	res.Error = func(location string, err error) error {
+		// the directory in place of dir/file cannot be overwritten
+		if location == filepath.FromSlash("/dir/file") {
+			return nil
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go progress.Run(ctx)
+
+	err := res.RestoreTo(ctx, tempdir)
+	rtest.OK(t, err)
+
+	cancel()
+	progress.Finish()
+
+	rtest.Equals(t, restoreui.Counter{Files: 1, Bytes: 14}, prnt.Skipped)
+	for name, data := range map[string]string{
+		"same":    "content: same\n",
+		"partial": "content: partial\n",
+		"shorter": "content: shorter\n",
+		"missing": "content: missing\n",
+	} {
+		buf, err := ioutil.ReadFile(filepath.Join(tempdir, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, data, string(buf))
+	}
+}
+
+func TestRestorerResume(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	sn, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n", ModTime: mtime},
+			"bar": File{Data: "content: bar\n", ModTime: mtime},
+			"dir": Dir{Nodes: map[string]Node{"file": File{Data: "content: dir\n", ModTime: mtime}}},
+		},
+	})
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	statefile := filepath.Join(tempdir, "state.json")
+	target := filepath.Join(tempdir, "target")
+
+	restore := func(state *ResumeState) *progressPrinter {
+		prnt := &progressPrinter{}
+		progress := restoreui.NewProgress(prnt, 0)
+		res := NewRestorer(context.TODO(), repo, sn, false, progress)
+		res.Resume = state
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go progress.Run(ctx)
+		rtest.OK(t, res.RestoreTo(ctx, target))
+		cancel()
+		progress.Finish()
+		return prnt
+	}
+
+	state := NewResumeState(id, target)
+	prnt := restore(state)
+	rtest.Equals(t, restoreui.Counter{}, prnt.Resumed)
+	rtest.Equals(t, 3, state.Len())
+	rtest.OK(t, state.Save(statefile))
+
+	// a modified file is restored again
+	modified := filepath.Join(target, "bar")
+	rtest.OK(t, ioutil.WriteFile(modified, []byte("content: BAR\n"), 0600))
+	rtest.OK(t, os.Chtimes(modified, time.Now(), time.Now().Add(time.Hour)))
+
+	state, err := LoadResumeState(statefile, id, target)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, state.Len())
+	prnt = restore(state)
+	rtest.Equals(t, restoreui.Counter{Files: 2, Bytes: 26}, prnt.Resumed)
+	rtest.Equals(t, restoreui.Counter{Files: 3, Bytes: 39}, prnt.Processed)
+
+	buf, err := ioutil.ReadFile(modified)
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: bar\n", string(buf))
+
+	// the state of a restore of a different snapshot is ignored
+	state, err = LoadResumeState(statefile, restic.NewRandomID(), target)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, state.Len())
+}
@@ -5,6 +5,7 @@ package restorer
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -30,7 +31,7 @@ func TestRestorerRestoreEmptyHardlinkedFileds(t *testing.T) {
 		},
 	})
 
-	res := NewRestorer(context.TODO(), repo, sn, false)
+	res := NewRestorer(context.TODO(), repo, sn, false, nil)
 
 	res.SelectFilter = func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		return true, true
@@ -69,3 +70,33 @@ func getBlockCount(t *testing.T, filename string) int64 {
 	}
 	return st.Blocks
 }
+
+func TestSparseWriteZeroRuns(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	data := make([]byte, 3*sparseBlockSize+200)
+	data[0] = 1
+	// two blocks of the file only contain zeros, independent of the offset
+	data[len(data)-1] = 2
+
+	for _, offset := range []int64{0, 100} {
+		filename := filepath.Join(tempdir, "file")
+		f, err := os.Create(filename)
+		rtest.OK(t, err)
+		rtest.OK(t, f.Truncate(offset+int64(len(data))))
+
+		var holes uint64
+		wr := &partialFile{File: f, sparse: true, holes: &holes}
+		n, err := wr.WriteAt(data, offset)
+		rtest.OK(t, err)
+		rtest.Equals(t, len(data), n)
+		rtest.OK(t, f.Close())
+
+		content, err := ioutil.ReadFile(filename)
+		rtest.OK(t, err)
+		rtest.Equals(t, data, content[offset:])
+		// the zeros are only skipped in whole blocks of the file
+		rtest.Equals(t, uint64(2*sparseBlockSize), holes)
+	}
+}
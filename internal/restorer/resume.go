@@ -0,0 +1,131 @@
+package restorer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ResumeState records the files which have been restored completely. When an
+// interrupted restore of the same snapshot to the same target is resumed,
+// these files are not restored again if their size and modification time did
+// not change since.
+type ResumeState struct {
+	mu       sync.Mutex
+	snapshot restic.ID
+	target   string
+	files    map[string]resumeFile
+}
+
+// resumeFile is a file which has been restored, the key in the map of files is
+// the location within the snapshot.
+type resumeFile struct {
+	ModTime time.Time `json:"mtime"`
+	Size    uint64    `json:"size"`
+}
+
+// resumeData is the format of the state on disk.
+type resumeData struct {
+	Snapshot restic.ID             `json:"snapshot"`
+	Target   string                `json:"target"`
+	Files    map[string]resumeFile `json:"files"`
+}
+
+// NewResumeState returns an empty state for a restore of snapshot to target.
+func NewResumeState(snapshot restic.ID, target string) *ResumeState {
+	return &ResumeState{
+		snapshot: snapshot,
+		target:   target,
+		files:    make(map[string]resumeFile),
+	}
+}
+
+// LoadResumeState loads the state from filename. If the file does not exist or
+// the state was written for a different snapshot or target, an empty state is
+// returned.
+func LoadResumeState(filename string, snapshot restic.ID, target string) (*ResumeState, error) {
+	s := NewResumeState(snapshot, target)
+
+	buf, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile")
+	}
+
+	var data resumeData
+	err = json.Unmarshal(buf, &data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	if data.Snapshot != snapshot || data.Target != target {
+		debug.Log("restore of %v to %v changed to %v to %v, ignoring state", data.Snapshot.Str(), data.Target, snapshot.Str(), target)
+		return s, nil
+	}
+
+	if data.Files != nil {
+		s.files = data.Files
+	}
+	return s, nil
+}
+
+// Save writes the state to filename. The file is replaced atomically so that
+// an interrupted write does not destroy the previous state.
+func (s *ResumeState) Save(filename string) error {
+	s.mu.Lock()
+	buf, err := json.Marshal(resumeData{Snapshot: s.snapshot, Target: s.target, Files: s.files})
+	s.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	return errors.WithStack(fs.WriteFileAtomic(filename, buf))
+}
+
+// Len returns the number of files in the state.
+func (s *ResumeState) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// add records that the file at location has been restored to path.
+func (s *ResumeState) add(location, path string) {
+	fi, err := fs.Lstat(path)
+	if err != nil {
+		debug.Log("unable to record %v: %v", location, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[location] = resumeFile{ModTime: fi.ModTime(), Size: uint64(fi.Size())}
+}
+
+// restored returns true if the file at location has been restored to path
+// before and was not modified since. Its modification time is either the one
+// recorded after writing the content or, if the metadata has been restored
+// already, the one of node.
+func (s *ResumeState) restored(location, path string, node *restic.Node) bool {
+	s.mu.Lock()
+	f, ok := s.files[location]
+	s.mu.Unlock()
+	if !ok || f.Size != node.Size {
+		return false
+	}
+
+	fi, err := fs.Lstat(path)
+	if err != nil || !fi.Mode().IsRegular() || uint64(fi.Size()) != f.Size {
+		return false
+	}
+	return fi.ModTime().Equal(f.ModTime) || fi.ModTime().Equal(node.ModTime)
+}
@@ -4,34 +4,58 @@
 package restorer
 
 import (
+	"sync/atomic"
+
 	"github.com/restic/restic/internal/restic"
 )
 
-// WriteAt writes p to f.File at offset. It tries to do a sparse write
-// and updates f.size.
+// sparseBlockSize is the granularity in which holes are created. File systems
+// allocate space in blocks, so shorter runs of zeros would not save any space.
+const sparseBlockSize = 4096
+
+// WriteAt writes p to f.File at offset. For sparse files, it skips all blocks
+// of p which only contain zeros, a previous WriteAt or Truncate will have
+// produced the zeros in f.File. The number of skipped bytes is added to
+// f.holes.
 func (f *partialFile) WriteAt(p []byte, offset int64) (n int, err error) {
 	if !f.sparse {
 		return f.File.WriteAt(p, offset)
 	}
 
-	n = len(p)
-
-	// Skip the longest all-zero prefix of p.
-	// If it's long enough, we can punch a hole in the file.
-	skipped := restic.ZeroPrefixLen(p)
-	p = p[skipped:]
-	offset += int64(skipped)
-
-	switch {
-	case len(p) == 0:
-		// All zeros, file already big enough. A previous WriteAt or
-		// Truncate will have produced the zeros in f.File.
+	var skipped int
+	// start is the beginning of the data in p which has yet to be written
+	start := 0
+	for pos := 0; pos < len(p); {
+		// align the blocks to the file offset
+		end := pos + sparseBlockSize - int((offset+int64(pos))%sparseBlockSize)
+		if end > len(p) {
+			end = len(p)
+		}
+
+		// the last block of p may be followed by data, nevertheless it is
+		// skipped if it only contains zeros
+		if restic.ZeroPrefixLen(p[pos:end]) == end-pos {
+			if start < pos {
+				_, err = f.File.WriteAt(p[start:pos], offset+int64(start))
+				if err != nil {
+					return start, err
+				}
+			}
+			skipped += end - pos
+			start = end
+		}
+		pos = end
+	}
 
-	default:
-		var n2 int
-		n2, err = f.File.WriteAt(p, offset)
-		n = skipped + n2
+	if start < len(p) {
+		_, err = f.File.WriteAt(p[start:], offset+int64(start))
+		if err != nil {
+			return start, err
+		}
 	}
 
-	return n, err
+	if f.holes != nil {
+		atomic.AddUint64(f.holes, uint64(skipped))
+	}
+	return len(p), nil
 }
@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"os"
+	"sort"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// maxCollectedErrors is the maximum number of errors kept for the summary,
+// further errors are only counted.
+const maxCollectedErrors = 1000
+
+// ItemError is an error which occurred while processing an item.
+type ItemError struct {
+	Item string
+	Err  error
+}
+
+// ErrorReason is the number of errors which share the same reason.
+type ErrorReason struct {
+	Reason string
+	Count  int
+}
+
+// errorReason returns the message of the innermost error for errors
+// concerning a path, for example "permission denied", so that errors for
+// different files can be grouped. All other errors are returned unchanged.
+func errorReason(err error) string {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Err.Error()
+	}
+
+	var syscallErr *os.SyscallError
+	if errors.As(err, &syscallErr) {
+		return syscallErr.Err.Error()
+	}
+
+	return err.Error()
+}
+
+// groupErrors counts the errors by reason. The reasons are sorted by
+// decreasing count.
+func groupErrors(errs []ItemError) []ErrorReason {
+	counts := make(map[string]int)
+	for _, e := range errs {
+		counts[errorReason(e.Err)]++
+	}
+
+	reasons := make([]ErrorReason, 0, len(counts))
+	for reason, count := range counts {
+		reasons = append(reasons, ErrorReason{Reason: reason, Count: count})
+	}
+
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		return reasons[i].Reason < reasons[j].Reason
+	})
+
+	return reasons
+}
@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+func TestGroupErrors(t *testing.T) {
+	errs := []ItemError{
+		{Item: "a", Err: &os.PathError{Op: "open", Path: "a", Err: syscall.EACCES}},
+		{Item: "b", Err: errors.Wrap(&os.PathError{Op: "lstat", Path: "b", Err: syscall.ENOENT}, "Lstat")},
+		{Item: "c", Err: &os.PathError{Op: "read", Path: "c", Err: syscall.EACCES}},
+		{Item: "d", Err: errors.New("file d changed type")},
+	}
+
+	want := []ErrorReason{
+		{Reason: syscall.EACCES.Error(), Count: 2},
+		{Reason: "file d changed type", Count: 1},
+		{Reason: syscall.ENOENT.Error(), Count: 1},
+	}
+
+	got := groupErrors(errs)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong error groups, want %v, got %v", want, got)
+	}
+}
+
+func TestProgressCollectsErrors(t *testing.T) {
+	prog := NewProgress(&mockPrinter{}, time.Millisecond, 0)
+
+	for i := 0; i < maxCollectedErrors+5; i++ {
+		_ = prog.Error("foo", errors.New("bar"))
+	}
+
+	if len(prog.summary.Errors) != maxCollectedErrors {
+		t.Errorf("expected %d collected errors, got %d", maxCollectedErrors, len(prog.summary.Errors))
+	}
+	if prog.summary.ErrorCount != maxCollectedErrors+5 {
+		t.Errorf("expected error count %d, got %d", maxCollectedErrors+5, prog.summary.ErrorCount)
+	}
+
+	want := "1005 items failed: bar (1000), not recorded (5)"
+	if got := formatErrorSummary(&prog.summary); got != want {
+		t.Errorf("wrong error summary, want %q, got %q", want, got)
+	}
+}
@@ -1,14 +1,14 @@
 package backup
 
 import (
-	"bytes"
-	"encoding/json"
-	"sort"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend/accounting"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/ui/termstatus"
 )
 
@@ -17,8 +17,14 @@ type JSONProgress struct {
 	*ui.Message
 	*ui.StdioWrapper
 
-	term *termstatus.Terminal
-	v    uint
+	out *progress.JSONPrinter
+	v   uint
+
+	mu        sync.Mutex
+	phase     Phase
+	paused    bool
+	throttled bool
+	subtotals []Subtotal
 }
 
 // assert that Backup implements the ProgressPrinter interface
@@ -29,57 +35,86 @@ func NewJSONProgress(term *termstatus.Terminal, verbosity uint) *JSONProgress {
 	return &JSONProgress{
 		Message:      ui.NewMessage(term, verbosity),
 		StdioWrapper: ui.NewStdioWrapper(term),
-		term:         term,
+		out:          progress.NewJSONPrinter(term),
 		v:            verbosity,
 	}
 }
 
-func toJSONString(status interface{}) string {
-	buf := new(bytes.Buffer)
-	err := json.NewEncoder(buf).Encode(status)
-	if err != nil {
-		panic(err)
-	}
-	return buf.String()
-}
-
-func (b *JSONProgress) print(status interface{}) {
-	b.term.Print(toJSONString(status))
-}
+// P is a no-op, plain text messages are not part of the JSON output.
+func (b *JSONProgress) P(msg string, args ...interface{}) {}
 
-func (b *JSONProgress) error(status interface{}) {
-	b.term.Error(toJSONString(status))
-}
+// V is a no-op, plain text messages are not part of the JSON output.
+func (b *JSONProgress) V(msg string, args ...interface{}) {}
 
 // Update updates the status lines.
-func (b *JSONProgress) Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64) {
+func (b *JSONProgress) Update(total, processed Counter, errors uint, currentFiles []string, start time.Time, secs uint64, bytesPerSec float64, newBytes, existingBytes uint64) {
+	b.mu.Lock()
+	phase, paused, throttled, subtotals := b.phase, b.paused, b.throttled, b.subtotals
+	b.mu.Unlock()
+
 	status := statusUpdate{
 		MessageType:      "status",
+		Phase:            phase.String(),
+		Paused:           paused,
+		Throttled:        throttled,
 		SecondsElapsed:   uint64(time.Since(start) / time.Second),
 		SecondsRemaining: secs,
 		TotalFiles:       total.Files,
 		FilesDone:        processed.Files,
+		TotalDirs:        total.Dirs,
+		DirsDone:         processed.Dirs,
 		TotalBytes:       total.Bytes,
 		BytesDone:        processed.Bytes,
 		ErrorCount:       errors,
+		BytesPerSecond:   bytesPerSec,
+		BytesNew:         newBytes,
+		BytesExisting:    existingBytes,
+		CurrentFiles:     currentFiles,
+		Subtotals:        subtotalsToStatus(subtotals),
 	}
 
 	if total.Bytes > 0 {
 		status.PercentDone = float64(processed.Bytes) / float64(total.Bytes)
 	}
 
-	for filename := range currentFiles {
-		status.CurrentFiles = append(status.CurrentFiles, filename)
-	}
-	sort.Strings(status.CurrentFiles)
+	b.out.Print(status)
+}
+
+// SetPhase records the current phase, it is included in the status messages.
+func (b *JSONProgress) SetPhase(phase Phase) {
+	b.mu.Lock()
+	b.phase = phase
+	b.mu.Unlock()
+}
+
+// SetPaused records whether the backup is paused, it is included in the
+// status messages.
+func (b *JSONProgress) SetPaused(paused bool) {
+	b.mu.Lock()
+	b.paused = paused
+	b.mu.Unlock()
+}
+
+// SetThrottled records whether the backup is limited by the upload limit, it
+// is included in the status messages.
+func (b *JSONProgress) SetThrottled(throttled bool) {
+	b.mu.Lock()
+	b.throttled = throttled
+	b.mu.Unlock()
+}
 
-	b.print(status)
+// SetSubtotals records the progress of the active top-level items, it is
+// included in the status messages.
+func (b *JSONProgress) SetSubtotals(subtotals []Subtotal) {
+	b.mu.Lock()
+	b.subtotals = subtotals
+	b.mu.Unlock()
 }
 
 // ScannerError is the error callback function for the scanner, it prints the
 // error in verbose mode and returns nil.
 func (b *JSONProgress) ScannerError(item string, err error) error {
-	b.error(errorUpdate{
+	b.out.PrintError(errorUpdate{
 		MessageType: "error",
 		Error:       err,
 		During:      "scan",
@@ -90,7 +125,7 @@ func (b *JSONProgress) ScannerError(item string, err error) error {
 
 // Error is the error callback function for the archiver, it prints the error and returns nil.
 func (b *JSONProgress) Error(item string, err error) error {
-	b.error(errorUpdate{
+	b.out.PrintError(errorUpdate{
 		MessageType: "error",
 		Error:       err,
 		During:      "archival",
@@ -108,7 +143,7 @@ func (b *JSONProgress) CompleteItem(messageType, item string, previous, current
 
 	switch messageType {
 	case "dir new":
-		b.print(verboseUpdate{
+		b.out.Print(verboseUpdate{
 			MessageType:        "verbose_status",
 			Action:             "new",
 			Item:               item,
@@ -119,13 +154,13 @@ func (b *JSONProgress) CompleteItem(messageType, item string, previous, current
 			MetadataSizeInRepo: s.TreeSizeInRepo,
 		})
 	case "dir unchanged":
-		b.print(verboseUpdate{
+		b.out.Print(verboseUpdate{
 			MessageType: "verbose_status",
 			Action:      "unchanged",
 			Item:        item,
 		})
 	case "dir modified":
-		b.print(verboseUpdate{
+		b.out.Print(verboseUpdate{
 			MessageType:        "verbose_status",
 			Action:             "modified",
 			Item:               item,
@@ -136,7 +171,7 @@ func (b *JSONProgress) CompleteItem(messageType, item string, previous, current
 			MetadataSizeInRepo: s.TreeSizeInRepo,
 		})
 	case "file new":
-		b.print(verboseUpdate{
+		b.out.Print(verboseUpdate{
 			MessageType:    "verbose_status",
 			Action:         "new",
 			Item:           item,
@@ -145,13 +180,13 @@ func (b *JSONProgress) CompleteItem(messageType, item string, previous, current
 			DataSizeInRepo: s.DataSizeInRepo,
 		})
 	case "file unchanged":
-		b.print(verboseUpdate{
+		b.out.Print(verboseUpdate{
 			MessageType: "verbose_status",
 			Action:      "unchanged",
 			Item:        item,
 		})
 	case "file modified":
-		b.print(verboseUpdate{
+		b.out.Print(verboseUpdate{
 			MessageType:    "verbose_status",
 			Action:         "modified",
 			Item:           item,
@@ -159,13 +194,95 @@ func (b *JSONProgress) CompleteItem(messageType, item string, previous, current
 			DataSize:       s.DataSize,
 			DataSizeInRepo: s.DataSizeInRepo,
 		})
+	case "file changed during read":
+		b.out.Print(verboseUpdate{
+			MessageType:    "verbose_status",
+			Action:         "changed_during_read",
+			Item:           item,
+			Duration:       d.Seconds(),
+			DataSize:       s.DataSize,
+			DataSizeInRepo: s.DataSizeInRepo,
+		})
+	case "file hardlink":
+		b.out.Print(verboseUpdate{
+			MessageType: "verbose_status",
+			Action:      "hardlink",
+			Item:        item,
+		})
+	case "file resumed":
+		b.out.Print(verboseUpdate{
+			MessageType: "verbose_status",
+			Action:      "resumed",
+			Item:        item,
+		})
+	}
+}
+
+// SkipItem is the status callback function for the archiver when a file/dir
+// has been excluded from the backup.
+func (b *JSONProgress) SkipItem(item string, reason string) {
+	if b.v < 2 {
+		return
 	}
+
+	b.out.Print(verboseUpdate{
+		MessageType: "verbose_status",
+		Action:      "excluded",
+		Item:        item,
+		Reason:      reason,
+	})
+}
+
+// FilesystemBoundary reports a directory which is located on a different
+// file system than its parent directory.
+func (b *JSONProgress) FilesystemBoundary(item string) {
+	b.out.Print(boundaryUpdate{
+		MessageType: "filesystem_boundary",
+		Item:        item,
+	})
+}
+
+// Dereferenced reports a symlink which has been followed.
+func (b *JSONProgress) Dereferenced(item, target string) {
+	if b.v < 2 {
+		return
+	}
+
+	b.out.Print(verboseUpdate{
+		MessageType: "verbose_status",
+		Action:      "dereferenced",
+		Item:        item,
+		Target:      target,
+	})
+}
+
+// ParallelRead reports a file which is read by several concurrent readers.
+func (b *JSONProgress) ParallelRead(item string, readers uint) {
+	if b.v < 2 {
+		return
+	}
+
+	b.out.Print(verboseUpdate{
+		MessageType: "verbose_status",
+		Action:      "parallel_read",
+		Item:        item,
+		Readers:     readers,
+	})
+}
+
+// SymlinkLoop reports a symlink which has not been followed because it
+// points to a directory containing it.
+func (b *JSONProgress) SymlinkLoop(item string) {
+	b.out.Print(symlinkLoopUpdate{
+		MessageType: "symlink_loop",
+		Item:        item,
+	})
 }
 
 // ReportTotal sets the total stats up to now
 func (b *JSONProgress) ReportTotal(item string, start time.Time, s archiver.ScanStats) {
 	if b.v >= 2 {
-		b.print(verboseUpdate{
+		b.out.Print(verboseUpdate{
 			MessageType: "status",
 			Action:      "scan_finished",
 			Duration:    time.Since(start).Seconds(),
@@ -177,22 +294,41 @@ func (b *JSONProgress) ReportTotal(item string, start time.Time, s archiver.Scan
 
 // Finish prints the finishing messages.
 func (b *JSONProgress) Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool) {
-	b.print(summaryOutput{
-		MessageType:         "summary",
-		FilesNew:            summary.Files.New,
-		FilesChanged:        summary.Files.Changed,
-		FilesUnmodified:     summary.Files.Unchanged,
-		DirsNew:             summary.Dirs.New,
-		DirsChanged:         summary.Dirs.Changed,
-		DirsUnmodified:      summary.Dirs.Unchanged,
-		DataBlobs:           summary.ItemStats.DataBlobs,
-		TreeBlobs:           summary.ItemStats.TreeBlobs,
-		DataAdded:           summary.ItemStats.DataSize + summary.ItemStats.TreeSize,
-		TotalFilesProcessed: summary.Files.New + summary.Files.Changed + summary.Files.Unchanged,
-		TotalBytesProcessed: summary.ProcessedBytes,
-		TotalDuration:       time.Since(start).Seconds(),
-		SnapshotID:          snapshotID.Str(),
-		DryRun:              dryRun,
+	b.out.Print(summaryOutput{
+		MessageType:            "summary",
+		FilesNew:               summary.Files.New,
+		FilesChanged:           summary.Files.Changed,
+		FilesUnmodified:        summary.Files.Unchanged,
+		FilesExcluded:          summary.Files.Excluded,
+		FilesHardlinked:        summary.Files.Hardlinked,
+		FilesChangedDuringRead: summary.Files.ChangedDuringRead,
+		FilesResumed:           summary.Files.Resumed,
+		DirsNew:                summary.Dirs.New,
+		DirsChanged:            summary.Dirs.Changed,
+		DirsUnmodified:         summary.Dirs.Unchanged,
+		DirsExcluded:           summary.Dirs.Excluded,
+		ExcludedByPath:         summary.ExcludedByPath,
+		DataBlobs:              summary.ItemStats.DataBlobs,
+		TreeBlobs:              summary.ItemStats.TreeBlobs,
+		DataBlobsDuplicate:     summary.ItemStats.DataBlobsDuplicate,
+		DataDuplicate:          summary.ItemStats.DataSizeDuplicate,
+		DataBlobsExisting:      summary.ItemStats.DataBlobsExisting,
+		DataAdded:              summary.ItemStats.DataSize + summary.ItemStats.TreeSize,
+		DataExisting:           summary.ExistingBytes,
+		CompressionRatio:       summary.CompressionRatio(),
+		Compression:            summary.Compression,
+		DedupRatio:             summary.DedupRatio(),
+		ModifiedFileBlobs:      summary.ModifiedFileBlobs,
+		ReusedFileBlobs:        summary.ReusedFileBlobs,
+		ParentReuseRatio:       summary.ParentReuseRatio(),
+		ErrorCount:             summary.ErrorCount,
+		Errors:                 errorsToSummary(summary.Errors),
+		TotalFilesProcessed:    summary.Files.New + summary.Files.Changed + summary.Files.Unchanged + summary.Files.Hardlinked + summary.Files.Resumed,
+		TotalBytesProcessed:    summary.ProcessedBytes,
+		TotalDuration:          time.Since(start).Seconds(),
+		Backend:                summary.Backend,
+		SnapshotID:             snapshotID.Str(),
+		DryRun:                 dryRun,
 	})
 }
 
@@ -201,16 +337,56 @@ func (b *JSONProgress) Reset() {
 }
 
 type statusUpdate struct {
-	MessageType      string   `json:"message_type"` // "status"
-	SecondsElapsed   uint64   `json:"seconds_elapsed,omitempty"`
-	SecondsRemaining uint64   `json:"seconds_remaining,omitempty"`
-	PercentDone      float64  `json:"percent_done"`
-	TotalFiles       uint64   `json:"total_files,omitempty"`
-	FilesDone        uint64   `json:"files_done,omitempty"`
-	TotalBytes       uint64   `json:"total_bytes,omitempty"`
-	BytesDone        uint64   `json:"bytes_done,omitempty"`
-	ErrorCount       uint     `json:"error_count,omitempty"`
-	CurrentFiles     []string `json:"current_files,omitempty"`
+	MessageType      string           `json:"message_type"` // "status"
+	Phase            string           `json:"phase"`
+	Paused           bool             `json:"paused,omitempty"`
+	Throttled        bool             `json:"throttled,omitempty"`
+	SecondsElapsed   uint64           `json:"seconds_elapsed,omitempty"`
+	SecondsRemaining uint64           `json:"seconds_remaining,omitempty"`
+	PercentDone      float64          `json:"percent_done"`
+	TotalFiles       uint64           `json:"total_files,omitempty"`
+	FilesDone        uint64           `json:"files_done,omitempty"`
+	TotalDirs        uint64           `json:"total_dirs,omitempty"`
+	DirsDone         uint64           `json:"dirs_done,omitempty"`
+	TotalBytes       uint64           `json:"total_bytes,omitempty"`
+	BytesDone        uint64           `json:"bytes_done,omitempty"`
+	ErrorCount       uint             `json:"error_count,omitempty"`
+	BytesPerSecond   float64          `json:"bytes_per_second,omitempty"`
+	BytesNew         uint64           `json:"bytes_new,omitempty"`
+	BytesExisting    uint64           `json:"bytes_existing,omitempty"`
+	CurrentFiles     []string         `json:"current_files,omitempty"`
+	Subtotals        []subtotalStatus `json:"subtotals,omitempty"`
+}
+
+type subtotalStatus struct {
+	Item        string  `json:"item"`
+	PercentDone float64 `json:"percent_done,omitempty"`
+	TotalFiles  uint64  `json:"total_files,omitempty"`
+	FilesDone   uint64  `json:"files_done"`
+	TotalBytes  uint64  `json:"total_bytes,omitempty"`
+	BytesDone   uint64  `json:"bytes_done"`
+}
+
+func subtotalsToStatus(subtotals []Subtotal) []subtotalStatus {
+	if len(subtotals) == 0 {
+		return nil
+	}
+
+	res := make([]subtotalStatus, 0, len(subtotals))
+	for _, st := range subtotals {
+		status := subtotalStatus{
+			Item:       st.Item,
+			TotalFiles: st.Total.Files,
+			FilesDone:  st.Processed.Files,
+			TotalBytes: st.Total.Bytes,
+			BytesDone:  st.Processed.Bytes,
+		}
+		if st.Scanned && st.Total.Bytes > 0 {
+			status.PercentDone = float64(st.Processed.Bytes) / float64(st.Total.Bytes)
+		}
+		res = append(res, status)
+	}
+	return res
 }
 
 type errorUpdate struct {
@@ -220,32 +396,81 @@ type errorUpdate struct {
 	Item        string `json:"item"`
 }
 
+type boundaryUpdate struct {
+	MessageType string `json:"message_type"` // "filesystem_boundary"
+	Item        string `json:"item"`
+}
+
+type symlinkLoopUpdate struct {
+	MessageType string `json:"message_type"` // "symlink_loop"
+	Item        string `json:"item"`
+}
+
 type verboseUpdate struct {
 	MessageType        string  `json:"message_type"` // "verbose_status"
 	Action             string  `json:"action"`
 	Item               string  `json:"item"`
+	Reason             string  `json:"reason,omitempty"`
+	Target             string  `json:"target,omitempty"`
 	Duration           float64 `json:"duration"` // in seconds
 	DataSize           uint64  `json:"data_size"`
 	DataSizeInRepo     uint64  `json:"data_size_in_repo"`
 	MetadataSize       uint64  `json:"metadata_size"`
 	MetadataSizeInRepo uint64  `json:"metadata_size_in_repo"`
 	TotalFiles         uint    `json:"total_files"`
+	Readers            uint    `json:"readers,omitempty"`
 }
 
 type summaryOutput struct {
-	MessageType         string  `json:"message_type"` // "summary"
-	FilesNew            uint    `json:"files_new"`
-	FilesChanged        uint    `json:"files_changed"`
-	FilesUnmodified     uint    `json:"files_unmodified"`
-	DirsNew             uint    `json:"dirs_new"`
-	DirsChanged         uint    `json:"dirs_changed"`
-	DirsUnmodified      uint    `json:"dirs_unmodified"`
-	DataBlobs           int     `json:"data_blobs"`
-	TreeBlobs           int     `json:"tree_blobs"`
-	DataAdded           uint64  `json:"data_added"`
-	TotalFilesProcessed uint    `json:"total_files_processed"`
-	TotalBytesProcessed uint64  `json:"total_bytes_processed"`
-	TotalDuration       float64 `json:"total_duration"` // in seconds
-	SnapshotID          string  `json:"snapshot_id"`
-	DryRun              bool    `json:"dry_run,omitempty"`
+	MessageType            string            `json:"message_type"` // "summary"
+	FilesNew               uint              `json:"files_new"`
+	FilesChanged           uint              `json:"files_changed"`
+	FilesUnmodified        uint              `json:"files_unmodified"`
+	FilesExcluded          uint              `json:"files_excluded"`
+	FilesHardlinked        uint              `json:"files_hardlinked"`
+	FilesChangedDuringRead uint              `json:"files_changed_during_read"`
+	FilesResumed           uint              `json:"files_resumed"`
+	DirsNew                uint              `json:"dirs_new"`
+	DirsChanged            uint              `json:"dirs_changed"`
+	DirsUnmodified         uint              `json:"dirs_unmodified"`
+	DirsExcluded           uint              `json:"dirs_excluded"`
+	ExcludedByPath         uint              `json:"excluded_by_path"`
+	DataBlobs              int               `json:"data_blobs"`
+	TreeBlobs              int               `json:"tree_blobs"`
+	DataBlobsDuplicate     int               `json:"data_blobs_duplicate"`
+	DataDuplicate          uint64            `json:"data_duplicate"`
+	DataBlobsExisting      int               `json:"data_blobs_existing"`
+	DataAdded              uint64            `json:"data_added"`
+	DataExisting           uint64            `json:"data_existing"`
+	CompressionRatio       float64           `json:"compression_ratio"`
+	Compression            string            `json:"compression,omitempty"`
+	DedupRatio             float64           `json:"dedup_ratio"`
+	ModifiedFileBlobs      uint64            `json:"modified_file_blobs"`
+	ReusedFileBlobs        uint64            `json:"reused_file_blobs"`
+	ParentReuseRatio       float64           `json:"parent_reuse_ratio"`
+	ErrorCount             uint              `json:"error_count,omitempty"`
+	Errors                 []summaryError    `json:"errors,omitempty"`
+	TotalFilesProcessed    uint              `json:"total_files_processed"`
+	TotalBytesProcessed    uint64            `json:"total_bytes_processed"`
+	TotalDuration          float64           `json:"total_duration"` // in seconds
+	Backend                *accounting.Stats `json:"backend,omitempty"`
+	SnapshotID             string            `json:"snapshot_id"`
+	DryRun                 bool              `json:"dry_run,omitempty"`
+}
+
+type summaryError struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
+
+func errorsToSummary(errs []ItemError) []summaryError {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	res := make([]summaryError, 0, len(errs))
+	for _, e := range errs {
+		res = append(res, summaryError{Item: e.Item, Error: e.Err.Error()})
+	}
+	return res
 }
@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+func TestJSONProgressConcurrent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	term := termstatus.New(buf, buf, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		term.Run(ctx)
+		close(done)
+	}()
+
+	prnt := NewJSONProgress(term, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				prnt.Update(Counter{Files: 10, Bytes: 1000}, Counter{Files: 1, Bytes: 100}, 0,
+					[]string{"foo"}, time.Now(), 5, 0, 0, 0)
+			}
+		}()
+	}
+	wg.Wait()
+	prnt.Finish(restic.NewRandomID(), time.Now(), &Summary{}, false)
+
+	cancel()
+	<-done
+
+	var statusLines, summaryLines int
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		var msg struct {
+			MessageType string `json:"message_type"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", sc.Text(), err)
+		}
+
+		switch msg.MessageType {
+		case "status":
+			statusLines++
+		case "summary":
+			summaryLines++
+		default:
+			t.Errorf("unexpected message type %q", msg.MessageType)
+		}
+	}
+
+	if statusLines != 100 {
+		t.Errorf("expected 100 status messages, got %d", statusLines)
+	}
+	if summaryLines != 1 {
+		t.Errorf("expected 1 summary message, got %d", summaryLines)
+	}
+}
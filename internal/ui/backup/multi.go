@@ -0,0 +1,221 @@
+package backup
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/restic"
+)
+
+// MultiPrinter forwards all progress messages to several printers, for
+// example to show the progress on the terminal while also writing JSON
+// messages to a file.
+type MultiPrinter struct {
+	printers []ProgressPrinter
+
+	// mu makes sure that all printers receive the messages in the same
+	// order.
+	mu sync.Mutex
+}
+
+// assert that MultiPrinter implements the ProgressPrinter interface
+var _ ProgressPrinter = &MultiPrinter{}
+
+// NewMultiPrinter returns a printer which forwards all messages to printers.
+// The first printer is the primary one, its writers are returned by Stdout
+// and Stderr.
+func NewMultiPrinter(printers ...ProgressPrinter) *MultiPrinter {
+	return &MultiPrinter{printers: printers}
+}
+
+// Update updates the status lines.
+func (m *MultiPrinter) Update(total, processed Counter, errors uint, currentFiles []string, start time.Time, secs uint64, bytesPerSec float64, newBytes, existingBytes uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.Update(total, processed, errors, currentFiles, start, secs, bytesPerSec, newBytes, existingBytes)
+	}
+}
+
+// Error is the error callback function for the archiver. All printers are
+// called, the first error returned by one of them is passed on.
+func (m *MultiPrinter) Error(item string, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res error
+	for _, p := range m.printers {
+		if perr := p.Error(item, err); perr != nil && res == nil {
+			res = perr
+		}
+	}
+	return res
+}
+
+// ScannerError is the error callback function for the scanner. All printers
+// are called, the first error returned by one of them is passed on.
+func (m *MultiPrinter) ScannerError(item string, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res error
+	for _, p := range m.printers {
+		if perr := p.ScannerError(item, err); perr != nil && res == nil {
+			res = perr
+		}
+	}
+	return res
+}
+
+// CompleteItem is the status callback function for the archiver when a
+// file/dir has been saved successfully.
+func (m *MultiPrinter) CompleteItem(messageType, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.CompleteItem(messageType, item, previous, current, s, d)
+	}
+}
+
+// SkipItem is the status callback function for the archiver when a file/dir
+// has been excluded from the backup.
+func (m *MultiPrinter) SkipItem(item string, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.SkipItem(item, reason)
+	}
+}
+
+// FilesystemBoundary is called for directories which are located on a
+// different file system than their parent directory.
+func (m *MultiPrinter) FilesystemBoundary(item string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.FilesystemBoundary(item)
+	}
+}
+
+// Dereferenced is called for symlinks which have been followed.
+func (m *MultiPrinter) Dereferenced(item, target string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.Dereferenced(item, target)
+	}
+}
+
+// ParallelRead is called for files which are read by several concurrent
+// readers.
+func (m *MultiPrinter) ParallelRead(item string, readers uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.ParallelRead(item, readers)
+	}
+}
+
+// SymlinkLoop is called for symlinks which point to a directory containing
+// them.
+func (m *MultiPrinter) SymlinkLoop(item string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.SymlinkLoop(item)
+	}
+}
+
+// SetPhase records the current phase.
+func (m *MultiPrinter) SetPhase(phase Phase) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.SetPhase(phase)
+	}
+}
+
+// SetPaused records whether the backup is paused.
+func (m *MultiPrinter) SetPaused(paused bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.SetPaused(paused)
+	}
+}
+
+// SetThrottled records whether the backup is limited by the upload limit.
+func (m *MultiPrinter) SetThrottled(throttled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.SetThrottled(throttled)
+	}
+}
+
+// SetSubtotals records the progress of the active top-level items.
+func (m *MultiPrinter) SetSubtotals(subtotals []Subtotal) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.SetSubtotals(subtotals)
+	}
+}
+
+// ReportTotal sets the total stats up to now
+func (m *MultiPrinter) ReportTotal(item string, start time.Time, s archiver.ScanStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.ReportTotal(item, start, s)
+	}
+}
+
+// Finish prints the finishing messages.
+func (m *MultiPrinter) Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.Finish(snapshotID, start, summary, dryRun)
+	}
+}
+
+// Reset status
+func (m *MultiPrinter) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.Reset()
+	}
+}
+
+// Stdout returns the writer for the standard output of the primary printer,
+// the other printers only receive the progress messages.
+func (m *MultiPrinter) Stdout() io.WriteCloser {
+	return m.printers[0].Stdout()
+}
+
+// Stderr returns the writer for the standard error of the primary printer.
+func (m *MultiPrinter) Stderr() io.WriteCloser {
+	return m.printers[0].Stderr()
+}
+
+// P prints a message via all printers.
+func (m *MultiPrinter) P(msg string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.P(msg, args...)
+	}
+}
+
+// V prints a verbose message via all printers.
+func (m *MultiPrinter) V(msg string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.printers {
+		p.V(msg, args...)
+	}
+}
@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/restic"
+)
+
+// recordingPrinter records the message types of all items it receives.
+type recordingPrinter struct {
+	mockPrinter
+	items []string
+	err   error
+}
+
+func (p *recordingPrinter) CompleteItem(messageType string, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
+	p.items = append(p.items, item)
+}
+
+func (p *recordingPrinter) Error(item string, err error) error { return p.err }
+
+func TestMultiPrinter(t *testing.T) {
+	first := &recordingPrinter{}
+	second := &recordingPrinter{err: errors.New("second")}
+	prnt := NewMultiPrinter(first, second)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				prnt.CompleteItem("file new", string(rune('a'+i)), nil, nil, archiver.ItemStats{}, 0)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(first.items) != 100 {
+		t.Errorf("expected 100 items, got %d", len(first.items))
+	}
+	if !reflect.DeepEqual(first.items, second.items) {
+		t.Errorf("printers received items in different order")
+	}
+
+	if err := prnt.Error("foo", errors.New("foo")); err != second.err {
+		t.Errorf("expected error from second printer, got %v", err)
+	}
+}
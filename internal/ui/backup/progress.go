@@ -3,21 +3,34 @@ package backup
 import (
 	"context"
 	"io"
+	"math"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend/accounting"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
 	"github.com/restic/restic/internal/ui/signals"
 )
 
 // A ProgressPrinter can print various progress messages.
 // It must be safe to call its methods from concurrent goroutines.
 type ProgressPrinter interface {
-	Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64)
+	Update(total, processed Counter, errors uint, currentFiles []string, start time.Time, secs uint64, bytesPerSec float64, newBytes, existingBytes uint64)
 	Error(item string, err error) error
 	ScannerError(item string, err error) error
 	CompleteItem(messageType string, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration)
+	SkipItem(item string, reason string)
+	FilesystemBoundary(item string)
+	Dereferenced(item, target string)
+	SymlinkLoop(item string)
+	ParallelRead(item string, readers uint)
+	SetPhase(phase Phase)
+	SetPaused(paused bool)
+	SetThrottled(throttled bool)
+	SetSubtotals(subtotals []Subtotal)
 	ReportTotal(item string, start time.Time, s archiver.ScanStats)
 	Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool)
 	Reset()
@@ -30,6 +43,33 @@ type ProgressPrinter interface {
 	V(msg string, args ...interface{})
 }
 
+// Phase describes the current state of a backup.
+type Phase uint8
+
+// The phases a backup passes through, in order.
+const (
+	// PhaseScanning is active until the first item has been processed.
+	PhaseScanning Phase = iota
+	// PhaseBackingUp is active while files and dirs are read and uploaded.
+	PhaseBackingUp
+	// PhaseFinalizing is active once all items have been saved, while the
+	// snapshot is written.
+	PhaseFinalizing
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseScanning:
+		return "scanning"
+	case PhaseBackingUp:
+		return "backing_up"
+	case PhaseFinalizing:
+		return "finalizing"
+	default:
+		return "unknown"
+	}
+}
+
 type Counter struct {
 	Files, Dirs, Bytes uint64
 }
@@ -39,11 +79,207 @@ type Summary struct {
 		New       uint
 		Changed   uint
 		Unchanged uint
+		Excluded  uint
+		// Hardlinked counts files which are hardlinks to an inode that
+		// has already been processed.
+		Hardlinked uint
+		// ChangedDuringRead counts files whose size changed while they
+		// were read, they are also counted as new or changed.
+		ChangedDuringRead uint
+		// Resumed counts files which were not read again because they had
+		// been saved by an interrupted backup.
+		Resumed uint
 	}
+	// ExcludedByPath counts the files and dirs excluded by their path, their
+	// type is not determined to avoid an Lstat call for each of them.
+	ExcludedByPath uint
 	ProcessedBytes uint64
+	// HardlinkedBytes is the size of the content of all hardlinked files,
+	// which is not included in ProcessedBytes.
+	HardlinkedBytes uint64
+	// ExistingBytes is the size of all file data which was already present
+	// in the repository.
+	ExistingBytes uint64
+	// ModifiedFileBlobs is the number of data blobs of the files which were
+	// modified since the parent snapshot, ReusedFileBlobs is the number of
+	// these blobs which were already referenced by the file in the parent.
+	ModifiedFileBlobs, ReusedFileBlobs uint64
+	// Compression is the compression level used for new data, it is empty if
+	// the repository does not support compression.
+	Compression string
+	// Backend contains the requests and transferred bytes of the backend, it
+	// is nil if they were not recorded.
+	Backend *accounting.Stats
+	// Errors contains the first errors reported during the backup, at most
+	// maxCollectedErrors. ErrorCount is the number of all errors.
+	Errors     []ItemError
+	ErrorCount uint
 	archiver.ItemStats
 }
 
+// CompressionRatio returns the ratio of the size of the data and metadata
+// added to the repository before and after compression. The ratio is at least
+// 1, which is also returned when nothing was stored or compression is
+// disabled, in which case only the encryption overhead would be measured.
+func (s *Summary) CompressionRatio() float64 {
+	size := s.ItemStats.DataSize + s.ItemStats.TreeSize
+	stored := s.ItemStats.DataSizeInRepo + s.ItemStats.TreeSizeInRepo
+	if size == 0 || stored == 0 || stored >= size {
+		return 1
+	}
+	return float64(size) / float64(stored)
+}
+
+// DedupRatio returns the fraction of the processed bytes which were already
+// present in the repository, between 0 and 1. If no bytes were processed, it
+// returns 0.
+func (s *Summary) DedupRatio() float64 {
+	if s.ProcessedBytes == 0 || s.ItemStats.DataSize >= s.ProcessedBytes {
+		return 0
+	}
+	return float64(s.ProcessedBytes-s.ItemStats.DataSize) / float64(s.ProcessedBytes)
+}
+
+// ParentReuseRatio returns the fraction of the data blobs of modified files
+// which were already referenced by the same file in the parent snapshot,
+// between 0 and 1. If no file was modified, it returns 0.
+func (s *Summary) ParentReuseRatio() float64 {
+	if s.ModifiedFileBlobs == 0 {
+		return 0
+	}
+	return float64(s.ReusedFileBlobs) / float64(s.ModifiedFileBlobs)
+}
+
+// ErrorReasons groups the collected errors by their reason, sorted by
+// decreasing count.
+func (s *Summary) ErrorReasons() []ErrorReason {
+	return groupErrors(s.Errors)
+}
+
+// throughputWindow is the time span over which the throughput passed to
+// ProgressPrinter.Update is averaged.
+const throughputWindow = 30 * time.Second
+
+// throughputSamples is the number of samples kept for calculating the
+// throughput.
+const throughputSamples = 64
+
+type throughputSample struct {
+	t     time.Time
+	bytes uint64
+}
+
+// throughput computes a moving average of the processed bytes per second. It
+// keeps a ring buffer of the most recent samples.
+type throughput struct {
+	samples [throughputSamples]throughputSample
+	next    int
+	n       int
+}
+
+// add records the number of processed bytes at time now. Samples are only
+// stored if enough time has passed since the previous one, so that the ring
+// buffer covers the whole window regardless of the update interval.
+func (t *throughput) add(now time.Time, bytes uint64) {
+	if t.n > 0 {
+		last := t.samples[(t.next+throughputSamples-1)%throughputSamples]
+		if now.Sub(last.t) < throughputWindow/throughputSamples {
+			return
+		}
+	}
+
+	t.samples[t.next] = throughputSample{t: now, bytes: bytes}
+	t.next = (t.next + 1) % throughputSamples
+	if t.n < throughputSamples {
+		t.n++
+	}
+}
+
+// rate returns the average number of bytes per second processed within the
+// window before now, or zero if not enough samples are available yet.
+func (t *throughput) rate(now time.Time, bytes uint64) float64 {
+	// find the oldest sample within the window
+	var oldest *throughputSample
+	for i := 0; i < t.n; i++ {
+		s := &t.samples[(t.next+throughputSamples-t.n+i)%throughputSamples]
+		if now.Sub(s.t) <= throughputWindow {
+			oldest = s
+			break
+		}
+	}
+
+	if oldest == nil || bytes < oldest.bytes {
+		return 0
+	}
+
+	secs := now.Sub(oldest.t).Seconds()
+	if secs <= 0 {
+		return 0
+	}
+
+	return float64(bytes-oldest.bytes) / secs
+}
+
+// inodeKey identifies a file by its device and inode number.
+type inodeKey struct {
+	device, inode uint64
+}
+
+// isHardlink returns true if node is a file with several links whose inode
+// has already been seen. It must be called with p.mu held.
+func (p *Progress) isHardlink(node *restic.Node) bool {
+	if node.Type != "file" || node.Links < 2 {
+		return false
+	}
+
+	key := inodeKey{device: node.DeviceID, inode: node.Inode}
+	if _, ok := p.inodes[key]; ok {
+		return true
+	}
+	p.inodes[key] = struct{}{}
+	return false
+}
+
+// currentFiles tracks the files which are currently being processed in the
+// order in which they were started.
+type currentFiles struct {
+	order []string
+	set   map[string]struct{}
+}
+
+func newCurrentFiles() currentFiles {
+	return currentFiles{set: make(map[string]struct{})}
+}
+
+// add appends filename unless it is already tracked.
+func (c *currentFiles) add(filename string) {
+	if _, ok := c.set[filename]; ok {
+		return
+	}
+	c.set[filename] = struct{}{}
+	c.order = append(c.order, filename)
+}
+
+// remove stops tracking filename, the order of the remaining files is kept.
+func (c *currentFiles) remove(filename string) {
+	if _, ok := c.set[filename]; !ok {
+		return
+	}
+	delete(c.set, filename)
+
+	for i, name := range c.order {
+		if name == filename {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// list returns a copy of the tracked files, oldest first.
+func (c *currentFiles) list() []string {
+	return append([]string(nil), c.order...)
+}
+
 // Progress reports progress for the `backup` command.
 type Progress struct {
 	mu sync.Mutex
@@ -51,27 +287,135 @@ type Progress struct {
 	interval time.Duration
 	start    time.Time
 
-	scanStarted, scanFinished bool
+	phase Phase
+	// scanFinished is set once the scanner has reported the final totals.
+	scanFinished bool
 
-	currentFiles     map[string]struct{}
+	currentFiles     currentFiles
 	processed, total Counter
 	errors           uint
+	throughput       throughput
 
 	closed chan struct{}
 
 	summary Summary
 	printer ProgressPrinter
+
+	// newBytes is the size of all saved data blobs which were not yet
+	// present in the repository.
+	newBytes uint64
+
+	// uploadLimit is the configured upload limit in bytes per second, zero
+	// means unlimited. throttled is set while the rate of new data reaches
+	// the limit.
+	uploadLimit   uint64
+	newThroughput throughput
+	throttled     bool
+
+	subtotals subtotals
+
+	// changedDuringRead contains the files whose size changed while they
+	// were read and which have not been completed yet.
+	changedDuringRead map[string]struct{}
+
+	// resumed contains the files which have been saved by an interrupted
+	// backup and which have not been completed yet.
+	resumed map[string]struct{}
+
+	// inodes contains all files with more than one link seen so far.
+	inodes map[inodeKey]struct{}
+
+	// pausedAt is set while the backup is paused, pausedTotal is the sum of
+	// all completed pauses.
+	pausedAt    time.Time
+	pausedTotal time.Duration
+
+	// minPercentDelta is the minimum change of the processed percentage
+	// between two regular status updates, lastPercent is the percentage at
+	// the last update.
+	minPercentDelta float64
+	lastPercent     float64
+
+	// ETAByteWeight is the weight of the byte rate when estimating the
+	// remaining time, the file rate is weighted with 1-ETAByteWeight.
+	ETAByteWeight float64
+
+	// PauseGate is toggled when SIGUSR2 is received. If it is nil, pausing
+	// is disabled. It must be set before Run is called.
+	PauseGate *archiver.PauseGate
 }
 
-func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
+// NewProgress returns a new progress reporter. uploadLimit is the upload
+// limit in bytes per second, which is taken into account for the estimated
+// remaining time. If it is zero, uploads are not limited.
+func NewProgress(printer ProgressPrinter, interval time.Duration, uploadLimit uint64) *Progress {
 	return &Progress{
-		interval: interval,
-		start:    time.Now(),
+		interval:    interval,
+		start:       time.Now(),
+		uploadLimit: uploadLimit,
 
-		currentFiles: make(map[string]struct{}),
+		currentFiles: newCurrentFiles(),
 		closed:       make(chan struct{}),
+		inodes:       make(map[inodeKey]struct{}),
+
+		changedDuringRead: make(map[string]struct{}),
+		resumed:           make(map[string]struct{}),
+		subtotals:         newSubtotals(),
 
 		printer: printer,
+
+		ETAByteWeight: 0.7,
+	}
+}
+
+// throttledFraction is the fraction of the upload limit above which the rate
+// of new data is considered to be limited by it.
+const throttledFraction = 0.9
+
+// isThrottled returns true if newBytesPerSec is close to uploadLimit.
+func isThrottled(newBytesPerSec float64, uploadLimit uint64) bool {
+	return uploadLimit > 0 && newBytesPerSec >= throttledFraction*float64(uploadLimit)
+}
+
+// estimateUploadSeconds returns the number of seconds needed to upload the
+// new data for the remaining bytes at uploadLimit bytes per second. The
+// fraction of new data is assumed to stay the same as for the processed
+// bytes. If uploadLimit is zero, it returns zero.
+func estimateUploadSeconds(total, processed Counter, newBytes, uploadLimit uint64) uint64 {
+	if uploadLimit == 0 || processed.Bytes == 0 || total.Bytes <= processed.Bytes {
+		return 0
+	}
+
+	newFraction := float64(newBytes) / float64(processed.Bytes)
+	if newFraction > 1 {
+		newFraction = 1
+	}
+	return uint64(float64(total.Bytes-processed.Bytes) * newFraction / float64(uploadLimit))
+}
+
+// estimateSecondsRemaining returns the estimated number of seconds until all
+// files and bytes are processed, based on the average rates since start.
+// The byte and file based estimates are blended according to byteWeight.
+func estimateSecondsRemaining(total, processed Counter, elapsed time.Duration, byteWeight float64) uint64 {
+	if elapsed <= 0 {
+		return 0
+	}
+
+	haveBytes := processed.Bytes > 0 && total.Bytes > processed.Bytes
+	haveFiles := processed.Files > 0 && total.Files > processed.Files
+	byteSecs := float64(progress.EstimateSecondsRemaining(total.Bytes, processed.Bytes, 0, elapsed))
+	fileSecs := float64(progress.EstimateSecondsRemaining(total.Files, processed.Files, 0, elapsed))
+
+	switch {
+	case haveBytes && haveFiles:
+		return uint64(byteWeight*byteSecs + (1-byteWeight)*fileSecs)
+	case haveBytes:
+		// all files are done (or no file rate is known yet) but bytes remain
+		return uint64(byteSecs)
+	case haveFiles:
+		return uint64(fileSecs)
+	default:
+		return 0
 	}
 }
 
@@ -91,56 +435,186 @@ func (p *Progress) Run(ctx context.Context) {
 
 	signalsCh := signals.GetProgressChannel()
 
+	var pauseCh <-chan os.Signal
+	if p.PauseGate != nil {
+		pauseCh = signals.GetPauseChannel()
+	}
+
 	for {
 		var now time.Time
+		// status updates requested by the user must always be shown
+		forced := false
 		select {
 		case <-ctx.Done():
 			return
 		case now = <-tick:
 		case <-signalsCh:
 			now = time.Now()
+			forced = true
+		case <-pauseCh:
+			now = time.Now()
+			forced = true
+			p.togglePause(now)
 		}
 
 		p.mu.Lock()
-		if p.scanStarted {
-			p.mu.Unlock()
-			continue
+		var secondsRemaining uint64
+		if p.phase == PhaseBackingUp && p.scanFinished && p.pausedAt.IsZero() {
+			elapsed := now.Sub(p.start) - p.pausedTotal
+			secondsRemaining = estimateSecondsRemaining(p.total, p.processed, elapsed, p.ETAByteWeight)
+			if secs := estimateUploadSeconds(p.total, p.processed, p.newBytes, p.uploadLimit); secs > secondsRemaining {
+				secondsRemaining = secs
+			}
 		}
 
-		var secondsRemaining uint64
-		if p.scanFinished {
-			secs := float64(now.Sub(p.start) / time.Second)
-			todo := float64(p.total.Bytes - p.processed.Bytes)
-			secondsRemaining = uint64(secs / float64(p.processed.Bytes) * todo)
+		var bytesPerSec float64
+		if p.pausedAt.IsZero() {
+			p.throughput.add(now, p.processed.Bytes)
+			bytesPerSec = p.throughput.rate(now, p.processed.Bytes)
+
+			if p.uploadLimit > 0 {
+				p.newThroughput.add(now, p.newBytes)
+				p.setThrottled(isThrottled(p.newThroughput.rate(now, p.newBytes), p.uploadLimit))
+			}
+		}
+
+		if !p.percentDeltaReached() && !forced {
+			p.mu.Unlock()
+			continue
 		}
 
-		p.printer.Update(p.total, p.processed, p.errors, p.currentFiles, p.start, secondsRemaining)
+		p.printer.SetSubtotals(p.subtotals.list())
+		p.printer.Update(p.total, p.processed, p.errors, p.currentFiles.list(), p.start, secondsRemaining, bytesPerSec, p.newBytes, p.summary.ExistingBytes)
 		p.mu.Unlock()
 	}
 }
 
+// SetMinPercentDelta configures Run to skip regular status updates until the
+// percentage of processed bytes has changed by at least delta since the last
+// update. This avoids flooding logs when the output is not a terminal.
+// Updates requested via a signal are always shown. It must be called before
+// Run.
+func (p *Progress) SetMinPercentDelta(delta float64) {
+	p.mu.Lock()
+	p.minPercentDelta = delta
+	p.mu.Unlock()
+}
+
+// SetCompression records the compression level used for new data, it is
+// reported in the summary.
+func (p *Progress) SetCompression(level string) {
+	p.mu.Lock()
+	p.summary.Compression = level
+	p.mu.Unlock()
+}
+
+// SetBackendStats records the backend counters, they are reported in the
+// summary.
+func (p *Progress) SetBackendStats(stats accounting.Stats) {
+	p.mu.Lock()
+	p.summary.Backend = &stats
+	p.mu.Unlock()
+}
+
+// percentDeltaReached returns true if the processed percentage has changed
+// enough since the last update, see SetMinPercentDelta. The caller must hold
+// p.mu.
+func (p *Progress) percentDeltaReached() bool {
+	var percent float64
+	if p.total.Bytes > 0 {
+		percent = 100 * float64(p.processed.Bytes) / float64(p.total.Bytes)
+	}
+
+	if p.minPercentDelta > 0 && math.Abs(percent-p.lastPercent) < p.minPercentDelta {
+		return false
+	}
+
+	p.lastPercent = percent
+	return true
+}
+
+// togglePause pauses or resumes the backup. The time spent paused is excluded
+// from the remaining time estimate, and the throughput is calculated only from
+// samples taken after resuming.
+func (p *Progress) togglePause(now time.Time) {
+	paused := p.PauseGate.Toggle()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if paused {
+		p.pausedAt = now
+	} else {
+		p.pausedTotal += now.Sub(p.pausedAt)
+		p.pausedAt = time.Time{}
+		p.throughput = throughput{}
+		p.newThroughput = throughput{}
+	}
+	p.printer.SetPaused(paused)
+}
+
+// setThrottled notifies the printer when the backup becomes limited by the
+// upload limit or no longer is. It must be called with p.mu held.
+func (p *Progress) setThrottled(throttled bool) {
+	if throttled == p.throttled {
+		return
+	}
+	p.throttled = throttled
+	p.printer.SetThrottled(throttled)
+}
+
 // Error is the error callback function for the archiver, it prints the error and returns nil.
 func (p *Progress) Error(item string, err error) error {
 	p.mu.Lock()
 	p.errors++
-	p.scanStarted = true
+	if len(p.summary.Errors) < maxCollectedErrors {
+		p.summary.Errors = append(p.summary.Errors, ItemError{Item: item, Err: err})
+	}
+	p.summary.ErrorCount = p.errors
+	p.setPhase(PhaseBackingUp)
 	p.mu.Unlock()
 
 	return p.printer.Error(item, err)
 }
 
+// StartTarget is called by the archiver before a target is saved.
+func (p *Progress) StartTarget(item string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subtotals.addTarget(item)
+}
+
+// ReportTopLevel records the total stats for a top-level item found by the
+// scanner.
+func (p *Progress) ReportTopLevel(item string, s archiver.ScanStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subtotals.reportTotal(item, s)
+}
+
 // StartFile is called when a file is being processed by a worker.
 func (p *Progress) StartFile(filename string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.currentFiles[filename] = struct{}{}
+	p.currentFiles.add(filename)
 }
 
 func (p *Progress) addProcessed(c Counter) {
 	p.processed.Files += c.Files
 	p.processed.Dirs += c.Dirs
 	p.processed.Bytes += c.Bytes
-	p.scanStarted = true
+	p.setPhase(PhaseBackingUp)
+}
+
+// setPhase switches to the given phase and informs the printer. Phases only
+// advance, attempts to return to an earlier phase are ignored. The caller
+// must hold p.mu.
+func (p *Progress) setPhase(phase Phase) {
+	if phase <= p.phase {
+		return
+	}
+	p.phase = phase
+	p.printer.SetPhase(phase)
 }
 
 // CompleteBlob is called for all saved blobs for files.
@@ -150,6 +624,34 @@ func (p *Progress) CompleteBlob(bytes uint64) {
 	p.mu.Unlock()
 }
 
+// BlobSaved is called for all saved data blobs, known is true if the blob
+// was already present in the repository.
+func (p *Progress) BlobSaved(bytes uint64, known bool) {
+	p.mu.Lock()
+	if known {
+		p.summary.ExistingBytes += bytes
+	} else {
+		p.newBytes += bytes
+	}
+	p.mu.Unlock()
+}
+
+// ChangedDuringRead is called by the archiver for files whose size changed
+// while they were read.
+func (p *Progress) ChangedDuringRead(item string, size, read uint64) {
+	p.mu.Lock()
+	p.changedDuringRead[item] = struct{}{}
+	p.mu.Unlock()
+}
+
+// ResumeFile is called by the archiver for files which are not read again
+// because they have been saved by an interrupted backup.
+func (p *Progress) ResumeFile(item string) {
+	p.mu.Lock()
+	p.resumed[item] = struct{}{}
+	p.mu.Unlock()
+}
+
 // CompleteItem is the status callback function for the archiver when a
 // file/dir has been saved successfully.
 func (p *Progress) CompleteItem(item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
@@ -157,16 +659,39 @@ func (p *Progress) CompleteItem(item string, previous, current *restic.Node, s a
 	p.summary.ItemStats.Add(s)
 
 	// for the last item "/", current is nil
+	hardlink := false
 	if current != nil {
-		p.summary.ProcessedBytes += current.Size
+		// the content of hardlinks is only counted once
+		hardlink = p.isHardlink(current)
+		if hardlink {
+			p.summary.HardlinkedBytes += current.Size
+		} else {
+			p.summary.ProcessedBytes += current.Size
+		}
+
+		switch current.Type {
+		case "dir":
+			p.subtotals.complete(item, true, Counter{Dirs: 1})
+		case "file":
+			c := Counter{Files: 1}
+			if !hardlink {
+				c.Bytes = current.Size
+			}
+			p.subtotals.complete(item, false, c)
+		}
 	}
 
 	p.mu.Unlock()
 
 	if current == nil {
-		// error occurred, tell the status display to remove the line
 		p.mu.Lock()
-		delete(p.currentFiles, item)
+		if item == "/" {
+			// the root tree has been saved, only the snapshot is left
+			p.setPhase(PhaseFinalizing)
+		} else {
+			// error occurred, tell the status display to remove the line
+			p.currentFiles.remove(item)
+		}
 		p.mu.Unlock()
 		return
 	}
@@ -200,10 +725,38 @@ func (p *Progress) CompleteItem(item string, previous, current *restic.Node, s a
 	case "file":
 		p.mu.Lock()
 		p.addProcessed(Counter{Files: 1})
-		delete(p.currentFiles, item)
+		p.currentFiles.remove(item)
+		_, changedDuringRead := p.changedDuringRead[item]
+		delete(p.changedDuringRead, item)
+		_, resumed := p.resumed[item]
+		delete(p.resumed, item)
 		p.mu.Unlock()
 
 		switch {
+		case resumed:
+			p.printer.CompleteItem("file resumed", item, previous, current, s, d)
+			p.mu.Lock()
+			p.summary.Files.Resumed++
+			p.mu.Unlock()
+
+		case changedDuringRead:
+			p.printer.CompleteItem("file changed during read", item, previous, current, s, d)
+			p.mu.Lock()
+			p.summary.Files.ChangedDuringRead++
+			if previous == nil {
+				p.summary.Files.New++
+			} else {
+				p.summary.Files.Changed++
+				p.addParentReuse(previous, current)
+			}
+			p.mu.Unlock()
+
+		case hardlink:
+			p.printer.CompleteItem("file hardlink", item, previous, current, s, d)
+			p.mu.Lock()
+			p.summary.Files.Hardlinked++
+			p.mu.Unlock()
+
 		case previous == nil:
 			p.printer.CompleteItem("file new", item, previous, current, s, d)
 			p.mu.Lock()
@@ -220,11 +773,66 @@ func (p *Progress) CompleteItem(item string, previous, current *restic.Node, s a
 			p.printer.CompleteItem("file modified", item, previous, current, s, d)
 			p.mu.Lock()
 			p.summary.Files.Changed++
+			p.addParentReuse(previous, current)
 			p.mu.Unlock()
 		}
 	}
 }
 
+// addParentReuse counts the data blobs of the modified file current which
+// were already referenced by the file in the parent snapshot. It must be
+// called with p.mu held.
+func (p *Progress) addParentReuse(previous, current *restic.Node) {
+	blobs := restic.NewIDSet(previous.Content...)
+	for _, id := range current.Content {
+		if blobs.Has(id) {
+			p.summary.ReusedFileBlobs++
+		}
+	}
+	p.summary.ModifiedFileBlobs += uint64(len(current.Content))
+}
+
+// SkipFile is the callback function for the archiver when a file/dir has been
+// excluded from the backup. If fi is nil, the type of the item is not known.
+func (p *Progress) SkipFile(item string, fi os.FileInfo, reason string) {
+	p.mu.Lock()
+	switch {
+	case fi == nil:
+		p.summary.ExcludedByPath++
+	case fi.IsDir():
+		p.summary.Dirs.Excluded++
+	default:
+		p.summary.Files.Excluded++
+	}
+	p.mu.Unlock()
+
+	p.printer.SkipItem(item, reason)
+}
+
+// FilesystemBoundary is called by the archiver for directories which are
+// located on a different file system than their parent directory.
+func (p *Progress) FilesystemBoundary(item string) {
+	p.printer.FilesystemBoundary(item)
+}
+
+// Dereferenced is called by the archiver for symlinks which have been
+// followed.
+func (p *Progress) Dereferenced(item, target string) {
+	p.printer.Dereferenced(item, target)
+}
+
+// SymlinkLoop is called by the archiver for symlinks which have not been
+// followed because they point to a directory containing them.
+func (p *Progress) SymlinkLoop(item string) {
+	p.printer.SymlinkLoop(item)
+}
+
+// ParallelRead is called by the archiver for large files which are read by
+// several concurrent readers.
+func (p *Progress) ParallelRead(item string, readers uint) {
+	p.printer.ParallelRead(item, readers)
+}
+
 // ReportTotal sets the total stats up to now
 func (p *Progress) ReportTotal(item string, s archiver.ScanStats) {
 	p.mu.Lock()
@@ -234,7 +842,7 @@ func (p *Progress) ReportTotal(item string, s archiver.ScanStats) {
 
 	if item == "" {
 		p.printer.ReportTotal(item, p.start, s)
-		p.scanStarted = true
+		p.scanFinished = true
 		return
 	}
 }
@@ -3,6 +3,7 @@ package backup
 import (
 	"context"
 	"io"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -15,9 +16,10 @@ type mockPrinter struct {
 	sync.Mutex
 	dirUnchanged, fileNew bool
 	id                    restic.ID
+	phases                []Phase
 }
 
-func (p *mockPrinter) Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64) {
+func (p *mockPrinter) Update(total, processed Counter, errors uint, currentFiles []string, start time.Time, secs uint64, bytesPerSec float64, newBytes, existingBytes uint64) {
 }
 func (p *mockPrinter) Error(item string, err error) error        { return err }
 func (p *mockPrinter) ScannerError(item string, err error) error { return err }
@@ -34,6 +36,26 @@ func (p *mockPrinter) CompleteItem(messageType string, item string, previous, cu
 	}
 }
 
+func (p *mockPrinter) SkipItem(item string, reason string) {}
+
+func (p *mockPrinter) FilesystemBoundary(item string)         {}
+func (p *mockPrinter) Dereferenced(item, target string)       {}
+func (p *mockPrinter) ParallelRead(item string, readers uint) {}
+func (p *mockPrinter) SymlinkLoop(item string)                {}
+
+func (p *mockPrinter) SetPaused(paused bool) {}
+
+func (p *mockPrinter) SetThrottled(throttled bool) {}
+
+func (p *mockPrinter) SetSubtotals(subtotals []Subtotal) {}
+
+func (p *mockPrinter) SetPhase(phase Phase) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.phases = append(p.phases, phase)
+}
+
 func (p *mockPrinter) ReportTotal(_ string, _ time.Time, _ archiver.ScanStats) {}
 func (p *mockPrinter) Finish(id restic.ID, _ time.Time, summary *Summary, dryRun bool) {
 	p.Lock()
@@ -55,7 +77,7 @@ func TestProgress(t *testing.T) {
 	t.Parallel()
 
 	prnt := &mockPrinter{}
-	prog := NewProgress(prnt, time.Millisecond)
+	prog := NewProgress(prnt, time.Millisecond, 0)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go prog.Run(ctx)
@@ -69,6 +91,8 @@ func TestProgress(t *testing.T) {
 	// "file new"
 	node.Type = "file"
 	prog.CompleteItem("foo", nil, &node, archiver.ItemStats{}, 0)
+	// root tree saved
+	prog.CompleteItem("/", nil, nil, archiver.ItemStats{}, 0)
 
 	time.Sleep(10 * time.Millisecond)
 	cancel()
@@ -84,4 +108,303 @@ func TestProgress(t *testing.T) {
 	if prnt.id != id {
 		t.Errorf("id not stored (has %v)", prnt.id)
 	}
+	wantPhases := []Phase{PhaseBackingUp, PhaseFinalizing}
+	if !reflect.DeepEqual(prnt.phases, wantPhases) {
+		t.Errorf("wrong phase transitions, want %v, got %v", wantPhases, prnt.phases)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	var tp throughput
+	start := time.Unix(1000, 0)
+
+	// no samples and no processed bytes during the scan phase
+	if r := tp.rate(start, 0); r != 0 {
+		t.Errorf("expected zero rate without samples, got %v", r)
+	}
+	tp.add(start, 0)
+	if r := tp.rate(start, 0); r != 0 {
+		t.Errorf("expected zero rate for a single sample, got %v", r)
+	}
+
+	for i := 1; i <= 10; i++ {
+		now := start.Add(time.Duration(i) * time.Second)
+		tp.add(now, uint64(i)*1000)
+	}
+	now := start.Add(10 * time.Second)
+	if r := tp.rate(now, 10000); r != 1000 {
+		t.Errorf("expected rate 1000, got %v", r)
+	}
+
+	// samples older than the window must be ignored
+	for i := 11; i <= 100; i++ {
+		now = start.Add(time.Duration(i) * time.Second)
+		tp.add(now, 10000+uint64(i-10)*2000)
+	}
+	if r := tp.rate(now, 10000+90*2000); r != 2000 {
+		t.Errorf("expected rate 2000, got %v", r)
+	}
+}
+
+func TestEstimateSecondsRemaining(t *testing.T) {
+	for _, test := range []struct {
+		total, processed Counter
+		elapsed          time.Duration
+		weight           float64
+		want             uint64
+	}{
+		// nothing processed yet
+		{Counter{Files: 10, Bytes: 1000}, Counter{}, 10 * time.Second, 0.7, 0},
+		// byte and file rates agree
+		{Counter{Files: 10, Bytes: 1000}, Counter{Files: 5, Bytes: 500}, 10 * time.Second, 0.7, 10},
+		// blended: 10s by bytes, 90s by files
+		{Counter{Files: 100, Bytes: 1000}, Counter{Files: 10, Bytes: 500}, 10 * time.Second, 0.7, 34},
+		{Counter{Files: 100, Bytes: 1000}, Counter{Files: 10, Bytes: 500}, 10 * time.Second, 1, 10},
+		// all files done, but bytes remain
+		{Counter{Files: 10, Bytes: 1000}, Counter{Files: 10, Bytes: 500}, 10 * time.Second, 0.7, 10},
+		// all bytes done, but files remain
+		{Counter{Files: 10, Bytes: 1000}, Counter{Files: 5, Bytes: 1000}, 10 * time.Second, 0.7, 10},
+		// everything done
+		{Counter{Files: 10, Bytes: 1000}, Counter{Files: 10, Bytes: 1000}, 10 * time.Second, 0.7, 0},
+		// no time elapsed
+		{Counter{Files: 10, Bytes: 1000}, Counter{Files: 5, Bytes: 500}, 0, 0.7, 0},
+	} {
+		got := estimateSecondsRemaining(test.total, test.processed, test.elapsed, test.weight)
+		if got != test.want {
+			t.Errorf("estimateSecondsRemaining(%v, %v, %v, %v) = %v, want %v",
+				test.total, test.processed, test.elapsed, test.weight, got, test.want)
+		}
+	}
+}
+
+func TestCurrentFiles(t *testing.T) {
+	c := newCurrentFiles()
+	for _, name := range []string{"c", "a", "b", "a", "d"} {
+		c.add(name)
+	}
+	c.remove("a")
+	c.remove("missing")
+	c.add("a")
+
+	want := []string{"c", "b", "d", "a"}
+	got := c.list()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong order, want %v, got %v", want, got)
+	}
+	if len(c.set) != len(want) {
+		t.Errorf("set has %d entries, want %d", len(c.set), len(want))
+	}
+
+	// the returned list must not be affected by later changes
+	c.remove("c")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("list was modified, want %v, got %v", want, got)
+	}
+}
+
+func TestProgressPause(t *testing.T) {
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, 0, 0)
+	prog.PauseGate = archiver.NewPauseGate()
+
+	start := prog.start
+	prog.togglePause(start.Add(time.Second))
+	if !prog.PauseGate.Paused() {
+		t.Fatal("gate not paused")
+	}
+
+	prog.togglePause(start.Add(11 * time.Second))
+	if prog.PauseGate.Paused() {
+		t.Fatal("gate still paused")
+	}
+	if prog.pausedTotal != 10*time.Second {
+		t.Errorf("wrong paused time, want 10s, got %v", prog.pausedTotal)
+	}
+	if !prog.pausedAt.IsZero() {
+		t.Errorf("pausedAt not reset")
+	}
+}
+
+func TestSummaryRatios(t *testing.T) {
+	for _, test := range []struct {
+		summary     Summary
+		compression float64
+		dedup       float64
+	}{
+		// nothing processed
+		{Summary{}, 1, 0},
+		// compression disabled, only encryption overhead
+		{Summary{ProcessedBytes: 1000, ItemStats: archiver.ItemStats{DataSize: 1000, DataSizeInRepo: 1032}}, 1, 0},
+		// compressed to half the size, nothing deduplicated
+		{Summary{ProcessedBytes: 1000, ItemStats: archiver.ItemStats{DataSize: 1000, DataSizeInRepo: 500}}, 2, 0},
+		// three quarters already in the repository
+		{Summary{ProcessedBytes: 1000, ItemStats: archiver.ItemStats{DataSize: 250, DataSizeInRepo: 125}}, 2, 0.75},
+		// everything already in the repository
+		{Summary{ProcessedBytes: 1000}, 1, 1},
+	} {
+		if r := test.summary.CompressionRatio(); r != test.compression {
+			t.Errorf("%+v: wrong compression ratio, want %v, got %v", test.summary, test.compression, r)
+		}
+		if r := test.summary.DedupRatio(); r != test.dedup {
+			t.Errorf("%+v: wrong dedup ratio, want %v, got %v", test.summary, test.dedup, r)
+		}
+	}
+}
+
+func TestProgressMinPercentDelta(t *testing.T) {
+	prog := NewProgress(&mockPrinter{}, 0, 0)
+
+	prog.total = Counter{Bytes: 1000}
+	if !prog.percentDeltaReached() {
+		t.Error("update without threshold suppressed")
+	}
+
+	prog.SetMinPercentDelta(10)
+	for _, test := range []struct {
+		processed uint64
+		want      bool
+	}{
+		{50, false},
+		{99, false},
+		{100, true},
+		{150, false},
+		{250, true},
+	} {
+		prog.processed.Bytes = test.processed
+		if got := prog.percentDeltaReached(); got != test.want {
+			t.Errorf("processed %v: want %v, got %v", test.processed, test.want, got)
+		}
+	}
+}
+
+func TestProgressHardlinks(t *testing.T) {
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, time.Millisecond, 0)
+
+	link := restic.Node{Type: "file", Size: 100, Links: 2, Inode: 42, DeviceID: 1}
+	other := restic.Node{Type: "file", Size: 10, Links: 2, Inode: 42, DeviceID: 2}
+	single := restic.Node{Type: "file", Size: 5, Links: 1, Inode: 23, DeviceID: 1}
+
+	prog.CompleteItem("a", nil, &link, archiver.ItemStats{}, 0)
+	prog.CompleteItem("b", nil, &link, archiver.ItemStats{}, 0)
+	prog.CompleteItem("c", nil, &other, archiver.ItemStats{}, 0)
+	prog.CompleteItem("d", nil, &single, archiver.ItemStats{}, 0)
+	prog.CompleteItem("e", nil, &single, archiver.ItemStats{}, 0)
+
+	if prog.summary.Files.Hardlinked != 1 {
+		t.Errorf("expected 1 hardlinked file, got %d", prog.summary.Files.Hardlinked)
+	}
+	if prog.summary.Files.New != 4 {
+		t.Errorf("expected 4 new files, got %d", prog.summary.Files.New)
+	}
+	if prog.summary.ProcessedBytes != 120 {
+		t.Errorf("expected 120 processed bytes, got %d", prog.summary.ProcessedBytes)
+	}
+	if prog.summary.HardlinkedBytes != 100 {
+		t.Errorf("expected 100 hardlinked bytes, got %d", prog.summary.HardlinkedBytes)
+	}
+}
+
+func TestProgressBlobSaved(t *testing.T) {
+	prog := NewProgress(&mockPrinter{}, time.Millisecond, 0)
+
+	prog.BlobSaved(100, false)
+	prog.BlobSaved(20, true)
+	prog.BlobSaved(30, true)
+
+	if prog.newBytes != 100 {
+		t.Errorf("expected 100 new bytes, got %d", prog.newBytes)
+	}
+	if prog.summary.ExistingBytes != 50 {
+		t.Errorf("expected 50 existing bytes, got %d", prog.summary.ExistingBytes)
+	}
+}
+
+func TestEstimateUploadSeconds(t *testing.T) {
+	for _, test := range []struct {
+		total, processed Counter
+		newBytes, limit  uint64
+		want             uint64
+	}{
+		// no upload limit
+		{Counter{Bytes: 1000}, Counter{Bytes: 100}, 100, 0, 0},
+		// nothing processed yet
+		{Counter{Bytes: 1000}, Counter{}, 0, 10, 0},
+		// half of the data is new, 900 bytes remain
+		{Counter{Bytes: 1000}, Counter{Bytes: 100}, 50, 10, 45},
+		// all data is already present in the repository
+		{Counter{Bytes: 1000}, Counter{Bytes: 100}, 0, 10, 0},
+		// done
+		{Counter{Bytes: 1000}, Counter{Bytes: 1000}, 1000, 10, 0},
+	} {
+		got := estimateUploadSeconds(test.total, test.processed, test.newBytes, test.limit)
+		if got != test.want {
+			t.Errorf("estimateUploadSeconds(%v, %v, %v, %v) = %v, want %v",
+				test.total, test.processed, test.newBytes, test.limit, got, test.want)
+		}
+	}
+
+	if isThrottled(1000, 0) {
+		t.Error("throttled without upload limit")
+	}
+	if !isThrottled(950, 1000) || isThrottled(500, 1000) {
+		t.Error("wrong throttled state")
+	}
+}
+
+func TestProgressChangedDuringRead(t *testing.T) {
+	prnt := &logPrinter{}
+	prog := NewProgress(prnt, time.Millisecond, 0)
+
+	node := restic.Node{Type: "file", Size: 10}
+	prog.ChangedDuringRead("/a", 5, 10)
+	prog.CompleteItem("/a", nil, &node, archiver.ItemStats{}, 0)
+	prog.CompleteItem("/b", nil, &node, archiver.ItemStats{}, 0)
+
+	want := []string{"file changed during read /a", "file new /b"}
+	if !reflect.DeepEqual(prnt.lines, want) {
+		t.Errorf("wrong messages, want %v, got %v", want, prnt.lines)
+	}
+	if prog.summary.Files.ChangedDuringRead != 1 || prog.summary.Files.New != 2 {
+		t.Errorf("wrong summary %+v", prog.summary.Files)
+	}
+}
+
+func TestProgressResumeFile(t *testing.T) {
+	prnt := &logPrinter{}
+	prog := NewProgress(prnt, time.Millisecond, 0)
+
+	node := restic.Node{Type: "file", Size: 10}
+	prog.ResumeFile("/a")
+	prog.CompleteItem("/a", nil, &node, archiver.ItemStats{}, 0)
+	prog.CompleteItem("/b", nil, &node, archiver.ItemStats{}, 0)
+
+	want := []string{"file resumed /a", "file new /b"}
+	if !reflect.DeepEqual(prnt.lines, want) {
+		t.Errorf("wrong messages, want %v, got %v", want, prnt.lines)
+	}
+	if prog.summary.Files.Resumed != 1 || prog.summary.Files.New != 1 {
+		t.Errorf("wrong summary %+v", prog.summary.Files)
+	}
+}
+
+func TestProgressParentReuse(t *testing.T) {
+	prog := NewProgress(&mockPrinter{}, time.Millisecond, 0)
+
+	ids := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	previous := restic.Node{Type: "file", Size: 30, Content: ids[:3]}
+	current := restic.Node{Type: "file", Size: 40, Content: restic.IDs{ids[0], ids[3], ids[2], ids[3]}}
+	prog.CompleteItem("/a", &previous, &current, archiver.ItemStats{}, 0)
+
+	// unchanged and new files are not counted
+	prog.CompleteItem("/b", &previous, &previous, archiver.ItemStats{}, 0)
+	prog.CompleteItem("/c", nil, &current, archiver.ItemStats{}, 0)
+
+	if prog.summary.ModifiedFileBlobs != 4 || prog.summary.ReusedFileBlobs != 2 {
+		t.Errorf("wrong number of blobs, want 4 modified and 2 reused, got %v and %v",
+			prog.summary.ModifiedFileBlobs, prog.summary.ReusedFileBlobs)
+	}
+	if ratio := prog.summary.ParentReuseRatio(); ratio != 0.5 {
+		t.Errorf("wrong ratio %v", ratio)
+	}
 }
@@ -0,0 +1,199 @@
+package backup
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+)
+
+// QuietProgress wraps a ProgressPrinter and suppresses all output unless an
+// error occurs. The most recent messages are kept and printed as context
+// before each error, errors are always printed immediately. The status is
+// never shown.
+type QuietProgress struct {
+	printer ProgressPrinter
+
+	// SummaryLine enables printing a single line after a backup without
+	// errors. Otherwise nothing is printed in this case.
+	SummaryLine bool
+
+	mu sync.Mutex
+	// context is a ring buffer of the most recent messages.
+	context  []func()
+	next, n  int
+	hasError bool
+}
+
+// assert that QuietProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &QuietProgress{}
+
+// NewQuietProgress returns a printer which only shows the output of printer
+// once an error occurs, contextLines is the number of messages shown before
+// an error.
+func NewQuietProgress(printer ProgressPrinter, contextLines int) *QuietProgress {
+	if contextLines < 1 {
+		contextLines = 1
+	}
+
+	return &QuietProgress{
+		printer: printer,
+		context: make([]func(), contextLines),
+	}
+}
+
+// record keeps fn as the most recent message, the oldest one is dropped if
+// the buffer is full.
+func (q *QuietProgress) record(fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.context[q.next] = fn
+	q.next = (q.next + 1) % len(q.context)
+	if q.n < len(q.context) {
+		q.n++
+	}
+}
+
+// flush prints all recorded messages in order and clears the buffer. It must
+// be called with q.mu held.
+func (q *QuietProgress) flush() {
+	for i := 0; i < q.n; i++ {
+		idx := (q.next + len(q.context) - q.n + i) % len(q.context)
+		q.context[idx]()
+		q.context[idx] = nil
+	}
+	q.n = 0
+}
+
+// Update is a no-op, the status is never shown.
+func (q *QuietProgress) Update(total, processed Counter, errors uint, currentFiles []string, start time.Time, secs uint64, bytesPerSec float64, newBytes, existingBytes uint64) {
+}
+
+// Error prints the recorded messages followed by the error.
+func (q *QuietProgress) Error(item string, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.flush()
+	q.hasError = true
+	return q.printer.Error(item, err)
+}
+
+// ScannerError prints the recorded messages followed by the error.
+func (q *QuietProgress) ScannerError(item string, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.flush()
+	q.hasError = true
+	return q.printer.ScannerError(item, err)
+}
+
+// CompleteItem records the message for the completed item.
+func (q *QuietProgress) CompleteItem(messageType, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
+	q.record(func() { q.printer.CompleteItem(messageType, item, previous, current, s, d) })
+}
+
+// SkipItem records the message for the excluded item.
+func (q *QuietProgress) SkipItem(item string, reason string) {
+	q.record(func() { q.printer.SkipItem(item, reason) })
+}
+
+// FilesystemBoundary records the warning for the directory.
+func (q *QuietProgress) FilesystemBoundary(item string) {
+	q.record(func() { q.printer.FilesystemBoundary(item) })
+}
+
+// Dereferenced records the message for the followed symlink.
+func (q *QuietProgress) Dereferenced(item, target string) {
+	q.record(func() { q.printer.Dereferenced(item, target) })
+}
+
+// ParallelRead records the message for the file.
+func (q *QuietProgress) ParallelRead(item string, readers uint) {
+	q.record(func() { q.printer.ParallelRead(item, readers) })
+}
+
+// SymlinkLoop records the warning for the symlink.
+func (q *QuietProgress) SymlinkLoop(item string) {
+	q.record(func() { q.printer.SymlinkLoop(item) })
+}
+
+// SetPhase records the current phase.
+func (q *QuietProgress) SetPhase(phase Phase) {
+	q.printer.SetPhase(phase)
+}
+
+// SetPaused records whether the backup is paused.
+func (q *QuietProgress) SetPaused(paused bool) {
+	q.printer.SetPaused(paused)
+}
+
+// SetThrottled records whether the backup is limited by the upload limit.
+func (q *QuietProgress) SetThrottled(throttled bool) {
+	q.printer.SetThrottled(throttled)
+}
+
+// SetSubtotals records the progress of the active top-level items.
+func (q *QuietProgress) SetSubtotals(subtotals []Subtotal) {
+	q.printer.SetSubtotals(subtotals)
+}
+
+// ReportTotal records the message for the finished scan.
+func (q *QuietProgress) ReportTotal(item string, start time.Time, s archiver.ScanStats) {
+	q.record(func() { q.printer.ReportTotal(item, start, s) })
+}
+
+// Finish prints the complete summary if an error occurred or files changed
+// while they were read. Otherwise nothing is printed, or a single line if
+// SummaryLine is set.
+func (q *QuietProgress) Finish(snapshotID restic.ID, start time.Time, summary *Summary, dryRun bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.hasError || summary.Files.ChangedDuringRead > 0 {
+		q.printer.Finish(snapshotID, start, summary, dryRun)
+		return
+	}
+
+	if !q.SummaryLine {
+		return
+	}
+
+	snapshot := "snapshot " + snapshotID.Str()
+	if dryRun {
+		snapshot = "dry run"
+	}
+	q.printer.P("%s: processed %v files, %v in %s\n", snapshot,
+		summary.Files.New+summary.Files.Changed+summary.Files.Unchanged+summary.Files.Hardlinked+summary.Files.Resumed,
+		ui.FormatBytes(summary.ProcessedBytes),
+		ui.FormatDuration(time.Since(start)),
+	)
+}
+
+// Reset is a no-op, the status is never shown.
+func (q *QuietProgress) Reset() {}
+
+// Stdout returns the writer for the standard output of the wrapped printer.
+func (q *QuietProgress) Stdout() io.WriteCloser {
+	return q.printer.Stdout()
+}
+
+// Stderr returns the writer for the standard error of the wrapped printer.
+func (q *QuietProgress) Stderr() io.WriteCloser {
+	return q.printer.Stderr()
+}
+
+// P records the message.
+func (q *QuietProgress) P(msg string, args ...interface{}) {
+	q.record(func() { q.printer.P(msg, args...) })
+}
+
+// V records the verbose message.
+func (q *QuietProgress) V(msg string, args ...interface{}) {
+	q.record(func() { q.printer.V(msg, args...) })
+}
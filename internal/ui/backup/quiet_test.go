@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/restic"
+)
+
+// logPrinter records all messages it prints.
+type logPrinter struct {
+	mockPrinter
+	lines []string
+}
+
+func (p *logPrinter) CompleteItem(messageType string, item string, previous, current *restic.Node, s archiver.ItemStats, d time.Duration) {
+	p.lines = append(p.lines, messageType+" "+item)
+}
+
+func (p *logPrinter) Error(item string, err error) error {
+	p.lines = append(p.lines, "error "+item)
+	return nil
+}
+
+func (p *logPrinter) Finish(id restic.ID, _ time.Time, summary *Summary, dryRun bool) {
+	p.lines = append(p.lines, "finish")
+}
+
+func (p *logPrinter) P(msg string, args ...interface{}) {
+	p.lines = append(p.lines, fmt.Sprintf(msg, args...))
+}
+
+func TestQuietProgress(t *testing.T) {
+	prnt := &logPrinter{}
+	quiet := NewQuietProgress(prnt, 2)
+
+	quiet.P("using parent snapshot")
+	quiet.CompleteItem("file new", "/a", nil, nil, archiver.ItemStats{}, 0)
+	quiet.CompleteItem("file new", "/b", nil, nil, archiver.ItemStats{}, 0)
+	quiet.Update(Counter{}, Counter{}, 0, nil, time.Now(), 0, 0, 0, 0)
+
+	if len(prnt.lines) != 0 {
+		t.Fatalf("unexpected output before error: %v", prnt.lines)
+	}
+
+	_ = quiet.Error("/c", errors.New("bad"))
+	_ = quiet.Error("/d", errors.New("bad"))
+	quiet.CompleteItem("file new", "/e", nil, nil, archiver.ItemStats{}, 0)
+	quiet.Finish(restic.ID{}, time.Now(), &Summary{}, false)
+
+	want := []string{"file new /a", "file new /b", "error /c", "error /d", "finish"}
+	if !reflect.DeepEqual(prnt.lines, want) {
+		t.Errorf("wrong output, want %v, got %v", want, prnt.lines)
+	}
+}
+
+func TestQuietProgressSuccess(t *testing.T) {
+	for _, summaryLine := range []bool{false, true} {
+		prnt := &logPrinter{}
+		quiet := NewQuietProgress(prnt, 2)
+		quiet.SummaryLine = summaryLine
+
+		quiet.CompleteItem("file new", "/a", nil, nil, archiver.ItemStats{}, 0)
+		summary := &Summary{ProcessedBytes: 10}
+		summary.Files.New = 1
+		quiet.Finish(restic.ID{}, time.Now(), summary, true)
+
+		var want []string
+		if summaryLine {
+			want = []string{"dry run: processed 1 files, 10 B in 0:00\n"}
+		}
+		if !reflect.DeepEqual(prnt.lines, want) {
+			t.Errorf("wrong output, want %q, got %q", want, prnt.lines)
+		}
+	}
+}
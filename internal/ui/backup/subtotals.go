@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/archiver"
+)
+
+// Subtotal is the progress for one of the top-level items of the backup, for
+// example a directory within the backed up directory.
+type Subtotal struct {
+	// Item is the path within the snapshot, directories end with a slash.
+	Item string
+	// Total is only set once the item has been scanned completely.
+	Total     Counter
+	Scanned   bool
+	Processed Counter
+}
+
+// subtotals accumulates the progress per top-level item. Top-level items are
+// the entries of the targets which are directories and all other targets.
+type subtotals struct {
+	targets map[string]struct{}
+	items   map[string]*Subtotal
+	// active contains the items which are currently being saved
+	active currentFiles
+}
+
+func newSubtotals() subtotals {
+	return subtotals{
+		targets: make(map[string]struct{}),
+		items:   make(map[string]*Subtotal),
+		active:  newCurrentFiles(),
+	}
+}
+
+// addTarget records the path of a target within the snapshot.
+func (t *subtotals) addTarget(item string) {
+	t.targets[item] = struct{}{}
+}
+
+// topLevel returns the top-level item below which item is located. For
+// targets which are a directory, ok is false.
+func (t *subtotals) topLevel(item string, isDir bool) (key string, ok bool) {
+	item = strings.TrimSuffix(item, "/")
+	for p := item; p != "/" && p != "." && p != ""; p = path.Dir(p) {
+		if _, ok := t.targets[path.Dir(p)]; ok {
+			return p, true
+		}
+		if _, ok := t.targets[p]; ok && p == item && !isDir {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func (t *subtotals) get(key string, isDir bool) *Subtotal {
+	st, ok := t.items[key]
+	if !ok {
+		st = &Subtotal{Item: key}
+		t.items[key] = st
+	}
+	if isDir && !strings.HasSuffix(st.Item, "/") {
+		st.Item += "/"
+	}
+	return st
+}
+
+// complete accounts for a saved file or directory.
+func (t *subtotals) complete(item string, isDir bool, c Counter) {
+	key, ok := t.topLevel(item, isDir)
+	if !ok {
+		return
+	}
+
+	// only directories contain other items
+	finished := key == strings.TrimSuffix(item, "/")
+	st := t.get(key, isDir || !finished)
+	st.Processed.Files += c.Files
+	st.Processed.Dirs += c.Dirs
+	st.Processed.Bytes += c.Bytes
+
+	if finished {
+		t.active.remove(key)
+	} else {
+		t.active.add(key)
+	}
+}
+
+// reportTotal records the result of scanning a top-level item.
+func (t *subtotals) reportTotal(item string, s archiver.ScanStats) {
+	st := t.get(item, s.Dirs > 0)
+	st.Total = Counter{Files: uint64(s.Files), Dirs: uint64(s.Dirs), Bytes: s.Bytes}
+	st.Scanned = true
+}
+
+// list returns the subtotals for all active items in the order in which they
+// were started.
+func (t *subtotals) list() []Subtotal {
+	keys := t.active.list()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	res := make([]Subtotal, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, *t.items[key])
+	}
+	return res
+}
@@ -0,0 +1,44 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/restic/restic/internal/archiver"
+)
+
+func TestSubtotals(t *testing.T) {
+	st := newSubtotals()
+	st.addTarget("/work")
+	st.addTarget("/other")
+
+	st.reportTotal("/work/src", archiver.ScanStats{Files: 2, Dirs: 1, Bytes: 100})
+	st.complete("/work/src/a/foo", false, Counter{Files: 1, Bytes: 40})
+	st.complete("/work/assets/logo.png", false, Counter{Files: 1, Bytes: 12})
+	st.complete("/work/src/a/", true, Counter{Dirs: 1})
+
+	want := []Subtotal{
+		{Item: "/work/src/", Total: Counter{Files: 2, Dirs: 1, Bytes: 100}, Scanned: true, Processed: Counter{Files: 1, Dirs: 1, Bytes: 40}},
+		{Item: "/work/assets/", Processed: Counter{Files: 1, Bytes: 12}},
+	}
+	if got := st.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong subtotals, want %v, got %v", want, got)
+	}
+
+	if line := formatSubtotals(want); line != "src/ 40.00%, assets/ 12 B" {
+		t.Errorf("wrong subtotals line %q", line)
+	}
+
+	// completed items and targets which are files are not active
+	st.complete("/work/src/", true, Counter{Dirs: 1})
+	st.complete("/other", false, Counter{Files: 1, Bytes: 5})
+	st.complete("/work/", true, Counter{Dirs: 1})
+
+	want = want[1:]
+	if got := st.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong subtotals, want %v, got %v", want, got)
+	}
+	if st.items["/other"].Processed.Bytes != 5 {
+		t.Errorf("file target not accounted for")
+	}
+}
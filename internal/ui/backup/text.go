@@ -2,10 +2,13 @@ package backup
 
 import (
 	"fmt"
-	"sort"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui"
 	"github.com/restic/restic/internal/ui/termstatus"
@@ -17,6 +20,21 @@ type TextProgress struct {
 	*ui.StdioWrapper
 
 	term *termstatus.Terminal
+
+	// MaxCurrentFiles limits the number of files currently being processed
+	// which are shown below the status line. If it is zero, the number is
+	// derived from the terminal height.
+	MaxCurrentFiles int
+
+	// DryRun shows how much of the processed data would be added to the
+	// repository and how much is already present.
+	DryRun bool
+
+	mu        sync.Mutex
+	phase     Phase
+	pausedAt  time.Time
+	throttled bool
+	subtotals []Subtotal
 }
 
 // assert that Backup implements the ProgressPrinter interface
@@ -32,16 +50,29 @@ func NewTextProgress(term *termstatus.Terminal, verbosity uint) *TextProgress {
 }
 
 // Update updates the status lines.
-func (b *TextProgress) Update(total, processed Counter, errors uint, currentFiles map[string]struct{}, start time.Time, secs uint64) {
+func (b *TextProgress) Update(total, processed Counter, errors uint, currentFiles []string, start time.Time, secs uint64, bytesPerSec float64, newBytes, existingBytes uint64) {
+	b.mu.Lock()
+	phase := b.phase
+	pausedAt := b.pausedAt
+	throttled := b.throttled
+	subtotals := b.subtotals
+	b.mu.Unlock()
+
+	label := phaseLabel(phase)
+	if !pausedAt.IsZero() {
+		label = fmt.Sprintf("PAUSED (%s)", ui.FormatDuration(time.Since(pausedAt)))
+	}
+
 	var status string
 	if total.Files == 0 && total.Dirs == 0 {
 		// no total count available yet
-		status = fmt.Sprintf("[%s] %v files, %s, %d errors",
+		status = fmt.Sprintf("[%s] %s %v files, %s, %d errors",
 			ui.FormatDuration(time.Since(start)),
+			label,
 			processed.Files, ui.FormatBytes(processed.Bytes), errors,
 		)
 	} else {
-		var eta, percent string
+		var eta, percent, rate string
 
 		if secs > 0 && processed.Bytes < total.Bytes {
 			eta = fmt.Sprintf(" ETA %s", ui.FormatSeconds(secs))
@@ -49,9 +80,17 @@ func (b *TextProgress) Update(total, processed Counter, errors uint, currentFile
 			percent += "  "
 		}
 
+		if bytesPerSec > 0 {
+			rate = fmt.Sprintf(" %s", ui.FormatRate(bytesPerSec))
+		}
+		if throttled {
+			rate += " (upload limit reached)"
+		}
+
 		// include totals
-		status = fmt.Sprintf("[%s] %s%v files %s, total %v files %v, %d errors%s",
+		status = fmt.Sprintf("[%s] %s %s%v files %s, total %v files %v, %d errors%s%s",
 			ui.FormatDuration(time.Since(start)),
+			label,
 			percent,
 			processed.Files,
 			ui.FormatBytes(processed.Bytes),
@@ -59,19 +98,105 @@ func (b *TextProgress) Update(total, processed Counter, errors uint, currentFile
 			ui.FormatBytes(total.Bytes),
 			errors,
 			eta,
+			rate,
 		)
 	}
 
-	lines := make([]string, 0, len(currentFiles)+1)
-	for filename := range currentFiles {
-		lines = append(lines, filename)
+	lines := []string{status}
+	if b.DryRun {
+		lines = append(lines, fmt.Sprintf("would add %s new, %s already present",
+			ui.FormatBytes(newBytes), ui.FormatBytes(existingBytes)))
+	}
+	if len(subtotals) > 0 {
+		lines = append(lines, formatSubtotals(subtotals))
+	}
+
+	maxFiles := b.MaxCurrentFiles
+	if maxFiles == 0 {
+		if height := b.term.Height(); height > 0 {
+			// leave room for the status lines and the cursor
+			maxFiles = height - len(lines) - 1
+			if maxFiles < 1 {
+				maxFiles = 1
+			}
+		}
+	}
+	if maxFiles > 0 && len(currentFiles) > maxFiles {
+		// currentFiles is ordered by start time, so the oldest files are kept
+		currentFiles = currentFiles[:maxFiles]
 	}
-	sort.Strings(lines)
-	lines = append([]string{status}, lines...)
+
+	lines = append(lines, currentFiles...)
 
 	b.term.SetStatus(lines)
 }
 
+// phaseLabel returns the text shown in the status line for phase.
+func phaseLabel(phase Phase) string {
+	switch phase {
+	case PhaseScanning:
+		return "Scanning..."
+	case PhaseFinalizing:
+		return "Finalizing..."
+	default:
+		return "Uploading..."
+	}
+}
+
+// SetPhase records the current phase for the status line.
+func (b *TextProgress) SetPhase(phase Phase) {
+	b.mu.Lock()
+	b.phase = phase
+	b.mu.Unlock()
+}
+
+// SetPaused records whether the backup is paused for the status line.
+func (b *TextProgress) SetPaused(paused bool) {
+	b.mu.Lock()
+	if paused {
+		b.pausedAt = time.Now()
+	} else {
+		b.pausedAt = time.Time{}
+	}
+	b.mu.Unlock()
+}
+
+// SetThrottled records whether the backup is limited by the upload limit
+// instead of reading the files, this is shown in the status line.
+func (b *TextProgress) SetThrottled(throttled bool) {
+	b.mu.Lock()
+	b.throttled = throttled
+	b.mu.Unlock()
+}
+
+// SetSubtotals records the progress of the active top-level items, it is
+// shown below the status line.
+func (b *TextProgress) SetSubtotals(subtotals []Subtotal) {
+	b.mu.Lock()
+	b.subtotals = subtotals
+	b.mu.Unlock()
+}
+
+// formatSubtotals returns a line like "src/ 40.00%, assets/ 12.00%". For
+// items which have not been scanned completely, the processed bytes are
+// shown instead.
+func formatSubtotals(subtotals []Subtotal) string {
+	items := make([]string, 0, len(subtotals))
+	for _, st := range subtotals {
+		name := path.Base(st.Item)
+		if strings.HasSuffix(st.Item, "/") {
+			name += "/"
+		}
+
+		if st.Scanned && st.Total.Bytes > 0 {
+			items = append(items, fmt.Sprintf("%s %s", name, ui.FormatPercent(st.Processed.Bytes, st.Total.Bytes)))
+		} else {
+			items = append(items, fmt.Sprintf("%s %s", name, ui.FormatBytes(st.Processed.Bytes)))
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
 // ScannerError is the error callback function for the scanner, it prints the
 // error in verbose mode and returns nil.
 func (b *TextProgress) ScannerError(item string, err error) error {
@@ -81,6 +206,10 @@ func (b *TextProgress) ScannerError(item string, err error) error {
 
 // Error is the error callback function for the archiver, it prints the error and returns nil.
 func (b *TextProgress) Error(item string, err error) error {
+	if errors.Is(err, archiver.ErrReadTimeout) {
+		b.E("timed out: %v\n", err)
+		return nil
+	}
 	b.E("error: %v\n", err)
 	return nil
 }
@@ -107,9 +236,44 @@ func (b *TextProgress) CompleteItem(messageType, item string, previous, current
 	case "file modified":
 		b.VV("modified  %v, saved in %.3fs (%v added, %v stored)", item,
 			d.Seconds(), ui.FormatBytes(s.DataSize), ui.FormatBytes(s.DataSizeInRepo))
+	case "file changed during read":
+		b.VV("changed during read %v, saved in %.3fs (%v added, %v stored)", item,
+			d.Seconds(), ui.FormatBytes(s.DataSize), ui.FormatBytes(s.DataSizeInRepo))
+	case "file hardlink":
+		b.VV("hardlink  %v (%v already processed)", item, ui.FormatBytes(current.Size))
+	case "file resumed":
+		b.VV("resumed   %v", item)
 	}
 }
 
+// SkipItem is the status callback function for the archiver when a file/dir
+// has been excluded from the backup.
+func (b *TextProgress) SkipItem(item string, reason string) {
+	b.VV("excluded  %v (%v)", item, reason)
+}
+
+// FilesystemBoundary prints a warning for a directory which is located on a
+// different file system than its parent directory.
+func (b *TextProgress) FilesystemBoundary(item string) {
+	b.E("warning: %v is on a different file system than its parent directory\n", item)
+}
+
+// Dereferenced prints a symlink which has been followed.
+func (b *TextProgress) Dereferenced(item, target string) {
+	b.V("dereferenced %v -> %v", item, target)
+}
+
+// ParallelRead prints a file which is read by several concurrent readers.
+func (b *TextProgress) ParallelRead(item string, readers uint) {
+	b.V("reading %v with %d parallel readers", item, readers)
+}
+
+// SymlinkLoop prints a warning for a symlink which has not been followed
+// because it points to a directory containing it.
+func (b *TextProgress) SymlinkLoop(item string) {
+	b.E("warning: %v points to a directory containing it, saved as symlink\n", item)
+}
+
 // ReportTotal sets the total stats up to now
 func (b *TextProgress) ReportTotal(item string, start time.Time, s archiver.ScanStats) {
 	b.V("scan finished in %.3fs: %v files, %s",
@@ -130,8 +294,28 @@ func (b *TextProgress) Finish(snapshotID restic.ID, start time.Time, summary *Su
 	b.P("\n")
 	b.P("Files:       %5d new, %5d changed, %5d unmodified\n", summary.Files.New, summary.Files.Changed, summary.Files.Unchanged)
 	b.P("Dirs:        %5d new, %5d changed, %5d unmodified\n", summary.Dirs.New, summary.Dirs.Changed, summary.Dirs.Unchanged)
+	if summary.Files.Excluded > 0 || summary.Dirs.Excluded > 0 || summary.ExcludedByPath > 0 {
+		b.V("Excluded:    %5d files, %5d dirs, %5d by path\n", summary.Files.Excluded, summary.Dirs.Excluded, summary.ExcludedByPath)
+	}
+	if summary.Files.Hardlinked > 0 {
+		b.V("Hardlinks:   %5d files, %v not counted again\n", summary.Files.Hardlinked, ui.FormatBytes(summary.HardlinkedBytes))
+	}
+	if summary.Files.Resumed > 0 {
+		b.P("Resumed:     %5d files from the checkpoint, %5d files read\n", summary.Files.Resumed, summary.Files.New+summary.Files.Changed)
+	}
+	if summary.Files.ChangedDuringRead > 0 {
+		b.E("Warning: %d files changed while they were read, their contents may be inconsistent\n", summary.Files.ChangedDuringRead)
+	}
+	if summary.ErrorCount > 0 {
+		b.P("Errors:      %s\n", formatErrorSummary(summary))
+	}
 	b.V("Data Blobs:  %5d new\n", summary.ItemStats.DataBlobs)
 	b.V("Tree Blobs:  %5d new\n", summary.ItemStats.TreeBlobs)
+	if summary.ItemStats.DataBlobsDuplicate > 0 || summary.ItemStats.DataBlobsExisting > 0 {
+		b.V("Deduplicated: %d data blobs (%v) within this backup, %d data blobs (%v) already in the repository\n",
+			summary.ItemStats.DataBlobsDuplicate, ui.FormatBytes(summary.ItemStats.DataSizeDuplicate),
+			summary.ItemStats.DataBlobsExisting, ui.FormatBytes(summary.ItemStats.DataSizeExisting))
+	}
 	verb := "Added"
 	if dryRun {
 		verb = "Would add"
@@ -139,10 +323,42 @@ func (b *TextProgress) Finish(snapshotID restic.ID, start time.Time, summary *Su
 	b.P("%s to the repository: %-5s (%-5s stored)\n", verb,
 		ui.FormatBytes(summary.ItemStats.DataSize+summary.ItemStats.TreeSize),
 		ui.FormatBytes(summary.ItemStats.DataSizeInRepo+summary.ItemStats.TreeSizeInRepo))
+	if dryRun {
+		b.P("Would add %-5s of new data, %-5s already present\n",
+			ui.FormatBytes(summary.ItemStats.DataSize), ui.FormatBytes(summary.ExistingBytes))
+	}
+	if summary.Compression != "" {
+		b.P("Compression ratio: %.2fx (level %v), deduplicated: %.2f%%\n",
+			summary.CompressionRatio(), summary.Compression, 100*summary.DedupRatio())
+	} else {
+		b.P("Compression ratio: %.2fx, deduplicated: %.2f%%\n",
+			summary.CompressionRatio(), 100*summary.DedupRatio())
+	}
+	if summary.ModifiedFileBlobs > 0 {
+		b.P("Reused from parent: %d of %d blobs of modified files (%.2f%%)\n",
+			summary.ReusedFileBlobs, summary.ModifiedFileBlobs, 100*summary.ParentReuseRatio())
+	}
+	if summary.Backend != nil {
+		b.P("Backend: %s\n", ui.FormatBackendStats(*summary.Backend))
+	}
 	b.P("\n")
 	b.P("processed %v files, %v in %s",
-		summary.Files.New+summary.Files.Changed+summary.Files.Unchanged,
+		summary.Files.New+summary.Files.Changed+summary.Files.Unchanged+summary.Files.Hardlinked+summary.Files.Resumed,
 		ui.FormatBytes(summary.ProcessedBytes),
 		ui.FormatDuration(time.Since(start)),
 	)
 }
+
+// formatErrorSummary returns a line like "23 items failed: permission denied
+// (18), no such file or directory (5)".
+func formatErrorSummary(summary *Summary) string {
+	var reasons []string
+	for _, r := range summary.ErrorReasons() {
+		reasons = append(reasons, fmt.Sprintf("%v (%d)", r.Reason, r.Count))
+	}
+	if missing := int(summary.ErrorCount) - len(summary.Errors); missing > 0 {
+		reasons = append(reasons, fmt.Sprintf("not recorded (%d)", missing))
+	}
+
+	return fmt.Sprintf("%d items failed: %v", summary.ErrorCount, strings.Join(reasons, ", "))
+}
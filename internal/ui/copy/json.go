@@ -0,0 +1,88 @@
+package copy
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// JSONProgress reports progress for the `copy` command in JSON.
+type JSONProgress struct {
+	*ui.Message
+
+	out *progress.JSONPrinter
+}
+
+// assert that JSONProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &JSONProgress{}
+
+// NewJSONProgress returns a new copy progress reporter.
+func NewJSONProgress(term *termstatus.Terminal, verbosity uint) *JSONProgress {
+	return &JSONProgress{
+		Message: ui.NewMessage(term, verbosity),
+		out:     progress.NewJSONPrinter(term),
+	}
+}
+
+// Update updates the status lines.
+func (t *JSONProgress) Update(total, processed, existing Counter, start time.Time, secs uint64) {
+	status := statusUpdate{
+		MessageType:      "status",
+		SecondsElapsed:   uint64(time.Since(start) / time.Second),
+		SecondsRemaining: secs,
+		TotalBlobs:       total.Blobs,
+		BlobsDone:        processed.Blobs,
+		TotalBytes:       total.Bytes,
+		BytesDone:        processed.Bytes,
+		ExistingBlobs:    existing.Blobs,
+		ExistingBytes:    existing.Bytes,
+	}
+
+	if total.Bytes > 0 {
+		status.PercentDone = float64(processed.Bytes) / float64(total.Bytes)
+	}
+
+	t.out.Print(status)
+}
+
+// Reset no-op
+func (t *JSONProgress) Reset() {
+}
+
+// Finish prints the finishing messages.
+func (t *JSONProgress) Finish(total, processed, existing Counter, snapshots uint, start time.Time) {
+	t.out.Print(summaryOutput{
+		MessageType:     "summary",
+		TotalDuration:   time.Since(start).Seconds(),
+		SnapshotsCopied: snapshots,
+		BlobsCopied:     processed.Blobs - existing.Blobs,
+		BytesCopied:     processed.Bytes - existing.Bytes,
+		ExistingBlobs:   existing.Blobs,
+		ExistingBytes:   existing.Bytes,
+	})
+}
+
+type statusUpdate struct {
+	MessageType      string  `json:"message_type"` // "status"
+	SecondsElapsed   uint64  `json:"seconds_elapsed,omitempty"`
+	SecondsRemaining uint64  `json:"seconds_remaining,omitempty"`
+	PercentDone      float64 `json:"percent_done"`
+	TotalBlobs       uint64  `json:"total_blobs,omitempty"`
+	BlobsDone        uint64  `json:"blobs_done,omitempty"`
+	TotalBytes       uint64  `json:"total_bytes,omitempty"`
+	BytesDone        uint64  `json:"bytes_done,omitempty"`
+	ExistingBlobs    uint64  `json:"existing_blobs,omitempty"`
+	ExistingBytes    uint64  `json:"existing_bytes,omitempty"`
+}
+
+type summaryOutput struct {
+	MessageType     string  `json:"message_type"`   // "summary"
+	TotalDuration   float64 `json:"total_duration"` // in seconds
+	SnapshotsCopied uint    `json:"snapshots_copied"`
+	BlobsCopied     uint64  `json:"blobs_copied"`
+	BytesCopied     uint64  `json:"bytes_copied"`
+	ExistingBlobs   uint64  `json:"existing_blobs"`
+	ExistingBytes   uint64  `json:"existing_bytes"`
+}
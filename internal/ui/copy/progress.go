@@ -0,0 +1,148 @@
+package copy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/restic/restic/internal/ui/signals"
+)
+
+// A ProgressPrinter can print various progress messages.
+// It must be safe to call its methods from concurrent goroutines.
+type ProgressPrinter interface {
+	Update(total, processed, existing Counter, start time.Time, secs uint64)
+	Finish(total, processed, existing Counter, snapshots uint, start time.Time)
+	Reset()
+
+	P(msg string, args ...interface{})
+	V(msg string, args ...interface{})
+}
+
+// Counter tracks a number of blobs and bytes.
+type Counter struct {
+	Blobs, Bytes uint64
+}
+
+// Progress reports progress for the `copy` command.
+type Progress struct {
+	mu sync.Mutex
+
+	interval time.Duration
+	start    time.Time
+
+	total, processed Counter
+	// existing counts the blobs which were already present in the
+	// destination repository, they are included in total and processed
+	existing  Counter
+	snapshots uint
+
+	closed chan struct{}
+
+	printer ProgressPrinter
+}
+
+// NewProgress returns a new copy progress reporter. If interval is zero, the
+// status is only printed when a signal is received.
+func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
+	return &Progress{
+		interval: interval,
+		start:    time.Now(),
+
+		closed: make(chan struct{}),
+
+		printer: printer,
+	}
+}
+
+// Run regularly updates the status lines. It should be called in a separate
+// goroutine.
+func (p *Progress) Run(ctx context.Context) {
+	defer close(p.closed)
+	// Reset status when finished
+	defer p.printer.Reset()
+
+	var tick <-chan time.Time
+	if p.interval != 0 {
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	signalsCh := signals.GetProgressChannel()
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-tick:
+		case <-signalsCh:
+			now = time.Now()
+		}
+
+		p.mu.Lock()
+		// blobs present in the destination are not taken into account for the rate
+		secondsRemaining := progress.EstimateSecondsRemaining(p.total.Bytes, p.processed.Bytes, p.existing.Bytes, now.Sub(p.start))
+		p.printer.Update(p.total, p.processed, p.existing, p.start, secondsRemaining)
+		p.mu.Unlock()
+	}
+}
+
+// AddBlob adds a blob of the given size to the set of blobs to copy.
+func (p *Progress) AddBlob(size uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total.Blobs++
+	p.total.Bytes += size
+}
+
+// ExistingBlob records a blob of the given size which is already present in
+// the destination repository and does not need to be copied.
+func (p *Progress) ExistingBlob(size uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total.Blobs++
+	p.total.Bytes += size
+	p.processed.Blobs++
+	p.processed.Bytes += size
+	p.existing.Blobs++
+	p.existing.Bytes += size
+}
+
+// CompleteBlob records that a blob of the given size, which was added with
+// AddBlob before, has been processed. If known is true, the blob was found in
+// the destination repository and was not uploaded again.
+func (p *Progress) CompleteBlob(size uint64, known bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.processed.Blobs++
+	p.processed.Bytes += size
+	if known {
+		p.existing.Blobs++
+		p.existing.Bytes += size
+	}
+}
+
+// CompleteSnapshot records that a snapshot has been copied.
+func (p *Progress) CompleteSnapshot() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.snapshots++
+}
+
+// Finish prints the finishing messages.
+func (p *Progress) Finish() {
+	// wait for the status update goroutine to shut down
+	<-p.closed
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.printer.Finish(p.total, p.processed, p.existing, p.snapshots, p.start)
+}
@@ -0,0 +1,69 @@
+package copy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockPrinter struct {
+	sync.Mutex
+	total, processed, existing Counter
+	snapshots                  uint
+	finished                   bool
+}
+
+func (p *mockPrinter) Update(total, processed, existing Counter, start time.Time, secs uint64) {
+}
+
+func (p *mockPrinter) Finish(total, processed, existing Counter, snapshots uint, start time.Time) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.total, p.processed, p.existing, p.snapshots = total, processed, existing, snapshots
+	p.finished = true
+}
+
+func (p *mockPrinter) Reset() {}
+
+func (p *mockPrinter) P(msg string, args ...interface{}) {}
+func (p *mockPrinter) V(msg string, args ...interface{}) {}
+
+func TestProgress(t *testing.T) {
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go prog.Run(ctx)
+
+	prog.AddBlob(100)
+	prog.AddBlob(50)
+	prog.AddBlob(20)
+	prog.ExistingBlob(10)
+
+	prog.CompleteBlob(100, false)
+	prog.CompleteBlob(50, true)
+	prog.CompleteBlob(20, false)
+	prog.CompleteSnapshot()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	prog.Finish()
+
+	if !prnt.finished {
+		t.Fatal("Finish not called")
+	}
+	if prnt.total != (Counter{Blobs: 4, Bytes: 180}) {
+		t.Errorf("wrong total %+v", prnt.total)
+	}
+	if prnt.processed != (Counter{Blobs: 4, Bytes: 180}) {
+		t.Errorf("wrong processed %+v", prnt.processed)
+	}
+	if prnt.existing != (Counter{Blobs: 2, Bytes: 60}) {
+		t.Errorf("wrong existing %+v", prnt.existing)
+	}
+	if prnt.snapshots != 1 {
+		t.Errorf("wrong number of snapshots %v", prnt.snapshots)
+	}
+}
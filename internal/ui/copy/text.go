@@ -0,0 +1,69 @@
+package copy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// TextProgress reports progress for the `copy` command.
+type TextProgress struct {
+	*ui.Message
+
+	term *termstatus.Terminal
+}
+
+// assert that TextProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &TextProgress{}
+
+// NewTextProgress returns a new copy progress reporter.
+func NewTextProgress(term *termstatus.Terminal, verbosity uint) *TextProgress {
+	return &TextProgress{
+		Message: ui.NewMessage(term, verbosity),
+		term:    term,
+	}
+}
+
+// Update updates the status lines.
+func (t *TextProgress) Update(total, processed, existing Counter, start time.Time, secs uint64) {
+	var eta string
+	if secs > 0 {
+		eta = fmt.Sprintf(" ETA %s", ui.FormatSeconds(secs))
+	}
+
+	status := fmt.Sprintf("[%s] %s  %v blobs %s copied, total %v blobs %v, %v blobs %s already present%s",
+		ui.FormatDuration(time.Since(start)),
+		ui.FormatPercent(processed.Bytes, total.Bytes),
+		processed.Blobs-existing.Blobs,
+		ui.FormatBytes(processed.Bytes-existing.Bytes),
+		total.Blobs,
+		ui.FormatBytes(total.Bytes),
+		existing.Blobs,
+		ui.FormatBytes(existing.Bytes),
+		eta,
+	)
+
+	t.term.SetStatus([]string{status})
+}
+
+// Reset status
+func (t *TextProgress) Reset() {
+	if t.term.CanUpdateStatus() {
+		t.term.SetStatus([]string{""})
+	}
+}
+
+// Finish prints the finishing messages.
+func (t *TextProgress) Finish(total, processed, existing Counter, snapshots uint, start time.Time) {
+	t.P("Summary: Copied %d snapshots, %d blobs (%s) in %s\n",
+		snapshots,
+		processed.Blobs-existing.Blobs, ui.FormatBytes(processed.Bytes-existing.Bytes),
+		ui.FormatDuration(time.Since(start)),
+	)
+	if existing.Blobs > 0 {
+		t.P("%d blobs (%s) were already present in the destination repository\n",
+			existing.Blobs, ui.FormatBytes(existing.Bytes))
+	}
+}
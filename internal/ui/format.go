@@ -3,6 +3,8 @@ package ui
 import (
 	"fmt"
 	"time"
+
+	"github.com/restic/restic/internal/backend/accounting"
 )
 
 func FormatBytes(c uint64) string {
@@ -21,6 +23,22 @@ func FormatBytes(c uint64) string {
 	}
 }
 
+// FormatRate formats bytesPerSec as a transfer rate, e.g. "12.3 MiB/s".
+func FormatRate(bytesPerSec float64) string {
+	switch {
+	case bytesPerSec >= 1<<40:
+		return fmt.Sprintf("%.1f TiB/s", bytesPerSec/(1<<40))
+	case bytesPerSec >= 1<<30:
+		return fmt.Sprintf("%.1f GiB/s", bytesPerSec/(1<<30))
+	case bytesPerSec >= 1<<20:
+		return fmt.Sprintf("%.1f MiB/s", bytesPerSec/(1<<20))
+	case bytesPerSec >= 1<<10:
+		return fmt.Sprintf("%.1f KiB/s", bytesPerSec/(1<<10))
+	default:
+		return fmt.Sprintf("%.0f B/s", bytesPerSec)
+	}
+}
+
 // FormatPercent formats numerator/denominator as a percentage.
 func FormatPercent(numerator uint64, denominator uint64) string {
 	if denominator == 0 {
@@ -35,6 +53,15 @@ func FormatPercent(numerator uint64, denominator uint64) string {
 	return fmt.Sprintf("%3.2f%%", percent)
 }
 
+// FormatBackendStats formats the backend counters as a single line, e.g.
+// "42 requests (12 save, 25 load, 3 stat, 2 list, 0 remove), 5.500 MiB
+// uploaded, 1.000 KiB downloaded".
+func FormatBackendStats(s accounting.Stats) string {
+	return fmt.Sprintf("%d requests (%d save, %d load, %d stat, %d list, %d remove), %s uploaded, %s downloaded",
+		s.Requests(), s.Save.Requests, s.Load.Requests, s.Stat.Requests, s.List.Requests, s.Remove.Requests,
+		FormatBytes(s.Save.Bytes), FormatBytes(s.Load.Bytes))
+}
+
 // FormatDuration formats d as FormatSeconds would.
 func FormatDuration(d time.Duration) string {
 	sec := uint64(d / time.Second)
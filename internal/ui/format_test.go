@@ -1,6 +1,10 @@
 package ui
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/backend/accounting"
+)
 
 func TestFormatBytes(t *testing.T) {
 	for _, c := range []struct {
@@ -22,6 +26,38 @@ func TestFormatBytes(t *testing.T) {
 	}
 }
 
+func TestFormatBackendStats(t *testing.T) {
+	s := accounting.Stats{
+		Save:   accounting.Operation{Requests: 12, Bytes: 5<<20 + 1<<19},
+		Load:   accounting.Operation{Requests: 25, Bytes: 1024},
+		Stat:   accounting.Operation{Requests: 3},
+		List:   accounting.Operation{Requests: 2},
+		Remove: accounting.Operation{Requests: 0},
+	}
+	want := "42 requests (12 save, 25 load, 3 stat, 2 list, 0 remove), 5.500 MiB uploaded, 1.000 KiB downloaded"
+	if got := FormatBackendStats(s); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	for _, c := range []struct {
+		rate float64
+		want string
+	}{
+		{0, "0 B/s"},
+		{1023, "1023 B/s"},
+		{1024, "1.0 KiB/s"},
+		{12.3 * (1 << 20), "12.3 MiB/s"},
+		{1 << 30, "1.0 GiB/s"},
+		{1 << 40, "1.0 TiB/s"},
+	} {
+		if got := FormatRate(c.rate); got != c.want {
+			t.Errorf("want %q, got %q", c.want, got)
+		}
+	}
+}
+
 func TestFormatPercent(t *testing.T) {
 	for _, c := range []struct {
 		num, denom uint64
@@ -0,0 +1,17 @@
+package progress
+
+import "time"
+
+// EstimateSecondsRemaining returns the estimated number of seconds until
+// processed reaches total, based on the average rate since start. The skipped
+// units are included in processed, but were not processed during elapsed
+// (e.g. because they were already present), they are not taken into account
+// for the rate. It returns zero if no estimate is possible.
+func EstimateSecondsRemaining(total, processed, skipped uint64, elapsed time.Duration) uint64 {
+	if skipped >= processed || processed >= total || elapsed <= 0 {
+		return 0
+	}
+
+	todo := float64(total - processed)
+	return uint64(elapsed.Seconds() / float64(processed-skipped) * todo)
+}
@@ -0,0 +1,28 @@
+package progress_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+func TestEstimateSecondsRemaining(t *testing.T) {
+	for _, test := range []struct {
+		total, processed, skipped uint64
+		elapsed                   time.Duration
+		secs                      uint64
+	}{
+		{100, 0, 0, time.Second, 0},
+		{100, 50, 0, 10 * time.Second, 10},
+		{100, 60, 40, 10 * time.Second, 20},
+		{100, 40, 40, 10 * time.Second, 0},
+		{100, 100, 0, 10 * time.Second, 0},
+		{100, 50, 0, 0, 0},
+	} {
+		secs := progress.EstimateSecondsRemaining(test.total, test.processed, test.skipped, test.elapsed)
+		if secs != test.secs {
+			t.Errorf("%+v: want %v seconds, got %v", test, test.secs, secs)
+		}
+	}
+}
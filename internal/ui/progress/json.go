@@ -0,0 +1,44 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// JSONPrinter prints JSON messages to a terminal. It is safe to call its
+// methods from concurrent goroutines, the messages are never interleaved.
+type JSONPrinter struct {
+	term *termstatus.Terminal
+	mu   sync.Mutex
+}
+
+// NewJSONPrinter returns a new JSONPrinter which prints to term.
+func NewJSONPrinter(term *termstatus.Terminal) *JSONPrinter {
+	return &JSONPrinter{term: term}
+}
+
+func toJSONString(msg interface{}) string {
+	buf := new(bytes.Buffer)
+	err := json.NewEncoder(buf).Encode(msg)
+	if err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+// Print prints msg to stdout.
+func (p *JSONPrinter) Print(msg interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.term.Print(toJSONString(msg))
+}
+
+// PrintError prints msg to stderr.
+func (p *JSONPrinter) PrintError(msg interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.term.Error(toJSONString(msg))
+}
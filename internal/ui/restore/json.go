@@ -0,0 +1,145 @@
+package restore
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/backend/accounting"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// JSONProgress reports progress for the `restore` command in JSON.
+type JSONProgress struct {
+	*ui.Message
+
+	out *progress.JSONPrinter
+}
+
+// assert that JSONProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &JSONProgress{}
+
+// NewJSONProgress returns a new restore progress reporter.
+func NewJSONProgress(term *termstatus.Terminal, verbosity uint) *JSONProgress {
+	return &JSONProgress{
+		Message: ui.NewMessage(term, verbosity),
+		out:     progress.NewJSONPrinter(term),
+	}
+}
+
+// Update updates the status lines.
+func (t *JSONProgress) Update(start time.Time, s *Summary, secs uint64) {
+	status := statusUpdate{
+		MessageType:      "status",
+		SecondsElapsed:   uint64(time.Since(start) / time.Second),
+		SecondsRemaining: secs,
+		TotalFiles:       s.Total.Files,
+		FilesRestored:    s.Processed.Files,
+		FilesSkipped:     s.Skipped.Files,
+		FilesFiltered:    s.Filtered.Files,
+		FilesVerified:    s.Verified.Files,
+		TotalBytes:       s.Total.Bytes,
+		BytesRestored:    s.Processed.Bytes,
+		BytesSkipped:     s.Skipped.Bytes,
+		ErrorCount:       s.Errors,
+	}
+
+	if s.Total.Bytes > 0 {
+		status.PercentDone = float64(s.Processed.Bytes) / float64(s.Total.Bytes)
+	}
+
+	t.out.Print(status)
+}
+
+// Error is the error callback function for the restorer, it prints the error
+// and returns nil.
+func (t *JSONProgress) Error(item string, err error) error {
+	t.out.PrintError(errorUpdate{
+		MessageType: "error",
+		Error:       err.Error(),
+		During:      "restore",
+		Item:        item,
+	})
+	return nil
+}
+
+// Reset no-op
+func (t *JSONProgress) Reset() {
+}
+
+// Finish prints the finishing messages.
+func (t *JSONProgress) Finish(start time.Time, s *Summary) {
+	for _, m := range s.Mismatches {
+		t.out.PrintError(errorUpdate{
+			MessageType: "error",
+			Error:       m.Error,
+			During:      "verify",
+			Item:        m.Item,
+		})
+	}
+
+	t.out.Print(summaryOutput{
+		MessageType:   "summary",
+		TotalDuration: time.Since(start).Seconds(),
+		TotalFiles:    s.Total.Files,
+		FilesRestored: s.Processed.Files,
+		FilesSkipped:  s.Skipped.Files,
+		FilesFiltered: s.Filtered.Files,
+		TotalBytes:    s.Total.Bytes,
+		BytesRestored: s.Processed.Bytes,
+		BytesSkipped:  s.Skipped.Bytes,
+		BytesFiltered: s.Filtered.Bytes,
+		FilesResumed:  s.Resumed.Files,
+		BytesResumed:  s.Resumed.Bytes,
+		FilesVerified: s.Verified.Files,
+		BytesVerified: s.Verified.Bytes,
+		Mismatches:    uint(len(s.Mismatches)),
+		ErrorCount:    s.Errors,
+		BytesSparse:   s.SparseBytes,
+		Backend:       s.Backend,
+	})
+}
+
+type statusUpdate struct {
+	MessageType      string  `json:"message_type"` // "status"
+	SecondsElapsed   uint64  `json:"seconds_elapsed,omitempty"`
+	SecondsRemaining uint64  `json:"seconds_remaining,omitempty"`
+	PercentDone      float64 `json:"percent_done"`
+	TotalFiles       uint64  `json:"total_files,omitempty"`
+	FilesRestored    uint64  `json:"files_restored,omitempty"`
+	FilesSkipped     uint64  `json:"files_skipped,omitempty"`
+	FilesFiltered    uint64  `json:"files_filtered,omitempty"`
+	FilesVerified    uint64  `json:"files_verified,omitempty"`
+	TotalBytes       uint64  `json:"total_bytes,omitempty"`
+	BytesRestored    uint64  `json:"bytes_restored,omitempty"`
+	BytesSkipped     uint64  `json:"bytes_skipped,omitempty"`
+	ErrorCount       uint    `json:"error_count,omitempty"`
+}
+
+type errorUpdate struct {
+	MessageType string `json:"message_type"` // "error"
+	Error       string `json:"error"`
+	During      string `json:"during"`
+	Item        string `json:"item"`
+}
+
+type summaryOutput struct {
+	MessageType   string            `json:"message_type"`   // "summary"
+	TotalDuration float64           `json:"total_duration"` // in seconds
+	TotalFiles    uint64            `json:"total_files"`
+	FilesRestored uint64            `json:"files_restored"`
+	FilesSkipped  uint64            `json:"files_skipped"`
+	FilesFiltered uint64            `json:"files_filtered"`
+	TotalBytes    uint64            `json:"total_bytes"`
+	BytesRestored uint64            `json:"bytes_restored"`
+	BytesSkipped  uint64            `json:"bytes_skipped"`
+	BytesFiltered uint64            `json:"bytes_filtered"`
+	FilesResumed  uint64            `json:"files_resumed,omitempty"`
+	BytesResumed  uint64            `json:"bytes_resumed,omitempty"`
+	FilesVerified uint64            `json:"files_verified,omitempty"`
+	BytesVerified uint64            `json:"bytes_verified,omitempty"`
+	Mismatches    uint              `json:"verify_mismatches,omitempty"`
+	ErrorCount    uint              `json:"error_count"`
+	BytesSparse   uint64            `json:"bytes_sparse,omitempty"`
+	Backend       *accounting.Stats `json:"backend,omitempty"`
+}
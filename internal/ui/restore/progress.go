@@ -0,0 +1,282 @@
+package restore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/backend/accounting"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/restic/restic/internal/ui/signals"
+)
+
+// A ProgressPrinter can print various progress messages.
+// It must be safe to call its methods from concurrent goroutines.
+type ProgressPrinter interface {
+	Update(start time.Time, summary *Summary, secs uint64)
+	Error(item string, err error) error
+	Finish(start time.Time, summary *Summary)
+	Reset()
+
+	P(msg string, args ...interface{})
+	V(msg string, args ...interface{})
+}
+
+// Counter tracks a number of files and bytes.
+type Counter struct {
+	Files, Bytes uint64
+}
+
+// Mismatch is a restored file for which the verification failed.
+type Mismatch struct {
+	Item  string
+	Error string
+}
+
+// Summary contains the statistics of the restore.
+type Summary struct {
+	Total, Processed, Skipped Counter
+	// Resumed counts the files which have been restored completely by a
+	// previous, interrupted restore
+	Resumed Counter
+	// Filtered counts the files which are not restored because of the
+	// include and exclude patterns
+	Filtered Counter
+	// Verified counts the files which have been verified successfully after
+	// the restore, Mismatches lists the files for which the verification
+	// failed
+	Verified   Counter
+	Mismatches []Mismatch
+	Errors     uint
+	// SparseBytes is the number of bytes which were not written to sparse
+	// files
+	SparseBytes uint64
+	// Backend contains the counters of the backend, it is nil if they were
+	// not recorded
+	Backend *accounting.Stats
+}
+
+// Progress reports progress for the `restore` command.
+type Progress struct {
+	mu sync.Mutex
+
+	interval time.Duration
+	start    time.Time
+
+	// bytesWritten tracks the files which are currently being written
+	bytesWritten map[string]uint64
+	summary      Summary
+
+	closed chan struct{}
+
+	printer ProgressPrinter
+}
+
+// NewProgress returns a new restore progress reporter. If interval is zero,
+// the status is only printed when a signal is received.
+func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
+	return &Progress{
+		interval: interval,
+		start:    time.Now(),
+
+		bytesWritten: make(map[string]uint64),
+		closed:       make(chan struct{}),
+
+		printer: printer,
+	}
+}
+
+// Run regularly updates the status lines. It should be called in a separate
+// goroutine.
+func (p *Progress) Run(ctx context.Context) {
+	defer close(p.closed)
+	// Reset status when finished
+	defer p.printer.Reset()
+
+	var tick <-chan time.Time
+	if p.interval != 0 {
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	signalsCh := signals.GetProgressChannel()
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-tick:
+		case <-signalsCh:
+			now = time.Now()
+		}
+
+		p.mu.Lock()
+		secondsRemaining := progress.EstimateSecondsRemaining(p.summary.Total.Bytes, p.summary.Processed.Bytes,
+			p.summary.Skipped.Bytes+p.summary.Resumed.Bytes, now.Sub(p.start))
+		p.printer.Update(p.start, &p.summary, secondsRemaining)
+		p.mu.Unlock()
+	}
+}
+
+// AddFile adds a file of the given size to the set of files to restore.
+func (p *Progress) AddFile(size uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.summary.Total.Files++
+	p.summary.Total.Bytes += size
+}
+
+// AddProgress records that bytesWritten bytes of the file at location have
+// been written. The file is complete once size bytes have been written, files
+// without content are complete on the first call.
+func (p *Progress) AddProgress(location string, bytesWritten uint64, size uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	written := p.bytesWritten[location] + bytesWritten
+	p.summary.Processed.Bytes += bytesWritten
+
+	if written >= size {
+		delete(p.bytesWritten, location)
+		p.summary.Processed.Files++
+		return
+	}
+	p.bytesWritten[location] = written
+}
+
+// AddSkippedFile records that a file of the given size has not been restored
+// because its content already matches. The file must have been added with
+// AddFile before.
+func (p *Progress) AddSkippedFile(size uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.summary.Skipped.Files++
+	p.summary.Skipped.Bytes += size
+	p.summary.Processed.Files++
+	p.summary.Processed.Bytes += size
+}
+
+// AddResumedFile records that a file of the given size has not been restored
+// because a previous restore has restored it already. The file must have been
+// added with AddFile before.
+func (p *Progress) AddResumedFile(size uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.summary.Resumed.Files++
+	p.summary.Resumed.Bytes += size
+	p.summary.Processed.Files++
+	p.summary.Processed.Bytes += size
+}
+
+// AddFilteredFile records that a file of the given size is not restored
+// because it does not match the include and exclude patterns. In contrast to
+// AddSkippedFile, the file is not part of the files to restore.
+func (p *Progress) AddFilteredFile(size uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.summary.Filtered.Files++
+	p.summary.Filtered.Bytes += size
+}
+
+// AddVerifiedFile records that the content of a restored file of the given
+// size has been verified successfully.
+func (p *Progress) AddVerifiedFile(size uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.summary.Verified.Files++
+	p.summary.Verified.Bytes += size
+}
+
+// AddMismatch records that the verification of the restored file item failed
+// with err. Mismatches are not printed immediately but listed by Finish.
+func (p *Progress) AddMismatch(item string, err error) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.summary.Mismatches = append(p.summary.Mismatches, Mismatch{Item: item, Error: err.Error()})
+}
+
+// AddSparseBytes records that size bytes of zeros were not written to sparse
+// files.
+func (p *Progress) AddSparseBytes(size uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.summary.SparseBytes += size
+}
+
+// SetBackendStats records the backend counters, they are reported in the
+// summary.
+func (p *Progress) SetBackendStats(stats accounting.Stats) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.summary.Backend = &stats
+}
+
+// Error is the error callback function for the restorer, it prints the error
+// and returns nil.
+func (p *Progress) Error(item string, err error) error {
+	p.mu.Lock()
+	p.summary.Errors++
+	p.mu.Unlock()
+
+	return p.printer.Error(item, err)
+}
+
+// Finish prints the finishing messages.
+func (p *Progress) Finish() {
+	// wait for the status update goroutine to shut down
+	<-p.closed
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sort.Slice(p.summary.Mismatches, func(i, j int) bool {
+		return p.summary.Mismatches[i].Item < p.summary.Mismatches[j].Item
+	})
+	p.printer.Finish(p.start, &p.summary)
+}
@@ -0,0 +1,89 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockPrinter struct {
+	sync.Mutex
+	summary  Summary
+	finished bool
+}
+
+func (p *mockPrinter) Update(start time.Time, summary *Summary, secs uint64) {}
+func (p *mockPrinter) Error(item string, err error) error                    { return nil }
+
+func (p *mockPrinter) Finish(start time.Time, summary *Summary) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.summary = *summary
+	p.finished = true
+}
+
+func (p *mockPrinter) Reset() {}
+
+func (p *mockPrinter) P(msg string, args ...interface{}) {}
+func (p *mockPrinter) V(msg string, args ...interface{}) {}
+
+func TestProgress(t *testing.T) {
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go prog.Run(ctx)
+
+	prog.AddFile(100)
+	prog.AddFile(50)
+	prog.AddFile(0)
+	prog.AddFile(10)
+	prog.AddFile(30)
+
+	prog.AddProgress("/foo", 60, 100)
+	prog.AddProgress("/bar", 50, 50)
+	prog.AddProgress("/empty", 0, 0)
+	prog.AddSkippedFile(10)
+	prog.AddResumedFile(30)
+	prog.AddFilteredFile(20)
+	prog.AddVerifiedFile(50)
+	prog.AddMismatch("/foo", errors.New("mismatch foo"))
+	prog.AddMismatch("/baz", errors.New("mismatch baz"))
+	_ = prog.Error("/foo", errors.New("error"))
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	prog.Finish()
+
+	if !prnt.finished {
+		t.Fatal("Finish not called")
+	}
+	want := Summary{
+		Total:      Counter{Files: 5, Bytes: 190},
+		Processed:  Counter{Files: 4, Bytes: 150},
+		Skipped:    Counter{Files: 1, Bytes: 10},
+		Resumed:    Counter{Files: 1, Bytes: 30},
+		Filtered:   Counter{Files: 1, Bytes: 20},
+		Verified:   Counter{Files: 1, Bytes: 50},
+		Mismatches: []Mismatch{{"/baz", "mismatch baz"}, {"/foo", "mismatch foo"}},
+		Errors:     1,
+	}
+	if !reflect.DeepEqual(prnt.summary, want) {
+		t.Errorf("wrong summary, want %+v, got %+v", want, prnt.summary)
+	}
+}
+
+func TestProgressNil(t *testing.T) {
+	var prog *Progress
+	prog.AddFile(1)
+	prog.AddProgress("/foo", 1, 1)
+	prog.AddSkippedFile(1)
+	prog.AddResumedFile(1)
+	prog.AddFilteredFile(1)
+	prog.AddVerifiedFile(1)
+	prog.AddMismatch("/foo", errors.New("mismatch"))
+}
@@ -0,0 +1,108 @@
+package restore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// TextProgress reports progress for the `restore` command.
+type TextProgress struct {
+	*ui.Message
+
+	term *termstatus.Terminal
+}
+
+// assert that TextProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &TextProgress{}
+
+// NewTextProgress returns a new restore progress reporter.
+func NewTextProgress(term *termstatus.Terminal, verbosity uint) *TextProgress {
+	return &TextProgress{
+		Message: ui.NewMessage(term, verbosity),
+		term:    term,
+	}
+}
+
+// Update updates the status lines.
+func (t *TextProgress) Update(start time.Time, s *Summary, secs uint64) {
+	var eta, skippedFiles string
+	if secs > 0 {
+		eta = fmt.Sprintf(" ETA %s", ui.FormatSeconds(secs))
+	}
+	if s.Skipped.Files > 0 {
+		skippedFiles = fmt.Sprintf(", %d skipped", s.Skipped.Files)
+	}
+	if s.Filtered.Files > 0 {
+		skippedFiles += fmt.Sprintf(", %d filtered", s.Filtered.Files)
+	}
+	if s.Verified.Files > 0 {
+		skippedFiles += fmt.Sprintf(", %d verified", s.Verified.Files)
+	}
+
+	status := fmt.Sprintf("[%s] %s  %v files %s, total %v files %v, %d errors%s%s",
+		ui.FormatDuration(time.Since(start)),
+		ui.FormatPercent(s.Processed.Bytes, s.Total.Bytes),
+		s.Processed.Files,
+		ui.FormatBytes(s.Processed.Bytes),
+		s.Total.Files,
+		ui.FormatBytes(s.Total.Bytes),
+		s.Errors,
+		skippedFiles,
+		eta,
+	)
+
+	t.term.SetStatus([]string{status})
+}
+
+// Error is the error callback function for the restorer, it prints the error
+// and returns nil.
+func (t *TextProgress) Error(item string, err error) error {
+	t.E("ignoring error for %s: %s\n", item, err)
+	return nil
+}
+
+// Reset status
+func (t *TextProgress) Reset() {
+	if t.term.CanUpdateStatus() {
+		t.term.SetStatus([]string{""})
+	}
+}
+
+// Finish prints the finishing messages.
+func (t *TextProgress) Finish(start time.Time, s *Summary) {
+	t.P("Summary: Restored %d of %d files (%s of %s) in %s\n",
+		s.Processed.Files, s.Total.Files,
+		ui.FormatBytes(s.Processed.Bytes), ui.FormatBytes(s.Total.Bytes),
+		ui.FormatDuration(time.Since(start)),
+	)
+	if s.Skipped.Files > 0 {
+		t.P("Skipped %d files (%s) which were already up to date\n",
+			s.Skipped.Files, ui.FormatBytes(s.Skipped.Bytes))
+	}
+	if s.Resumed.Files > 0 {
+		t.P("Resumed %d files (%s) which were restored by a previous run\n",
+			s.Resumed.Files, ui.FormatBytes(s.Resumed.Bytes))
+	}
+	if s.Filtered.Files > 0 {
+		t.P("Skipped %d files (%s) which did not match the include and exclude patterns\n",
+			s.Filtered.Files, ui.FormatBytes(s.Filtered.Bytes))
+	}
+	if s.Verified.Files > 0 || len(s.Mismatches) > 0 {
+		t.P("Verified %d files (%s)\n", s.Verified.Files, ui.FormatBytes(s.Verified.Bytes))
+	}
+	if s.SparseBytes > 0 {
+		t.P("Created holes for %s of zeros in sparse files\n", ui.FormatBytes(s.SparseBytes))
+	}
+	if s.Backend != nil {
+		t.P("Backend: %s\n", ui.FormatBackendStats(*s.Backend))
+	}
+	if len(s.Mismatches) > 0 {
+		t.E("Verification failed for %d files:\n", len(s.Mismatches))
+		for _, m := range s.Mismatches {
+			t.E("  %s: %s\n", m.Item, m.Error)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package scrub
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// JSONProgress reports progress for the `scrub` command in JSON.
+type JSONProgress struct {
+	*ui.Message
+
+	out *progress.JSONPrinter
+}
+
+// assert that JSONProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &JSONProgress{}
+
+// NewJSONProgress returns a new scrub progress reporter.
+func NewJSONProgress(term *termstatus.Terminal, verbosity uint) *JSONProgress {
+	return &JSONProgress{
+		Message: ui.NewMessage(term, verbosity),
+		out:     progress.NewJSONPrinter(term),
+	}
+}
+
+// Update updates the status lines.
+func (t *JSONProgress) Update(total, processed Counter, errors uint, start time.Time, secs uint64) {
+	status := statusUpdate{
+		MessageType:      "status",
+		SecondsElapsed:   uint64(time.Since(start) / time.Second),
+		SecondsRemaining: secs,
+		TotalPacks:       total.Packs,
+		PacksVerified:    processed.Packs,
+		TotalBytes:       total.Bytes,
+		BytesVerified:    processed.Bytes,
+		ErrorCount:       errors,
+	}
+
+	if total.Bytes > 0 {
+		status.PercentDone = float64(processed.Bytes) / float64(total.Bytes)
+	}
+
+	t.out.Print(status)
+}
+
+// Error is the error callback function for the scrub, it prints the error
+// and returns nil.
+func (t *JSONProgress) Error(pack restic.ID, err error) error {
+	t.out.PrintError(errorUpdate{
+		MessageType: "error",
+		Error:       err.Error(),
+		During:      "scrub",
+		Item:        pack.String(),
+	})
+	return nil
+}
+
+// Reset no-op
+func (t *JSONProgress) Reset() {
+}
+
+// Finish prints the finishing messages.
+func (t *JSONProgress) Finish(total, processed Counter, corrupt []CorruptPack, start time.Time) {
+	summary := summaryOutput{
+		MessageType:   "summary",
+		TotalDuration: time.Since(start).Seconds(),
+		TotalPacks:    total.Packs,
+		PacksVerified: processed.Packs,
+		TotalBytes:    total.Bytes,
+		BytesVerified: processed.Bytes,
+		CorruptPacks:  []corruptPack{},
+	}
+	for _, pack := range corrupt {
+		summary.CorruptPacks = append(summary.CorruptPacks, corruptPack{ID: pack.ID, Error: pack.Err})
+	}
+
+	t.out.Print(summary)
+}
+
+type statusUpdate struct {
+	MessageType      string  `json:"message_type"` // "status"
+	SecondsElapsed   uint64  `json:"seconds_elapsed,omitempty"`
+	SecondsRemaining uint64  `json:"seconds_remaining,omitempty"`
+	PercentDone      float64 `json:"percent_done"`
+	TotalPacks       uint64  `json:"total_packs,omitempty"`
+	PacksVerified    uint64  `json:"packs_verified,omitempty"`
+	TotalBytes       uint64  `json:"total_bytes,omitempty"`
+	BytesVerified    uint64  `json:"bytes_verified,omitempty"`
+	ErrorCount       uint    `json:"error_count,omitempty"`
+}
+
+type errorUpdate struct {
+	MessageType string `json:"message_type"` // "error"
+	Error       string `json:"error"`
+	During      string `json:"during"`
+	Item        string `json:"item"`
+}
+
+type corruptPack struct {
+	ID    restic.ID `json:"id"`
+	Error string    `json:"error"`
+}
+
+type summaryOutput struct {
+	MessageType   string        `json:"message_type"`   // "summary"
+	TotalDuration float64       `json:"total_duration"` // in seconds
+	TotalPacks    uint64        `json:"total_packs"`
+	PacksVerified uint64        `json:"packs_verified"`
+	TotalBytes    uint64        `json:"total_bytes"`
+	BytesVerified uint64        `json:"bytes_verified"`
+	CorruptPacks  []corruptPack `json:"corrupt_packs"`
+}
@@ -0,0 +1,156 @@
+package scrub
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+	"github.com/restic/restic/internal/ui/signals"
+)
+
+// A ProgressPrinter can print various progress messages.
+// It must be safe to call its methods from concurrent goroutines.
+type ProgressPrinter interface {
+	Update(total, processed Counter, errors uint, start time.Time, secs uint64)
+	Error(pack restic.ID, err error) error
+	Finish(total, processed Counter, corrupt []CorruptPack, start time.Time)
+	Reset()
+
+	P(msg string, args ...interface{})
+	V(msg string, args ...interface{})
+}
+
+// Counter tracks a number of packs and bytes.
+type Counter struct {
+	Packs, Bytes uint64
+}
+
+// CorruptPack is a pack for which the verification failed.
+type CorruptPack struct {
+	ID  restic.ID
+	Err string
+}
+
+// Progress reports progress for the `scrub` command.
+type Progress struct {
+	mu sync.Mutex
+
+	interval time.Duration
+	start    time.Time
+
+	total, processed Counter
+	// resumed counts the packs which were verified by an interrupted scrub,
+	// they are ignored for estimating the remaining time
+	resumed Counter
+	corrupt []CorruptPack
+
+	closed chan struct{}
+
+	printer ProgressPrinter
+}
+
+// NewProgress returns a new scrub progress reporter. If interval is zero, the
+// status is only printed when a signal is received.
+func NewProgress(printer ProgressPrinter, interval time.Duration) *Progress {
+	return &Progress{
+		interval: interval,
+		start:    time.Now(),
+
+		closed: make(chan struct{}),
+
+		printer: printer,
+	}
+}
+
+// Run regularly updates the status lines. It should be called in a separate
+// goroutine.
+func (p *Progress) Run(ctx context.Context) {
+	defer close(p.closed)
+	// Reset status when finished
+	defer p.printer.Reset()
+
+	var tick <-chan time.Time
+	if p.interval != 0 {
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	signalsCh := signals.GetProgressChannel()
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-tick:
+		case <-signalsCh:
+			now = time.Now()
+		}
+
+		p.mu.Lock()
+		secondsRemaining := progress.EstimateSecondsRemaining(p.total.Bytes, p.processed.Bytes, p.resumed.Bytes, now.Sub(p.start))
+		p.printer.Update(p.total, p.processed, uint(len(p.corrupt)), p.start, secondsRemaining)
+		p.mu.Unlock()
+	}
+}
+
+// AddPack adds a pack of the given size to the set of packs to verify.
+func (p *Progress) AddPack(size uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total.Packs++
+	p.total.Bytes += size
+}
+
+// ResumePack records that a pack of the given size has been verified by an
+// interrupted scrub. The pack must have been added with AddPack before. If
+// msg is not empty, the verification failed with this error message.
+func (p *Progress) ResumePack(id restic.ID, size uint64, msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.resumed.Packs++
+	p.resumed.Bytes += size
+	p.processed.Packs++
+	p.processed.Bytes += size
+	if msg != "" {
+		p.corrupt = append(p.corrupt, CorruptPack{ID: id, Err: msg})
+	}
+}
+
+// CompletePack records that the pack id of the given size has been verified,
+// err is the result of the verification. Errors are printed.
+func (p *Progress) CompletePack(id restic.ID, size uint64, err error) error {
+	p.mu.Lock()
+	p.processed.Packs++
+	p.processed.Bytes += size
+	if err != nil {
+		p.corrupt = append(p.corrupt, CorruptPack{ID: id, Err: err.Error()})
+	}
+	p.mu.Unlock()
+
+	if err == nil {
+		return nil
+	}
+	return p.printer.Error(id, err)
+}
+
+// Finish prints the finishing messages.
+func (p *Progress) Finish() {
+	// wait for the status update goroutine to shut down
+	<-p.closed
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sort.Slice(p.corrupt, func(i, j int) bool {
+		return bytes.Compare(p.corrupt[i].ID[:], p.corrupt[j].ID[:]) < 0
+	})
+	p.printer.Finish(p.total, p.processed, p.corrupt, p.start)
+}
@@ -0,0 +1,87 @@
+package scrub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+type mockPrinter struct {
+	sync.Mutex
+	total, processed Counter
+	corrupt          []CorruptPack
+	errors           []restic.ID
+	finished         bool
+}
+
+func (p *mockPrinter) Update(total, processed Counter, errors uint, start time.Time, secs uint64) {
+}
+
+func (p *mockPrinter) Error(pack restic.ID, err error) error {
+	p.Lock()
+	defer p.Unlock()
+
+	p.errors = append(p.errors, pack)
+	return nil
+}
+
+func (p *mockPrinter) Finish(total, processed Counter, corrupt []CorruptPack, start time.Time) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.total, p.processed, p.corrupt = total, processed, corrupt
+	p.finished = true
+}
+
+func (p *mockPrinter) Reset() {}
+
+func (p *mockPrinter) P(msg string, args ...interface{}) {}
+func (p *mockPrinter) V(msg string, args ...interface{}) {}
+
+func TestProgress(t *testing.T) {
+	prnt := &mockPrinter{}
+	prog := NewProgress(prnt, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go prog.Run(ctx)
+
+	ids := []restic.ID{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	prog.AddPack(100)
+	prog.AddPack(50)
+	prog.AddPack(20)
+	prog.AddPack(10)
+
+	prog.ResumePack(ids[0], 100, "")
+	prog.ResumePack(ids[1], 50, "damaged")
+	_ = prog.CompletePack(ids[2], 20, nil)
+	_ = prog.CompletePack(ids[3], 10, errors.New("error"))
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	prog.Finish()
+
+	if !prnt.finished {
+		t.Fatal("Finish not called")
+	}
+	if prnt.total != (Counter{Packs: 4, Bytes: 180}) {
+		t.Errorf("wrong total %+v", prnt.total)
+	}
+	if prnt.processed != (Counter{Packs: 4, Bytes: 180}) {
+		t.Errorf("wrong processed %+v", prnt.processed)
+	}
+	if len(prnt.errors) != 1 || prnt.errors[0] != ids[3] {
+		t.Errorf("wrong errors printed %v", prnt.errors)
+	}
+	if len(prnt.corrupt) != 2 {
+		t.Fatalf("wrong number of corrupt packs %v", prnt.corrupt)
+	}
+	for _, pack := range prnt.corrupt {
+		if (pack.ID != ids[1] || pack.Err != "damaged") && (pack.ID != ids[3] || pack.Err != "error") {
+			t.Errorf("unexpected corrupt pack %v", pack)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package scrub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// TextProgress reports progress for the `scrub` command.
+type TextProgress struct {
+	*ui.Message
+
+	term *termstatus.Terminal
+}
+
+// assert that TextProgress implements the ProgressPrinter interface
+var _ ProgressPrinter = &TextProgress{}
+
+// NewTextProgress returns a new scrub progress reporter.
+func NewTextProgress(term *termstatus.Terminal, verbosity uint) *TextProgress {
+	return &TextProgress{
+		Message: ui.NewMessage(term, verbosity),
+		term:    term,
+	}
+}
+
+// Update updates the status lines.
+func (t *TextProgress) Update(total, processed Counter, errors uint, start time.Time, secs uint64) {
+	var eta string
+	if secs > 0 {
+		eta = fmt.Sprintf(" ETA %s", ui.FormatSeconds(secs))
+	}
+
+	status := fmt.Sprintf("[%s] %s  %v packs %s, total %v packs %v, %d errors%s",
+		ui.FormatDuration(time.Since(start)),
+		ui.FormatPercent(processed.Bytes, total.Bytes),
+		processed.Packs,
+		ui.FormatBytes(processed.Bytes),
+		total.Packs,
+		ui.FormatBytes(total.Bytes),
+		errors,
+		eta,
+	)
+
+	t.term.SetStatus([]string{status})
+}
+
+// Error is the error callback function for the scrub, it prints the error
+// and returns nil.
+func (t *TextProgress) Error(pack restic.ID, err error) error {
+	t.E("error: %v\n", err)
+	return nil
+}
+
+// Reset status
+func (t *TextProgress) Reset() {
+	if t.term.CanUpdateStatus() {
+		t.term.SetStatus([]string{""})
+	}
+}
+
+// Finish prints the finishing messages.
+func (t *TextProgress) Finish(total, processed Counter, corrupt []CorruptPack, start time.Time) {
+	t.P("Summary: Verified %d of %d packs (%s of %s) in %s\n",
+		processed.Packs, total.Packs,
+		ui.FormatBytes(processed.Bytes), ui.FormatBytes(total.Bytes),
+		ui.FormatDuration(time.Since(start)),
+	)
+
+	if len(corrupt) == 0 {
+		return
+	}
+
+	t.P("\n%d packs are damaged:\n", len(corrupt))
+	for _, pack := range corrupt {
+		t.P("  %v\n", pack.ID)
+	}
+	t.P("\nRun `restic rebuild-index --read-all-packs` to remove the damaged packs from the index.\n")
+}
@@ -16,9 +16,27 @@ func GetProgressChannel() <-chan os.Signal {
 	return signals.ch
 }
 
+// GetPauseChannel returns a channel which receives the signal used to toggle
+// pausing a running operation (SIGUSR2). Like for GetProgressChannel, only a
+// single listener receives each incoming signal. On Windows, no signals are
+// ever delivered.
+func GetPauseChannel() <-chan os.Signal {
+	pauseSignals.Once.Do(func() {
+		pauseSignals.ch = make(chan os.Signal, 1)
+		setupPauseSignals()
+	})
+
+	return pauseSignals.ch
+}
+
 // XXX The fact that signals is a single global variable means that only one
 // listener receives each incoming signal.
 var signals struct {
 	ch chan os.Signal
 	sync.Once
 }
+
+var pauseSignals struct {
+	ch chan os.Signal
+	sync.Once
+}
@@ -11,3 +11,7 @@ import (
 func setupSignals() {
 	signal.Notify(signals.ch, syscall.SIGINFO, syscall.SIGUSR1)
 }
+
+func setupPauseSignals() {
+	signal.Notify(pauseSignals.ch, syscall.SIGUSR2)
+}
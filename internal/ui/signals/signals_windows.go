@@ -1,3 +1,5 @@
 package signals
 
 func setupSignals() {}
+
+func setupPauseSignals() {}
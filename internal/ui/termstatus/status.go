@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
 	"unicode"
 
@@ -14,6 +15,32 @@ import (
 	"golang.org/x/text/width"
 )
 
+// StatusMode describes how status lines are displayed.
+type StatusMode int
+
+const (
+	// StatusLines prints each status update as regular lines. It is used when
+	// the output is not a terminal, e.g. in CI logs.
+	StatusLines StatusMode = iota
+	// StatusCarriageReturn updates a single status line in place, using only
+	// carriage returns and no cursor movement. It is used for terminals which
+	// don't support ANSI control sequences, e.g. with TERM=dumb.
+	StatusCarriageReturn
+	// StatusANSI updates several status lines in place using cursor control.
+	StatusANSI
+)
+
+// DetectStatusMode returns how status lines can be displayed on fd.
+func DetectStatusMode(fd uintptr) StatusMode {
+	if CanUpdateStatus(fd) {
+		return StatusANSI
+	}
+	if term.IsTerminal(int(fd)) {
+		return StatusCarriageReturn
+	}
+	return StatusLines
+}
+
 // Terminal is used to write messages and display status lines which can be
 // updated. When the output is redirected to a file, the status lines are not
 // printed.
@@ -25,7 +52,14 @@ type Terminal struct {
 	msg             chan message
 	status          chan status
 	canUpdateStatus bool
+	carriageReturn  bool
 	lastStatusLen   int
+	// lastStatusWidths holds the display width of each status line printed
+	// last, to find out how many lines they occupy after a resize
+	lastStatusWidths []int
+
+	// receives a signal when the terminal was resized
+	resize chan os.Signal
 
 	// will be closed when the goroutine which runs Run() terminates, so it'll
 	// yield a default value immediately
@@ -33,6 +67,7 @@ type Terminal struct {
 
 	clearCurrentLine func(io.Writer, uintptr)
 	moveCursorUp     func(io.Writer, uintptr, int)
+	terminalWidth    func(uintptr) int
 }
 
 type message struct {
@@ -51,7 +86,8 @@ type fder interface {
 // New returns a new Terminal for wr. A goroutine is started to update the
 // terminal. It is terminated when ctx is cancelled. When wr is redirected to
 // a file (e.g. via shell output redirection) or is just an io.Writer (not the
-// open *os.File for stdout), no status lines are printed. The status lines and
+// open *os.File for stdout), no status lines are printed. On terminals without
+// cursor control, a single status line is updated. The status lines and
 // normal output (via Print/Printf) are written to wr, error messages are
 // written to errWriter. If disableStatus is set to true, no status messages
 // are printed even if the terminal supports it.
@@ -63,18 +99,30 @@ func New(wr io.Writer, errWriter io.Writer, disableStatus bool) *Terminal {
 		msg:       make(chan message),
 		status:    make(chan status),
 		closed:    make(chan struct{}),
+		resize:    make(chan os.Signal, 1),
+
+		terminalWidth: terminalWidth,
 	}
 
 	if disableStatus {
 		return t
 	}
 
-	if d, ok := wr.(fder); ok && CanUpdateStatus(d.Fd()) {
+	d, ok := wr.(fder)
+	if !ok {
+		return t
+	}
+
+	switch DetectStatusMode(d.Fd()) {
+	case StatusANSI:
 		// only use the fancy status code when we're running on a real terminal.
 		t.canUpdateStatus = true
 		t.fd = d.Fd()
 		t.clearCurrentLine = clearCurrentLine(wr, t.fd)
 		t.moveCursorUp = moveCursorUp(wr, t.fd)
+	case StatusCarriageReturn:
+		t.carriageReturn = true
+		t.fd = d.Fd()
 	}
 
 	return t
@@ -82,17 +130,63 @@ func New(wr io.Writer, errWriter io.Writer, disableStatus bool) *Terminal {
 
 // CanUpdateStatus return whether the status output is updated in place.
 func (t *Terminal) CanUpdateStatus() bool {
-	return t.canUpdateStatus
+	return t.canUpdateStatus || t.carriageReturn
+}
+
+// StatusMode returns how the status lines are displayed.
+func (t *Terminal) StatusMode() StatusMode {
+	switch {
+	case t.canUpdateStatus:
+		return StatusANSI
+	case t.carriageReturn:
+		return StatusCarriageReturn
+	default:
+		return StatusLines
+	}
+}
+
+// Height returns the number of lines of the terminal, or zero if the status
+// output is not updated in place or the height cannot be determined.
+func (t *Terminal) Height() int {
+	if !t.canUpdateStatus {
+		return 0
+	}
+
+	_, height, err := term.GetSize(int(t.fd))
+	if err != nil || height <= 0 {
+		return 0
+	}
+	return height
+}
+
+// terminalWidth returns the number of columns of the terminal fd, or 80 if
+// the width cannot be determined.
+func terminalWidth(fd uintptr) int {
+	width, _, err := term.GetSize(int(fd))
+	if err != nil || width <= 0 {
+		// use 80 columns by default
+		return 80
+	}
+	return width
 }
 
 // Run updates the screen. It should be run in a separate goroutine. When
-// ctx is cancelled, the status lines are cleanly removed.
+// ctx is cancelled, the status lines are cleanly removed. When the terminal is
+// resized, the status lines are redrawn for the new width.
 func (t *Terminal) Run(ctx context.Context) {
 	defer close(t.closed)
+	if t.canUpdateStatus || t.carriageReturn {
+		notifyResize(t.resize)
+		defer signal.Stop(t.resize)
+	}
 	if t.canUpdateStatus {
 		t.run(ctx)
 		return
 	}
+	if t.carriageReturn {
+		t.runCarriageReturn(ctx)
+		return
+	}
 
 	t.runWithoutStatus(ctx)
 }
@@ -150,13 +244,52 @@ func (t *Terminal) run(ctx context.Context) {
 			status = status[:0]
 			status = append(status, stat.lines...)
 			t.writeStatus(status)
+
+		case <-t.resize:
+			if IsProcessBackground(t.fd) {
+				continue
+			}
+
+			// terminals which rewrap their content on resize may need more
+			// lines for the previous status, all of them must be cleared
+			t.lastStatusLen = statusRows(t.lastStatusWidths, t.terminalWidth(t.fd))
+			t.writeStatus(status)
+		}
+	}
+}
+
+// statusRows returns the number of lines of a terminal with the given width
+// which are occupied by status lines with the display widths.
+func statusRows(widths []int, width int) int {
+	rows := 0
+	for _, w := range widths {
+		rows++
+		if w > width {
+			rows += (w - 1) / width
 		}
 	}
+	return rows
+}
+
+// truncateStatus returns the status lines truncated to fit into width
+// columns, line breaks at the end of the lines are kept.
+func truncateStatus(status []string, width int) []string {
+	res := make([]string, 0, len(status))
+	for _, line := range status {
+		trimmed := strings.TrimRight(line, "\n")
+		truncated := Truncate(trimmed, width-2)
+		res = append(res, truncated+line[len(trimmed):])
+	}
+	return res
 }
 
 func (t *Terminal) writeStatus(status []string) {
 	statusLen := len(status)
-	status = append([]string{}, status...)
+	status = truncateStatus(status, t.terminalWidth(t.fd))
+	t.lastStatusWidths = t.lastStatusWidths[:0]
+	for _, line := range status {
+		t.lastStatusWidths = append(t.lastStatusWidths, displayWidth(strings.TrimRight(line, "\n")))
+	}
 	for i := len(status); i < t.lastStatusLen; i++ {
 		// clear no longer used status lines
 		status = append(status, "")
@@ -192,6 +325,86 @@ func (t *Terminal) writeStatus(status []string) {
 	}
 }
 
+// runCarriageReturn listens on the channels and keeps a single status line at
+// the bottom of the output. The line is overwritten after a carriage return,
+// left over characters of a longer previous line are replaced with spaces.
+func (t *Terminal) runCarriageReturn(ctx context.Context) {
+	var status string
+	for {
+		select {
+		case <-ctx.Done():
+			if !IsProcessBackground(t.fd) {
+				t.writeStatusLine("")
+			}
+			return
+
+		case msg := <-t.msg:
+			if IsProcessBackground(t.fd) {
+				continue
+			}
+			t.writeStatusLine("")
+
+			dst := io.Writer(t.wr)
+			if msg.err {
+				dst = t.errWriter
+			}
+			if _, err := io.WriteString(dst, msg.line); err != nil {
+				fmt.Fprintf(os.Stderr, "write failed: %v\n", err)
+				continue
+			}
+
+			t.writeStatusLine(status)
+
+		case stat := <-t.status:
+			if IsProcessBackground(t.fd) {
+				continue
+			}
+			status = strings.Join(stat.lines, "")
+			t.writeStatusLine(status)
+
+		case <-t.resize:
+			if IsProcessBackground(t.fd) {
+				continue
+			}
+			t.writeStatusLine(status)
+		}
+	}
+}
+
+// writeStatusLine replaces the current line with line and returns the cursor
+// to the first column if line is empty.
+func (t *Terminal) writeStatusLine(line string) {
+	if line == "" && t.lastStatusLen == 0 {
+		// nothing to clear
+		return
+	}
+
+	width := t.terminalWidth(t.fd)
+	line = Truncate(line, width-2)
+	lineLen := displayWidth(line)
+	out := "\r" + line
+	// the previous line may be wider than the terminal after a resize, don't
+	// pad beyond the end of the line
+	padLen := t.lastStatusLen
+	if padLen > width-2 {
+		padLen = width - 2
+	}
+	if lineLen < padLen {
+		out += strings.Repeat(" ", padLen-lineLen)
+	}
+	if line == "" {
+		out += "\r"
+	}
+	t.lastStatusLen = lineLen
+
+	if _, err := t.wr.WriteString(out); err != nil {
+		fmt.Fprintf(os.Stderr, "write failed: %v\n", err)
+	}
+	if err := t.wr.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "flush failed: %v\n", err)
+	}
+}
+
 // runWithoutStatus listens on the channels and just prints out the messages,
 // without status lines.
 func (t *Terminal) runWithoutStatus(ctx context.Context) {
@@ -316,6 +529,18 @@ func Truncate(s string, w int) string {
 	return s
 }
 
+// displayWidth returns the number of terminal cells occupied by s.
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w++
+		if r > unicode.MaxASCII && wideRune(r) {
+			w++
+		}
+	}
+	return w
+}
+
 // Guess whether r would occupy two terminal cells instead of one.
 // This cannot be determined exactly without knowing the terminal font,
 // so we treat all ambigous runes as full-width, i.e., two cells.
@@ -330,24 +555,19 @@ func (t *Terminal) SetStatus(lines []string) {
 		return
 	}
 
-	// only truncate interactive status output
-	var width int
-	if t.canUpdateStatus {
-		var err error
-		width, _, err = term.GetSize(int(t.fd))
-		if err != nil || width <= 0 {
-			// use 80 columns by default
-			width = 80
+	if t.carriageReturn {
+		// only a single line can be updated, so show all lines on it
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, "\n")
 		}
+		lines = []string{strings.Join(lines, "  ")}
 	}
 
-	// make sure that all lines have a line break and are not too long
+	// make sure that all lines have a line break, interactive status output
+	// is truncated to the terminal width when it is written, so that it can
+	// be redrawn for a new width after a resize
 	for i, line := range lines {
-		line = strings.TrimRight(line, "\n")
-		if width > 0 {
-			line = Truncate(line, width-2)
-		}
-		lines[i] = line + "\n"
+		lines[i] = strings.TrimRight(line, "\n") + "\n"
 	}
 
 	// make sure the last line does not have a line break
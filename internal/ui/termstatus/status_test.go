@@ -1,6 +1,106 @@
 package termstatus
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCarriageReturnStatus(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	term := New(buf, buf, false)
+	term.carriageReturn = true
+	// an invalid fd, the process is never considered to be in the background
+	term.fd = ^uintptr(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go term.Run(ctx)
+
+	term.SetStatus([]string{"[0:01] 10.00%", "file1"})
+	term.SetStatus([]string{"[0:02] 9%"})
+	term.Print("message")
+	cancel()
+	<-term.closed
+
+	want := "\r[0:01] 10.00%  file1" +
+		"\r[0:02] 9%           " +
+		"\r         \rmessage\n" +
+		"\r[0:02] 9%" +
+		"\r         \r"
+	if buf.String() != want {
+		t.Fatalf("wrong output, want %q, got %q", want, buf.String())
+	}
+	if term.StatusMode() != StatusCarriageReturn {
+		t.Fatalf("wrong status mode %v", term.StatusMode())
+	}
+}
+
+func TestStatusResize(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	term := New(buf, buf, false)
+	term.canUpdateStatus = true
+	// an invalid fd, the process is never considered to be in the background
+	term.fd = ^uintptr(0)
+	term.clearCurrentLine = posixClearCurrentLine
+	term.moveCursorUp = posixMoveCursorUp
+	// the terminal is resized after the first status was written
+	resized := false
+	term.terminalWidth = func(uintptr) int {
+		if !resized {
+			resized = true
+			return 40
+		}
+		return 10
+	}
+	// unbuffered, so that the resize is handled before the context is cancelled
+	term.resize = make(chan os.Signal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go term.Run(ctx)
+
+	status := strings.Repeat("a", 30)
+	term.SetStatus([]string{status, "file1"})
+	term.resize <- os.Interrupt
+	cancel()
+	<-term.closed
+
+	clear := posixControlMoveCursorHome + posixControlClearLine
+	up := func(n int) string {
+		return posixControlMoveCursorHome + strings.Repeat(posixControlMoveCursorUp, n)
+	}
+	want := clear + status + "\n" + clear + "file1" + up(1) +
+		// the first status line now occupies three lines, so four are cleared
+		clear + "aaaaaaaa\n" + clear + "file1\n" + clear + "\n" + clear + up(3) +
+		clear + "\n" + clear + "\n" + up(2)
+	if buf.String() != want {
+		t.Fatalf("wrong output, want %q, got %q", want, buf.String())
+	}
+}
+
+func TestStatusRows(t *testing.T) {
+	var tests = []struct {
+		widths []int
+		width  int
+		rows   int
+	}{
+		{nil, 80, 0},
+		{[]int{0}, 80, 1},
+		{[]int{10, 20}, 80, 2},
+		{[]int{80}, 80, 1},
+		{[]int{81}, 80, 2},
+		{[]int{30, 5}, 10, 4},
+	}
+
+	for _, test := range tests {
+		rows := statusRows(test.widths, test.width)
+		if rows != test.rows {
+			t.Errorf("wrong number of rows for %v with width %d: want %d, got %d",
+				test.widths, test.width, test.rows, rows)
+		}
+	}
+}
 
 func TestTruncate(t *testing.T) {
 	var tests = []struct {
@@ -6,6 +6,8 @@ package termstatus
 import (
 	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"golang.org/x/term"
 )
@@ -34,3 +36,8 @@ func CanUpdateStatus(fd uintptr) bool {
 	// TODO actually read termcap db and detect if terminal supports what we need
 	return term != "dumb"
 }
+
+// notifyResize relays the signal sent when the terminal is resized to ch.
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
@@ -5,6 +5,7 @@ package termstatus
 
 import (
 	"io"
+	"os"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -126,3 +127,7 @@ func CanUpdateStatus(fd uintptr) bool {
 
 	return false
 }
+
+// notifyResize does nothing, there is no signal when a console window is
+// resized. The status lines are truncated to the new width on the next update.
+func notifyResize(ch chan<- os.Signal) {}